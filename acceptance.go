@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AcceptanceTracker makes cleaners confirm they have seen their assignments,
+// so a notification that went out but was never read does not go unnoticed.
+// Every minute it:
+//
+//   - sends each cleaner the pending assignments (today or later) nobody has
+//     asked them to accept yet, with an "acc:all" button, and stamps
+//     accept_requested_at;
+//   - flags to the managers those still not accepted ASSIGNMENT_ACCEPT_MINUTES
+//     after the request (ASSIGNMENT_ACCEPT_UNSEEN_MINUTES for cleaners who
+//     have not opened the bot today, users.last_seen_at), stamping
+//     accept_flagged_at so each is flagged once.
+//
+// The button and the accept_assignments tool set accepted_at. Assignments a
+// cleaner took themselves, or started working on, count as accepted, and a
+// reassignment starts over (assignment_acceptance trigger, db/rls.sql).
+//
+// Configure via env:
+//
+//	ASSIGNMENT_ACCEPT_MINUTES=60          minutes to accept before managers are told; 0 disables
+//	ASSIGNMENT_ACCEPT_UNSEEN_MINUTES=20   the same for cleaners not seen today
+type AcceptanceTracker struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	window    int // minutes, 0 = disabled
+	unseen    int // minutes, for cleaners not seen today
+}
+
+func newAcceptanceTracker(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *AcceptanceTracker {
+	return &AcceptanceTracker{
+		adminPool: adminPool,
+		registry:  registry,
+		botToken:  botToken,
+		window:    envInt("ASSIGNMENT_ACCEPT_MINUTES", 60),
+		unseen:    envInt("ASSIGNMENT_ACCEPT_UNSEEN_MINUTES", 20),
+	}
+}
+
+// seenTodaySQL is true when the user (alias u) wrote to the bot today.
+const seenTodaySQL = `COALESCE(u.last_seen_at >= date_trunc('day', now() AT TIME ZONE 'Europe/Rome') AT TIME ZONE 'Europe/Rome', false)`
+
+// unseenWindow is the acceptance window of cleaners not seen today.
+func (t *AcceptanceTracker) unseenWindow() int {
+	if t.unseen > 0 && t.unseen < t.window {
+		return t.unseen
+	}
+	return t.window
+}
+
+// windowFor is the acceptance window of userID right now.
+func (t *AcceptanceTracker) windowFor(ctx context.Context, userID int64) int {
+	var seen bool
+	if err := t.adminPool.QueryRow(ctx,
+		`SELECT `+seenTodaySQL+` FROM users u WHERE u.telegram_id = $1`, userID).Scan(&seen); err != nil || seen {
+		return t.window
+	}
+	return t.unseenWindow()
+}
+
+// Register wires the accept button into the messenger.
+func (t *AcceptanceTracker) Register(m *routedMessenger) {
+	m.Handle("acc:", t.handleCallback)
+}
+
+// Tools returns the cleaners' accept_assignments tool.
+func (t *AcceptanceTracker) Tools() []agent.Tool {
+	return []agent.Tool{&acceptAssignmentsTool{tracker: t}}
+}
+
+// Start launches the request/flag loop.
+func (t *AcceptanceTracker) Start(ctx context.Context) {
+	if t.window <= 0 {
+		log.Printf("assignment acceptance: disabled (ASSIGNMENT_ACCEPT_MINUTES=%d)", t.window)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			t.request(ctx)
+			t.flag(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type acceptanceItem struct {
+	id        int64
+	hotelID   int
+	cleanerID int64
+	cleaner   string
+	room      string
+	date      time.Time
+	shift     string
+	kind      string
+}
+
+func (i acceptanceItem) line() string {
+	return fmt.Sprintf("• %s %s — camera %s, %s (%s)", italianWeekday(i.date.Weekday())[:3], i.date.Format("02/01"),
+		htmlpkg.EscapeString(i.room), i.kind, i.shift)
+}
+
+func scanAcceptanceItems(rows pgx.Rows) ([]acceptanceItem, error) {
+	defer rows.Close()
+	var items []acceptanceItem
+	for rows.Next() {
+		var i acceptanceItem
+		if err := rows.Scan(&i.id, &i.cleanerID, &i.cleaner, &i.room, &i.date, &i.shift, &i.kind, &i.hotelID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+// request asks each cleaner to accept their new assignments.
+func (t *AcceptanceTracker) request(ctx context.Context) {
+	rows, err := t.adminPool.Query(ctx,
+		`SELECT a.id, a.cleaner_id, COALESCE(u.name, ''), r.name, a.date, a.shift, a.type, a.hotel_id
+		 FROM assignments a
+		 JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 WHERE a.status = 'pending' AND a.accepted_at IS NULL AND a.accept_requested_at IS NULL
+		   AND a.date >= (now() AT TIME ZONE 'Europe/Rome')::date
+		 ORDER BY a.cleaner_id, a.date, a.shift, r.name`)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("assignment acceptance: query: %v", err)
+		}
+		return
+	}
+	items, err := scanAcceptanceItems(rows)
+	if err != nil {
+		log.Printf("assignment acceptance: scan: %v", err)
+		return
+	}
+	byCleaner := make(map[int64][]acceptanceItem)
+	var order []int64
+	for _, i := range items {
+		if _, ok := byCleaner[i.cleanerID]; !ok {
+			order = append(order, i.cleanerID)
+		}
+		byCleaner[i.cleanerID] = append(byCleaner[i.cleanerID], i)
+	}
+
+	buttons := [][]telegram.Button{{{Text: "✅ Accetto", CallbackData: "acc:all"}}}
+	for _, cleanerID := range order {
+		var sb strings.Builder
+		var ids []int64
+		sb.WriteString("📋 <b>Nuove assegnazioni</b>\n\n")
+		for _, i := range byCleaner[cleanerID] {
+			sb.WriteString(i.line() + "\n")
+			ids = append(ids, i.id)
+		}
+		fmt.Fprintf(&sb, "\nPremi <b>Accetto</b> per confermare di averle viste (entro %d minuti, poi avviso il manager).", t.windowFor(ctx, cleanerID))
+		// Stamped even when the send fails: the manager hears about it
+		// after the window like any other unanswered request.
+		if _, err := sendKeyboard(ctx, t.botToken, cleanerID, sb.String(), buttons); err != nil {
+			log.Printf("assignment acceptance: notify %d: %v", cleanerID, err)
+		}
+		if _, err := t.adminPool.Exec(ctx,
+			`UPDATE assignments SET accept_requested_at = now() WHERE id = ANY($1)`, ids,
+		); err != nil {
+			log.Printf("assignment acceptance: mark requested: %v", err)
+		}
+	}
+}
+
+// flag tells the managers about requests left unanswered past the window.
+func (t *AcceptanceTracker) flag(ctx context.Context) {
+	rows, err := t.adminPool.Query(ctx,
+		`WITH flagged AS (
+		   UPDATE assignments a SET accept_flagged_at = now()
+		   WHERE a.status = 'pending' AND a.accepted_at IS NULL AND a.accept_flagged_at IS NULL
+		     AND a.accept_requested_at < now() - make_interval(mins => CASE
+		           WHEN (SELECT `+seenTodaySQL+` FROM users u WHERE u.telegram_id = a.cleaner_id) THEN $1
+		           ELSE $2 END)
+		   RETURNING a.id, a.cleaner_id, a.room_id, a.date, a.shift, a.type, a.hotel_id
+		 )
+		 SELECT f.id, f.cleaner_id, COALESCE(u.name, f.cleaner_id::text), r.name, f.date, f.shift, f.type, f.hotel_id
+		 FROM flagged f
+		 JOIN rooms r ON r.id = f.room_id
+		 LEFT JOIN users u ON u.telegram_id = f.cleaner_id
+		 ORDER BY f.hotel_id, u.name, f.date, f.shift, r.name`, t.window, t.unseenWindow())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("assignment acceptance: flag: %v", err)
+		}
+		return
+	}
+	items, err := scanAcceptanceItems(rows)
+	if err != nil {
+		log.Printf("assignment acceptance: scan: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(items))
+	for _, i := range items {
+		ids = append(ids, i.cleanerID)
+	}
+	lastSeen := make(map[int64]*time.Time)
+	if rows, err := t.adminPool.Query(ctx,
+		`SELECT telegram_id, last_seen_at FROM users WHERE telegram_id = ANY($1)`, ids); err == nil {
+		for rows.Next() {
+			var id int64
+			var seen *time.Time
+			if rows.Scan(&id, &seen) == nil {
+				lastSeen[id] = seen
+			}
+		}
+		rows.Close()
+	}
+	// Items come ordered by property: each one's managers hear about their
+	// own staff only.
+	now := time.Now()
+	for start := 0; start < len(items); {
+		hotelID := items[start].hotelID
+		end := start
+		for end < len(items) && items[end].hotelID == hotelID {
+			end++
+		}
+		var sb strings.Builder
+		sb.WriteString("⏰ <b>Assegnazioni non accettate</b> in tempo:\n")
+		cleaner := ""
+		for _, i := range items[start:end] {
+			if i.cleaner != cleaner {
+				cleaner = i.cleaner
+				fmt.Fprintf(&sb, "\n<b>%s</b> (visto %s)\n", htmlpkg.EscapeString(cleaner), lastSeenLabel(lastSeen[i.cleanerID], now))
+			}
+			sb.WriteString(i.line() + "\n")
+		}
+		sb.WriteString("\nForse non hanno visto il messaggio: meglio sentirli o riassegnare.")
+		managers, err := managerIDs(ctx, t.adminPool, hotelID)
+		if err != nil {
+			log.Printf("assignment acceptance: %v", err)
+			return
+		}
+		for _, m := range managers {
+			if _, err := sendKeyboard(ctx, t.botToken, m, sb.String(), nil); err != nil {
+				log.Printf("assignment acceptance: notify manager %d: %v", m, err)
+			}
+		}
+		log.Printf("assignment acceptance: %d assignment(s) flagged to %d manager(s) of hotel %d", end-start, len(managers), hotelID)
+		start = end
+	}
+}
+
+// accept marks the pending assignments of the pool's user as accepted (ids
+// empty: all of them) and returns them. Those already flagged are reported
+// to the managers as a late acceptance.
+func (t *AcceptanceTracker) accept(ctx context.Context, db querier, ids []int64) ([]acceptanceItem, error) {
+	if ids == nil {
+		ids = []int64{} // NULL would match nothing
+	}
+	rows, err := db.Query(ctx,
+		`WITH accepted AS (
+		   UPDATE assignments SET accepted_at = now()
+		   WHERE cleaner_id = current_telegram_id() AND status = 'pending' AND accepted_at IS NULL
+		     AND (cardinality($1::bigint[]) = 0 OR id = ANY($1))
+		   RETURNING id, cleaner_id, room_id, date, shift, type, accept_flagged_at, hotel_id
+		 )
+		 SELECT a.id, a.cleaner_id, COALESCE(u.name, a.cleaner_id::text), r.name, a.date, a.shift, a.type, a.hotel_id
+		 FROM accepted a
+		 JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 ORDER BY a.date, a.shift, r.name`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("accept assignments: %w", err)
+	}
+	items, err := scanAcceptanceItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		t.notifyLate(ctx, items)
+	}
+	return items, nil
+}
+
+// notifyLate tells the managers when flagged assignments get accepted after all.
+func (t *AcceptanceTracker) notifyLate(ctx context.Context, items []acceptanceItem) {
+	ids := make([]int64, len(items))
+	for n, i := range items {
+		ids[n] = i.id
+	}
+	var late int
+	if err := t.adminPool.QueryRow(ctx,
+		`SELECT count(*) FROM assignments WHERE id = ANY($1) AND accept_flagged_at IS NOT NULL`, ids,
+	).Scan(&late); err != nil || late == 0 {
+		return
+	}
+	msg := fmt.Sprintf("✅ %s ha accettato in ritardo %d assegnazioni segnalate.", htmlpkg.EscapeString(items[0].cleaner), late)
+	managers, err := managerIDs(ctx, t.adminPool, items[0].hotelID)
+	if err != nil {
+		log.Printf("assignment acceptance: %v", err)
+		return
+	}
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, t.botToken, m, msg, nil); err != nil {
+			log.Printf("assignment acceptance: notify manager %d: %v", m, err)
+		}
+	}
+}
+
+func (t *AcceptanceTracker) handleCallback(ctx context.Context, u agent.Update) error {
+	tg := newBot(t.botToken)
+	// Runs as the cleaner: RLS limits the update to their own assignments.
+	db, err := t.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	items, err := t.accept(ctx, db, nil)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return tg.Send(ctx, u.ChatID, "Nessuna assegnazione da accettare: sei già a posto.")
+	}
+	return tg.Send(ctx, u.ChatID, fmt.Sprintf("✅ Grazie! %d assegnazioni accettate.", len(items)))
+}
+
+// ── accept_assignments ───────────────────────────────────────────────────────
+
+type acceptAssignmentsTool struct {
+	tracker *AcceptanceTracker
+}
+
+func (t *acceptAssignmentsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "accept_assignments",
+		Description: "Conferma di aver visto le proprie assegnazioni in attesa (come il pulsante Accetto). " +
+			"Senza assignment_ids accetta tutte quelle in attesa.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"assignment_ids": {"type": "array", "items": {"type": "integer"}, "description": "Assegnazioni da accettare (default: tutte quelle in attesa)"}
+			}
+		}`),
+	}
+}
+
+func (t *acceptAssignmentsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		AssignmentIDs []int64 `json:"assignment_ids"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	items, err := t.tracker.accept(context.Background(), db, in.AssignmentIDs)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "Nessuna assegnazione in attesa di accettazione.", nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d assegnazioni accettate:\n", len(items))
+	for _, i := range items {
+		fmt.Fprintf(&sb, "%s\n", strings.TrimPrefix(i.line(), "• "))
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Occupancy and revenue KPIs, computed in SQL over room-nights so the model
+// never has to improvise the aggregate queries:
+//
+//   - available room-nights: every room × every night of the range
+//   - sold room-nights: nights of confirmed reservations inside the range
+//   - revenue: amount_eur prorated on the nights inside the range
+//   - occupancy = sold / available, ADR = revenue / sold, RevPAR = revenue / available
+//
+// Rooms and reservations are read through the user's pool, so RLS keeps the
+// figures to the current hotel.
+
+// analyticsMaxDays bounds a report range to about two years of nights.
+const analyticsMaxDays = 731
+
+// roomNights is one group of a room-night aggregate.
+type roomNights struct {
+	group     string
+	available int
+	sold      int
+	revenue   float64
+	unpriced  int // sold nights of reservations without amount_eur
+}
+
+func (r roomNights) occupancy() float64 {
+	if r.available == 0 {
+		return 0
+	}
+	return float64(r.sold) * 100 / float64(r.available)
+}
+
+func (r roomNights) adr() float64 {
+	if r.sold == 0 {
+		return 0
+	}
+	return r.revenue / float64(r.sold)
+}
+
+func (r roomNights) revpar() float64 {
+	if r.available == 0 {
+		return 0
+	}
+	return r.revenue / float64(r.available)
+}
+
+func (r *roomNights) add(o roomNights) {
+	r.available += o.available
+	r.sold += o.sold
+	r.revenue += o.revenue
+	r.unpriced += o.unpriced
+}
+
+// roomNightGroups maps a group_by value to the SQL expression of its key.
+var roomNightGroups = map[string]string{
+	"day":       `to_char(k.night, 'YYYY-MM-DD')`,
+	"week":      `to_char(date_trunc('week', k.night), 'YYYY-MM-DD')`,
+	"month":     `to_char(k.night, 'YYYY-MM')`,
+	"room_type": `k.room_type`,
+}
+
+// loadRoomNights aggregates the nights from..to (both included) by groupBy,
+// one of the roomNightGroups keys.
+func loadRoomNights(ctx context.Context, db querier, from, to time.Time, groupBy string) ([]roomNights, error) {
+	key, ok := roomNightGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown group_by %q", groupBy)
+	}
+	rows, err := db.Query(ctx, fmt.Sprintf(
+		`WITH stock AS (
+		   SELECT d::date AS night, r.id AS room_id, COALESCE(t.name, '') AS room_type
+		   FROM generate_series($1::date, $2::date, interval '1 day') d
+		   CROSS JOIN rooms r
+		   LEFT JOIN room_types t ON t.id = r.room_type_id
+		 ), stays AS (
+		   SELECT res.room_id, res.amount_eur,
+		          (res.checkin_at AT TIME ZONE 'Europe/Rome')::date AS ci,
+		          (res.checkout_at AT TIME ZONE 'Europe/Rome')::date AS co
+		   FROM reservations res
+		   WHERE res.status = 'confirmed'
+		     AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= $2::date
+		     AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date > $1::date
+		 )
+		 SELECT %s AS grp,
+		        count(*),
+		        count(s.room_id),
+		        COALESCE(sum(s.amount_eur / (s.co - s.ci)), 0)::float8,
+		        count(s.room_id) FILTER (WHERE s.amount_eur IS NULL)
+		 FROM stock k
+		 LEFT JOIN stays s ON s.room_id = k.room_id AND s.ci <= k.night AND s.co > k.night
+		 GROUP BY grp
+		 ORDER BY grp`, key),
+		from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("query room nights: %w", err)
+	}
+	defer rows.Close()
+	var out []roomNights
+	for rows.Next() {
+		var r roomNights
+		if err := rows.Scan(&r.group, &r.available, &r.sold, &r.revenue, &r.unpriced); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// roomNightLabel renders a group key of groupBy for the chat.
+func roomNightLabel(groupBy, group string) string {
+	switch groupBy {
+	case "day":
+		if d, err := time.Parse("2006-01-02", group); err == nil {
+			return italianWeekday(d.Weekday())[:3] + " " + d.Format("02/01")
+		}
+	case "week":
+		if d, err := time.Parse("2006-01-02", group); err == nil {
+			return "settimana dal " + d.Format("02/01")
+		}
+	case "month":
+		if d, err := time.Parse("2006-01", group); err == nil {
+			return d.Format("01/2006")
+		}
+	case "room_type":
+		if group == "" {
+			return "senza tipologia"
+		}
+	}
+	return group
+}
+
+// parseReportRange reads the from/to arguments of a report (YYYY-MM-DD,
+// Rome calendar days): from defaults to from, to to defaultTo(from).
+func parseReportRange(fromArg, toArg string, from time.Time, defaultTo func(time.Time) time.Time, maxDays int) (time.Time, time.Time, error) {
+	loc := romeLocation()
+	if fromArg != "" {
+		d, err := time.ParseInLocation("2006-01-02", fromArg, loc)
+		if err != nil {
+			return from, from, fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+		}
+		from = d
+	}
+	to := defaultTo(from)
+	if toArg != "" {
+		d, err := time.ParseInLocation("2006-01-02", toArg, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+		}
+		to = d
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to is before from")
+	}
+	if to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		return from, to, fmt.Errorf("at most %d days per report", maxDays)
+	}
+	return from, to, nil
+}
+
+// ── revenue_report ───────────────────────────────────────────────────────────
+
+type revenueReportTool struct{}
+
+func (t *revenueReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "revenue_report",
+		Description: "KPI di ricavo su un periodo qualsiasi: notti disponibili e vendute, occupazione %, ricavi, " +
+			"ADR (ricavo medio per notte venduta) e RevPAR (ricavo per camera disponibile), per giorno, settimana, " +
+			"mese o tipologia di camera. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Prima notte YYYY-MM-DD (default: primo giorno del mese corrente)"},
+				"to": {"type": "string", "description": "Ultima notte YYYY-MM-DD (default: ultimo giorno del mese di from)"},
+				"group_by": {"type": "string", "enum": ["day", "week", "month", "room_type"], "description": "Raggruppamento (default: month)"}
+			}
+		}`),
+	}
+}
+
+func (t *revenueReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		GroupBy string `json:"group_by"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.GroupBy == "" {
+		in.GroupBy = "month"
+	}
+	if _, ok := roomNightGroups[in.GroupBy]; !ok {
+		return "", fmt.Errorf("group_by must be day, week, month or room_type")
+	}
+	now := time.Now().In(romeLocation())
+	monthEnd := func(from time.Time) time.Time {
+		return time.Date(from.Year(), from.Month()+1, 0, 0, 0, 0, 0, from.Location())
+	}
+	from, to, err := parseReportRange(in.From, in.To,
+		time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), monthEnd, analyticsMaxDays)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("revenue_report is only available to managers")
+	}
+	groups, err := loadRoomNights(bg, db, from, to, in.GroupBy)
+	if err != nil {
+		return "", err
+	}
+	if len(groups) == 0 {
+		return "Nessuna camera registrata.", nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "💶 Ricavi %s → %s\n", from.Format("02/01/2006"), to.Format("02/01/2006"))
+	var total roomNights
+	for _, g := range groups {
+		total.add(g)
+		fmt.Fprintf(&sb, "• %s: occupazione %.0f%% (%d/%d notti), ricavi %s, ADR %s, RevPAR %s\n",
+			roomNightLabel(in.GroupBy, g.group), g.occupancy(), g.sold, g.available,
+			euro(g.revenue), euro(g.adr()), euro(g.revpar()))
+	}
+	fmt.Fprintf(&sb, "Totale: occupazione %.1f%% (%d/%d notti), ricavi %s, ADR %s, RevPAR %s\n",
+		total.occupancy(), total.sold, total.available, euro(total.revenue), euro(total.adr()), euro(total.revpar()))
+	if total.unpriced > 0 {
+		fmt.Fprintf(&sb, "⚠️ %d notti vendute senza importo (amount_eur): ricavi, ADR e RevPAR sono sottostimati.\n", total.unpriced)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
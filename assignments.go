@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AutoAssigner creates the day's cleaning assignments from reservations:
+// a checkout clean for every departure and a stayover for every night in
+// between, skipping rooms that already have an assignment for the day.
+//
+// Tasks are balanced across cleaners by estimated minutes: the room's own
+// cleaning standard for that kind when a manager set one (cleaning_standard),
+// else the median time actually measured on that room and kind (started_at →
+// completed_at) once there are measuredMinSamples of them, otherwise a
+// checkout clean takes the room type's cleaning_minutes
+// (defaultCleaningMinutes for rooms without a type) and a stayover the same
+// scaled by the stayover/checkout weight ratio. The plan then says whether
+// each cleaner's minutes fit their shift. Rooms on the same floor go to the
+// same cleaner whenever that does not unbalance the day. On days with a staff
+// schedule (shifts.go) only the cleaners on shift get rooms, in their
+// scheduled shift; otherwise each cleaner works in their users.default_shift
+// (morning if unset). A property's rooms only ever go to its own cleaners.
+//
+// Configure via env:
+//
+//	DAILY_PLAN_TIME=07:00          generate and notify every morning, Europe/Rome
+//	                               (empty disables; the tool always works)
+//	ASSIGN_WEIGHT_CHECKOUT=3       relative effort of a checkout clean
+//	ASSIGN_WEIGHT_STAYOVER=1       relative effort of a stayover refresh
+//	ASSIGN_WEIGHT_DEEP_CLEAN=6     relative effort of a recurring deep clean
+type AutoAssigner struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+	weights   map[string]int
+}
+
+func newAutoAssigner(adminPool *pgxpool.Pool, botToken string) *AutoAssigner {
+	return &AutoAssigner{
+		adminPool: adminPool,
+		botToken:  botToken,
+		weights: map[string]int{
+			"checkout": envInt("ASSIGN_WEIGHT_CHECKOUT", 3),
+			"stayover": envInt("ASSIGN_WEIGHT_STAYOVER", 1),
+			// Recurring deep cleans (recurring.go).
+			"deep_clean": envInt("ASSIGN_WEIGHT_DEEP_CLEAN", 6),
+		},
+	}
+}
+
+// defaultCleaningMinutes is the checkout clean of a room without a type
+// (same as the room_types.cleaning_minutes default).
+const defaultCleaningMinutes = 45
+
+// minutes estimates a task of kind on a room whose checkout clean takes
+// cleaning minutes.
+func (a *AutoAssigner) minutes(kind string, cleaning int) int {
+	if kind == "checkout" {
+		return cleaning
+	}
+	return max(1, cleaning*a.weights[kind]/a.weights["checkout"])
+}
+
+// measuredMinSamples is how many timed cleans of a room and kind, over the
+// last measuredDays, replace the room type estimate with their median.
+const (
+	measuredMinSamples = 3
+	measuredDays       = 90
+)
+
+type measuredKey struct {
+	roomID int64
+	kind   string
+}
+
+// measured returns the known minutes per room and kind: the median measured
+// time, replaced by the room's cleaning standard where there is one.
+// Durations over four hours are left out: a task forgotten in progress, not
+// a clean.
+func (a *AutoAssigner) measured(ctx context.Context, db querier) (map[measuredKey]int, error) {
+	rows, err := db.Query(ctx,
+		`SELECT room_id, type,
+		        round(percentile_cont(0.5) WITHIN GROUP (ORDER BY extract(epoch FROM completed_at - started_at) / 60))::int
+		 FROM assignments
+		 WHERE status = 'done' AND completed_at > started_at
+		   AND completed_at - started_at <= interval '4 hours'
+		   AND date >= (now() AT TIME ZONE 'Europe/Rome')::date - $1::int
+		 GROUP BY room_id, type
+		 HAVING count(*) >= $2`, measuredDays, measuredMinSamples)
+	if err != nil {
+		return nil, fmt.Errorf("query measured times: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[measuredKey]int)
+	for rows.Next() {
+		var k measuredKey
+		var m int
+		if err := rows.Scan(&k.roomID, &k.kind, &m); err != nil {
+			return nil, err
+		}
+		out[k] = max(1, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `SELECT room_id, kind, minutes FROM cleaning_standards`)
+	if err != nil {
+		return nil, fmt.Errorf("query cleaning standards: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k measuredKey
+		var m int
+		if err := rows.Scan(&k.roomID, &k.kind, &m); err != nil {
+			return nil, err
+		}
+		out[k] = m
+	}
+	return out, rows.Err()
+}
+
+// estimate is the minutes of a task of kind on roomID: the room's standard or
+// measured time when known, otherwise from the room type's cleaning minutes.
+func (a *AutoAssigner) estimate(measured map[measuredKey]int, roomID int64, kind string, cleaning int) int {
+	if m, ok := measured[measuredKey{roomID, kind}]; ok {
+		return m
+	}
+	return a.minutes(kind, cleaning)
+}
+
+// Tools implements agent.ToolSet.
+func (a *AutoAssigner) Tools() []agent.Tool {
+	return []agent.Tool{&generateDailyPlanTool{assigner: a}, &occupancyReportTool{assigner: a}}
+}
+
+// Start launches the morning producer goroutine when DAILY_PLAN_TIME is set.
+func (a *AutoAssigner) Start(ctx context.Context) {
+	timeStr := envOr("DAILY_PLAN_TIME", "")
+	if timeStr == "" {
+		return
+	}
+	hour, min, ok := parseClock(timeStr)
+	if !ok {
+		log.Printf("daily plan: disabled (DAILY_PLAN_TIME=%q)", timeStr)
+		return
+	}
+	loc := romeLocation()
+
+	go func() {
+		for {
+			now := time.Now().In(loc)
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			log.Printf("daily plan: next run at %s", next.Format("2006-01-02 15:04 MST"))
+			select {
+			case <-ctx.Done():
+				log.Printf("daily plan: stopped")
+				return
+			case <-time.After(time.Until(next)):
+			}
+			day := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc)
+			plan, err := a.propose(ctx, day, 0)
+			if err != nil {
+				log.Printf("daily plan: %v", err)
+				continue
+			}
+			if err := a.commit(ctx, a.adminPool, plan); err != nil {
+				log.Printf("daily plan: %v", err)
+				continue
+			}
+			a.notify(ctx, day, plan)
+			log.Printf("daily plan: %d assignment(s) for %s", len(plan), day.Format("2006-01-02"))
+		}
+	}()
+}
+
+type assignCleaner struct {
+	id      int64
+	name    string
+	shift   string
+	hotelID int
+	load    int
+	// floors this cleaner already works on today.
+	floors map[int]bool
+}
+
+type assignTask struct {
+	roomID   int64
+	roomName string
+	hotelID  int
+	floor    int
+	kind     string
+	minutes  int
+}
+
+// cleanersOn returns the cleaners of property hotelID (0: every property)
+// working on day: those on shift when the day has a staff schedule, otherwise
+// every cleaner in their default shift, without the ones on approved absence.
+func (a *AutoAssigner) cleanersOn(ctx context.Context, day time.Time, hotelID int) ([]*assignCleaner, error) {
+	rows, err := a.adminPool.Query(ctx,
+		`SELECT u.telegram_id, COALESCE(u.name, ''), COALESCE(s.name, u.default_shift, 'morning'), u.hotel_id
+		 FROM users u
+		 LEFT JOIN shift_assignments sa ON sa.user_id = u.telegram_id AND sa.date = $1::date
+		 LEFT JOIN shifts s ON s.id = sa.shift_id
+		 WHERE u.role = 'cleaner' AND ($2::int = 0 OR u.hotel_id = $2)
+		   AND NOT EXISTS (SELECT 1 FROM staff_absences ab
+		                   WHERE ab.user_id = u.telegram_id AND ab.status = 'approved'
+		                     AND $1::date BETWEEN ab.from_date AND ab.to_date)
+		   AND (sa.id IS NOT NULL OR NOT EXISTS (SELECT 1 FROM shift_assignments x
+		                                         WHERE x.hotel_id = u.hotel_id AND x.date = $1::date))
+		 ORDER BY u.telegram_id`, day.Format("2006-01-02"), hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query cleaners: %w", err)
+	}
+	defer rows.Close()
+	var cleaners []*assignCleaner
+	for rows.Next() {
+		c := &assignCleaner{floors: make(map[int]bool)}
+		if err := rows.Scan(&c.id, &c.name, &c.shift, &c.hotelID); err != nil {
+			return nil, fmt.Errorf("scan cleaner: %w", err)
+		}
+		cleaners = append(cleaners, c)
+	}
+	return cleaners, rows.Err()
+}
+
+// propose drafts balanced assignments for day without writing anything, for
+// property hotelID (0: every property). Each property's rooms go to its own
+// cleaners only, balanced among them.
+func (a *AutoAssigner) propose(ctx context.Context, day time.Time, hotelID int) ([]planEntry, error) {
+	cleaners, err := a.cleanersOn(ctx, day, hotelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cleaners) == 0 {
+		return nil, nil
+	}
+	byID := make(map[int64]*assignCleaner)
+	byHotel := make(map[int][]*assignCleaner)
+	for _, c := range cleaners {
+		byID[c.id] = c
+		byHotel[c.hotelID] = append(byHotel[c.hotelID], c)
+	}
+
+	measured, err := a.measured(ctx, a.adminPool)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work already assigned today counts towards each cleaner's load.
+	if err := a.assigned(ctx, day, measured, byID); err != nil {
+		return nil, err
+	}
+
+	rows, err := a.adminPool.Query(ctx,
+		`SELECT r.id, r.name, r.hotel_id, r.floor,
+		        CASE WHEN (res.checkout_at AT TIME ZONE 'Europe/Rome')::date = $1 THEN 'checkout' ELSE 'stayover' END,
+		        COALESCE(t.cleaning_minutes, $2)
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 LEFT JOIN room_types t ON t.id = r.room_type_id
+		 WHERE res.status = 'confirmed' AND ($3::int = 0 OR r.hotel_id = $3)
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date < $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		   AND NOT EXISTS (SELECT 1 FROM assignments a
+		                   WHERE a.room_id = r.id AND a.date = $1 AND a.type IN ('checkout', 'stayover'))
+		 ORDER BY r.hotel_id, r.floor, r.name`, day, defaultCleaningMinutes, hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+	tasks := make(map[int][]assignTask)
+	var hotels []int
+	for rows.Next() {
+		var t assignTask
+		var cleaning int
+		if err := rows.Scan(&t.roomID, &t.roomName, &t.hotelID, &t.floor, &t.kind, &cleaning); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		t.minutes = a.estimate(measured, t.roomID, t.kind, cleaning)
+		if _, ok := tasks[t.hotelID]; !ok {
+			hotels = append(hotels, t.hotelID)
+		}
+		tasks[t.hotelID] = append(tasks[t.hotelID], t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+
+	var plan []planEntry
+	for _, h := range hotels {
+		if len(byHotel[h]) == 0 {
+			log.Printf("daily plan: hotel %d: %d room(s) to clean and no cleaner on shift", h, len(tasks[h]))
+			continue
+		}
+		plan = append(plan, balance(day, tasks[h], byHotel[h])...)
+	}
+	return plan, nil
+}
+
+// balance gives tasks to cleaners, all of one property, keeping floors
+// together as long as no cleaner goes too far over the even share.
+func balance(day time.Time, tasks []assignTask, cleaners []*assignCleaner) []planEntry {
+	total, longest := 0, 0
+	for _, t := range tasks {
+		total += t.minutes
+		longest = max(longest, t.minutes)
+	}
+	for _, c := range cleaners {
+		total += c.load
+	}
+	// A cleaner may go over the even share by at most the longest task to
+	// keep a floor together.
+	target := (total+len(cleaners)-1)/len(cleaners) + longest
+
+	// Heaviest tasks first within each floor so the balance stays tight.
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].floor != tasks[j].floor {
+			return tasks[i].floor < tasks[j].floor
+		}
+		return tasks[i].minutes > tasks[j].minutes
+	})
+
+	date := day.Format("2006-01-02")
+	var plan []planEntry
+	for _, t := range tasks {
+		w := t.minutes
+		var pick *assignCleaner
+		for _, c := range cleaners {
+			if c.floors[t.floor] && c.load+w <= target && (pick == nil || c.load < pick.load) {
+				pick = c
+			}
+		}
+		if pick == nil {
+			for _, c := range cleaners {
+				if pick == nil || c.load < pick.load {
+					pick = c
+				}
+			}
+		}
+		pick.load += w
+		pick.floors[t.floor] = true
+		plan = append(plan, planEntry{
+			Date: date, RoomID: t.roomID, RoomName: t.roomName,
+			CleanerID: pick.id, CleanerName: pick.name,
+			Type: t.kind, Shift: pick.shift, Minutes: t.minutes,
+		})
+	}
+	return plan
+}
+
+// assigned adds the estimated minutes and the floors of the assignments
+// already made on day to the cleaners of byID.
+func (a *AutoAssigner) assigned(ctx context.Context, day time.Time, measured map[measuredKey]int, byID map[int64]*assignCleaner) error {
+	rows, err := a.adminPool.Query(ctx,
+		`SELECT a.cleaner_id, a.room_id, a.type, r.floor, COALESCE(t.cleaning_minutes, $2)
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN room_types t ON t.id = r.room_type_id
+		 WHERE a.date = $1 AND a.status <> 'skipped'`, day, defaultCleaningMinutes)
+	if err != nil {
+		return fmt.Errorf("query existing: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, roomID int64
+		var kind string
+		var floor, cleaning int
+		if err := rows.Scan(&id, &roomID, &kind, &floor, &cleaning); err != nil {
+			return fmt.Errorf("scan existing: %w", err)
+		}
+		if c := byID[id]; c != nil {
+			c.load += a.estimate(measured, roomID, kind, cleaning)
+			c.floors[floor] = true
+		}
+	}
+	return rows.Err()
+}
+
+// shiftFit says, for every cleaner of property hotelID (0: every property)
+// working on day, whether the estimated minutes of their assignments (already
+// made, plus plan when it is not saved yet) fit the length of their shift.
+// over is how many are over it.
+func (a *AutoAssigner) shiftFit(ctx context.Context, day time.Time, hotelID int, plan []planEntry) (lines []string, over int, err error) {
+	cleaners, err := a.cleanersOn(ctx, day, hotelID)
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[int64]*assignCleaner)
+	for _, c := range cleaners {
+		byID[c.id] = c
+	}
+	measured, err := a.measured(ctx, a.adminPool)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := a.assigned(ctx, day, measured, byID); err != nil {
+		return nil, 0, err
+	}
+	for _, e := range plan {
+		if c := byID[e.CleanerID]; c != nil {
+			c.load += e.Minutes
+		}
+	}
+
+	type shiftKey struct {
+		hotelID int
+		name    string
+	}
+	length := make(map[shiftKey]int)
+	rows, err := a.adminPool.Query(ctx,
+		`SELECT hotel_id, name,
+		        (extract(epoch FROM ends_at - starts_at) / 60)::int + CASE WHEN ends_at > starts_at THEN 0 ELSE 1440 END
+		 FROM shifts`)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query shifts: %w", err)
+	}
+	for rows.Next() {
+		var k shiftKey
+		var m int
+		if err := rows.Scan(&k.hotelID, &k.name, &m); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		length[k] = m
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for _, c := range cleaners {
+		if c.load == 0 {
+			continue
+		}
+		shift := shiftNames[c.shift]
+		m, ok := length[shiftKey{c.hotelID, c.shift}]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("%s: ~%s (%s)", c.name, formatMinutes(c.load), shift))
+		case c.load > m:
+			over++
+			lines = append(lines, fmt.Sprintf("%s: ~%s su %s di %s ⚠️ %s oltre il turno",
+				c.name, formatMinutes(c.load), formatMinutes(m), shift, formatMinutes(c.load-m)))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: ~%s su %s di %s ✅", c.name, formatMinutes(c.load), formatMinutes(m), shift))
+		}
+	}
+	return lines, over, nil
+}
+
+// absent lists the cleaners of property hotelID left out of day's plan for an
+// approved absence, as "Name (ferie)".
+func (a *AutoAssigner) absent(ctx context.Context, day time.Time, hotelID int) ([]string, error) {
+	rows, err := a.adminPool.Query(ctx,
+		`SELECT DISTINCT COALESCE(u.name, u.telegram_id::text), ab.reason
+		 FROM staff_absences ab JOIN users u ON u.telegram_id = ab.user_id
+		 WHERE u.role = 'cleaner' AND u.hotel_id = $2
+		   AND ab.status = 'approved' AND $1::date BETWEEN ab.from_date AND ab.to_date
+		 ORDER BY 1`, day.Format("2006-01-02"), hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query absent cleaners: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name, reason string
+		if err := rows.Scan(&name, &reason); err != nil {
+			return nil, err
+		}
+		label := "malattia"
+		if reason == "leave" {
+			label = "ferie"
+		}
+		out = append(out, fmt.Sprintf("%s (%s)", name, label))
+	}
+	return out, rows.Err()
+}
+
+// commit inserts plan in one transaction on db (the manager's pool for the
+// tool, so RLS applies; the admin pool for the morning run).
+func (a *AutoAssigner) commit(ctx context.Context, db *pgxpool.Pool, plan []planEntry) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		for _, e := range plan {
+			// An absence approved since the proposal was made wins.
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO assignments (room_id, cleaner_id, date, shift, type)
+				 SELECT $1, $2, $3, $4, $5
+				 WHERE NOT EXISTS (SELECT 1 FROM staff_absences
+				                   WHERE user_id = $2 AND status = 'approved' AND $3::date BETWEEN from_date AND to_date)`,
+				e.RoomID, e.CleanerID, e.Date, e.Shift, e.Type,
+			)
+			if err != nil {
+				return fmt.Errorf("camera %s: %w", e.RoomName, err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("camera %s: %s risulta assente, rigenera il piano", e.RoomName, e.CleanerName)
+			}
+		}
+		return nil
+	})
+}
+
+// notify sends each cleaner the list of rooms assigned to them in plan,
+// with the guests' special requests for each room.
+func (a *AutoAssigner) notify(ctx context.Context, day time.Time, plan []planEntry) {
+	byCleaner := make(map[int64][]planEntry)
+	var order []int64
+	roomIDs := make([]int64, 0, len(plan))
+	for _, e := range plan {
+		if _, ok := byCleaner[e.CleanerID]; !ok {
+			order = append(order, e.CleanerID)
+		}
+		byCleaner[e.CleanerID] = append(byCleaner[e.CleanerID], e)
+		roomIDs = append(roomIDs, e.RoomID)
+	}
+	requests, err := guestRequestNotes(ctx, a.adminPool, day, roomIDs)
+	if err != nil {
+		log.Printf("daily plan: %v", err)
+	}
+	vips, err := vipNotes(ctx, a.adminPool, day, roomIDs)
+	if err != nil {
+		log.Printf("daily plan: %v", err)
+	}
+	tg := newBot(a.botToken)
+	for _, id := range order {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "🧹 Le tue camere per %s %s:\n", strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01"))
+		minutes := 0
+		for _, e := range byCleaner[id] {
+			fmt.Fprintf(&sb, "• %s — %s (%s)\n", e.RoomName, e.Type, e.Shift)
+			for _, v := range vips[e.RoomID] {
+				fmt.Fprintf(&sb, "   %s\n", v)
+			}
+			for _, r := range requests[e.RoomID] {
+				fmt.Fprintf(&sb, "   🛎 %s\n", r)
+			}
+			minutes += e.Minutes
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&sb, "Tempo stimato: %s\n", formatMinutes(minutes))
+		}
+		sb.WriteString("\nBuon lavoro! Scrivimi quando inizi e quando finisci ogni camera.")
+		if err := tg.Send(ctx, id, sb.String()); err != nil {
+			log.Printf("daily plan: notify %d: %v", id, err)
+		}
+	}
+}
+
+// ── generate_daily_plan ──────────────────────────────────────────────────────
+
+type generateDailyPlanTool struct {
+	assigner *AutoAssigner
+}
+
+func (t *generateDailyPlanTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "generate_daily_plan",
+		Description: "Genera automaticamente le assegnazioni di pulizia di un giorno a partire dalle prenotazioni " +
+			"(checkout e fermate), bilanciando il carico tra i cleaner e raggruppando per piano, poi avvisa ogni cleaner. " +
+			"Le camere già assegnate non vengono toccate. Con dry_run=true mostra solo la proposta. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {
+					"type": "string",
+					"description": "Giorno YYYY-MM-DD (default: oggi)"
+				},
+				"dry_run": {
+					"type": "boolean",
+					"description": "Se true, mostra la proposta senza salvarla né avvisare nessuno"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *generateDailyPlanTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Date   string `json:"date"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		day = d
+	}
+
+	bg := context.Background()
+	hotelID, err := hotelOf(bg, t.assigner.adminPool, ctx.UserID)
+	if err != nil {
+		return "", err
+	}
+	plan, err := t.assigner.propose(bg, day, hotelID)
+	if err != nil {
+		return "", err
+	}
+	if len(plan) == 0 {
+		return fmt.Sprintf("Nessuna camera da assegnare per il %s.", day.Format("02/01/2006")), nil
+	}
+
+	var sb strings.Builder
+	for _, e := range plan {
+		fmt.Fprintf(&sb, "  %s — %s, %s (%s, ~%d min)\n", e.RoomName, e.CleanerName, e.Type, e.Shift, e.Minutes)
+	}
+	if absent, err := t.assigner.absent(bg, day, hotelID); err != nil {
+		log.Printf("daily plan: %v", err)
+	} else if len(absent) > 0 {
+		fmt.Fprintf(&sb, "Esclusi perché assenti: %s.\n", strings.Join(absent, ", "))
+	}
+	if fit, over, err := t.assigner.shiftFit(bg, day, hotelID, plan); err != nil {
+		log.Printf("daily plan: %v", err)
+	} else if len(fit) > 0 {
+		sb.WriteString("Carico stimato rispetto al turno:\n")
+		for _, l := range fit {
+			fmt.Fprintf(&sb, "  %s\n", l)
+		}
+		if over > 0 {
+			sb.WriteString("Il piano non sta nei turni: valuta un cleaner in più, un turno più lungo o di rimandare le fermate.\n")
+		}
+	}
+	if in.DryRun {
+		return fmt.Sprintf("Proposta per il %s (%d camere, non salvata):\n%s", day.Format("02/01/2006"), len(plan), sb.String()), nil
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := t.assigner.commit(bg, db, plan); err != nil {
+		return "", fmt.Errorf("nessuna assegnazione salvata: %w", err)
+	}
+	t.assigner.notify(bg, day, plan)
+	return fmt.Sprintf("✅ %d assegnazioni create per il %s e cleaner avvisati:\n%s", len(plan), day.Format("02/01/2006"), sb.String()), nil
+}
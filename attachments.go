@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Attachments keeps the photos and files staff send to the bot. The SDK Poll
+// drops messages without text, so Poll here reads getUpdates itself (installed
+// with routedMessenger.PollWith): text and button updates come out as before,
+// photos are downloaded into ATTACHMENTS_DIR, recorded in the attachments
+// table, and reach the agent as their caption plus a line with the attachment
+// ids, so "c'è una macchia sul divano" + photo becomes a ticket with evidence.
+// Photos sent together (an album) become a single update. Files (documents,
+// e.g. a spreadsheet of reservations to import) are stored the same way with
+// kind 'document' and their original name.
+//
+// Configure via env:
+//
+//	ATTACHMENTS_DIR=attachments   where photo and document files are stored
+type Attachments struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	dir       string
+}
+
+// attachmentMaxBytes is the Bot API download limit.
+const attachmentMaxBytes = 20 << 20
+
+func newAttachments(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *Attachments {
+	return &Attachments{adminPool: adminPool, registry: registry, botToken: botToken,
+		dir: envOr("ATTACHMENTS_DIR", "attachments")}
+}
+
+type photoMsg struct {
+	From         *telegram.TelegramUser `json:"from,omitempty"`
+	Chat         telegram.TelegramChat  `json:"chat"`
+	Text         string                 `json:"text,omitempty"`
+	Caption      string                 `json:"caption,omitempty"`
+	MediaGroupID string                 `json:"media_group_id,omitempty"`
+	Photo        []struct {
+		FileID       string `json:"file_id"`
+		FileUniqueID string `json:"file_unique_id"`
+		FileSize     int64  `json:"file_size"`
+	} `json:"photo,omitempty"`
+	Document *struct {
+		FileID       string `json:"file_id"`
+		FileUniqueID string `json:"file_unique_id"`
+		FileName     string `json:"file_name"`
+		FileSize     int64  `json:"file_size"`
+	} `json:"document,omitempty"`
+}
+
+// Poll implements agent.Messenger's Poll like the SDK client, plus photos
+// and documents.
+func (a *Attachments) Poll(ctx context.Context, offset int64, timeoutSec int) ([]agent.Update, error) {
+	var raw []struct {
+		UpdateID      int64                   `json:"update_id"`
+		Message       *photoMsg               `json:"message,omitempty"`
+		CallbackQuery *telegram.CallbackQuery `json:"callback_query,omitempty"`
+	}
+	if err := botAPITimeout(ctx, a.botToken, "getUpdates", map[string]any{
+		"offset":          offset,
+		"timeout":         timeoutSec,
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &raw, time.Duration(timeoutSec+30)*time.Second); err != nil {
+		return nil, err
+	}
+
+	updates := make([]agent.Update, 0, len(raw))
+	albums := make(map[string]int) // media_group_id → index in updates
+	for _, u := range raw {
+		switch msg := u.Message; {
+		case msg != nil && msg.From != nil && len(msg.Photo) > 0:
+			// The last size is the largest.
+			p := msg.Photo[len(msg.Photo)-1]
+			note := a.store(ctx, msg.From.ID, "photo", p.FileID, p.FileUniqueID, "", msg.Caption)
+			if i, ok := albums[msg.MediaGroupID]; ok && msg.MediaGroupID != "" {
+				updates[i].Text = mergeAttachmentNote(updates[i].Text, note)
+				if msg.Caption != "" {
+					updates[i].Text = msg.Caption + "\n" + updates[i].Text
+				}
+				continue
+			}
+			text := note
+			if msg.Caption != "" {
+				text = msg.Caption + "\n" + note
+			}
+			if msg.MediaGroupID != "" {
+				albums[msg.MediaGroupID] = len(updates)
+			}
+			updates = append(updates, agent.Update{
+				UpdateID: u.UpdateID, UserID: msg.From.ID, ChatID: msg.Chat.ID, Text: text,
+			})
+		case msg != nil && msg.From != nil && msg.Document != nil:
+			d := msg.Document
+			text := a.store(ctx, msg.From.ID, "document", d.FileID, d.FileUniqueID, d.FileName, msg.Caption)
+			if msg.Caption != "" {
+				text = msg.Caption + "\n" + text
+			}
+			updates = append(updates, agent.Update{
+				UpdateID: u.UpdateID, UserID: msg.From.ID, ChatID: msg.Chat.ID, Text: text,
+			})
+		case msg != nil:
+			if msg.From == nil || msg.Text == "" {
+				continue
+			}
+			updates = append(updates, agent.Update{
+				UpdateID: u.UpdateID, UserID: msg.From.ID, ChatID: msg.Chat.ID, Text: msg.Text,
+			})
+		case u.CallbackQuery != nil:
+			if u.CallbackQuery.Data == "" || u.CallbackQuery.Message == nil {
+				continue
+			}
+			updates = append(updates, agent.Update{
+				UpdateID: u.UpdateID, UserID: u.CallbackQuery.From.ID,
+				ChatID: u.CallbackQuery.Message.Chat.ID, Text: u.CallbackQuery.Data,
+			})
+		}
+	}
+	return updates, nil
+}
+
+// attachmentNotePrefix starts the line the agent sees for stored photos,
+// documentNotePrefix the one for a stored file.
+const (
+	attachmentNotePrefix = "📎 Foto allegata: attachment_id "
+	documentNotePrefix   = "📎 File allegato: attachment_id "
+)
+
+// mergeAttachmentNote adds the ids of note to the attachment line of text.
+func mergeAttachmentNote(text, note string) string {
+	id := strings.TrimPrefix(note, attachmentNotePrefix)
+	if id == note || !strings.Contains(text, attachmentNotePrefix) {
+		return text + "\n" + note
+	}
+	return text + ", " + id
+}
+
+// store downloads and records one photo or document of userID and returns
+// the line that tells the agent about it. fileName is the document's
+// original name ("" for photos).
+func (a *Attachments) store(ctx context.Context, userID int64, kind, fileID, uniqueID, fileName, caption string) string {
+	what := "Foto non salvata"
+	if kind == "document" {
+		what = "File non salvato"
+	}
+	if !a.registry.IsRegistered(ctx, userID) {
+		return "📎 " + what + " (utente non registrato)."
+	}
+	data, remote, err := downloadFile(ctx, a.botToken, fileID, attachmentMaxBytes)
+	if err != nil {
+		log.Printf("attachments: download from %d: %v", userID, err)
+		return "📎 " + what + " (download non riuscito)."
+	}
+	ext := filepath.Ext(remote)
+	if fileName != "" {
+		ext = filepath.Ext(fileName)
+	}
+	name := uniqueID + strings.ToLower(ext)
+	if err := os.MkdirAll(a.dir, 0o750); err != nil {
+		log.Printf("attachments: %v", err)
+		return "📎 " + what + " (archivio non disponibile)."
+	}
+	if err := os.WriteFile(filepath.Join(a.dir, name), data, 0o640); err != nil {
+		log.Printf("attachments: %v", err)
+		return "📎 " + what + " (archivio non disponibile)."
+	}
+	var id int64
+	if err := a.adminPool.QueryRow(ctx,
+		`INSERT INTO attachments (hotel_id, uploaded_by, kind, file_id, file_unique_id, file_name, path, size_bytes, caption)
+		 SELECT hotel_id, telegram_id, $2, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, '') FROM users WHERE telegram_id = $1
+		 RETURNING id`, userID, kind, fileID, uniqueID, fileName, name, len(data), caption,
+	).Scan(&id); err != nil {
+		log.Printf("attachments: insert: %v", err)
+		return "📎 " + what + " (errore del database)."
+	}
+	if kind == "document" {
+		return fmt.Sprintf("%s%d (%s)", documentNotePrefix, id, fileName)
+	}
+	return fmt.Sprintf("%s%d", attachmentNotePrefix, id)
+}
+
+// read returns the original name and the content of a stored document,
+// looked up with the caller's pool so RLS scopes it to their property.
+func (a *Attachments) read(ctx context.Context, db querier, id int64) (string, []byte, error) {
+	var name, path string
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(file_name, path), path FROM attachments WHERE id = $1 AND kind = 'document'`, id,
+	).Scan(&name, &path)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, fmt.Errorf("file %d non trovato: manda di nuovo il file in chat", id)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("query attachment: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(a.dir, path))
+	if err != nil {
+		return "", nil, fmt.Errorf("read attachment %d: %w", id, err)
+	}
+	return name, data, nil
+}
+
+// Tools implements agent.ToolSet.
+func (a *Attachments) Tools() []agent.Tool {
+	return []agent.Tool{&attachPhotoTool{}, &showPhotosTool{botToken: a.botToken}}
+}
+
+// ── attach_photo ─────────────────────────────────────────────────────────────
+
+type attachPhotoTool struct{}
+
+func (t *attachPhotoTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "attach_photo",
+		Description: "Collega foto già inviate (attachment_id) a un'assegnazione o a un ticket di manutenzione, " +
+			"come prova di un danno o di un problema. Per un guasto nuovo usa open_ticket con attachments.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"attachments": {"type": "array", "items": {"type": "integer"}, "description": "attachment_id delle foto"},
+				"assignment_id": {"type": "integer", "description": "Assegnazione a cui collegarle"},
+				"ticket_id": {"type": "integer", "description": "Ticket a cui collegarle"}
+			},
+			"required": ["attachments"]
+		}`),
+	}
+}
+
+func (t *attachPhotoTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Attachments  []int64 `json:"attachments"`
+		AssignmentID *int64  `json:"assignment_id"`
+		TicketID     *int64  `json:"ticket_id"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Attachments) == 0 {
+		return "", fmt.Errorf("attachments is required")
+	}
+	if (in.AssignmentID == nil) == (in.TicketID == nil) {
+		return "", fmt.Errorf("give exactly one of assignment_id and ticket_id")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	target := ""
+	if in.AssignmentID != nil {
+		var room string
+		if err := db.QueryRow(bg,
+			`SELECT r.name FROM assignments a JOIN rooms r ON r.id = a.room_id WHERE a.id = $1`, *in.AssignmentID,
+		).Scan(&room); err != nil {
+			return "", fmt.Errorf("assegnazione %d non trovata", *in.AssignmentID)
+		}
+		target = fmt.Sprintf("all'assegnazione %d (camera %s)", *in.AssignmentID, room)
+	} else {
+		var exists bool
+		if err := db.QueryRow(bg,
+			`SELECT EXISTS (SELECT 1 FROM maintenance_tickets WHERE id = $1)`, *in.TicketID,
+		).Scan(&exists); err != nil || !exists {
+			return "", fmt.Errorf("ticket %d non trovato", *in.TicketID)
+		}
+		target = fmt.Sprintf("al ticket #%d", *in.TicketID)
+	}
+	// RLS lets only the uploader (or a manager) link a photo.
+	tag, err := db.Exec(bg,
+		`UPDATE attachments SET assignment_id = COALESCE($2, assignment_id), ticket_id = COALESCE($3, ticket_id)
+		 WHERE id = ANY($1)`, in.Attachments, in.AssignmentID, in.TicketID)
+	if err != nil {
+		return "", fmt.Errorf("link attachments: %w", err)
+	}
+	if n := tag.RowsAffected(); int(n) < len(in.Attachments) {
+		return fmt.Sprintf("📎 %d foto su %d collegate %s; le altre non esistono o non sono tue.", n, len(in.Attachments), target), nil
+	}
+	return fmt.Sprintf("📎 %d foto collegate %s.", len(in.Attachments), target), nil
+}
+
+// ── show_photos ──────────────────────────────────────────────────────────────
+
+type showPhotosTool struct {
+	botToken string
+}
+
+func (t *showPhotosTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "show_photos",
+		Description: "Invia in chat le foto allegate a un ticket, a un'assegnazione o indicate per attachment_id.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"ticket_id": {"type": "integer"},
+				"assignment_id": {"type": "integer"},
+				"attachments": {"type": "array", "items": {"type": "integer"}}
+			}
+		}`),
+	}
+}
+
+func (t *showPhotosTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		TicketID     *int64  `json:"ticket_id"`
+		AssignmentID *int64  `json:"assignment_id"`
+		Attachments  []int64 `json:"attachments"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.TicketID == nil && in.AssignmentID == nil && len(in.Attachments) == 0 {
+		return "", fmt.Errorf("give ticket_id, assignment_id or attachments")
+	}
+	if in.Attachments == nil {
+		in.Attachments = []int64{}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	rows, err := db.Query(bg,
+		`SELECT at.id, at.file_id, COALESCE(u.name, ''), to_char(at.created_at AT TIME ZONE 'Europe/Rome', 'DD/MM HH24:MI'),
+		        COALESCE(at.caption, '')
+		 FROM attachments at LEFT JOIN users u ON u.telegram_id = at.uploaded_by
+		 WHERE at.kind = 'photo' AND (at.ticket_id = $1 OR at.assignment_id = $2 OR at.id = ANY($3))
+		 ORDER BY at.created_at`, in.TicketID, in.AssignmentID, in.Attachments)
+	if err != nil {
+		return "", fmt.Errorf("query attachments: %w", err)
+	}
+	type photo struct {
+		id              int64
+		fileID, caption string
+	}
+	var photos []photo
+	for rows.Next() {
+		var p photo
+		var who, when, caption string
+		if err := rows.Scan(&p.id, &p.fileID, &who, &when, &caption); err != nil {
+			rows.Close()
+			return "", err
+		}
+		p.caption = fmt.Sprintf("#%d — %s, %s", p.id, who, when)
+		if caption != "" {
+			p.caption += "\n" + oneLine(caption)
+		}
+		photos = append(photos, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(photos) == 0 {
+		return "Nessuna foto.", nil
+	}
+	sent := 0
+	for _, p := range photos {
+		if err := sendPhoto(bg, t.botToken, ctx.ChatID, p.fileID, p.caption); err != nil {
+			log.Printf("show_photos: attachment %d: %v", p.id, err)
+			continue
+		}
+		sent++
+	}
+	return fmt.Sprintf("📷 %d foto inviate in chat.", sent), nil
+}
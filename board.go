@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// The front-desk board of a day: who arrives, who leaves and who stays, with
+// the room's state and parking spot for the arrivals, the cleaning of each
+// room and how many parking spots are free for the night. It is the
+// same multi-join every time, so today_board builds it once, with a fixed
+// layout, instead of the LLM composing the SQL on each question.
+
+// roomStatusLabels are the values of rooms.status, as the board shows them.
+var roomStatusLabels = map[string]string{
+	"available":      "libera e pulita",
+	"occupied":       "occupata",
+	"stayover_due":   "fermata da rifare",
+	"checkout_due":   "da pulire (partenza)",
+	"cleaning":       "in pulizia",
+	"inspection_due": "da ispezionare",
+	"ready":          "pronta",
+	"out_of_service": "fuori servizio",
+}
+
+// cleaningLabels are the values of assignments.status, as the board shows them.
+var cleaningLabels = map[string]string{
+	"pending":     "da fare",
+	"in_progress": "in corso",
+	"done":        "fatta",
+	"skipped":     "saltata",
+}
+
+// boardStay is a confirmed reservation touching the board's day.
+type boardStay struct {
+	id                  int64
+	room, roomStatus    string
+	guest, board        string
+	guests, children    int
+	vip                 bool
+	instructions        string
+	checkin, checkout   time.Time
+	cleaning, cleanedBy string
+	parking             string // parking spot label, "" = none
+}
+
+// ── today_board ──────────────────────────────────────────────────────────────
+
+type todayBoardTool struct{}
+
+func (t *todayBoardTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "today_board",
+		Description: "Tabellone di un giorno: arrivi (ospiti, trattamento, ora, VIP e stato della camera), partenze e " +
+			"fermate (notte N di M), con lo stato della pulizia di ogni camera, il posto auto degli arrivi, i posti auto " +
+			"liberi per la notte e il totale degli ospiti in casa. " +
+			"Usalo per 'chi arriva oggi?', 'chi parte domani?', 'com'è la situazione?' invece di execute_sql.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {"type": "string", "description": "Giorno, YYYY-MM-DD (default oggi)"}
+			}
+		}`),
+	}
+}
+
+func (t *todayBoardTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Date string `json:"date"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	day := today
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		day = d
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	stays, err := boardStays(context.Background(), db, day)
+	if err != nil {
+		return "", err
+	}
+	board := formatBoard(day, day.Equal(today), stays)
+	spots, err := parkingSpots(context.Background(), db, day.Add(18*time.Hour), day.AddDate(0, 0, 1).Add(9*time.Hour), 0)
+	if err != nil {
+		return "", err
+	}
+	if len(spots) > 0 {
+		free := 0
+		for _, s := range spots {
+			if s.reservation == 0 {
+				free++
+			}
+		}
+		board += fmt.Sprintf("\n🅿️ Posti auto liberi la notte del %s: %d di %d", day.Format("02/01"), free, len(spots))
+	}
+	return board, nil
+}
+
+// boardStays returns the confirmed stays touching day, with the room's
+// current status and the day's cleaning of the room (the latest shift).
+func boardStays(ctx context.Context, db querier, day time.Time) ([]boardStay, error) {
+	rows, err := db.Query(ctx,
+		`SELECT res.id, r.name, r.status, COALESCE(res.guest_name, 'ospite'), res.board,
+		        res.guests, res.children, res.vip, COALESCE(res.special_instructions, ''),
+		        res.checkin_at, res.checkout_at,
+		        COALESCE(a.status, ''), COALESCE(u.name, ''), COALESCE(p.label, '')
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 LEFT JOIN parking_spots p ON p.id = res.parking_spot_id
+		 LEFT JOIN LATERAL (
+		     SELECT a.status, a.cleaner_id FROM assignments a
+		     WHERE a.room_id = r.id AND a.date = $1
+		     ORDER BY array_position(ARRAY['morning', 'afternoon', 'evening'], a.shift) DESC, a.id DESC
+		     LIMIT 1) a ON true
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 WHERE res.status = 'confirmed'
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		 ORDER BY r.floor, r.name, res.checkin_at`, day)
+	if err != nil {
+		return nil, fmt.Errorf("query board: %w", err)
+	}
+	defer rows.Close()
+	var out []boardStay
+	for rows.Next() {
+		var s boardStay
+		if err := rows.Scan(&s.id, &s.room, &s.roomStatus, &s.guest, &s.board,
+			&s.guests, &s.children, &s.vip, &s.instructions,
+			&s.checkin, &s.checkout, &s.cleaning, &s.cleanedBy, &s.parking); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// formatBoard lays out the board of day; the room status of the arrivals is
+// only meaningful for today.
+func formatBoard(day time.Time, isToday bool, stays []boardStay) string {
+	loc := romeLocation()
+	sameDay := func(t time.Time) bool {
+		t = t.In(loc)
+		return t.Year() == day.Year() && t.YearDay() == day.YearDay()
+	}
+	cleaning := func(s boardStay) string {
+		if s.cleaning == "" {
+			return "pulizia non assegnata"
+		}
+		label := "pulizia " + cleaningLabels[s.cleaning]
+		if s.cleanedBy != "" {
+			label += " (" + s.cleanedBy + ")"
+		}
+		return label
+	}
+	people := func(s boardStay) string {
+		if s.children > 0 {
+			return fmt.Sprintf("%d pers. di cui %d bambini", s.guests, s.children)
+		}
+		return fmt.Sprintf("%d pers.", s.guests)
+	}
+
+	var arrivals, departures, stayovers []string
+	inHouse := 0
+	for _, s := range stays {
+		guest := s.guest
+		if s.vip {
+			guest += " ⭐ VIP"
+		}
+		if s.instructions != "" {
+			guest += " (📝 " + s.instructions + ")"
+		}
+		switch {
+		case sameDay(s.checkin):
+			line := fmt.Sprintf("• %s — %s, %s, %s, ore %s (#%d)", s.room, guest, people(s),
+				boardTypes[s.board], s.checkin.In(loc).Format("15:04"), s.id)
+			if isToday {
+				line += " — camera " + roomStatusLabels[s.roomStatus]
+			}
+			if s.parking != "" {
+				line += " — 🅿️ " + s.parking
+			}
+			arrivals = append(arrivals, line)
+			if !sameDay(s.checkout) {
+				inHouse += s.guests
+			}
+		case sameDay(s.checkout):
+			departures = append(departures, fmt.Sprintf("• %s — %s, entro le %s (#%d) — %s",
+				s.room, guest, s.checkout.In(loc).Format("15:04"), s.id, cleaning(s)))
+		default:
+			ci := s.checkin.In(loc)
+			co := s.checkout.In(loc)
+			start := time.Date(ci.Year(), ci.Month(), ci.Day(), 0, 0, 0, 0, loc)
+			end := time.Date(co.Year(), co.Month(), co.Day(), 0, 0, 0, 0, loc)
+			night := int(day.Sub(start).Hours()/24+0.5) + 1
+			nights := int(end.Sub(start).Hours()/24 + 0.5)
+			stayovers = append(stayovers, fmt.Sprintf("• %s — %s, notte %d di %d, parte il %s — %s",
+				s.room, guest, night, nights, end.Format("02/01"), cleaning(s)))
+			inHouse += s.guests
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📋 Tabellone di %s %s\n", strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01/2006"))
+	section := func(title string, lines []string, none string) {
+		fmt.Fprintf(&sb, "\n%s (%d)\n", title, len(lines))
+		if len(lines) == 0 {
+			sb.WriteString(none + "\n")
+			return
+		}
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	section("🛬 Arrivi", arrivals, "Nessun arrivo.")
+	section("🛫 Partenze", departures, "Nessuna partenza.")
+	section("🛏 Fermate", stayovers, "Nessuna fermata.")
+	fmt.Fprintf(&sb, "\nOspiti in casa la notte del %s: %d", day.Format("02/01"), inHouse)
+	return sb.String()
+}
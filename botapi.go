@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+)
+
+// botAPI calls a Telegram Bot API method directly. Use it only for methods the
+// SDK client does not expose (keyboards with several rows, pinning, message ids).
+// result may be nil when the caller does not need the decoded "result" field.
+func botAPI(ctx context.Context, botToken, method string, payload, result any) error {
+	return botAPITimeout(ctx, botToken, method, payload, result, 30*time.Second)
+}
+
+// botAPITimeout is botAPI with a custom HTTP timeout, for long polling.
+func botAPITimeout(ctx context.Context, botToken, method string, payload, result any, timeout time.Duration) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", method, err)
+	}
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", botToken, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram %s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("decode %s response: %w", method, err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s API error: %s", method, envelope.Description)
+	}
+	if result != nil && envelope.Result != nil {
+		if err := json.Unmarshal(envelope.Result, result); err != nil {
+			return fmt.Errorf("decode %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// sendKeyboard sends an HTML message with an inline keyboard (one slice per
+// row) and returns the Telegram message_id.
+func sendKeyboard(ctx context.Context, botToken string, chatID int64, html string, rows [][]telegram.Button) (int64, error) {
+	buttons := localizer.LocalizeButtons(ctx, chatID, rows)
+	payload := map[string]any{
+		"chat_id":    chatID,
+		"text":       localizer.Localize(ctx, chatID, html),
+		"parse_mode": "HTML",
+	}
+	if len(buttons) > 0 {
+		payload["reply_markup"] = map[string]any{"inline_keyboard": buttons}
+	}
+	var msg struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := deliver(ctx, chatID, func() error {
+		return botAPI(ctx, botToken, "sendMessage", payload, &msg)
+	}); err != nil {
+		missed.Record(ctx, chatID, html, true, err)
+		return 0, err
+	}
+	return msg.MessageID, nil
+}
+
+// pinMessage pins messageID in chatID without notifying the user.
+func pinMessage(ctx context.Context, botToken string, chatID, messageID int64) error {
+	return botAPI(ctx, botToken, "pinChatMessage", map[string]any{
+		"chat_id":              chatID,
+		"message_id":           messageID,
+		"disable_notification": true,
+	}, nil)
+}
+
+// sendDocument uploads data as a file named filename to chatID. The Bot API
+// needs multipart for uploads, so this does not go through botAPI.
+func sendDocument(ctx context.Context, botToken string, chatID int64, filename string, data []byte, caption string) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		_ = w.WriteField("caption", localizer.Localize(ctx, chatID, caption))
+	}
+	part, err := w.CreateFormFile("document", filename)
+	if err != nil {
+		return fmt.Errorf("build sendDocument form: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("build sendDocument form: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("build sendDocument form: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", botToken)
+	return deliver(ctx, chatID, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return fmt.Errorf("build sendDocument request: %w", err)
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		client := &http.Client{Timeout: 60 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("telegram sendDocument request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		var envelope struct {
+			OK          bool   `json:"ok"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+			return fmt.Errorf("decode sendDocument response: %w", err)
+		}
+		if !envelope.OK {
+			return fmt.Errorf("telegram sendDocument API error: %s", envelope.Description)
+		}
+		return nil
+	})
+}
+
+// sendPhoto sends a photo already on Telegram servers (by file_id) to chatID.
+func sendPhoto(ctx context.Context, botToken string, chatID int64, fileID, caption string) error {
+	payload := map[string]any{"chat_id": chatID, "photo": fileID}
+	if caption != "" {
+		payload["caption"] = caption
+	}
+	return deliver(ctx, chatID, func() error {
+		return botAPI(ctx, botToken, "sendPhoto", payload, nil)
+	})
+}
+
+// downloadFile fetches a file sent to the bot, at most maxBytes, and returns
+// its content and its path on Telegram servers (which carries the extension).
+func downloadFile(ctx context.Context, botToken, fileID string, maxBytes int64) ([]byte, string, error) {
+	var file struct {
+		FilePath string `json:"file_path"`
+		FileSize int64  `json:"file_size"`
+	}
+	if err := botAPI(ctx, botToken, "getFile", map[string]any{"file_id": fileID}, &file); err != nil {
+		return nil, "", err
+	}
+	if file.FilePath == "" {
+		return nil, "", fmt.Errorf("getFile: no file_path for %s", fileID)
+	}
+	if file.FileSize > maxBytes {
+		return nil, "", fmt.Errorf("file too large (%d bytes)", file.FileSize)
+	}
+	url := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", botToken, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("build download request: %w", err)
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("download %s: %w", file.FilePath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download %s: %s", file.FilePath, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("download %s: %w", file.FilePath, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, "", fmt.Errorf("file too large (over %d bytes)", maxBytes)
+	}
+	return data, file.FilePath, nil
+}
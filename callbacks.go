@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+)
+
+// callbackHandler handles a routed update (button press or command) without
+// an LLM turn. update.Text is the full callback data / command text.
+type callbackHandler func(ctx context.Context, update agent.Update) error
+
+// routedMessenger wraps the SDK Telegram client and intercepts inbound updates
+// whose text starts with a registered prefix (e.g. "onb:" for onboarding
+// buttons). Matched updates are handled in-process and never reach the agent,
+// so scripted flows consume zero tokens. Everything else passes through.
+//
+// The SDK delivers inline-button presses as plain updates whose Text is the
+// callback_data, which is why prefixes are namespaced ("onb:", "plan:", ...).
+type routedMessenger struct {
+	*telegram.Client
+	mu        sync.RWMutex
+	routes    map[string]callbackHandler
+	captures  map[int64]callbackHandler // chatID → handler for free-text answers
+	observers []func(ctx context.Context, update agent.Update)
+	all       []func(ctx context.Context, update agent.Update)
+	onSend    []func(chatID int64, text string)
+	keyOf     func(userID, chatID int64) int64
+	poll      func(ctx context.Context, offset int64, timeoutSec int) ([]agent.Update, error)
+
+	// nextOffset is one past the last update consumed here. The agent derives
+	// its polling offset from the updates we return, so without this a batch
+	// made only of routed updates would be fetched (and handled) again.
+	nextOffset int64
+}
+
+func newRoutedMessenger(client *telegram.Client) *routedMessenger {
+	return &routedMessenger{
+		Client:   client,
+		routes:   make(map[string]callbackHandler),
+		captures: make(map[int64]callbackHandler),
+	}
+}
+
+var _ agent.Messenger = (*routedMessenger)(nil)
+
+// Handle registers h for every update whose text starts with prefix.
+func (m *routedMessenger) Handle(prefix string, h callbackHandler) {
+	m.mu.Lock()
+	m.routes[prefix] = h
+	m.mu.Unlock()
+}
+
+// Capture routes every non-prefixed update from chatID to h until Release is
+// called. Used by scripted flows that ask free-text questions whose answers
+// must not reach the agent (and so the LLM and the session logs).
+func (m *routedMessenger) Capture(chatID int64, h callbackHandler) {
+	m.mu.Lock()
+	m.captures[chatID] = h
+	m.mu.Unlock()
+}
+
+// Release ends a capture started with Capture.
+func (m *routedMessenger) Release(chatID int64) {
+	m.mu.Lock()
+	delete(m.captures, chatID)
+	m.mu.Unlock()
+}
+
+// Observe registers fn to be called for every update that is passed through
+// to the agent (i.e. not routed). Used for analytics; fn must not block.
+func (m *routedMessenger) Observe(fn func(ctx context.Context, update agent.Update)) {
+	m.mu.Lock()
+	m.observers = append(m.observers, fn)
+	m.mu.Unlock()
+}
+
+// ObserveAll registers fn to be called for every update, routed or not (a
+// button press also tells the user is there). fn must not block.
+func (m *routedMessenger) ObserveAll(fn func(ctx context.Context, update agent.Update)) {
+	m.mu.Lock()
+	m.all = append(m.all, fn)
+	m.mu.Unlock()
+}
+
+// KeyContexts sets fn to replace the UserID of updates passed to the agent,
+// which keys its conversation history by it (see chatContexts). Routed
+// handlers and observers still see the Telegram user.
+func (m *routedMessenger) KeyContexts(fn func(userID, chatID int64) int64) {
+	m.mu.Lock()
+	m.keyOf = fn
+	m.mu.Unlock()
+}
+
+// PollWith replaces the SDK Client.Poll as the source of updates, e.g. to
+// keep the photo messages the SDK drops (see Attachments.Poll).
+func (m *routedMessenger) PollWith(fn func(ctx context.Context, offset int64, timeoutSec int) ([]agent.Update, error)) {
+	m.mu.Lock()
+	m.poll = fn
+	m.mu.Unlock()
+}
+
+// ObserveSend registers fn to be called before every outbound Send.
+func (m *routedMessenger) ObserveSend(fn func(chatID int64, text string)) {
+	m.mu.Lock()
+	m.onSend = append(m.onSend, fn)
+	m.mu.Unlock()
+}
+
+// Send implements agent.Messenger, notifying send observers first.
+func (m *routedMessenger) Send(ctx context.Context, chatID int64, text string) error {
+	m.mu.RLock()
+	obs := m.onSend
+	m.mu.RUnlock()
+	for _, fn := range obs {
+		fn(chatID, text)
+	}
+	return deliver(ctx, chatID, func() error {
+		return m.Client.Send(ctx, chatID, text)
+	})
+}
+
+// Poll implements agent.Messenger. Routed updates are consumed here and
+// filtered out of the returned slice.
+func (m *routedMessenger) Poll(ctx context.Context, offset int64, timeoutSec int) ([]agent.Update, error) {
+	if offset < m.nextOffset {
+		offset = m.nextOffset
+	}
+	m.mu.RLock()
+	poll := m.poll
+	m.mu.RUnlock()
+	if poll == nil {
+		poll = m.Client.Poll
+	}
+	updates, err := poll(ctx, offset, timeoutSec)
+	if err != nil {
+		return nil, err
+	}
+
+	out := updates[:0]
+	for _, u := range updates {
+		if u.UpdateID >= m.nextOffset {
+			m.nextOffset = u.UpdateID + 1
+		}
+		m.mu.RLock()
+		all := m.all
+		m.mu.RUnlock()
+		for _, fn := range all {
+			fn(ctx, u)
+		}
+		h := m.match(u.Text)
+		if h == nil {
+			h = m.captured(u.ChatID)
+		}
+		if h == nil {
+			m.observe(ctx, u)
+			m.mu.RLock()
+			keyOf := m.keyOf
+			m.mu.RUnlock()
+			if keyOf != nil {
+				u.UserID = keyOf(u.UserID, u.ChatID)
+			}
+			out = append(out, u)
+			continue
+		}
+		if err := h(ctx, u); err != nil {
+			log.Printf("callback %q from user %d: %v", u.Text, u.UserID, err)
+		}
+	}
+	return out, nil
+}
+
+func (m *routedMessenger) match(text string) callbackHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for prefix, h := range m.routes {
+		if strings.HasPrefix(text, prefix) {
+			return h
+		}
+	}
+	return nil
+}
+
+func (m *routedMessenger) captured(chatID int64) callbackHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.captures[chatID]
+}
+
+func (m *routedMessenger) observe(ctx context.Context, u agent.Update) {
+	m.mu.RLock()
+	obs := m.observers
+	m.mu.RUnlock()
+	for _, fn := range obs {
+		fn(ctx, u)
+	}
+}
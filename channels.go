@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// defaultBookingChannels are seeded on first boot. Commission rates are
+// typical OTA figures; managers adjust them with execute_sql
+// (UPDATE booking_channels SET commission_pct = … WHERE name = …).
+var defaultBookingChannels = []struct {
+	name string
+	pct  float64
+}{
+	{"direct", 0},
+	{"booking", 15},
+	{"airbnb", 15},
+	{"phone", 0},
+}
+
+// seedBookingChannels inserts the default channels for every property.
+// Existing rows are left untouched so manager-tuned commissions survive
+// restarts.
+func seedBookingChannels(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, c := range defaultBookingChannels {
+		if _, err := pool.Exec(ctx,
+			`INSERT INTO booking_channels (hotel_id, name, commission_pct)
+			 SELECT id, $1, $2 FROM hotels
+			 ON CONFLICT (hotel_id, name) DO NOTHING`,
+			c.name, c.pct,
+		); err != nil {
+			return fmt.Errorf("seed channel %s: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// ── channel_report ───────────────────────────────────────────────────────────
+
+type channelReportTool struct{}
+
+func (t *channelReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "channel_report",
+		Description: "Report mensile per canale di prenotazione (direct, booking, airbnb, phone…): prenotazioni, notti, " +
+			"incasso e commissioni stimate. Serve a capire dove conviene spingere le prenotazioni dirette. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {
+					"type": "string",
+					"description": "Mese nel formato YYYY-MM (default: mese corrente)"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *channelReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Revenue is manager-only information; reservations themselves are not.
+	var manager bool
+	if err := db.QueryRow(context.Background(), `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("channel_report is only available to managers")
+	}
+	var in struct {
+		Month string `json:"month"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	start := time.Now().In(loc)
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		start, err = time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+
+	// Nights are counted only inside the month; the amount (when known) is
+	// prorated on those nights so stays across month boundaries split fairly.
+	rows, err := db.Query(context.Background(),
+		`WITH stays AS (
+		   SELECT res.source, res.amount_eur,
+		          (res.checkout_at AT TIME ZONE 'Europe/Rome')::date - (res.checkin_at AT TIME ZONE 'Europe/Rome')::date AS total_nights,
+		          LEAST((res.checkout_at AT TIME ZONE 'Europe/Rome')::date, $2::date)
+		            - GREATEST((res.checkin_at AT TIME ZONE 'Europe/Rome')::date, $1::date) AS nights
+		   FROM reservations res
+		   WHERE res.status = 'confirmed' AND res.checkin_at < $2 AND res.checkout_at > $1
+		 )
+		 SELECT c.name, c.commission_pct,
+		        count(s.source),
+		        COALESCE(sum(s.nights), 0),
+		        COALESCE(sum(s.amount_eur * s.nights / NULLIF(s.total_nights, 0)), 0)::float8,
+		        count(s.source) FILTER (WHERE s.amount_eur IS NULL)
+		 FROM booking_channels c
+		 LEFT JOIN stays s ON s.source = c.name AND s.nights > 0
+		 GROUP BY c.name, c.commission_pct
+		 ORDER BY COALESCE(sum(s.nights), 0) DESC, c.name`,
+		start, end,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Canali di prenotazione — %s\n", start.Format("01/2006"))
+	fmt.Fprintf(&sb, "  %-10s %5s %6s %10s %10s\n", "canale", "pren.", "notti", "incasso", "commiss.")
+	var totNights, totRes, missing int
+	var totAmount, totCommission float64
+	for rows.Next() {
+		var name string
+		var pct, amount float64
+		var n, nights, noAmount int
+		if err := rows.Scan(&name, &pct, &n, &nights, &amount, &noAmount); err != nil {
+			return "", err
+		}
+		commission := amount * pct / 100
+		fmt.Fprintf(&sb, "  %-10s %5d %6d %9.0f€ %9.0f€  (%.0f%%)\n", name, n, nights, amount, commission, pct)
+		totRes += n
+		totNights += nights
+		totAmount += amount
+		totCommission += commission
+		missing += noAmount
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if totRes == 0 {
+		return fmt.Sprintf("Nessuna prenotazione nel mese %s.", start.Format("01/2006")), nil
+	}
+	fmt.Fprintf(&sb, "Totale: %d prenotazioni, %d notti, %.0f€ incassati, %.0f€ di commissioni stimate.\n",
+		totRes, totNights, totAmount, totCommission)
+	if missing > 0 {
+		fmt.Fprintf(&sb, "⚠️ %d prenotazioni senza importo (amount_eur): commissioni sottostimate.\n", missing)
+	}
+	return sb.String(), nil
+}
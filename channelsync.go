@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChannelSync imports OTA bookings from the per-room iCal exports that
+// Booking.com, Airbnb & co. offer, so the rooms sold there block availability
+// here. Each channel_feeds row is fetched periodically and diffed against
+// the reservations it produced earlier (feed_id, external_uid): new events
+// are inserted, moved ones updated, and future bookings that vanished from
+// the feed are marked cancelled. Managers get a summary of every change and
+// of any overlap the overbooking trigger refused.
+//
+// Configure via env:
+//
+//	CHANNEL_SYNC_MINUTES=30   how often every feed is fetched
+type ChannelSync struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+	client    *http.Client
+}
+
+func newChannelSync(adminPool *pgxpool.Pool, botToken string) *ChannelSync {
+	return &ChannelSync{adminPool: adminPool, botToken: botToken, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *ChannelSync) Tools() []agent.Tool {
+	return []agent.Tool{&linkCalendarTool{sync: s}}
+}
+
+// Start launches the periodic sync goroutine.
+func (s *ChannelSync) Start(ctx context.Context) {
+	every := time.Duration(envInt("CHANNEL_SYNC_MINUTES", 30)) * time.Minute
+	go func() {
+		log.Printf("channel sync started (every %v)", every)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			s.syncAll(ctx)
+			select {
+			case <-ctx.Done():
+				log.Printf("channel sync stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type channelFeed struct {
+	id        int64
+	hotelID   int
+	roomID    int64
+	room      string
+	channel   string
+	url       string
+	createdBy int64
+	lastError string
+}
+
+type feedResult struct {
+	added, updated, cancelled int
+	warnings                  []string
+}
+
+func (r feedResult) changed() bool {
+	return r.added+r.updated+r.cancelled > 0 || len(r.warnings) > 0
+}
+
+func (r feedResult) String() string {
+	s := fmt.Sprintf("%d nuove, %d modificate, %d cancellate", r.added, r.updated, r.cancelled)
+	for _, w := range r.warnings {
+		s += "\n  ⚠️ " + w
+	}
+	return s
+}
+
+func (s *ChannelSync) syncAll(ctx context.Context) {
+	rows, err := s.adminPool.Query(ctx,
+		`SELECT f.id, f.hotel_id, f.room_id, r.name, f.channel, f.url, f.created_by, COALESCE(f.last_error, '')
+		 FROM channel_feeds f JOIN rooms r ON r.id = f.room_id
+		 ORDER BY f.hotel_id, r.name, f.id`)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("channel sync: %v", err)
+		}
+		return
+	}
+	var feeds []channelFeed
+	for rows.Next() {
+		var f channelFeed
+		if err := rows.Scan(&f.id, &f.hotelID, &f.roomID, &f.room, &f.channel, &f.url, &f.createdBy, &f.lastError); err != nil {
+			log.Printf("channel sync scan: %v", err)
+			continue
+		}
+		feeds = append(feeds, f)
+	}
+	rows.Close()
+
+	// Each property's managers get the report of their own feeds.
+	report := make(map[int][]string)
+	var hotels []int
+	for _, f := range feeds {
+		if _, ok := report[f.hotelID]; !ok {
+			hotels = append(hotels, f.hotelID)
+			report[f.hotelID] = nil
+		}
+		res, err := s.syncFeed(ctx, f)
+		if err != nil {
+			log.Printf("channel sync feed %d (room %s): %v", f.id, f.room, err)
+			// Report a failing feed once, not at every tick.
+			if err.Error() != f.lastError {
+				report[f.hotelID] = append(report[f.hotelID], fmt.Sprintf("• Camera %s (%s): ❌ %v", f.room, f.channel, err))
+			}
+			continue
+		}
+		if res.changed() {
+			report[f.hotelID] = append(report[f.hotelID], fmt.Sprintf("• Camera %s (%s): %s", f.room, f.channel, res))
+		}
+	}
+	tg := newBot(s.botToken)
+	for _, hotelID := range hotels {
+		if len(report[hotelID]) == 0 {
+			continue
+		}
+		managers, err := managerIDs(ctx, s.adminPool, hotelID)
+		if err != nil {
+			log.Printf("channel sync: %v", err)
+			return
+		}
+		msg := "🔄 Sincronizzazione canali\n" + strings.Join(report[hotelID], "\n")
+		for _, id := range managers {
+			if err := tg.Send(ctx, id, msg); err != nil {
+				log.Printf("channel sync send to %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// syncFeed fetches one feed and applies it; the outcome is recorded on the
+// channel_feeds row.
+func (s *ChannelSync) syncFeed(ctx context.Context, f channelFeed) (feedResult, error) {
+	res, err := s.applyFeed(ctx, f)
+	var lastError *string
+	if err != nil {
+		e := err.Error()
+		lastError = &e
+	}
+	if _, uerr := s.adminPool.Exec(ctx,
+		`UPDATE channel_feeds SET last_synced_at = now(), last_error = $2 WHERE id = $1`, f.id, lastError,
+	); uerr != nil {
+		log.Printf("channel sync feed %d: record outcome: %v", f.id, uerr)
+	}
+	return res, err
+}
+
+func (s *ChannelSync) applyFeed(ctx context.Context, f channelFeed) (feedResult, error) {
+	var res feedResult
+	events, err := s.fetch(ctx, f.url)
+	if err != nil {
+		return res, err
+	}
+
+	type known struct {
+		id                int64
+		checkin, checkout time.Time
+	}
+	existing := make(map[string]known)
+	rows, err := s.adminPool.Query(ctx,
+		`SELECT id, external_uid, checkin_at, checkout_at FROM reservations
+		 WHERE feed_id = $1 AND status = 'confirmed'`, f.id)
+	if err != nil {
+		return res, fmt.Errorf("load reservations: %w", err)
+	}
+	for rows.Next() {
+		var uid string
+		var k known
+		if err := rows.Scan(&k.id, &uid, &k.checkin, &k.checkout); err != nil {
+			rows.Close()
+			return res, err
+		}
+		existing[uid] = k
+	}
+	rows.Close()
+
+	loc := romeLocation()
+	seen := make(map[string]bool)
+	for _, ev := range events {
+		if ev.cancelled || !ev.end.After(time.Now()) {
+			continue
+		}
+		seen[ev.uid] = true
+		period := ev.start.In(loc).Format("02/01") + " → " + ev.end.In(loc).Format("02/01")
+		if k, ok := existing[ev.uid]; ok {
+			if k.checkin.Equal(ev.start) && k.checkout.Equal(ev.end) {
+				continue
+			}
+			_, err := s.adminPool.Exec(ctx,
+				`UPDATE reservations SET checkin_at = $2, checkout_at = $3 WHERE id = $1`, k.id, ev.start, ev.end)
+			if isOverlap(err) {
+				res.warnings = append(res.warnings, fmt.Sprintf("modifica %s rifiutata: si sovrappone a un'altra prenotazione (prenotazione %d)", period, k.id))
+				continue
+			}
+			if err != nil {
+				return res, fmt.Errorf("update reservation %d: %w", k.id, err)
+			}
+			res.updated++
+			continue
+		}
+		// Also revives a booking cancelled earlier that reappeared in the feed.
+		_, err := s.adminPool.Exec(ctx,
+			`INSERT INTO reservations (room_id, checkin_at, checkout_at, source, notes, created_by, feed_id, external_uid)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			 ON CONFLICT (feed_id, external_uid) DO UPDATE
+			   SET status = 'confirmed', checkin_at = EXCLUDED.checkin_at, checkout_at = EXCLUDED.checkout_at`,
+			f.roomID, ev.start, ev.end, f.channel, "Import "+f.channel+": "+ev.summary, f.createdBy, f.id, ev.uid)
+		if isOverlap(err) {
+			res.warnings = append(res.warnings, fmt.Sprintf("OVERBOOKING %s: la prenotazione %s si sovrappone a una esistente, non importata", period, f.channel))
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("insert reservation: %w", err)
+		}
+		res.added++
+	}
+
+	// An empty feed while future bookings exist is more likely an OTA
+	// glitch than a wave of cancellations: keep them and warn.
+	if len(seen) == 0 && len(existing) > 0 {
+		res.warnings = append(res.warnings, fmt.Sprintf("feed vuoto: %d prenotazioni future mantenute, verifica sul portale", len(existing)))
+		return res, nil
+	}
+	for uid, k := range existing {
+		if seen[uid] || !k.checkout.After(time.Now()) {
+			continue
+		}
+		if _, err := s.adminPool.Exec(ctx,
+			`UPDATE reservations SET status = 'cancelled' WHERE id = $1`, k.id); err != nil {
+			return res, fmt.Errorf("cancel reservation %d: %w", k.id, err)
+		}
+		res.cancelled++
+	}
+	return res, nil
+}
+
+func isOverlap(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23P01"
+}
+
+func (s *ChannelSync) fetch(ctx context.Context, url string) ([]feedEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 5<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+	if !strings.Contains(string(data), "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("not an iCalendar feed")
+	}
+	return parseICalEvents(string(data)), nil
+}
+
+// ── iCal parsing ─────────────────────────────────────────────────────────────
+
+type feedEvent struct {
+	uid        string
+	summary    string
+	start, end time.Time
+	cancelled  bool
+}
+
+// parseICalEvents extracts the VEVENTs of an iCalendar document. OTA exports
+// use all-day events (DTSTART;VALUE=DATE): those get the default check-in and
+// check-out hours. Events without UID or dates are skipped.
+func parseICalEvents(data string) []feedEvent {
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	var out []feedEvent
+	var ev *feedEvent
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, params, value := splitICalLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			ev = &feedEvent{}
+		case name == "END" && value == "VEVENT":
+			if ev != nil && ev.uid != "" && !ev.start.IsZero() && ev.end.After(ev.start) {
+				out = append(out, *ev)
+			}
+			ev = nil
+		case ev == nil:
+		case name == "UID":
+			ev.uid = value
+		case name == "SUMMARY":
+			ev.summary = icalUnescape(value)
+		case name == "STATUS":
+			ev.cancelled = value == "CANCELLED"
+		case name == "DTSTART":
+			ev.start = parseICalTime(params, value, defaultCheckinHour)
+		case name == "DTEND":
+			ev.end = parseICalTime(params, value, defaultCheckoutHour)
+		}
+	}
+	return out
+}
+
+// splitICalLine splits "NAME;PARAM=X:value" into its parts.
+func splitICalLine(line string) (name string, params map[string]string, value string) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, ""
+	}
+	parts := strings.Split(head, ";")
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+// parseICalTime reads a DATE or DATE-TIME value. Dates get hour (Europe/Rome);
+// floating times use TZID when present, else Europe/Rome.
+func parseICalTime(params map[string]string, value string, hour int) time.Time {
+	loc := romeLocation()
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		d, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return time.Time{}
+		}
+		return d.Add(time.Duration(hour) * time.Hour)
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, _ := time.Parse("20060102T150405Z", value)
+		return t
+	}
+	if tz, ok := params["TZID"]; ok {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, _ := time.ParseInLocation("20060102T150405", value, loc)
+	return t
+}
+
+// icalUnescape reverses icalEscape.
+func icalUnescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// ── link_calendar ────────────────────────────────────────────────────────────
+
+type linkCalendarTool struct {
+	sync *ChannelSync
+}
+
+func (t *linkCalendarTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "link_calendar",
+		Description: "Collega a una camera il calendario iCal esportato da un portale (Booking.com, Airbnb…): le prenotazioni " +
+			"del portale vengono importate e tenute allineate automaticamente. Con unlink=true scollega. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera"},
+				"url": {"type": "string", "description": "URL iCal di esportazione del portale (.ics)"},
+				"channel": {"type": "string", "description": "Canale (booking_channels.name), default booking"},
+				"unlink": {"type": "boolean", "description": "Scollega il calendario (senza url: tutti quelli della camera)"}
+			},
+			"required": ["room"]
+		}`),
+	}
+}
+
+func (t *linkCalendarTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room    string `json:"room"`
+		URL     string `json:"url"`
+		Channel string `json:"channel"`
+		Unlink  bool   `json:"unlink"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("link_calendar is only available to managers")
+	}
+
+	var roomID int64
+	var room string
+	if err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, in.Room).Scan(&roomID, &room); err != nil {
+		return "", fmt.Errorf("camera %q non trovata", in.Room)
+	}
+
+	if in.Unlink {
+		// Imported reservations stay: they keep blocking the room until
+		// a manager cancels them.
+		tag, err := db.Exec(bg,
+			`DELETE FROM channel_feeds WHERE room_id = $1 AND ($2 = '' OR url = $2)`, roomID, in.URL)
+		if err != nil {
+			return "", fmt.Errorf("unlink: %w", err)
+		}
+		return fmt.Sprintf("✅ %d calendari scollegati dalla camera %s. Le prenotazioni già importate restano.", tag.RowsAffected(), room), nil
+	}
+	if !strings.HasPrefix(in.URL, "https://") && !strings.HasPrefix(in.URL, "http://") {
+		return "", fmt.Errorf("url must be the http(s) iCal export link")
+	}
+	if in.Channel == "" {
+		in.Channel = "booking"
+	}
+
+	f := channelFeed{roomID: roomID, room: room, channel: in.Channel, url: in.URL, createdBy: ctx.UserID}
+	if err := db.QueryRow(bg,
+		`INSERT INTO channel_feeds (room_id, channel, url, created_by) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (room_id, url) DO UPDATE SET channel = EXCLUDED.channel
+		 RETURNING id`, roomID, in.Channel, in.URL, ctx.UserID,
+	).Scan(&f.id); err != nil {
+		return "", fmt.Errorf("link (is %q a booking_channels name?): %w", in.Channel, err)
+	}
+	res, err := t.sync.syncFeed(bg, f)
+	if err != nil {
+		return fmt.Sprintf("Calendario collegato alla camera %s, ma la prima sincronizzazione è fallita: %v", room, err), nil
+	}
+	return fmt.Sprintf("✅ Calendario %s collegato alla camera %s. Prima sincronizzazione: %s", in.Channel, room, res), nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// The SDK agent keeps one conversation history per update UserID, so a
+// manager writing both in their DM and in the staff group would see the two
+// conversations bleed into each other. chatContexts gives every (user, group
+// chat) pair its own conversation key: routedMessenger puts it in place of
+// UserID on updates from groups, and everything the agent calls back with it
+// (HandleStart, Authorize, BuildExtra, BuildPrompt, tools) maps it back to the
+// Telegram user with User. Private chats keep the user ID as key, so the DM
+// conversation, session file and injected notifications are unchanged.
+//
+// A user can also open named topics in a chat (/topic, see topics.go): while
+// a topic is active, the pair's updates get the key of (user, chat, topic)
+// instead, so a long planning discussion is not pushed out of the window by
+// daily chatter.
+//
+// Group and topic keys are negative (Telegram user IDs are positive) and
+// derived by hashing, so a conversation keeps its session file across
+// restarts.
+
+type chatContexts struct {
+	mu     sync.RWMutex
+	keys   map[int64]chatContext // conversation key → owner
+	active map[[2]int64]string   // (user, chat) → active topic, "" for none
+}
+
+// chatContext is what a conversation key stands for.
+type chatContext struct {
+	userID, chatID int64
+	topic          string
+}
+
+func newChatContexts() *chatContexts {
+	return &chatContexts{
+		keys:   make(map[int64]chatContext),
+		active: make(map[[2]int64]string),
+	}
+}
+
+// Key returns the conversation key of userID writing in chatID, within the
+// pair's active topic.
+func (c *chatContexts) Key(userID, chatID int64) int64 {
+	c.mu.RLock()
+	topic := c.active[[2]int64{userID, chatID}]
+	c.mu.RUnlock()
+	return c.topicKey(userID, chatID, topic)
+}
+
+func (c *chatContexts) topicKey(userID, chatID int64, topic string) int64 {
+	if chatID == userID && topic == "" {
+		return userID
+	}
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [2]int64{userID, chatID})
+	h.Write([]byte(topic))
+	key := -int64(h.Sum64()>>1) - 1
+	c.mu.Lock()
+	c.keys[key] = chatContext{userID: userID, chatID: chatID, topic: topic}
+	c.mu.Unlock()
+	return key
+}
+
+// User returns the Telegram user of a conversation key. Anything that is not
+// a group or topic key (a plain user ID) is returned unchanged.
+func (c *chatContexts) User(key int64) int64 {
+	if key > 0 {
+		return key
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if cc, ok := c.keys[key]; ok {
+		return cc.userID
+	}
+	return key
+}
+
+// Context returns what key stands for; a plain user ID is their DM.
+func (c *chatContexts) Context(key int64) chatContext {
+	if key > 0 {
+		return chatContext{userID: key, chatID: key}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys[key]
+}
+
+// KeysOf lists the group and topic conversation keys of userID seen since
+// startup.
+func (c *chatContexts) KeysOf(userID int64) []int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var keys []int64
+	for key, cc := range c.keys {
+		if cc.userID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// SetTopic makes topic the active one of userID in chatID; "" returns to the
+// chat's main conversation.
+func (c *chatContexts) SetTopic(userID, chatID int64, topic string) {
+	c.topicKey(userID, chatID, topic)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic == "" {
+		delete(c.active, [2]int64{userID, chatID})
+		return
+	}
+	c.active[[2]int64{userID, chatID}] = topic
+}
+
+// Topic returns the active topic of userID in chatID.
+func (c *chatContexts) Topic(userID, chatID int64) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.active[[2]int64{userID, chatID}]
+}
+
+// Topics lists the topics userID opened in chatID since startup.
+func (c *chatContexts) Topics(userID, chatID int64) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var topics []string
+	for _, cc := range c.keys {
+		if cc.userID == userID && cc.chatID == chatID && cc.topic != "" {
+			topics = append(topics, cc.topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Tools wraps ts so its tools see the Telegram user in ToolContext.UserID, and
+// so what they inject into a user's DM lands in the DM's active topic.
+func (c *chatContexts) Tools(ts agent.ToolSet) agent.ToolSet {
+	return chatContextToolSet{ToolSet: ts, contexts: c}
+}
+
+type chatContextToolSet struct {
+	agent.ToolSet
+	contexts *chatContexts
+}
+
+func (ts chatContextToolSet) Tools() []agent.Tool {
+	var out []agent.Tool
+	for _, t := range ts.ToolSet.Tools() {
+		out = append(out, chatContextTool{Tool: t, contexts: ts.contexts})
+	}
+	return out
+}
+
+type chatContextTool struct {
+	agent.Tool
+	contexts *chatContexts
+}
+
+func (t chatContextTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	ctx.UserID = t.contexts.User(ctx.UserID)
+	if ctx.ContextInjector != nil {
+		ctx.ContextInjector = chatContextInjector{ContextInjector: ctx.ContextInjector, contexts: t.contexts}
+	}
+	return t.Tool.Execute(ctx, args)
+}
+
+type chatContextInjector struct {
+	agent.ContextInjector
+	contexts *chatContexts
+}
+
+func (i chatContextInjector) Inject(userID int64, msg llm.Message) {
+	if userID > 0 {
+		userID = i.contexts.Key(userID, userID)
+	}
+	i.ContextInjector.Inject(userID, msg)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// ── city_tax_report ──────────────────────────────────────────────────────────
+//
+// The city tax (imposta di soggiorno) is due per guest per night, CITY_TAX_EUR
+// each, on the first CITY_TAX_MAX_NIGHTS nights of a stay; children
+// (reservations.children, counted in guests) are exempt. The municipality
+// wants it remitted by month, so every night is counted in the month it falls
+// in: a stay across two months is split between both reports, and the nights
+// beyond the cap are counted where the stay actually passes them.
+
+type cityTaxReportTool struct {
+	botToken string
+}
+
+func (t *cityTaxReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "city_tax_report",
+		Description: "Imposta di soggiorno del mese da versare al Comune: pernottamenti tassati ed esenti (bambini, notti oltre il massimo) " +
+			"e importo totale. Invia in chat il CSV per prenotazione e restituisce il riepilogo. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {
+					"type": "string",
+					"description": "Mese nel formato YYYY-MM (default: mese precedente)"
+				}
+			}
+		}`),
+	}
+}
+
+type cityTaxRow struct {
+	id                int64
+	room, guest       string
+	guests, children  int
+	nights, taxed     int
+	checkin, checkout time.Time
+}
+
+// presences are the taxable guest-nights of the row.
+func (r cityTaxRow) presences() int {
+	return (r.guests - r.children) * r.taxed
+}
+
+func (t *cityTaxReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("city_tax_report is only available to managers")
+	}
+	var in struct {
+		Month string `json:"month"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		start, err = time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+	rate := envFloat("CITY_TAX_EUR", 0)
+	maxNights := envInt("CITY_TAX_MAX_NIGHTS", 0)
+
+	rows, err := db.Query(bg,
+		`WITH stays AS (
+		   SELECT res.id, r.name AS room, COALESCE(res.guest_name, '') AS guest, res.guests, res.children,
+		          (res.checkin_at AT TIME ZONE 'Europe/Rome')::date AS ci,
+		          (res.checkout_at AT TIME ZONE 'Europe/Rome')::date AS co
+		   FROM reservations res
+		   JOIN rooms r ON r.id = res.room_id
+		   WHERE res.status = 'confirmed'
+		     AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date < $2
+		     AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date > $1
+		 )
+		 SELECT s.id, s.room, s.guest, s.guests, s.children, s.ci, s.co,
+		        count(*)::int,
+		        (count(*) FILTER (WHERE $3::int = 0 OR d::date < s.ci + $3::int))::int
+		 FROM stays s
+		 CROSS JOIN LATERAL generate_series(GREATEST(s.ci, $1::date), LEAST(s.co, $2::date) - 1, INTERVAL '1 day') d
+		 GROUP BY s.id, s.room, s.guest, s.guests, s.children, s.ci, s.co
+		 ORDER BY s.ci, s.room`,
+		start, end, maxNights,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var data []cityTaxRow
+	for rows.Next() {
+		var r cityTaxRow
+		if err := rows.Scan(&r.id, &r.room, &r.guest, &r.guests, &r.children, &r.checkin, &r.checkout,
+			&r.nights, &r.taxed); err != nil {
+			return "", err
+		}
+		data = append(data, r)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	month := start.Format("01/2006")
+	if len(data) == 0 {
+		return fmt.Sprintf("Nessun pernottamento nel mese %s.", month), nil
+	}
+
+	var csv strings.Builder
+	csv.WriteString("prenotazione;camera;ospite;arrivo;partenza;ospiti;bambini;notti_nel_mese;notti_tassate;pernottamenti_tassati;importo\n")
+	var taxable, childNights, capNights, stays int
+	for _, r := range data {
+		p := r.presences()
+		fmt.Fprintf(&csv, "%d;%s;%s;%s;%s;%d;%d;%d;%d;%d;%.2f\n",
+			r.id, r.room, strings.ReplaceAll(r.guest, ";", ","), r.checkin.Format("02/01/2006"), r.checkout.Format("02/01/2006"),
+			r.guests, r.children, r.nights, r.taxed, p, float64(p)*rate)
+		taxable += p
+		childNights += r.children * r.nights
+		capNights += (r.guests - r.children) * (r.nights - r.taxed)
+		stays++
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Imposta di soggiorno %s (%d prenotazioni):\n", month, stays)
+	fmt.Fprintf(&sb, "  pernottamenti tassati: %d\n", taxable)
+	fmt.Fprintf(&sb, "  esenti bambini: %d\n", childNights)
+	if maxNights > 0 {
+		fmt.Fprintf(&sb, "  esenti oltre la %dª notte: %d\n", maxNights, capNights)
+	}
+	if rate > 0 {
+		fmt.Fprintf(&sb, "Da versare: %.2f€ (%d × %.2f€).\n", float64(taxable)*rate, taxable, rate)
+	} else {
+		sb.WriteString("⚠️ CITY_TAX_EUR non è configurata: importo non calcolato.\n")
+	}
+
+	name := "imposta_soggiorno_" + start.Format("200601") + ".csv"
+	if err := sendDocument(bg, t.botToken, ctx.ChatID, name, []byte(csv.String()),
+		"Imposta di soggiorno "+month+" per prenotazione"); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	fmt.Fprintf(&sb, "📄 Dettaglio per prenotazione inviato in chat (%s).", name)
+	return sb.String(), nil
+}
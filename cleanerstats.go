@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Cleaning staff performance: per cleaner, the assignments of a period that
+// were completed, skipped or left open, the average completion time
+// (started_at → completed_at, stamped by the assignments_timestamps trigger)
+// per cleaning type, how many carry notes and the average review score
+// (review_cleaning). cleaner_stats answers on demand, for everyone or for one
+// cleaner with their reviews listed; startCleanerStatsReport sends last
+// week's figures to every manager on Monday morning.
+//
+// Configure via env:
+//
+//	CLEANER_STATS_TIME=08:00   Monday send time, Europe/Rome; "off" disables
+
+// startCleanerStatsReport launches the weekly report goroutine.
+func startCleanerStatsReport(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	timeStr := envOr("CLEANER_STATS_TIME", "08:00")
+	hour, min, ok := parseClock(timeStr)
+	if !ok {
+		log.Printf("cleaner stats: disabled (CLEANER_STATS_TIME=%q)", timeStr)
+		return
+	}
+	loc := romeLocation()
+
+	go func() {
+		for {
+			now := time.Now().In(loc)
+			daysUntilMonday := (8 - int(now.Weekday())) % 7
+			next := time.Date(now.Year(), now.Month(), now.Day()+daysUntilMonday, hour, min, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 7)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			monday := time.Date(next.Year(), next.Month(), next.Day()-7, 0, 0, 0, 0, loc)
+			hotels, err := hotelIDs(ctx, pool)
+			if err != nil {
+				log.Printf("cleaner stats: %v", err)
+				continue
+			}
+			tg := newBot(botToken)
+			for _, hotelID := range hotels {
+				text, err := cleanerStats(ctx, pool, monday, monday.AddDate(0, 0, 6), hotelID, 0)
+				if err != nil {
+					log.Printf("cleaner stats: hotel %d: %v", hotelID, err)
+					continue
+				}
+				managers, err := managerIDs(ctx, pool, hotelID)
+				if err != nil {
+					log.Printf("cleaner stats: %v", err)
+					continue
+				}
+				for _, id := range managers {
+					if err := tg.Send(ctx, id, text); err != nil {
+						log.Printf("cleaner stats: send to %d: %v", id, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// cleanerStats summarises the assignments dated from..to (both included) of
+// property hotelID (0: as far as db can see), of everyone or, when cleanerID
+// is not 0, of that cleaner only — followed by the reviews of their work.
+func cleanerStats(ctx context.Context, db querier, from, to time.Time, hotelID int, cleanerID int64) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT COALESCE(u.name, a.cleaner_id::text),
+		        count(*) FILTER (WHERE a.status = 'done'),
+		        count(*) FILTER (WHERE a.status = 'skipped'),
+		        count(*) FILTER (WHERE a.status IN ('pending', 'in_progress')),
+		        COALESCE(avg(extract(epoch FROM a.completed_at - a.started_at) / 60)
+		          FILTER (WHERE a.type = 'checkout' AND a.completed_at > a.started_at), 0)::float8,
+		        COALESCE(avg(extract(epoch FROM a.completed_at - a.started_at) / 60)
+		          FILTER (WHERE a.type = 'stayover' AND a.completed_at > a.started_at), 0)::float8,
+		        count(*) FILTER (WHERE btrim(COALESCE(a.notes, '')) <> ''),
+		        count(rv.id),
+		        COALESCE(avg(rv.score), 0)::float8
+		 FROM assignments a
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 LEFT JOIN reviews rv ON rv.assignment_id = a.id
+		 WHERE a.date BETWEEN $1 AND $2 AND ($3::bigint = 0 OR a.cleaner_id = $3)
+		   AND ($4::int = 0 OR a.hotel_id = $4)
+		 GROUP BY a.cleaner_id, u.name
+		 ORDER BY count(*) FILTER (WHERE a.status = 'done') DESC, u.name`,
+		from.Format("2006-01-02"), to.Format("2006-01-02"), cleanerID, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("query assignments: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧹 Pulizie %s → %s\n", from.Format("02/01"), to.Format("02/01/2006"))
+	var totDone, totSkipped, totOpen, cleaners int
+	for rows.Next() {
+		var name string
+		var done, skipped, open, notes, reviews int
+		var checkout, stayover, score float64
+		if err := rows.Scan(&name, &done, &skipped, &open, &checkout, &stayover, &notes, &reviews, &score); err != nil {
+			return "", err
+		}
+		cleaners++
+		totDone += done
+		totSkipped += skipped
+		totOpen += open
+		fmt.Fprintf(&sb, "\n%s: %d completate, %d saltate", name, done, skipped)
+		if open > 0 {
+			fmt.Fprintf(&sb, ", %d non chiuse", open)
+		}
+		var times []string
+		if checkout > 0 {
+			times = append(times, "partenza "+formatMinutes(int(checkout+0.5)))
+		}
+		if stayover > 0 {
+			times = append(times, "fermata "+formatMinutes(int(stayover+0.5)))
+		}
+		if len(times) > 0 {
+			fmt.Fprintf(&sb, "\n  tempo medio: %s", strings.Join(times, ", "))
+		}
+		if notes > 0 {
+			fmt.Fprintf(&sb, "\n  %d con note", notes)
+		}
+		if reviews > 0 {
+			fmt.Fprintf(&sb, "\n  voto medio %.1f/5 su %d valutazioni", score, reviews)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if cleaners == 0 {
+		return fmt.Sprintf("Nessuna assegnazione tra il %s e il %s.", from.Format("02/01"), to.Format("02/01/2006")), nil
+	}
+	if cleanerID == 0 {
+		fmt.Fprintf(&sb, "\n\nTotale: %d completate, %d saltate, %d non chiuse.", totDone, totSkipped, totOpen)
+		return sb.String(), nil
+	}
+
+	rows, err = db.Query(ctx,
+		`SELECT a.date, r.name, a.type, rv.score, COALESCE(rv.notes, '')
+		 FROM reviews rv
+		 JOIN assignments a ON a.id = rv.assignment_id
+		 JOIN rooms r ON r.id = a.room_id
+		 WHERE a.date BETWEEN $1 AND $2 AND a.cleaner_id = $3
+		 ORDER BY rv.score, a.date, r.name`,
+		from.Format("2006-01-02"), to.Format("2006-01-02"), cleanerID)
+	if err != nil {
+		return "", fmt.Errorf("query reviews: %w", err)
+	}
+	defer rows.Close()
+	first := true
+	for rows.Next() {
+		var day time.Time
+		var room, kind, note string
+		var score int
+		if err := rows.Scan(&day, &room, &kind, &score, &note); err != nil {
+			return "", err
+		}
+		if first {
+			sb.WriteString("\n\nValutazioni (dalla peggiore):")
+			first = false
+		}
+		fmt.Fprintf(&sb, "\n• %s camera %s (%s): %d/5", day.Format("02/01"), room, kind, score)
+		if note != "" {
+			sb.WriteString(" — " + note)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if first {
+		sb.WriteString("\n\nNessuna pulizia valutata nel periodo.")
+	}
+	return sb.String(), nil
+}
+
+// ── cleaner_stats ────────────────────────────────────────────────────────────
+
+type cleanerStatsTool struct{}
+
+func (t *cleanerStatsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "cleaner_stats",
+		Description: "Statistiche per addetto alle pulizie su un periodo: assegnazioni completate, saltate e non chiuse, " +
+			"tempo medio di pulizia per tipo (da in corso a fatto), quante hanno note e il voto medio delle valutazioni " +
+			"(review_cleaning). Con cleaner mostra solo quella persona, con le valutazioni ricevute. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD (default: lunedì della settimana scorsa)"},
+				"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD (default: from + 6 giorni)"},
+				"cleaner": {"type": "string", "description": "Nome dell'addetto, per vedere solo lui/lei e le sue valutazioni"}
+			}
+		}`),
+	}
+}
+
+func (t *cleanerStatsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		Cleaner string `json:"cleaner"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	now := time.Now().In(romeLocation())
+	lastMonday := time.Date(now.Year(), now.Month(), now.Day()-(int(now.Weekday())+6)%7-7, 0, 0, 0, 0, now.Location())
+	from, to, err := parseReportRange(in.From, in.To, lastMonday,
+		func(from time.Time) time.Time { return from.AddDate(0, 0, 6) }, analyticsMaxDays)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("cleaner_stats is only available to managers")
+	}
+	var cleanerID int64
+	if strings.TrimSpace(in.Cleaner) != "" {
+		if cleanerID, _, err = findStaff(bg, db, in.Cleaner); err != nil {
+			return "", err
+		}
+	}
+	return cleanerStats(bg, db, from, to, 0, cleanerID)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Cleaning standards: a room's own effort for a kind of clean (checkout,
+// stayover, deep clean) and what that clean includes, for the rooms the room
+// type estimate gets wrong — the suite with the terrace, the single under the
+// roof. The daily plan takes them over measured times and the room type's
+// cleaning_minutes (AutoAssigner.measured), both to balance the cleaners and
+// to say whether each one's day fits their shift.
+
+// cleaningKinds are the values of cleaning_standards.kind, with their label.
+var cleaningKinds = map[string]string{
+	"checkout":   "checkout",
+	"stayover":   "fermata",
+	"deep_clean": "pulizia a fondo",
+}
+
+// ── cleaning_standard ────────────────────────────────────────────────────────
+
+type cleaningStandardTool struct{}
+
+func (t *cleaningStandardTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "cleaning_standard",
+		Description: "Standard di pulizia per camera: minuti previsti per tipo di pulizia (checkout, fermata, pulizia a fondo) " +
+			"e cosa comprende. Il piano giornaliero li usa al posto della stima della tipologia per bilanciare i cleaner " +
+			"e verificare che il lavoro stia nel turno. Senza minutes mostra gli standard (di una camera o di tutte); " +
+			"con room, kind e minutes un manager li imposta, minutes=0 li rimuove.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera"},
+				"kind": {"type": "string", "enum": ["checkout", "stayover", "deep_clean"], "description": "Tipo di pulizia (default checkout)"},
+				"minutes": {"type": "integer", "description": "Minuti previsti (0 = rimuovi lo standard)"},
+				"notes": {"type": "string", "description": "Cosa comprende, es. 'terrazzo e vetrate ogni checkout'"}
+			}
+		}`),
+	}
+}
+
+func (t *cleaningStandardTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room    string  `json:"room"`
+		Kind    string  `json:"kind"`
+		Minutes *int    `json:"minutes"`
+		Notes   *string `json:"notes"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.Kind == "" {
+		in.Kind = "checkout"
+	}
+	if _, ok := cleaningKinds[in.Kind]; !ok {
+		return "", fmt.Errorf("kind must be checkout, stayover or deep_clean")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var roomID int
+	room := strings.TrimSpace(in.Room)
+	if room != "" {
+		if err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, room).Scan(&roomID, &room); err != nil {
+			return "", fmt.Errorf("camera %q non trovata", in.Room)
+		}
+	}
+
+	if in.Minutes != nil {
+		if roomID == 0 {
+			return "", fmt.Errorf("room is required to set a standard")
+		}
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("cleaning_standard changes are only available to managers")
+		}
+		label := cleaningKinds[in.Kind]
+		switch m := *in.Minutes; {
+		case m == 0:
+			tag, err := db.Exec(bg, `DELETE FROM cleaning_standards WHERE room_id = $1 AND kind = $2`, roomID, in.Kind)
+			if err != nil {
+				return "", fmt.Errorf("delete cleaning standard: %w", err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Sprintf("La camera %s non ha uno standard per il %s.", room, label), nil
+			}
+			return fmt.Sprintf("🧽 Standard %s della camera %s rimosso: torna alla stima della tipologia.", label, room), nil
+		case m < 0 || m > 480:
+			return "", fmt.Errorf("minutes must be between 1 and 480")
+		}
+		var notes string
+		if in.Notes != nil {
+			notes = strings.TrimSpace(*in.Notes)
+		}
+		if _, err := db.Exec(bg,
+			`INSERT INTO cleaning_standards (room_id, kind, minutes, notes, updated_by)
+			 VALUES ($1, $2, $3, NULLIF($4, ''), current_telegram_id())
+			 ON CONFLICT (room_id, kind) DO UPDATE
+			   SET minutes = EXCLUDED.minutes,
+			       notes = CASE WHEN $5 THEN EXCLUDED.notes ELSE cleaning_standards.notes END,
+			       updated_by = EXCLUDED.updated_by, updated_at = now()`,
+			roomID, in.Kind, *in.Minutes, notes, in.Notes != nil); err != nil {
+			return "", fmt.Errorf("save cleaning standard: %w", err)
+		}
+		return fmt.Sprintf("🧽 Camera %s, %s: %s. Il piano giornaliero userà questa stima.",
+			room, label, formatMinutes(*in.Minutes)), nil
+	}
+
+	rows, err := db.Query(bg,
+		`SELECT r.name, s.kind, s.minutes, COALESCE(s.notes, '')
+		 FROM cleaning_standards s JOIN rooms r ON r.id = s.room_id
+		 WHERE $1 = 0 OR s.room_id = $1
+		 ORDER BY r.floor, r.name, s.kind`, roomID)
+	if err != nil {
+		return "", fmt.Errorf("query cleaning standards: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		var name, kind, notes string
+		var minutes int
+		if err := rows.Scan(&name, &kind, &minutes, &notes); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n• %s, %s: %s", name, cleaningKinds[kind], formatMinutes(minutes))
+		if notes != "" {
+			fmt.Fprintf(&sb, " — %s", notes)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if sb.Len() == 0 {
+		if roomID != 0 {
+			return fmt.Sprintf("La camera %s non ha standard propri: vale la stima della tipologia.", room), nil
+		}
+		return "Nessuno standard per camera: il piano usa i minuti delle tipologie e i tempi misurati.", nil
+	}
+	return "🧽 Standard di pulizia:" + sb.String(), nil
+}
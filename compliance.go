@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Periodic safety and compliance checks. A compliance_templates row says what
+// to check and how often (fire extinguishers monthly, emergency lights,
+// the HACCP fridge temperature log daily). Each active template has one open
+// compliance_tasks row; complete_check turns it into the completion record
+// and the compliance_tasks_next trigger opens the next one, due one period
+// later. materializeCompliance covers new or reactivated templates. A
+// value outside value_min..value_max, or a check marked not OK, is pushed to
+// the managers at once; every morning the managers get the checks past due.
+//
+// Configure via env:
+//
+//	COMPLIANCE_ALERT_TIME=09:00   daily time (Europe/Rome) of the overdue alert; "off" disables it
+
+var defaultComplianceTemplates = []struct {
+	code, title, frequency, instructions, unit string
+	min, max                                   *float64
+}{
+	{"estintori", "Controllo estintori", "monthly",
+		"Verifica a vista ogni estintore: al suo posto e accessibile, sigillo integro, manometro in zona verde, " +
+			"cartellino della manutenzione semestrale aggiornato.", "", nil, nil},
+	{"luci_emergenza", "Prova luci di emergenza", "monthly",
+		"Premi il pulsante di test di ogni lampada di emergenza: devono accendersi tutte. Annota quelle guaste.",
+		"", nil, nil},
+	{"frigo_haccp", "Temperatura frigorifero colazioni (HACCP)", "daily",
+		"Leggi il termometro del frigorifero della sala colazioni e registra la temperatura.",
+		"°C", ptr(0.0), ptr(4.0)},
+	{"freezer_haccp", "Temperatura congelatore (HACCP)", "daily",
+		"Leggi il termometro del congelatore e registra la temperatura.",
+		"°C", nil, ptr(-18.0)},
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// seedComplianceTemplates adds the default checks to every property. Safe to
+// call on every boot: templates edited or deactivated by managers are kept.
+func seedComplianceTemplates(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, t := range defaultComplianceTemplates {
+		if _, err := pool.Exec(ctx,
+			`INSERT INTO compliance_templates (hotel_id, code, title, frequency, instructions, value_unit, value_min, value_max)
+			 SELECT id, $1, $2, $3, $4, NULLIF($5, ''), $6, $7 FROM hotels
+			 ON CONFLICT (hotel_id, code) DO NOTHING`,
+			t.code, t.title, t.frequency, t.instructions, t.unit, t.min, t.max,
+		); err != nil {
+			return fmt.Errorf("seed compliance template %s: %w", t.code, err)
+		}
+	}
+	return nil
+}
+
+// materializeCompliance opens the next task of every active template that has
+// none open: one period after the last one, or today if that is already past.
+func materializeCompliance(ctx context.Context, db *pgxpool.Pool) (int64, error) {
+	tag, err := db.Exec(ctx,
+		`INSERT INTO compliance_tasks (hotel_id, template_id, due_date)
+		 SELECT t.hotel_id, t.id,
+		        GREATEST((SELECT max(k.due_date) FROM compliance_tasks k WHERE k.template_id = t.id) + compliance_interval(t.frequency),
+		                 (now() AT TIME ZONE 'Europe/Rome')::date)::date
+		 FROM compliance_templates t
+		 WHERE t.active
+		   AND NOT EXISTS (SELECT 1 FROM compliance_tasks k WHERE k.template_id = t.id AND k.status = 'open')
+		 ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("materialize compliance tasks: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// startComplianceWatch opens the due tasks at startup and every morning, then
+// sends the managers the list of checks past their due date.
+func startComplianceWatch(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	if _, err := materializeCompliance(ctx, pool); err != nil {
+		log.Printf("compliance: %v", err)
+	}
+	timeStr := envOr("COMPLIANCE_ALERT_TIME", "09:00")
+	hour, min, ok := parseClock(timeStr)
+	if !ok {
+		log.Printf("compliance: overdue alert disabled (COMPLIANCE_ALERT_TIME=%q)", timeStr)
+		return
+	}
+	loc := romeLocation()
+
+	go func() {
+		for {
+			now := time.Now().In(loc)
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			if _, err := materializeCompliance(ctx, pool); err != nil {
+				log.Printf("compliance: %v", err)
+			}
+			hotels, err := hotelIDs(ctx, pool)
+			if err != nil {
+				log.Printf("compliance: %v", err)
+				continue
+			}
+			tg := newBot(botToken)
+			for _, hotelID := range hotels {
+				text, err := overdueCompliance(ctx, pool, hotelID)
+				if err != nil {
+					log.Printf("compliance: hotel %d: %v", hotelID, err)
+					continue
+				}
+				if text == "" {
+					continue
+				}
+				managers, err := managerIDs(ctx, pool, hotelID)
+				if err != nil {
+					log.Printf("compliance: %v", err)
+					continue
+				}
+				for _, id := range managers {
+					if err := tg.Send(ctx, id, text); err != nil {
+						log.Printf("compliance: send to %d: %v", id, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// overdueCompliance lists the open checks of property hotelID due before
+// today, "" when none.
+func overdueCompliance(ctx context.Context, db querier, hotelID int) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT t.title, k.due_date
+		 FROM compliance_tasks k JOIN compliance_templates t ON t.id = k.template_id
+		 WHERE k.hotel_id = $1 AND k.status = 'open' AND k.due_date < (now() AT TIME ZONE 'Europe/Rome')::date
+		 ORDER BY k.due_date, t.title`, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("query overdue checks: %w", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var title string
+		var due time.Time
+		if err := rows.Scan(&title, &due); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("• %s — scaduto il %s", title, due.Format("02/01")))
+	}
+	if err := rows.Err(); err != nil || len(lines) == 0 {
+		return "", err
+	}
+	return "🧯 Controlli di sicurezza scaduti:\n" + strings.Join(lines, "\n") +
+		"\nRegistrali con complete_check appena fatti.", nil
+}
+
+// ── compliance_checks ────────────────────────────────────────────────────────
+
+type complianceChecksTool struct{}
+
+func (t *complianceChecksTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "compliance_checks",
+		Description: "Controlli periodici di sicurezza e HACCP (estintori, luci di emergenza, temperature frigo…): " +
+			"quelli da fare entro oggi o entro days_ahead giorni, con le istruzioni. Con code mostra anche gli ultimi esiti.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"days_ahead": {"type": "integer", "description": "Includi i controlli in scadenza nei prossimi N giorni (default 0)"},
+				"code": {"type": "string", "description": "Codice del controllo per vederne lo storico (opzionale)"}
+			}
+		}`),
+	}
+}
+
+func (t *complianceChecksTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		DaysAhead int    `json:"days_ahead"`
+		Code      string `json:"code"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.DaysAhead < 0 {
+		in.DaysAhead = 0
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	today := time.Now().In(romeLocation())
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	var sb strings.Builder
+	rows, err := db.Query(bg,
+		`SELECT k.id, t.code, t.title, COALESCE(t.instructions, ''), k.due_date,
+		        COALESCE(t.value_unit, ''), t.value_min::float8, t.value_max::float8
+		 FROM compliance_tasks k JOIN compliance_templates t ON t.id = k.template_id
+		 WHERE k.status = 'open' AND k.due_date <= $1::date + $2::int
+		   AND ($3::text = '' OR t.code = $3)
+		 ORDER BY k.due_date, t.title`,
+		today.Format("2006-01-02"), in.DaysAhead, in.Code)
+	if err != nil {
+		return "", fmt.Errorf("query checks: %w", err)
+	}
+	n := 0
+	for rows.Next() {
+		var id int64
+		var code, title, instructions, unit string
+		var due time.Time
+		var vmin, vmax *float64
+		if err := rows.Scan(&id, &code, &title, &instructions, &due, &unit, &vmin, &vmax); err != nil {
+			rows.Close()
+			return "", err
+		}
+		when := "oggi"
+		switch {
+		case due.Before(today):
+			when = "⚠️ scaduto il " + due.Format("02/01")
+		case due.After(today):
+			when = "entro il " + due.Format("02/01")
+		}
+		fmt.Fprintf(&sb, "#%d %s [%s] — %s\n", id, title, code, when)
+		if instructions != "" {
+			fmt.Fprintf(&sb, "   %s\n", instructions)
+		}
+		if vmin != nil || vmax != nil {
+			fmt.Fprintf(&sb, "   valore da registrare (%s)%s\n", unit, complianceRange(vmin, vmax, unit))
+		}
+		n++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		sb.WriteString("✅ Nessun controllo da fare.\n")
+	}
+
+	if in.Code != "" {
+		rows, err := db.Query(bg,
+			`SELECT k.due_date, k.completed_at, COALESCE(u.name, ''), k.value::float8, COALESCE(k.ok, true), COALESCE(k.notes, '')
+			 FROM compliance_tasks k JOIN compliance_templates t ON t.id = k.template_id
+			 LEFT JOIN users u ON u.telegram_id = k.completed_by
+			 WHERE t.code = $1 AND k.status = 'done'
+			 ORDER BY k.due_date DESC LIMIT 10`, in.Code)
+		if err != nil {
+			return "", fmt.Errorf("query history: %w", err)
+		}
+		defer rows.Close()
+		sb.WriteString("Ultimi esiti:\n")
+		h := 0
+		for rows.Next() {
+			var due, at time.Time
+			var who, notes string
+			var value *float64
+			var ok bool
+			if err := rows.Scan(&due, &at, &who, &value, &ok, &notes); err != nil {
+				return "", err
+			}
+			mark := "✅"
+			if !ok {
+				mark = "❌"
+			}
+			fmt.Fprintf(&sb, "%s %s — %s, %s", mark, due.Format("02/01"), who, at.In(romeLocation()).Format("02/01 15:04"))
+			if value != nil {
+				fmt.Fprintf(&sb, ", valore %g", *value)
+			}
+			if notes != "" {
+				fmt.Fprintf(&sb, " — %s", oneLine(notes))
+			}
+			sb.WriteString("\n")
+			h++
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		if h == 0 {
+			sb.WriteString("nessuno.\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// complianceRange renders " tra 0 e 4 °C", or "" without bounds.
+func complianceRange(vmin, vmax *float64, unit string) string {
+	switch {
+	case vmin != nil && vmax != nil:
+		return fmt.Sprintf(" tra %g e %g %s", *vmin, *vmax, unit)
+	case vmin != nil:
+		return fmt.Sprintf(" almeno %g %s", *vmin, unit)
+	case vmax != nil:
+		return fmt.Sprintf(" al massimo %g %s", *vmax, unit)
+	}
+	return ""
+}
+
+// ── complete_check ───────────────────────────────────────────────────────────
+
+type completeCheckTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *completeCheckTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "complete_check",
+		Description: "Registra l'esecuzione di un controllo periodico (per task_id o codice): esito, valore misurato " +
+			"(obbligatorio per le temperature) e note. Un esito non conforme viene segnalato subito ai manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"task_id": {"type": "integer", "description": "ID del controllo da compliance_checks"},
+				"code": {"type": "string", "description": "Codice del controllo, in alternativa a task_id"},
+				"value": {"type": "number", "description": "Valore misurato (es. temperatura)"},
+				"ok": {"type": "boolean", "description": "false se qualcosa non va (estintore scarico, lampada guasta). Default true"},
+				"notes": {"type": "string"}
+			}
+		}`),
+	}
+}
+
+func (t *completeCheckTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		TaskID *int64   `json:"task_id"`
+		Code   string   `json:"code"`
+		Value  *float64 `json:"value"`
+		OK     *bool    `json:"ok"`
+		Notes  string   `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.TaskID == nil && in.Code == "" {
+		return "", fmt.Errorf("give task_id or code")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var id, templateID int64
+	var title, unit string
+	var vmin, vmax *float64
+	if err := db.QueryRow(bg,
+		`SELECT k.id, t.id, t.title, COALESCE(t.value_unit, ''), t.value_min::float8, t.value_max::float8
+		 FROM compliance_tasks k JOIN compliance_templates t ON t.id = k.template_id
+		 WHERE k.status = 'open' AND (k.id = $1 OR ($1 IS NULL AND t.code = $2))`,
+		in.TaskID, in.Code,
+	).Scan(&id, &templateID, &title, &unit, &vmin, &vmax); err != nil {
+		return "", fmt.Errorf("nessun controllo aperto per %s", complianceRef(in.TaskID, in.Code))
+	}
+	if (vmin != nil || vmax != nil) && in.Value == nil {
+		return "", fmt.Errorf("%s: serve il valore misurato (%s)", title, unit)
+	}
+	ok := in.OK == nil || *in.OK
+	outOfRange := in.Value != nil && ((vmin != nil && *in.Value < *vmin) || (vmax != nil && *in.Value > *vmax))
+	if outOfRange {
+		ok = false
+	}
+	if _, err := db.Exec(bg,
+		`UPDATE compliance_tasks SET status = 'done', completed_by = $2, completed_at = now(),
+		        value = $3, ok = $4, notes = NULLIF($5, '')
+		 WHERE id = $1 AND status = 'open'`,
+		id, ctx.UserID, in.Value, ok, in.Notes,
+	); err != nil {
+		return "", fmt.Errorf("complete check: %w", err)
+	}
+	// Temperatures also go to the HACCP register (haccp.go).
+	if unit == "°C" && in.Value != nil {
+		if _, err := db.Exec(bg,
+			`INSERT INTO temperature_logs (template_id, value_c, in_range, logged_by, task_id, notes)
+			 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`,
+			templateID, *in.Value, !outOfRange, ctx.UserID, id, in.Notes,
+		); err != nil {
+			return "", fmt.Errorf("log temperature: %w", err)
+		}
+	}
+	if ok {
+		return fmt.Sprintf("✅ %s registrato.", title), nil
+	}
+	what := "esito non conforme"
+	if outOfRange {
+		what = fmt.Sprintf("valore %g %s fuori range%s", *in.Value, unit, complianceRange(vmin, vmax, unit))
+	}
+	complianceAlert(ctx, t.adminPool, t.botToken, title, what, in.Notes)
+	return fmt.Sprintf("❌ %s registrato: %s. I manager sono stati avvisati.", title, what), nil
+}
+
+func complianceRef(id *int64, code string) string {
+	if id != nil {
+		return fmt.Sprintf("#%d", *id)
+	}
+	return fmt.Sprintf("%q", code)
+}
+
+// complianceAlert tells the managers, other than the caller, about a failed
+// check recorded by the caller.
+func complianceAlert(ctx agent.ToolContext, adminPool *pgxpool.Pool, botToken, title, what, notes string) {
+	bg := context.Background()
+	var reporter string
+	var hotelID int
+	_ = adminPool.QueryRow(bg, `SELECT COALESCE(name, ''), hotel_id FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&reporter, &hotelID)
+	msg := fmt.Sprintf("🧯 %s: %s.\nRegistrato da %s.", title, what, reporter)
+	if notes != "" {
+		msg += "\nNote: " + notes
+	}
+	managers, err := managerIDs(bg, adminPool, hotelID)
+	if err != nil {
+		return
+	}
+	tg := newBot(botToken)
+	for _, m := range managers {
+		if m == ctx.UserID {
+			continue
+		}
+		_ = tg.Send(bg, m, msg)
+	}
+}
+
+// ── set_compliance_check ─────────────────────────────────────────────────────
+
+type setComplianceCheckTool struct{}
+
+func (t *setComplianceCheckTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_compliance_check",
+		Description: "Crea o modifica un controllo periodico (per codice): titolo, frequenza, istruzioni, range del valore " +
+			"da registrare; active=false lo sospende. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"code": {"type": "string", "description": "Codice breve, es. 'frigo_bar'"},
+				"title": {"type": "string"},
+				"frequency": {"type": "string", "enum": ["daily", "weekly", "monthly", "quarterly", "semiannual", "yearly"]},
+				"instructions": {"type": "string"},
+				"value_unit": {"type": "string", "description": "Unità del valore da registrare, es. '°C'"},
+				"value_min": {"type": "number"},
+				"value_max": {"type": "number"},
+				"active": {"type": "boolean"}
+			},
+			"required": ["code"]
+		}`),
+	}
+}
+
+func (t *setComplianceCheckTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Code         string   `json:"code"`
+		Title        *string  `json:"title"`
+		Frequency    *string  `json:"frequency"`
+		Instructions *string  `json:"instructions"`
+		ValueUnit    *string  `json:"value_unit"`
+		ValueMin     *float64 `json:"value_min"`
+		ValueMax     *float64 `json:"value_max"`
+		Active       *bool    `json:"active"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	in.Code = strings.TrimSpace(in.Code)
+	if in.Code == "" {
+		return "", fmt.Errorf("code is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_compliance_check is only available to managers")
+	}
+
+	var exists bool
+	if err := db.QueryRow(bg, `SELECT EXISTS (SELECT 1 FROM compliance_templates WHERE code = $1)`, in.Code).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		if _, err := db.Exec(bg,
+			`UPDATE compliance_templates SET
+			   title = COALESCE($2, title), frequency = COALESCE($3, frequency),
+			   instructions = CASE WHEN $4::text IS NULL THEN instructions ELSE NULLIF($4, '') END,
+			   value_unit = CASE WHEN $5::text IS NULL THEN value_unit ELSE NULLIF($5, '') END, value_min = COALESCE($6, value_min),
+			   value_max = COALESCE($7, value_max), active = COALESCE($8, active)
+			 WHERE code = $1`,
+			in.Code, in.Title, in.Frequency, in.Instructions, in.ValueUnit, in.ValueMin, in.ValueMax, in.Active,
+		); err != nil {
+			return "", fmt.Errorf("update check: %w", err)
+		}
+		if in.Active != nil && !*in.Active {
+			// A suspended check leaves nothing open behind.
+			if _, err := db.Exec(bg,
+				`DELETE FROM compliance_tasks k USING compliance_templates t
+				 WHERE t.id = k.template_id AND t.code = $1 AND k.status = 'open'`, in.Code); err != nil {
+				return "", fmt.Errorf("close open task: %w", err)
+			}
+		}
+	} else {
+		if in.Title == nil || in.Frequency == nil {
+			return "", fmt.Errorf("a new check needs title and frequency")
+		}
+		if _, err := db.Exec(bg,
+			`INSERT INTO compliance_templates (code, title, frequency, instructions, value_unit, value_min, value_max, active)
+			 VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, COALESCE($8, true))`,
+			in.Code, *in.Title, *in.Frequency, in.Instructions, in.ValueUnit, in.ValueMin, in.ValueMax, in.Active,
+		); err != nil {
+			return "", fmt.Errorf("insert check: %w", err)
+		}
+	}
+	if _, err := materializeCompliance(bg, db); err != nil {
+		return "", err
+	}
+	verb := "creato"
+	if exists {
+		verb = "aggiornato"
+	}
+	return fmt.Sprintf("🧯 Controllo %s %s.", in.Code, verb), nil
+}
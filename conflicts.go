@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ConflictResolver turns double assignments into a choice for the manager
+// instead of an error. The assignments_detect_conflict trigger (db/rls.sql)
+// records every clash in assignment_conflicts at insert time:
+//
+//	room     two cleaners on the same room, date and shift
+//	cleaner  one cleaner given more estimated work in a shift than it holds
+//
+// and NOTIFYs 'assignment_conflict'. The resolver sends each open conflict to
+// the managers with buttons "conf:<id>:new|old|both":
+//
+//	new   keep the new assignment, delete the existing one
+//	old   keep the existing assignment, delete the new one
+//	both  keep both (intentional, e.g. a two-person deep clean)
+type ConflictResolver struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+}
+
+func newConflictResolver(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *ConflictResolver {
+	return &ConflictResolver{adminPool: adminPool, registry: registry, botToken: botToken}
+}
+
+// Register wires the resolution buttons into the messenger.
+func (c *ConflictResolver) Register(m *routedMessenger) {
+	m.Handle("conf:", c.handleCallback)
+}
+
+// Start launches the listener that notifies managers of new conflicts.
+func (c *ConflictResolver) Start(ctx context.Context) {
+	startListener(ctx, c.adminPool, "assignment_conflict", c.drain)
+}
+
+type assignmentConflict struct {
+	id                        int64
+	hotelID                   int
+	kind                      string
+	date, shift               string
+	newRoom, newCleaner       string
+	existingRoom, existingCln string
+	// minutes of the cleaner's work in the shift and the shift length, for
+	// 'cleaner' conflicts.
+	minutes, shiftMinutes int
+}
+
+func (c *ConflictResolver) drain(ctx context.Context) {
+	rows, err := c.adminPool.Query(ctx,
+		`SELECT ac.id, n.hotel_id, ac.kind, n.date::text, n.shift,
+		        nr.name, COALESCE(nu.name, ''), er.name, COALESCE(eu.name, ''),
+		        COALESCE((SELECT sum(assignment_minutes(x.room_id, x.type)) FROM assignments x
+		                  WHERE x.cleaner_id = n.cleaner_id AND x.date = n.date AND x.shift = n.shift
+		                    AND x.status IN ('pending', 'in_progress')), 0)::int,
+		        COALESCE(shift_minutes(n.hotel_id, n.shift), 0)
+		 FROM assignment_conflicts ac
+		 JOIN assignments n ON n.id = ac.new_assignment_id
+		 JOIN assignments e ON e.id = ac.existing_assignment_id
+		 JOIN rooms nr ON nr.id = n.room_id
+		 JOIN rooms er ON er.id = e.room_id
+		 JOIN users nu ON nu.telegram_id = n.cleaner_id
+		 JOIN users eu ON eu.telegram_id = e.cleaner_id
+		 WHERE ac.notified_at IS NULL AND ac.resolved_at IS NULL
+		 ORDER BY ac.id`,
+	)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("conflicts query: %v", err)
+		}
+		return
+	}
+	var pending []assignmentConflict
+	for rows.Next() {
+		var a assignmentConflict
+		if err := rows.Scan(&a.id, &a.hotelID, &a.kind, &a.date, &a.shift,
+			&a.newRoom, &a.newCleaner, &a.existingRoom, &a.existingCln, &a.minutes, &a.shiftMinutes); err != nil {
+			log.Printf("conflicts scan: %v", err)
+			continue
+		}
+		pending = append(pending, a)
+	}
+	rows.Close()
+
+	for _, a := range pending {
+		c.notify(ctx, a)
+		if _, err := c.adminPool.Exec(ctx,
+			`UPDATE assignment_conflicts SET notified_at = now() WHERE id = $1`, a.id,
+		); err != nil {
+			log.Printf("conflicts mark notified (id=%d): %v", a.id, err)
+		}
+	}
+}
+
+func (c *ConflictResolver) notify(ctx context.Context, a assignmentConflict) {
+	var text string
+	if a.kind == "room" {
+		text = fmt.Sprintf("⚠️ <b>Doppia assegnazione</b> — camera %s, %s (%s)\n\nGià assegnata a <b>%s</b>, ora anche a <b>%s</b>.",
+			a.newRoom, a.date, a.shift, a.existingCln, a.newCleaner)
+	} else {
+		text = fmt.Sprintf("⚠️ <b>Turno pieno</b> — %s, %s (%s)\n\n"+
+			"Con la camera <b>%s</b> ha ~%s di lavoro stimato su un turno di %s. "+
+			"Tenendo la nuova tolgo la camera <b>%s</b>.",
+			a.newCleaner, a.date, shiftNames[a.shift], a.newRoom,
+			formatMinutes(a.minutes), formatMinutes(a.shiftMinutes), a.existingRoom)
+	}
+	id := strconv.FormatInt(a.id, 10)
+	buttons := []telegram.Button{
+		{Text: "Tieni la nuova", CallbackData: "conf:" + id + ":new"},
+		{Text: "Tieni la vecchia", CallbackData: "conf:" + id + ":old"},
+		{Text: "Tienile entrambe", CallbackData: "conf:" + id + ":both"},
+	}
+
+	managers, err := managerIDs(ctx, c.adminPool, a.hotelID)
+	if err != nil {
+		log.Printf("conflicts: %v", err)
+		return
+	}
+
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, c.botToken, m, text, [][]telegram.Button{buttons}); err != nil {
+			log.Printf("conflicts: notify manager %d: %v", m, err)
+		}
+	}
+}
+
+func (c *ConflictResolver) handleCallback(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed conflict callback")
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad conflict id: %w", err)
+	}
+	tg := newBot(c.botToken)
+
+	db, err := c.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	var role string
+	_ = c.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+
+	hotelID, err := hotelOf(ctx, c.adminPool, u.UserID)
+	if err != nil {
+		return err
+	}
+	// Deleting either assignment, here or by other means, sets its id NULL
+	// (ON DELETE SET NULL): such a conflict has nothing left to resolve.
+	var newID, existingID *int64
+	var resolvedAt *time.Time
+	if err := c.adminPool.QueryRow(ctx,
+		`SELECT new_assignment_id, existing_assignment_id, resolved_at
+		 FROM assignment_conflicts WHERE id = $1 AND hotel_id = $2`, id, hotelID,
+	).Scan(&newID, &existingID, &resolvedAt); err != nil {
+		return tg.Send(ctx, u.ChatID, "Conflitto non trovato.")
+	}
+	if resolvedAt != nil {
+		return tg.Send(ctx, u.ChatID, "Questo conflitto è già stato risolto.")
+	}
+	if newID == nil || existingID == nil {
+		return tg.Send(ctx, u.ChatID, "Una delle due assegnazioni è già stata rimossa: nessun conflitto da risolvere.")
+	}
+
+	var reply string
+	var tag pgconn.CommandTag
+	switch parts[2] {
+	case "new":
+		tag, err = db.Exec(ctx, `DELETE FROM assignments WHERE id = $1`, *existingID)
+		reply = "✅ Tenuta la nuova assegnazione, rimossa quella precedente."
+	case "old":
+		tag, err = db.Exec(ctx, `DELETE FROM assignments WHERE id = $1`, *newID)
+		reply = "✅ Tenuta l'assegnazione precedente, rimossa la nuova."
+	case "both":
+		reply = "✅ Tenute entrambe le assegnazioni."
+	default:
+		return fmt.Errorf("unknown resolution %q", parts[2])
+	}
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("❌ Non sono riuscito a risolvere il conflitto: %v", err))
+	}
+	// RLS hides rows the manager may not delete: nothing removed, no error.
+	if parts[2] != "both" && tag.RowsAffected() == 0 {
+		return tg.Send(ctx, u.ChatID, "❌ Non posso rimuovere quell'assegnazione: il conflitto resta aperto.")
+	}
+	tag, err = c.adminPool.Exec(ctx,
+		`UPDATE assignment_conflicts SET resolved_at = now(), resolved_by = $2, resolution = $3
+		 WHERE id = $1 AND hotel_id = $4 AND resolved_at IS NULL`,
+		id, u.UserID, parts[2], hotelID,
+	)
+	if err != nil {
+		log.Printf("conflicts: mark resolved (id=%d): %v", id, err)
+	} else if tag.RowsAffected() == 0 {
+		return tg.Send(ctx, u.ChatID, "Questo conflitto è già stato risolto.")
+	}
+	return tg.Send(ctx, u.ChatID, reply)
+}
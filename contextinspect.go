@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/session"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// /context <user> [n] shows the admin (ADMIN_TELEGRAM_ID) what the model
+// currently sees for a user: how many messages are in the conversation window,
+// a token estimate of the window and the system prompt, and the last n
+// messages, redacted — for "why does the bot think X" incidents without
+// opening the JSONL files on the server.
+//
+// The agent's history is private to the SDK, so it is rebuilt from the
+// session transcript: the current run starts at the last event without a
+// parentId (the repair pass at startup links all earlier runs), and the agent
+// keeps the last contextWindow messages of it. Group and topic conversations
+// of the user (see chatContexts) are listed too.
+
+// contextWindow is the history the SDK agent sends to the model
+// (agent.NewContextManager(40)).
+const contextWindow = 40
+
+type contextInspector struct {
+	adminPool    *pgxpool.Pool
+	botToken     string
+	adminID      int64
+	sessionDir   string
+	contexts     *chatContexts
+	redactor     *redactor
+	systemPrompt func(ctx context.Context, userID int64, override string) string
+}
+
+// Register wires /context.
+func (c *contextInspector) Register(m *routedMessenger) {
+	m.Handle("/context", c.handleCommand)
+}
+
+func (c *contextInspector) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := telegram.New(c.botToken)
+	if u.UserID != c.adminID {
+		return tg.Send(ctx, u.ChatID, "🔒 /context è riservato all'amministratore.")
+	}
+	args := strings.Fields(strings.TrimPrefix(u.Text, "/context"))
+	n := 10
+	if len(args) > 1 {
+		if v, err := strconv.Atoi(args[len(args)-1]); err == nil && v > 0 {
+			n = min(v, contextWindow)
+			args = args[:len(args)-1]
+		}
+	}
+	if len(args) == 0 {
+		return tg.Send(ctx, u.ChatID, "Uso: /context <telegram_id o nome> [n messaggi, default 10]")
+	}
+	who := strings.Join(args, " ")
+
+	rows, err := c.adminPool.Query(ctx,
+		`SELECT telegram_id, COALESCE(name, ''), role FROM users
+		 WHERE telegram_id::text = $1 OR name ILIKE '%' || $1 || '%'
+		 ORDER BY name LIMIT 6`, who)
+	if err != nil {
+		return err
+	}
+	type match struct {
+		id         int64
+		name, role string
+	}
+	var found []match
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.id, &m.name, &m.role); err != nil {
+			rows.Close()
+			return err
+		}
+		found = append(found, m)
+	}
+	rows.Close()
+	switch {
+	case len(found) == 0:
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("Nessun utente %q.", who))
+	case len(found) > 1:
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Più utenti corrispondono a %q, indica il telegram_id:", who)
+		for _, m := range found {
+			fmt.Fprintf(&sb, "\n• %d %s (%s)", m.id, m.name, m.role)
+		}
+		return tg.Send(ctx, u.ChatID, sb.String())
+	}
+	target := found[0]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧠 Contesto di %s (%d, %s)\n", target.name, target.id, target.role)
+	prompt := c.systemPrompt(ctx, target.id, "")
+	fmt.Fprintf(&sb, "Prompt di sistema: ~%d token\n", estimateTokens(len(prompt)))
+	for _, key := range append([]int64{target.id}, c.contexts.KeysOf(target.id)...) {
+		sb.WriteString("\n")
+		cc := c.contexts.Context(key)
+		if cc.chatID == target.id {
+			sb.WriteString("💬 Chat privata")
+		} else {
+			fmt.Fprintf(&sb, "👥 Gruppo %d", cc.chatID)
+		}
+		if cc.topic != "" {
+			fmt.Fprintf(&sb, ", argomento «%s»", cc.topic)
+		}
+		if cc.topic == c.contexts.Topic(target.id, cc.chatID) {
+			sb.WriteString(" (attiva)")
+		}
+		fmt.Fprintf(&sb, " — conversazione %d: ", key)
+		run, err := currentRun(filepath.Join(c.sessionDir, fmt.Sprintf("%d.jsonl", key)))
+		if err != nil {
+			fmt.Fprintf(&sb, "transcript non leggibile: %v\n", err)
+			continue
+		}
+		if len(run) == 0 {
+			sb.WriteString("nessun messaggio da questo avvio.\n")
+			continue
+		}
+		window := run[max(0, len(run)-contextWindow):]
+		size := 0
+		for _, m := range window {
+			b, _ := json.Marshal(m)
+			size += len(b)
+		}
+		fmt.Fprintf(&sb, "%d messaggi nella finestra (max %d, %d da questo avvio), ~%d token\n",
+			len(window), contextWindow, len(run), estimateTokens(size))
+		for _, m := range window[max(0, len(window)-n):] {
+			sb.WriteString(c.describe(m))
+		}
+	}
+	return tg.Send(ctx, u.ChatID, sb.String())
+}
+
+// estimateTokens is the usual ~4 characters per token.
+func estimateTokens(chars int) int {
+	return (chars + 3) / 4
+}
+
+// currentRun returns the messages recorded in path since this process
+// started; no file means no messages.
+func currentRun(path string) ([]llm.Message, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run []llm.Message
+	for _, line := range strings.Split(string(raw), "\n") {
+		var ev session.Event
+		if json.Unmarshal([]byte(line), &ev) != nil || ev.ID == "" {
+			continue
+		}
+		if ev.ParentID == "" {
+			run = run[:0]
+		}
+		if ev.Type == "message" && ev.Message != nil {
+			run = append(run, *ev.Message)
+		}
+	}
+	return run, nil
+}
+
+// describe renders one message as short, redacted lines.
+func (c *contextInspector) describe(m llm.Message) string {
+	icon := "👤"
+	if m.Role == "assistant" {
+		icon = "🤖"
+	}
+	var sb strings.Builder
+	for _, b := range m.Content {
+		switch b.Type {
+		case "text":
+			fmt.Fprintf(&sb, "%s %s\n", icon, c.clip(b.Text))
+		case "tool_use":
+			if b.ToolCall != nil {
+				fmt.Fprintf(&sb, "🔧 %s %s\n", b.ToolCall.Name, c.clip(string(b.ToolCall.Arguments)))
+			}
+		case "tool_result":
+			if b.ToolResult != nil {
+				mark := "↩️"
+				if b.ToolResult.IsError {
+					mark = "⚠️"
+				}
+				fmt.Fprintf(&sb, "%s %s\n", mark, c.clip(b.ToolResult.Content))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func (c *contextInspector) clip(s string) string {
+	s = c.redactor.String(oneLine(s))
+	if r := []rune(s); len(r) > 200 {
+		s = string(r[:200]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// countdownStages are the minutes before a same-day arrival at which the
+// assigned cleaner(s) and the managers are warned that the room is not ready.
+// Ordered from least to most urgent.
+var countdownStages = []struct {
+	minutes int
+	icon    string
+	label   string
+}{
+	{90, "ℹ️", "tra 90 minuti"},
+	{45, "⚠️", "tra 45 minuti"},
+	{15, "🚨", "tra 15 minuti — URGENTE"},
+}
+
+// startCountdownProducer launches a background goroutine that checks every
+// minute for turnover rooms (a departure and an arrival on the same day) whose
+// next guest is due soon and whose status is not 'ready' yet. Notifications
+// are sent directly via Telegram (no LLM turn): they are time-critical and
+// fully determined by the data. countdown_notifications dedups each stage.
+func startCountdownProducer(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	go func() {
+		log.Printf("countdown producer started")
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		for {
+			checkCountdowns(ctx, pool, botToken)
+			select {
+			case <-ctx.Done():
+				log.Printf("countdown producer stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type turnover struct {
+	reservationID int64
+	roomID        int64
+	roomName      string
+	roomStatus    string
+	guestName     string
+	eta           time.Time
+}
+
+func checkCountdowns(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	maxMinutes := countdownStages[0].minutes
+	rows, err := pool.Query(ctx,
+		`SELECT arr.id, r.id, r.name, r.status, COALESCE(arr.guest_name, ''), arr.checkin_at
+		 FROM reservations arr
+		 JOIN rooms r ON r.id = arr.room_id
+		 WHERE arr.status = 'confirmed'
+		   AND arr.checkin_at > now()
+		   AND arr.checkin_at <= now() + make_interval(mins => $1)
+		   AND r.status <> 'ready'
+		   AND EXISTS (
+		       SELECT 1 FROM reservations dep
+		       WHERE dep.room_id = arr.room_id AND dep.id <> arr.id AND dep.status = 'confirmed'
+		         AND (dep.checkout_at AT TIME ZONE 'Europe/Rome')::date = (arr.checkin_at AT TIME ZONE 'Europe/Rome')::date
+		         AND dep.checkout_at <= arr.checkin_at)`, maxMinutes,
+	)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("countdown query: %v", err)
+		}
+		return
+	}
+	var due []turnover
+	for rows.Next() {
+		var t turnover
+		if err := rows.Scan(&t.reservationID, &t.roomID, &t.roomName, &t.roomStatus, &t.guestName, &t.eta); err != nil {
+			log.Printf("countdown scan: %v", err)
+			continue
+		}
+		due = append(due, t)
+	}
+	rows.Close()
+
+	for _, t := range due {
+		minutesLeft := int(time.Until(t.eta).Minutes())
+		stage := -1
+		for i, s := range countdownStages {
+			if minutesLeft <= s.minutes {
+				stage = i
+			}
+		}
+		if stage < 0 || !claimCountdownStage(ctx, pool, t.reservationID, stage) {
+			continue
+		}
+		notifyCountdown(ctx, pool, botToken, t, stage)
+	}
+}
+
+// claimCountdownStage records stage (and any earlier, skipped stages) as sent.
+// Returns false if this stage was already notified.
+func claimCountdownStage(ctx context.Context, pool *pgxpool.Pool, reservationID int64, stage int) bool {
+	tag, err := pool.Exec(ctx,
+		`INSERT INTO countdown_notifications (reservation_id, stage_minutes)
+		 VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		reservationID, countdownStages[stage].minutes,
+	)
+	if err != nil {
+		log.Printf("countdown claim (reservation=%d): %v", reservationID, err)
+		return false
+	}
+	if tag.RowsAffected() == 0 {
+		return false
+	}
+	for _, s := range countdownStages[:stage] {
+		_, _ = pool.Exec(ctx,
+			`INSERT INTO countdown_notifications (reservation_id, stage_minutes)
+			 VALUES ($1, $2) ON CONFLICT DO NOTHING`, reservationID, s.minutes)
+	}
+	return true
+}
+
+func notifyCountdown(ctx context.Context, pool *pgxpool.Pool, botToken string, t turnover, stage int) {
+	s := countdownStages[stage]
+	guest := t.guestName
+	if guest == "" {
+		guest = "nuovo ospite"
+	}
+	msg := fmt.Sprintf("%s Camera %s non ancora pronta (stato: %s). Arrivo di %s %s, alle %s.",
+		s.icon, t.roomName, t.roomStatus, guest, s.label, t.eta.In(romeLocation()).Format("15:04"))
+
+	rows, err := pool.Query(ctx,
+		`SELECT DISTINCT telegram_id FROM (
+		     SELECT cleaner_id AS telegram_id FROM assignments
+		     WHERE room_id = $1 AND date = (now() AT TIME ZONE 'Europe/Rome')::date
+		       AND status IN ('pending', 'in_progress')
+		     UNION
+		     SELECT telegram_id FROM users
+		     WHERE role = 'manager' AND hotel_id = (SELECT hotel_id FROM rooms WHERE id = $1)
+		 ) t`, t.roomID,
+	)
+	if err != nil {
+		log.Printf("countdown recipients (room=%d): %v", t.roomID, err)
+		return
+	}
+	var recipients []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			recipients = append(recipients, id)
+		}
+	}
+	rows.Close()
+
+	tg := newBot(botToken)
+	for _, id := range recipients {
+		if err := tg.Send(ctx, id, msg); err != nil {
+			log.Printf("countdown send to %d: %v", id, err)
+		}
+	}
+	log.Printf("countdown T-%d sent for room %s (reservation=%d) to %d recipient(s)",
+		s.minutes, t.roomName, t.reservationID, len(recipients))
+}
+
+// romeLocation returns the hotel's timezone, falling back to UTC.
+func romeLocation() *time.Location {
+	loc, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -26,6 +26,888 @@ CREATE OR REPLACE FUNCTION is_manager() RETURNS boolean AS $$
     );
 $$ LANGUAGE sql STABLE SECURITY DEFINER;
 
+-- current_hotel_id() is the property the current connection's user works at;
+-- NULL for the bot's own (superuser) connection.
+CREATE OR REPLACE FUNCTION current_hotel_id() RETURNS integer AS $$
+    SELECT hotel_id FROM users WHERE telegram_id = current_telegram_id();
+$$ LANGUAGE sql STABLE SECURITY DEFINER;
+
+-- ── Triggers ──────────────────────────────────────────────────────────────────
+
+-- assign_hotel_id() stamps hotel_id on new rows so nobody has to pass it,
+-- taking it from:
+--
+--   room         reservations, assignments, room inspections, minibar
+--                consumption, room blocks, the DND log, recurring tasks,
+--                cleaning standards, room status events, channel feeds;
+--                meter readings, tips, tickets, lost items and rates that
+--                have a room
+--   room type    rates without a room
+--   assignment   cleaning reviews
+--   supply       supply movements
+--   reservation  guest requests, guest messages, reservation extras, guest
+--                documents
+--   template     compliance tasks, temperature logs
+--   creator      rooms, room types, users, invites, invoices, payments, staff
+--                absences, checklists, supplies, minibar items, compliance and
+--                reminder templates, guests, booking groups and channels,
+--                extras, incidents, shifts, shift assignments, work sessions,
+--                keys, parking spots, hotel info and settings, rate rules,
+--                knowledge base notes, guest message templates, content
+--                templates, saved queries; meter
+--                readings, tips, tickets and lost items without a room
+--
+-- Rows written by the bot keep the hotel_id they were given (or the column
+-- default).
+CREATE OR REPLACE FUNCTION assign_hotel_id() RETURNS trigger AS $$
+DECLARE h integer;
+BEGIN
+    IF TG_TABLE_NAME IN ('reservations', 'assignments', 'room_inspections', 'minibar_consumption', 'room_blocks', 'dnd_log', 'recurring_tasks', 'cleaning_standards', 'room_status_events', 'channel_feeds') THEN
+        SELECT hotel_id INTO h FROM rooms WHERE id = NEW.room_id;
+    ELSIF TG_TABLE_NAME IN ('meter_readings', 'tips', 'maintenance_tickets', 'lost_found', 'rates') AND NEW.room_id IS NOT NULL THEN
+        SELECT hotel_id INTO h FROM rooms WHERE id = NEW.room_id;
+    ELSIF TG_TABLE_NAME = 'rates' AND NEW.room_type_id IS NOT NULL THEN
+        SELECT hotel_id INTO h FROM room_types WHERE id = NEW.room_type_id;
+    ELSIF TG_TABLE_NAME = 'reviews' THEN
+        SELECT hotel_id INTO h FROM assignments WHERE id = NEW.assignment_id;
+    ELSIF TG_TABLE_NAME = 'supply_movements' THEN
+        SELECT hotel_id INTO h FROM supplies WHERE id = NEW.supply_id;
+    ELSIF TG_TABLE_NAME IN ('compliance_tasks', 'temperature_logs') THEN
+        SELECT hotel_id INTO h FROM compliance_templates WHERE id = NEW.template_id;
+    ELSIF TG_TABLE_NAME IN ('guest_requests', 'guest_messages', 'reservation_extras', 'guest_documents') THEN
+        SELECT hotel_id INTO h FROM reservations WHERE id = NEW.reservation_id;
+    ELSE
+        h := current_hotel_id();
+    END IF;
+    IF h IS NOT NULL THEN
+        NEW.hotel_id := h;
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS room_types_assign_hotel ON room_types;
+CREATE TRIGGER room_types_assign_hotel
+    BEFORE INSERT ON room_types
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS rooms_assign_hotel ON rooms;
+CREATE TRIGGER rooms_assign_hotel
+    BEFORE INSERT ON rooms
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS users_assign_hotel ON users;
+CREATE TRIGGER users_assign_hotel
+    BEFORE INSERT ON users
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS invites_assign_hotel ON invites;
+CREATE TRIGGER invites_assign_hotel
+    BEFORE INSERT ON invites
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS invoices_assign_hotel ON invoices;
+CREATE TRIGGER invoices_assign_hotel
+    BEFORE INSERT ON invoices
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS payments_assign_hotel ON payments;
+CREATE TRIGGER payments_assign_hotel
+    BEFORE INSERT ON payments
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS staff_absences_assign_hotel ON staff_absences;
+CREATE TRIGGER staff_absences_assign_hotel
+    BEFORE INSERT ON staff_absences
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS checklists_assign_hotel ON checklists;
+CREATE TRIGGER checklists_assign_hotel
+    BEFORE INSERT ON checklists
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS supplies_assign_hotel ON supplies;
+CREATE TRIGGER supplies_assign_hotel
+    BEFORE INSERT ON supplies
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS supply_movements_assign_hotel ON supply_movements;
+CREATE TRIGGER supply_movements_assign_hotel
+    BEFORE INSERT ON supply_movements
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS minibar_items_assign_hotel ON minibar_items;
+CREATE TRIGGER minibar_items_assign_hotel
+    BEFORE INSERT ON minibar_items
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS minibar_consumption_assign_hotel ON minibar_consumption;
+CREATE TRIGGER minibar_consumption_assign_hotel
+    BEFORE INSERT ON minibar_consumption
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS compliance_templates_assign_hotel ON compliance_templates;
+CREATE TRIGGER compliance_templates_assign_hotel
+    BEFORE INSERT ON compliance_templates
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS reminder_templates_assign_hotel ON reminder_templates;
+CREATE TRIGGER reminder_templates_assign_hotel
+    BEFORE INSERT ON reminder_templates
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS compliance_tasks_assign_hotel ON compliance_tasks;
+CREATE TRIGGER compliance_tasks_assign_hotel
+    BEFORE INSERT ON compliance_tasks
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS tips_assign_hotel ON tips;
+CREATE TRIGGER tips_assign_hotel
+    BEFORE INSERT ON tips
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS room_status_events_assign_hotel ON room_status_events;
+CREATE TRIGGER room_status_events_assign_hotel
+    BEFORE INSERT ON room_status_events
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS channel_feeds_assign_hotel ON channel_feeds;
+CREATE TRIGGER channel_feeds_assign_hotel
+    BEFORE INSERT ON channel_feeds
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS maintenance_tickets_assign_hotel ON maintenance_tickets;
+CREATE TRIGGER maintenance_tickets_assign_hotel
+    BEFORE INSERT ON maintenance_tickets
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS lost_found_assign_hotel ON lost_found;
+CREATE TRIGGER lost_found_assign_hotel
+    BEFORE INSERT ON lost_found
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS rates_assign_hotel ON rates;
+CREATE TRIGGER rates_assign_hotel
+    BEFORE INSERT ON rates
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS reservation_extras_assign_hotel ON reservation_extras;
+CREATE TRIGGER reservation_extras_assign_hotel
+    BEFORE INSERT ON reservation_extras
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS guests_assign_hotel ON guests;
+CREATE TRIGGER guests_assign_hotel
+    BEFORE INSERT ON guests
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS booking_channels_assign_hotel ON booking_channels;
+CREATE TRIGGER booking_channels_assign_hotel
+    BEFORE INSERT ON booking_channels
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS extras_assign_hotel ON extras;
+CREATE TRIGGER extras_assign_hotel
+    BEFORE INSERT ON extras
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS knowledge_base_assign_hotel ON knowledge_base;
+CREATE TRIGGER knowledge_base_assign_hotel
+    BEFORE INSERT ON knowledge_base
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS content_templates_assign_hotel ON content_templates;
+CREATE TRIGGER content_templates_assign_hotel
+    BEFORE INSERT ON content_templates
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS saved_queries_assign_hotel ON saved_queries;
+CREATE TRIGGER saved_queries_assign_hotel
+    BEFORE INSERT ON saved_queries
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS meter_readings_assign_hotel ON meter_readings;
+CREATE TRIGGER meter_readings_assign_hotel
+    BEFORE INSERT ON meter_readings
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS temperature_logs_assign_hotel ON temperature_logs;
+CREATE TRIGGER temperature_logs_assign_hotel
+    BEFORE INSERT ON temperature_logs
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS guest_requests_assign_hotel ON guest_requests;
+CREATE TRIGGER guest_requests_assign_hotel
+    BEFORE INSERT ON guest_requests
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS guest_messages_assign_hotel ON guest_messages;
+CREATE TRIGGER guest_messages_assign_hotel
+    BEFORE INSERT ON guest_messages
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS guest_documents_assign_hotel ON guest_documents;
+CREATE TRIGGER guest_documents_assign_hotel
+    BEFORE INSERT ON guest_documents
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS guest_message_templates_assign_hotel ON guest_message_templates;
+CREATE TRIGGER guest_message_templates_assign_hotel
+    BEFORE INSERT ON guest_message_templates
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS incidents_assign_hotel ON incidents;
+CREATE TRIGGER incidents_assign_hotel
+    BEFORE INSERT ON incidents
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS shifts_assign_hotel ON shifts;
+CREATE TRIGGER shifts_assign_hotel
+    BEFORE INSERT ON shifts
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS shift_assignments_assign_hotel ON shift_assignments;
+CREATE TRIGGER shift_assignments_assign_hotel
+    BEFORE INSERT ON shift_assignments
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS work_sessions_assign_hotel ON work_sessions;
+CREATE TRIGGER work_sessions_assign_hotel
+    BEFORE INSERT ON work_sessions
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS hotel_info_assign_hotel ON hotel_info;
+CREATE TRIGGER hotel_info_assign_hotel
+    BEFORE INSERT ON hotel_info
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS parking_spots_assign_hotel ON parking_spots;
+CREATE TRIGGER parking_spots_assign_hotel
+    BEFORE INSERT ON parking_spots
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS keys_assign_hotel ON keys;
+CREATE TRIGGER keys_assign_hotel
+    BEFORE INSERT ON keys
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS room_blocks_assign_hotel ON room_blocks;
+CREATE TRIGGER room_blocks_assign_hotel
+    BEFORE INSERT ON room_blocks
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS dnd_log_assign_hotel ON dnd_log;
+CREATE TRIGGER dnd_log_assign_hotel
+    BEFORE INSERT ON dnd_log
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS recurring_tasks_assign_hotel ON recurring_tasks;
+CREATE TRIGGER recurring_tasks_assign_hotel
+    BEFORE INSERT ON recurring_tasks
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS hotel_settings_assign_hotel ON hotel_settings;
+CREATE TRIGGER hotel_settings_assign_hotel
+    BEFORE INSERT ON hotel_settings
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS room_inspections_assign_hotel ON room_inspections;
+CREATE TRIGGER room_inspections_assign_hotel
+    BEFORE INSERT ON room_inspections
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS reviews_assign_hotel ON reviews;
+CREATE TRIGGER reviews_assign_hotel
+    BEFORE INSERT ON reviews
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS cleaning_standards_assign_hotel ON cleaning_standards;
+CREATE TRIGGER cleaning_standards_assign_hotel
+    BEFORE INSERT ON cleaning_standards
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS reservations_assign_hotel ON reservations;
+CREATE TRIGGER reservations_assign_hotel
+    BEFORE INSERT OR UPDATE OF room_id ON reservations
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS booking_groups_assign_hotel ON booking_groups;
+CREATE TRIGGER booking_groups_assign_hotel
+    BEFORE INSERT ON booking_groups
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS rate_rules_assign_hotel ON rate_rules;
+CREATE TRIGGER rate_rules_assign_hotel
+    BEFORE INSERT ON rate_rules
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+DROP TRIGGER IF EXISTS assignments_assign_hotel ON assignments;
+CREATE TRIGGER assignments_assign_hotel
+    BEFORE INSERT OR UPDATE OF room_id ON assignments
+    FOR EACH ROW EXECUTE FUNCTION assign_hotel_id();
+
+-- cancel_assignment_reminders() cancels pending reminders attached to an
+-- assignment once it is done, skipped, or deleted, so cleaners are not nagged
+-- about rooms they already finished. SECURITY DEFINER: the cleaner finishing
+-- the task may not own the reminders (e.g. a manager scheduled them).
+CREATE OR REPLACE FUNCTION cancel_assignment_reminders() RETURNS trigger AS $$
+BEGIN
+    UPDATE reminders SET cancelled_at = now()
+    WHERE assignment_id = OLD.id AND fired_at IS NULL AND cancelled_at IS NULL;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS assignments_cancel_reminders ON assignments;
+CREATE TRIGGER assignments_cancel_reminders
+    AFTER UPDATE OF status ON assignments
+    FOR EACH ROW WHEN (NEW.status IN ('done', 'skipped') AND OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION cancel_assignment_reminders();
+
+DROP TRIGGER IF EXISTS assignments_cancel_reminders_delete ON assignments;
+CREATE TRIGGER assignments_cancel_reminders_delete
+    BEFORE DELETE ON assignments
+    FOR EACH ROW EXECUTE FUNCTION cancel_assignment_reminders();
+
+-- assignment_acceptance() keeps the acceptance columns (acceptance.go)
+-- honest: an assignment the cleaner took themselves, or has started, counts
+-- as accepted; one moved to another cleaner must be accepted again.
+CREATE OR REPLACE FUNCTION assignment_acceptance() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.cleaner_id IS DISTINCT FROM OLD.cleaner_id THEN
+        NEW.accept_requested_at := NULL;
+        NEW.accepted_at := NULL;
+        NEW.accept_flagged_at := NULL;
+    END IF;
+    IF NEW.accepted_at IS NULL AND (NEW.cleaner_id = current_telegram_id() OR NEW.status <> 'pending') THEN
+        NEW.accepted_at := now();
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS assignments_acceptance ON assignments;
+CREATE TRIGGER assignments_acceptance
+    BEFORE INSERT OR UPDATE OF cleaner_id, status ON assignments
+    FOR EACH ROW EXECUTE FUNCTION assignment_acceptance();
+
+-- assignment_timestamps() stamps started_at when work begins and
+-- completed_at when it is done, whoever changes the status, for the
+-- completion times of cleaner_stats (cleanerstats.go).
+CREATE OR REPLACE FUNCTION assignment_timestamps() RETURNS trigger AS $$
+BEGIN
+    IF NEW.status = 'in_progress' AND NEW.started_at IS NULL THEN
+        NEW.started_at := now();
+    END IF;
+    IF NEW.status = 'done' AND NEW.completed_at IS NULL THEN
+        NEW.completed_at := now();
+    ELSIF NEW.status <> 'done' THEN
+        NEW.completed_at := NULL;
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS assignments_timestamps ON assignments;
+CREATE TRIGGER assignments_timestamps
+    BEFORE INSERT OR UPDATE OF status ON assignments
+    FOR EACH ROW EXECUTE FUNCTION assignment_timestamps();
+
+-- log_room_status_change() records every rooms.status transition with the
+-- acting user (NULL when the bot itself changed it) and wakes the Go
+-- dispatcher (roomevents.go) via NOTIFY room_status.
+CREATE OR REPLACE FUNCTION log_room_status_change() RETURNS trigger AS $$
+DECLARE ev_id bigint;
+BEGIN
+    INSERT INTO room_status_events (room_id, old_status, new_status, actor_id)
+    VALUES (NEW.id, OLD.status, NEW.status, current_telegram_id())
+    RETURNING id INTO ev_id;
+    PERFORM pg_notify('room_status', ev_id::text);
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS rooms_status_change ON rooms;
+CREATE TRIGGER rooms_status_change
+    AFTER UPDATE OF status ON rooms
+    FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status)
+    EXECUTE FUNCTION log_room_status_change();
+
+-- room_inspection_pending() is true when the room's checklist (its room
+-- type's, else the property's default) is required and its last checkout
+-- clean has no passed inspection since. The lifecycle (lifecycle.go) parks
+-- such rooms in inspection_due instead of ready/available.
+CREATE OR REPLACE FUNCTION room_inspection_pending(room integer) RETURNS boolean AS $$
+    SELECT COALESCE((
+        SELECT c.required
+        FROM rooms r
+        JOIN checklists c ON c.hotel_id = r.hotel_id
+                         AND (c.room_type_id = r.room_type_id OR c.room_type_id IS NULL)
+        WHERE r.id = room
+        ORDER BY c.room_type_id IS NULL
+        LIMIT 1), false)
+    AND EXISTS (
+        SELECT 1
+        FROM (SELECT a.completed_at FROM assignments a
+              WHERE a.room_id = room AND a.type = 'checkout' AND a.status = 'done'
+              ORDER BY a.completed_at DESC NULLS LAST LIMIT 1) last
+        WHERE NOT EXISTS (SELECT 1 FROM room_inspections i
+                          WHERE i.room_id = room AND i.passed
+                            AND i.created_at >= COALESCE(last.completed_at, '-infinity')))
+$$ LANGUAGE sql STABLE;
+
+-- room_inspection_gate() keeps a room coming out of a checkout clean from
+-- becoming ready or available while its inspection is pending, whoever sets
+-- the status (execute_sql included).
+CREATE OR REPLACE FUNCTION room_inspection_gate() RETURNS trigger AS $$
+BEGIN
+    IF room_inspection_pending(NEW.id) THEN
+        RAISE EXCEPTION 'room % cannot become % before its inspection passes (inspect_room)', NEW.name, NEW.status;
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS rooms_inspection_gate ON rooms;
+CREATE TRIGGER rooms_inspection_gate
+    BEFORE UPDATE OF status ON rooms
+    FOR EACH ROW WHEN (NEW.status IN ('ready', 'available')
+                       AND OLD.status IN ('checkout_due', 'cleaning', 'inspection_due'))
+    EXECUTE FUNCTION room_inspection_gate();
+
+-- assignment_minutes() estimates a task of type task on room the way the daily
+-- plan does (AutoAssigner.estimate, assignments.go): the room's cleaning
+-- standard, else the median of at least three timed cleans in the last 90
+-- days, else the room type's cleaning_minutes (45 without a type) scaled by the
+-- default ASSIGN_WEIGHT_* ratios (stayover 1/3, deep clean 2x).
+CREATE OR REPLACE FUNCTION assignment_minutes(room integer, task text) RETURNS integer AS $$
+    SELECT COALESCE(
+        (SELECT s.minutes FROM cleaning_standards s WHERE s.room_id = room AND s.kind = task),
+        (SELECT greatest(1, round(percentile_cont(0.5) WITHIN GROUP (
+                    ORDER BY extract(epoch FROM a.completed_at - a.started_at) / 60))::int)
+         FROM assignments a
+         WHERE a.room_id = room AND a.type = task AND a.status = 'done'
+           AND a.completed_at > a.started_at AND a.completed_at - a.started_at <= interval '4 hours'
+           AND a.date >= (now() AT TIME ZONE 'Europe/Rome')::date - 90
+         HAVING count(*) >= 3),
+        (SELECT greatest(1, COALESCE(t.cleaning_minutes, 45)
+                            * CASE task WHEN 'checkout' THEN 3 WHEN 'stayover' THEN 1 WHEN 'deep_clean' THEN 6 ELSE 0 END / 3)
+         FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id
+         WHERE r.id = room))
+$$ LANGUAGE sql STABLE;
+
+-- shift_minutes() is the length of a property's shift (shifts), NULL when the
+-- property has not defined it.
+CREATE OR REPLACE FUNCTION shift_minutes(hotel integer, shift text) RETURNS integer AS $$
+    SELECT (extract(epoch FROM ends_at - starts_at) / 60)::int
+           + CASE WHEN ends_at > starts_at THEN 0 ELSE 1440 END
+    FROM shifts WHERE hotel_id = hotel AND name = shift
+$$ LANGUAGE sql STABLE;
+
+-- detect_assignment_conflict() records clashes with the new assignment instead
+-- of rejecting it. Only active (pending/in_progress) assignments count.
+--
+--   room     the same room, date and shift given to another cleaner
+--   cleaner  the cleaner's estimated minutes in that date and shift
+--            (assignment_minutes) no longer fit the shift (shift_minutes);
+--            recorded against their latest other assignment there, the one
+--            to drop to make room. Not checked where the shift is not defined.
+--
+-- conflicts.go offers the manager resolution buttons.
+CREATE OR REPLACE FUNCTION detect_assignment_conflict() RETURNS trigger AS $$
+DECLARE n integer; total integer; shift_len integer; other integer;
+BEGIN
+    INSERT INTO assignment_conflicts (hotel_id, kind, new_assignment_id, existing_assignment_id)
+    SELECT NEW.hotel_id, 'room', NEW.id, a.id
+    FROM assignments a
+    WHERE a.id <> NEW.id
+      AND a.room_id = NEW.room_id AND a.cleaner_id <> NEW.cleaner_id
+      AND a.date = NEW.date AND a.shift = NEW.shift
+      AND a.status IN ('pending', 'in_progress');
+    GET DIAGNOSTICS n = ROW_COUNT;
+
+    shift_len := shift_minutes(NEW.hotel_id, NEW.shift);
+    IF shift_len IS NOT NULL AND NEW.status IN ('pending', 'in_progress') THEN
+        SELECT sum(assignment_minutes(a.room_id, a.type)) INTO total
+        FROM assignments a
+        WHERE a.cleaner_id = NEW.cleaner_id AND a.date = NEW.date AND a.shift = NEW.shift
+          AND a.status IN ('pending', 'in_progress');
+        SELECT a.id INTO other
+        FROM assignments a
+        WHERE a.id <> NEW.id
+          AND a.cleaner_id = NEW.cleaner_id AND a.date = NEW.date AND a.shift = NEW.shift
+          AND a.status IN ('pending', 'in_progress')
+        ORDER BY a.status = 'pending' DESC, a.id DESC
+        LIMIT 1;
+        IF total > shift_len AND other IS NOT NULL THEN
+            INSERT INTO assignment_conflicts (hotel_id, kind, new_assignment_id, existing_assignment_id)
+            VALUES (NEW.hotel_id, 'cleaner', NEW.id, other);
+            n := n + 1;
+        END IF;
+    END IF;
+
+    IF n > 0 THEN
+        PERFORM pg_notify('assignment_conflict', NEW.id::text);
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS assignments_detect_conflict ON assignments;
+CREATE TRIGGER assignments_detect_conflict
+    AFTER INSERT ON assignments
+    FOR EACH ROW EXECUTE FUNCTION detect_assignment_conflict();
+
+-- reject_reservation_overlap() refuses a reservation whose stay overlaps
+-- another one on the same room, whichever path wrote it (add_reservation or
+-- raw execute_sql), or a room block (room_blocks) on any of its nights.
+-- Back-to-back stays (checkout = next checkin) are fine.
+-- Options (tentative holds) block the room only until hold_until; expired
+-- ones never do. It runs whenever a reservation starts blocking the room:
+-- new, moved, re-dated, set back to confirmed, or an option renewed; the
+-- ones that do not block (cancelled, expired, lapsed options) pass.
+-- Raised as exclusion_violation (23P01) so callers can tell it apart.
+CREATE OR REPLACE FUNCTION reject_reservation_overlap() RETURNS trigger AS $$
+DECLARE other record;
+BEGIN
+    IF NOT COALESCE(NEW.status = 'confirmed' OR (NEW.status = 'option' AND NEW.hold_until > now()), false) THEN
+        RETURN NEW;
+    END IF;
+    -- Serialize concurrent bookings of the same room.
+    PERFORM pg_advisory_xact_lock(NEW.room_id);
+    SELECT id, guest_name, checkin_at, checkout_at INTO other
+    FROM reservations
+    WHERE room_id = NEW.room_id AND id <> NEW.id
+      AND checkin_at < NEW.checkout_at AND checkout_at > NEW.checkin_at
+      AND (status = 'confirmed' OR (status = 'option' AND hold_until > now()))
+    LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION 'overbooking: room % already reserved by reservation % (%, % → %)',
+            NEW.room_id, other.id, COALESCE(other.guest_name, '?'),
+            to_char(other.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM'),
+            to_char(other.checkout_at AT TIME ZONE 'Europe/Rome', 'DD/MM')
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+    SELECT id, from_date, to_date, reason INTO other
+    FROM room_blocks
+    WHERE room_id = NEW.room_id AND lifted_at IS NULL
+      AND from_date < (NEW.checkout_at AT TIME ZONE 'Europe/Rome')::date
+      AND to_date >= (NEW.checkin_at AT TIME ZONE 'Europe/Rome')::date
+    LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION 'room % is out of service from % to % (%, block %)',
+            NEW.room_id, to_char(other.from_date, 'DD/MM'), to_char(other.to_date, 'DD/MM'), other.reason, other.id
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_reject_overlap ON reservations;
+CREATE TRIGGER reservations_reject_overlap
+    BEFORE INSERT OR UPDATE OF room_id, checkin_at, checkout_at, status, hold_until ON reservations
+    FOR EACH ROW EXECUTE FUNCTION reject_reservation_overlap();
+
+-- reject_parking_overlap() refuses a parking spot already given to another
+-- stay on any of the same nights (confirmed reservations and live options),
+-- from assign_parking or raw execute_sql alike. Raised as exclusion_violation
+-- (23P01), like the room overlap above.
+CREATE OR REPLACE FUNCTION reject_parking_overlap() RETURNS trigger AS $$
+DECLARE other record;
+BEGIN
+    IF NEW.parking_spot_id IS NULL OR NEW.status NOT IN ('confirmed', 'option') THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_advisory_xact_lock(hashtext('parking_spots'), NEW.parking_spot_id);
+    SELECT res.id, res.guest_name, r.name AS room, res.checkin_at, res.checkout_at INTO other
+    FROM reservations res JOIN rooms r ON r.id = res.room_id
+    WHERE res.parking_spot_id = NEW.parking_spot_id AND res.id <> NEW.id
+      AND res.checkin_at < NEW.checkout_at AND res.checkout_at > NEW.checkin_at
+      AND (res.status = 'confirmed' OR (res.status = 'option' AND res.hold_until > now()))
+    ORDER BY res.checkin_at
+    LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION 'parking spot % already taken by reservation % (%, room %, % → %)',
+            NEW.parking_spot_id, other.id, COALESCE(other.guest_name, '?'), other.room,
+            to_char(other.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM'),
+            to_char(other.checkout_at AT TIME ZONE 'Europe/Rome', 'DD/MM')
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_reject_parking_overlap ON reservations;
+CREATE TRIGGER reservations_reject_parking_overlap
+    BEFORE INSERT OR UPDATE OF parking_spot_id, checkin_at, checkout_at, status ON reservations
+    FOR EACH ROW EXECUTE FUNCTION reject_parking_overlap();
+
+-- reject_block_over_reservation() is the other side: a room cannot be taken
+-- out of service for nights a confirmed reservation or a live option holds.
+-- The guest has to be moved first. Raised as exclusion_violation (23P01).
+CREATE OR REPLACE FUNCTION reject_block_over_reservation() RETURNS trigger AS $$
+DECLARE other record;
+BEGIN
+    IF NEW.lifted_at IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_advisory_xact_lock(NEW.room_id);
+    SELECT id, guest_name, checkin_at, checkout_at INTO other
+    FROM reservations
+    WHERE room_id = NEW.room_id
+      AND (checkin_at AT TIME ZONE 'Europe/Rome')::date <= NEW.to_date
+      AND (checkout_at AT TIME ZONE 'Europe/Rome')::date > NEW.from_date
+      AND (status = 'confirmed' OR (status = 'option' AND hold_until > now()))
+    ORDER BY checkin_at
+    LIMIT 1;
+    IF FOUND THEN
+        RAISE EXCEPTION 'room % is reserved in that period by reservation % (%, % → %)',
+            NEW.room_id, other.id, COALESCE(other.guest_name, '?'),
+            to_char(other.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM'),
+            to_char(other.checkout_at AT TIME ZONE 'Europe/Rome', 'DD/MM')
+            USING ERRCODE = 'exclusion_violation';
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS room_blocks_reject_reservations ON room_blocks;
+CREATE TRIGGER room_blocks_reject_reservations
+    BEFORE INSERT OR UPDATE OF room_id, from_date, to_date, lifted_at ON room_blocks
+    FOR EACH ROW EXECUTE FUNCTION reject_block_over_reservation();
+
+-- reject_reservation_over_capacity() refuses a party larger than the room
+-- type's capacity, whichever path wrote it. Rooms without a type are not
+-- checked. Raised as check_violation (23514).
+CREATE OR REPLACE FUNCTION reject_reservation_over_capacity() RETURNS trigger AS $$
+DECLARE cap integer; room text;
+BEGIN
+    SELECT t.capacity, r.name INTO cap, room
+    FROM rooms r JOIN room_types t ON t.id = r.room_type_id
+    WHERE r.id = NEW.room_id;
+    IF cap IS NOT NULL AND NEW.guests > cap THEN
+        RAISE EXCEPTION 'room % holds at most % guests, the reservation has %', room, cap, NEW.guests
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_check_capacity ON reservations;
+CREATE TRIGGER reservations_check_capacity
+    BEFORE INSERT OR UPDATE OF room_id, guests ON reservations
+    FOR EACH ROW EXECUTE FUNCTION reject_reservation_over_capacity();
+
+-- refresh_guest_stats() keeps guests.stay_count (confirmed reservations,
+-- upcoming ones included) and last_stay in step with the reservations
+-- linked to a profile, however they are written.
+CREATE OR REPLACE FUNCTION refresh_guest_stats() RETURNS trigger AS $$
+DECLARE gid bigint;
+BEGIN
+    FOREACH gid IN ARRAY ARRAY[
+        CASE WHEN TG_OP <> 'INSERT' THEN OLD.guest_id END,
+        CASE WHEN TG_OP <> 'DELETE' THEN NEW.guest_id END]
+    LOOP
+        CONTINUE WHEN gid IS NULL;
+        UPDATE guests g SET
+            stay_count = s.n, last_stay = s.last
+        FROM (SELECT count(*) AS n, max((checkin_at AT TIME ZONE 'Europe/Rome')::date) AS last
+              FROM reservations WHERE guest_id = gid AND status = 'confirmed') s
+        WHERE g.id = gid;
+    END LOOP;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_guest_stats ON reservations;
+CREATE TRIGGER reservations_guest_stats
+    AFTER INSERT OR DELETE OR UPDATE OF guest_id, status, checkin_at ON reservations
+    FOR EACH ROW EXECUTE FUNCTION refresh_guest_stats();
+
+-- inherit_guest_vip() copies a VIP profile's flag and standing instructions
+-- onto the reservations linked to it, so staff who cannot read guests (RLS)
+-- still see them on the stay. SECURITY DEFINER for the same reason.
+CREATE OR REPLACE FUNCTION inherit_guest_vip() RETURNS trigger AS $$
+DECLARE g record;
+BEGIN
+    IF NEW.guest_id IS NULL OR (TG_OP = 'UPDATE' AND NEW.guest_id IS NOT DISTINCT FROM OLD.guest_id) THEN
+        RETURN NEW;
+    END IF;
+    SELECT vip, special_instructions INTO g FROM guests WHERE id = NEW.guest_id;
+    IF NOT FOUND THEN
+        RETURN NEW;
+    END IF;
+    IF g.vip THEN
+        NEW.vip := true;
+    END IF;
+    NEW.special_instructions := COALESCE(NULLIF(NEW.special_instructions, ''), g.special_instructions);
+    RETURN NEW;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_inherit_guest_vip ON reservations;
+CREATE TRIGGER reservations_inherit_guest_vip
+    BEFORE INSERT OR UPDATE OF guest_id ON reservations
+    FOR EACH ROW EXECUTE FUNCTION inherit_guest_vip();
+
+-- schedule_reservation_reminders() replaces the pending reminders of a
+-- reservation with the standard set: one per active reminder_templates row of
+-- its property and per user with the template's audience role, offset_minutes
+-- before the checkin or checkout. Only confirmed stays get them, and only
+-- reminders still in the future; {room}, {guest} and {time} are filled in.
+-- Cleaner reminders are narrowed to the room's assigned cleaner when they
+-- fire (reminder.go). SECURITY DEFINER: reminders are private to their owner.
+CREATE OR REPLACE FUNCTION schedule_reservation_reminders(res_id bigint) RETURNS void AS $$
+BEGIN
+    UPDATE reminders SET cancelled_at = now()
+    WHERE reservation_id = res_id AND fired_at IS NULL AND cancelled_at IS NULL;
+    INSERT INTO reminders (fire_at, chat_id, message, room_id, created_by, reservation_id, template_id)
+    SELECT e.at - make_interval(mins => t.offset_minutes), u.telegram_id,
+           replace(replace(replace(t.message, '{room}', r.name), '{guest}', COALESCE(res.guest_name, 'ospite')),
+                   '{time}', to_char(e.at AT TIME ZONE 'Europe/Rome', 'HH24:MI')),
+           res.room_id, u.telegram_id, res.id, t.id
+    FROM reservations res
+    JOIN rooms r ON r.id = res.room_id
+    JOIN reminder_templates t ON t.hotel_id = res.hotel_id AND t.active
+    CROSS JOIN LATERAL (SELECT CASE t.event WHEN 'checkin' THEN res.checkin_at ELSE res.checkout_at END AS at) e
+    JOIN users u ON u.hotel_id = res.hotel_id AND u.role = t.audience
+    WHERE res.id = res_id AND res.status = 'confirmed'
+      AND e.at - make_interval(mins => t.offset_minutes) > now();
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+CREATE OR REPLACE FUNCTION reservations_schedule_reminders() RETURNS trigger AS $$
+BEGIN
+    PERFORM schedule_reservation_reminders(NEW.id);
+    RETURN NULL;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS reservations_schedule_reminders ON reservations;
+CREATE TRIGGER reservations_schedule_reminders
+    AFTER INSERT OR UPDATE OF room_id, guest_name, checkin_at, checkout_at, status ON reservations
+    FOR EACH ROW EXECUTE FUNCTION reservations_schedule_reminders();
+
+-- apply_supply_movement() keeps supplies.quantity equal to the sum of its
+-- movements. SECURITY DEFINER: cleaners log usage but cannot update supplies;
+-- a usage larger than the stock fails on supplies_quantity_check.
+CREATE OR REPLACE FUNCTION apply_supply_movement() RETURNS trigger AS $$
+BEGIN
+    UPDATE supplies SET quantity = quantity + NEW.delta, updated_at = now()
+    WHERE id = NEW.supply_id;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS supply_movements_apply ON supply_movements;
+CREATE TRIGGER supply_movements_apply
+    AFTER INSERT ON supply_movements
+    FOR EACH ROW EXECUTE FUNCTION apply_supply_movement();
+
+-- compliance_interval() is the period of a compliance_templates.frequency.
+CREATE OR REPLACE FUNCTION compliance_interval(frequency text) RETURNS interval AS $$
+    SELECT CASE frequency
+        WHEN 'daily' THEN interval '1 day'
+        WHEN 'weekly' THEN interval '7 days'
+        WHEN 'monthly' THEN interval '1 month'
+        WHEN 'quarterly' THEN interval '3 months'
+        WHEN 'semiannual' THEN interval '6 months'
+        ELSE interval '1 year' END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- open_next_compliance_task() opens the next occurrence of a check when one is
+-- completed: one period after the one just done, or today if that is already
+-- past. SECURITY DEFINER: anyone may complete a check, only managers insert.
+CREATE OR REPLACE FUNCTION open_next_compliance_task() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO compliance_tasks (hotel_id, template_id, due_date)
+    SELECT t.hotel_id, t.id,
+           GREATEST(NEW.due_date + compliance_interval(t.frequency), (now() AT TIME ZONE 'Europe/Rome')::date)::date
+    FROM compliance_templates t
+    WHERE t.id = NEW.template_id AND t.active
+    ON CONFLICT DO NOTHING;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DROP TRIGGER IF EXISTS compliance_tasks_next ON compliance_tasks;
+CREATE TRIGGER compliance_tasks_next
+    AFTER UPDATE OF status ON compliance_tasks
+    FOR EACH ROW WHEN (OLD.status = 'open' AND NEW.status = 'done')
+    EXECUTE FUNCTION open_next_compliance_task();
+
+-- notify_subscribers() tells the users following a room or a reservation
+-- (subscriptions) about a change to it or to what hangs off it: its
+-- assignments, tickets, incidents, blocks, guest requests, extras, payments.
+-- Each subscriber but the one who made the change gets an agent_events row
+-- (kind entity_change) with what changed; NOTIFY entity_change wakes the Go
+-- dispatcher (subscriptions.go), which puts them on the agent's event bus.
+-- Changes by the bot itself (admin pool) have no actor and reach everyone.
+CREATE OR REPLACE FUNCTION notify_subscribers() RETURNS trigger AS $$
+DECLARE
+    rec      jsonb := to_jsonb(COALESCE(NEW, OLD));
+    old_rec  jsonb := CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END;
+    room_ids integer[];
+    res_ids  bigint[];
+    actor    bigint := current_telegram_id();
+    who      text;
+    changes  text;
+    n        integer;
+BEGIN
+    -- The rooms and reservations the row is about, before and after a move.
+    IF TG_TABLE_NAME = 'rooms' THEN
+        room_ids := ARRAY[(rec->>'id')::integer];
+    ELSIF TG_TABLE_NAME = 'reservations' THEN
+        res_ids  := ARRAY[(rec->>'id')::bigint];
+        room_ids := ARRAY[(rec->>'room_id')::integer, (old_rec->>'room_id')::integer];
+    ELSIF TG_TABLE_NAME IN ('guest_requests', 'reservation_extras', 'payments') THEN
+        res_ids  := ARRAY[(rec->>'reservation_id')::bigint];
+        room_ids := ARRAY(SELECT room_id FROM reservations WHERE id = (rec->>'reservation_id')::bigint);
+    ELSE
+        room_ids := ARRAY[(rec->>'room_id')::integer, (old_rec->>'room_id')::integer];
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM subscriptions s
+                   WHERE (s.room_id = ANY (room_ids) OR s.reservation_id = ANY (res_ids))
+                     AND s.user_id IS DISTINCT FROM actor) THEN
+        RETURN NULL;
+    END IF;
+
+    -- What changed: the columns an UPDATE touched, the row otherwise.
+    IF TG_OP = 'UPDATE' THEN
+        SELECT string_agg(format('%s: %s → %s', n.key,
+                                 COALESCE(left(o.value #>> '{}', 80), '—'),
+                                 COALESCE(left(n.value #>> '{}', 80), '—')), ', ' ORDER BY n.key)
+        INTO changes
+        FROM jsonb_each(rec) n JOIN jsonb_each(old_rec) o ON o.key = n.key
+        WHERE n.value IS DISTINCT FROM o.value
+          AND n.key NOT IN ('updated_at', 'hotel_id', 'accept_requested_at', 'accept_flagged_at');
+        IF changes IS NULL THEN
+            RETURN NULL;
+        END IF;
+    ELSE
+        changes := left((rec - 'hotel_id')::text, 400);
+    END IF;
+    SELECT name INTO who FROM users WHERE telegram_id = actor;
+
+    INSERT INTO agent_events (event_id, target_user_id, chat_id, kind, content, source)
+    SELECT gen_random_uuid(), f.user_id, f.user_id, 'entity_change',
+           format('%s — %s #%s %s da %s: %s', f.label, TG_TABLE_NAME, rec->>'id',
+                  CASE TG_OP WHEN 'INSERT' THEN 'creato' WHEN 'DELETE' THEN 'eliminato' ELSE 'modificato' END,
+                  COALESCE(who, 'il bot'), changes),
+           COALESCE(who, 'system')
+    FROM (SELECT DISTINCT ON (s.user_id) s.user_id,
+                 CASE WHEN s.reservation_id IS NOT NULL THEN 'prenotazione #' || s.reservation_id
+                      ELSE 'camera ' || r.name END AS label
+          FROM subscriptions s LEFT JOIN rooms r ON r.id = s.room_id
+          WHERE (s.room_id = ANY (room_ids) OR s.reservation_id = ANY (res_ids))
+            AND s.user_id IS DISTINCT FROM actor
+          ORDER BY s.user_id, s.reservation_id NULLS LAST) f;
+    GET DIAGNOSTICS n = ROW_COUNT;
+    IF n > 0 THEN
+        PERFORM pg_notify('entity_change', '');
+    END IF;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql SECURITY DEFINER;
+
+DO $$
+DECLARE t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['rooms', 'reservations', 'assignments', 'maintenance_tickets', 'incidents',
+                             'room_blocks', 'guest_requests', 'reservation_extras', 'payments']
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS %I ON %I', t || '_notify_subscribers', t);
+        EXECUTE format('CREATE TRIGGER %I AFTER INSERT OR UPDATE OR DELETE ON %I
+                        FOR EACH ROW EXECUTE FUNCTION notify_subscribers()', t || '_notify_subscribers', t);
+    END LOOP;
+END $$;
+
 -- ── Re-grant table access to all existing tg_* roles ─────────────────────────
 -- Repairs any missing grants idempotently. Run on every startup/deploy.
 -- Grants issued during Register() may be missing if tables didn't exist yet.
@@ -44,10 +926,90 @@ BEGIN
         EXECUTE format('GRANT SELECT ON invites TO %I', r);
         EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON reservations TO %I', r);
         EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON reminders TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON content_templates TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON saved_queries TO %I', r);
+        EXECUTE format('GRANT SELECT ON room_status_events TO %I', r);
+        EXECUTE format('GRANT SELECT ON intent_metrics TO %I', r);
+        EXECUTE format('GRANT SELECT ON assignment_conflicts TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE ON maintenance_tickets TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON booking_channels TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE ON lost_found TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON extras TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON reservation_extras TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON rates TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON rate_rules TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON knowledge_base TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON channel_feeds TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON guests TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON prompt_translations TO %I', r);
+        EXECUTE format('GRANT SELECT,UPDATE ON hotels TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON room_types TO %I', r);
+        EXECUTE format('GRANT SELECT,DELETE ON shadow_runs TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT ON invoices TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON payments TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON staff_absences TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON checklists TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON checklist_items TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT ON room_inspections TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON reviews TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON cleaning_standards TO %I', r);
+        EXECUTE format('GRANT SELECT,UPDATE ON attachments TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON supplies TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT ON supply_movements TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON minibar_items TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON minibar_consumption TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON compliance_templates TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON reminder_templates TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON compliance_tasks TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT ON temperature_logs TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON meter_readings TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON tips TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON guest_requests TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE ON incidents TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON shifts TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON shift_assignments TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON work_sessions TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON keys TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON parking_spots TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON hotel_info TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON room_blocks TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON dnd_log TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON recurring_tasks TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON hotel_settings TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,DELETE ON subscriptions TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON booking_groups TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE,DELETE ON guest_message_templates TO %I', r);
+        EXECUTE format('GRANT SELECT,INSERT,UPDATE ON guest_messages TO %I', r);
         EXECUTE format('GRANT USAGE,SELECT ON ALL SEQUENCES IN SCHEMA public TO %I', r);
     END LOOP;
 END $$;
 
+-- ── Guests ───────────────────────────────────────────────────────────────────
+-- Guests log in as guest_<telegram_id>, members of m4d_guest, and are left out
+-- of the tg_* grants above: RLS is per property, so any table grant would show
+-- them the other guests. All they can read is their own stay through
+-- guest_stays, which runs with its owner's rights and filters on current_user;
+-- their requests and reports are written by the bot (guestaccess.go).
+DO $$ BEGIN
+    CREATE ROLE m4d_guest NOLOGIN;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+GRANT CONNECT ON DATABASE m4dtimes TO m4d_guest;
+GRANT USAGE ON SCHEMA public TO m4d_guest;
+
+CREATE OR REPLACE VIEW guest_stays AS
+    SELECT res.id AS reservation_id, res.hotel_id, h.name AS hotel, rm.id AS room_id, rm.name AS room,
+           res.guest_name, res.checkin_at, res.checkout_at, res.guests, res.children, res.board,
+           res.status, u.telegram_id
+    FROM invites i
+    JOIN users u          ON u.telegram_id = i.used_by
+    JOIN reservations res ON res.id = i.reservation_id
+    JOIN rooms rm         ON rm.id = res.room_id
+    JOIN hotels h         ON h.id = res.hotel_id
+    WHERE i.role = 'guest' AND u.pg_user = current_user;
+REVOKE ALL ON guest_stays FROM PUBLIC;
+GRANT SELECT ON guest_stays TO m4d_guest;
+
 -- ── RLS: prompts ─────────────────────────────────────────────────────────────
 -- Prompts are system config — managers can CRUD, cleaners cannot touch them.
 -- The bot reads them via adminPool (superuser, bypasses RLS).
@@ -57,6 +1019,117 @@ DROP POLICY IF EXISTS prompts_all    ON prompts;
 CREATE POLICY prompts_select ON prompts FOR SELECT USING (is_manager());
 CREATE POLICY prompts_all    ON prompts FOR ALL    USING (is_manager()) WITH CHECK (is_manager());
 
+-- Translations are generated by the bot; managers may correct them.
+ALTER TABLE prompt_translations ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS prompt_translations_all ON prompt_translations;
+CREATE POLICY prompt_translations_all ON prompt_translations FOR ALL
+    USING (is_manager()) WITH CHECK (is_manager());
+
+-- Shadow runs are written by the bot; managers review (and prune) them.
+ALTER TABLE shadow_runs ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS shadow_runs_select ON shadow_runs;
+DROP POLICY IF EXISTS shadow_runs_delete ON shadow_runs;
+CREATE POLICY shadow_runs_select ON shadow_runs FOR SELECT USING (is_manager());
+CREATE POLICY shadow_runs_delete ON shadow_runs FOR DELETE USING (is_manager());
+
+-- ── RLS: content_templates / saved_queries ────────────────────────────────────
+-- Background-event templates and the queries behind their {{placeholders}},
+-- and the managers' reports (reports.go), one set per property. Its managers
+-- only; the bot reads them via adminPool for the property it renders and runs
+-- saved queries read-only through the target user's pool, so RLS still
+-- applies to results.
+ALTER TABLE content_templates ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS content_templates_all ON content_templates;
+CREATE POLICY content_templates_all ON content_templates FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+ALTER TABLE saved_queries ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS saved_queries_all ON saved_queries;
+CREATE POLICY saved_queries_all ON saved_queries FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: countdown_notifications ──────────────────────────────────────────────
+-- Internal bookkeeping for countdown.go; no grants, admin pool only.
+ALTER TABLE countdown_notifications ENABLE ROW LEVEL SECURITY;
+
+-- ── RLS: planning_sessions ────────────────────────────────────────────────────
+-- Internal /plan state (planning.go); no grants, admin pool only.
+ALTER TABLE planning_sessions ENABLE ROW LEVEL SECURITY;
+
+-- ── RLS: guest_documents ──────────────────────────────────────────────────────
+-- Internal (identity documents): no policies, no grants; bot admin pool only.
+-- guestdocs.go filters by the manager's hotel_id itself.
+ALTER TABLE guest_documents ENABLE ROW LEVEL SECURITY;
+
+-- Documents registered before guest_documents had a hotel_id took the
+-- default; give them their reservation's property.
+UPDATE guest_documents gd SET hotel_id = res.hotel_id
+FROM reservations res
+WHERE res.id = gd.reservation_id AND gd.hotel_id <> res.hotel_id;
+
+-- ── RLS: message_translations ─────────────────────────────────────────────────
+-- Internal cache of messageLocalizer: no policies, no grants; bot admin pool only.
+ALTER TABLE message_translations ENABLE ROW LEVEL SECURITY;
+
+-- ── RLS: missed_messages ──────────────────────────────────────────────────────
+-- Internal (failed deliveries, flushed as a digest): no policies, no grants; bot admin pool only.
+ALTER TABLE missed_messages ENABLE ROW LEVEL SECURITY;
+
+-- ── RLS: agent_events ────────────────────────────────────────────────────────
+-- Internal (the event bus; notify_subscribers writes as SECURITY DEFINER):
+-- no policies, no grants; bot admin pool only.
+ALTER TABLE agent_events ENABLE ROW LEVEL SECURITY;
+
+-- ── RLS: subscriptions ───────────────────────────────────────────────────────
+-- Everyone follows rooms and reservations for themselves; managers see all.
+ALTER TABLE subscriptions ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS subscriptions_select ON subscriptions;
+DROP POLICY IF EXISTS subscriptions_insert ON subscriptions;
+DROP POLICY IF EXISTS subscriptions_delete ON subscriptions;
+CREATE POLICY subscriptions_select ON subscriptions FOR SELECT
+    USING (is_manager() OR user_id = current_telegram_id());
+CREATE POLICY subscriptions_insert ON subscriptions FOR INSERT
+    WITH CHECK (user_id = current_telegram_id());
+CREATE POLICY subscriptions_delete ON subscriptions FOR DELETE
+    USING (user_id = current_telegram_id());
+
+-- ── RLS: room_status_events ───────────────────────────────────────────────────
+-- SELECT: everyone at the property (status history is operational context)
+-- Writes: trigger only (SECURITY DEFINER); no write grants.
+ALTER TABLE room_status_events ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS room_status_events_select ON room_status_events;
+CREATE POLICY room_status_events_select ON room_status_events FOR SELECT USING (hotel_id = current_hotel_id());
+
+-- ── RLS: intent_metrics ───────────────────────────────────────────────────────
+-- SELECT: managers of the property. Rows are written by the bot via adminPool,
+-- stamped with the sender's hotel_id; rows recorded before the column existed
+-- carry no user to trace and stay on the default property.
+ALTER TABLE intent_metrics ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS intent_metrics_select ON intent_metrics;
+CREATE POLICY intent_metrics_select ON intent_metrics FOR SELECT USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: assignment_conflicts ─────────────────────────────────────────────────
+-- SELECT: managers of the property. Written by trigger, resolved by the bot
+-- via adminPool for a manager of the same property.
+ALTER TABLE assignment_conflicts ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS assignment_conflicts_select ON assignment_conflicts;
+CREATE POLICY assignment_conflicts_select ON assignment_conflicts FOR SELECT USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- Conflicts recorded before assignment_conflicts had a hotel_id took the
+-- default; give them their assignments' property.
+UPDATE assignment_conflicts ac SET hotel_id = a.hotel_id
+FROM assignments a
+WHERE a.id = COALESCE(ac.new_assignment_id, ac.existing_assignment_id) AND ac.hotel_id <> a.hotel_id;
+
+-- ── RLS: relay_messages ─────────────────────────────────────────────────────
+-- No user access: ask_hotel / reply_to_hotel check the manager and use the
+-- admin pool, like the /relay endpoint that writes inbound questions.
+ALTER TABLE relay_messages ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS relay_messages_deny ON relay_messages;
+CREATE POLICY relay_messages_deny ON relay_messages USING (false);
+
 -- ── RLS: user_credentials ─────────────────────────────────────────────────────
 -- Defense-in-depth: no non-superuser can ever read credentials.
 -- The admin pool (postgres/superuser) bypasses RLS automatically.
@@ -64,20 +1137,33 @@ ALTER TABLE user_credentials ENABLE ROW LEVEL SECURITY;
 DROP POLICY IF EXISTS credentials_deny ON user_credentials;
 CREATE POLICY credentials_deny ON user_credentials USING (false);
 
+-- Rooms, assignments, users and reservations are scoped to the user's
+-- property: every policy below also requires hotel_id = current_hotel_id().
+
 -- ── RLS: rooms ────────────────────────────────────────────────────────────────
--- SELECT: everyone (cleaners need to know which rooms exist)
+-- SELECT: everyone at the property (cleaners need to know which rooms exist)
 -- INSERT/UPDATE/DELETE: managers only
 ALTER TABLE rooms ENABLE ROW LEVEL SECURITY;
 DROP POLICY IF EXISTS rooms_select ON rooms;
 DROP POLICY IF EXISTS rooms_insert ON rooms;
 DROP POLICY IF EXISTS rooms_update ON rooms;
 DROP POLICY IF EXISTS rooms_delete ON rooms;
-CREATE POLICY rooms_select ON rooms FOR SELECT USING (true);
-CREATE POLICY rooms_insert ON rooms FOR INSERT WITH CHECK (is_manager());
+CREATE POLICY rooms_select ON rooms FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY rooms_insert ON rooms FOR INSERT WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 CREATE POLICY rooms_update ON rooms FOR UPDATE
-    USING      (is_manager())
-    WITH CHECK (is_manager());
-CREATE POLICY rooms_delete ON rooms FOR DELETE USING (is_manager());
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY rooms_delete ON rooms FOR DELETE USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: room_types ───────────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: managers only
+ALTER TABLE room_types ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS room_types_select ON room_types;
+DROP POLICY IF EXISTS room_types_write ON room_types;
+CREATE POLICY room_types_select ON room_types FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY room_types_write ON room_types FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 
 -- ── RLS: assignments ──────────────────────────────────────────────────────────
 -- SELECT: everyone (cleaners need to see all assignments)
@@ -89,14 +1175,14 @@ DROP POLICY IF EXISTS assignments_select ON assignments;
 DROP POLICY IF EXISTS assignments_insert ON assignments;
 DROP POLICY IF EXISTS assignments_update ON assignments;
 DROP POLICY IF EXISTS assignments_delete ON assignments;
-CREATE POLICY assignments_select ON assignments FOR SELECT USING (true);
+CREATE POLICY assignments_select ON assignments FOR SELECT USING (hotel_id = current_hotel_id());
 CREATE POLICY assignments_insert ON assignments FOR INSERT
-    WITH CHECK (is_manager() OR cleaner_id = current_telegram_id());
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
 CREATE POLICY assignments_update ON assignments FOR UPDATE
-    USING      (is_manager() OR cleaner_id = current_telegram_id())
-    WITH CHECK (is_manager() OR cleaner_id = current_telegram_id());
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
 CREATE POLICY assignments_delete ON assignments FOR DELETE
-    USING (is_manager() OR (cleaner_id = current_telegram_id() AND status = 'pending'));
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR (cleaner_id = current_telegram_id() AND status = 'pending')));
 
 -- ── RLS: users ────────────────────────────────────────────────────────────────
 -- SELECT: everyone
@@ -109,23 +1195,34 @@ DROP POLICY IF EXISTS users_write  ON users;  -- legacy (FOR ALL)
 DROP POLICY IF EXISTS users_insert ON users;
 DROP POLICY IF EXISTS users_update ON users;
 DROP POLICY IF EXISTS users_delete ON users;
-CREATE POLICY users_select ON users FOR SELECT USING (true);
-CREATE POLICY users_insert ON users FOR INSERT WITH CHECK (is_manager());
+CREATE POLICY users_select ON users FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY users_insert ON users FOR INSERT WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 CREATE POLICY users_update ON users FOR UPDATE
-    USING      (is_manager() OR telegram_id = current_telegram_id())
-    WITH CHECK (is_manager() OR telegram_id = current_telegram_id());
-CREATE POLICY users_delete ON users FOR DELETE USING (is_manager());
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR telegram_id = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR telegram_id = current_telegram_id()));
+CREATE POLICY users_delete ON users FOR DELETE USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: hotels ───────────────────────────────────────────────────────────────
+-- SELECT: own property only; properties are added by the operator (superuser).
+-- UPDATE: managers of the property (name, timezone, setup wizard; configure_hotel)
+ALTER TABLE hotels ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hotels_select ON hotels;
+DROP POLICY IF EXISTS hotels_update ON hotels;
+CREATE POLICY hotels_select ON hotels FOR SELECT USING (id = current_hotel_id());
+CREATE POLICY hotels_update ON hotels FOR UPDATE
+    USING      (id = current_hotel_id() AND is_manager())
+    WITH CHECK (id = current_hotel_id() AND is_manager());
 
 -- ── RLS: invites ──────────────────────────────────────────────────────────────
--- SELECT: managers see all; cleaners see only invites they redeemed
+-- SELECT: managers see all of their property; cleaners see only invites they redeemed
 -- INSERT: managers only
 ALTER TABLE invites ENABLE ROW LEVEL SECURITY;
 DROP POLICY IF EXISTS invites_select ON invites;
 DROP POLICY IF EXISTS invites_insert ON invites;
 CREATE POLICY invites_select ON invites FOR SELECT
-    USING (is_manager() OR used_by = current_telegram_id());
+    USING ((hotel_id = current_hotel_id() AND is_manager()) OR used_by = current_telegram_id());
 CREATE POLICY invites_insert ON invites FOR INSERT
-    WITH CHECK (is_manager());
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 
 -- ── RLS: reservations ─────────────────────────────────────────────────────────
 -- SELECT: everyone (cleaners need context)
@@ -135,11 +1232,499 @@ DROP POLICY IF EXISTS reservations_select ON reservations;
 DROP POLICY IF EXISTS reservations_insert ON reservations;
 DROP POLICY IF EXISTS reservations_update ON reservations;
 DROP POLICY IF EXISTS reservations_delete ON reservations;
-CREATE POLICY reservations_select ON reservations FOR SELECT USING (true);
-CREATE POLICY reservations_insert ON reservations FOR INSERT WITH CHECK (is_manager());
+CREATE POLICY reservations_select ON reservations FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY reservations_insert ON reservations FOR INSERT WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 CREATE POLICY reservations_update ON reservations FOR UPDATE
-    USING (is_manager()) WITH CHECK (is_manager());
-CREATE POLICY reservations_delete ON reservations FOR DELETE USING (is_manager());
+    USING (hotel_id = current_hotel_id() AND is_manager()) WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY reservations_delete ON reservations FOR DELETE USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: booking_channels ─────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: its managers (commission rates)
+ALTER TABLE booking_channels ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS booking_channels_select ON booking_channels;
+DROP POLICY IF EXISTS booking_channels_write ON booking_channels;
+CREATE POLICY booking_channels_select ON booking_channels FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY booking_channels_write ON booking_channels FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: guests ───────────────────────────────────────────────────────────────
+-- Managers of the property only: contact details and guest history are
+-- personal data.
+ALTER TABLE guests ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS guests_manager ON guests;
+CREATE POLICY guests_manager ON guests FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: booking_groups ───────────────────────────────────────────────────────
+-- Managers of the property only, like guests: the group's contact and total
+-- price. Staff see the rooms through reservations as usual.
+ALTER TABLE booking_groups ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS booking_groups_manager ON booking_groups;
+CREATE POLICY booking_groups_manager ON booking_groups FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: channel_feeds ────────────────────────────────────────────────────────
+-- Managers of the property only: feed URLs embed the OTA's secret token.
+ALTER TABLE channel_feeds ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS channel_feeds_manager ON channel_feeds;
+CREATE POLICY channel_feeds_manager ON channel_feeds FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: knowledge_base ───────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: its managers
+ALTER TABLE knowledge_base ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS knowledge_base_select ON knowledge_base;
+DROP POLICY IF EXISTS knowledge_base_write ON knowledge_base;
+CREATE POLICY knowledge_base_select ON knowledge_base FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY knowledge_base_write ON knowledge_base FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: rates ────────────────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: its managers
+ALTER TABLE rates ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS rates_select ON rates;
+DROP POLICY IF EXISTS rates_write ON rates;
+CREATE POLICY rates_select ON rates FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY rates_write ON rates FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: rate_rules ───────────────────────────────────────────────────────────
+-- SELECT: everyone at the property (quotes apply them); INSERT/UPDATE/DELETE: managers
+ALTER TABLE rate_rules ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS rate_rules_select ON rate_rules;
+DROP POLICY IF EXISTS rate_rules_write ON rate_rules;
+CREATE POLICY rate_rules_select ON rate_rules FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY rate_rules_write ON rate_rules FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: extras / reservation_extras ──────────────────────────────────────────
+-- SELECT: everyone at the property (cleaners prepare cots, bikes…); writes: its managers
+ALTER TABLE extras ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS extras_select ON extras;
+DROP POLICY IF EXISTS extras_write ON extras;
+CREATE POLICY extras_select ON extras FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY extras_write ON extras FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+ALTER TABLE reservation_extras ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS reservation_extras_select ON reservation_extras;
+DROP POLICY IF EXISTS reservation_extras_write ON reservation_extras;
+CREATE POLICY reservation_extras_select ON reservation_extras FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY reservation_extras_write ON reservation_extras FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: invoices ────────────────────────────────────────────────────────────
+-- Managers of the property read and issue them; no UPDATE/DELETE grant, so an
+-- issued invoice (and its number) stays as it was sent.
+ALTER TABLE invoices ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS invoices_select ON invoices;
+DROP POLICY IF EXISTS invoices_insert ON invoices;
+CREATE POLICY invoices_select ON invoices FOR SELECT USING (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY invoices_insert ON invoices FOR INSERT WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: payments ────────────────────────────────────────────────────────────
+-- Money matters: managers of the property only, full CRUD to fix mistakes
+ALTER TABLE payments ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS payments_all ON payments;
+CREATE POLICY payments_all ON payments FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: staff_absences ──────────────────────────────────────────────────────
+-- SELECT: everyone at the property (plans are made around absences)
+-- INSERT: staff report their own sickness, or request their own leave; managers anyone's
+-- UPDATE/DELETE: managers only (approving a request included)
+ALTER TABLE staff_absences ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS staff_absences_select ON staff_absences;
+DROP POLICY IF EXISTS staff_absences_insert ON staff_absences;
+DROP POLICY IF EXISTS staff_absences_update ON staff_absences;
+DROP POLICY IF EXISTS staff_absences_delete ON staff_absences;
+CREATE POLICY staff_absences_select ON staff_absences FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY staff_absences_insert ON staff_absences FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR
+                (user_id = current_telegram_id() AND (reason = 'sick' OR status = 'requested'))));
+CREATE POLICY staff_absences_update ON staff_absences FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY staff_absences_delete ON staff_absences FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: attachments ────────────────────────────────────────────────────────
+-- Rows are written by the bot when a photo or file arrives (attachments.go).
+-- SELECT: everyone at the property; UPDATE (link to an assignment or ticket):
+-- the uploader or a manager
+ALTER TABLE attachments ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS attachments_select ON attachments;
+DROP POLICY IF EXISTS attachments_update ON attachments;
+CREATE POLICY attachments_select ON attachments FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY attachments_update ON attachments FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR uploaded_by = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR uploaded_by = current_telegram_id()));
+
+-- ── RLS: supplies / supply_movements ────────────────────────────────────────
+-- SELECT: everyone at the property
+-- supplies INSERT/UPDATE/DELETE: managers only (quantity moves via movements)
+-- supply_movements INSERT: as oneself; cleaners only log usage, managers also
+-- restocks and counts. No UPDATE/DELETE: a correction is a new movement
+ALTER TABLE supplies ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS supplies_select ON supplies;
+DROP POLICY IF EXISTS supplies_write ON supplies;
+CREATE POLICY supplies_select ON supplies FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY supplies_write ON supplies FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE supply_movements ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS supply_movements_select ON supply_movements;
+DROP POLICY IF EXISTS supply_movements_insert ON supply_movements;
+CREATE POLICY supply_movements_select ON supply_movements FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY supply_movements_insert ON supply_movements FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND user_id = current_telegram_id()
+                AND (is_manager() OR (kind = 'usage' AND delta < 0)));
+
+-- ── RLS: minibar_items / minibar_consumption ────────────────────────────────
+-- SELECT: everyone at the property
+-- items INSERT/UPDATE/DELETE: managers only (the price list)
+-- consumption INSERT: as oneself (cleaners log it during room checks);
+-- UPDATE/DELETE: managers only (corrections before invoicing)
+ALTER TABLE minibar_items ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS minibar_items_select ON minibar_items;
+DROP POLICY IF EXISTS minibar_items_write ON minibar_items;
+CREATE POLICY minibar_items_select ON minibar_items FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY minibar_items_write ON minibar_items FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE minibar_consumption ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS minibar_consumption_select ON minibar_consumption;
+DROP POLICY IF EXISTS minibar_consumption_insert ON minibar_consumption;
+DROP POLICY IF EXISTS minibar_consumption_update ON minibar_consumption;
+DROP POLICY IF EXISTS minibar_consumption_delete ON minibar_consumption;
+CREATE POLICY minibar_consumption_select ON minibar_consumption FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY minibar_consumption_insert ON minibar_consumption FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND logged_by = current_telegram_id());
+CREATE POLICY minibar_consumption_update ON minibar_consumption FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY minibar_consumption_delete ON minibar_consumption FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: guest_message_templates / guest_messages ─────────────────────────────
+-- Managers of the property only: what goes out to guests, and to which
+-- address. Automatic sends are written by the bot (guestmessages.go).
+ALTER TABLE guest_message_templates ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS guest_message_templates_manager ON guest_message_templates;
+CREATE POLICY guest_message_templates_manager ON guest_message_templates FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE guest_messages ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS guest_messages_manager ON guest_messages;
+CREATE POLICY guest_messages_manager ON guest_messages FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: reminder_templates ─────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: managers only
+ALTER TABLE reminder_templates ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS reminder_templates_select ON reminder_templates;
+DROP POLICY IF EXISTS reminder_templates_write ON reminder_templates;
+CREATE POLICY reminder_templates_select ON reminder_templates FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY reminder_templates_write ON reminder_templates FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: compliance_templates / compliance_tasks ────────────────────────────
+-- SELECT: everyone at the property
+-- templates INSERT/UPDATE/DELETE, tasks INSERT/DELETE: managers only
+-- tasks UPDATE: anyone closes an open check as themselves; managers any row
+ALTER TABLE compliance_templates ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS compliance_templates_select ON compliance_templates;
+DROP POLICY IF EXISTS compliance_templates_write ON compliance_templates;
+CREATE POLICY compliance_templates_select ON compliance_templates FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY compliance_templates_write ON compliance_templates FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE compliance_tasks ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS compliance_tasks_select ON compliance_tasks;
+DROP POLICY IF EXISTS compliance_tasks_insert ON compliance_tasks;
+DROP POLICY IF EXISTS compliance_tasks_update ON compliance_tasks;
+DROP POLICY IF EXISTS compliance_tasks_delete ON compliance_tasks;
+CREATE POLICY compliance_tasks_select ON compliance_tasks FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY compliance_tasks_insert ON compliance_tasks FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY compliance_tasks_update ON compliance_tasks FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR status = 'open'))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR completed_by = current_telegram_id()));
+CREATE POLICY compliance_tasks_delete ON compliance_tasks FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: meter_readings ──────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: anyone, as logged_by
+-- UPDATE/DELETE: managers, or whoever logged the reading
+ALTER TABLE meter_readings ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS meter_readings_select ON meter_readings;
+DROP POLICY IF EXISTS meter_readings_insert ON meter_readings;
+DROP POLICY IF EXISTS meter_readings_update ON meter_readings;
+DROP POLICY IF EXISTS meter_readings_delete ON meter_readings;
+CREATE POLICY meter_readings_select ON meter_readings FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY meter_readings_insert ON meter_readings FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND logged_by = current_telegram_id());
+CREATE POLICY meter_readings_update ON meter_readings FOR UPDATE
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR logged_by = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR logged_by = current_telegram_id()));
+CREATE POLICY meter_readings_delete ON meter_readings FOR DELETE
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR logged_by = current_telegram_id()));
+
+-- ── RLS: tips ─────────────────────────────────────────────────────────────────
+-- Private: a cleaner sees and logs only their own tips, managers at the property see all
+-- INSERT: as oneself (managers may log for a cleaner); UPDATE/DELETE: managers, or the cleaner
+ALTER TABLE tips ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tips_select ON tips;
+DROP POLICY IF EXISTS tips_insert ON tips;
+DROP POLICY IF EXISTS tips_update ON tips;
+DROP POLICY IF EXISTS tips_delete ON tips;
+CREATE POLICY tips_select ON tips FOR SELECT
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
+CREATE POLICY tips_insert ON tips FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
+CREATE POLICY tips_update ON tips FOR UPDATE
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
+CREATE POLICY tips_delete ON tips FOR DELETE
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR cleaner_id = current_telegram_id()));
+
+-- ── RLS: temperature_logs ───────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: as oneself
+-- No UPDATE/DELETE: it is the HACCP register, a wrong reading is followed by a new one
+ALTER TABLE temperature_logs ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS temperature_logs_select ON temperature_logs;
+DROP POLICY IF EXISTS temperature_logs_insert ON temperature_logs;
+CREATE POLICY temperature_logs_select ON temperature_logs FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY temperature_logs_insert ON temperature_logs FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND logged_by = current_telegram_id());
+
+-- ── RLS: guest_requests ─────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: everyone, as created_by (guests ask cleaners too)
+-- UPDATE: manager, or anyone completing an open request as completed_by; DELETE: manager
+ALTER TABLE guest_requests ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS guest_requests_select ON guest_requests;
+DROP POLICY IF EXISTS guest_requests_insert ON guest_requests;
+DROP POLICY IF EXISTS guest_requests_update ON guest_requests;
+DROP POLICY IF EXISTS guest_requests_delete ON guest_requests;
+CREATE POLICY guest_requests_select ON guest_requests FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY guest_requests_insert ON guest_requests FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND created_by = current_telegram_id());
+CREATE POLICY guest_requests_update ON guest_requests FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR status = 'open'))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR completed_by = current_telegram_id()));
+CREATE POLICY guest_requests_delete ON guest_requests FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: incidents ──────────────────────────────────────────────────────────
+-- SELECT: managers, and whoever reported it (they name colleagues: not for everyone)
+-- INSERT: anyone, as reported_by, open; UPDATE: managers only (resolution)
+ALTER TABLE incidents ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS incidents_select ON incidents;
+DROP POLICY IF EXISTS incidents_insert ON incidents;
+DROP POLICY IF EXISTS incidents_update ON incidents;
+CREATE POLICY incidents_select ON incidents FOR SELECT
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR reported_by = current_telegram_id()));
+CREATE POLICY incidents_insert ON incidents FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND reported_by = current_telegram_id()
+                AND status = 'open' AND resolved_at IS NULL);
+CREATE POLICY incidents_update ON incidents FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: shifts / shift_assignments ─────────────────────────────────────────
+-- SELECT: everyone at the property (colleagues look for someone to swap with)
+-- INSERT/UPDATE/DELETE: managers only; swap_shift moves rows through the bot
+ALTER TABLE shifts ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS shifts_select ON shifts;
+DROP POLICY IF EXISTS shifts_write ON shifts;
+CREATE POLICY shifts_select ON shifts FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY shifts_write ON shifts FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE shift_assignments ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS shift_assignments_select ON shift_assignments;
+DROP POLICY IF EXISTS shift_assignments_write ON shift_assignments;
+CREATE POLICY shift_assignments_select ON shift_assignments FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY shift_assignments_write ON shift_assignments FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: work_sessions ──────────────────────────────────────────────────────
+-- SELECT: managers, and everyone their own sessions
+-- INSERT/UPDATE: own sessions, stamped at most 15 minutes back; managers anyone's, any time
+-- DELETE: managers only
+ALTER TABLE work_sessions ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS work_sessions_select ON work_sessions;
+DROP POLICY IF EXISTS work_sessions_insert ON work_sessions;
+DROP POLICY IF EXISTS work_sessions_update ON work_sessions;
+DROP POLICY IF EXISTS work_sessions_delete ON work_sessions;
+CREATE POLICY work_sessions_select ON work_sessions FOR SELECT
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR user_id = current_telegram_id()));
+CREATE POLICY work_sessions_insert ON work_sessions FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR
+                (user_id = current_telegram_id() AND ended_at IS NULL
+                 AND started_at BETWEEN now() - interval '15 minutes' AND now() + interval '1 minute')));
+CREATE POLICY work_sessions_update ON work_sessions FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND (is_manager() OR (user_id = current_telegram_id() AND ended_at IS NULL)))
+    WITH CHECK (hotel_id = current_hotel_id() AND (is_manager() OR
+                (user_id = current_telegram_id()
+                 AND ended_at BETWEEN now() - interval '15 minutes' AND now() + interval '1 minute')));
+CREATE POLICY work_sessions_delete ON work_sessions FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: hotel_settings ─────────────────────────────────────────────────────
+-- SELECT: everyone at the property
+-- INSERT/UPDATE/DELETE: managers only
+ALTER TABLE hotel_settings ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hotel_settings_select ON hotel_settings;
+DROP POLICY IF EXISTS hotel_settings_write ON hotel_settings;
+CREATE POLICY hotel_settings_select ON hotel_settings FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY hotel_settings_write ON hotel_settings FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: room_blocks ────────────────────────────────────────────────────────
+-- SELECT: everyone at the property
+-- INSERT/UPDATE/DELETE: managers only
+ALTER TABLE room_blocks ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS room_blocks_select ON room_blocks;
+DROP POLICY IF EXISTS room_blocks_write ON room_blocks;
+CREATE POLICY room_blocks_select ON room_blocks FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY room_blocks_write ON room_blocks FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: dnd_log ────────────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: as oneself
+-- UPDATE/DELETE: managers only (correcting a wrong entry)
+ALTER TABLE dnd_log ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS dnd_log_select ON dnd_log;
+DROP POLICY IF EXISTS dnd_log_insert ON dnd_log;
+DROP POLICY IF EXISTS dnd_log_manage ON dnd_log;
+CREATE POLICY dnd_log_select ON dnd_log FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY dnd_log_insert ON dnd_log FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND logged_by = current_telegram_id());
+CREATE POLICY dnd_log_manage ON dnd_log FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: recurring_tasks ────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: managers only
+ALTER TABLE recurring_tasks ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS recurring_tasks_select ON recurring_tasks;
+DROP POLICY IF EXISTS recurring_tasks_write ON recurring_tasks;
+CREATE POLICY recurring_tasks_select ON recurring_tasks FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY recurring_tasks_write ON recurring_tasks FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: hotel_info ───────────────────────────────────────────────────────────
+-- SELECT: everyone at the property (staff answer guests too); INSERT/UPDATE/DELETE: managers
+ALTER TABLE hotel_info ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS hotel_info_select ON hotel_info;
+DROP POLICY IF EXISTS hotel_info_write ON hotel_info;
+CREATE POLICY hotel_info_select ON hotel_info FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY hotel_info_write ON hotel_info FOR ALL
+    USING (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: parking_spots ────────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT/UPDATE/DELETE: managers
+-- Who parks where lives on reservations.parking_spot_id (managers only)
+ALTER TABLE parking_spots ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS parking_spots_select ON parking_spots;
+DROP POLICY IF EXISTS parking_spots_write ON parking_spots;
+CREATE POLICY parking_spots_select ON parking_spots FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY parking_spots_write ON parking_spots FOR ALL
+    USING (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: keys ───────────────────────────────────────────────────────────────
+-- SELECT: everyone at the property
+-- UPDATE: everyone may take a key on the board or give back their own; managers any key
+-- INSERT/DELETE: managers only
+ALTER TABLE keys ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS keys_select ON keys;
+DROP POLICY IF EXISTS keys_write ON keys;
+DROP POLICY IF EXISTS keys_custody ON keys;
+CREATE POLICY keys_select ON keys FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY keys_write ON keys FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY keys_custody ON keys FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND (held_by IS NULL OR held_by = current_telegram_id()))
+    WITH CHECK (hotel_id = current_hotel_id() AND (held_by IS NULL OR held_by = current_telegram_id()));
+
+-- ── RLS: checklists / checklist_items ───────────────────────────────────────
+-- SELECT: everyone at the property (cleaners can see what will be checked)
+-- INSERT/UPDATE/DELETE: managers only; items follow their checklist
+ALTER TABLE checklists ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS checklists_select ON checklists;
+DROP POLICY IF EXISTS checklists_write ON checklists;
+CREATE POLICY checklists_select ON checklists FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY checklists_write ON checklists FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+ALTER TABLE checklist_items ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS checklist_items_select ON checklist_items;
+DROP POLICY IF EXISTS checklist_items_write ON checklist_items;
+CREATE POLICY checklist_items_select ON checklist_items FOR SELECT
+    USING (EXISTS (SELECT 1 FROM checklists c WHERE c.id = checklist_id AND c.hotel_id = current_hotel_id()));
+CREATE POLICY checklist_items_write ON checklist_items FOR ALL
+    USING      (is_manager() AND EXISTS (SELECT 1 FROM checklists c WHERE c.id = checklist_id AND c.hotel_id = current_hotel_id()))
+    WITH CHECK (is_manager() AND EXISTS (SELECT 1 FROM checklists c WHERE c.id = checklist_id AND c.hotel_id = current_hotel_id()));
+
+-- ── RLS: room_inspections ───────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: managers, as themselves
+-- No UPDATE/DELETE: an inspection is a record, a new one supersedes it
+ALTER TABLE room_inspections ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS room_inspections_select ON room_inspections;
+DROP POLICY IF EXISTS room_inspections_insert ON room_inspections;
+CREATE POLICY room_inspections_select ON room_inspections FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY room_inspections_insert ON room_inspections FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager() AND inspector_id = current_telegram_id());
+
+-- ── RLS: reviews ──────────────────────────────────────────────────────────────
+-- SELECT: managers at the property, and the cleaner whose work was scored
+-- INSERT/UPDATE/DELETE: managers at the property; a new score is signed by its author
+ALTER TABLE reviews ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS reviews_select ON reviews;
+DROP POLICY IF EXISTS reviews_insert ON reviews;
+DROP POLICY IF EXISTS reviews_update ON reviews;
+DROP POLICY IF EXISTS reviews_delete ON reviews;
+CREATE POLICY reviews_select ON reviews FOR SELECT
+    USING (hotel_id = current_hotel_id() AND (is_manager() OR EXISTS (
+        SELECT 1 FROM assignments a WHERE a.id = assignment_id AND a.cleaner_id = current_telegram_id())));
+CREATE POLICY reviews_insert ON reviews FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager() AND reviewer_id = current_telegram_id());
+CREATE POLICY reviews_update ON reviews FOR UPDATE
+    USING (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+CREATE POLICY reviews_delete ON reviews FOR DELETE
+    USING (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: cleaning_standards ───────────────────────────────────────────────────
+-- SELECT: everyone at the property (the cleaners read what a clean includes)
+-- INSERT/UPDATE/DELETE: managers at the property
+ALTER TABLE cleaning_standards ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS cleaning_standards_select ON cleaning_standards;
+DROP POLICY IF EXISTS cleaning_standards_write ON cleaning_standards;
+CREATE POLICY cleaning_standards_select ON cleaning_standards FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY cleaning_standards_write ON cleaning_standards FOR ALL
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
 
 -- ── RLS: reminders ────────────────────────────────────────────────────────────
 -- SELECT: managers see all; others see their own
@@ -159,3 +1744,32 @@ CREATE POLICY reminders_update ON reminders FOR UPDATE
     WITH CHECK (is_manager() OR created_by = current_telegram_id());
 CREATE POLICY reminders_delete ON reminders FOR DELETE
     USING (is_manager() OR created_by = current_telegram_id());
+
+-- ── RLS: maintenance_tickets ─────────────────────────────────────────────────
+-- SELECT: everyone at the property (cleaners need to know what's broken in their rooms)
+-- INSERT: anyone, as themselves, and only as an open ticket
+-- UPDATE: the property's managers only (triage and closing)
+ALTER TABLE maintenance_tickets ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS maintenance_tickets_select ON maintenance_tickets;
+DROP POLICY IF EXISTS maintenance_tickets_insert ON maintenance_tickets;
+DROP POLICY IF EXISTS maintenance_tickets_update ON maintenance_tickets;
+CREATE POLICY maintenance_tickets_select ON maintenance_tickets FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY maintenance_tickets_insert ON maintenance_tickets FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND reporter = current_telegram_id() AND status = 'open' AND resolved_at IS NULL);
+CREATE POLICY maintenance_tickets_update ON maintenance_tickets FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
+
+-- ── RLS: lost_found ──────────────────────────────────────────────────────────
+-- SELECT: everyone at the property; INSERT: anyone, as themselves, not yet returned
+-- UPDATE: the property's managers only (mark returned)
+ALTER TABLE lost_found ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS lost_found_select ON lost_found;
+DROP POLICY IF EXISTS lost_found_insert ON lost_found;
+DROP POLICY IF EXISTS lost_found_update ON lost_found;
+CREATE POLICY lost_found_select ON lost_found FOR SELECT USING (hotel_id = current_hotel_id());
+CREATE POLICY lost_found_insert ON lost_found FOR INSERT
+    WITH CHECK (hotel_id = current_hotel_id() AND found_by = current_telegram_id() AND returned_at IS NULL);
+CREATE POLICY lost_found_update ON lost_found FOR UPDATE
+    USING      (hotel_id = current_hotel_id() AND is_manager())
+    WITH CHECK (hotel_id = current_hotel_id() AND is_manager());
@@ -7,6 +7,15 @@
 -- See db/rls.sql for those.
 -- ============================================================
 
+-- Create "hotels" table (properties run by this deployment)
+CREATE TABLE "hotels" (
+  "id"         serial NOT NULL,
+  "name"       text NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "timezone"   text NOT NULL DEFAULT 'Europe/Rome',
+  "setup_completed_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
 -- Create "users" table
 CREATE TABLE "users" (
   "telegram_id" bigint NOT NULL,
@@ -15,9 +24,38 @@ CREATE TABLE "users" (
   "name" text NULL,
   "role" text NOT NULL DEFAULT 'cleaner',
   "language" text NOT NULL DEFAULT 'Italian',
+  "language_source" text NOT NULL DEFAULT 'default',
+  "timezone" text NOT NULL DEFAULT 'Europe/Rome',
+  "onboarded_at" timestamptz NULL,
+  "default_shift" text NULL,
   "is_admin" boolean NULL GENERATED ALWAYS AS (role = 'manager'::text) STORED,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "weekly_hours" numeric(4,1) NULL,
+  "last_seen_at" timestamptz NULL,
+  "unreachable_at" timestamptz NULL,
+  "unreachable_reason" text NULL,
   PRIMARY KEY ("telegram_id"),
-  CONSTRAINT "users_pg_user_key" UNIQUE ("pg_user")
+  CONSTRAINT "users_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "users_pg_user_key" UNIQUE ("pg_user"),
+  CONSTRAINT "users_default_shift_check" CHECK (default_shift = ANY (ARRAY['morning'::text, 'afternoon'::text, 'evening'::text])),
+  CONSTRAINT "users_weekly_hours_check" CHECK (weekly_hours > (0)::numeric),
+  CONSTRAINT "users_language_source_check" CHECK (language_source = ANY (ARRAY['default'::text, 'detected'::text, 'chosen'::text])),
+  CONSTRAINT "users_unreachable_reason_check" CHECK (unreachable_reason = ANY (ARRAY['blocked'::text, 'chat_not_found'::text]))
+);
+-- Create "room_types" table (capacity, default nightly rate, cleaning effort)
+CREATE TABLE "room_types" (
+  "id" serial NOT NULL,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "name" text NOT NULL,
+  "capacity" integer NOT NULL DEFAULT 2,
+  "base_rate" numeric(10,2) NULL,
+  "cleaning_minutes" integer NOT NULL DEFAULT 45,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "room_types_hotel_id_name_key" UNIQUE ("hotel_id", "name"),
+  CONSTRAINT "room_types_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "room_types_capacity_check" CHECK (capacity > 0),
+  CONSTRAINT "room_types_base_rate_check" CHECK (base_rate >= (0)::numeric),
+  CONSTRAINT "room_types_cleaning_minutes_check" CHECK (cleaning_minutes > 0)
 );
 -- Create "rooms" table
 CREATE TABLE "rooms" (
@@ -29,8 +67,18 @@ CREATE TABLE "rooms" (
   "guest_name" text NULL,
   "checkin_at" timestamptz NULL,
   "checkout_at" timestamptz NULL,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "room_type_id" integer NULL,
+  "pets_allowed" boolean NOT NULL DEFAULT false,
+  "accessible" boolean NOT NULL DEFAULT false,
+  "balcony" boolean NOT NULL DEFAULT false,
+  "connecting_room_id" integer NULL,
   PRIMARY KEY ("id"),
-  CONSTRAINT "rooms_name_key" UNIQUE ("name")
+  CONSTRAINT "rooms_hotel_id_name_key" UNIQUE ("hotel_id", "name"),
+  CONSTRAINT "rooms_connecting_room_id_fkey" FOREIGN KEY ("connecting_room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "rooms_connecting_room_id_check" CHECK (connecting_room_id <> id),
+  CONSTRAINT "rooms_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "rooms_room_type_id_fkey" FOREIGN KEY ("room_type_id") REFERENCES "room_types" ("id") ON UPDATE NO ACTION ON DELETE SET NULL
 );
 -- Create "assignments" table
 CREATE TABLE "assignments" (
@@ -43,13 +91,191 @@ CREATE TABLE "assignments" (
   "notes" text NULL,
   "updated_at" timestamptz NOT NULL DEFAULT now(),
   "type" text NOT NULL DEFAULT 'checkout',
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "accept_requested_at" timestamptz NULL,
+  "accepted_at" timestamptz NULL,
+  "accept_flagged_at" timestamptz NULL,
+  "started_at" timestamptz NULL,
+  "completed_at" timestamptz NULL,
   PRIMARY KEY ("id"),
+  CONSTRAINT "assignments_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
   CONSTRAINT "assignments_cleaner_id_fkey" FOREIGN KEY ("cleaner_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
   CONSTRAINT "assignments_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
   CONSTRAINT "assignments_shift_check" CHECK (shift = ANY (ARRAY['morning'::text, 'afternoon'::text, 'evening'::text])),
   CONSTRAINT "assignments_status_check" CHECK (status = ANY (ARRAY['pending'::text, 'in_progress'::text, 'done'::text, 'skipped'::text]))
 );
--- Create "invites" table
+-- Create "rates" table (nightly prices; room, then room type rows and narrower periods win)
+CREATE TABLE "rates" (
+  "id"              bigserial NOT NULL,
+  "hotel_id"        integer NOT NULL DEFAULT 1,
+  "room_id"         integer NULL,
+  "room_type_id"    integer NULL,
+  "valid_from"      date NOT NULL,
+  "valid_to"        date NOT NULL,
+  "nightly_eur"     numeric(10,2) NOT NULL,
+  "included_guests" integer NOT NULL DEFAULT 2,
+  "extra_guest_eur" numeric(10,2) NOT NULL DEFAULT 0,
+  "note"            text NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "rates_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "rates_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "rates_room_type_id_fkey" FOREIGN KEY ("room_type_id") REFERENCES "room_types" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "rates_target_check" CHECK (room_id IS NULL OR room_type_id IS NULL),
+  CONSTRAINT "rates_dates_check" CHECK (valid_to >= valid_from),
+  CONSTRAINT "rates_nightly_eur_check" CHECK (nightly_eur >= 0)
+);
+-- Create "rate_rules" table (minimum stays and surcharges on top of rates: weekends, holidays, event dates)
+CREATE TABLE "rate_rules" (
+  "id"            bigserial NOT NULL,
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "room_type_id"  integer NULL,
+  "valid_from"    date NOT NULL,
+  "valid_to"      date NOT NULL,
+  "min_nights"    integer NULL,
+  "surcharge_pct" numeric(5,2) NULL,
+  "weekends_only" boolean NOT NULL DEFAULT false,
+  "note"          text NULL,
+  "created_by"    bigint NULL,
+  "created_at"    timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "rate_rules_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "rate_rules_room_type_id_fkey" FOREIGN KEY ("room_type_id") REFERENCES "room_types" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "rate_rules_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "rate_rules_dates_check" CHECK (valid_to >= valid_from),
+  CONSTRAINT "rate_rules_min_nights_check" CHECK (min_nights > 1),
+  CONSTRAINT "rate_rules_surcharge_pct_check" CHECK ((surcharge_pct > '-100'::numeric) AND (surcharge_pct <= '500'::numeric)),
+  CONSTRAINT "rate_rules_rule_check" CHECK ((min_nights IS NOT NULL) OR (surcharge_pct IS NOT NULL))
+);
+-- Create index "rate_rules_hotel_id_valid_from_idx" to table: "rate_rules"
+CREATE INDEX "rate_rules_hotel_id_valid_from_idx" ON "rate_rules" ("hotel_id", "valid_from", "valid_to");
+-- Create "booking_channels" table (per property: each one negotiates its own commissions)
+CREATE TABLE "booking_channels" (
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "name"           text NOT NULL,
+  "commission_pct" numeric(5,2) NOT NULL DEFAULT 0,
+  PRIMARY KEY ("hotel_id", "name"),
+  CONSTRAINT "booking_channels_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "booking_channels_commission_pct_check" CHECK (commission_pct >= 0 AND commission_pct <= 100)
+);
+-- Create "channel_feeds" table (per-room iCal exports of OTAs, synced into reservations)
+CREATE TABLE "channel_feeds" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "room_id"        integer NOT NULL,
+  "channel"        text NOT NULL,
+  "url"            text NOT NULL,
+  "created_by"     bigint NOT NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  "last_synced_at" timestamptz NULL,
+  "last_error"     text NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "channel_feeds_room_id_url_key" UNIQUE ("room_id", "url"),
+  CONSTRAINT "channel_feeds_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "channel_feeds_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "channel_feeds_channel_fkey" FOREIGN KEY ("hotel_id", "channel") REFERENCES "booking_channels" ("hotel_id", "name") ON UPDATE CASCADE ON DELETE NO ACTION,
+  CONSTRAINT "channel_feeds_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create "guests" table (returning-guest profiles, linked from reservations)
+CREATE TABLE "guests" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "name"        text NOT NULL,
+  "phone"       text NULL,
+  "email"       text NULL,
+  "preferences" text NULL,
+  "notes"       text NULL,
+  "vip"         boolean NOT NULL DEFAULT false,
+  "special_instructions" text NULL,
+  "stay_count"  integer NOT NULL DEFAULT 0,
+  "last_stay"   date NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "guests_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "guests_name_idx" to table: "guests"
+CREATE INDEX "guests_name_idx" ON "guests" ("hotel_id", (lower(name)));
+-- Create "booking_groups" table (one booking of several rooms: a tour group, a wedding party)
+CREATE TABLE "booking_groups" (
+  "id" bigserial NOT NULL,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "name" text NOT NULL,
+  "guest_id" bigint NULL,
+  "amount_eur" numeric(10,2) NULL,
+  "notes" text NULL,
+  "created_by" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "booking_groups_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "booking_groups_guest_id_fkey" FOREIGN KEY ("guest_id") REFERENCES "guests" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "booking_groups_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create "parking_spots" table (the property's parking spaces, assigned to stays via reservations.parking_spot_id)
+CREATE TABLE "parking_spots" (
+  "id" serial NOT NULL,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "label" text NOT NULL,
+  "kind" text NOT NULL DEFAULT 'outdoor',
+  "notes" text NULL,
+  "active" boolean NOT NULL DEFAULT true,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "parking_spots_hotel_id_label_key" UNIQUE ("hotel_id", "label"),
+  CONSTRAINT "parking_spots_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "parking_spots_kind_check" CHECK (kind = ANY (ARRAY['outdoor'::text, 'covered'::text, 'garage'::text]))
+);
+-- Create "reservations" table
+CREATE TABLE "reservations" (
+  "id" bigserial NOT NULL,
+  "room_id" integer NOT NULL,
+  "guest_name" text NULL,
+  "checkin_at" timestamptz NOT NULL,
+  "checkout_at" timestamptz NOT NULL,
+  "notes" text NULL,
+  "created_by" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "source" text NOT NULL DEFAULT 'direct',
+  "amount_eur" numeric(10,2) NULL,
+  "guests" integer NOT NULL DEFAULT 1,
+  "children" integer NOT NULL DEFAULT 0,
+  "residence_country" text NULL,
+  "residence_province" text NULL,
+  "board" text NOT NULL DEFAULT 'bb',
+  "dietary_notes" text NULL,
+  "status" text NOT NULL DEFAULT 'confirmed',
+  "hold_until" timestamptz NULL,
+  "feed_id" bigint NULL,
+  "external_uid" text NULL,
+  "guest_id" bigint NULL,
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "linked_reservation_id" bigint NULL,
+  "vip" boolean NOT NULL DEFAULT false,
+  "special_instructions" text NULL,
+  "booking_group_id" bigint NULL,
+  "parking_spot_id" integer NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "reservations_parking_spot_id_fkey" FOREIGN KEY ("parking_spot_id") REFERENCES "parking_spots" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reservations_booking_group_id_fkey" FOREIGN KEY ("booking_group_id") REFERENCES "booking_groups" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reservations_linked_reservation_id_fkey" FOREIGN KEY ("linked_reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reservations_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reservations_feed_id_external_uid_key" UNIQUE ("feed_id", "external_uid"),
+  CONSTRAINT "reservations_guest_id_fkey" FOREIGN KEY ("guest_id") REFERENCES "guests" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reservations_feed_id_fkey" FOREIGN KEY ("feed_id") REFERENCES "channel_feeds" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reservations_source_fkey" FOREIGN KEY ("hotel_id", "source") REFERENCES "booking_channels" ("hotel_id", "name") ON UPDATE CASCADE ON DELETE NO ACTION,
+  CONSTRAINT "reservations_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reservations_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "reservations_guests_check" CHECK (guests > 0),
+  CONSTRAINT "reservations_children_check" CHECK (children >= 0 AND children <= guests),
+  CONSTRAINT "reservations_status_check" CHECK (status = ANY (ARRAY['confirmed'::text, 'option'::text, 'expired'::text, 'cancelled'::text])),
+  CONSTRAINT "reservations_board_check" CHECK (board = ANY (ARRAY['room_only'::text, 'bb'::text, 'half_board'::text, 'full_board'::text])),
+  CONSTRAINT "reservations_hold_check" CHECK (status <> 'option'::text OR hold_until IS NOT NULL),
+  CONSTRAINT "reservations_residence_country_check" CHECK (residence_country ~ '^[A-Z]{2}$'),
+  CONSTRAINT "reservations_residence_province_check" CHECK (residence_province ~ '^[A-Z]{2}$' AND residence_country = 'IT')
+);
+-- Create index "reservations_booking_group_idx" to table: "reservations"
+CREATE INDEX "reservations_booking_group_idx" ON "reservations" ("booking_group_id") WHERE (booking_group_id IS NOT NULL);
+-- Create index "reservations_parking_spot_idx" to table: "reservations"
+CREATE INDEX "reservations_parking_spot_idx" ON "reservations" ("parking_spot_id", "checkin_at") WHERE (parking_spot_id IS NOT NULL);
+-- Create "invites" table (guest invites belong to a reservation)
 CREATE TABLE "invites" (
   "id" bigserial NOT NULL,
   "token" text NOT NULL,
@@ -60,12 +286,36 @@ CREATE TABLE "invites" (
   "created_at" timestamptz NOT NULL DEFAULT now(),
   "used_at" timestamptz NULL,
   "expires_at" timestamptz NOT NULL DEFAULT (now() + '7 days'::interval),
+  "hotel_id" integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NULL,
   PRIMARY KEY ("id"),
+  CONSTRAINT "invites_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
   CONSTRAINT "invites_token_key" UNIQUE ("token"),
   CONSTRAINT "invites_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
   CONSTRAINT "invites_used_by_fkey" FOREIGN KEY ("used_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
-  CONSTRAINT "invites_role_check" CHECK (role = ANY (ARRAY['manager'::text, 'cleaner'::text]))
+  CONSTRAINT "invites_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "invites_role_check" CHECK (role = ANY (ARRAY['manager'::text, 'cleaner'::text, 'guest'::text])),
+  CONSTRAINT "invites_reservation_check" CHECK ((role = 'guest'::text) = (reservation_id IS NOT NULL))
 );
+-- Create "reminder_templates" table (standard reminders scheduled for every confirmed reservation)
+CREATE TABLE "reminder_templates" (
+  "id"             serial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "code"           text NOT NULL,
+  "event"          text NOT NULL,
+  "offset_minutes" integer NOT NULL,
+  "audience"       text NOT NULL,
+  "message"        text NOT NULL,
+  "active"         boolean NOT NULL DEFAULT true,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "reminder_templates_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reminder_templates_event_check" CHECK (event = ANY (ARRAY['checkin'::text, 'checkout'::text])),
+  CONSTRAINT "reminder_templates_audience_check" CHECK (audience = ANY (ARRAY['cleaner'::text, 'manager'::text])),
+  CONSTRAINT "reminder_templates_offset_minutes_check" CHECK ((offset_minutes >= 0) AND (offset_minutes <= 1440))
+);
+-- Create index "reminder_templates_hotel_id_code_idx" to table: "reminder_templates"
+CREATE UNIQUE INDEX "reminder_templates_hotel_id_code_idx" ON "reminder_templates" ("hotel_id", "code");
 -- Create "reminders" table
 CREATE TABLE "reminders" (
   "id" bigserial NOT NULL,
@@ -76,26 +326,72 @@ CREATE TABLE "reminders" (
   "created_by" bigint NOT NULL,
   "fired_at" timestamptz NULL,
   "created_at" timestamptz NOT NULL DEFAULT now(),
+  "assignment_id" integer NULL,
+  "cancelled_at" timestamptz NULL,
+  "reservation_id" bigint NULL,
+  "template_id" integer NULL,
   PRIMARY KEY ("id"),
+  CONSTRAINT "reminders_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "reminders_template_id_fkey" FOREIGN KEY ("template_id") REFERENCES "reminder_templates" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "reminders_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
   CONSTRAINT "reminders_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
   CONSTRAINT "reminders_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL
 );
 -- Create index "reminders_pending_idx" to table: "reminders"
 CREATE INDEX "reminders_pending_idx" ON "reminders" ("fire_at") WHERE (fired_at IS NULL);
--- Create "reservations" table
-CREATE TABLE "reservations" (
-  "id" bigserial NOT NULL,
-  "room_id" integer NOT NULL,
-  "guest_name" text NULL,
-  "checkin_at" timestamptz NOT NULL,
-  "checkout_at" timestamptz NOT NULL,
-  "notes" text NULL,
-  "created_by" bigint NOT NULL,
-  "created_at" timestamptz NOT NULL DEFAULT now(),
+-- Create index "reminders_assignment_idx" to table: "reminders"
+CREATE INDEX "reminders_assignment_idx" ON "reminders" ("assignment_id") WHERE (assignment_id IS NOT NULL);
+-- Create index "reminders_reservation_idx" to table: "reminders"
+CREATE INDEX "reminders_reservation_idx" ON "reminders" ("reservation_id") WHERE (reservation_id IS NOT NULL);
+-- Create "guest_message_templates" table (messages to guests: booking confirmation, pre-arrival info, checkout instructions)
+CREATE TABLE "guest_message_templates" (
+  "id"             serial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "code"           text NOT NULL,
+  "event"          text NOT NULL,
+  "offset_minutes" integer NOT NULL DEFAULT 0,
+  "subject"        text NOT NULL,
+  "body"           text NOT NULL,
+  "active"         boolean NOT NULL DEFAULT false,
+  "active_since"   timestamptz NULL,
+  "needs_approval" boolean NOT NULL DEFAULT false,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
   PRIMARY KEY ("id"),
-  CONSTRAINT "reservations_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
-  CONSTRAINT "reservations_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+  CONSTRAINT "guest_message_templates_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_message_templates_event_check" CHECK (event = ANY (ARRAY['booking'::text, 'checkin'::text, 'checkout'::text, 'manual'::text])),
+  CONSTRAINT "guest_message_templates_offset_minutes_check" CHECK ((offset_minutes >= 0) AND (offset_minutes <= 20160)),
+  CONSTRAINT "guest_message_templates_active_check" CHECK (NOT active OR active_since IS NOT NULL)
+);
+-- Create index "guest_message_templates_hotel_id_code_idx" to table: "guest_message_templates"
+CREATE UNIQUE INDEX "guest_message_templates_hotel_id_code_idx" ON "guest_message_templates" ("hotel_id", "code");
+-- Create "guest_messages" table (messages sent to the guests of a reservation; sent_by NULL = automatic, queued = waiting for a manager)
+CREATE TABLE "guest_messages" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NOT NULL,
+  "template_id"    integer NULL,
+  "channel"        text NULL,
+  "recipient"      text NULL,
+  "subject"        text NULL,
+  "body"           text NOT NULL,
+  "error"          text NULL,
+  "sent_by"        bigint NULL,
+  "sent_at"        timestamptz NOT NULL DEFAULT now(),
+  "status"         text NOT NULL DEFAULT 'sent',
+  "approved_by"    bigint NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "guest_messages_approved_by_fkey" FOREIGN KEY ("approved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "guest_messages_status_check" CHECK (status = ANY (ARRAY['queued'::text, 'sent'::text, 'discarded'::text])),
+  CONSTRAINT "guest_messages_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_messages_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "guest_messages_template_id_fkey" FOREIGN KEY ("template_id") REFERENCES "guest_message_templates" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "guest_messages_sent_by_fkey" FOREIGN KEY ("sent_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "guest_messages_channel_check" CHECK (channel = ANY (ARRAY['telegram'::text, 'email'::text]))
 );
+-- Create index "guest_messages_reservation_idx" to table: "guest_messages"
+CREATE INDEX "guest_messages_reservation_idx" ON "guest_messages" ("reservation_id");
+-- Create index "guest_messages_automatic_idx" to table: "guest_messages"
+CREATE UNIQUE INDEX "guest_messages_automatic_idx" ON "guest_messages" ("reservation_id", "template_id") WHERE (sent_by IS NULL);
 -- Create "prompts" table
 CREATE TABLE "prompts" (
   "role"       text NOT NULL,
@@ -103,6 +399,898 @@ CREATE TABLE "prompts" (
   "updated_at" timestamptz NOT NULL DEFAULT now(),
   PRIMARY KEY ("role")
 );
+-- Create "prompt_translations" table (generated translations of prompts.template)
+CREATE TABLE "prompt_translations" (
+  "role"        text NOT NULL,
+  "language"    text NOT NULL,
+  "template"    text NOT NULL,
+  "source_hash" text NOT NULL,
+  "updated_at"  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("role", "language")
+);
+-- Create "message_translations" table (internal: the bot's own messages translated into a user's language)
+CREATE TABLE "message_translations" (
+  "language"    text NOT NULL,
+  "source_hash" text NOT NULL,
+  "text"        text NOT NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("language", "source_hash")
+);
+-- Create "missed_messages" table (internal: bot messages a user did not receive, for the catch-up digest)
+CREATE TABLE "missed_messages" (
+  "id"          bigserial NOT NULL,
+  "telegram_id" bigint NOT NULL,
+  "text"        text NOT NULL,
+  "html"        boolean NOT NULL DEFAULT false,
+  "error"       text NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "missed_messages_telegram_id_fkey" FOREIGN KEY ("telegram_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create index "missed_messages_telegram_id_idx" to table: "missed_messages"
+CREATE INDEX "missed_messages_telegram_id_idx" ON "missed_messages" ("telegram_id");
+-- Create "agent_events" table (internal: the SDK's persistent event bus; entity_change rows come from notify_subscribers)
+CREATE TABLE "agent_events" (
+  "id"               bigserial NOT NULL,
+  "event_id"         uuid NOT NULL,
+  "target_user_id"   bigint NOT NULL,
+  "chat_id"          bigint NOT NULL,
+  "kind"             text NOT NULL,
+  "content"          text NOT NULL,
+  "source"           text NULL,
+  "context_snapshot" jsonb NULL,
+  "created_at"       timestamptz NULL DEFAULT now(),
+  "processed_at"     timestamptz NULL,
+  "dispatched_at"    timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "agent_events_event_id_key" UNIQUE ("event_id")
+);
+-- Create index "agent_events_pending_idx" to table: "agent_events"
+CREATE INDEX "agent_events_pending_idx" ON "agent_events" ("id") WHERE (processed_at IS NULL);
+-- Create "shadow_runs" table (candidate prompt/model vs production, per message)
+CREATE TABLE "shadow_runs" (
+  "id" bigserial NOT NULL,
+  "telegram_id" bigint NOT NULL,
+  "inbound" text NOT NULL,
+  "production_reply" text NOT NULL,
+  "production_tools" jsonb NULL,
+  "shadow_reply" text NOT NULL DEFAULT '',
+  "shadow_tools" jsonb NULL,
+  "similarity" real NOT NULL,
+  "diverged" boolean NOT NULL DEFAULT false,
+  "model" text NOT NULL,
+  "prompt_hash" text NULL,
+  "error" text NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id")
+);
+-- Create index "shadow_runs_diverged_idx" to table: "shadow_runs"
+CREATE INDEX "shadow_runs_diverged_idx" ON "shadow_runs" ("created_at") WHERE diverged;
+-- Create "content_templates" table (seeded: the default text the row was last seeded with; edited rows differ from it)
+CREATE TABLE "content_templates" (
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "name"       text NOT NULL,
+  "template"   text NOT NULL,
+  "seeded"     text NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("hotel_id", "name"),
+  CONSTRAINT "content_templates_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create "saved_queries" table (heartbeat placeholders and managers' reports, optionally sent on a schedule)
+CREATE TABLE "saved_queries" (
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "name"          text NOT NULL,
+  "description"   text NULL,
+  "sql"           text NOT NULL,
+  "schedule"      text NULL,
+  "weekday"       smallint NULL,
+  "week_of_month" smallint NULL,
+  "day_of_month"  smallint NULL,
+  "send_at"       time NOT NULL DEFAULT '08:00:00',
+  "recipient"     bigint NULL,
+  "last_sent_on"  date NULL,
+  "created_by"    bigint NULL,
+  "updated_at"    timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("hotel_id", "name"),
+  CONSTRAINT "saved_queries_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "saved_queries_recipient_fkey" FOREIGN KEY ("recipient") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "saved_queries_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "saved_queries_name_check" CHECK (name ~ '^[a-z0-9_]+$'),
+  CONSTRAINT "saved_queries_schedule_check" CHECK (schedule = ANY (ARRAY['daily'::text, 'weekly'::text, 'monthly'::text])),
+  CONSTRAINT "saved_queries_weekday_check" CHECK ((weekday >= 1) AND (weekday <= 7)),
+  CONSTRAINT "saved_queries_week_of_month_check" CHECK ((week_of_month = -1) OR ((week_of_month >= 1) AND (week_of_month <= 4))),
+  CONSTRAINT "saved_queries_day_of_month_check" CHECK ((day_of_month >= 1) AND (day_of_month <= 31)),
+  CONSTRAINT "saved_queries_rule_check" CHECK ((schedule IS NULL) OR ((schedule = 'daily'::text) AND (weekday IS NULL) AND (week_of_month IS NULL) AND (day_of_month IS NULL)) OR ((schedule = 'weekly'::text) AND (weekday IS NOT NULL) AND (week_of_month IS NULL) AND (day_of_month IS NULL)) OR ((schedule = 'monthly'::text) AND (((day_of_month IS NOT NULL) AND (weekday IS NULL) AND (week_of_month IS NULL)) OR ((day_of_month IS NULL) AND (weekday IS NOT NULL) AND (week_of_month IS NOT NULL)))))
+);
+-- Create "countdown_notifications" table (internal: dedup for countdown.go)
+CREATE TABLE "countdown_notifications" (
+  "reservation_id" bigint NOT NULL,
+  "stage_minutes"  integer NOT NULL,
+  "sent_at"        timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("reservation_id", "stage_minutes"),
+  CONSTRAINT "countdown_notifications_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create "room_status_events" table (written by the rooms_status_change trigger)
+CREATE TABLE "room_status_events" (
+  "id"            bigserial NOT NULL,
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "room_id"       integer NOT NULL,
+  "old_status"    text NOT NULL,
+  "new_status"    text NOT NULL,
+  "actor_id"      bigint NULL,
+  "changed_at"    timestamptz NOT NULL DEFAULT now(),
+  "dispatched_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "room_status_events_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "room_status_events_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create index "room_status_events_pending_idx" to table: "room_status_events"
+CREATE INDEX "room_status_events_pending_idx" ON "room_status_events" ("id") WHERE (dispatched_at IS NULL);
+-- Create "intent_metrics" table (anonymized: property, role + topic only, no user id/text)
+CREATE TABLE "intent_metrics" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "occurred_at" timestamptz NOT NULL DEFAULT now(),
+  "role"        text NOT NULL,
+  "intent"      text NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "intent_metrics_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "intent_metrics_occurred_at_idx" to table: "intent_metrics"
+CREATE INDEX "intent_metrics_occurred_at_idx" ON "intent_metrics" ("occurred_at");
+-- Create "planning_sessions" table (internal: /plan state machine, one per manager)
+CREATE TABLE "planning_sessions" (
+  "manager_id" bigint NOT NULL,
+  "week_start" date NOT NULL,
+  "day_index"  integer NOT NULL DEFAULT 0,
+  "draft"      jsonb NOT NULL DEFAULT '[]',
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("manager_id"),
+  CONSTRAINT "planning_sessions_manager_id_fkey" FOREIGN KEY ("manager_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create "assignment_conflicts" table (written by the assignments_detect_conflict trigger)
+CREATE TABLE "assignment_conflicts" (
+  "id"                     bigserial NOT NULL,
+  "hotel_id"               integer NOT NULL DEFAULT 1,
+  "kind"                   text NOT NULL,
+  "new_assignment_id"      integer NULL,
+  "existing_assignment_id" integer NULL,
+  "created_at"             timestamptz NOT NULL DEFAULT now(),
+  "notified_at"            timestamptz NULL,
+  "resolved_at"            timestamptz NULL,
+  "resolved_by"            bigint NULL,
+  "resolution"             text NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "assignment_conflicts_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "assignment_conflicts_new_assignment_id_fkey" FOREIGN KEY ("new_assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "assignment_conflicts_existing_assignment_id_fkey" FOREIGN KEY ("existing_assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "assignment_conflicts_resolved_by_fkey" FOREIGN KEY ("resolved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "assignment_conflicts_kind_check" CHECK (kind = ANY (ARRAY['room'::text, 'cleaner'::text])),
+  CONSTRAINT "assignment_conflicts_resolution_check" CHECK (resolution = ANY (ARRAY['new'::text, 'old'::text, 'both'::text]))
+);
+-- Create "maintenance_tickets" table
+CREATE TABLE "maintenance_tickets" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "room_id"     integer NULL,
+  "reporter"    bigint NOT NULL,
+  "description" text NOT NULL,
+  "severity"    text NOT NULL DEFAULT 'normal',
+  "status"      text NOT NULL DEFAULT 'open',
+  "photos"      text[] NOT NULL DEFAULT '{}',
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  "resolved_at" timestamptz NULL,
+  "resolved_by" bigint NULL,
+  "resolution"  text NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "maintenance_tickets_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "maintenance_tickets_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "maintenance_tickets_reporter_fkey" FOREIGN KEY ("reporter") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "maintenance_tickets_resolved_by_fkey" FOREIGN KEY ("resolved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "maintenance_tickets_severity_check" CHECK (severity = ANY (ARRAY['low'::text, 'normal'::text, 'high'::text, 'urgent'::text])),
+  CONSTRAINT "maintenance_tickets_status_check" CHECK (status = ANY (ARRAY['open'::text, 'in_progress'::text, 'closed'::text]))
+);
+-- Create index "maintenance_tickets_open_idx" to table: "maintenance_tickets"
+CREATE INDEX "maintenance_tickets_open_idx" ON "maintenance_tickets" ("room_id") WHERE (status <> 'closed'::text);
+-- Create "extras" table (catalog of bookable extra services, per property)
+CREATE TABLE "extras" (
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "code"           text NOT NULL,
+  "name"           text NOT NULL,
+  "unit_price_eur" numeric(10,2) NOT NULL DEFAULT 0,
+  "pricing"        text NOT NULL DEFAULT 'per_day',
+  "stock"          integer NULL,
+  PRIMARY KEY ("hotel_id", "code"),
+  CONSTRAINT "extras_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "extras_code_check" CHECK (code ~ '^[a-z0-9_]+$'),
+  CONSTRAINT "extras_pricing_check" CHECK (pricing = ANY (ARRAY['per_day'::text, 'per_stay'::text])),
+  CONSTRAINT "extras_stock_check" CHECK (stock >= 0)
+);
+-- Create "reservation_extras" table
+CREATE TABLE "reservation_extras" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NOT NULL,
+  "extra_code"     text NOT NULL,
+  "quantity"       integer NOT NULL DEFAULT 1,
+  "from_date"      date NOT NULL,
+  "to_date"        date NOT NULL,
+  "unit_price_eur" numeric(10,2) NOT NULL,
+  "created_by"     bigint NOT NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "reservation_extras_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "reservation_extras_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reservation_extras_extra_code_fkey" FOREIGN KEY ("hotel_id", "extra_code") REFERENCES "extras" ("hotel_id", "code") ON UPDATE CASCADE ON DELETE NO ACTION,
+  CONSTRAINT "reservation_extras_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reservation_extras_quantity_check" CHECK (quantity > 0),
+  CONSTRAINT "reservation_extras_dates_check" CHECK (to_date >= from_date)
+);
+-- Create index "reservation_extras_dates_idx" to table: "reservation_extras"
+CREATE INDEX "reservation_extras_dates_idx" ON "reservation_extras" ("hotel_id", "extra_code", "from_date", "to_date");
+-- Create "invoices" table (one per reservation, numbered per property and year)
+CREATE TABLE "invoices" (
+  "id"                bigserial NOT NULL,
+  "hotel_id"          integer NOT NULL DEFAULT 1,
+  "year"              integer NOT NULL,
+  "number"            integer NOT NULL,
+  "reservation_id"    bigint NOT NULL,
+  "customer_name"     text NOT NULL,
+  "customer_address"  text NULL,
+  "customer_tax_code" text NULL,
+  "stay"              text NOT NULL,
+  "vat_pct"           numeric(4,2) NOT NULL,
+  "lines"             jsonb NOT NULL,
+  "total_eur"         numeric(10,2) NOT NULL,
+  "created_by"        bigint NOT NULL,
+  "created_at"        timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "invoices_hotel_id_year_number_key" UNIQUE ("hotel_id", "year", "number"),
+  CONSTRAINT "invoices_reservation_id_key" UNIQUE ("reservation_id"),
+  CONSTRAINT "invoices_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "invoices_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "invoices_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "invoices_number_check" CHECK (number > 0)
+);
+-- Create "payments" table (deposits, balances and refunds per reservation)
+CREATE TABLE "payments" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NOT NULL,
+  "amount_eur"     numeric(10,2) NOT NULL,
+  "method"         text NOT NULL,
+  "is_deposit"     boolean NOT NULL DEFAULT false,
+  "paid_at"        timestamptz NOT NULL DEFAULT now(),
+  "note"           text NULL,
+  "created_by"     bigint NOT NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "payments_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "payments_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "payments_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "payments_amount_check" CHECK (amount_eur <> 0),
+  CONSTRAINT "payments_method_check" CHECK (method = ANY (ARRAY['cash'::text, 'card'::text, 'transfer'::text, 'ota'::text, 'other'::text]))
+);
+-- Create index "payments_reservation_id_idx" to table: "payments"
+CREATE INDEX "payments_reservation_id_idx" ON "payments" ("reservation_id");
+-- Create "staff_absences" table (sick days and leave; leave is requested and approved by a manager; a pending proposal moves the absentee's assignments)
+CREATE TABLE "staff_absences" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "user_id"     bigint NOT NULL,
+  "from_date"   date NOT NULL,
+  "to_date"     date NOT NULL,
+  "reason"      text NOT NULL DEFAULT 'sick',
+  "status"      text NOT NULL DEFAULT 'approved',
+  "note"        text NULL,
+  "decided_by"  bigint NULL,
+  "decided_at"  timestamptz NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  "proposal"    jsonb NULL,
+  "resolution"  text NULL,
+  "resolved_by" bigint NULL,
+  "resolved_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "staff_absences_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "staff_absences_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "staff_absences_resolved_by_fkey" FOREIGN KEY ("resolved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "staff_absences_decided_by_fkey" FOREIGN KEY ("decided_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "staff_absences_dates_check" CHECK (to_date >= from_date),
+  CONSTRAINT "staff_absences_reason_check" CHECK (reason = ANY (ARRAY['sick'::text, 'leave'::text])),
+  CONSTRAINT "staff_absences_status_check" CHECK (status = ANY (ARRAY['requested'::text, 'approved'::text, 'rejected'::text])),
+  CONSTRAINT "staff_absences_resolution_check" CHECK (resolution = ANY (ARRAY['approved'::text, 'manual'::text]))
+);
+-- Create index "staff_absences_user_id_idx" to table: "staff_absences"
+CREATE INDEX "staff_absences_user_id_idx" ON "staff_absences" ("user_id", "to_date");
+-- Create "attachments" table (photos and files sent to the bot; the file itself is under ATTACHMENTS_DIR)
+CREATE TABLE "attachments" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "uploaded_by"    bigint NOT NULL,
+  "kind"           text NOT NULL DEFAULT 'photo',
+  "file_id"        text NOT NULL,
+  "file_unique_id" text NOT NULL,
+  "file_name"      text NULL,
+  "path"           text NOT NULL,
+  "size_bytes"     integer NOT NULL,
+  "caption"        text NULL,
+  "assignment_id"  integer NULL,
+  "ticket_id"      bigint NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "attachments_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "attachments_uploaded_by_fkey" FOREIGN KEY ("uploaded_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "attachments_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "attachments_ticket_id_fkey" FOREIGN KEY ("ticket_id") REFERENCES "maintenance_tickets" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "attachments_kind_check" CHECK (kind = ANY (ARRAY['photo'::text, 'document'::text]))
+);
+-- Create index "attachments_assignment_id_idx" to table: "attachments"
+CREATE INDEX "attachments_assignment_id_idx" ON "attachments" ("assignment_id") WHERE (assignment_id IS NOT NULL);
+-- Create index "attachments_ticket_id_idx" to table: "attachments"
+CREATE INDEX "attachments_ticket_id_idx" ON "attachments" ("ticket_id") WHERE (ticket_id IS NOT NULL);
+-- Create "supplies" table (cleaning supplies stock; quantity is kept by the supply_movements trigger)
+CREATE TABLE "supplies" (
+  "id"         serial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "name"       text NOT NULL,
+  "category"   text NOT NULL DEFAULT 'other',
+  "unit"       text NOT NULL DEFAULT 'pz',
+  "quantity"   numeric(10,2) NOT NULL DEFAULT 0,
+  "threshold"  numeric(10,2) NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "supplies_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "supplies_category_check" CHECK (category = ANY (ARRAY['detergent'::text, 'linen'::text, 'amenity'::text, 'other'::text])),
+  CONSTRAINT "supplies_quantity_check" CHECK (quantity >= (0)::numeric),
+  CONSTRAINT "supplies_threshold_check" CHECK (threshold >= (0)::numeric)
+);
+-- Create index "supplies_hotel_id_name_idx" to table: "supplies"
+CREATE UNIQUE INDEX "supplies_hotel_id_name_idx" ON "supplies" ("hotel_id", (lower(name)));
+-- Create "supply_movements" table (stock ledger: usage by cleaners, restocks and counts by managers)
+CREATE TABLE "supply_movements" (
+  "id"            bigserial NOT NULL,
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "supply_id"     integer NOT NULL,
+  "delta"         numeric(10,2) NOT NULL,
+  "kind"          text NOT NULL,
+  "user_id"       bigint NOT NULL,
+  "assignment_id" integer NULL,
+  "note"          text NULL,
+  "created_at"    timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "supply_movements_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "supply_movements_supply_id_fkey" FOREIGN KEY ("supply_id") REFERENCES "supplies" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "supply_movements_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "supply_movements_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "supply_movements_kind_check" CHECK (kind = ANY (ARRAY['usage'::text, 'restock'::text, 'adjustment'::text])),
+  CONSTRAINT "supply_movements_delta_check" CHECK (delta <> (0)::numeric)
+);
+-- Create index "supply_movements_supply_id_idx" to table: "supply_movements"
+CREATE INDEX "supply_movements_supply_id_idx" ON "supply_movements" ("supply_id", "created_at");
+-- Create "minibar_items" table (minibar price list of a property)
+CREATE TABLE "minibar_items" (
+  "id"        serial NOT NULL,
+  "hotel_id"  integer NOT NULL DEFAULT 1,
+  "code"      text NOT NULL,
+  "name"      text NOT NULL,
+  "price_eur" numeric(8,2) NOT NULL,
+  "active"    boolean NOT NULL DEFAULT true,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "minibar_items_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "minibar_items_price_eur_check" CHECK (price_eur >= (0)::numeric)
+);
+-- Create index "minibar_items_hotel_id_code_idx" to table: "minibar_items"
+CREATE UNIQUE INDEX "minibar_items_hotel_id_code_idx" ON "minibar_items" ("hotel_id", "code");
+-- Create "minibar_consumption" table (items taken from a room's minibar, billed to the reservation)
+CREATE TABLE "minibar_consumption" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" integer NOT NULL,
+  "room_id"        integer NOT NULL,
+  "item_id"        integer NOT NULL,
+  "quantity"       integer NOT NULL,
+  "unit_price_eur" numeric(8,2) NOT NULL,
+  "logged_by"      bigint NOT NULL,
+  "assignment_id"  integer NULL,
+  "logged_at"      timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "minibar_consumption_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "minibar_consumption_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "minibar_consumption_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "minibar_consumption_item_id_fkey" FOREIGN KEY ("item_id") REFERENCES "minibar_items" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "minibar_consumption_logged_by_fkey" FOREIGN KEY ("logged_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "minibar_consumption_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "minibar_consumption_quantity_check" CHECK (quantity > 0)
+);
+-- Create index "minibar_consumption_reservation_id_idx" to table: "minibar_consumption"
+CREATE INDEX "minibar_consumption_reservation_id_idx" ON "minibar_consumption" ("reservation_id");
+-- Create "compliance_templates" table (recurring safety/HACCP checks: extinguishers, emergency lights, fridge temperatures)
+CREATE TABLE "compliance_templates" (
+  "id"           serial NOT NULL,
+  "hotel_id"     integer NOT NULL DEFAULT 1,
+  "code"         text NOT NULL,
+  "title"        text NOT NULL,
+  "instructions" text NULL,
+  "frequency"    text NOT NULL,
+  "value_unit"   text NULL,
+  "value_min"    numeric(8,2) NULL,
+  "value_max"    numeric(8,2) NULL,
+  "active"       boolean NOT NULL DEFAULT true,
+  "created_at"   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "compliance_templates_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "compliance_templates_frequency_check" CHECK (frequency = ANY (ARRAY['daily'::text, 'weekly'::text, 'monthly'::text, 'quarterly'::text, 'semiannual'::text, 'yearly'::text]))
+);
+-- Create index "compliance_templates_hotel_id_code_idx" to table: "compliance_templates"
+CREATE UNIQUE INDEX "compliance_templates_hotel_id_code_idx" ON "compliance_templates" ("hotel_id", "code");
+-- Create "compliance_tasks" table (one occurrence of a compliance check and its completion record)
+CREATE TABLE "compliance_tasks" (
+  "id"           bigserial NOT NULL,
+  "hotel_id"     integer NOT NULL DEFAULT 1,
+  "template_id"  integer NOT NULL,
+  "due_date"     date NOT NULL,
+  "status"       text NOT NULL DEFAULT 'open',
+  "completed_by" bigint NULL,
+  "completed_at" timestamptz NULL,
+  "value"        numeric(8,2) NULL,
+  "ok"           boolean NULL,
+  "notes"        text NULL,
+  "created_at"   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "compliance_tasks_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "compliance_tasks_template_id_fkey" FOREIGN KEY ("template_id") REFERENCES "compliance_templates" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "compliance_tasks_completed_by_fkey" FOREIGN KEY ("completed_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "compliance_tasks_status_check" CHECK (status = ANY (ARRAY['open'::text, 'done'::text]))
+);
+-- Create index "compliance_tasks_template_id_due_date_idx" to table: "compliance_tasks"
+CREATE UNIQUE INDEX "compliance_tasks_template_id_due_date_idx" ON "compliance_tasks" ("template_id", "due_date");
+-- Create index "compliance_tasks_open_idx" to table: "compliance_tasks"
+CREATE UNIQUE INDEX "compliance_tasks_open_idx" ON "compliance_tasks" ("template_id") WHERE (status = 'open'::text);
+-- Create "temperature_logs" table (HACCP register of fridge/freezer readings; devices are compliance templates in °C)
+CREATE TABLE "temperature_logs" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "template_id" integer NOT NULL,
+  "value_c"     numeric(5,1) NOT NULL,
+  "entered"     text NULL,
+  "in_range"    boolean NOT NULL,
+  "logged_by"   bigint NOT NULL,
+  "task_id"     bigint NULL,
+  "notes"       text NULL,
+  "logged_at"   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "temperature_logs_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "temperature_logs_template_id_fkey" FOREIGN KEY ("template_id") REFERENCES "compliance_templates" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "temperature_logs_logged_by_fkey" FOREIGN KEY ("logged_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "temperature_logs_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "compliance_tasks" ("id") ON UPDATE NO ACTION ON DELETE SET NULL
+);
+-- Create index "temperature_logs_template_id_idx" to table: "temperature_logs"
+CREATE INDEX "temperature_logs_template_id_idx" ON "temperature_logs" ("template_id", "logged_at");
+-- Create "meter_readings" table (electricity/water/gas meter readings, cumulative; room_id NULL = the building's meter)
+CREATE TABLE "meter_readings" (
+  "id"        bigserial NOT NULL,
+  "hotel_id"  integer NOT NULL DEFAULT 1,
+  "room_id"   integer NULL,
+  "meter"     text NOT NULL,
+  "reading"   numeric(12,2) NOT NULL,
+  "read_on"   date NOT NULL,
+  "reset"     boolean NOT NULL DEFAULT false,
+  "notes"     text NULL,
+  "logged_by" bigint NOT NULL,
+  "logged_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "meter_readings_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "meter_readings_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "meter_readings_logged_by_fkey" FOREIGN KEY ("logged_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "meter_readings_meter_check" CHECK (meter = ANY (ARRAY['electricity'::text, 'water'::text, 'gas'::text])),
+  CONSTRAINT "meter_readings_reading_check" CHECK (reading >= 0)
+);
+-- Create index "meter_readings_meter_idx" to table: "meter_readings"
+CREATE UNIQUE INDEX "meter_readings_meter_idx" ON "meter_readings" ("hotel_id", (COALESCE(room_id, 0)), "meter", "read_on");
+-- Create "tips" table (tips and gifts a cleaner found in a room or was handed; private to the cleaner and managers)
+CREATE TABLE "tips" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "cleaner_id"  bigint NOT NULL,
+  "room_id"     integer NULL,
+  "kind"        text NOT NULL DEFAULT 'found',
+  "amount_eur"  numeric(8,2) NULL,
+  "received_on" date NOT NULL DEFAULT CURRENT_DATE,
+  "notes"       text NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "tips_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "tips_cleaner_id_fkey" FOREIGN KEY ("cleaner_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "tips_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "tips_kind_check" CHECK (kind = ANY (ARRAY['found'::text, 'handed'::text, 'gift'::text])),
+  CONSTRAINT "tips_amount_eur_check" CHECK ((amount_eur > (0)::numeric) OR ((amount_eur IS NULL) AND (kind = 'gift'::text)))
+);
+-- Create index "tips_cleaner_id_received_on_idx" to table: "tips"
+CREATE INDEX "tips_cleaner_id_received_on_idx" ON "tips" ("cleaner_id", "received_on");
+-- Create "guest_requests" table (special requests of a stay: crib, extra bed, late checkout, allergies; shown in the cleaner's brief)
+CREATE TABLE "guest_requests" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NOT NULL,
+  "kind"           text NOT NULL,
+  "details"        text NULL,
+  "requested_at"   timestamptz NULL,
+  "status"         text NOT NULL DEFAULT 'open',
+  "created_by"     bigint NOT NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  "approved_by"    bigint NULL,
+  "approved_at"    timestamptz NULL,
+  "completed_by"   bigint NULL,
+  "completed_at"   timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "guest_requests_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_requests_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "guest_requests_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_requests_approved_by_fkey" FOREIGN KEY ("approved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_requests_completed_by_fkey" FOREIGN KEY ("completed_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_requests_kind_check" CHECK (kind = ANY (ARRAY['crib'::text, 'extra_bed'::text, 'late_checkout'::text, 'early_checkin'::text, 'allergy'::text, 'towels'::text, 'other'::text])),
+  CONSTRAINT "guest_requests_status_check" CHECK (status = ANY (ARRAY['pending'::text, 'open'::text, 'done'::text, 'cancelled'::text, 'rejected'::text])),
+  CONSTRAINT "guest_requests_requested_at_check" CHECK (requested_at IS NULL OR kind = ANY (ARRAY['late_checkout'::text, 'early_checkin'::text]))
+);
+-- Create index "guest_requests_reservation_id_idx" to table: "guest_requests"
+CREATE INDEX "guest_requests_reservation_id_idx" ON "guest_requests" ("reservation_id");
+-- Create "incidents" table (guest complaints and incidents, with the staff involved and how they were resolved)
+CREATE TABLE "incidents" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "kind"        text NOT NULL DEFAULT 'complaint',
+  "severity"    text NOT NULL DEFAULT 'normal',
+  "room_id"     integer NULL,
+  "guest_name"  text NULL,
+  "description" text NOT NULL,
+  "staff_ids"   bigint[] NOT NULL DEFAULT '{}',
+  "status"      text NOT NULL DEFAULT 'open',
+  "reported_by" bigint NOT NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  "resolution"  text NULL,
+  "resolved_by" bigint NULL,
+  "resolved_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "incidents_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "incidents_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "incidents_reported_by_fkey" FOREIGN KEY ("reported_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "incidents_resolved_by_fkey" FOREIGN KEY ("resolved_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "incidents_kind_check" CHECK (kind = ANY (ARRAY['complaint'::text, 'incident'::text])),
+  CONSTRAINT "incidents_severity_check" CHECK (severity = ANY (ARRAY['low'::text, 'normal'::text, 'high'::text, 'urgent'::text])),
+  CONSTRAINT "incidents_status_check" CHECK (status = ANY (ARRAY['open'::text, 'resolved'::text]))
+);
+-- Create index "incidents_created_at_idx" to table: "incidents"
+CREATE INDEX "incidents_created_at_idx" ON "incidents" ("hotel_id", "created_at");
+-- Create "shifts" table (hours of the morning, afternoon and evening shift at each property)
+CREATE TABLE "shifts" (
+  "id"        serial NOT NULL,
+  "hotel_id"  integer NOT NULL DEFAULT 1,
+  "name"      text NOT NULL,
+  "starts_at" time NOT NULL,
+  "ends_at"   time NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "shifts_hotel_id_name_key" UNIQUE ("hotel_id", "name"),
+  CONSTRAINT "shifts_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "shifts_name_check" CHECK (name = ANY (ARRAY['morning'::text, 'afternoon'::text, 'evening'::text]))
+);
+-- Create "shift_assignments" table (the staff schedule: who works which shift on which day)
+CREATE TABLE "shift_assignments" (
+  "id"         bigserial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "user_id"    bigint NOT NULL,
+  "date"       date NOT NULL,
+  "shift_id"   integer NOT NULL,
+  "created_by" bigint NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "shift_assignments_user_id_date_key" UNIQUE ("user_id", "date"),
+  CONSTRAINT "shift_assignments_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "shift_assignments_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "shift_assignments_shift_id_fkey" FOREIGN KEY ("shift_id") REFERENCES "shifts" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "shift_assignments_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL
+);
+-- Create index "shift_assignments_hotel_id_date_idx" to table: "shift_assignments"
+CREATE INDEX "shift_assignments_hotel_id_date_idx" ON "shift_assignments" ("hotel_id", "date");
+-- Create "work_sessions" table (clock-in / clock-out; one open session per person)
+CREATE TABLE "work_sessions" (
+  "id"         bigserial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "user_id"    bigint NOT NULL,
+  "started_at" timestamptz NOT NULL DEFAULT now(),
+  "ended_at"   timestamptz NULL,
+  "note"       text NULL,
+  "edited_by"  bigint NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "work_sessions_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "work_sessions_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "work_sessions_edited_by_fkey" FOREIGN KEY ("edited_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "work_sessions_times_check" CHECK (ended_at > started_at)
+);
+-- Create index "work_sessions_open_idx" to table: "work_sessions"
+CREATE UNIQUE INDEX "work_sessions_open_idx" ON "work_sessions" ("user_id") WHERE (ended_at IS NULL);
+-- Create index "work_sessions_started_at_idx" to table: "work_sessions"
+CREATE INDEX "work_sessions_started_at_idx" ON "work_sessions" ("hotel_id", "started_at");
+-- Create "keys" table (master keys and keycards; held_by is who has it now, NULL = on the board)
+CREATE TABLE "keys" (
+  "id"         serial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "label"      text NOT NULL,
+  "kind"       text NOT NULL DEFAULT 'master',
+  "room_id"    integer NULL,
+  "held_by"    bigint NULL,
+  "taken_at"   timestamptz NULL,
+  "active"     boolean NOT NULL DEFAULT true,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "keys_hotel_id_label_key" UNIQUE ("hotel_id", "label"),
+  CONSTRAINT "keys_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "keys_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "keys_held_by_fkey" FOREIGN KEY ("held_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "keys_kind_check" CHECK (kind = ANY (ARRAY['master'::text, 'keycard'::text, 'room'::text, 'other'::text])),
+  CONSTRAINT "keys_taken_check" CHECK ((held_by IS NULL) OR (taken_at IS NOT NULL))
+);
+-- Create index "keys_held_by_idx" to table: "keys"
+CREATE INDEX "keys_held_by_idx" ON "keys" ("held_by") WHERE (held_by IS NOT NULL);
+-- Create "room_blocks" table (out-of-service periods; from_date..to_date inclusive, lifted blocks are kept as history)
+CREATE TABLE "room_blocks" (
+  "id"         bigserial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "room_id"    integer NOT NULL,
+  "from_date"  date NOT NULL,
+  "to_date"    date NOT NULL,
+  "reason"     text NOT NULL,
+  "created_by" bigint NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "lifted_at"  timestamptz NULL,
+  "lifted_by"  bigint NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "room_blocks_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "room_blocks_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "room_blocks_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "room_blocks_lifted_by_fkey" FOREIGN KEY ("lifted_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "room_blocks_dates_check" CHECK (to_date >= from_date)
+);
+-- Create index "room_blocks_room_id_idx" to table: "room_blocks"
+CREATE INDEX "room_blocks_room_id_idx" ON "room_blocks" ("room_id", "from_date") WHERE (lifted_at IS NULL);
+-- Create "dnd_log" table (do-not-disturb signs and refused service, per room per day; assignment_id is the skipped task, rescheduled_id the one that replaces it)
+CREATE TABLE "dnd_log" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "room_id"        integer NOT NULL,
+  "date"           date NOT NULL,
+  "kind"           text NOT NULL DEFAULT 'refused',
+  "logged_by"      bigint NULL,
+  "logged_at"      timestamptz NOT NULL DEFAULT now(),
+  "assignment_id"  integer NULL,
+  "rescheduled_id" integer NULL,
+  "notes"          text NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "dnd_log_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "dnd_log_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "dnd_log_logged_by_fkey" FOREIGN KEY ("logged_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "dnd_log_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "dnd_log_rescheduled_id_fkey" FOREIGN KEY ("rescheduled_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "dnd_log_kind_check" CHECK (kind = ANY (ARRAY['dnd'::text, 'refused'::text]))
+);
+-- Create index "dnd_log_date_idx" to table: "dnd_log"
+CREATE INDEX "dnd_log_date_idx" ON "dnd_log" ("date", "room_id");
+-- Create "recurring_tasks" table (recurrence rules, e.g. deep clean of a room every first Monday, turned into assignments daily)
+CREATE TABLE "recurring_tasks" (
+  "id"             serial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "room_id"        integer NOT NULL,
+  "type"           text NOT NULL DEFAULT 'deep_clean',
+  "title"          text NOT NULL DEFAULT 'Pulizia a fondo',
+  "notes"          text NULL,
+  "frequency"      text NOT NULL,
+  "every"          integer NOT NULL DEFAULT 1,
+  "weekday"        smallint NULL,
+  "week_of_month"  smallint NULL,
+  "day_of_month"   smallint NULL,
+  "starts_on"      date NOT NULL DEFAULT CURRENT_DATE,
+  "cleaner_id"     bigint NULL,
+  "shift"          text NULL,
+  "active"         boolean NOT NULL DEFAULT true,
+  "last_generated" date NULL,
+  "created_by"     bigint NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "recurring_tasks_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "recurring_tasks_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "recurring_tasks_cleaner_id_fkey" FOREIGN KEY ("cleaner_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "recurring_tasks_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "recurring_tasks_type_check" CHECK (type <> ALL (ARRAY['checkout'::text, 'stayover'::text])),
+  CONSTRAINT "recurring_tasks_frequency_check" CHECK (frequency = ANY (ARRAY['daily'::text, 'weekly'::text, 'monthly'::text])),
+  CONSTRAINT "recurring_tasks_every_check" CHECK (every >= 1),
+  CONSTRAINT "recurring_tasks_weekday_check" CHECK ((weekday >= 1) AND (weekday <= 7)),
+  CONSTRAINT "recurring_tasks_week_of_month_check" CHECK ((week_of_month = -1) OR ((week_of_month >= 1) AND (week_of_month <= 4))),
+  CONSTRAINT "recurring_tasks_day_of_month_check" CHECK ((day_of_month >= 1) AND (day_of_month <= 31)),
+  CONSTRAINT "recurring_tasks_shift_check" CHECK (shift = ANY (ARRAY['morning'::text, 'afternoon'::text, 'evening'::text])),
+  CONSTRAINT "recurring_tasks_rule_check" CHECK (((frequency = 'daily'::text) AND (weekday IS NULL) AND (week_of_month IS NULL) AND (day_of_month IS NULL)) OR ((frequency = 'weekly'::text) AND (weekday IS NOT NULL) AND (week_of_month IS NULL) AND (day_of_month IS NULL)) OR ((frequency = 'monthly'::text) AND (((day_of_month IS NOT NULL) AND (weekday IS NULL) AND (week_of_month IS NULL)) OR ((day_of_month IS NULL) AND (weekday IS NOT NULL) AND (week_of_month IS NOT NULL)))))
+);
+-- Create index "recurring_tasks_room_id_idx" to table: "recurring_tasks"
+CREATE INDEX "recurring_tasks_room_id_idx" ON "recurring_tasks" ("room_id");
+-- Create "hotel_settings" table (per-property settings set from the chat; unset keys fall back to env)
+CREATE TABLE "hotel_settings" (
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "key"        text NOT NULL,
+  "value"      text NOT NULL,
+  "updated_by" bigint NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("hotel_id", "key"),
+  CONSTRAINT "hotel_settings_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "hotel_settings_updated_by_fkey" FOREIGN KEY ("updated_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "hotel_settings_key_check" CHECK (key = ANY (ARRAY['evening_digest_time'::text, 'kitchen_digest_time'::text]))
+);
+-- Create "hotel_info" table (practical information for guests: directions, check-in, parking, WiFi)
+CREATE TABLE "hotel_info" (
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "topic"      text NOT NULL,
+  "body"       text NOT NULL,
+  "updated_by" bigint NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("hotel_id", "topic"),
+  CONSTRAINT "hotel_info_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "hotel_info_updated_by_fkey" FOREIGN KEY ("updated_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "hotel_info_topic_check" CHECK (topic = ANY (ARRAY['directions'::text, 'checkin'::text, 'parking'::text, 'wifi'::text]))
+);
+-- Create "relay_messages" table (questions exchanged with the owner's other hotel instances; bot only)
+CREATE TABLE "relay_messages" (
+  "id"          bigserial NOT NULL,
+  "direction"   text NOT NULL,
+  "peer"        text NOT NULL,
+  "remote_id"   bigint NULL,
+  "asked_by"    bigint NULL,
+  "question"    text NOT NULL,
+  "answer"      text NULL,
+  "answered_by" bigint NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  "answered_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "relay_messages_peer_remote_id_key" UNIQUE ("peer", "direction", "remote_id"),
+  CONSTRAINT "relay_messages_asked_by_fkey" FOREIGN KEY ("asked_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "relay_messages_answered_by_fkey" FOREIGN KEY ("answered_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "relay_messages_direction_check" CHECK (direction = ANY (ARRAY['out'::text, 'in'::text])),
+  CONSTRAINT "relay_messages_in_check" CHECK ((direction = 'out'::text) OR (remote_id IS NOT NULL))
+);
+-- Create "checklists" table (inspection template per room type; NULL room_type_id = every other room)
+CREATE TABLE "checklists" (
+  "id"           serial NOT NULL,
+  "hotel_id"     integer NOT NULL DEFAULT 1,
+  "room_type_id" integer NULL,
+  "required"     boolean NOT NULL DEFAULT true,
+  "created_at"   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "checklists_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "checklists_room_type_id_fkey" FOREIGN KEY ("room_type_id") REFERENCES "room_types" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create index "checklists_hotel_id_room_type_id_key" to table: "checklists"
+CREATE UNIQUE INDEX "checklists_hotel_id_room_type_id_key" ON "checklists" ("hotel_id", (COALESCE(room_type_id, 0)));
+-- Create "checklist_items" table
+CREATE TABLE "checklist_items" (
+  "id"           bigserial NOT NULL,
+  "checklist_id" integer NOT NULL,
+  "position"     integer NOT NULL,
+  "label"        text NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "checklist_items_checklist_id_position_key" UNIQUE ("checklist_id", "position"),
+  CONSTRAINT "checklist_items_checklist_id_fkey" FOREIGN KEY ("checklist_id") REFERENCES "checklists" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create "room_inspections" table (a manager's pass over a cleaned room, against its checklist)
+CREATE TABLE "room_inspections" (
+  "id"            bigserial NOT NULL,
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "room_id"       integer NOT NULL,
+  "assignment_id" integer NULL,
+  "inspector_id"  bigint NOT NULL,
+  "passed"        boolean NOT NULL,
+  "failed_items"  text[] NOT NULL DEFAULT '{}',
+  "notes"         text NULL,
+  "created_at"    timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "room_inspections_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "room_inspections_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "room_inspections_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "room_inspections_inspector_id_fkey" FOREIGN KEY ("inspector_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "room_inspections_room_id_idx" to table: "room_inspections"
+CREATE INDEX "room_inspections_room_id_idx" ON "room_inspections" ("room_id", "created_at");
+-- Create "reviews" table (a manager's 1–5 score of a completed cleaning)
+CREATE TABLE "reviews" (
+  "id"            bigserial NOT NULL,
+  "hotel_id"      integer NOT NULL DEFAULT 1,
+  "assignment_id" integer NOT NULL,
+  "reviewer_id"   bigint NOT NULL,
+  "score"         smallint NOT NULL,
+  "notes"         text NULL,
+  "created_at"    timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "reviews_assignment_id_key" UNIQUE ("assignment_id"),
+  CONSTRAINT "reviews_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reviews_assignment_id_fkey" FOREIGN KEY ("assignment_id") REFERENCES "assignments" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "reviews_reviewer_id_fkey" FOREIGN KEY ("reviewer_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "reviews_score_check" CHECK ((score >= 1) AND (score <= 5))
+);
+-- Create "cleaning_standards" table (per-room effort of each cleaning kind, replacing the room type estimate in the daily plan)
+CREATE TABLE "cleaning_standards" (
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "room_id"    integer NOT NULL,
+  "kind"       text NOT NULL,
+  "minutes"    integer NOT NULL,
+  "notes"      text NULL,
+  "updated_by" bigint NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("room_id", "kind"),
+  CONSTRAINT "cleaning_standards_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "cleaning_standards_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "cleaning_standards_updated_by_fkey" FOREIGN KEY ("updated_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "cleaning_standards_kind_check" CHECK (kind = ANY (ARRAY['checkout'::text, 'stayover'::text, 'deep_clean'::text])),
+  CONSTRAINT "cleaning_standards_minutes_check" CHECK ((minutes > 0) AND (minutes <= 480))
+);
+-- Create "lost_found" table
+CREATE TABLE "lost_found" (
+  "id"          bigserial NOT NULL,
+  "hotel_id"    integer NOT NULL DEFAULT 1,
+  "room_id"     integer NULL,
+  "found_by"    bigint NOT NULL,
+  "found_on"    date NOT NULL DEFAULT CURRENT_DATE,
+  "description" text NOT NULL,
+  "stored_at"   text NULL,
+  "photo"       text NULL,
+  "created_at"  timestamptz NOT NULL DEFAULT now(),
+  "returned_at" timestamptz NULL,
+  "returned_to" text NULL,
+  "returned_by" bigint NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "lost_found_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "lost_found_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE SET NULL,
+  CONSTRAINT "lost_found_found_by_fkey" FOREIGN KEY ("found_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "lost_found_returned_by_fkey" FOREIGN KEY ("returned_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL
+);
+-- Create "knowledge_base" table (operating notes: chemical safety sheets, procedures…)
+CREATE TABLE "knowledge_base" (
+  "id"         bigserial NOT NULL,
+  "hotel_id"   integer NOT NULL DEFAULT 1,
+  "category"   text NOT NULL,
+  "title"      text NOT NULL,
+  "body"       text NOT NULL,
+  "tags"       text[] NOT NULL DEFAULT '{}',
+  "updated_by" bigint NULL,
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "knowledge_base_hotel_id_category_title_key" UNIQUE ("hotel_id", "category", "title"),
+  CONSTRAINT "knowledge_base_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "knowledge_base_updated_by_fkey" FOREIGN KEY ("updated_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE SET NULL
+);
+-- Create "guest_documents" table (internal: Alloggiati Web data, purged after checkout + retention)
+CREATE TABLE "guest_documents" (
+  "id"             bigserial NOT NULL,
+  "hotel_id"       integer NOT NULL DEFAULT 1,
+  "reservation_id" bigint NOT NULL,
+  "guest_type"     smallint NOT NULL,
+  "surname"        text NOT NULL,
+  "given_name"     text NOT NULL,
+  "sex"            text NOT NULL,
+  "birth_date"     date NOT NULL,
+  "birth_comune"   text NULL,
+  "birth_province" text NULL,
+  "birth_country"  text NOT NULL,
+  "citizenship"    text NOT NULL,
+  "doc_type"       text NULL,
+  "doc_number"     text NULL,
+  "doc_issued_at"  text NULL,
+  "created_by"     bigint NOT NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  "reported_at"    timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "guest_documents_hotel_id_fkey" FOREIGN KEY ("hotel_id") REFERENCES "hotels" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_documents_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "guest_documents_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "guest_documents_guest_type_check" CHECK (guest_type >= 16 AND guest_type <= 20),
+  CONSTRAINT "guest_documents_sex_check" CHECK (sex = ANY (ARRAY['M'::text, 'F'::text])),
+  CONSTRAINT "guest_documents_doc_check" CHECK (guest_type >= 19 OR (doc_type IS NOT NULL AND doc_number IS NOT NULL AND doc_issued_at IS NOT NULL))
+);
 -- Create "user_credentials" table
 CREATE TABLE "user_credentials" (
   "telegram_id" bigint NOT NULL,
@@ -110,3 +1298,24 @@ CREATE TABLE "user_credentials" (
   PRIMARY KEY ("telegram_id"),
   CONSTRAINT "user_credentials_telegram_id_fkey" FOREIGN KEY ("telegram_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE
 );
+-- Create "subscriptions" table (a user follows a room or a reservation and hears about changes made by others)
+CREATE TABLE "subscriptions" (
+  "id"             serial NOT NULL,
+  "user_id"        bigint NOT NULL,
+  "room_id"        integer NULL,
+  "reservation_id" bigint NULL,
+  "created_at"     timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "subscriptions_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("telegram_id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "subscriptions_room_id_fkey" FOREIGN KEY ("room_id") REFERENCES "rooms" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "subscriptions_reservation_id_fkey" FOREIGN KEY ("reservation_id") REFERENCES "reservations" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "subscriptions_target_check" CHECK ((room_id IS NULL) <> (reservation_id IS NULL))
+);
+-- Create index "subscriptions_user_room_key" to table: "subscriptions"
+CREATE UNIQUE INDEX "subscriptions_user_room_key" ON "subscriptions" ("user_id", "room_id") WHERE (room_id IS NOT NULL);
+-- Create index "subscriptions_user_reservation_key" to table: "subscriptions"
+CREATE UNIQUE INDEX "subscriptions_user_reservation_key" ON "subscriptions" ("user_id", "reservation_id") WHERE (reservation_id IS NOT NULL);
+-- Create index "subscriptions_room_id_idx" to table: "subscriptions"
+CREATE INDEX "subscriptions_room_id_idx" ON "subscriptions" ("room_id") WHERE (room_id IS NOT NULL);
+-- Create index "subscriptions_reservation_id_idx" to table: "subscriptions"
+CREATE INDEX "subscriptions_reservation_id_idx" ON "subscriptions" ("reservation_id") WHERE (reservation_id IS NOT NULL);
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Telegram send failures are not all alike. A user who blocked the bot (or
+// deleted their account) and a chat Telegram does not know will refuse every
+// message until the user writes again; a flood wait (429) only asks to slow
+// down for a few seconds. deliver, through which newBot, sendKeyboard,
+// sendDocument and the agent's replies (routedMessenger) send:
+//
+//   - marks users refusing messages in users.unreachable_at/_reason and,
+//     from then on, fails their sends at once without calling Telegram;
+//   - waits out a flood wait of up to floodMaxWait and tries once more;
+//   - treats anything else (network, malformed HTML) as before.
+//
+// What could not be delivered is still kept for the catch-up digest
+// (missed.go). When a marked user comes back (any update: a message, a
+// button) the mark is cleared, the digest is sent at once and the managers
+// are told they can be reached again.
+
+// sendFailure is the kind of a Telegram send error.
+type sendFailure string
+
+const (
+	failureOther    sendFailure = ""
+	failureBlocked  sendFailure = "blocked"        // 403: bot blocked, user deactivated, never started the bot
+	failureNotFound sendFailure = "chat_not_found" // 400: unknown chat
+	failureFlood    sendFailure = "flood"          // 429: retry after a wait
+)
+
+// floodMaxWait is the longest flood wait deliver sits out; a longer one
+// fails the send like any other error.
+const floodMaxWait = 30 * time.Second
+
+// errUnreachable is returned for sends to a user marked unreachable.
+var errUnreachable = errors.New("user unreachable")
+
+var retryAfterRe = regexp.MustCompile(`retry after (\d+)`)
+
+// classifySendError tells the kind of err from the Bot API description
+// (both the SDK and botAPI put it in the error text) and, for flood waits,
+// how long Telegram asks to wait.
+func classifySendError(err error) (sendFailure, time.Duration) {
+	if err == nil {
+		return failureOther, 0
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Too Many Requests"):
+		wait := time.Second
+		if m := retryAfterRe.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			wait = time.Duration(n) * time.Second
+		}
+		return failureFlood, wait
+	case strings.Contains(msg, "Forbidden: bot was blocked"),
+		strings.Contains(msg, "Forbidden: user is deactivated"),
+		strings.Contains(msg, "Forbidden: bot can't initiate conversation"):
+		return failureBlocked, 0
+	case strings.Contains(msg, "chat not found"):
+		return failureNotFound, 0
+	}
+	return failureOther, 0
+}
+
+// reachability keeps the users Telegram refuses to deliver to.
+type reachability struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+
+	mu          sync.Mutex
+	unreachable map[int64]sendFailure
+}
+
+// reach is set once at startup (main.go) next to missed; nil sends to
+// everyone as before.
+var reach *reachability
+
+func newReachability(ctx context.Context, adminPool *pgxpool.Pool, botToken string) *reachability {
+	r := &reachability{adminPool: adminPool, botToken: botToken, unreachable: make(map[int64]sendFailure)}
+	rows, err := adminPool.Query(ctx,
+		`SELECT telegram_id, unreachable_reason FROM users WHERE unreachable_at IS NOT NULL`)
+	if err != nil {
+		log.Printf("delivery: load unreachable users: %v", err)
+		return r
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var reason string
+		if rows.Scan(&id, &reason) == nil {
+			r.unreachable[id] = sendFailure(reason)
+		}
+	}
+	if len(r.unreachable) > 0 {
+		log.Printf("delivery: %d users unreachable until they write again", len(r.unreachable))
+	}
+	return r
+}
+
+// check returns errUnreachable for a user marked unreachable.
+func (r *reachability) check(chatID int64) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	why, ok := r.unreachable[chatID]
+	r.mu.Unlock()
+	if ok {
+		return fmt.Errorf("%w (%s)", errUnreachable, why)
+	}
+	return nil
+}
+
+// failed marks the user unreachable when err says Telegram will keep
+// refusing them. Group chats have no users row and are never marked.
+func (r *reachability) failed(ctx context.Context, chatID int64, kind sendFailure, err error) {
+	if r == nil || (kind != failureBlocked && kind != failureNotFound) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	tag, dbErr := r.adminPool.Exec(ctx,
+		`UPDATE users SET unreachable_at = now(), unreachable_reason = $2 WHERE telegram_id = $1`,
+		chatID, string(kind))
+	if dbErr != nil {
+		log.Printf("delivery: mark %d unreachable: %v", chatID, dbErr)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.unreachable[chatID] = kind
+	r.mu.Unlock()
+	log.Printf("delivery: user %d unreachable (%s: %v), no more sends until they write", chatID, kind, err)
+}
+
+// Seen implements the routedMessenger ObserveAll observer: any update from
+// a user proves they are reachable again. It runs before the Observe
+// observers, so the digest goes out here rather than in missed.Inbound.
+func (r *reachability) Seen(ctx context.Context, u agent.Update) {
+	r.mu.Lock()
+	_, marked := r.unreachable[u.UserID]
+	delete(r.unreachable, u.UserID)
+	r.mu.Unlock()
+	if !marked {
+		return
+	}
+	var name, role, reason string
+	var since time.Time
+	var hotelID int
+	err := r.adminPool.QueryRow(ctx,
+		`UPDATE users u SET unreachable_at = NULL, unreachable_reason = NULL
+		 FROM users old
+		 WHERE u.telegram_id = $1 AND old.telegram_id = u.telegram_id AND old.unreachable_at IS NOT NULL
+		 RETURNING COALESCE(u.name, u.telegram_id::text), u.role, u.hotel_id, old.unreachable_at, old.unreachable_reason`, u.UserID,
+	).Scan(&name, &role, &hotelID, &since, &reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("delivery: clear %d: %v", u.UserID, err)
+		return
+	}
+	log.Printf("delivery: user %d reachable again", u.UserID)
+	delivered := missed.Deliver(ctx, u.UserID)
+	r.tellManagers(ctx, hotelID, u.UserID, name, Role(role), sendFailure(reason), since, delivered)
+}
+
+// tellManagers lets the managers of hotelID know userID can be reached again.
+func (r *reachability) tellManagers(ctx context.Context, hotelID int, userID int64, name string, role Role, reason sendFailure, since time.Time, delivered int) {
+	who := name
+	if role == RoleGuest {
+		who = "l'ospite " + name
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📶 %s è di nuovo raggiungibile", who)
+	switch reason {
+	case failureBlocked:
+		fmt.Fprintf(&sb, ": aveva bloccato il bot dal %s", since.In(romeLocation()).Format("02/01 15:04"))
+	case failureNotFound:
+		fmt.Fprintf(&sb, ": la chat non risultava dal %s", since.In(romeLocation()).Format("02/01 15:04"))
+	}
+	sb.WriteString(".")
+	if delivered > 0 {
+		fmt.Fprintf(&sb, " Ha appena ricevuto il riepilogo dei %d messaggi persi.", delivered)
+	}
+	managers, err := managerIDs(ctx, r.adminPool, hotelID)
+	if err != nil {
+		log.Printf("delivery: %v", err)
+		return
+	}
+	tg := newBot(r.botToken)
+	for _, m := range managers {
+		if m == userID {
+			continue
+		}
+		if err := tg.Send(ctx, m, sb.String()); err != nil {
+			log.Printf("delivery: tell manager %d: %v", m, err)
+		}
+	}
+}
+
+// deliver runs send towards chatID unless the user is unreachable, sits out
+// a short flood wait once, and marks the user when Telegram refuses them.
+func deliver(ctx context.Context, chatID int64, send func() error) error {
+	if err := reach.check(chatID); err != nil {
+		return err
+	}
+	err := send()
+	kind, wait := classifySendError(err)
+	if kind == failureFlood && wait <= floodMaxWait {
+		log.Printf("delivery: flood wait %s for chat %d", wait, chatID)
+		select {
+		case <-time.After(wait):
+			err = send()
+			kind, _ = classifySendError(err)
+		case <-ctx.Done():
+			return err
+		}
+	}
+	reach.failed(ctx, chatID, kind, err)
+	return err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// startEveningDigest launches a background goroutine that sends every manager,
+// once a day, one message with what tomorrow looks like: arrivals, departures
+// and stayovers, today's assignments still not done, open maintenance
+// tickets, the day's do-not-disturb signs and refused service (dnd.go)
+// and keys not returned; on Friday also each cleaner's hours of the week (hours.go). Unlike
+// the heartbeat it is fully determined by the data, so it goes straight to
+// Telegram without an LLM turn.
+//
+// Each property's digest goes out at its own evening_digest_time setting
+// (configure_hotel), else env:
+//
+//	EVENING_DIGEST_TIME=20:00   daily send time, Europe/Rome; "off" disables
+func startEveningDigest(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	loc := romeLocation()
+
+	go eachHotelDaily(ctx, pool, "evening_digest_time", func(hotelID int, next time.Time) {
+		today := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc)
+		text, err := eveningDigest(ctx, pool, hotelID, today)
+		if err != nil {
+			log.Printf("evening digest: hotel %d: %v", hotelID, err)
+			return
+		}
+		managers, err := managerIDs(ctx, pool, hotelID)
+		if err != nil {
+			log.Printf("evening digest: %v", err)
+			return
+		}
+		tg := newBot(botToken)
+		for _, id := range managers {
+			if err := tg.SendHTML(ctx, id, text); err != nil {
+				log.Printf("evening digest: send to %d: %v", id, err)
+			}
+		}
+		log.Printf("evening digest of hotel %d sent to %d manager(s)", hotelID, len(managers))
+	})
+}
+
+// eveningDigest builds the digest of property hotelID sent on the evening of
+// today.
+func eveningDigest(ctx context.Context, pool *pgxpool.Pool, hotelID int, today time.Time) (string, error) {
+	tomorrow := today.AddDate(0, 0, 1)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🌙 <b>Riepilogo per %s %s</b>\n", strings.ToLower(italianWeekday(tomorrow.Weekday())), tomorrow.Format("02/01"))
+
+	arrivals, err := digestLines(ctx, pool,
+		`SELECT r.name, COALESCE(res.guest_name, 'ospite'), res.guests,
+		        to_char(res.checkin_at AT TIME ZONE 'Europe/Rome', 'HH24:MI')
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.hotel_id = $2 AND res.status = 'confirmed' AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1
+		 ORDER BY res.checkin_at, r.name`,
+		func(room, guest string, guests int, at string) string {
+			return fmt.Sprintf("• %s — %s, %d pers., ore %s", room, guest, guests, at)
+		}, tomorrow, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("arrivals: %w", err)
+	}
+	departures, err := digestLines(ctx, pool,
+		`SELECT r.name, COALESCE(res.guest_name, 'ospite'), res.guests,
+		        to_char(res.checkout_at AT TIME ZONE 'Europe/Rome', 'HH24:MI')
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.hotel_id = $2 AND res.status = 'confirmed' AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date = $1
+		 ORDER BY res.checkout_at, r.name`,
+		func(room, guest string, guests int, at string) string {
+			return fmt.Sprintf("• %s — %s, entro le %s", room, guest, at)
+		}, tomorrow, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("departures: %w", err)
+	}
+	stayovers, err := digestLines(ctx, pool,
+		`SELECT r.name, COALESCE(res.guest_name, 'ospite'), res.guests, ''
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.hotel_id = $2 AND res.status = 'confirmed'
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date < $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date > $1
+		 ORDER BY r.floor, r.name`,
+		func(room, guest string, guests int, _ string) string {
+			return room
+		}, tomorrow, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("stayovers: %w", err)
+	}
+	unfinished, err := digestLines(ctx, pool,
+		`SELECT r.name, COALESCE(u.name, a.cleaner_id::text), 0, a.status
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 WHERE a.hotel_id = $2 AND a.date = $1 AND a.status IN ('pending', 'in_progress')
+		 ORDER BY r.floor, r.name`,
+		func(room, cleaner string, _ int, status string) string {
+			return fmt.Sprintf("• %s — %s (%s)", room, cleaner, status)
+		}, today, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("assignments: %w", err)
+	}
+	tickets, err := digestLines(ctx, pool,
+		`SELECT COALESCE(r.name, '—'), t.description, t.id::int, t.severity
+		 FROM maintenance_tickets t LEFT JOIN rooms r ON r.id = t.room_id
+		 WHERE t.hotel_id = $1 AND t.status <> 'closed'
+		 ORDER BY array_position(ARRAY['urgent', 'high', 'normal', 'low'], t.severity), t.created_at`,
+		func(room, description string, id int, severity string) string {
+			return fmt.Sprintf("• #%d %s, camera %s: %s", id, severity, room, description)
+		}, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("tickets: %w", err)
+	}
+	dnd, err := dndDigestLines(ctx, pool, hotelID, today)
+	if err != nil {
+		return "", fmt.Errorf("dnd: %w", err)
+	}
+	keys, err := digestLines(ctx, pool,
+		`SELECT k.label, COALESCE(u.name, k.held_by::text), 0,
+		        to_char(k.taken_at AT TIME ZONE 'Europe/Rome', 'DD/MM HH24:MI')
+		 FROM keys k JOIN users u ON u.telegram_id = k.held_by
+		 WHERE k.hotel_id = $1
+		 ORDER BY k.taken_at`,
+		func(label, holder string, _ int, at string) string {
+			return fmt.Sprintf("• %s — %s, presa il %s", label, holder, at)
+		}, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("keys: %w", err)
+	}
+
+	section := func(title string, lines []string, none string) {
+		fmt.Fprintf(&sb, "\n<b>%s (%d)</b>\n", title, len(lines))
+		if len(lines) == 0 {
+			sb.WriteString(none + "\n")
+			return
+		}
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	section("🛬 Arrivi", arrivals, "Nessun arrivo.")
+	section("🛫 Partenze", departures, "Nessuna partenza.")
+	fmt.Fprintf(&sb, "\n<b>🛏 Fermate (%d)</b>\n", len(stayovers))
+	if len(stayovers) == 0 {
+		sb.WriteString("Nessuna.\n")
+	} else {
+		sb.WriteString("Camere " + strings.Join(stayovers, ", ") + "\n")
+	}
+	section("🧹 Assegnazioni di oggi non completate", unfinished, "Tutte completate.")
+	section("🔧 Ticket di manutenzione aperti", tickets, "Nessun ticket aperto.")
+	if len(dnd) > 0 {
+		section("🚪 Non disturbare / servizio rifiutato oggi", dnd, "")
+	}
+	if len(keys) > 0 {
+		section("🔑 Chiavi non restituite", keys, "")
+	}
+
+	// Friday: the week's hours so far, before the weekend shifts are planned.
+	if today.Weekday() == time.Friday {
+		hours, err := weekHours(ctx, pool, weekStart(today), hotelID)
+		if err != nil {
+			return "", fmt.Errorf("hours: %w", err)
+		}
+		var lines []string
+		for _, h := range hours {
+			lines = append(lines, "• "+htmlpkg.EscapeString(h.String()))
+		}
+		section("⏱ Ore della settimana", lines, "Nessun addetto alle pulizie.")
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// digestLines runs a query returning (text, text, int, text) rows and
+// formats each with line, HTML-escaping the text columns.
+func digestLines(ctx context.Context, pool *pgxpool.Pool, query string,
+	line func(a, b string, n int, c string) string, args ...any) ([]string, error) {
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var a, b, c string
+		var n int
+		if err := rows.Scan(&a, &b, &n, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, line(htmlpkg.EscapeString(a), htmlpkg.EscapeString(oneLine(b)), n, htmlpkg.EscapeString(c)))
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlpkg "html"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Do-not-disturb and refused service. When a cleaner finds the sign on the
+// door or the guest turns the service down, log_dnd records it in dnd_log,
+// skips the assignment and reschedules it for the next shift of the day (a
+// stayover after the evening shift moves to tomorrow morning, if the guest
+// is still in). The evening digest lists the day's entries, with how many
+// days of the stay had one (dndDigestLines).
+
+// dndStreakWarn is the number of days of a stay with an entry from which the
+// digest flags the room: the guest may need a word from the manager.
+const dndStreakWarn = 3
+
+// dndKinds are the values of dnd_log.kind, with their icon and label.
+var dndKinds = map[string]struct{ icon, label string }{
+	"dnd":     {"🚪", "cartello non disturbare"},
+	"refused": {"🙅", "servizio rifiutato dall'ospite"},
+}
+
+// shiftOrder is the order of the shifts in a day.
+var shiftOrder = []string{"morning", "afternoon", "evening"}
+
+// ── log_dnd ──────────────────────────────────────────────────────────────────
+
+type logDNDTool struct{}
+
+func (t *logDNDTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_dnd",
+		Description: "Registra che una camera di oggi non si può pulire: cartello 'non disturbare' (kind=dnd) o " +
+			"servizio rifiutato dall'ospite (kind=refused). La propria assegnazione viene saltata e riprogrammata al " +
+			"turno successivo (dopo la sera, la fermata passa a domattina se l'ospite resta). Il manager lo vede nel " +
+			"riepilogo serale.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera"},
+				"assignment_id": {"type": "integer", "description": "In alternativa: assegnazione da saltare"},
+				"kind": {"type": "string", "enum": ["dnd", "refused"], "description": "dnd = cartello non disturbare, refused = l'ospite ha rifiutato il servizio (default)"},
+				"notes": {"type": "string", "description": "Note, es. 'ripassare dopo le 15'"}
+			}
+		}`),
+	}
+}
+
+func (t *logDNDTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		taskArgs
+		Kind string `json:"kind"`
+	}
+	if err := in.parse(args); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Kind == "" {
+		in.Kind = "refused"
+	}
+	kind, ok := dndKinds[in.Kind]
+	if !ok {
+		return "", fmt.Errorf("kind must be dnd or refused")
+	}
+	notes := strings.TrimSpace(in.Notes)
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var room, next string
+	var day, nextDate time.Time
+	var nextID int64
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		id, name, typ, err := findOwnTask(bg, tx, in.AssignmentID, in.Room, "pending", "in_progress")
+		if err != nil {
+			return err
+		}
+		room = name
+		var roomID, cleanerID int64
+		var shift string
+		if err := tx.QueryRow(bg,
+			`UPDATE assignments SET status = 'skipped', updated_at = now(),
+			        notes = concat_ws(E'\n', NULLIF(notes, ''), $2::text)
+			 WHERE id = $1
+			 RETURNING room_id, cleaner_id, date, shift`,
+			id, strings.TrimSpace(kind.icon+" "+strings.ToUpper(kind.label[:1])+kind.label[1:]+" "+notes),
+		).Scan(&roomID, &cleanerID, &day, &shift); err != nil {
+			return fmt.Errorf("skip assignment: %w", err)
+		}
+
+		// The next shift of the day, or tomorrow morning for a stayover whose
+		// guest is still in tomorrow night.
+		nextDate, next = day, ""
+		for i, s := range shiftOrder {
+			if s == shift && i+1 < len(shiftOrder) {
+				next = shiftOrder[i+1]
+			}
+		}
+		if next == "" && typ == "stayover" {
+			var staying bool
+			if err := tx.QueryRow(bg,
+				`SELECT EXISTS (SELECT 1 FROM reservations
+				                WHERE room_id = $1 AND status = 'confirmed'
+				                  AND (checkin_at AT TIME ZONE 'Europe/Rome')::date <= $2
+				                  AND (checkout_at AT TIME ZONE 'Europe/Rome')::date > $2 + 1)`,
+				roomID, day,
+			).Scan(&staying); err != nil {
+				return fmt.Errorf("query stay: %w", err)
+			}
+			if staying {
+				nextDate, next = day.AddDate(0, 0, 1), "morning"
+			}
+		}
+		if next != "" {
+			// A task already planned for the room then takes the place of a new one.
+			err := tx.QueryRow(bg,
+				`SELECT id FROM assignments
+				 WHERE room_id = $1 AND date = $2 AND status IN ('pending', 'in_progress')
+				   AND array_position($3::text[], shift) >= array_position($3::text[], $4::text)
+				 ORDER BY array_position($3::text[], shift) LIMIT 1`,
+				roomID, nextDate, shiftOrder, next,
+			).Scan(&nextID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = tx.QueryRow(bg,
+					`INSERT INTO assignments (room_id, cleaner_id, date, shift, type, notes)
+					 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+					roomID, cleanerID, nextDate, next, typ,
+					fmt.Sprintf("Ripasso (%s nel turno di %s)", kind.label, shiftNames[shift]),
+				).Scan(&nextID)
+			}
+			if err != nil {
+				return fmt.Errorf("reschedule: %w", err)
+			}
+		}
+
+		var rescheduled *int64
+		if nextID != 0 {
+			rescheduled = &nextID
+		}
+		if _, err := tx.Exec(bg,
+			`INSERT INTO dnd_log (room_id, date, kind, logged_by, assignment_id, rescheduled_id, notes)
+			 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`,
+			roomID, day, in.Kind, ctx.UserID, id, rescheduled, notes,
+		); err != nil {
+			return fmt.Errorf("insert dnd log: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	msg := fmt.Sprintf("%s Camera %s: %s, assegnazione saltata.", kind.icon, room, kind.label)
+	switch {
+	case nextID == 0:
+		msg += " Nessun turno successivo utile: il manager lo vedrà nel riepilogo serale."
+	case nextDate.Equal(day):
+		msg += fmt.Sprintf(" Ripasso al turno di %s (assegnazione %d).", shiftNames[next], nextID)
+	default:
+		msg += fmt.Sprintf(" Ripasso il %s, turno di %s (assegnazione %d).", nextDate.Format("02/01"), shiftNames[next], nextID)
+	}
+	return msg, nil
+}
+
+// dndDigestLines lists the do-not-disturb and refused-service entries of
+// day for the evening digest, HTML-escaped. Each carries the number of days
+// of the current stay with an entry, flagged from dndStreakWarn on. Only
+// property hotelID's entries are listed.
+func dndDigestLines(ctx context.Context, db querier, hotelID int, day time.Time) ([]string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT r.name, d.kind, COALESCE(u.name, '—'), COALESCE(d.notes, ''),
+		        COALESCE(n.shift, ''), n.date,
+		        (SELECT count(DISTINCT d2.date)::int FROM dnd_log d2
+		         WHERE d2.room_id = d.room_id AND d2.date <= d.date
+		           AND d2.date >= COALESCE((SELECT (res.checkin_at AT TIME ZONE 'Europe/Rome')::date
+		                                    FROM reservations res
+		                                    WHERE res.room_id = d.room_id AND res.status = 'confirmed'
+		                                      AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= d.date
+		                                      AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= d.date
+		                                    ORDER BY res.checkin_at DESC LIMIT 1), d.date))
+		 FROM dnd_log d JOIN rooms r ON r.id = d.room_id
+		 LEFT JOIN users u ON u.telegram_id = d.logged_by
+		 LEFT JOIN assignments n ON n.id = d.rescheduled_id
+		 WHERE d.date = $1 AND d.hotel_id = $2
+		 ORDER BY r.floor, r.name, d.logged_at`, day, hotelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var room, kind, who, notes, shift string
+		var nextDate *time.Time
+		var days int
+		if err := rows.Scan(&room, &kind, &who, &notes, &shift, &nextDate, &days); err != nil {
+			return nil, err
+		}
+		line := fmt.Sprintf("• %s — %s %s (%s)", htmlpkg.EscapeString(room),
+			dndKinds[kind].icon, htmlpkg.EscapeString(dndKinds[kind].label), htmlpkg.EscapeString(who))
+		switch {
+		case nextDate == nil:
+			line += ", non riprogrammata"
+		case nextDate.Equal(day):
+			line += ", ripasso di " + shiftNames[shift]
+		default:
+			line += fmt.Sprintf(", ripasso il %s di %s", nextDate.Format("02/01"), shiftNames[shift])
+		}
+		if notes != "" {
+			line += ": " + htmlpkg.EscapeString(oneLine(notes))
+		}
+		if days >= dndStreakWarn {
+			line += fmt.Sprintf(" ⚠️ %d° giorno di questo soggiorno", days)
+		} else if days > 1 {
+			line += fmt.Sprintf(" (%d° giorno)", days)
+		}
+		out = append(out, line)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Dry-run mode: the agent works as usual but its tools change nothing, for
+// demos, training new staff and checking a restored backup. The per-user
+// pools are opened with default_transaction_read_only, so a write tool runs
+// its checks and stops at its first write, and toolGuard reports what it
+// would have done instead of the error:
+//
+//   - execute_sql runs in a read-write transaction that is rolled back, so
+//     a write reports the rows it would have touched;
+//   - tools with their own dry_run argument (toolMeta.dryRunArg) get it set;
+//   - tools acting outside the caller's pool (toolMeta.external: messages to
+//     other people, the admin pool, other hotels) are not called at all.
+//
+// Background jobs (digests, lifecycle, auto-assignment, channel sync, guest
+// messages…) are not started at all (main.go): they would write on the admin
+// pool and message real staff and guests.
+//
+// Configure via env:
+//
+//	DRY_RUN=false   "true" enables dry-run mode
+
+func dryRunEnabled() bool {
+	return envOr("DRY_RUN", "false") == "true"
+}
+
+// dryRunPrompt is the system prompt section telling the model, and through
+// it the user, that nothing will be saved.
+func dryRunPrompt() string {
+	if !dryRunEnabled() {
+		return ""
+	}
+	return `
+
+## Dry run
+The bot is in dry-run mode (demo or training): tools check their input and report what they would do, but nothing is saved and nobody else is messaged. Results starting with 🧪 describe an action that was not carried out: say so plainly, never claim it was done.`
+}
+
+// dryRunExecute runs a tool call in dry-run mode.
+func (g *toolGuard) dryRunExecute(ctx agent.ToolContext, t agent.Tool, name string, meta toolMeta, args json.RawMessage) (string, error) {
+	switch {
+	case name == "execute_sql":
+		db, err := poolFrom(ctx)
+		if err != nil {
+			return "", err
+		}
+		return rolledBackSQL(context.Background(), db, args)
+	case meta.external:
+		return fmt.Sprintf("🧪 Prova: %s non eseguito, agirebbe fuori dal database (messaggi ad altri, altre strutture). Argomenti: %s",
+			name, oneLine(string(args))), nil
+	case meta.dryRunArg:
+		in := make(map[string]any)
+		if len(args) > 0 {
+			if err := json.Unmarshal(args, &in); err != nil {
+				return "", err
+			}
+		}
+		in["dry_run"] = true
+		args, _ = json.Marshal(in)
+	}
+	out, err := t.Execute(ctx, args)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "25006" { // read_only_sql_transaction
+		return fmt.Sprintf("🧪 Prova: %s ha superato i controlli e modificherebbe il database; nulla è stato salvato. Argomenti: %s",
+			name, oneLine(string(args))), nil
+	}
+	return out, err
+}
+
+// rolledBackSQL runs an execute_sql call in a transaction that is always
+// rolled back: reads return their rows, writes the rows they would touch.
+func rolledBackSQL(ctx context.Context, pool *pgxpool.Pool, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	q := strings.TrimSpace(in.Query)
+	if q == "" {
+		return "", fmt.Errorf("empty query")
+	}
+	// The pool defaults to read-only; this transaction may write, then vanishes.
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	upper := strings.ToUpper(q)
+	if strings.HasPrefix(upper, "SELECT") || strings.HasPrefix(upper, "WITH") {
+		rows, err := tx.Query(ctx, q)
+		if err != nil {
+			return "", fmt.Errorf("query: %w", err)
+		}
+		defer rows.Close()
+		return formatRows(rows)
+	}
+	tag, err := tx.Exec(ctx, q)
+	if err != nil {
+		return "", fmt.Errorf("exec: %w", err)
+	}
+	return fmt.Sprintf("🧪 Prova: OK — %d rows would be affected, rolled back (nothing saved)", tag.RowsAffected()), nil
+}
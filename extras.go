@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Extras are bookable services from the extras catalog (cot, parking, bike,
+// spa slot…). Finite resources have a stock: the number of units available
+// on any single day. A booking covers every day from from_date to to_date
+// inclusive, so availability is the stock minus the busiest day's usage.
+
+// extraPeak returns the highest number of units of code already booked on
+// any day in [from, to], and that day.
+func extraPeak(ctx context.Context, tx pgx.Tx, code string, from, to time.Time) (int, time.Time, error) {
+	var used int
+	var day time.Time
+	err := tx.QueryRow(ctx,
+		`SELECT COALESCE(sum(re.quantity), 0), d::date
+		 FROM generate_series($2::date, $3::date, INTERVAL '1 day') d
+		 LEFT JOIN reservation_extras re
+		   ON re.extra_code = $1 AND d::date BETWEEN re.from_date AND re.to_date
+		 GROUP BY d
+		 ORDER BY 1 DESC, d
+		 LIMIT 1`, code, from, to,
+	).Scan(&used, &day)
+	return used, day, err
+}
+
+// ── book_extra ───────────────────────────────────────────────────────────────
+
+type bookExtraTool struct{}
+
+func (t *bookExtraTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "book_extra",
+		Description: "Aggiunge un servizio extra a una prenotazione (culla, parcheggio, bici, spa…) dal catalogo extras, " +
+			"controllando la disponibilità delle risorse limitate giorno per giorno. Senza date copre tutto il soggiorno. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {
+					"type": "integer",
+					"description": "ID della prenotazione"
+				},
+				"code": {
+					"type": "string",
+					"description": "Codice dell'extra (extras.code)"
+				},
+				"quantity": {
+					"type": "integer",
+					"description": "Quantità (default 1)"
+				},
+				"from": {
+					"type": "string",
+					"description": "Primo giorno YYYY-MM-DD (default: arrivo)"
+				},
+				"to": {
+					"type": "string",
+					"description": "Ultimo giorno incluso YYYY-MM-DD (default: ultima notte; per uno slot spa usare from = to)"
+				}
+			},
+			"required": ["reservation_id", "code"]
+		}`),
+	}
+}
+
+func (t *bookExtraTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64  `json:"reservation_id"`
+		Code          string `json:"code"`
+		Quantity      int    `json:"quantity"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Quantity <= 0 {
+		in.Quantity = 1
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	bg := context.Background()
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		var checkin, lastNight time.Time
+		if err := tx.QueryRow(bg,
+			`SELECT (checkin_at AT TIME ZONE 'Europe/Rome')::date,
+			        GREATEST((checkin_at AT TIME ZONE 'Europe/Rome')::date, (checkout_at AT TIME ZONE 'Europe/Rome')::date - 1)
+			 FROM reservations WHERE id = $1`, in.ReservationID,
+		).Scan(&checkin, &lastNight); err != nil {
+			return fmt.Errorf("prenotazione %d non trovata", in.ReservationID)
+		}
+		from, to := checkin, lastNight
+		if in.From != "" {
+			d, err := time.Parse("2006-01-02", in.From)
+			if err != nil {
+				return fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+			}
+			from = d
+			if in.To == "" {
+				to = d
+			}
+		}
+		if in.To != "" {
+			d, err := time.Parse("2006-01-02", in.To)
+			if err != nil {
+				return fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+			}
+			to = d
+		}
+		if to.Before(from) {
+			return fmt.Errorf("to is before from")
+		}
+
+		// Lock the catalog row: concurrent bookings of the same extra queue
+		// here, so two managers cannot both take the last cot.
+		var name, pricing string
+		var price float64
+		var stock *int
+		if err := tx.QueryRow(bg,
+			`SELECT name, unit_price_eur::float8, pricing, stock FROM extras WHERE code = $1 FOR UPDATE`, in.Code,
+		).Scan(&name, &price, &pricing, &stock); err != nil {
+			return fmt.Errorf("extra %q non trovato nel catalogo (o permesso negato: solo i manager)", in.Code)
+		}
+		if stock != nil {
+			used, day, err := extraPeak(bg, tx, in.Code, from, to)
+			if err != nil {
+				return fmt.Errorf("availability: %w", err)
+			}
+			if used+in.Quantity > *stock {
+				return fmt.Errorf("%s non disponibile: il %s ne restano %d su %d", name, day.Format("02/01"), *stock-used, *stock)
+			}
+		}
+
+		if _, err := tx.Exec(bg,
+			`INSERT INTO reservation_extras (reservation_id, extra_code, quantity, from_date, to_date, unit_price_eur, created_by)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			in.ReservationID, in.Code, in.Quantity, from, to, price, ctx.UserID,
+		); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+
+		total := price * float64(in.Quantity)
+		if pricing == "per_day" {
+			total *= to.Sub(from).Hours()/24 + 1
+		}
+		result = fmt.Sprintf("✅ %d × %s dal %s al %s aggiunto alla prenotazione %d (%.2f€).",
+			in.Quantity, name, from.Format("02/01"), to.Format("02/01"), in.ReservationID, total)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Group bookings: "la gita del liceo Volta, 6 camere dal 3 al 6 marzo, paga
+// la scuola". A booking_groups row holds what the rooms share — the name, the
+// contact who pays (a guest profile) and the agreed total — and each room is
+// an ordinary reservation pointing at it, so the board, cleaning, city tax and
+// balances keep working per room. All the rooms go in one transaction: one
+// taken room refuses the whole group. Options, confirmations and cancellations
+// apply to every room of the group unless some rooms are named.
+
+// splitEven divides total into n shares of whole cents; the first shares take
+// the leftover cents.
+func splitEven(total float64, n int) []float64 {
+	cents := int64(math.Round(total * 100))
+	out := make([]float64, n)
+	for i := range out {
+		share := cents / int64(n)
+		if int64(i) < cents%int64(n) {
+			share++
+		}
+		out[i] = float64(share) / 100
+	}
+	return out
+}
+
+// ── add_group_booking ────────────────────────────────────────────────────────
+
+type addGroupBookingTool struct{}
+
+func (t *addGroupBookingTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "add_group_booking",
+		Description: "Prenota più camere insieme per un gruppo (gita, matrimonio, azienda) con le stesse date, lo stesso referente " +
+			"che paga, canale e trattamento. Tutte le camere o nessuna: se una è occupata rifiuta e propone le camere libere. " +
+			"amount_eur è il totale del gruppo, diviso in parti uguali tra le camere senza un prezzo proprio. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"group_name": {"type": "string", "description": "Nome del gruppo, es. 'Gita liceo Volta'"},
+				"rooms": {
+					"type": "array",
+					"description": "Le camere del gruppo",
+					"items": {
+						"type": "object",
+						"properties": {
+							"room": {"type": "string", "description": "Nome della camera"},
+							"guests": {"type": "integer", "description": "Persone in camera (default 1)"},
+							"children": {"type": "integer", "description": "Bambini, compresi nei guests"},
+							"guest_name": {"type": "string", "description": "Chi dorme in camera, se diverso dal referente"},
+							"amount_eur": {"type": "number", "description": "Prezzo di questa camera, se diverso dalla quota del totale"}
+						},
+						"required": ["room"]
+					}
+				},
+				"guest_name": {"type": "string", "description": "Referente che paga (cognome nome): collega il gruppo al profilo con lo stesso nome o ne crea uno"},
+				"guest_id": {"type": "integer", "description": "Profilo del referente (guests.id) quando più profili hanno lo stesso nome"},
+				"guest_phone": {"type": "string", "description": "Telefono del referente"},
+				"guest_email": {"type": "string", "description": "Email del referente"},
+				"checkin": {"type": "string", "description": "Arrivo: YYYY-MM-DD (ore 14:00) o ISO 8601 con fuso"},
+				"checkout": {"type": "string", "description": "Partenza: YYYY-MM-DD (ore 10:00) o ISO 8601 con fuso"},
+				"amount_eur": {"type": "number", "description": "Prezzo totale concordato per il gruppo"},
+				"source": {"type": "string", "description": "Canale: direct, booking, airbnb, phone (default direct)"},
+				"residence_country": {"type": "string", "description": "Paese di residenza, codice ISO (es. DE)"},
+				"residence_province": {"type": "string", "description": "Provincia (solo residenti in Italia, es. RM)"},
+				"board": {"type": "string", "enum": ["room_only", "bb", "half_board", "full_board"], "description": "Trattamento per tutto il gruppo (default bb)"},
+				"dietary_notes": {"type": "string", "description": "Allergie / esigenze alimentari"},
+				"notes": {"type": "string", "description": "Note sul gruppo"},
+				"hold_hours": {"type": "integer", "description": "Se indicato, mette tutte le camere in opzione per queste ore invece di confermarle"},
+				"override": {"type": "boolean", "description": "Accetta il soggiorno anche se più corto del minimo: la deroga viene annotata nelle note del gruppo"}
+			},
+			"required": ["group_name", "rooms", "checkin", "checkout"]
+		}`),
+	}
+}
+
+func (t *addGroupBookingTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		GroupName string `json:"group_name"`
+		Rooms     []struct {
+			Room      string   `json:"room"`
+			Guests    int      `json:"guests"`
+			Children  int      `json:"children"`
+			GuestName string   `json:"guest_name"`
+			AmountEUR *float64 `json:"amount_eur"`
+		} `json:"rooms"`
+		GuestName         string   `json:"guest_name"`
+		GuestID           int64    `json:"guest_id"`
+		GuestPhone        string   `json:"guest_phone"`
+		GuestEmail        string   `json:"guest_email"`
+		Checkin           string   `json:"checkin"`
+		Checkout          string   `json:"checkout"`
+		AmountEUR         *float64 `json:"amount_eur"`
+		Source            string   `json:"source"`
+		ResidenceCountry  string   `json:"residence_country"`
+		ResidenceProvince string   `json:"residence_province"`
+		Board             string   `json:"board"`
+		DietaryNotes      string   `json:"dietary_notes"`
+		Notes             string   `json:"notes"`
+		HoldHours         int      `json:"hold_hours"`
+		Override          bool     `json:"override"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.GroupName) == "" {
+		return "", fmt.Errorf("group_name is required")
+	}
+	if len(in.Rooms) < 2 {
+		return "", fmt.Errorf("a group needs at least 2 rooms; for one room use add_reservation")
+	}
+	checkin, err := parseStayTime(in.Checkin, defaultCheckinHour)
+	if err != nil {
+		return "", fmt.Errorf("checkin %w", err)
+	}
+	checkout, err := parseStayTime(in.Checkout, defaultCheckoutHour)
+	if err != nil {
+		return "", fmt.Errorf("checkout %w", err)
+	}
+	if !checkout.After(checkin) {
+		return "", fmt.Errorf("checkout must be after checkin")
+	}
+	if in.Source == "" {
+		in.Source = "direct"
+	}
+	if in.Board == "" {
+		in.Board = "bb"
+	}
+	if _, ok := boardTypes[in.Board]; !ok {
+		return "", fmt.Errorf("board must be room_only, bb, half_board or full_board")
+	}
+	status := "confirmed"
+	var holdUntil *time.Time
+	if in.HoldHours > 0 {
+		t := time.Now().Add(time.Duration(in.HoldHours) * time.Hour)
+		status, holdUntil = "option", &t
+	}
+
+	// The group total goes to the rooms without a price of their own.
+	var unpriced int
+	for i, r := range in.Rooms {
+		if err := partySize(&in.Rooms[i].Guests, 0, r.Children, 1); err != nil {
+			return "", fmt.Errorf("room %s: %w", r.Room, err)
+		}
+		if r.AmountEUR == nil {
+			unpriced++
+		}
+	}
+	if in.AmountEUR != nil && unpriced > 0 {
+		rest := *in.AmountEUR
+		for _, r := range in.Rooms {
+			if r.AmountEUR != nil {
+				rest -= *r.AmountEUR
+			}
+		}
+		if rest < 0 {
+			return "", fmt.Errorf("the room prices exceed the group total (%.2f€)", *in.AmountEUR)
+		}
+		shares := splitEven(rest, unpriced)
+		for i := range in.Rooms {
+			if in.Rooms[i].AmountEUR == nil {
+				in.Rooms[i].AmountEUR = &shares[0]
+				shares = shares[1:]
+			}
+		}
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var isManager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&isManager); err != nil {
+		return "", fmt.Errorf("check role: %w", err)
+	}
+	if !isManager {
+		return "", fmt.Errorf("add_group_booking is only available to managers")
+	}
+
+	// Say up front which of the rooms are taken, all of them at once; the
+	// overlap trigger still guards the inserts below.
+	free, err := availableRooms(bg, db, checkin, checkout)
+	if err != nil {
+		return "", fmt.Errorf("availability: %w", err)
+	}
+	freeIDs := make(map[string]int64, len(free))
+	for _, r := range free {
+		freeIDs[strings.ToLower(r.name)] = r.id
+	}
+	roomIDs := make([]int64, len(in.Rooms))
+	seen := make(map[string]bool)
+	var busy, unknown []string
+	for i, r := range in.Rooms {
+		key := strings.ToLower(strings.TrimSpace(r.Room))
+		if seen[key] {
+			return "", fmt.Errorf("room %s is listed twice", r.Room)
+		}
+		seen[key] = true
+		if id, ok := freeIDs[key]; ok {
+			roomIDs[i] = id
+			continue
+		}
+		var exists bool
+		if err := db.QueryRow(bg, `SELECT EXISTS (SELECT 1 FROM rooms WHERE lower(name) = $1)`, key).Scan(&exists); err != nil {
+			return "", err
+		}
+		if exists {
+			busy = append(busy, r.Room)
+		} else {
+			unknown = append(unknown, r.Room)
+		}
+	}
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("camere non trovate: %s", strings.Join(unknown, ", "))
+	}
+	if len(busy) > 0 {
+		return groupRefusal(bg, db, fmt.Sprintf("❌ Gruppo non inserito: camere già occupate o fuori servizio in quelle date: %s.",
+			strings.Join(busy, ", ")), checkin, checkout, seen), nil
+	}
+	for _, id := range roomIDs {
+		v, err := minStayViolation(bg, db, id, checkin, checkout)
+		if err != nil {
+			return "", err
+		}
+		if v == "" {
+			continue
+		}
+		if !in.Override {
+			return fmt.Sprintf("⚠️ Gruppo non inserito: il soggiorno non rispetta il %s. Proponi più notti, "+
+				"oppure se il manager accetta la deroga ripeti con override=true.", v), nil
+		}
+		in.Notes = overrideNote(v, in.Notes)
+		break
+	}
+
+	var groupID int64
+	ids := make([]int64, len(in.Rooms))
+	var returning *guestProfile
+	var ambiguous []guestProfile
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		guest, amb, err := resolveGuest(bg, tx, in.GuestID, in.GuestName, in.GuestPhone)
+		if err != nil {
+			return err
+		}
+		ambiguous = amb
+		var guestID *int64
+		switch {
+		case guest != nil:
+			guestID = &guest.id
+			if guest.stays > 0 {
+				returning = guest
+			}
+			if _, err := tx.Exec(bg,
+				`UPDATE guests SET phone = COALESCE(NULLIF($2, ''), phone), email = COALESCE(NULLIF($3, ''), email)
+				 WHERE id = $1`, guest.id, in.GuestPhone, in.GuestEmail); err != nil {
+				return fmt.Errorf("update guest: %w", err)
+			}
+		case amb == nil && strings.TrimSpace(in.GuestName) != "":
+			var newID int64
+			if err := tx.QueryRow(bg,
+				`INSERT INTO guests (name, phone, email) VALUES (trim($1), NULLIF($2, ''), NULLIF($3, '')) RETURNING id`,
+				in.GuestName, in.GuestPhone, in.GuestEmail).Scan(&newID); err != nil {
+				return fmt.Errorf("create guest: %w", err)
+			}
+			guestID = &newID
+		}
+		if err := tx.QueryRow(bg,
+			`INSERT INTO booking_groups (name, guest_id, amount_eur, notes, created_by)
+			 VALUES (trim($1), $2, $3, NULLIF($4, ''), $5) RETURNING id`,
+			in.GroupName, guestID, in.AmountEUR, in.Notes, ctx.UserID).Scan(&groupID); err != nil {
+			return fmt.Errorf("insert group: %w", err)
+		}
+		for i, r := range in.Rooms {
+			// A room's own occupant is not the contact: no profile link.
+			name, roomGuest := in.GuestName, guestID
+			if strings.TrimSpace(r.GuestName) != "" {
+				name, roomGuest = r.GuestName, nil
+			}
+			if err := tx.QueryRow(bg,
+				`INSERT INTO reservations (room_id, guest_name, checkin_at, checkout_at, guests, source, amount_eur,
+				   residence_country, residence_province, board, dietary_notes, notes, created_by, status, hold_until, guest_id,
+				   children, booking_group_id)
+				 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, NULLIF(upper($8), ''), NULLIF(upper($9), ''), $10,
+				   NULLIF($11, ''), $12, $13, $14, $15, $16, $17, $18)
+				 RETURNING id`,
+				roomIDs[i], name, checkin, checkout, r.Guests, in.Source, r.AmountEUR,
+				in.ResidenceCountry, in.ResidenceProvince, in.Board, in.DietaryNotes, "Gruppo: "+strings.TrimSpace(in.GroupName),
+				ctx.UserID, status, holdUntil, roomGuest, r.Children, groupID,
+			).Scan(&ids[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23514" && strings.Contains(pgErr.Message, "holds at most") {
+		return "❌ Gruppo non inserito: " + pgErr.Message + ". Distribuisci le persone diversamente o scegli una camera più grande.", nil
+	}
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		return groupRefusal(bg, db, "❌ Gruppo non inserito: "+pgErr.Message, checkin, checkout, seen), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("insert group booking: %w", err)
+	}
+
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✅ Gruppo %d %q: %d camere, %s → %s.", groupID, strings.TrimSpace(in.GroupName), len(ids),
+		checkin.In(loc).Format("02/01 15:04"), checkout.In(loc).Format("02/01 15:04"))
+	total := 0
+	for i, r := range in.Rooms {
+		fmt.Fprintf(&sb, "\n• prenotazione %d: camera %s, %d pers.", ids[i], r.Room, r.Guests)
+		if r.AmountEUR != nil {
+			fmt.Fprintf(&sb, ", %.2f€", *r.AmountEUR)
+		}
+		total += r.Guests
+	}
+	fmt.Fprintf(&sb, "\nIn tutto %d persone.", total)
+	if holdUntil != nil {
+		fmt.Fprintf(&sb, "\nTutte in opzione fino al %s: confirm_option o group_booking le confermano insieme.",
+			holdUntil.In(loc).Format("02/01 15:04"))
+	}
+	if returning != nil {
+		sb.WriteString("\nReferente abituale — " + returning.summary())
+	}
+	if len(ambiguous) > 0 {
+		fmt.Fprintf(&sb, "\n⚠️ %d profili ospite si chiamano %q: referente non collegato. Indica guest_id:", len(ambiguous), in.GuestName)
+		for _, g := range ambiguous {
+			sb.WriteString("\n" + g.summary())
+		}
+	}
+	return sb.String(), nil
+}
+
+// groupRefusal appends the rooms free in the period, other than the ones
+// asked for, to a refusal.
+func groupRefusal(ctx context.Context, db *pgxpool.Pool, msg string, checkin, checkout time.Time, asked map[string]bool) string {
+	free, err := freeRooms(ctx, db, checkin, checkout)
+	if err != nil {
+		return msg
+	}
+	var others []string
+	for _, f := range free {
+		name, _, _ := strings.Cut(f, " (")
+		if !asked[strings.ToLower(name)] {
+			others = append(others, f)
+		}
+	}
+	if len(others) == 0 {
+		return msg + "\nNessun'altra camera libera in quelle date."
+	}
+	return msg + "\nAltre camere libere: " + strings.Join(others, ", ")
+}
+
+// ── group_booking ────────────────────────────────────────────────────────────
+
+type groupBookingTool struct{}
+
+func (t *groupBookingTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "group_booking",
+		Description: "Mostra una prenotazione di gruppo (camere, stato, totale e saldo) oppure, con action, conferma le opzioni, " +
+			"le rilascia o cancella le prenotazioni: di tutte le camere del gruppo o solo di quelle in rooms, in un colpo solo. " +
+			"Senza group_id elenca i gruppi in corso e futuri. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"group_id": {"type": "integer", "description": "ID del gruppo (booking_groups.id)"},
+				"action": {"type": "string", "enum": ["confirm", "release", "cancel"], "description": "confirm: conferma le opzioni; release: rilascia le opzioni; cancel: cancella le prenotazioni"},
+				"rooms": {"type": "array", "items": {"type": "string"}, "description": "Solo queste camere del gruppo (default tutte)"}
+			}
+		}`),
+	}
+}
+
+func (t *groupBookingTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		GroupID int64    `json:"group_id"`
+		Action  string   `json:"action"`
+		Rooms   []string `json:"rooms"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var isManager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&isManager); err != nil {
+		return "", fmt.Errorf("check role: %w", err)
+	}
+	if !isManager {
+		return "", fmt.Errorf("group_booking is only available to managers")
+	}
+	if in.GroupID == 0 {
+		if in.Action != "" {
+			return "", fmt.Errorf("action needs group_id")
+		}
+		return listGroups(bg, db)
+	}
+
+	var name string
+	if err := db.QueryRow(bg, `SELECT name FROM booking_groups WHERE id = $1`, in.GroupID).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Sprintf("Nessun gruppo con ID %d.", in.GroupID), nil
+		}
+		return "", err
+	}
+
+	if in.Action != "" {
+		// Which rows each action may touch: only a live option can be
+		// confirmed, as in confirm_option.
+		var set, from string
+		switch in.Action {
+		case "confirm":
+			set, from = `status = 'confirmed', hold_until = NULL`, `status = 'option' AND hold_until > now()`
+		case "release":
+			set, from = `status = 'expired'`, `status = 'option' AND hold_until > now()`
+		case "cancel":
+			set, from = `status = 'cancelled'`, `(status = 'confirmed' OR (status = 'option' AND hold_until > now()))`
+		default:
+			return "", fmt.Errorf("action must be confirm, release or cancel")
+		}
+		rooms := make([]string, len(in.Rooms))
+		for i, r := range in.Rooms {
+			rooms[i] = strings.ToLower(strings.TrimSpace(r))
+		}
+		// All or nothing: a named room outside the group, or one not in a
+		// state the action applies to, refuses the whole update.
+		var changed []string
+		var skipped []string
+		err := pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+			rows, err := tx.Query(bg,
+				`SELECT r.name, `+from+`
+				 FROM reservations res JOIN rooms r ON r.id = res.room_id
+				 WHERE res.booking_group_id = $1 AND (cardinality($2::text[]) = 0 OR lower(r.name) = ANY ($2))
+				 ORDER BY r.name FOR UPDATE OF res`, in.GroupID, rooms)
+			if err != nil {
+				return err
+			}
+			found := make(map[string]bool)
+			for rows.Next() {
+				var room string
+				var ok bool
+				if err := rows.Scan(&room, &ok); err != nil {
+					rows.Close()
+					return err
+				}
+				found[strings.ToLower(room)] = true
+				if !ok {
+					skipped = append(skipped, room)
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			for i, r := range rooms {
+				if !found[r] {
+					return fmt.Errorf("camera %s non fa parte del gruppo %d", in.Rooms[i], in.GroupID)
+				}
+			}
+			if len(in.Rooms) > 0 && len(skipped) > 0 {
+				return nil
+			}
+			rows, err = tx.Query(bg,
+				`UPDATE reservations res SET `+set+`
+				 FROM rooms r
+				 WHERE r.id = res.room_id AND res.booking_group_id = $1 AND `+from+`
+				   AND (cardinality($2::text[]) = 0 OR lower(r.name) = ANY ($2))
+				 RETURNING r.name`, in.GroupID, rooms)
+			if err != nil {
+				return err
+			}
+			changed, err = pgx.CollectRows(rows, pgx.RowTo[string])
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("update group: %w", err)
+		}
+		verb := map[string]string{"confirm": "confermate", "release": "rilasciate", "cancel": "cancellate"}[in.Action]
+		if len(in.Rooms) > 0 && len(skipped) > 0 {
+			return fmt.Sprintf("❌ Nessuna modifica: camere %s non possono essere %s (opzione scaduta, già confermata o cancellata).",
+				strings.Join(skipped, ", "), verb), nil
+		}
+		if len(changed) == 0 {
+			return fmt.Sprintf("Nessuna camera del gruppo %d da %s.", in.GroupID,
+				map[string]string{"confirm": "confermare", "release": "rilasciare", "cancel": "cancellare"}[in.Action]), nil
+		}
+		msg := fmt.Sprintf("✅ Gruppo %d %q: camere %s %s.", in.GroupID, name, strings.Join(changed, ", "), verb)
+		if len(skipped) > 0 {
+			msg += fmt.Sprintf("\nNon toccate (opzione scaduta, già confermate o cancellate): %s.", strings.Join(skipped, ", "))
+		}
+		return msg, nil
+	}
+	return showGroup(bg, db, in.GroupID, name)
+}
+
+// showGroup lists the rooms of a group with their status, then the balance
+// of the confirmed ones.
+func showGroup(ctx context.Context, db *pgxpool.Pool, id int64, name string) (string, error) {
+	var contact string
+	var amount *float64
+	var notes string
+	if err := db.QueryRow(ctx,
+		`SELECT COALESCE(g.name || COALESCE(' · ' || g.phone, ''), ''), bg.amount_eur::float8, COALESCE(bg.notes, '')
+		 FROM booking_groups bg LEFT JOIN guests g ON g.id = bg.guest_id
+		 WHERE bg.id = $1`, id).Scan(&contact, &amount, &notes); err != nil {
+		return "", err
+	}
+	rows, err := db.Query(ctx,
+		`SELECT res.id, r.name, COALESCE(res.guest_name, ''), res.guests, res.status, res.hold_until,
+		        res.checkin_at, res.checkout_at
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.booking_group_id = $1
+		 ORDER BY r.floor, r.name`, id)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "👥 Gruppo %d %q", id, name)
+	if contact != "" {
+		sb.WriteString(", referente " + contact)
+	}
+	if amount != nil {
+		fmt.Fprintf(&sb, ", totale concordato %.2f€", *amount)
+	}
+	if notes != "" {
+		sb.WriteString("\nNote: " + notes)
+	}
+	people := 0
+	for rows.Next() {
+		var resID int64
+		var room, guest, status string
+		var guests int
+		var hold *time.Time
+		var checkin, checkout time.Time
+		if err := rows.Scan(&resID, &room, &guest, &guests, &status, &hold, &checkin, &checkout); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n• #%d camera %s, %s → %s, %d pers.", resID, room,
+			checkin.In(loc).Format("02/01"), checkout.In(loc).Format("02/01"), guests)
+		if guest != "" {
+			sb.WriteString(", " + guest)
+		}
+		switch {
+		case status == "option" && hold != nil:
+			fmt.Fprintf(&sb, " — opzione fino al %s", hold.In(loc).Format("02/01 15:04"))
+		case status != "confirmed":
+			sb.WriteString(" — " + status)
+		}
+		if status == "confirmed" || status == "option" {
+			people += guests
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	rows.Close()
+	fmt.Fprintf(&sb, "\nIn tutto %d persone.", people)
+
+	balances, err := loadBalances(ctx, db, `res.booking_group_id = $1`, id)
+	if err != nil {
+		return "", fmt.Errorf("balances: %w", err)
+	}
+	var due, paid float64
+	known := true
+	for _, b := range balances {
+		if b.due == nil {
+			known = false
+			continue
+		}
+		due += *b.due
+		paid += b.paid
+	}
+	switch {
+	case len(balances) == 0:
+	case !known:
+		sb.WriteString("\nSaldo: alcune camere non hanno il prezzo (amount_eur), vedi outstanding_balance.")
+	default:
+		fmt.Fprintf(&sb, "\nSaldo camere confermate: totale %.2f€, pagati %.2f€, da saldare %.2f€.",
+			roundCents(due), roundCents(paid), roundCents(due-paid))
+	}
+	return sb.String(), nil
+}
+
+func listGroups(ctx context.Context, db *pgxpool.Pool) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT bg.id, bg.name, min(res.checkin_at), max(res.checkout_at),
+		        count(*) FILTER (WHERE res.status IN ('confirmed', 'option')),
+		        count(*) FILTER (WHERE res.status = 'option' AND res.hold_until > now())
+		 FROM booking_groups bg JOIN reservations res ON res.booking_group_id = bg.id
+		 GROUP BY bg.id, bg.name
+		 HAVING max(res.checkout_at) > now()
+		 ORDER BY min(res.checkin_at)`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	loc := romeLocation()
+	var lines []string
+	for rows.Next() {
+		var id int64
+		var name string
+		var from, to time.Time
+		var live, options int
+		if err := rows.Scan(&id, &name, &from, &to, &live, &options); err != nil {
+			return "", err
+		}
+		line := fmt.Sprintf("• %d %q: %s → %s, %d camere", id, name, from.In(loc).Format("02/01"), to.In(loc).Format("02/01"), live)
+		if options > 0 {
+			line += fmt.Sprintf(" (%d in opzione)", options)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "Nessun gruppo in corso o in arrivo.", nil
+	}
+	return "👥 Gruppi:\n" + strings.Join(lines, "\n"), nil
+}
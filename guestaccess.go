@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GuestAccess is the bot as the guests see it. A manager sends the guest of
+// a reservation a link (generate_invite with role 'guest'); redeeming it
+// registers them as a guest, whose Postgres role (guest_<id>, in m4d_guest)
+// can read nothing but its own stay through the guest_stays view (db/rls.sql).
+//
+// Guests get the guest prompt (DefaultGuestTemplate) and only the tools below,
+// marked guest in toolMetas: BuildTools offers them nothing else and toolGuard
+// refuses anything else, while staff never see these. Requests and reports
+// are written with the admin pool on the guest's behalf, on the stay read
+// through their own pool:
+//
+//   - my_reservation: room, dates, guests and board of the stay;
+//   - checkout_time: when to leave the room;
+//   - request_towels: a guest request (kind towels) for the room, sent to
+//     its cleaner of the day, or to the managers when nobody has it;
+//   - report_issue: a maintenance ticket on the room, sent to the managers.
+type GuestAccess struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+	requests  *GuestRequests
+}
+
+func newGuestAccess(adminPool *pgxpool.Pool, botToken string, requests *GuestRequests) *GuestAccess {
+	return &GuestAccess{adminPool: adminPool, botToken: botToken, requests: requests}
+}
+
+// Tools implements agent.ToolSet.
+func (g *GuestAccess) Tools() []agent.Tool {
+	return []agent.Tool{&myReservationTool{}, &checkoutTimeTool{}, &requestTowelsTool{g: g}, &reportIssueTool{g: g}}
+}
+
+// guestStay is a row of guest_stays.
+type guestStay struct {
+	reservationID, roomID int64
+	hotel, room, guest    string
+	checkin, checkout     time.Time
+	guests, children      int
+	board, status         string
+}
+
+// stayOf reads the caller's stay through their own pool: the one in progress
+// or the next, else the last one. Staff have none.
+func stayOf(ctx agent.ToolContext) (guestStay, error) {
+	var s guestStay
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return s, err
+	}
+	err = db.QueryRow(context.Background(),
+		`SELECT reservation_id, room_id, hotel, room, COALESCE(guest_name, ''), checkin_at, checkout_at,
+		        guests, children, board, status
+		 FROM guest_stays
+		 ORDER BY checkout_at < now(),
+		          CASE WHEN checkout_at < now() THEN -extract(epoch FROM checkout_at)
+		               ELSE extract(epoch FROM checkin_at) END
+		 LIMIT 1`,
+	).Scan(&s.reservationID, &s.roomID, &s.hotel, &s.room, &s.guest, &s.checkin, &s.checkout,
+		&s.guests, &s.children, &s.board, &s.status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, fmt.Errorf("nessun soggiorno collegato a questo utente")
+	}
+	if err != nil {
+		return s, fmt.Errorf("query stay: %w", err)
+	}
+	return s, nil
+}
+
+// inHouse reports whether the guest is staying now: requests and reports
+// only make sense from check-in day to checkout.
+func (s guestStay) inHouse(now time.Time) error {
+	loc := romeLocation()
+	y, m, d := s.checkin.In(loc).Date()
+	switch {
+	case s.status != "confirmed":
+		return fmt.Errorf("la prenotazione non è confermata")
+	case now.Before(time.Date(y, m, d, 0, 0, 0, 0, loc)):
+		return fmt.Errorf("il soggiorno inizia il %s: la richiesta si potrà fare dal giorno dell'arrivo", s.checkin.In(loc).Format("02/01"))
+	case now.After(s.checkout):
+		return fmt.Errorf("il soggiorno è terminato il %s", s.checkout.In(loc).Format("02/01"))
+	}
+	return nil
+}
+
+// notifyManagers sends msg to the managers of the property of roomID.
+func (g *GuestAccess) notifyManagers(ctx context.Context, roomID int64, msg string) int {
+	var hotelID int
+	if err := g.adminPool.QueryRow(ctx, `SELECT hotel_id FROM rooms WHERE id = $1`, roomID).Scan(&hotelID); err != nil {
+		log.Printf("guest access: room %d: %v", roomID, err)
+		return 0
+	}
+	managers, err := managerIDs(ctx, g.adminPool, hotelID)
+	if err != nil {
+		log.Printf("guest access: %v", err)
+		return 0
+	}
+	tg := newBot(g.botToken)
+	sent := 0
+	for _, m := range managers {
+		if err := tg.Send(ctx, m, msg); err != nil {
+			log.Printf("guest access: notify manager %d: %v", m, err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// ── my_reservation ───────────────────────────────────────────────────────────
+
+type myReservationTool struct{}
+
+func (t *myReservationTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "my_reservation",
+		Description: "La prenotazione dell'ospite: struttura, camera, arrivo, partenza, persone e trattamento.",
+		Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (t *myReservationTool) Execute(ctx agent.ToolContext, _ json.RawMessage) (string, error) {
+	s, err := stayOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🏨 %s, camera %s", s.hotel, s.room)
+	if s.guest != "" {
+		fmt.Fprintf(&sb, " — %s", s.guest)
+	}
+	fmt.Fprintf(&sb, "\nArrivo: %s %s\nPartenza: %s %s",
+		italianWeekday(s.checkin.In(loc).Weekday()), s.checkin.In(loc).Format("02/01 15:04"),
+		italianWeekday(s.checkout.In(loc).Weekday()), s.checkout.In(loc).Format("02/01 15:04"))
+	fmt.Fprintf(&sb, "\nPersone: %d", s.guests)
+	if s.children > 0 {
+		fmt.Fprintf(&sb, " (di cui %d bambini)", s.children)
+	}
+	if b, ok := boardTypes[s.board]; ok {
+		fmt.Fprintf(&sb, "\nTrattamento: %s", b)
+	}
+	if s.status == "cancelled" {
+		sb.WriteString("\n⚠️ La prenotazione è stata cancellata.")
+	}
+	return sb.String(), nil
+}
+
+// ── checkout_time ────────────────────────────────────────────────────────────
+
+type checkoutTimeTool struct{}
+
+func (t *checkoutTimeTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "checkout_time",
+		Description: "A che ora l'ospite deve lasciare la camera il giorno della partenza.",
+		Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (t *checkoutTimeTool) Execute(ctx agent.ToolContext, _ json.RawMessage) (string, error) {
+	s, err := stayOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	out := s.checkout.In(loc)
+	if time.Now().After(s.checkout) {
+		return fmt.Sprintf("Il soggiorno è terminato: checkout %s %s alle %s.", italianWeekday(out.Weekday()), out.Format("02/01"), out.Format("15:04")), nil
+	}
+	return fmt.Sprintf("🕐 Checkout %s %s entro le %s (camera %s). Per un late checkout chiedi alla reception.",
+		italianWeekday(out.Weekday()), out.Format("02/01"), out.Format("15:04"), s.room), nil
+}
+
+// ── request_towels ───────────────────────────────────────────────────────────
+
+type requestTowelsTool struct {
+	g *GuestAccess
+}
+
+func (t *requestTowelsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "request_towels",
+		Description: "L'ospite chiede asciugamani (puliti o in più) in camera: la richiesta va al personale di turno.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"details": {"type": "string", "description": "Cosa serve, es. '2 teli doccia', 'asciugamani puliti'"}
+			}
+		}`),
+	}
+}
+
+func (t *requestTowelsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Details string `json:"details"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	s, err := stayOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := s.inHouse(time.Now()); err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	details := strings.TrimSpace(in.Details)
+
+	var id int64
+	if err := t.g.adminPool.QueryRow(bg,
+		`INSERT INTO guest_requests (reservation_id, kind, details, created_by)
+		 VALUES ($1, 'towels', NULLIF($2, ''), $3) RETURNING id`,
+		s.reservationID, details, ctx.UserID,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert request: %w", err)
+	}
+	msg := fmt.Sprintf("🛎 Camera %s, richiesta dell'ospite #%d: %s.", s.room, id, guestRequestLabel("towels", details, nil))
+	if t.g.requests.notifyCleaners(bg, s.roomID, ctx.UserID, msg+" Segnalami quando è fatta.") == 0 {
+		t.g.notifyManagers(bg, s.roomID, msg+" Nessun cleaner ha la camera oggi.")
+	}
+	return fmt.Sprintf("✅ Richiesta #%d inviata al personale: gli asciugamani arriveranno in camera %s.", id, s.room), nil
+}
+
+// ── report_issue ─────────────────────────────────────────────────────────────
+
+type reportIssueTool struct {
+	g *GuestAccess
+}
+
+func (t *reportIssueTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "report_issue",
+		Description: "L'ospite segnala un problema in camera (guasto, rumore, pulizia, aria condizionata…): " +
+			"diventa un ticket di manutenzione e la direzione viene avvisata.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"description": {"type": "string", "description": "Il problema, con le parole dell'ospite"},
+				"urgent": {"type": "boolean", "description": "true se la camera non è utilizzabile o c'è un rischio (perdita d'acqua, porta che non chiude)"}
+			},
+			"required": ["description"]
+		}`),
+	}
+}
+
+func (t *reportIssueTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Description string `json:"description"`
+		Urgent      bool   `json:"urgent"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Description) == "" {
+		return "", fmt.Errorf("description is required")
+	}
+	s, err := stayOf(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := s.inHouse(time.Now()); err != nil {
+		return "", err
+	}
+	severity := "high"
+	if in.Urgent {
+		severity = "urgent"
+	}
+	bg := context.Background()
+
+	var id int64
+	if err := t.g.adminPool.QueryRow(bg,
+		`INSERT INTO maintenance_tickets (room_id, reporter, description, severity)
+		 VALUES ($1, $2, $3, $4) RETURNING id`,
+		s.roomID, ctx.UserID, strings.TrimSpace(in.Description), severity,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert ticket: %w", err)
+	}
+	who := "l'ospite"
+	if s.guest != "" {
+		who = "l'ospite " + s.guest
+	}
+	t.g.notifyManagers(bg, s.roomID, fmt.Sprintf("🚨 Ticket #%d (%s) — camera %s\n%s\nSegnalato da %s.",
+		id, severity, s.room, strings.TrimSpace(in.Description), who))
+	return fmt.Sprintf("🔧 Segnalazione #%d registrata: la direzione è stata avvisata e ti contatterà.", id), nil
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GuestDocs captures guest identity documents at check-in and exports them in
+// the fixed-width format of the Italian police portal "Alloggiati Web".
+//
+// Document data never goes through the LLM: a manager starts the scripted
+// flow with "/documento <reservation_id>", and every answer is captured by
+// routedMessenger (buttons "gdoc:<value>", free text via Capture) so it is
+// neither sent to the provider nor recorded in session logs. guest_documents
+// is an internal table (no grants to tg_* roles); only the export tool reads
+// it, after checking the caller is a manager. Both the capture and the export
+// stay within the manager's own property: RLS does not cover the admin pool,
+// so every query here filters by hotel_id.
+//
+// Retention: rows are deleted GUEST_DOCS_RETENTION_DAYS after checkout.
+//
+//	GUEST_DOCS_RETENTION_DAYS=7   days to keep documents after checkout
+type GuestDocs struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+	messenger *routedMessenger
+
+	mu     sync.Mutex
+	drafts map[int64]*guestDocDraft // chatID → in-progress capture
+}
+
+func newGuestDocs(adminPool *pgxpool.Pool, botToken string) *GuestDocs {
+	return &GuestDocs{adminPool: adminPool, botToken: botToken, drafts: make(map[int64]*guestDocDraft)}
+}
+
+// Alloggiati Web guest types ("tipo alloggiato").
+const (
+	alloggiatoSingolo      = 16
+	alloggiatoCapoFamiglia = 17
+	alloggiatoCapoGruppo   = 18
+	alloggiatoFamiliare    = 19
+	alloggiatoMembro       = 20
+)
+
+// alloggiatiItaly is the Alloggiati Web state code for Italy.
+const alloggiatiItaly = "100000100"
+
+type guestDocDraft struct {
+	reservationID int64
+	guestName     string
+	step          int
+	values        map[string]string
+	startedAt     time.Time
+}
+
+// guestDocStep is one question of the capture flow. Steps with buttons accept
+// the button value; the others parse free text with check.
+type guestDocStep struct {
+	key     string
+	prompt  string
+	buttons []telegram.Button
+	check   func(string) (string, error)
+	// skip reports whether the step does not apply given earlier answers.
+	skip func(values map[string]string) bool
+}
+
+var (
+	reAlloggiatiCode = regexp.MustCompile(`^\d{9}$`)
+	reProvince       = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+func checkText(max int) func(string) (string, error) {
+	return func(s string) (string, error) {
+		s = strings.TrimSpace(s)
+		if s == "" || len(s) > max {
+			return "", fmt.Errorf("serve un testo di massimo %d caratteri", max)
+		}
+		return s, nil
+	}
+}
+
+func checkCode(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !reAlloggiatiCode.MatchString(s) {
+		return "", fmt.Errorf("serve il codice a 9 cifre della tabella Alloggiati Web")
+	}
+	return s, nil
+}
+
+func checkDate(s string) (string, error) {
+	d, err := time.Parse("02/01/2006", strings.TrimSpace(s))
+	if err != nil || d.After(time.Now()) {
+		return "", fmt.Errorf("formato data gg/mm/aaaa")
+	}
+	return d.Format("2006-01-02"), nil
+}
+
+func isMember(v map[string]string) bool {
+	t := v["guest_type"]
+	return t == strconv.Itoa(alloggiatoFamiliare) || t == strconv.Itoa(alloggiatoMembro)
+}
+
+func bornAbroad(v map[string]string) bool { return v["birth_country"] != alloggiatiItaly }
+
+var guestDocSteps = []guestDocStep{
+	{key: "guest_type", prompt: "Tipo di ospite?", buttons: []telegram.Button{
+		{Text: "Singolo", CallbackData: "gdoc:16"},
+		{Text: "Capofamiglia", CallbackData: "gdoc:17"},
+		{Text: "Capogruppo", CallbackData: "gdoc:18"},
+		{Text: "Familiare", CallbackData: "gdoc:19"},
+		{Text: "Membro gruppo", CallbackData: "gdoc:20"},
+	}},
+	{key: "surname", prompt: "Cognome?", check: checkText(50)},
+	{key: "given_name", prompt: "Nome?", check: checkText(30)},
+	{key: "sex", prompt: "Sesso?", buttons: []telegram.Button{
+		{Text: "M", CallbackData: "gdoc:M"},
+		{Text: "F", CallbackData: "gdoc:F"},
+	}},
+	{key: "birth_date", prompt: "Data di nascita (gg/mm/aaaa)?", check: checkDate},
+	{key: "birth_country", prompt: "Stato di nascita (codice a 9 cifre; Italia = " + alloggiatiItaly + ")?", check: checkCode},
+	{key: "birth_comune", prompt: "Comune di nascita (codice a 9 cifre)?", check: checkCode, skip: bornAbroad},
+	{key: "birth_province", prompt: "Provincia di nascita (sigla, es. RM)?", skip: bornAbroad,
+		check: func(s string) (string, error) {
+			s = strings.ToUpper(strings.TrimSpace(s))
+			if !reProvince.MatchString(s) {
+				return "", fmt.Errorf("serve la sigla di due lettere")
+			}
+			return s, nil
+		}},
+	{key: "citizenship", prompt: "Cittadinanza (codice a 9 cifre)?", check: checkCode},
+	{key: "doc_type", prompt: "Tipo di documento?", skip: isMember, buttons: []telegram.Button{
+		{Text: "Carta d'identità", CallbackData: "gdoc:IDENT"},
+		{Text: "Passaporto", CallbackData: "gdoc:PASOR"},
+		{Text: "Patente", CallbackData: "gdoc:PATEN"},
+	}},
+	{key: "doc_number", prompt: "Numero del documento?", check: checkText(20), skip: isMember},
+	{key: "doc_issued_at", prompt: "Luogo di rilascio (codice comune o stato a 9 cifre)?", check: checkCode, skip: isMember},
+}
+
+// Register wires /documento, the gdoc:* buttons and free-text capture.
+func (g *GuestDocs) Register(m *routedMessenger) {
+	g.messenger = m
+	m.Handle("/documento", g.handleCommand)
+	m.Handle("gdoc:", g.handleAnswer)
+}
+
+// Tools implements agent.ToolSet.
+func (g *GuestDocs) Tools() []agent.Tool {
+	return []agent.Tool{&exportAlloggiatiTool{docs: g}}
+}
+
+// Start launches the retention purge goroutine.
+func (g *GuestDocs) Start(ctx context.Context) {
+	days := 7
+	if v := envOr("GUEST_DOCS_RETENTION_DAYS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			days = n
+		} else {
+			log.Printf("guest docs: invalid GUEST_DOCS_RETENTION_DAYS=%q, using %d", v, days)
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			tag, err := g.adminPool.Exec(ctx,
+				`DELETE FROM guest_documents gd USING reservations res
+				 WHERE res.id = gd.reservation_id AND res.checkout_at < now() - make_interval(days => $1)`, days)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("guest docs: purge: %v", err)
+			} else if n := tag.RowsAffected(); n > 0 {
+				log.Printf("guest docs: purged %d document(s) past retention", n)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (g *GuestDocs) isManager(ctx context.Context, userID int64) bool {
+	var role string
+	_ = g.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, userID).Scan(&role)
+	return Role(role) == RoleManager
+}
+
+func (g *GuestDocs) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := newBot(g.botToken)
+	if !g.isManager(ctx, u.UserID) {
+		return tg.Send(ctx, u.ChatID, "🔒 La registrazione dei documenti è riservata ai manager.")
+	}
+	arg := strings.TrimSpace(strings.TrimPrefix(u.Text, "/documento"))
+	resID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, "Uso: /documento <id prenotazione>. Ripeti per ogni ospite; /annulla per interrompere.")
+	}
+	hotelID, err := hotelOf(ctx, g.adminPool, u.UserID)
+	if err != nil {
+		return err
+	}
+	var guest string
+	if err := g.adminPool.QueryRow(ctx,
+		`SELECT COALESCE(guest_name, '') FROM reservations WHERE id = $1 AND hotel_id = $2`, resID, hotelID,
+	).Scan(&guest); err != nil {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("Prenotazione %d non trovata.", resID))
+	}
+
+	d := &guestDocDraft{reservationID: resID, guestName: guest, values: make(map[string]string), startedAt: time.Now()}
+	g.mu.Lock()
+	g.drafts[u.ChatID] = d
+	g.mu.Unlock()
+	g.messenger.Capture(u.ChatID, g.handleAnswer)
+
+	if err := tg.Send(ctx, u.ChatID, fmt.Sprintf(
+		"🪪 Registrazione documento — prenotazione %d (%s).\nI dati restano fuori dalla chat con l'assistente. /annulla per interrompere.",
+		resID, guest)); err != nil {
+		return err
+	}
+	return g.ask(ctx, u.ChatID, d)
+}
+
+// handleAnswer receives both button values ("gdoc:<v>") and captured text.
+func (g *GuestDocs) handleAnswer(ctx context.Context, u agent.Update) error {
+	tg := newBot(g.botToken)
+	g.mu.Lock()
+	d := g.drafts[u.ChatID]
+	g.mu.Unlock()
+	if d == nil || time.Since(d.startedAt) > time.Hour {
+		g.stop(u.ChatID)
+		if strings.HasPrefix(u.Text, "gdoc:") {
+			return tg.Send(ctx, u.ChatID, "Registrazione scaduta: ricomincia con /documento <id prenotazione>.")
+		}
+		return nil
+	}
+	if strings.TrimSpace(u.Text) == "/annulla" {
+		g.stop(u.ChatID)
+		return tg.Send(ctx, u.ChatID, "Registrazione annullata, nessun dato salvato.")
+	}
+
+	step := guestDocSteps[d.step]
+	value, isButton := strings.CutPrefix(u.Text, "gdoc:")
+	switch {
+	case step.buttons != nil && !isButton:
+		return tg.Send(ctx, u.ChatID, "Usa i bottoni qui sopra.")
+	case step.buttons == nil && isButton:
+		return nil // stale button from an earlier step
+	case step.check != nil:
+		v, err := step.check(value)
+		if err != nil {
+			return tg.Send(ctx, u.ChatID, "❌ "+err.Error()+". Riprova.")
+		}
+		value = v
+	}
+	d.values[step.key] = value
+
+	d.step++
+	for d.step < len(guestDocSteps) && guestDocSteps[d.step].skip != nil && guestDocSteps[d.step].skip(d.values) {
+		d.step++
+	}
+	if d.step < len(guestDocSteps) {
+		return g.ask(ctx, u.ChatID, d)
+	}
+
+	g.stop(u.ChatID)
+	if err := g.save(ctx, u.UserID, d); err != nil {
+		log.Printf("guest docs: save: %v", err)
+		return tg.Send(ctx, u.ChatID, "❌ Non sono riuscito a salvare il documento. Riprova con /documento.")
+	}
+	return tg.Send(ctx, u.ChatID, fmt.Sprintf("✅ Documento di %s %s registrato per la prenotazione %d.",
+		d.values["given_name"], d.values["surname"], d.reservationID))
+}
+
+func (g *GuestDocs) ask(ctx context.Context, chatID int64, d *guestDocDraft) error {
+	step := guestDocSteps[d.step]
+	if step.buttons != nil {
+		_, err := sendKeyboard(ctx, g.botToken, chatID, step.prompt, [][]telegram.Button{step.buttons})
+		return err
+	}
+	return newBot(g.botToken).Send(ctx, chatID, step.prompt)
+}
+
+func (g *GuestDocs) stop(chatID int64) {
+	g.mu.Lock()
+	delete(g.drafts, chatID)
+	g.mu.Unlock()
+	g.messenger.Release(chatID)
+}
+
+func (g *GuestDocs) save(ctx context.Context, userID int64, d *guestDocDraft) error {
+	v := d.values
+	nullable := func(k string) *string {
+		if s, ok := v[k]; ok {
+			return &s
+		}
+		return nil
+	}
+	guestType, _ := strconv.Atoi(v["guest_type"])
+	_, err := g.adminPool.Exec(ctx,
+		`INSERT INTO guest_documents (reservation_id, guest_type, surname, given_name, sex, birth_date,
+		   birth_comune, birth_province, birth_country, citizenship, doc_type, doc_number, doc_issued_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		d.reservationID, guestType, v["surname"], v["given_name"], v["sex"], v["birth_date"],
+		nullable("birth_comune"), nullable("birth_province"), v["birth_country"], v["citizenship"],
+		nullable("doc_type"), nullable("doc_number"), nullable("doc_issued_at"), userID,
+	)
+	return err
+}
+
+// ── export_alloggiati ────────────────────────────────────────────────────────
+
+type exportAlloggiatiTool struct {
+	docs *GuestDocs
+}
+
+func (t *exportAlloggiatiTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "export_alloggiati",
+		Description: "Genera il file per Alloggiati Web (Polizia di Stato) con gli ospiti arrivati in una data, " +
+			"e lo invia come documento nella chat del manager. I dati dei documenti non passano dall'assistente: " +
+			"il tool restituisce solo un riepilogo. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {
+					"type": "string",
+					"description": "Data di arrivo YYYY-MM-DD (default: oggi)"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *exportAlloggiatiTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	bg := context.Background()
+	if !t.docs.isManager(bg, ctx.UserID) {
+		return "", fmt.Errorf("export_alloggiati is only available to managers")
+	}
+	var in struct {
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	day := time.Now().In(loc)
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		day = d
+	}
+
+	hotelID, err := hotelOf(bg, t.docs.adminPool, ctx.UserID)
+	if err != nil {
+		return "", err
+	}
+	file, ids, missing, err := t.docs.export(bg, day, hotelID)
+	if err != nil {
+		return "", err
+	}
+	var notes []string
+	if missing > 0 {
+		notes = append(notes, fmt.Sprintf("⚠️ %d prenotazioni in arrivo senza documenti registrati (usa /documento <id>).", missing))
+	}
+	if len(ids) == 0 {
+		return strings.Join(append([]string{"Nessun documento da esportare per il " + day.Format("02/01/2006") + "."}, notes...), "\n"), nil
+	}
+
+	name := "alloggiati_" + day.Format("20060102") + ".txt"
+	if err := sendDocument(bg, t.docs.botToken, ctx.ChatID, name, file,
+		"Da caricare su alloggiatiweb.poliziadistato.it (Invio file)"); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	if _, err := t.docs.adminPool.Exec(bg,
+		`UPDATE guest_documents SET reported_at = now() WHERE id = ANY($1)`, ids,
+	); err != nil {
+		log.Printf("guest docs: mark reported: %v", err)
+	}
+	return strings.Join(append([]string{fmt.Sprintf("📄 File %s inviato in chat: %d ospiti.", name, len(ids))}, notes...), "\n"), nil
+}
+
+// export builds the Alloggiati Web file for arrivals on day at property
+// hotelID. It also returns the exported row ids and how many arriving
+// reservations have no document.
+func (g *GuestDocs) export(ctx context.Context, day time.Time, hotelID int) ([]byte, []int64, int, error) {
+	rows, err := g.adminPool.Query(ctx,
+		`SELECT gd.id, gd.guest_type, res.checkin_at,
+		        GREATEST(1, (res.checkout_at AT TIME ZONE 'Europe/Rome')::date - (res.checkin_at AT TIME ZONE 'Europe/Rome')::date),
+		        gd.surname, gd.given_name, gd.sex, gd.birth_date,
+		        COALESCE(gd.birth_comune, ''), COALESCE(gd.birth_province, ''), gd.birth_country, gd.citizenship,
+		        COALESCE(gd.doc_type, ''), COALESCE(gd.doc_number, ''), COALESCE(gd.doc_issued_at, '')
+		 FROM guest_documents gd JOIN reservations res ON res.id = gd.reservation_id
+		 WHERE (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1 AND gd.hotel_id = $2
+		 ORDER BY res.id, gd.guest_type, gd.id`, day, hotelID,
+	)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("query documents: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	var ids []int64
+	for rows.Next() {
+		var (
+			id                                              int64
+			guestType, nights                               int
+			arrival, birth                                  time.Time
+			surname, given, sex, comune, prov, state, citiz string
+			docType, docNum, docPlace                       string
+		)
+		if err := rows.Scan(&id, &guestType, &arrival, &nights, &surname, &given, &sex, &birth,
+			&comune, &prov, &state, &citiz, &docType, &docNum, &docPlace); err != nil {
+			return nil, nil, 0, err
+		}
+		sexCode := "1"
+		if sex == "F" {
+			sexCode = "2"
+		}
+		// Fixed-width record, 168 characters (Alloggiati Web "tracciato record").
+		sb.WriteString(fixedWidth(strconv.Itoa(guestType), 2))
+		sb.WriteString(fixedWidth(arrival.In(romeLocation()).Format("02/01/2006"), 10))
+		sb.WriteString(fixedWidth(strconv.Itoa(min(nights, 30)), 2))
+		sb.WriteString(fixedWidth(strings.ToUpper(surname), 50))
+		sb.WriteString(fixedWidth(strings.ToUpper(given), 30))
+		sb.WriteString(sexCode)
+		sb.WriteString(birth.Format("02/01/2006"))
+		sb.WriteString(fixedWidth(comune, 9))
+		sb.WriteString(fixedWidth(prov, 2))
+		sb.WriteString(fixedWidth(state, 9))
+		sb.WriteString(fixedWidth(citiz, 9))
+		sb.WriteString(fixedWidth(docType, 5))
+		sb.WriteString(fixedWidth(strings.ToUpper(docNum), 20))
+		sb.WriteString(fixedWidth(docPlace, 9))
+		sb.WriteString("\r\n")
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var missing int
+	if err := g.adminPool.QueryRow(ctx,
+		`SELECT count(*) FROM reservations res
+		 WHERE res.status = 'confirmed' AND res.hotel_id = $2
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1
+		   AND NOT EXISTS (SELECT 1 FROM guest_documents gd WHERE gd.reservation_id = res.id)`, day, hotelID,
+	).Scan(&missing); err != nil {
+		return nil, nil, 0, fmt.Errorf("count missing: %w", err)
+	}
+	return []byte(sb.String()), ids, missing, nil
+}
+
+// fixedWidth pads s with spaces (or truncates it) to exactly n runes.
+func fixedWidth(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s + strings.Repeat(" ", n-len(r))
+}
@@ -0,0 +1,981 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"mime"
+	"net/smtp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Guest messages: the booking confirmation, the practical information before
+// arrival, the checkout instructions. A guest_message_templates
+// row is the text, with {placeholders} filled from the reservation, and the
+// moment it goes out: on booking (once the reservation is confirmed),
+// offset_minutes before the checkin or the checkout, or only by hand
+// (manual, send_guest_message).
+//
+// Every minute the automatic messages due are sent to the guests of the
+// reservation: on Telegram when they redeemed a guest invite (the bot's own
+// messages are translated into their language, language.go), otherwise by
+// email to the address in their profile. guest_messages records each send;
+// its unique index on (reservation, template) keeps an automatic message
+// from going out twice, and the row is written before sending, so a crash
+// can lose a message but never repeat it. A message that could not go out
+// is recorded with its error and the managers are told.
+//
+// A template with needs_approval is not sent on its own: the message is
+// written 'queued' and the managers get it with the buttons "gmsg:ok:<id>"
+// (send it now) and "gmsg:no:<id>" (discard it). The same happens when the
+// text uses hotel info (hotelinfo.go) nobody has filled in yet, so a guest
+// never receives "Wi-Fi: " followed by nothing.
+//
+// The default templates are seeded suspended: nothing reaches a guest until
+// a manager reads and turns them on (set_guest_message_template). A template
+// only covers the moments after it was turned on (active_since), so enabling
+// one does not send it to every reservation already on the books.
+//
+// Configure via env:
+//
+//	SMTP_HOST=smtp.example.com   enables email; unset = Telegram only
+//	SMTP_PORT=587
+//	SMTP_USER / SMTP_PASSWORD    credentials, when the server asks for them
+//	SMTP_FROM=info@hotel.it      sender (default SMTP_USER)
+
+var defaultGuestMessageTemplates = []struct {
+	code, event, subject, body string
+	offset                     int
+	approval                   bool
+}{
+	{"conferma", "booking", "Conferma prenotazione {hotel}",
+		"Gentile {guest},\nla sua prenotazione presso {hotel} è confermata: camera {room}, arrivo {checkin_date} " +
+			"dalle {checkin_time}, partenza {checkout_date} entro le {checkout_time} ({nights} notti, {guests} persone, {board}).\n" +
+			"Numero di prenotazione: {reservation_id}. A presto!", 0, false},
+	{"info_arrivo", "checkin", "Informazioni per il suo arrivo a {hotel}",
+		"Gentile {guest},\nmancano pochi giorni al suo arrivo a {hotel}, {checkin_date}. Qualche informazione utile:\n" +
+			"📍 Come arrivare: {directions}\n🕐 Check-in: dalle {checkin_time}. {checkin_info}\n" +
+			"🅿️ Parcheggio: {parking}\n📶 Wi-Fi: {wifi}\nBuon viaggio!", 4320, true},
+	{"pre_arrivo", "checkin", "Il suo arrivo a {hotel}",
+		"Gentile {guest},\nla aspettiamo {checkin_date} a {hotel}: la camera {room} è pronta dalle {checkin_time}. " +
+			"Al suo arrivo le chiederemo un documento d'identità per ogni ospite. Buon viaggio!", 1440, false},
+	{"checkout", "checkout", "La sua partenza da {hotel}",
+		"Gentile {guest},\nle ricordiamo che la partenza è {checkout_date} entro le {checkout_time}: lasci la chiave " +
+			"alla reception. Grazie per aver soggiornato da noi!", 720, false},
+}
+
+var guestMessageEvents = map[string]string{
+	"booking":  "alla conferma della prenotazione",
+	"checkin":  "prima dell'arrivo",
+	"checkout": "prima della partenza",
+	"manual":   "solo a mano",
+}
+
+// guestMessageVars are the placeholders a template can use.
+var guestMessageVars = []string{"guest", "hotel", "room", "checkin_date", "checkin_time", "checkout_date",
+	"checkout_time", "nights", "guests", "board", "amount", "reservation_id",
+	"directions", "checkin_info", "parking", "wifi"}
+
+var guestPlaceholderRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// errNoGuestChannel: the guests of the reservation have neither a Telegram
+// chat with the bot nor an email address (or email is not configured).
+var errNoGuestChannel = errors.New("nessun canale: l'ospite non ha usato un invito (generate_invite) e non c'è un'email nel profilo")
+
+// GuestMessenger provides the guest message tools and sends the automatic
+// messages.
+type GuestMessenger struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+}
+
+func newGuestMessenger(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *GuestMessenger {
+	return &GuestMessenger{adminPool: adminPool, registry: registry, botToken: botToken}
+}
+
+// Register wires the approval buttons into the messenger.
+func (gm *GuestMessenger) Register(m *routedMessenger) {
+	m.Handle("gmsg:", gm.handleButton)
+}
+
+// Tools implements agent.ToolSet.
+func (gm *GuestMessenger) Tools() []agent.Tool {
+	return []agent.Tool{&guestMessageTemplatesTool{}, &setGuestMessageTemplateTool{}, &sendGuestMessageTool{gm: gm}}
+}
+
+// seedGuestMessageTemplates adds the default templates, suspended, to every
+// property. Templates edited or deleted by managers are kept as they are.
+func seedGuestMessageTemplates(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, t := range defaultGuestMessageTemplates {
+		if _, err := pool.Exec(ctx,
+			`INSERT INTO guest_message_templates (hotel_id, code, event, offset_minutes, subject, body, needs_approval)
+			 SELECT id, $1, $2, $3, $4, $5, $6 FROM hotels
+			 ON CONFLICT (hotel_id, code) DO NOTHING`,
+			t.code, t.event, t.offset, t.subject, t.body, t.approval,
+		); err != nil {
+			return fmt.Errorf("seed guest message template %s: %w", t.code, err)
+		}
+	}
+	return nil
+}
+
+// checkGuestPlaceholders refuses placeholders that renderGuestMessage would
+// not know.
+func checkGuestPlaceholders(texts ...string) error {
+	var unknown []string
+	for _, s := range texts {
+		for _, m := range guestPlaceholderRe.FindAllStringSubmatch(s, -1) {
+			if !slices.Contains(guestMessageVars, m[1]) {
+				unknown = append(unknown, "{"+m[1]+"}")
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown placeholders %s; available: {%s}", strings.Join(unknown, ", "),
+			strings.Join(guestMessageVars, "}, {"))
+	}
+	return nil
+}
+
+// loadGuestMessageVars reads the placeholder values of a reservation.
+func loadGuestMessageVars(ctx context.Context, db querier, resID int64) (map[string]string, error) {
+	var guest, hotel, room, board, spot, spotKind string
+	var checkin, checkout time.Time
+	var guests, hotelID int
+	var amount *float64
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(res.guest_name, ''), h.name, r.name, res.checkin_at, res.checkout_at, res.guests, res.board,
+		        res.amount_eur::float8, res.hotel_id, COALESCE(p.label, ''), COALESCE(p.kind, '')
+		 FROM reservations res
+		 JOIN rooms r ON r.id = res.room_id
+		 JOIN hotels h ON h.id = res.hotel_id
+		 LEFT JOIN parking_spots p ON p.id = res.parking_spot_id
+		 WHERE res.id = $1`, resID).Scan(&guest, &hotel, &room, &checkin, &checkout, &guests, &board, &amount,
+		&hotelID, &spot, &spotKind)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("reservation %d not found", resID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if guest == "" {
+		guest = "ospite"
+	}
+	loc := romeLocation()
+	vars := map[string]string{
+		"guest":          guest,
+		"hotel":          hotel,
+		"room":           room,
+		"checkin_date":   checkin.In(loc).Format("02/01/2006"),
+		"checkin_time":   checkin.In(loc).Format("15:04"),
+		"checkout_date":  checkout.In(loc).Format("02/01/2006"),
+		"checkout_time":  checkout.In(loc).Format("15:04"),
+		"nights":         fmt.Sprint(len(nightsBetween(checkin, checkout))),
+		"guests":         fmt.Sprint(guests),
+		"board":          boardTypes[board],
+		"amount":         "da definire",
+		"reservation_id": fmt.Sprint(resID),
+	}
+	if amount != nil {
+		vars["amount"] = fmt.Sprintf("%.2f €", *amount)
+	}
+	info, err := loadHotelInfo(ctx, db, hotelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ti := range hotelInfoTopics {
+		vars[ti.placeholder] = info[ti.topic]
+	}
+	if spot != "" {
+		parking := fmt.Sprintf("posto auto %s (%s) riservato per lei.", spot, parkingKinds[spotKind])
+		if info["parking"] != "" {
+			parking += " " + info["parking"]
+		}
+		vars["parking"] = parking
+	}
+	return vars, nil
+}
+
+// missingGuestInfo lists the hotel info the texts use that is still empty
+// for this reservation.
+func missingGuestInfo(vars map[string]string, texts ...string) []string {
+	var missing []string
+	for _, ti := range hotelInfoTopics {
+		for _, s := range texts {
+			if strings.Contains(s, "{"+ti.placeholder+"}") && vars[ti.placeholder] == "" {
+				missing = append(missing, ti.topic)
+				break
+			}
+		}
+	}
+	return missing
+}
+
+func renderGuestMessage(tmpl string, vars map[string]string) string {
+	return guestPlaceholderRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		if v, ok := vars[m[1:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// guestContacts are where the guests of a reservation can be reached.
+type guestContacts struct {
+	chats []int64 // guest users who redeemed an invite for it
+	email string  // from the linked guest profile
+}
+
+func loadGuestContacts(ctx context.Context, db querier, resID int64) (guestContacts, error) {
+	var c guestContacts
+	if err := db.QueryRow(ctx,
+		`SELECT COALESCE(g.email, '') FROM reservations res LEFT JOIN guests g ON g.id = res.guest_id
+		 WHERE res.id = $1`, resID).Scan(&c.email); err != nil {
+		return c, err
+	}
+	rows, err := db.Query(ctx,
+		`SELECT DISTINCT i.used_by FROM invites i JOIN users u ON u.telegram_id = i.used_by
+		 WHERE i.reservation_id = $1 AND i.role = 'guest' AND u.role = 'guest'`, resID)
+	if err != nil {
+		return c, err
+	}
+	c.chats, err = pgx.CollectRows(rows, pgx.RowTo[int64])
+	return c, err
+}
+
+// channelFor picks how to reach c: "auto" prefers the guest's Telegram chat.
+func (c guestContacts) channelFor(channel string) (string, error) {
+	telegramOK, emailOK := len(c.chats) > 0, c.email != "" && mailConfigured()
+	switch {
+	case channel == "telegram" && !telegramOK:
+		return "", fmt.Errorf("l'ospite non ha un chat con il bot: mandagli un invito (generate_invite con role guest)")
+	case channel == "email" && c.email == "":
+		return "", fmt.Errorf("nessuna email nel profilo dell'ospite")
+	case channel == "email" && !emailOK:
+		return "", fmt.Errorf("l'email non è configurata (SMTP_HOST)")
+	case channel == "telegram" || channel == "email":
+		return channel, nil
+	case telegramOK:
+		return "telegram", nil
+	case emailOK:
+		return "email", nil
+	}
+	return "", errNoGuestChannel
+}
+
+// send delivers a message over channel and returns the recipient it
+// reached, as recorded in guest_messages.
+func (gm *GuestMessenger) send(ctx context.Context, c guestContacts, channel, subject, body string) (string, error) {
+	if channel == "email" {
+		return c.email, sendEmail(c.email, subject, body)
+	}
+	var sent []string
+	var lastErr error
+	tg := newBot(gm.botToken)
+	for _, chat := range c.chats {
+		if err := tg.Send(ctx, chat, body); err != nil {
+			lastErr = err
+			continue
+		}
+		sent = append(sent, fmt.Sprint(chat))
+	}
+	if len(sent) == 0 {
+		return "", fmt.Errorf("telegram: %w", lastErr)
+	}
+	return "telegram " + strings.Join(sent, ", "), nil
+}
+
+func mailConfigured() bool {
+	return envOr("SMTP_HOST", "") != ""
+}
+
+// sendEmail sends a plain-text UTF-8 email through SMTP_HOST.
+func sendEmail(to, subject, body string) error {
+	host := envOr("SMTP_HOST", "")
+	if host == "" {
+		return fmt.Errorf("email not configured (SMTP_HOST)")
+	}
+	user := envOr("SMTP_USER", "")
+	from := envOr("SMTP_FROM", user)
+	if from == "" {
+		return fmt.Errorf("email sender not configured (SMTP_FROM)")
+	}
+	var auth smtp.Auth
+	if user != "" {
+		auth = smtp.PlainAuth("", user, envOr("SMTP_PASSWORD", ""), host)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", from, to,
+		mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n") + "\r\n")
+	addr := host + ":" + envOr("SMTP_PORT", "587")
+	if err := smtp.SendMail(addr, auth, from, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// Start launches the goroutine sending the automatic messages.
+func (gm *GuestMessenger) Start(ctx context.Context) {
+	go func() {
+		log.Printf("guest messages started")
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			gm.sendDue(ctx)
+			select {
+			case <-ctx.Done():
+				log.Printf("guest messages stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type dueGuestMessage struct {
+	templateID          int64
+	code, subject, body string
+	approval            bool
+	resID               int64
+	hotelID             int
+}
+
+func (gm *GuestMessenger) sendDue(ctx context.Context) {
+	// A checkin message still goes out late as long as the guest has not
+	// arrived; a booking or checkout one until the checkout.
+	rows, err := gm.adminPool.Query(ctx,
+		`SELECT t.id, t.code, t.subject, t.body, t.needs_approval, res.id, res.hotel_id
+		 FROM guest_message_templates t
+		 JOIN reservations res ON res.hotel_id = t.hotel_id AND res.status = 'confirmed'
+		 CROSS JOIN LATERAL (SELECT CASE t.event
+		     WHEN 'booking' THEN res.created_at
+		     WHEN 'checkin' THEN res.checkin_at - make_interval(mins => t.offset_minutes)
+		     ELSE res.checkout_at - make_interval(mins => t.offset_minutes) END AS at) d
+		 WHERE t.active AND t.event <> 'manual'
+		   AND d.at <= now() AND d.at >= t.active_since
+		   AND res.checkout_at > now()
+		   AND (t.event <> 'checkin' OR res.checkin_at > now())
+		   AND NOT EXISTS (SELECT 1 FROM guest_messages m
+		                   WHERE m.reservation_id = res.id AND m.template_id = t.id AND m.sent_by IS NULL)
+		 ORDER BY d.at
+		 LIMIT 50`)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("guest messages: %v", err)
+		}
+		return
+	}
+	var due []dueGuestMessage
+	for rows.Next() {
+		var m dueGuestMessage
+		if err := rows.Scan(&m.templateID, &m.code, &m.subject, &m.body, &m.approval, &m.resID, &m.hotelID); err != nil {
+			log.Printf("guest messages scan: %v", err)
+			continue
+		}
+		due = append(due, m)
+	}
+	rows.Close()
+	for _, m := range due {
+		gm.sendAutomatic(ctx, m)
+	}
+}
+
+func (gm *GuestMessenger) sendAutomatic(ctx context.Context, m dueGuestMessage) {
+	vars, err := loadGuestMessageVars(ctx, gm.adminPool, m.resID)
+	if err != nil {
+		log.Printf("guest messages %s (reservation %d): %v", m.code, m.resID, err)
+		return
+	}
+	subject, body := renderGuestMessage(m.subject, vars), renderGuestMessage(m.body, vars)
+	missing := missingGuestInfo(vars, m.subject, m.body)
+	status := "sent"
+	if m.approval || len(missing) > 0 {
+		status = "queued"
+	}
+	var msgID int64
+	err = gm.adminPool.QueryRow(ctx,
+		`INSERT INTO guest_messages (hotel_id, reservation_id, template_id, subject, body, status)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (reservation_id, template_id) WHERE sent_by IS NULL DO NOTHING
+		 RETURNING id`, m.hotelID, m.resID, m.templateID, subject, body, status).Scan(&msgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return // already sent
+	}
+	if err != nil {
+		log.Printf("guest messages claim %s (reservation %d): %v", m.code, m.resID, err)
+		return
+	}
+	if status == "queued" {
+		log.Printf("guest messages: %s for reservation %d queued for approval", m.code, m.resID)
+		gm.askManagers(ctx, msgID, m.code, vars, body, missing)
+		return
+	}
+	gm.deliver(ctx, msgID, m.code, m.resID, vars, subject, body)
+}
+
+// deliver sends a claimed automatic message, records the outcome and tells
+// the managers when it could not go out.
+func (gm *GuestMessenger) deliver(ctx context.Context, msgID int64, code string, resID int64, vars map[string]string, subject, body string) error {
+	var channel, recipient string
+	contacts, err := loadGuestContacts(ctx, gm.adminPool, resID)
+	if err == nil {
+		channel, err = contacts.channelFor("auto")
+	}
+	if err == nil {
+		recipient, err = gm.send(ctx, contacts, channel, subject, body)
+	}
+	var errText *string
+	if err != nil {
+		s := err.Error()
+		errText = &s
+	}
+	if _, uerr := gm.adminPool.Exec(ctx,
+		`UPDATE guest_messages SET channel = NULLIF($2, ''), recipient = NULLIF($3, ''), error = $4 WHERE id = $1`,
+		msgID, channel, recipient, errText); uerr != nil {
+		log.Printf("guest messages record %d: %v", msgID, uerr)
+	}
+	if err == nil {
+		log.Printf("guest messages: %s sent for reservation %d (%s)", code, resID, channel)
+		return nil
+	}
+	log.Printf("guest messages: %s for reservation %d not sent: %v", code, resID, err)
+	managers, merr := gm.messageManagers(ctx, msgID)
+	if merr != nil {
+		log.Printf("guest messages: %v", merr)
+		return err
+	}
+	note := fmt.Sprintf("✉️ Il messaggio «%s» per %s (camera %s, prenotazione %d) non è partito: %v.\n"+
+		"Puoi mandarlo a mano con send_guest_message.", code, vars["guest"], vars["room"], resID, err)
+	tg := newBot(gm.botToken)
+	for _, id := range managers {
+		if err := tg.Send(ctx, id, note); err != nil {
+			log.Printf("guest messages notify %d: %v", id, err)
+		}
+	}
+	return err
+}
+
+// askManagers sends a queued message to the managers with the approval
+// buttons, saying which hotel info it lacks, if any.
+func (gm *GuestMessenger) askManagers(ctx context.Context, msgID int64, code string, vars map[string]string, body string, missing []string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✉️ <b>Messaggio «%s»</b> per %s (camera %s, prenotazione %s), da approvare:\n\n%s",
+		htmlpkg.EscapeString(code), htmlpkg.EscapeString(vars["guest"]), htmlpkg.EscapeString(vars["room"]),
+		vars["reservation_id"], htmlpkg.EscapeString(body))
+	if len(missing) > 0 {
+		fmt.Fprintf(&sb, "\n\n⚠️ Mancano le informazioni: %s. Compilale con hotel_info prima di approvare, "+
+			"oppure scartalo e mandane uno a mano (send_guest_message).", strings.Join(missing, ", "))
+	}
+	sid := strconv.FormatInt(msgID, 10)
+	buttons := [][]telegram.Button{{
+		{Text: "✅ Invia", CallbackData: "gmsg:ok:" + sid},
+		{Text: "🗑 Scarta", CallbackData: "gmsg:no:" + sid},
+	}}
+	managers, err := gm.messageManagers(ctx, msgID)
+	if err != nil {
+		log.Printf("guest messages: %v", err)
+		return
+	}
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, gm.botToken, m, sb.String(), buttons); err != nil {
+			log.Printf("guest messages: ask manager %d: %v", m, err)
+		}
+	}
+}
+
+// messageManagers returns the managers of the property guest message msgID
+// belongs to.
+func (gm *GuestMessenger) messageManagers(ctx context.Context, msgID int64) ([]int64, error) {
+	var hotelID int
+	if err := gm.adminPool.QueryRow(ctx, `SELECT hotel_id FROM guest_messages WHERE id = $1`, msgID).Scan(&hotelID); err != nil {
+		return nil, fmt.Errorf("guest message %d: %w", msgID, err)
+	}
+	return managerIDs(ctx, gm.adminPool, hotelID)
+}
+
+// handleButton sends ("ok") or discards ("no") a queued message. The text
+// is rendered again on approval, so hotel info filled in meanwhile is used.
+func (gm *GuestMessenger) handleButton(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed guest message callback")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad guest message id: %w", err)
+	}
+	tg := newBot(gm.botToken)
+	var role string
+	_ = gm.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	db, err := gm.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+
+	var resID int64
+	var code, subject, body string
+	var live bool
+	switch parts[1] {
+	case "ok":
+		err = db.QueryRow(ctx,
+			`UPDATE guest_messages m SET status = 'sent', approved_by = $2, sent_at = now()
+			 FROM reservations res
+			 WHERE m.id = $1 AND m.status = 'queued' AND res.id = m.reservation_id
+			 RETURNING m.reservation_id,
+			           COALESCE((SELECT code FROM guest_message_templates WHERE id = m.template_id), 'messaggio'),
+			           COALESCE((SELECT subject FROM guest_message_templates WHERE id = m.template_id), m.subject, ''),
+			           COALESCE((SELECT body FROM guest_message_templates WHERE id = m.template_id), m.body),
+			           res.status = 'confirmed' AND res.checkout_at > now()`,
+			id, u.UserID).Scan(&resID, &code, &subject, &body, &live)
+	case "no":
+		err = db.QueryRow(ctx,
+			`UPDATE guest_messages m SET status = 'discarded', approved_by = $2
+			 WHERE m.id = $1 AND m.status = 'queued'
+			 RETURNING m.reservation_id,
+			           COALESCE((SELECT code FROM guest_message_templates WHERE id = m.template_id), 'messaggio')`,
+			id, u.UserID).Scan(&resID, &code)
+	default:
+		return fmt.Errorf("unknown guest message action %q", parts[1])
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return tg.Send(ctx, u.ChatID, "Messaggio già gestito.")
+	}
+	if err != nil {
+		return fmt.Errorf("decide guest message %d: %w", id, err)
+	}
+	if parts[1] == "no" {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("🗑 Messaggio «%s» della prenotazione %d scartato.", code, resID))
+	}
+	if !live {
+		if _, err := db.Exec(ctx, `UPDATE guest_messages SET status = 'discarded' WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("discard guest message %d: %w", id, err)
+		}
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("La prenotazione %d è cancellata o conclusa: messaggio «%s» scartato.", resID, code))
+	}
+	vars, err := loadGuestMessageVars(ctx, gm.adminPool, resID)
+	if err != nil {
+		return err
+	}
+	subject, body = renderGuestMessage(subject, vars), renderGuestMessage(body, vars)
+	if _, err := gm.adminPool.Exec(ctx,
+		`UPDATE guest_messages SET subject = $2, body = $3 WHERE id = $1`, id, subject, body); err != nil {
+		return fmt.Errorf("update guest message %d: %w", id, err)
+	}
+	if err := gm.deliver(ctx, id, code, resID, vars, subject, body); err != nil {
+		return nil // the managers were told by deliver
+	}
+	return tg.Send(ctx, u.ChatID, fmt.Sprintf("✉️ Messaggio «%s» inviato a %s.", code, vars["guest"]))
+}
+
+// ── guest_message_templates ──────────────────────────────────────────────────
+
+type guestMessageTemplatesTool struct{}
+
+func (t *guestMessageTemplatesTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "guest_message_templates",
+		Description: "Elenca i modelli dei messaggi agli ospiti (conferma, info prima dell'arrivo, istruzioni per la partenza…): " +
+			"quando partono, se sono attivi, il testo e i segnaposto disponibili. Solo per i manager.",
+		Parameters: json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (t *guestMessageTemplatesTool) Execute(ctx agent.ToolContext, _ json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("guest_message_templates is only available to managers")
+	}
+	rows, err := db.Query(bg,
+		`SELECT code, event, offset_minutes, subject, body, active, needs_approval FROM guest_message_templates
+		 ORDER BY CASE event WHEN 'booking' THEN 0 WHEN 'checkin' THEN 1 WHEN 'checkout' THEN 2 ELSE 3 END,
+		          offset_minutes DESC, code`)
+	if err != nil {
+		return "", fmt.Errorf("query guest message templates: %w", err)
+	}
+	defer rows.Close()
+	var hotelID int
+	if err := db.QueryRow(bg, `SELECT current_hotel_id()`).Scan(&hotelID); err != nil {
+		return "", fmt.Errorf("current hotel: %w", err)
+	}
+	info, err := loadHotelInfo(bg, db, hotelID)
+	if err != nil {
+		return "", err
+	}
+	infoVars := make(map[string]string)
+	for _, ti := range hotelInfoTopics {
+		infoVars[ti.placeholder] = info[ti.topic]
+	}
+	var sb strings.Builder
+	for rows.Next() {
+		var code, event, subject, body string
+		var offset int
+		var active, approval bool
+		if err := rows.Scan(&code, &event, &offset, &subject, &body, &active, &approval); err != nil {
+			return "", err
+		}
+		when := guestMessageEvents[event]
+		if (event == "checkin" || event == "checkout") && offset > 0 {
+			when = fmt.Sprintf("%s prima %s", formatOffset(offset), strings.TrimPrefix(when, "prima "))
+		}
+		fmt.Fprintf(&sb, "• %s — %s", code, when)
+		if !active {
+			sb.WriteString(" (sospeso)")
+		}
+		if approval {
+			sb.WriteString(" (con approvazione)")
+		}
+		if missing := missingGuestInfo(infoVars, subject, body); len(missing) > 0 {
+			fmt.Fprintf(&sb, " ⚠️ info da compilare (hotel_info): %s", strings.Join(missing, ", "))
+		}
+		fmt.Fprintf(&sb, "\n   Oggetto: %s\n   %s\n", subject, strings.ReplaceAll(body, "\n", "\n   "))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("Nessun modello.\n")
+	}
+	email := "email non configurata (SMTP_HOST): solo Telegram"
+	if mailConfigured() {
+		email = "email attiva"
+	}
+	return fmt.Sprintf("✉️ Messaggi agli ospiti (%s):\n%sSegnaposto: {%s}", email, sb.String(),
+		strings.Join(guestMessageVars, "}, {")), nil
+}
+
+// formatOffset renders minutes as "2 giorni", "12 ore" or "30 minuti".
+func formatOffset(minutes int) string {
+	switch {
+	case minutes%1440 == 0:
+		if minutes == 1440 {
+			return "1 giorno"
+		}
+		return fmt.Sprintf("%d giorni", minutes/1440)
+	case minutes%60 == 0:
+		if minutes == 60 {
+			return "1 ora"
+		}
+		return fmt.Sprintf("%d ore", minutes/60)
+	}
+	return fmt.Sprintf("%d minuti", minutes)
+}
+
+// ── set_guest_message_template ───────────────────────────────────────────────
+
+type setGuestMessageTemplateTool struct{}
+
+func (t *setGuestMessageTemplateTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_guest_message_template",
+		Description: "Crea o modifica (per codice) un modello di messaggio agli ospiti: quando parte (booking = alla conferma, " +
+			"checkin/checkout = hours_before ore prima, manual = solo a mano), oggetto e testo con i segnaposto " +
+			"({guest}, {room}, {checkin_date}, {wifi}…). active=true lo attiva, false lo sospende, delete=true lo elimina. " +
+			"needs_approval=true fa arrivare ogni messaggio ai manager con i pulsanti Invia/Scarta invece di mandarlo da solo. " +
+			"Un modello attivato vale per i momenti successivi, non recupera i messaggi già passati. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"code": {"type": "string", "description": "Codice breve, es. 'pre_arrivo'"},
+				"event": {"type": "string", "enum": ["booking", "checkin", "checkout", "manual"]},
+				"hours_before": {"type": "number", "description": "Ore prima dell'arrivo o della partenza (0-336)"},
+				"subject": {"type": "string", "description": "Oggetto dell'email"},
+				"body": {"type": "string", "description": "Testo, es. 'Gentile {guest}, la aspettiamo il {checkin_date}…'"},
+				"active": {"type": "boolean"},
+				"needs_approval": {"type": "boolean", "description": "I messaggi aspettano l'ok di un manager"},
+				"delete": {"type": "boolean"}
+			},
+			"required": ["code"]
+		}`),
+	}
+}
+
+func (t *setGuestMessageTemplateTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Code        string   `json:"code"`
+		Event       *string  `json:"event"`
+		HoursBefore *float64 `json:"hours_before"`
+		Subject     *string  `json:"subject"`
+		Body        *string  `json:"body"`
+		Active      *bool    `json:"active"`
+		Approval    *bool    `json:"needs_approval"`
+		Delete      bool     `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	in.Code = strings.TrimSpace(in.Code)
+	if in.Code == "" {
+		return "", fmt.Errorf("code is required")
+	}
+	if in.Event != nil {
+		if _, ok := guestMessageEvents[*in.Event]; !ok {
+			return "", fmt.Errorf("event must be booking, checkin, checkout or manual")
+		}
+	}
+	var offset *int
+	if in.HoursBefore != nil {
+		if *in.HoursBefore < 0 || *in.HoursBefore > 336 {
+			return "", fmt.Errorf("hours_before must be between 0 and 336")
+		}
+		m := int(*in.HoursBefore * 60)
+		offset = &m
+	}
+	var texts []string
+	for _, s := range []*string{in.Subject, in.Body} {
+		if s != nil {
+			texts = append(texts, *s)
+		}
+	}
+	if err := checkGuestPlaceholders(texts...); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_guest_message_template is only available to managers")
+	}
+
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM guest_message_templates WHERE code = $1`, in.Code)
+		if err != nil {
+			return "", fmt.Errorf("delete template: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return "", fmt.Errorf("guest message template %q not found", in.Code)
+		}
+		return fmt.Sprintf("✉️ Modello %s eliminato.", in.Code), nil
+	}
+	// Turning a template on starts its clock: only the moments from now on
+	// are covered.
+	var active bool
+	err = db.QueryRow(bg,
+		`UPDATE guest_message_templates SET
+		   event = COALESCE($2, event), offset_minutes = COALESCE($3, offset_minutes),
+		   subject = COALESCE(NULLIF(trim($4), ''), subject), body = COALESCE(NULLIF(trim($5), ''), body),
+		   active_since = CASE WHEN COALESCE($6, active) AND NOT active THEN now() ELSE active_since END,
+		   active = COALESCE($6, active), needs_approval = COALESCE($7, needs_approval)
+		 WHERE code = $1
+		 RETURNING active`,
+		in.Code, in.Event, offset, in.Subject, in.Body, in.Active, in.Approval).Scan(&active)
+	verb := "aggiornato"
+	if errors.Is(err, pgx.ErrNoRows) {
+		if in.Event == nil || in.Subject == nil || in.Body == nil {
+			return "", fmt.Errorf("a new guest message template needs event, subject and body")
+		}
+		if offset == nil {
+			offset = new(int)
+		}
+		active = in.Active == nil || *in.Active
+		_, err = db.Exec(bg,
+			`INSERT INTO guest_message_templates (code, event, offset_minutes, subject, body, active, active_since, needs_approval)
+			 VALUES ($1, $2, $3, trim($4), trim($5), $6, CASE WHEN $6 THEN now() END, COALESCE($7, false))`,
+			in.Code, *in.Event, *offset, *in.Subject, *in.Body, active, in.Approval)
+		verb = "creato"
+	}
+	if err != nil {
+		return "", fmt.Errorf("save template: %w", err)
+	}
+	state := "attivo: parte da ora in poi"
+	if !active {
+		state = "sospeso"
+	}
+	return fmt.Sprintf("✉️ Modello %s %s (%s).", in.Code, verb, state), nil
+}
+
+// ── send_guest_message ───────────────────────────────────────────────────────
+
+type sendGuestMessageTool struct {
+	gm *GuestMessenger
+}
+
+func (t *sendGuestMessageTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "send_guest_message",
+		Description: "Manda subito un messaggio agli ospiti di una prenotazione: un modello (template, col testo compilato " +
+			"dalla prenotazione) o un testo libero. Canale: Telegram se l'ospite ha usato un invito, altrimenti email. " +
+			"preview=true mostra il testo, il canale e i messaggi già inviati senza mandare nulla: usalo prima e fai " +
+			"confermare al manager. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer"},
+				"template": {"type": "string", "description": "Codice del modello, es. 'pre_arrivo'"},
+				"text": {"type": "string", "description": "Testo libero, in alternativa al modello (può usare i segnaposto)"},
+				"subject": {"type": "string", "description": "Oggetto dell'email per un testo libero"},
+				"channel": {"type": "string", "enum": ["auto", "telegram", "email"], "description": "Default auto"},
+				"preview": {"type": "boolean"}
+			},
+			"required": ["reservation_id"]
+		}`),
+	}
+}
+
+func (t *sendGuestMessageTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64  `json:"reservation_id"`
+		Template      string `json:"template"`
+		Text          string `json:"text"`
+		Subject       string `json:"subject"`
+		Channel       string `json:"channel"`
+		Preview       bool   `json:"preview"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if (in.Template == "") == (strings.TrimSpace(in.Text) == "") {
+		return "", fmt.Errorf("pass either template or text")
+	}
+	if in.Channel == "" {
+		in.Channel = "auto"
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("send_guest_message is only available to managers")
+	}
+
+	var templateID *int64
+	subject, body := in.Subject, in.Text
+	if in.Template != "" {
+		var id int64
+		err := db.QueryRow(bg,
+			`SELECT id, subject, body FROM guest_message_templates WHERE code = $1`, in.Template).Scan(&id, &subject, &body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("guest message template %q not found (guest_message_templates)", in.Template)
+		}
+		if err != nil {
+			return "", err
+		}
+		templateID = &id
+	} else if err := checkGuestPlaceholders(subject, body); err != nil {
+		return "", err
+	}
+	vars, err := loadGuestMessageVars(bg, db, in.ReservationID)
+	if err != nil {
+		return "", err
+	}
+	if subject == "" {
+		subject = "{hotel}"
+	}
+	rawSubject, rawBody := subject, body
+	subject, body = renderGuestMessage(subject, vars), renderGuestMessage(body, vars)
+	contacts, err := loadGuestContacts(bg, db, in.ReservationID)
+	if err != nil {
+		return "", fmt.Errorf("guest contacts: %w", err)
+	}
+	channel, chErr := contacts.channelFor(in.Channel)
+
+	if in.Preview {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Anteprima per la prenotazione %d (%s, camera %s):\n", in.ReservationID, vars["guest"], vars["room"])
+		switch {
+		case chErr != nil:
+			fmt.Fprintf(&sb, "⚠️ Non si può inviare: %v\n", chErr)
+		case channel == "email":
+			fmt.Fprintf(&sb, "Canale: email a %s\nOggetto: %s\n", contacts.email, subject)
+		default:
+			fmt.Fprintf(&sb, "Canale: Telegram (%d chat, tradotto nella lingua dell'ospite)\n", len(contacts.chats))
+		}
+		if missing := missingGuestInfo(vars, rawSubject, rawBody); len(missing) > 0 {
+			fmt.Fprintf(&sb, "⚠️ Informazioni vuote (hotel_info): %s\n", strings.Join(missing, ", "))
+		}
+		sb.WriteString("---\n" + body + "\n---")
+		history, err := guestMessageHistory(bg, db, in.ReservationID)
+		if err != nil {
+			return "", err
+		}
+		if history != "" {
+			sb.WriteString("\nGià inviati:\n" + history)
+		}
+		return sb.String(), nil
+	}
+	if chErr != nil {
+		return "", chErr
+	}
+	recipient, sendErr := t.gm.send(bg, contacts, channel, subject, body)
+	var errText *string
+	if sendErr != nil {
+		s := sendErr.Error()
+		errText = &s
+	}
+	if _, err := db.Exec(bg,
+		`INSERT INTO guest_messages (reservation_id, template_id, channel, recipient, subject, body, error, sent_by)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)`,
+		in.ReservationID, templateID, channel, recipient, subject, body, errText, ctx.UserID); err != nil {
+		log.Printf("send_guest_message: record: %v", err)
+	}
+	if sendErr != nil {
+		return "", fmt.Errorf("send: %w", sendErr)
+	}
+	return fmt.Sprintf("✉️ Messaggio inviato a %s (%s).", vars["guest"], recipient), nil
+}
+
+// guestMessageHistory lists what was sent to a reservation, oldest first.
+func guestMessageHistory(ctx context.Context, db querier, resID int64) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT m.sent_at, COALESCE(t.code, 'testo libero'), COALESCE(m.channel, ''), COALESCE(m.error, ''),
+		        m.sent_by IS NULL, m.status
+		 FROM guest_messages m LEFT JOIN guest_message_templates t ON t.id = m.template_id
+		 WHERE m.reservation_id = $1 ORDER BY m.sent_at`, resID)
+	if err != nil {
+		return "", fmt.Errorf("query guest messages: %w", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var at time.Time
+		var code, channel, sendErr, status string
+		var automatic bool
+		if err := rows.Scan(&at, &code, &channel, &sendErr, &automatic, &status); err != nil {
+			return "", err
+		}
+		line := fmt.Sprintf("• %s %s", at.In(romeLocation()).Format("02/01 15:04"), code)
+		if automatic {
+			line += " (automatico)"
+		}
+		switch {
+		case status == "queued":
+			line += " — in attesa di approvazione"
+		case status == "discarded":
+			line += " — scartato"
+		case sendErr != "":
+			line += " — non inviato: " + sendErr
+		default:
+			line += " via " + channel
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
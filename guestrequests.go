@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GuestRequests handles guest special requests (guest_requests table): a
+// crib, an extra bed, a late checkout, an allergy to feathers. Each belongs to
+// a reservation and is open until someone marks it done. The cleaners see them
+// in the morning brief of the rooms they clean (AutoAssigner.notify), and a
+// request added for a room already assigned today reaches its cleaner at
+// once. Allergies stay in the brief for the whole stay, done or not: they
+// apply to every clean.
+//
+// A late checkout or early check-in with a time needs the manager: it is
+// stored as 'pending' and sent to the managers with buttons "greq:ok:<id>"
+// and "greq:no:<id>" (one added by a manager is approved at once). Approval
+// moves the reservation's checkout_at/checkin_at (both rooms of a connecting
+// pair), the stay mirrored on rooms, the room's pending reminders of that day
+// and notes the change on the checkout clean, telling its cleaner; the
+// request then becomes 'open' like any other.
+type GuestRequests struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+}
+
+func newGuestRequests(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *GuestRequests {
+	return &GuestRequests{adminPool: adminPool, registry: registry, botToken: botToken}
+}
+
+// Register wires the approval buttons into the messenger.
+func (g *GuestRequests) Register(m *routedMessenger) {
+	m.Handle("greq:", g.handleButton)
+}
+
+// Tools implements agent.ToolSet.
+func (g *GuestRequests) Tools() []agent.Tool {
+	return []agent.Tool{&addGuestRequestTool{g: g}, &listGuestRequestsTool{}, &completeGuestRequestTool{}, &markVIPTool{g: g}}
+}
+
+// guestRequestKinds are the values of guest_requests.kind.
+var guestRequestKinds = map[string]string{
+	"crib":          "culla",
+	"extra_bed":     "letto aggiuntivo",
+	"late_checkout": "late checkout",
+	"early_checkin": "early check-in",
+	"allergy":       "allergia",
+	"towels":        "asciugamani",
+	"other":         "richiesta",
+}
+
+// stayChangeKinds are the requests that move the stay and need approval.
+var stayChangeKinds = map[string]bool{"late_checkout": true, "early_checkin": true}
+
+func guestRequestLabel(kind, details string, at *time.Time) string {
+	label := guestRequestKinds[kind]
+	if at != nil {
+		label += " alle " + at.In(romeLocation()).Format("15:04")
+	}
+	if details != "" {
+		label += ": " + details
+	}
+	return label
+}
+
+// guestRequestNotes returns, per room, the requests to keep in mind when
+// cleaning it on day: open ones and allergies of the stays touching day
+// (the guest leaving and the one arriving).
+func guestRequestNotes(ctx context.Context, db querier, day time.Time, roomIDs []int64) (map[int64][]string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT res.room_id, g.kind, COALESCE(g.details, ''), g.requested_at
+		 FROM guest_requests g JOIN reservations res ON res.id = g.reservation_id
+		 WHERE res.room_id = ANY($2) AND res.status = 'confirmed'
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		   AND (g.status = 'open' OR (g.kind = 'allergy' AND g.status = 'done'))
+		 ORDER BY g.id`, day, roomIDs)
+	if err != nil {
+		return nil, fmt.Errorf("query guest requests: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int64][]string)
+	for rows.Next() {
+		var roomID int64
+		var kind, details string
+		var at *time.Time
+		if err := rows.Scan(&roomID, &kind, &details, &at); err != nil {
+			return nil, err
+		}
+		out[roomID] = append(out[roomID], guestRequestLabel(kind, details, at))
+	}
+	return out, rows.Err()
+}
+
+// ── add_guest_request ────────────────────────────────────────────────────────
+
+type addGuestRequestTool struct {
+	g *GuestRequests
+}
+
+func (t *addGuestRequestTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "add_guest_request",
+		Description: "Registra una richiesta speciale di un ospite (culla, letto aggiuntivo, late checkout, allergie…) " +
+			"sulla sua prenotazione. Compare nel programma mattutino del cleaner della camera; se la camera è già assegnata oggi, il cleaner viene avvisato subito. " +
+			"Late checkout ed early check-in con un orario vanno al manager per l'approvazione, che sposta la prenotazione.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Camera: la richiesta va sulla prenotazione in corso o sulla prossima"},
+				"reservation_id": {"type": "integer", "description": "Prenotazione (in alternativa a room)"},
+				"kind": {"type": "string", "enum": ["crib", "extra_bed", "late_checkout", "early_checkin", "allergy", "towels", "other"]},
+				"time": {"type": "string", "description": "Per late_checkout / early_checkin: orario richiesto HH:MM"},
+				"details": {"type": "string", "description": "Dettagli (es. 'allergico alle piume')"}
+			},
+			"required": ["kind"]
+		}`),
+	}
+}
+
+func (t *addGuestRequestTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room          string `json:"room"`
+		ReservationID int64  `json:"reservation_id"`
+		Kind          string `json:"kind"`
+		Time          string `json:"time"`
+		Details       string `json:"details"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if _, ok := guestRequestKinds[in.Kind]; !ok {
+		return "", fmt.Errorf("kind must be crib, extra_bed, late_checkout, early_checkin, allergy, towels or other")
+	}
+	hour, min, timed := parseClock(strings.TrimSpace(in.Time))
+	if in.Time != "" && (!timed || !stayChangeKinds[in.Kind]) {
+		return "", fmt.Errorf("time must be HH:MM, for late_checkout or early_checkin only")
+	}
+	if in.ReservationID == 0 && strings.TrimSpace(in.Room) == "" {
+		return "", fmt.Errorf("room or reservation_id is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var reservationID, roomID int64
+	var room, guest string
+	var checkin, checkout time.Time
+	err = db.QueryRow(bg,
+		`SELECT res.id, r.id, r.name, COALESCE(res.guest_name, ''), res.checkin_at, res.checkout_at
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.status IN ('confirmed', 'option')
+		   AND CASE WHEN $1 > 0 THEN res.id = $1
+		            ELSE lower(r.name) = lower($2)
+		                 AND res.checkout_at >= (date_trunc('day', now() AT TIME ZONE 'Europe/Rome') AT TIME ZONE 'Europe/Rome') END
+		 ORDER BY res.checkin_at
+		 LIMIT 1`, in.ReservationID, strings.TrimSpace(in.Room),
+	).Scan(&reservationID, &roomID, &room, &guest, &checkin, &checkout)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if in.ReservationID > 0 {
+			return "", fmt.Errorf("prenotazione %d non trovata", in.ReservationID)
+		}
+		return "", fmt.Errorf("nessuna prenotazione in corso o futura per la camera %s", in.Room)
+	}
+	if err != nil {
+		return "", fmt.Errorf("query reservation: %w", err)
+	}
+
+	loc := romeLocation()
+	details := strings.TrimSpace(in.Details)
+	status := "open"
+	var requestedAt *time.Time
+	if timed {
+		base := checkout.In(loc)
+		if in.Kind == "early_checkin" {
+			base = checkin.In(loc)
+		}
+		at := time.Date(base.Year(), base.Month(), base.Day(), hour, min, 0, 0, loc)
+		if in.Kind == "late_checkout" && !at.After(checkout) {
+			return "", fmt.Errorf("il checkout è già alle %s", checkout.In(loc).Format("15:04"))
+		}
+		if in.Kind == "early_checkin" && !at.Before(checkin) {
+			return "", fmt.Errorf("il check-in è già alle %s", checkin.In(loc).Format("15:04"))
+		}
+		status, requestedAt = "pending", &at
+	}
+
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO guest_requests (reservation_id, kind, details, requested_at, status, created_by)
+		 VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6) RETURNING id`,
+		reservationID, in.Kind, details, requestedAt, status, ctx.UserID,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert request: %w", err)
+	}
+
+	label := guestRequestLabel(in.Kind, details, requestedAt)
+	msg := fmt.Sprintf("✅ Richiesta #%d (%s) sulla prenotazione #%d, camera %s", id, label, reservationID, room)
+	if guest != "" {
+		msg += " (" + guest + ")"
+	}
+	msg += fmt.Sprintf(", %s → %s.", checkin.In(loc).Format("02/01"), checkout.In(loc).Format("02/01"))
+	if status == "pending" {
+		var manager bool
+		_ = db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager)
+		if manager {
+			done, err := t.g.approve(bg, db, id)
+			if err != nil {
+				return msg + "\n❌ Non applicata: " + err.Error(), nil
+			}
+			return msg + "\n" + done, nil
+		}
+		t.g.askManagers(bg, id, room, guest, label, checkout, checkin, in.Kind, ctx.UserID)
+		return msg + " In attesa dell'approvazione del manager: ti avviso appena risponde.", nil
+	}
+	if n := t.g.notifyCleaners(bg, roomID, ctx.UserID,
+		fmt.Sprintf("🛎 Camera %s, richiesta dell'ospite #%d: %s. Segnalami quando è fatta.", room, id, label)); n > 0 {
+		msg += " Il cleaner di oggi è stato avvisato."
+	}
+	return msg, nil
+}
+
+// notifyCleaners sends msg to the cleaners with an unfinished assignment on
+// the room today, except userID; the admin pool sees everyone's assignments.
+func (g *GuestRequests) notifyCleaners(ctx context.Context, roomID, userID int64, msg string) int {
+	rows, err := g.adminPool.Query(ctx,
+		`SELECT DISTINCT cleaner_id FROM assignments
+		 WHERE room_id = $1 AND date = (now() AT TIME ZONE 'Europe/Rome')::date
+		   AND status IN ('pending', 'in_progress') AND cleaner_id <> $2`, roomID, userID)
+	if err != nil {
+		return 0
+	}
+	var cleaners []int64
+	for rows.Next() {
+		var c int64
+		if rows.Scan(&c) == nil {
+			cleaners = append(cleaners, c)
+		}
+	}
+	rows.Close()
+	tg := newBot(g.botToken)
+	sent := 0
+	for _, c := range cleaners {
+		if tg.Send(ctx, c, msg) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// askManagers sends a pending late checkout / early check-in to the managers
+// with the approval buttons.
+func (g *GuestRequests) askManagers(ctx context.Context, id int64, room, guest, label string, checkout, checkin time.Time, kind string, requester int64) {
+	loc := romeLocation()
+	var who string
+	_ = g.adminPool.QueryRow(ctx, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, requester).Scan(&who)
+	now := "checkout previsto alle " + checkout.In(loc).Format("15:04 del 02/01")
+	if kind == "early_checkin" {
+		now = "check-in previsto alle " + checkin.In(loc).Format("15:04 del 02/01")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🕐 <b>Camera %s</b>", htmlpkg.EscapeString(room))
+	if guest != "" {
+		fmt.Fprintf(&sb, " (%s)", htmlpkg.EscapeString(guest))
+	}
+	fmt.Fprintf(&sb, ": richiesta di %s (%s).", htmlpkg.EscapeString(label), now)
+	if who != "" {
+		fmt.Fprintf(&sb, "\nRichiesta da %s.", htmlpkg.EscapeString(who))
+	}
+	sid := strconv.FormatInt(id, 10)
+	buttons := [][]telegram.Button{{
+		{Text: "✅ Approva", CallbackData: "greq:ok:" + sid},
+		{Text: "❌ Rifiuta", CallbackData: "greq:no:" + sid},
+	}}
+	var hotelID int
+	if err := g.adminPool.QueryRow(ctx, `SELECT hotel_id FROM guest_requests WHERE id = $1`, id).Scan(&hotelID); err != nil {
+		log.Printf("guest requests: request %d: %v", id, err)
+		return
+	}
+	managers, err := managerIDs(ctx, g.adminPool, hotelID)
+	if err != nil {
+		log.Printf("guest requests: %v", err)
+		return
+	}
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, g.botToken, m, sb.String(), buttons); err != nil {
+			log.Printf("guest requests: notify manager %d: %v", m, err)
+		}
+	}
+}
+
+func (g *GuestRequests) handleButton(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed guest request callback")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad guest request id: %w", err)
+	}
+	tg := newBot(g.botToken)
+	var role string
+	_ = g.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	db, err := g.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+
+	var requester int64
+	var kind string
+	var at *time.Time
+	var reply, told string
+	switch parts[1] {
+	case "ok":
+		reply, err = g.approve(ctx, db, id)
+		if err != nil {
+			return tg.Send(ctx, u.ChatID, "❌ "+err.Error())
+		}
+		told = "✅ Approvata"
+	case "no":
+		err = db.QueryRow(ctx,
+			`UPDATE guest_requests SET status = 'rejected', completed_by = $2, completed_at = now()
+			 WHERE id = $1 AND status = 'pending' RETURNING kind, requested_at`, id, u.UserID).Scan(&kind, &at)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tg.Send(ctx, u.ChatID, "Richiesta già gestita.")
+		}
+		if err != nil {
+			return fmt.Errorf("reject request %d: %w", id, err)
+		}
+		reply = fmt.Sprintf("Richiesta #%d (%s) rifiutata.", id, guestRequestLabel(kind, "", at))
+		told = "❌ Rifiutata"
+	default:
+		return fmt.Errorf("unknown guest request action %q", parts[1])
+	}
+	if err := g.adminPool.QueryRow(ctx,
+		`SELECT created_by, kind, requested_at FROM guest_requests WHERE id = $1`, id).Scan(&requester, &kind, &at); err == nil && requester != u.UserID {
+		_ = tg.Send(ctx, requester, fmt.Sprintf("%s dal manager la richiesta #%d: %s.", told, id, guestRequestLabel(kind, "", at)))
+	}
+	return tg.Send(ctx, u.ChatID, reply)
+}
+
+// approve applies a pending late checkout / early check-in on db (the
+// manager's pool) and tells the cleaners whose clean it changes.
+func (g *GuestRequests) approve(ctx context.Context, db *pgxpool.Pool, id int64) (string, error) {
+	loc := romeLocation()
+	var kind, room string
+	var reservationID int64
+	var at, oldAt time.Time
+	var notified []int64
+	var note string
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`SELECT g.kind, g.requested_at, g.reservation_id, r.name,
+			        CASE WHEN g.kind = 'late_checkout' THEN res.checkout_at ELSE res.checkin_at END
+			 FROM guest_requests g
+			 JOIN reservations res ON res.id = g.reservation_id
+			 JOIN rooms r ON r.id = res.room_id
+			 WHERE g.id = $1 AND g.status = 'pending'
+			 FOR UPDATE OF g`, id,
+		).Scan(&kind, &at, &reservationID, &room, &oldAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("richiesta #%d già gestita o non trovata", id)
+		}
+		if err != nil {
+			return err
+		}
+		column, label := "checkout_at", "late checkout"
+		if kind == "early_checkin" {
+			column, label = "checkin_at", "early check-in"
+		}
+		// Both rooms of a connecting pair move together.
+		rooms := `SELECT room_id FROM reservations WHERE id = $1 OR linked_reservation_id = $1`
+		if _, err := tx.Exec(ctx,
+			`UPDATE reservations SET `+column+` = $2 WHERE id = $1 OR linked_reservation_id = $1`,
+			reservationID, at); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE rooms SET `+column+` = $2 WHERE id IN (`+rooms+`) AND `+column+` = $3`,
+			reservationID, at, oldAt); err != nil {
+			return fmt.Errorf("update room: %w", err)
+		}
+		// Reminders set around the old time on that day follow it: after the
+		// departure for a late checkout, before the arrival for an early one.
+		side := `fire_at >= $3`
+		if kind == "early_checkin" {
+			side = `fire_at <= $3`
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE reminders SET fire_at = fire_at + ($2::timestamptz - $3::timestamptz)
+			 WHERE room_id IN (`+rooms+`) AND fired_at IS NULL AND cancelled_at IS NULL AND `+side+`
+			   AND (fire_at AT TIME ZONE 'Europe/Rome')::date = ($3::timestamptz AT TIME ZONE 'Europe/Rome')::date`,
+			reservationID, at, oldAt); err != nil {
+			return fmt.Errorf("move reminders: %w", err)
+		}
+		note = fmt.Sprintf("%s alle %s", label, at.In(loc).Format("15:04"))
+		rows, err := tx.Query(ctx,
+			`UPDATE assignments SET notes = concat_ws(' · ', notes, $3::text), updated_at = now()
+			 WHERE room_id IN (`+rooms+`) AND type = 'checkout' AND status IN ('pending', 'in_progress')
+			   AND date = ($2::timestamptz AT TIME ZONE 'Europe/Rome')::date
+			 RETURNING cleaner_id`, reservationID, at, note)
+		if err != nil {
+			return fmt.Errorf("update assignments: %w", err)
+		}
+		for rows.Next() {
+			var c int64
+			if rows.Scan(&c) == nil {
+				notified = append(notified, c)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE guest_requests SET status = 'open', approved_by = current_telegram_id(), approved_at = now() WHERE id = $1`, id)
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		return "", fmt.Errorf("non si può: %s", pgErr.Message)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tg := newBot(g.botToken)
+	msg := fmt.Sprintf("🕐 Camera %s: %s. Tienine conto per la pulizia.", room, note)
+	if kind == "early_checkin" {
+		msg = fmt.Sprintf("🕐 Camera %s: %s, deve essere pronta per quell'ora.", room, note)
+	}
+	for _, c := range notified {
+		_ = tg.Send(ctx, c, msg)
+	}
+	reply := fmt.Sprintf("✅ Camera %s: %s (prima %s), prenotazione #%d aggiornata.",
+		room, note, oldAt.In(loc).Format("15:04"), reservationID)
+	if len(notified) > 0 {
+		reply += " Il cleaner della pulizia è stato avvisato."
+	}
+	return reply, nil
+}
+
+// ── list_guest_requests ──────────────────────────────────────────────────────
+
+type listGuestRequestsTool struct{}
+
+func (t *listGuestRequestsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "list_guest_requests",
+		Description: "Elenca le richieste speciali degli ospiti. Di default solo quelle aperte delle prenotazioni non ancora concluse.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Filtra per camera (opzionale)"},
+				"include_done": {"type": "boolean", "description": "Includi anche quelle completate o annullate (default false)"}
+			}
+		}`),
+	}
+}
+
+func (t *listGuestRequestsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room        string `json:"room"`
+		IncludeDone bool   `json:"include_done"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT g.id, r.name AS room, COALESCE(res.guest_name, '') AS guest, g.kind, COALESCE(g.details, '') AS details,
+		        to_char(g.requested_at AT TIME ZONE 'Europe/Rome', 'HH24:MI') AS time, g.status, to_char(res.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM') AS checkin,
+		        to_char(res.checkout_at AT TIME ZONE 'Europe/Rome', 'DD/MM') AS checkout, g.reservation_id
+		 FROM guest_requests g
+		 JOIN reservations res ON res.id = g.reservation_id
+		 JOIN rooms r ON r.id = res.room_id
+		 WHERE ($1 = '' OR lower(r.name) = lower($1))
+		   AND ($2 OR (g.status IN ('open', 'pending') AND res.checkout_at >= now()))
+		 ORDER BY res.checkin_at, r.name, g.id`,
+		strings.TrimSpace(in.Room), in.IncludeDone,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query requests: %w", err)
+	}
+	return formatRows(rows)
+}
+
+// ── complete_guest_request ───────────────────────────────────────────────────
+
+type completeGuestRequestTool struct{}
+
+func (t *completeGuestRequestTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "complete_guest_request",
+		Description: "Segna come fatta una richiesta speciale (es. culla montata), o la annulla con cancel=true.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"request_id": {"type": "integer", "description": "ID della richiesta"},
+				"cancel": {"type": "boolean", "description": "Annulla invece di completare (l'ospite non ne ha più bisogno)"}
+			},
+			"required": ["request_id"]
+		}`),
+	}
+}
+
+func (t *completeGuestRequestTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		RequestID int64 `json:"request_id"`
+		Cancel    bool  `json:"cancel"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	status := "done"
+	if in.Cancel {
+		status = "cancelled"
+	}
+	// A late checkout still waiting for the manager can only be cancelled.
+	var kind, details string
+	var at *time.Time
+	err = db.QueryRow(context.Background(),
+		`UPDATE guest_requests SET status = $2, completed_by = $3, completed_at = now()
+		 WHERE id = $1 AND (status = 'open' OR (status = 'pending' AND $2 = 'cancelled'))
+		 RETURNING kind, COALESCE(details, ''), requested_at`,
+		in.RequestID, status, ctx.UserID,
+	).Scan(&kind, &details, &at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("richiesta #%d non trovata o già chiusa", in.RequestID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("update request: %w", err)
+	}
+	if in.Cancel {
+		return fmt.Sprintf("🗑 Richiesta #%d (%s) annullata.", in.RequestID, guestRequestLabel(kind, details, at)), nil
+	}
+	return fmt.Sprintf("✅ Richiesta #%d (%s) fatta.", in.RequestID, guestRequestLabel(kind, details, at)), nil
+}
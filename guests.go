@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Guest profiles (guests table) collect contacts, preferences and history
+// of returning guests. add_reservation links each booking to a profile by
+// name (creating one for new guests); stay_count and last_stay are kept up
+// to date by the reservations_guest_stats trigger.
+
+type guestProfile struct {
+	id                 int64
+	name, phone, email string
+	preferences, notes string
+	vip                bool
+	instructions       string
+	stays              int
+	lastStay           *time.Time
+	preferredFloor     *int
+}
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// guestProfileSelect reads a profile plus the floor the guest stayed on most.
+const guestProfileSelect = `
+	SELECT g.id, g.name, COALESCE(g.phone, ''), COALESCE(g.email, ''),
+	       COALESCE(g.preferences, ''), COALESCE(g.notes, ''), g.vip, COALESCE(g.special_instructions, ''),
+	       g.stay_count, g.last_stay,
+	       (SELECT r.floor FROM reservations res JOIN rooms r ON r.id = res.room_id
+	        WHERE res.guest_id = g.id AND res.status = 'confirmed'
+	        GROUP BY r.floor ORDER BY count(*) DESC, max(res.checkin_at) DESC LIMIT 1)
+	FROM guests g`
+
+func scanGuestProfiles(ctx context.Context, db querier, where string, args ...any) ([]guestProfile, error) {
+	rows, err := db.Query(ctx, guestProfileSelect+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []guestProfile
+	for rows.Next() {
+		var g guestProfile
+		if err := rows.Scan(&g.id, &g.name, &g.phone, &g.email, &g.preferences, &g.notes,
+			&g.vip, &g.instructions, &g.stays, &g.lastStay, &g.preferredFloor); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// summary renders the one-paragraph recognition the agent surfaces, e.g.
+// "Rossi Mario (ID 4): 3 soggiorni, ultimo arrivo 12/08/2025, di solito al piano 2.".
+func (g guestProfile) summary() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "👤 %s (ID %d): ", g.name, g.id)
+	if g.vip {
+		sb.WriteString("⭐ VIP, ")
+	}
+	switch g.stays {
+	case 0:
+		sb.WriteString("nessun soggiorno confermato")
+	case 1:
+		sb.WriteString("1 soggiorno")
+	default:
+		fmt.Fprintf(&sb, "%d soggiorni", g.stays)
+	}
+	if g.lastStay != nil {
+		fmt.Fprintf(&sb, ", ultimo arrivo %s", g.lastStay.Format("02/01/2006"))
+	}
+	if g.preferredFloor != nil && g.stays >= 2 {
+		fmt.Fprintf(&sb, ", di solito al piano %d", *g.preferredFloor)
+	}
+	sb.WriteString(".")
+	if g.preferences != "" {
+		sb.WriteString(" Preferenze: " + g.preferences + ".")
+	}
+	if g.notes != "" {
+		sb.WriteString(" Note: " + g.notes + ".")
+	}
+	if g.instructions != "" {
+		sb.WriteString(" Istruzioni per lo staff: " + g.instructions + ".")
+	}
+	var contacts []string
+	for _, c := range []string{g.phone, g.email} {
+		if c != "" {
+			contacts = append(contacts, c)
+		}
+	}
+	if len(contacts) > 0 {
+		sb.WriteString(" Contatti: " + strings.Join(contacts, ", ") + ".")
+	}
+	return sb.String()
+}
+
+// resolveGuest finds the profile a new reservation belongs to. An explicit
+// id wins; otherwise the name must match exactly (case-insensitive), with a
+// matching phone breaking ties. ambiguous lists the candidates when the name
+// alone cannot decide; found is nil when the guest is new.
+func resolveGuest(ctx context.Context, tx pgx.Tx, id int64, name, phone string) (found *guestProfile, ambiguous []guestProfile, err error) {
+	var matches []guestProfile
+	if id != 0 {
+		matches, err = scanGuestProfiles(ctx, tx, `WHERE g.id = $1`, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("profilo ospite %d non trovato", id)
+		}
+		return &matches[0], nil, nil
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, nil, nil
+	}
+	matches, err = scanGuestProfiles(ctx, tx, `WHERE lower(g.name) = lower(trim($1)) ORDER BY g.stay_count DESC`, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(matches) > 1 && phone != "" {
+		for i := range matches {
+			if digitsOnly(matches[i].phone) == digitsOnly(phone) {
+				return &matches[i], nil, nil
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return &matches[0], nil, nil
+	default:
+		return nil, matches, nil
+	}
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// ── find_guest ───────────────────────────────────────────────────────────────
+
+type findGuestTool struct{}
+
+func (t *findGuestTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "find_guest",
+		Description: "Cerca un ospite nei profili (nome, telefono o email) e mostra storico soggiorni, preferenze e note, " +
+			"per riconoscere i clienti abituali. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "Nome (anche parziale), telefono o email"}
+			},
+			"required": ["query"]
+		}`),
+	}
+}
+
+func (t *findGuestTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("find_guest is only available to managers")
+	}
+
+	words := []string{}
+	for _, w := range strings.Fields(in.Query) {
+		words = append(words, "%"+w+"%")
+	}
+	digits := digitsOnly(in.Query)
+	profiles, err := scanGuestProfiles(bg, db,
+		`WHERE g.name ILIKE ALL ($1::text[])
+		    OR (length($2) >= 6 AND regexp_replace(COALESCE(g.phone, ''), '[^0-9]', '', 'g') LIKE '%' || $2 || '%')
+		    OR lower(g.email) = lower(trim($3))
+		 ORDER BY g.stay_count DESC, g.name
+		 LIMIT 10`, words, digits, in.Query)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	if len(profiles) == 0 {
+		return fmt.Sprintf("Nessun profilo ospite per %q.", in.Query), nil
+	}
+
+	var sb strings.Builder
+	for i, g := range profiles {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(g.summary())
+	}
+	if len(profiles) == 1 {
+		rows, err := db.Query(bg,
+			`SELECT r.name, res.checkin_at, res.checkout_at, res.status
+			 FROM reservations res JOIN rooms r ON r.id = res.room_id
+			 WHERE res.guest_id = $1
+			 ORDER BY res.checkin_at DESC LIMIT 10`, profiles[0].id)
+		if err != nil {
+			return "", fmt.Errorf("query stays: %w", err)
+		}
+		defer rows.Close()
+		loc := romeLocation()
+		for rows.Next() {
+			var room, status string
+			var ci, co time.Time
+			if err := rows.Scan(&room, &ci, &co, &status); err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&sb, "\n• Camera %s, %s → %s", room, ci.In(loc).Format("02/01/2006"), co.In(loc).Format("02/01/2006"))
+			if status != "confirmed" {
+				sb.WriteString(" (" + status + ")")
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+	}
+	return sb.String(), nil
+}
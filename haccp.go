@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HACCP temperature register. The fridges and freezers are the compliance
+// templates measured in °C (frigo_haccp, freezer_haccp, or any added with
+// set_compliance_check); log_temperature records a reading in
+// temperature_logs, closes the device's check due today if one is open, and
+// alerts the managers at once when the value is out of range. haccp_export
+// sends the month's register as CSV for the health inspectors.
+
+// temperatureDevice is a compliance template measured in °C.
+type temperatureDevice struct {
+	id         int64
+	code       string
+	title      string
+	vmin, vmax *float64
+	daily      bool
+}
+
+func (d temperatureDevice) inRange(c float64) bool {
+	return (d.vmin == nil || c >= *d.vmin) && (d.vmax == nil || c <= *d.vmax)
+}
+
+// findTemperatureDevice resolves a device by code or title; with name empty
+// it returns the only device of the property.
+func findTemperatureDevice(ctx context.Context, db querier, name string) (temperatureDevice, error) {
+	rows, err := db.Query(ctx,
+		`SELECT id, code, title, value_min::float8, value_max::float8, frequency = 'daily'
+		 FROM compliance_templates
+		 WHERE active AND value_unit = '°C'
+		   AND ($1 = '' OR lower(code) = lower($1) OR title ILIKE '%' || $1 || '%')
+		 ORDER BY lower(code) = lower($1) DESC, code`, strings.TrimSpace(name))
+	if err != nil {
+		return temperatureDevice{}, fmt.Errorf("query devices: %w", err)
+	}
+	defer rows.Close()
+	var found []temperatureDevice
+	for rows.Next() {
+		var d temperatureDevice
+		if err := rows.Scan(&d.id, &d.code, &d.title, &d.vmin, &d.vmax, &d.daily); err != nil {
+			return temperatureDevice{}, err
+		}
+		found = append(found, d)
+	}
+	if err := rows.Err(); err != nil {
+		return temperatureDevice{}, err
+	}
+	switch {
+	case len(found) == 0:
+		return temperatureDevice{}, pgx.ErrNoRows
+	case len(found) == 1 || strings.EqualFold(found[0].code, strings.TrimSpace(name)):
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, d := range found {
+		names[i] = fmt.Sprintf("%s (%s)", d.title, d.code)
+	}
+	return temperatureDevice{}, fmt.Errorf("indica quale: %s", strings.Join(names, ", "))
+}
+
+// ── log_temperature ──────────────────────────────────────────────────────────
+
+type logTemperatureTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *logTemperatureTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_temperature",
+		Description: "Registra la temperatura di un frigorifero o congelatore nel registro HACCP (es. 'frigo 3 gradi'). " +
+			"Chiude il controllo del giorno; se il valore è fuori range avvisa subito i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"device": {"type": "string", "description": "Codice o nome dell'apparecchio (es. 'frigo_haccp', 'congelatore'); omettere se ce n'è uno solo"},
+				"value": {"type": "number", "description": "Temperatura letta"},
+				"unit": {"type": "string", "enum": ["C", "F"], "description": "Scala del valore (default C)"},
+				"notes": {"type": "string", "description": "Es. azione correttiva presa"}
+			},
+			"required": ["value"]
+		}`),
+	}
+}
+
+func (t *logTemperatureTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Device string   `json:"device"`
+		Value  *float64 `json:"value"`
+		Unit   string   `json:"unit"`
+		Notes  string   `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Value == nil {
+		return "", fmt.Errorf("value is required")
+	}
+	celsius, entered := *in.Value, ""
+	switch strings.ToUpper(in.Unit) {
+	case "", "C":
+	case "F":
+		celsius = roundTenth((*in.Value - 32) * 5 / 9)
+		entered = fmt.Sprintf("%g °F", *in.Value)
+	default:
+		return "", fmt.Errorf("unit must be C or F")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var d temperatureDevice
+	ok := false
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		var err error
+		d, err = findTemperatureDevice(bg, tx, in.Device)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("nessun frigorifero o congelatore %q: il manager li aggiunge con set_compliance_check (value_unit °C)", in.Device)
+		}
+		if err != nil {
+			return err
+		}
+		ok = d.inRange(celsius)
+		// A reading closes the device's check due by today, if still open.
+		var taskID *int64
+		err = tx.QueryRow(bg,
+			`UPDATE compliance_tasks SET status = 'done', completed_by = $2, completed_at = now(),
+			        value = $3, ok = $4, notes = NULLIF($5, '')
+			 WHERE template_id = $1 AND status = 'open' AND due_date <= (now() AT TIME ZONE 'Europe/Rome')::date
+			 RETURNING id`,
+			d.id, ctx.UserID, celsius, ok, in.Notes,
+		).Scan(&taskID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("complete check: %w", err)
+		}
+		if _, err := tx.Exec(bg,
+			`INSERT INTO temperature_logs (template_id, value_c, entered, in_range, logged_by, task_id, notes)
+			 VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, NULLIF($7, ''))`,
+			d.id, celsius, entered, ok, ctx.UserID, taskID, in.Notes,
+		); err != nil {
+			return fmt.Errorf("log temperature: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	reading := fmt.Sprintf("%g °C", celsius)
+	if entered != "" {
+		reading += " (" + entered + ")"
+	}
+	if ok {
+		return fmt.Sprintf("🌡 %s: %s registrati.", d.title, reading), nil
+	}
+	what := fmt.Sprintf("%s fuori range%s", reading, complianceRange(d.vmin, d.vmax, "°C"))
+	complianceAlert(ctx, t.adminPool, t.botToken, d.title, what, in.Notes)
+	return fmt.Sprintf("⚠️ %s: %s. I manager sono stati avvisati: controlla la chiusura e sposta gli alimenti se serve.",
+		d.title, what), nil
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// ── haccp_export ─────────────────────────────────────────────────────────────
+
+type haccpExportTool struct {
+	botToken string
+}
+
+func (t *haccpExportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "haccp_export",
+		Description: "Registro HACCP delle temperature del mese (frigoriferi e congelatori): invia in chat il CSV per i controlli " +
+			"sanitari e restituisce letture fuori range e giorni senza registrazione. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {"type": "string", "description": "Mese nel formato YYYY-MM (default: mese corrente)"}
+			}
+		}`),
+	}
+}
+
+func (t *haccpExportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("haccp_export is only available to managers")
+	}
+	var in struct {
+		Month string `json:"month"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		start, err = time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := db.Query(bg,
+		`SELECT l.logged_at, t.code, t.title, l.value_c::float8, t.value_min::float8, t.value_max::float8,
+		        l.in_range, COALESCE(u.name, l.logged_by::text), COALESCE(l.notes, '')
+		 FROM temperature_logs l
+		 JOIN compliance_templates t ON t.id = l.template_id
+		 LEFT JOIN users u ON u.telegram_id = l.logged_by
+		 WHERE l.logged_at >= $1 AND l.logged_at < $2
+		 ORDER BY l.logged_at, t.code`, start, end)
+	if err != nil {
+		return "", fmt.Errorf("query readings: %w", err)
+	}
+	var csv strings.Builder
+	csv.WriteString("data;ora;apparecchio;temperatura_c;min_c;max_c;esito;operatore;note\n")
+	logged := make(map[string]bool) // code|day
+	var readings int
+	var alarms []string
+	for rows.Next() {
+		var at time.Time
+		var code, title, who, notes string
+		var value float64
+		var vmin, vmax *float64
+		var inRange bool
+		if err := rows.Scan(&at, &code, &title, &value, &vmin, &vmax, &inRange, &who, &notes); err != nil {
+			rows.Close()
+			return "", err
+		}
+		at = at.In(loc)
+		esito := "conforme"
+		if !inRange {
+			esito = "NON CONFORME"
+			alarms = append(alarms, fmt.Sprintf("%s %s: %g °C", at.Format("02/01 15:04"), title, value))
+		}
+		fmt.Fprintf(&csv, "%s;%s;%s;%.1f;%s;%s;%s;%s;%s\n", at.Format("02/01/2006"), at.Format("15:04"),
+			csvField(title), value, optFloat(vmin), optFloat(vmax), esito, csvField(who), csvField(notes))
+		logged[code+"|"+at.Format("2006-01-02")] = true
+		readings++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	// Days without a reading, for the devices checked daily.
+	devices, err := db.Query(bg,
+		`SELECT code, title FROM compliance_templates
+		 WHERE active AND value_unit = '°C' AND frequency = 'daily' ORDER BY code`)
+	if err != nil {
+		return "", fmt.Errorf("query devices: %w", err)
+	}
+	var missing []string
+	for devices.Next() {
+		var code, title string
+		if err := devices.Scan(&code, &title); err != nil {
+			devices.Close()
+			return "", err
+		}
+		var days []string
+		for d := start; d.Before(end) && !d.After(now); d = d.AddDate(0, 0, 1) {
+			if !logged[code+"|"+d.Format("2006-01-02")] {
+				days = append(days, d.Format("02"))
+			}
+		}
+		if len(days) > 0 {
+			missing = append(missing, fmt.Sprintf("%s: %s", title, strings.Join(days, ", ")))
+		}
+	}
+	devices.Close()
+	if err := devices.Err(); err != nil {
+		return "", err
+	}
+
+	month := start.Format("01/2006")
+	if readings == 0 {
+		return fmt.Sprintf("Nessuna temperatura registrata nel mese %s.", month), nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Registro temperature %s: %d letture.\n", month, readings)
+	if len(alarms) > 0 {
+		fmt.Fprintf(&sb, "⚠️ Fuori range (%d):\n  %s\n", len(alarms), strings.Join(alarms, "\n  "))
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&sb, "Giorni senza registrazione:\n  %s\n", strings.Join(missing, "\n  "))
+	}
+	name := "haccp_temperature_" + start.Format("200601") + ".csv"
+	if err := sendDocument(bg, t.botToken, ctx.ChatID, name, []byte(csv.String()),
+		"Registro HACCP temperature "+month); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	fmt.Fprintf(&sb, "📄 Registro inviato in chat (%s).", name)
+	return sb.String(), nil
+}
+
+// csvField makes s safe for a ;-separated line.
+func csvField(s string) string {
+	return strings.NewReplacer(";", ",", "\n", " ").Replace(s)
+}
+
+func optFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", *v)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// handoffTool hands a manager's desk over to another manager (end of a
+// season, holidays, a new hire). The incoming manager gets one briefing:
+// the outgoing manager's notes (the model writes them from the conversation,
+// which only it can see), open tickets and incidents, the next week's
+// arrivals, and every pending approval with its Approva / Rifiuta buttons —
+// the same callbacks the original requests use (greq:, gmsg:, off:, sick:). The
+// briefing is also injected into the incoming manager's conversation, and
+// the outgoing manager's pending reminders move to them.
+type handoffTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+// handoffDays is how far ahead the briefing lists arrivals; handoffLines
+// bounds each section, so the briefing fits in one Telegram message.
+const (
+	handoffDays  = 7
+	handoffLines = 15
+)
+
+func (t *handoffTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "handoff_manager",
+		Description: "Passa le consegne a un altro manager: gli manda un riepilogo (note, ticket e incidenti aperti, " +
+			"arrivi dei prossimi 7 giorni, approvazioni in sospeso con i pulsanti) e gli trasferisce i promemoria " +
+			"ancora da inviare. In notes riassumi le questioni in corso emerse in questa conversazione. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"to": {"type": "string", "description": "Nome del manager che subentra"},
+				"notes": {"type": "string", "description": "Questioni in corso, accordi presi, cose da sapere (dalla conversazione)"}
+			},
+			"required": ["to"]
+		}`),
+	}
+}
+
+// handoffApproval is a pending request the incoming manager can decide on.
+type handoffApproval struct {
+	line     string
+	callback string // prefix and id, ":ok:"/":no:" inserted
+}
+
+func (t *handoffTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		To    string `json:"to"`
+		Notes string `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("handoff_manager is only available to managers")
+	}
+	toID, toName, err := findStaff(bg, db, in.To)
+	if err != nil {
+		return "", err
+	}
+	if toID == ctx.UserID {
+		return "", fmt.Errorf("pick another manager, not yourself")
+	}
+	var role, fromName string
+	if err := db.QueryRow(bg, `SELECT role FROM users WHERE telegram_id = $1`, toID).Scan(&role); err != nil {
+		return "", fmt.Errorf("query user: %w", err)
+	}
+	if Role(role) != RoleManager {
+		return "", fmt.Errorf("%s is not a manager: change their role first", toName)
+	}
+	_ = db.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&fromName)
+
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🤝 <b>Passaggio di consegne da %s</b>\n", htmlpkg.EscapeString(fromName))
+	if notes := strings.TrimSpace(in.Notes); notes != "" {
+		fmt.Fprintf(&sb, "\n<b>Note</b>\n%s\n", htmlpkg.EscapeString(notes))
+	}
+
+	section := func(title, query string, args ...any) error {
+		rows, err := db.Query(bg, query, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", title, err)
+		}
+		lines, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("%s: %w", title, err)
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(&sb, "\n<b>%s</b> (%d)\n", title, len(lines))
+			for i, l := range lines {
+				if i == handoffLines {
+					fmt.Fprintf(&sb, "… e altri %d\n", len(lines)-i)
+					break
+				}
+				sb.WriteString("• " + htmlpkg.EscapeString(l) + "\n")
+			}
+		}
+		return nil
+	}
+	if err := section("Ticket aperti",
+		`SELECT format('#%s %s (%s): %s', t.id, COALESCE(r.name, 'aree comuni'), t.severity, t.description)
+		 FROM maintenance_tickets t LEFT JOIN rooms r ON r.id = t.room_id
+		 WHERE t.status <> 'closed'
+		 ORDER BY array_position(ARRAY['urgent', 'high', 'normal', 'low'], t.severity), t.created_at`); err != nil {
+		return "", err
+	}
+	if err := section("Reclami e incidenti aperti",
+		`SELECT format('#%s %s (%s): %s', i.id, COALESCE(r.name, 'aree comuni'), i.severity, i.description)
+		 FROM incidents i LEFT JOIN rooms r ON r.id = i.room_id
+		 WHERE i.status = 'open'
+		 ORDER BY array_position(ARRAY['urgent', 'high', 'normal', 'low'], i.severity), i.created_at`); err != nil {
+		return "", err
+	}
+	if err := section(fmt.Sprintf("Arrivi nei prossimi %d giorni", handoffDays),
+		`SELECT format('%s camera %s — %s%s', to_char(res.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM'), r.name,
+		              COALESCE(res.guest_name, 'ospite'), CASE WHEN res.status = 'option' THEN ' (opzione)' ELSE '' END)
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.status IN ('confirmed', 'option')
+		   AND res.checkin_at >= now() AND res.checkin_at < now() + make_interval(days => $1)
+		 ORDER BY res.checkin_at, r.name`, handoffDays); err != nil {
+		return "", err
+	}
+
+	approvals, err := t.pendingApprovals(bg, db)
+	if err != nil {
+		return "", err
+	}
+	var buttons [][]telegram.Button
+	if len(approvals) > 0 {
+		fmt.Fprintf(&sb, "\n<b>Da approvare</b> (%d)\n", len(approvals))
+		for i, a := range approvals {
+			n := strconv.Itoa(i + 1)
+			fmt.Fprintf(&sb, "%s. %s\n", n, htmlpkg.EscapeString(a.line))
+			prefix, id, _ := strings.Cut(a.callback, ":")
+			buttons = append(buttons, []telegram.Button{
+				{Text: "✅ Approva " + n, CallbackData: prefix + ":ok:" + id},
+				{Text: "❌ Rifiuta " + n, CallbackData: prefix + ":no:" + id},
+			})
+		}
+	}
+
+	// Reminders the outgoing manager would receive, or set for others, now
+	// belong to the incoming one.
+	tag, err := db.Exec(bg,
+		`UPDATE reminders
+		 SET chat_id = CASE WHEN chat_id = $1 THEN $2 ELSE chat_id END, created_by = $2
+		 WHERE (chat_id = $1 OR created_by = $1) AND fired_at IS NULL AND cancelled_at IS NULL`,
+		ctx.UserID, toID)
+	if err != nil {
+		return "", fmt.Errorf("transfer reminders: %w", err)
+	}
+	moved := tag.RowsAffected()
+	if moved > 0 {
+		fmt.Fprintf(&sb, "\n⏰ Ti ho passato %d promemoria ancora da inviare.\n", moved)
+	}
+	fmt.Fprintf(&sb, "\n<i>%s</i>", time.Now().In(loc).Format("02/01/2006 15:04"))
+
+	briefing := sb.String()
+	if _, err := sendKeyboard(bg, t.botToken, toID, briefing, buttons); err != nil {
+		return "", fmt.Errorf("send briefing to %s: %w", toName, err)
+	}
+	if ctx.ContextInjector != nil {
+		ctx.ContextInjector.Inject(toID, llm.Message{
+			Role:    "assistant",
+			Content: []llm.ContentBlock{{Type: "text", Text: htmlToText(briefing)}},
+		})
+	}
+	log.Printf("handoff: manager %d → %d, %d approval(s), %d reminder(s)", ctx.UserID, toID, len(approvals), moved)
+	return fmt.Sprintf("🤝 Consegne inviate a %s: %d approvazioni in sospeso con i pulsanti, %d promemoria trasferiti.",
+		toName, len(approvals), moved), nil
+}
+
+// pendingApprovals lists what still waits for a manager's button: late
+// checkouts / early check-ins, queued guest messages, leave requests and
+// sick-day redistributions.
+func (t *handoffTool) pendingApprovals(ctx context.Context, db *pgxpool.Pool) ([]handoffApproval, error) {
+	rows, err := db.Query(ctx,
+		`SELECT 'greq:' || g.id,
+		        format('%s camera %s%s', replace(g.kind, '_', ' '), r.name,
+		               COALESCE(' alle ' || to_char(g.requested_at AT TIME ZONE 'Europe/Rome', 'DD/MM HH24:MI'), ''))
+		 FROM guest_requests g
+		 JOIN reservations res ON res.id = g.reservation_id
+		 JOIN rooms r ON r.id = res.room_id
+		 WHERE g.status = 'pending'
+		 UNION ALL
+		 SELECT 'gmsg:' || m.id,
+		        format('messaggio %s a %s, camera %s', COALESCE(t.code, 'agli ospiti'), COALESCE(res.guest_name, 'ospite'), r.name)
+		 FROM guest_messages m
+		 LEFT JOIN guest_message_templates t ON t.id = m.template_id
+		 JOIN reservations res ON res.id = m.reservation_id
+		 JOIN rooms r ON r.id = res.room_id
+		 WHERE m.status = 'queued'
+		 UNION ALL
+		 SELECT 'off:' || ab.id,
+		        format('ferie di %s dal %s al %s', COALESCE(u.name, u.telegram_id::text),
+		               to_char(ab.from_date, 'DD/MM'), to_char(ab.to_date, 'DD/MM'))
+		 FROM staff_absences ab JOIN users u ON u.telegram_id = ab.user_id
+		 WHERE ab.status = 'requested'
+		 UNION ALL
+		 SELECT 'sick:' || ab.id,
+		        format('ridistribuzione delle pulizie di %s (%s dal %s al %s)', COALESCE(u.name, u.telegram_id::text),
+		               CASE ab.reason WHEN 'leave' THEN 'ferie' ELSE 'malattia' END,
+		               to_char(ab.from_date, 'DD/MM'), to_char(ab.to_date, 'DD/MM'))
+		 FROM staff_absences ab JOIN users u ON u.telegram_id = ab.user_id
+		 WHERE ab.proposal IS NOT NULL AND ab.resolution IS NULL AND ab.status = 'approved'
+		   AND ab.to_date >= (now() AT TIME ZONE 'Europe/Rome')::date`)
+	if err != nil {
+		return nil, fmt.Errorf("query pending approvals: %w", err)
+	}
+	defer rows.Close()
+	var out []handoffApproval
+	for rows.Next() {
+		var a handoffApproval
+		if err := rows.Scan(&a.callback, &a.line); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
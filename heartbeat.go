@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // startHeartbeatProducer launches a background goroutine that publishes
@@ -19,37 +20,63 @@ import (
 //
 //	HEARTBEAT_TIME=17:00              fire daily at this time (Europe/Rome)
 //	HEARTBEAT_INTERVAL_MINUTES=60    fire every N minutes (default; set to 0 to disable)
-func startHeartbeatProducer(ctx context.Context, bus agent.EventBus, managerID int64) {
+//
+// Each run sends one event to every manager of every property. The content
+// is that property's "heartbeat" content template (templates.go), with its
+// placeholders resolved as the manager right before publishing, so each one
+// sees their own property.
+func startHeartbeatProducer(ctx context.Context, adminPool *pgxpool.Pool, registry *UserRegistry, bus agent.EventBus) {
 	loc, _ := time.LoadLocation("Europe/Rome")
 
-	heartbeatContent := "🕐 Heartbeat check. Check the database for upcoming checkouts, check-ins, stale assignments, and any issues in the next 24 hours. Use execute_sql to investigate. If you find issues, use send_user_message to notify me with a summary. If everything looks fine, just reply OK."
+	// Used verbatim if the template cannot be rendered (e.g. no manager pool).
+	fallbackContent := "🕐 Heartbeat check. Check the database for upcoming checkouts, check-ins, stale assignments, and any issues in the next 24 hours. Use execute_sql to investigate. If you find issues, use send_user_message to notify me with a summary. If everything looks fine, just reply OK."
 
 	publish := func() {
-		bus.Publish(agent.AgentEvent{
-			Kind:     agent.EventHeartbeat,
-			TargetID: managerID,
-			ChatID:   managerID,
-			Content:  heartbeatContent,
-			Source:   "system",
-			EventID:  generateUUID(),
-		})
-		log.Printf("heartbeat: event published for manager %d", managerID)
+		hotels, err := hotelIDs(ctx, adminPool)
+		if err != nil {
+			log.Printf("heartbeat: %v", err)
+			return
+		}
+		for _, hotelID := range hotels {
+			tmpl := loadContentTemplate(ctx, adminPool, hotelID, "heartbeat", DefaultHeartbeatContent)
+			var hotelName string
+			if err := adminPool.QueryRow(ctx, `SELECT name FROM hotels WHERE id = $1`, hotelID).Scan(&hotelName); err != nil {
+				log.Printf("heartbeat: hotel %d: %v", hotelID, err)
+				continue
+			}
+			managers, err := managerIDs(ctx, adminPool, hotelID)
+			if err != nil {
+				log.Printf("heartbeat: %v", err)
+				continue
+			}
+			for _, managerID := range managers {
+				heartbeatContent := fallbackContent
+				if db, err := registry.Pool(ctx, managerID); err != nil {
+					log.Printf("heartbeat: manager pool: %v (using static content)", err)
+				} else {
+					heartbeatContent = renderContentTemplate(ctx, adminPool, db, hotelID, tmpl, hotelName)
+				}
+				bus.Publish(agent.AgentEvent{
+					Kind:     agent.EventHeartbeat,
+					TargetID: managerID,
+					ChatID:   managerID,
+					Content:  heartbeatContent,
+					Source:   "system",
+					EventID:  generateUUID(),
+				})
+			}
+			log.Printf("heartbeat: event published for %d manager(s) of hotel %d", len(managers), hotelID)
+		}
 	}
 
 	// HEARTBEAT_TIME=HH:MM → daily fire at exact time
 	if timeStr := envOr("HEARTBEAT_TIME", ""); timeStr != "" {
-		parts := strings.SplitN(timeStr, ":", 2)
-		if len(parts) != 2 {
+		hour, min, ok := parseClock(timeStr)
+		if !ok {
 			log.Printf("heartbeat: invalid HEARTBEAT_TIME=%q (expected HH:MM), disabling", timeStr)
 			return
 		}
-		hour, errH := strconv.Atoi(parts[0])
-		min, errM := strconv.Atoi(parts[1])
-		if errH != nil || errM != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
-			log.Printf("heartbeat: invalid HEARTBEAT_TIME=%q, disabling", timeStr)
-			return
-		}
-		log.Printf("heartbeat: daily mode, fires at %02d:%02d Europe/Rome for manager %d", hour, min, managerID)
+		log.Printf("heartbeat: daily mode, fires at %02d:%02d Europe/Rome", hour, min)
 		go func() {
 			for {
 				now := time.Now().In(loc)
@@ -79,7 +106,7 @@ func startHeartbeatProducer(ctx context.Context, bus agent.EventBus, managerID i
 		return
 	}
 	interval := time.Duration(minutes) * time.Minute
-	log.Printf("heartbeat: interval mode, every %v for manager %d", interval, managerID)
+	log.Printf("heartbeat: interval mode, every %v", interval)
 
 	go func() {
 		ticker := time.NewTicker(interval)
@@ -95,3 +122,17 @@ func startHeartbeatProducer(ctx context.Context, bus agent.EventBus, managerID i
 		}
 	}()
 }
+
+// parseClock parses "HH:MM" (24h). ok is false on any malformed input.
+func parseClock(s string) (hour, min int, ok bool) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	hour, errH := strconv.Atoi(parts[0])
+	min, errM := strconv.Atoi(parts[1])
+	if errH != nil || errM != nil || hour < 0 || hour > 23 || min < 0 || min > 59 {
+		return 0, 0, false
+	}
+	return hour, min, true
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Options are tentative reservations (status 'option') parked during a phone
+// inquiry. They block the room until hold_until; after that the overlap
+// trigger and availableRooms already ignore them, and startHoldExpiry marks
+// them 'expired' and tells the managers, so nothing is released silently.
+
+// startHoldExpiry launches a background goroutine that expires overdue
+// options every minute and notifies the managers and whoever placed the hold.
+func startHoldExpiry(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	go func() {
+		log.Printf("hold expiry started")
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		for {
+			expireHolds(ctx, pool, botToken)
+			select {
+			case <-ctx.Done():
+				log.Printf("hold expiry stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+type expiredHold struct {
+	id        int64
+	hotelID   int
+	room      string
+	guest     string
+	checkin   time.Time
+	checkout  time.Time
+	createdBy *int64
+}
+
+func expireHolds(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	rows, err := pool.Query(ctx,
+		`UPDATE reservations res SET status = 'expired'
+		 FROM rooms r
+		 WHERE r.id = res.room_id AND res.status = 'option' AND res.hold_until <= now()
+		 RETURNING res.id, res.hotel_id, r.name, COALESCE(res.guest_name, ''), res.checkin_at, res.checkout_at, res.created_by`)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("hold expiry: %v", err)
+		}
+		return
+	}
+	var expired []expiredHold
+	for rows.Next() {
+		var h expiredHold
+		if err := rows.Scan(&h.id, &h.hotelID, &h.room, &h.guest, &h.checkin, &h.checkout, &h.createdBy); err != nil {
+			log.Printf("hold expiry scan: %v", err)
+			continue
+		}
+		expired = append(expired, h)
+	}
+	rows.Close()
+	if len(expired) == 0 {
+		return
+	}
+
+	managers := make(map[int][]int64) // hotel → its managers
+	tg := newBot(botToken)
+	loc := romeLocation()
+	for _, h := range expired {
+		if _, ok := managers[h.hotelID]; !ok {
+			ids, err := managerIDs(ctx, pool, h.hotelID)
+			if err != nil {
+				log.Printf("hold expiry: %v", err)
+			}
+			managers[h.hotelID] = ids
+		}
+		guest := h.guest
+		if guest == "" {
+			guest = "ospite senza nome"
+		}
+		msg := fmt.Sprintf("⌛ Opzione scaduta: camera %s, %s, %s → %s (prenotazione %d). La camera è di nuovo disponibile.",
+			h.room, guest, h.checkin.In(loc).Format("02/01"), h.checkout.In(loc).Format("02/01"), h.id)
+		recipients := managers[h.hotelID]
+		if h.createdBy != nil && !containsID(recipients, *h.createdBy) {
+			recipients = append(append([]int64(nil), recipients...), *h.createdBy)
+		}
+		for _, id := range recipients {
+			if err := tg.Send(ctx, id, msg); err != nil {
+				log.Printf("hold expiry send to %d: %v", id, err)
+			}
+		}
+		log.Printf("hold expiry: reservation %d (room %s) expired", h.id, h.room)
+	}
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ── confirm_option ───────────────────────────────────────────────────────────
+
+type confirmOptionTool struct{}
+
+func (t *confirmOptionTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "confirm_option",
+		Description: "Conferma un'opzione (prenotazione provvisoria) ancora valida trasformandola in prenotazione confermata, " +
+			"oppure la rilascia subito con release=true. Per una prenotazione di gruppo vale per tutte le camere del gruppo. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer", "description": "ID della prenotazione in opzione"},
+				"release": {"type": "boolean", "description": "Rilascia l'opzione invece di confermarla"}
+			},
+			"required": ["reservation_id"]
+		}`),
+	}
+}
+
+func (t *confirmOptionTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64 `json:"reservation_id"`
+		Release       bool  `json:"release"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	status := "confirmed"
+	if in.Release {
+		status = "expired"
+	}
+	// Only a live option can be confirmed: once expired the room may already
+	// have been given to someone else, so it must go through add_reservation.
+	// A pair of connecting rooms, or a group booking, is confirmed or
+	// released as a whole (group_booking picks single rooms of a group).
+	tag, err := db.Exec(context.Background(),
+		`UPDATE reservations SET status = $2, hold_until = CASE WHEN $2 = 'confirmed' THEN NULL ELSE hold_until END
+		 WHERE (id = $1 OR linked_reservation_id = $1
+		        OR booking_group_id = (SELECT booking_group_id FROM reservations WHERE id = $1))
+		   AND status = 'option' AND hold_until > now()`, in.ReservationID, status)
+	if err != nil {
+		return "", fmt.Errorf("update: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Sprintf("Nessuna opzione valida con ID %d (scaduta, già confermata o permesso negato: solo i manager).", in.ReservationID), nil
+	}
+	pair := ""
+	switch n := tag.RowsAffected(); {
+	case n > 2:
+		pair = fmt.Sprintf(" (con le altre %d camere del gruppo)", n-1)
+	case n > 1:
+		pair = " (con l'altra camera collegata)"
+	}
+	if in.Release {
+		return fmt.Sprintf("✅ Opzione %d%s rilasciata, la camera è di nuovo disponibile.", in.ReservationID, pair), nil
+	}
+	return fmt.Sprintf("✅ Opzione %d%s confermata.", in.ReservationID, pair), nil
+}
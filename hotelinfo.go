@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Hotel info: the practical information guests ask for — how to get here,
+// check-in arrangements, parking, the WiFi — one hotel_info row per topic.
+// Managers keep it with hotel_info; the guest messages use it through the
+// {directions}, {checkin_info}, {parking} and {wifi} placeholders
+// (guestmessages.go), and staff read it to answer guests.
+
+// hotelInfoTopics are the values of hotel_info.topic, in display order, with
+// their label and the guest message placeholder that carries them.
+var hotelInfoTopics = []struct {
+	topic, label, placeholder string
+}{
+	{"directions", "come arrivare", "directions"},
+	{"checkin", "check-in", "checkin_info"},
+	{"parking", "parcheggio", "parking"},
+	{"wifi", "Wi-Fi", "wifi"},
+}
+
+// loadHotelInfo returns the info of a property by topic; topics not filled
+// in are missing.
+func loadHotelInfo(ctx context.Context, db querier, hotelID int) (map[string]string, error) {
+	rows, err := db.Query(ctx, `SELECT topic, body FROM hotel_info WHERE hotel_id = $1`, hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query hotel info: %w", err)
+	}
+	defer rows.Close()
+	info := make(map[string]string)
+	for rows.Next() {
+		var topic, body string
+		if err := rows.Scan(&topic, &body); err != nil {
+			return nil, err
+		}
+		info[topic] = body
+	}
+	return info, rows.Err()
+}
+
+// ── hotel_info ───────────────────────────────────────────────────────────────
+
+type hotelInfoTool struct{}
+
+func (t *hotelInfoTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "hotel_info",
+		Description: "Informazioni pratiche per gli ospiti: come arrivare (directions), check-in, parcheggio, Wi-Fi. " +
+			"Senza argomenti le mostra; con topic e text un manager le aggiorna (text vuoto la cancella). " +
+			"Finiscono nel messaggio prima dell'arrivo.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"topic": {"type": "string", "enum": ["directions", "checkin", "parking", "wifi"]},
+				"text": {"type": "string", "description": "Testo per gli ospiti, es. 'Rete HotelOspiti, password mare2024'"}
+			}
+		}`),
+	}
+}
+
+func (t *hotelInfoTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Topic string  `json:"topic"`
+		Text  *string `json:"text"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	if in.Topic != "" && in.Text != nil {
+		label := ""
+		for _, ti := range hotelInfoTopics {
+			if ti.topic == in.Topic {
+				label = ti.label
+			}
+		}
+		if label == "" {
+			return "", fmt.Errorf("topic must be directions, checkin, parking or wifi")
+		}
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("only managers can change the hotel info")
+		}
+		text := strings.TrimSpace(*in.Text)
+		if text == "" {
+			if _, err := db.Exec(bg, `DELETE FROM hotel_info WHERE topic = $1`, in.Topic); err != nil {
+				return "", fmt.Errorf("delete hotel info: %w", err)
+			}
+			return fmt.Sprintf("ℹ️ Informazione «%s» cancellata.", label), nil
+		}
+		if _, err := db.Exec(bg,
+			`INSERT INTO hotel_info (topic, body, updated_by) VALUES ($1, $2, $3)
+			 ON CONFLICT (hotel_id, topic) DO UPDATE SET body = $2, updated_by = $3, updated_at = now()`,
+			in.Topic, text, ctx.UserID); err != nil {
+			return "", fmt.Errorf("save hotel info: %w", err)
+		}
+		return fmt.Sprintf("ℹ️ Informazione «%s» salvata.", label), nil
+	}
+
+	var hotelID int
+	if err := db.QueryRow(bg, `SELECT current_hotel_id()`).Scan(&hotelID); err != nil {
+		return "", fmt.Errorf("current hotel: %w", err)
+	}
+	info, err := loadHotelInfo(bg, db, hotelID)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("ℹ️ Informazioni per gli ospiti:")
+	for _, ti := range hotelInfoTopics {
+		if in.Topic != "" && in.Topic != ti.topic {
+			continue
+		}
+		body, ok := info[ti.topic]
+		if !ok {
+			body = "(da compilare)"
+		}
+		fmt.Fprintf(&sb, "\n• %s [%s]: %s", ti.label, ti.topic, body)
+	}
+	return sb.String(), nil
+}
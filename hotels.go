@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// One deployment can run several properties of the same owner. Every table
+// of property data carries a hotel_id, and RLS scopes each staff member to
+// their own property (current_hotel_id() in db/rls.sql). New staff join the
+// property of the manager who invited them. The background jobs work across
+// properties through the admin pool and report to each one's managers
+// (managerIDs).
+//
+// Configure via env:
+//
+//	HOTEL_ID=1    property of the bootstrap admin; created with HOTEL_NAME if missing
+
+// seedHotel makes sure hotel id exists, named name. An existing row keeps its
+// name, so a property renamed in the database is not reverted on restart.
+// Properties already taking reservations are marked as set up, so the setup
+// wizard (setup.go) only runs on a fresh database.
+func seedHotel(ctx context.Context, pool *pgxpool.Pool, id int, name string) error {
+	if _, err := pool.Exec(ctx,
+		`INSERT INTO hotels (id, name) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, id, name,
+	); err != nil {
+		return fmt.Errorf("insert hotel %d: %w", id, err)
+	}
+	// Explicit ids bypass the serial: keep it ahead for properties added later.
+	if _, err := pool.Exec(ctx,
+		`SELECT setval(pg_get_serial_sequence('hotels', 'id'), (SELECT max(id) FROM hotels))`,
+	); err != nil {
+		return fmt.Errorf("sync hotels sequence: %w", err)
+	}
+	if _, err := pool.Exec(ctx,
+		`UPDATE hotels h SET setup_completed_at = now()
+		 WHERE h.setup_completed_at IS NULL
+		   AND EXISTS (SELECT 1 FROM reservations r WHERE r.hotel_id = h.id)`,
+	); err != nil {
+		return fmt.Errorf("mark hotels set up: %w", err)
+	}
+	return nil
+}
+
+// hotelIDs returns the id of every property, for the background jobs that
+// report to each one's managers.
+func hotelIDs(ctx context.Context, pool *pgxpool.Pool) ([]int, error) {
+	rows, err := pool.Query(ctx, `SELECT id FROM hotels ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query hotels: %w", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// hotelSettingDefs are the settings a manager changes from the chat
+// (configure_hotel), stored in hotel_settings. An unset key falls back to its
+// env variable, then to def. The key list matches hotel_settings_key_check.
+// A deployment setting drives one job for the whole deployment (the kitchen
+// has a single chat), so only the HOTEL_ID property's value is used and only
+// its managers may change it.
+var hotelSettingDefs = []struct {
+	key, env, def, label string
+	deployment           bool
+}{
+	{"evening_digest_time", "EVENING_DIGEST_TIME", "20:00", "riepilogo serale ai manager", false},
+	{"kitchen_digest_time", "KITCHEN_DIGEST_TIME", "18:00", "riepilogo per la cucina", true},
+}
+
+// hotelSetting returns the value of setting key for property hotelID.
+func hotelSetting(ctx context.Context, pool *pgxpool.Pool, hotelID int, key string) string {
+	var v string
+	err := pool.QueryRow(ctx,
+		`SELECT value FROM hotel_settings WHERE hotel_id = $1 AND key = $2`, hotelID, key,
+	).Scan(&v)
+	if err == nil && v != "" {
+		return v
+	}
+	for _, d := range hotelSettingDefs {
+		if d.key == key {
+			return envOr(d.env, d.def)
+		}
+	}
+	return ""
+}
+
+// settingRecheck is how often waitDaily re-reads its setting while waiting.
+const settingRecheck = 10 * time.Minute
+
+// waitDaily blocks until the next daily run at the HH:MM time held by setting
+// key of property hotelID, re-reading it every settingRecheck so a time
+// changed from the chat applies without a restart. "off" or an invalid time
+// pauses the job until it is set again. It returns false when ctx is done.
+func waitDaily(ctx context.Context, pool *pgxpool.Pool, hotelID int, key string) (time.Time, bool) {
+	loc := romeLocation()
+	since := time.Now().In(loc)
+	last := ""
+	for {
+		wait := settingRecheck
+		v := hotelSetting(ctx, pool, hotelID, key)
+		if hour, minute, ok := parseClock(v); ok {
+			next := time.Date(since.Year(), since.Month(), since.Day(), hour, minute, 0, 0, loc)
+			if !next.After(since) {
+				next = next.AddDate(0, 0, 1)
+			}
+			now := time.Now()
+			if !now.Before(next) {
+				return next, true
+			}
+			wait = min(wait, next.Sub(now))
+		} else if v != last {
+			log.Printf("%s: hotel %d: disabled (%q)", key, hotelID, v)
+		}
+		last = v
+		select {
+		case <-ctx.Done():
+			return time.Time{}, false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// eachHotelDaily runs fn every day for each property, at the time held by
+// that property's setting key (waitDaily). Properties added later are picked
+// up within settingRecheck. It blocks until ctx is done.
+func eachHotelDaily(ctx context.Context, pool *pgxpool.Pool, key string, fn func(hotelID int, next time.Time)) {
+	started := make(map[int]bool)
+	for {
+		hotels, err := hotelIDs(ctx, pool)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s: %v", key, err)
+		}
+		for _, hotelID := range hotels {
+			if started[hotelID] {
+				continue
+			}
+			started[hotelID] = true
+			go func() {
+				for {
+					next, ok := waitDaily(ctx, pool, hotelID, key)
+					if !ok {
+						return
+					}
+					fn(hotelID, next)
+				}
+			}()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(settingRecheck):
+		}
+	}
+}
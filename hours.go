@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Worked hours per cleaner, against the contracted users.weekly_hours.
+//
+// A day someone clocked in (work_sessions, worktime.go) counts the clocked
+// sessions; a session still open counts up to now, at most twelve hours.
+// Other days are measured from the assignments: the working day runs from the
+// first assignment started (started_at, or completed_at when closed without
+// start_task) to the last one completed, as stamped by the
+// assignments_timestamps trigger, an assignment still in progress counting up
+// to now, at most four hours. The week starts on Monday, Europe/Rome.
+//
+// startHoursWatch alerts the managers when a cleaner reaches the alert share of
+// their weekly hours and again when they exceed them; the evening digest on
+// Friday lists everyone's hours of the week.
+//
+// Configure via env:
+//
+//	HOURS_ALERT_PERCENT=90   share of weekly_hours that triggers the first alert; 0 disables
+
+// cleanerHours is one cleaner's worked hours of a week.
+type cleanerHours struct {
+	id      int64
+	hotelID int
+	name    string
+	worked  float64
+	// contracted is users.weekly_hours, 0 when not set.
+	contracted float64
+}
+
+// weekStart returns the Monday 00:00 of t's week, in t's location.
+func weekStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+}
+
+// workedDaysCTE is the "days" CTE of (cleaner_id, day, hours, clocked) worked
+// between $1 and $2, one row per staff member and Europe/Rome day; clocked
+// days replace the measure from the assignments.
+const workedDaysCTE = `WITH clocked AS (
+	SELECT w.user_id AS cleaner_id,
+	       (w.started_at AT TIME ZONE 'Europe/Rome')::date AS day,
+	       sum(extract(epoch FROM COALESCE(w.ended_at, LEAST(now(), w.started_at + interval '12 hours'))
+	                            - w.started_at)) / 3600 AS hours
+	FROM work_sessions w
+	WHERE w.started_at >= $1 AND w.started_at < $2
+	GROUP BY 1, 2
+), measured AS (
+	SELECT a.cleaner_id,
+	       (COALESCE(a.started_at, a.completed_at) AT TIME ZONE 'Europe/Rome')::date AS day,
+	       extract(epoch FROM max(COALESCE(a.completed_at, LEAST(now(), a.started_at + interval '4 hours')))
+	                        - min(COALESCE(a.started_at, a.completed_at))) / 3600 AS hours
+	FROM assignments a
+	WHERE COALESCE(a.started_at, a.completed_at) >= $1
+	  AND COALESCE(a.started_at, a.completed_at) < $2
+	GROUP BY 1, 2
+), days AS (
+	SELECT c.*, true AS clocked FROM clocked c
+	UNION ALL
+	SELECT m.*, false FROM measured m
+	WHERE NOT EXISTS (SELECT 1 FROM clocked c WHERE c.cleaner_id = m.cleaner_id AND c.day = m.day)
+)
+`
+
+// weekHours returns the hours worked from monday to now by every cleaner of
+// property hotelID (0: every property), most worked first.
+func weekHours(ctx context.Context, db querier, monday time.Time, hotelID int) ([]cleanerHours, error) {
+	rows, err := db.Query(ctx, workedDaysCTE+
+		`SELECT u.telegram_id, u.hotel_id, COALESCE(u.name, u.telegram_id::text), COALESCE(u.weekly_hours, 0)::float8,
+		        COALESCE(sum(d.hours), 0)::float8
+		 FROM users u LEFT JOIN days d ON d.cleaner_id = u.telegram_id
+		 WHERE u.role = 'cleaner' AND ($3::int = 0 OR u.hotel_id = $3)
+		 GROUP BY u.telegram_id, u.hotel_id, u.name, u.weekly_hours
+		 ORDER BY 5 DESC, 3`,
+		monday, monday.AddDate(0, 0, 7), hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query hours: %w", err)
+	}
+	defer rows.Close()
+	var out []cleanerHours
+	for rows.Next() {
+		var h cleanerHours
+		if err := rows.Scan(&h.id, &h.hotelID, &h.name, &h.contracted, &h.worked); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// formatHours renders hours as "12h30".
+func formatHours(h float64) string {
+	m := int(h*60 + 0.5)
+	return fmt.Sprintf("%dh%02d", m/60, m%60)
+}
+
+func (h cleanerHours) String() string {
+	if h.contracted == 0 {
+		return fmt.Sprintf("%s: %s", h.name, formatHours(h.worked))
+	}
+	s := fmt.Sprintf("%s: %s su %s", h.name, formatHours(h.worked), formatHours(h.contracted))
+	if h.worked > h.contracted {
+		s += fmt.Sprintf(" (+%s straordinario)", formatHours(h.worked-h.contracted))
+	}
+	return s
+}
+
+// hoursLevel is how far a cleaner is into their weekly hours: 0 below the
+// alert share, 1 near the limit, 2 over it.
+func hoursLevel(h cleanerHours, percent int) int {
+	switch {
+	case h.contracted == 0:
+		return 0
+	case h.worked > h.contracted:
+		return 2
+	case h.worked >= h.contracted*float64(percent)/100:
+		return 1
+	}
+	return 0
+}
+
+// startHoursWatch launches the overtime alert goroutine. Levels already
+// reached when the bot starts are not alerted again, so a restart does not
+// repeat the week's alerts.
+func startHoursWatch(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	percent := envInt("HOURS_ALERT_PERCENT", 90)
+	if percent <= 0 {
+		log.Printf("hours watch: disabled")
+		return
+	}
+	loc := romeLocation()
+	alerted := make(map[int64]int) // cleaner → level alerted this week
+	var week time.Time
+
+	check := func(notify bool) {
+		monday := weekStart(time.Now().In(loc))
+		if !monday.Equal(week) {
+			week = monday
+			clear(alerted)
+		}
+		hours, err := weekHours(ctx, pool, monday, 0)
+		if err != nil {
+			log.Printf("hours watch: %v", err)
+			return
+		}
+		lines := make(map[int][]string) // hotel → alerts for its managers
+		for _, h := range hours {
+			level := hoursLevel(h, percent)
+			if level <= alerted[h.id] {
+				continue
+			}
+			alerted[h.id] = level
+			if level == 2 {
+				lines[h.hotelID] = append(lines[h.hotelID], "🔴 "+h.String())
+			} else {
+				lines[h.hotelID] = append(lines[h.hotelID], "🟠 "+h.String())
+			}
+		}
+		if !notify {
+			return
+		}
+		tg := newBot(botToken)
+		for hotelID, hotelLines := range lines {
+			managers, err := managerIDs(ctx, pool, hotelID)
+			if err != nil {
+				log.Printf("hours watch: %v", err)
+				return
+			}
+			text := fmt.Sprintf("⏱ Ore settimanali (soglia %d%% del contratto):\n%s", percent, strings.Join(hotelLines, "\n"))
+			for _, id := range managers {
+				if err := tg.Send(ctx, id, text); err != nil {
+					log.Printf("hours watch: send to %d: %v", id, err)
+				}
+			}
+		}
+	}
+
+	go func() {
+		check(false)
+		ticker := time.NewTicker(15 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check(true)
+			}
+		}
+	}()
+}
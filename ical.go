@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// icalHandler serves the reservations of the HOTEL_ID property as an
+// iCalendar (RFC 5545) feed, so its managers can subscribe from Google/Apple
+// Calendar. Calendar apps cannot send headers, so the token travels in the
+// query string:
+//
+//	GET /reservations.ics?token=…
+//
+// Options are published as TENTATIVE events; expired and cancelled
+// reservations are left out.
+//
+// Configure via env:
+//
+//	ICAL_TOKEN=…   shared secret for the feed URL; empty disables the endpoint
+type icalHandler struct {
+	pool      *pgxpool.Pool
+	token     string
+	hotelID   int
+	hotelName string
+}
+
+func (h *icalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.token)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	body, err := renderICal(r.Context(), h.pool, h.hotelID, h.hotelName)
+	if err != nil {
+		log.Printf("ical: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write([]byte(body))
+}
+
+func renderICal(ctx context.Context, pool *pgxpool.Pool, hotelID int, hotelName string) (string, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT res.id, r.name, COALESCE(res.guest_name, ''), res.guests, res.checkin_at, res.checkout_at,
+		        res.status, res.source, COALESCE(res.notes, ''), res.created_at
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.hotel_id = $1 AND res.status IN ('confirmed', 'option')
+		 ORDER BY res.checkin_at`, hotelID)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	line := func(s string) { sb.WriteString(icalFold(s)) }
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//m4d-coso//reservations//IT")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icalEscape(hotelName+" — prenotazioni"))
+	line("X-WR-TIMEZONE:Europe/Rome")
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for rows.Next() {
+		var id int64
+		var room, guest, status, source, notes string
+		var guests int
+		var checkin, checkout, created time.Time
+		if err := rows.Scan(&id, &room, &guest, &guests, &checkin, &checkout, &status, &source, &notes, &created); err != nil {
+			return "", err
+		}
+		summary := fmt.Sprintf("Camera %s", room)
+		if guest != "" {
+			summary += " — " + guest
+		}
+		if status == "option" {
+			summary = "[Opzione] " + summary
+		}
+		desc := fmt.Sprintf("Prenotazione %d, %d pers., canale %s", id, guests, source)
+		if notes != "" {
+			desc += "\n" + notes
+		}
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:reservation-%d@m4d-coso", id))
+		line("DTSTAMP:" + stamp)
+		line("CREATED:" + created.UTC().Format("20060102T150405Z"))
+		line("DTSTART:" + checkin.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + checkout.UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + icalEscape(summary))
+		line("DESCRIPTION:" + icalEscape(desc))
+		if status == "option" {
+			line("STATUS:TENTATIVE")
+		} else {
+			line("STATUS:CONFIRMED")
+		}
+		line("END:VEVENT")
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	line("END:VCALENDAR")
+	return sb.String(), nil
+}
+
+// icalEscape escapes a TEXT value (RFC 5545 §3.3.11).
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icalFold terminates a content line with CRLF, folding it at 75 octets
+// without splitting a UTF-8 sequence (RFC 5545 §3.1).
+func icalFold(s string) string {
+	var sb strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > 75 {
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(r)
+		n += size
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Complaints and incidents: a guest unhappy with the noise, a slip on the
+// wet stairs, a rude word between colleagues. Anyone logs one as themselves
+// (log_incident), naming the room and the staff involved; only managers read
+// the ones of others and write the resolution, which closes it. RLS decides
+// both, as for maintenance tickets. Open incidents are part of the heartbeat
+// (saved query open_incidents) and incident_report sums up a period.
+
+// incidentKinds are the values of incidents.kind.
+var incidentKinds = map[string]string{
+	"complaint": "Reclamo",
+	"incident":  "Incidente",
+}
+
+// ── log_incident ─────────────────────────────────────────────────────────────
+
+type logIncidentTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *logIncidentTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_incident",
+		Description: "Registra un reclamo di un ospite o un incidente (infortunio, danno, lite) con gravità, camera e personale coinvolto. " +
+			"Quelli high o urgent vengono notificati subito ai manager. Con incident_id e resolution un manager registra " +
+			"com'è stato risolto e lo chiude.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"kind": {"type": "string", "enum": ["complaint", "incident"], "description": "complaint = reclamo di un ospite (default), incident = incidente"},
+				"description": {"type": "string", "description": "Cosa è successo"},
+				"severity": {"type": "string", "enum": ["low", "normal", "high", "urgent"], "description": "Gravità (default normal)"},
+				"room": {"type": "string", "description": "Camera interessata (omettere per aree comuni)"},
+				"guest_name": {"type": "string", "description": "Ospite coinvolto (opzionale)"},
+				"staff": {"type": "array", "items": {"type": "string"}, "description": "Nomi del personale coinvolto (opzionale)"},
+				"incident_id": {"type": "integer", "description": "Per chiudere un incidente già registrato (solo manager)"},
+				"resolution": {"type": "string", "description": "Com'è stato risolto (con incident_id)"}
+			}
+		}`),
+	}
+}
+
+func (t *logIncidentTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Kind        string   `json:"kind"`
+		Description string   `json:"description"`
+		Severity    string   `json:"severity"`
+		Room        string   `json:"room"`
+		GuestName   string   `json:"guest_name"`
+		Staff       []string `json:"staff"`
+		IncidentID  int64    `json:"incident_id"`
+		Resolution  string   `json:"resolution"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	if in.IncidentID > 0 {
+		return t.resolve(ctx, db, in.IncidentID, strings.TrimSpace(in.Resolution))
+	}
+
+	if in.Kind == "" {
+		in.Kind = "complaint"
+	}
+	if _, ok := incidentKinds[in.Kind]; !ok {
+		return "", fmt.Errorf("kind must be complaint or incident")
+	}
+	if in.Severity == "" {
+		in.Severity = "normal"
+	}
+	if strings.TrimSpace(in.Description) == "" {
+		return "", fmt.Errorf("description is required")
+	}
+	bg := context.Background()
+
+	var roomID *int64
+	if room := strings.TrimSpace(in.Room); room != "" {
+		var id int64
+		err := db.QueryRow(bg, `SELECT id FROM rooms WHERE lower(name) = lower($1)`, room).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("camera %q non trovata", room)
+		}
+		if err != nil {
+			return "", fmt.Errorf("query room: %w", err)
+		}
+		roomID = &id
+	}
+	staffIDs := []int64{}
+	var staffNames []string
+	for _, name := range in.Staff {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var id int64
+		var full string
+		err := db.QueryRow(bg,
+			`SELECT telegram_id, name FROM users WHERE name ILIKE $1 || '%' ORDER BY lower(name) = lower($1) DESC, name LIMIT 1`,
+			name).Scan(&id, &full)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("nessun membro del personale si chiama %q", name)
+		}
+		if err != nil {
+			return "", fmt.Errorf("query staff: %w", err)
+		}
+		staffIDs = append(staffIDs, id)
+		staffNames = append(staffNames, full)
+	}
+
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO incidents (kind, severity, room_id, guest_name, description, staff_ids, reported_by)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7) RETURNING id`,
+		in.Kind, in.Severity, roomID, strings.TrimSpace(in.GuestName), strings.TrimSpace(in.Description), staffIDs, ctx.UserID,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert incident: %w", err)
+	}
+
+	where := "area comune"
+	if roomID != nil {
+		where = "camera " + strings.TrimSpace(in.Room)
+	}
+	msg := fmt.Sprintf("📝 %s #%d registrato (%s, gravità %s)", incidentKinds[in.Kind], id, where, in.Severity)
+	if len(staffNames) > 0 {
+		msg += ", personale coinvolto: " + strings.Join(staffNames, ", ")
+	}
+	msg += "."
+	if in.Severity == "high" || in.Severity == "urgent" {
+		t.notifyManagers(ctx, id, in.Kind, in.Severity, where, strings.TrimSpace(in.Description))
+		msg += " I manager sono stati avvisati."
+	}
+	return msg, nil
+}
+
+// resolve records the resolution and closes the incident. Zero rows means
+// no such open incident or RLS refused the update (managers only).
+func (t *logIncidentTool) resolve(ctx agent.ToolContext, db *pgxpool.Pool, id int64, resolution string) (string, error) {
+	if resolution == "" {
+		return "", fmt.Errorf("resolution is required to close an incident")
+	}
+	bg := context.Background()
+	var reporter int64
+	var kind, description string
+	err := db.QueryRow(bg,
+		`UPDATE incidents SET status = 'resolved', resolution = $2, resolved_by = $3, resolved_at = now()
+		 WHERE id = $1 AND status = 'open'
+		 RETURNING reported_by, kind, description`,
+		id, resolution, ctx.UserID,
+	).Scan(&reporter, &kind, &description)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("incidente #%d non trovato, già chiuso, o permesso negato (solo i manager possono chiuderli)", id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolve incident: %w", err)
+	}
+	if reporter != ctx.UserID {
+		_ = newBot(t.botToken).Send(bg, reporter,
+			fmt.Sprintf("✅ %s #%d (%s) risolto.\n%s", incidentKinds[kind], id, description, resolution))
+	}
+	return fmt.Sprintf("✅ %s #%d chiuso.", incidentKinds[kind], id), nil
+}
+
+func (t *logIncidentTool) notifyManagers(ctx agent.ToolContext, id int64, kind, severity, where, description string) {
+	bg := context.Background()
+	var reporter string
+	var hotelID int
+	_ = t.adminPool.QueryRow(bg, `SELECT COALESCE(name, ''), hotel_id FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&reporter, &hotelID)
+	msg := fmt.Sprintf("🚨 %s #%d (%s) — %s\n%s\nSegnalato da %s.",
+		incidentKinds[kind], id, severity, where, description, reporter)
+	managers, err := managerIDs(bg, t.adminPool, hotelID)
+	if err != nil {
+		return
+	}
+	tg := newBot(t.botToken)
+	for _, m := range managers {
+		if m == ctx.UserID {
+			continue
+		}
+		_ = tg.Send(bg, m, msg)
+	}
+}
+
+// ── incident_report ──────────────────────────────────────────────────────────
+
+type incidentReportTool struct{}
+
+func (t *incidentReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "incident_report",
+		Description: "Reclami e incidenti di un periodo: totali per tipo e gravità, quanti ancora aperti, e l'elenco con camera, " +
+			"personale coinvolto e risoluzione. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD (default: 30 giorni fa)"},
+				"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD (default: oggi)"},
+				"open_only": {"type": "boolean", "description": "Solo quelli ancora aperti, di qualsiasi data (default false)"}
+			}
+		}`),
+	}
+}
+
+func (t *incidentReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From     string `json:"from"`
+		To       string `json:"to"`
+		OpenOnly bool   `json:"open_only"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	now := time.Now().In(romeLocation())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from, to, err := parseReportRange(in.From, in.To, today.AddDate(0, 0, -30),
+		func(time.Time) time.Time { return today }, analyticsMaxDays)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("incident_report is only available to managers")
+	}
+
+	const period = `(($3 AND i.status = 'open') OR (NOT $3 AND (i.created_at AT TIME ZONE 'Europe/Rome')::date BETWEEN $1 AND $2))`
+	var sb strings.Builder
+	if in.OpenOnly {
+		sb.WriteString("📝 Reclami e incidenti aperti\n")
+	} else {
+		fmt.Fprintf(&sb, "📝 Reclami e incidenti %s → %s\n", from.Format("02/01/2006"), to.Format("02/01/2006"))
+	}
+	rows, err := db.Query(bg,
+		`SELECT i.kind, i.severity, count(*), count(*) FILTER (WHERE i.status = 'open')
+		 FROM incidents i WHERE `+period+`
+		 GROUP BY i.kind, i.severity
+		 ORDER BY i.kind, array_position(ARRAY['urgent','high','normal','low'], i.severity)`,
+		from, to, in.OpenOnly)
+	if err != nil {
+		return "", fmt.Errorf("query incidents: %w", err)
+	}
+	total, open := 0, 0
+	for rows.Next() {
+		var kind, severity string
+		var n, o int
+		if err := rows.Scan(&kind, &severity, &n, &o); err != nil {
+			rows.Close()
+			return "", err
+		}
+		fmt.Fprintf(&sb, "• %s %s: %d (%d aperti)\n", strings.ToLower(incidentKinds[kind]), severity, n, o)
+		total += n
+		open += o
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if total == 0 {
+		return sb.String() + "Nessuno.", nil
+	}
+	fmt.Fprintf(&sb, "Totale %d, aperti %d.\n\n", total, open)
+
+	rows, err = db.Query(bg,
+		`SELECT i.id, i.kind, i.severity, i.status, COALESCE(r.name, '-') AS room, COALESCE(i.guest_name, '') AS guest,
+		        i.description,
+		        COALESCE((SELECT string_agg(u.name, ', ' ORDER BY u.name) FROM users u WHERE u.telegram_id = ANY(i.staff_ids)), '') AS staff,
+		        rep.name AS reported_by, to_char(i.created_at AT TIME ZONE 'Europe/Rome', 'DD/MM HH24:MI') AS at,
+		        COALESCE(i.resolution, '') AS resolution
+		 FROM incidents i
+		 LEFT JOIN rooms r ON r.id = i.room_id
+		 JOIN users rep ON rep.telegram_id = i.reported_by
+		 WHERE `+period+`
+		 ORDER BY i.status = 'resolved', array_position(ARRAY['urgent','high','normal','low'], i.severity), i.created_at`,
+		from, to, in.OpenOnly)
+	if err != nil {
+		return "", fmt.Errorf("query incidents: %w", err)
+	}
+	out, err := formatRows(rows)
+	if err != nil {
+		return "", err
+	}
+	return sb.String() + out, nil
+}
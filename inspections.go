@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Room inspections after a checkout clean. A checklist (checklists +
+// checklist_items) is a numbered template per room type; the one with no room
+// type applies to every room whose type has none of its own. When the
+// checklist is required, room_inspection_pending() holds the room in
+// inspection_due after the clean (lifecycle.go) and the rooms_inspection_gate
+// trigger refuses ready/available until a manager records a passed inspection
+// with inspect_room. required=false keeps the checklist as a guide only.
+
+// roomChecklist returns the checklist that applies to roomID and its items;
+// id 0 when there is none.
+func roomChecklist(ctx context.Context, db *pgxpool.Pool, roomID int64) (id int64, required bool, items []string, err error) {
+	err = db.QueryRow(ctx,
+		`SELECT c.id, c.required
+		 FROM rooms r
+		 JOIN checklists c ON c.hotel_id = r.hotel_id
+		                  AND (c.room_type_id = r.room_type_id OR c.room_type_id IS NULL)
+		 WHERE r.id = $1
+		 ORDER BY c.room_type_id IS NULL
+		 LIMIT 1`, roomID,
+	).Scan(&id, &required)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil, nil
+	}
+	if err != nil {
+		return 0, false, nil, fmt.Errorf("query checklist: %w", err)
+	}
+	rows, err := db.Query(ctx, `SELECT label FROM checklist_items WHERE checklist_id = $1 ORDER BY position`, id)
+	if err != nil {
+		return 0, false, nil, fmt.Errorf("query checklist items: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return 0, false, nil, err
+		}
+		items = append(items, label)
+	}
+	return id, required, items, rows.Err()
+}
+
+// inspectionDueNotifier tells the managers when a room enters inspection_due.
+func inspectionDueNotifier(adminPool *pgxpool.Pool, botToken string) func(context.Context, RoomStatusChange) {
+	return func(ctx context.Context, c RoomStatusChange) {
+		if c.NewStatus != "inspection_due" {
+			return
+		}
+		managers, err := managerIDs(ctx, adminPool, c.HotelID)
+		if err != nil {
+			log.Printf("inspections: %v", err)
+			return
+		}
+		msg := fmt.Sprintf("🔍 Camera %s pulita dopo il checkout: va ispezionata prima di diventare pronta "+
+			"(\"ispeziona la %s\").", c.RoomName, c.RoomName)
+		tg := newBot(botToken)
+		for _, id := range managers {
+			if err := tg.Send(ctx, id, msg); err != nil {
+				log.Printf("inspections: send to %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// ── inspect_room ─────────────────────────────────────────────────────────────
+
+type inspectRoomTool struct {
+	botToken string
+}
+
+func (t *inspectRoomTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "inspect_room",
+		Description: "Ispezione di una camera dopo la pulizia di checkout. Con solo room mostra la checklist numerata; " +
+			"con ok/failed (numeri delle voci) o all_ok registra l'ispezione. Se qualcosa non va avvisa chi ha pulito. " +
+			"Quando la checklist è obbligatoria la camera diventa pronta solo dopo un'ispezione superata. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera"},
+				"ok": {"type": "array", "items": {"type": "integer"}, "description": "Voci controllate e a posto"},
+				"failed": {"type": "array", "items": {"type": "integer"}, "description": "Voci non a posto"},
+				"all_ok": {"type": "boolean", "description": "Tutte le voci non in failed sono a posto"},
+				"notes": {"type": "string", "description": "Note per chi ha pulito"}
+			},
+			"required": ["room"]
+		}`),
+	}
+}
+
+func (t *inspectRoomTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room   string `json:"room"`
+		OK     []int  `json:"ok"`
+		Failed []int  `json:"failed"`
+		AllOK  *bool  `json:"all_ok"`
+		Notes  string `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Room) == "" {
+		return "", fmt.Errorf("room is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("inspect_room is only available to managers")
+	}
+
+	var roomID int64
+	var room, status string
+	if err := db.QueryRow(bg,
+		`SELECT id, name, status FROM rooms WHERE lower(name) = lower($1)`, strings.TrimSpace(in.Room),
+	).Scan(&roomID, &room, &status); err != nil {
+		return "", fmt.Errorf("camera %q non trovata", in.Room)
+	}
+	checklistID, required, items, err := roomChecklist(bg, db, roomID)
+	if err != nil {
+		return "", err
+	}
+	var assignmentID, cleanerID *int64
+	var cleaner, cleanedAt string
+	err = db.QueryRow(bg,
+		`SELECT a.id, a.cleaner_id, COALESCE(u.name, a.cleaner_id::text),
+		        COALESCE(to_char(a.completed_at AT TIME ZONE 'Europe/Rome', 'DD/MM HH24:MI'), a.date::text)
+		 FROM assignments a LEFT JOIN users u ON u.telegram_id = a.cleaner_id
+		 WHERE a.room_id = $1 AND a.type = 'checkout' AND a.status = 'done'
+		 ORDER BY a.completed_at DESC NULLS LAST
+		 LIMIT 1`, roomID,
+	).Scan(&assignmentID, &cleanerID, &cleaner, &cleanedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("query last clean: %w", err)
+	}
+
+	// No verdict given: show what is to be checked.
+	if in.AllOK == nil && len(in.OK) == 0 && len(in.Failed) == 0 {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Camera %s (%s).", room, status)
+		if assignmentID != nil {
+			fmt.Fprintf(&sb, " Ultima pulizia di checkout: %s, %s.", cleaner, cleanedAt)
+		}
+		switch {
+		case checklistID == 0:
+			sb.WriteString("\nNessuna checklist: registra l'ispezione con all_ok (true o false) e le note.")
+		case len(items) == 0:
+			sb.WriteString("\nLa checklist è vuota: registra l'ispezione con all_ok (true o false) e le note.")
+		default:
+			if required {
+				sb.WriteString("\nChecklist (obbligatoria):")
+			} else {
+				sb.WriteString("\nChecklist (facoltativa):")
+			}
+			for i, item := range items {
+				fmt.Fprintf(&sb, "\n%d. %s", i+1, item)
+			}
+		}
+		return sb.String(), nil
+	}
+
+	allOK := in.AllOK != nil && *in.AllOK
+	verdict := make(map[int]bool, len(items))
+	for _, n := range in.OK {
+		verdict[n] = true
+	}
+	for _, n := range in.Failed {
+		verdict[n] = false
+	}
+	for n := range verdict {
+		if n < 1 || n > len(items) {
+			return "", fmt.Errorf("voce %d inesistente: la checklist ha %d voci", n, len(items))
+		}
+	}
+	failed := []string{}
+	var missing []string
+	for i, item := range items {
+		ok, seen := verdict[i+1]
+		switch {
+		case seen && !ok:
+			failed = append(failed, item)
+		case !seen && !allOK:
+			missing = append(missing, fmt.Sprintf("%d. %s", i+1, item))
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("voci non controllate: %s — indicale in ok o failed, o usa all_ok", strings.Join(missing, "; "))
+	}
+	passed := len(failed) == 0
+	if len(items) == 0 {
+		passed = allOK
+	}
+
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO room_inspections (room_id, assignment_id, inspector_id, passed, failed_items, notes)
+		 VALUES ($1, $2, current_telegram_id(), $3, $4, NULLIF($5, ''))
+		 RETURNING id`, roomID, assignmentID, passed, failed, strings.TrimSpace(in.Notes),
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert inspection: %w", err)
+	}
+
+	if passed {
+		msg := fmt.Sprintf("✅ Ispezione #%d della camera %s superata.", id, room)
+		if status == "inspection_due" {
+			msg += " La camera diventa pronta entro un minuto."
+		}
+		return msg, nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔍 Ispezione della camera %s non superata.", room)
+	for _, item := range failed {
+		sb.WriteString("\n• " + item)
+	}
+	if note := strings.TrimSpace(in.Notes); note != "" {
+		sb.WriteString("\nNote: " + note)
+	}
+	problems := sb.String()
+	msg := fmt.Sprintf("❌ Ispezione #%d registrata: %s", id, strings.TrimPrefix(problems, "🔍 "))
+	if cleanerID != nil && *cleanerID != ctx.UserID {
+		if err := newBot(t.botToken).Send(bg, *cleanerID, problems+"\nRipassa la camera, grazie!"); err != nil {
+			log.Printf("inspect_room: notify %d: %v", *cleanerID, err)
+		} else {
+			msg += fmt.Sprintf("\nHo avvisato %s.", cleaner)
+		}
+	}
+	if required && checklistID != 0 {
+		msg += "\nLa camera resta da ispezionare finché un'ispezione non è superata."
+	}
+	return msg, nil
+}
+
+// ── set_checklist ────────────────────────────────────────────────────────────
+
+type setChecklistTool struct{}
+
+func (t *setChecklistTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_checklist",
+		Description: "Crea o modifica la checklist di ispezione di una tipologia di camera (senza room_type: " +
+			"quella predefinita per tutte le altre). items sostituisce le voci; required decide se la camera " +
+			"diventa pronta solo dopo un'ispezione superata. Con delete=true la elimina. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room_type": {"type": "string", "description": "Tipologia (vuoto = checklist predefinita)"},
+				"items": {"type": "array", "items": {"type": "string"}, "description": "Voci da controllare, in ordine"},
+				"required": {"type": "boolean", "description": "Ispezione obbligatoria prima di pronta (default true)"},
+				"delete": {"type": "boolean", "description": "Elimina la checklist"}
+			}
+		}`),
+	}
+}
+
+func (t *setChecklistTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		RoomType string   `json:"room_type"`
+		Items    []string `json:"items"`
+		Required *bool    `json:"required"`
+		Delete   bool     `json:"delete"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_checklist is only available to managers")
+	}
+
+	var typeID *int64
+	label := "predefinita"
+	if name := strings.TrimSpace(in.RoomType); name != "" {
+		var id int64
+		if err := db.QueryRow(bg,
+			`SELECT id, name FROM room_types WHERE lower(name) = lower($1)`, name,
+		).Scan(&id, &label); err != nil {
+			return "", fmt.Errorf("tipologia %q non trovata", name)
+		}
+		typeID = &id
+	}
+
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM checklists WHERE COALESCE(room_type_id, 0) = COALESCE($1, 0)`, typeID)
+		if err != nil {
+			return "", fmt.Errorf("delete: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Sprintf("Nessuna checklist %s.", label), nil
+		}
+		return fmt.Sprintf("🗑 Checklist %s eliminata.", label), nil
+	}
+
+	var items []string
+	for _, item := range in.Items {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	var required bool
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		var id int64
+		if err := tx.QueryRow(bg,
+			`INSERT INTO checklists (room_type_id, required) VALUES ($1, COALESCE($2, true))
+			 ON CONFLICT (hotel_id, (COALESCE(room_type_id, 0))) DO UPDATE SET
+			   required = COALESCE($2, checklists.required)
+			 RETURNING id, required`, typeID, in.Required,
+		).Scan(&id, &required); err != nil {
+			return fmt.Errorf("save checklist: %w", err)
+		}
+		if in.Items == nil {
+			return nil
+		}
+		if _, err := tx.Exec(bg, `DELETE FROM checklist_items WHERE checklist_id = $1`, id); err != nil {
+			return fmt.Errorf("replace items: %w", err)
+		}
+		for i, item := range items {
+			if _, err := tx.Exec(bg,
+				`INSERT INTO checklist_items (checklist_id, position, label) VALUES ($1, $2, $3)`, id, i+1, item,
+			); err != nil {
+				return fmt.Errorf("insert item %d: %w", i+1, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✅ Checklist %s", label)
+	if required {
+		sb.WriteString(" (obbligatoria prima di pronta)")
+	} else {
+		sb.WriteString(" (facoltativa)")
+	}
+	if in.Items != nil {
+		fmt.Fprintf(&sb, ": %d voci.", len(items))
+		for i, item := range items {
+			fmt.Fprintf(&sb, "\n%d. %s", i+1, item)
+		}
+	} else {
+		sb.WriteString(" aggiornata.")
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// intentKeywords maps each intent to the (lowercase) keywords that signal it,
+// in Italian and English. The first intent with a matching keyword wins, so
+// more specific intents come first. No LLM call: tagging must be free.
+var intentKeywords = []struct {
+	intent   string
+	keywords []string
+}{
+	{"invites", []string{"invit", "invite", "nuovo collega", "new staff"}},
+	{"reminders", []string{"ricord", "promemoria", "remind", "sveglia"}},
+	{"reservations", []string{"prenotaz", "reservation", "booking", "check-in", "checkin", "arriv", "ospite", "guest"}},
+	{"issues", []string{"rott", "guast", "manca", "mancano", "problema", "broken", "missing", "leak", "perde"}},
+	{"assignments", []string{"assegn", "prendo", "pulir", "pulizi", "finito", "iniziato", "clean", "assign", "take room"}},
+	{"room_status", []string{"stato", "pronta", "pronte", "libera", "status", "ready", "occupied", "occupata"}},
+	{"messaging", []string{"scrivi", "dì a", "di' a", "chiedi", "avvisa", "tell ", "message"}},
+	{"reports", []string{"report", "riepilogo", "quant", "statistic", "how many", "summary"}},
+}
+
+// classifyIntent tags a message with a coarse topic via keyword matching.
+func classifyIntent(text string) string {
+	t := strings.ToLower(text)
+	for _, ik := range intentKeywords {
+		for _, kw := range ik.keywords {
+			if strings.Contains(t, kw) {
+				return ik.intent
+			}
+		}
+	}
+	return "other"
+}
+
+// recordIntent stores an anonymized intent tag for an inbound message: only
+// the sender's property, role and the tag are kept, never the user id or the
+// text.
+func recordIntent(adminPool *pgxpool.Pool) func(context.Context, agent.Update) {
+	return func(ctx context.Context, u agent.Update) {
+		if strings.HasPrefix(u.Text, "/start") {
+			return
+		}
+		_, err := adminPool.Exec(ctx,
+			`INSERT INTO intent_metrics (hotel_id, role, intent)
+			 SELECT hotel_id, role, $2 FROM users WHERE telegram_id = $1`,
+			u.UserID, classifyIntent(u.Text),
+		)
+		if err != nil {
+			log.Printf("intent metrics: %v", err)
+		}
+	}
+}
+
+// ── intent_report ────────────────────────────────────────────────────────────
+
+type intentReportTool struct{}
+
+func (t *intentReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "intent_report",
+		Description: "Report anonimo su cosa chiede lo staff della struttura al bot: numero di messaggi per argomento e per ruolo " +
+			"negli ultimi N giorni, con gli argomenti mai usati. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"days": {
+					"type": "integer",
+					"description": "Finestra in giorni (default 30)"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *intentReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var in struct {
+		Days int `json:"days"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Days <= 0 {
+		in.Days = 30
+	}
+
+	// RLS limits intent_metrics to managers; cleaners simply see no rows.
+	rows, err := db.Query(context.Background(),
+		`SELECT intent, role, count(*)
+		 FROM intent_metrics
+		 WHERE hotel_id = current_hotel_id()
+		   AND occurred_at > now() - make_interval(days => $1)
+		 GROUP BY intent, role
+		 ORDER BY count(*) DESC`, in.Days,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	used := make(map[string]bool)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Messaggi per argomento (ultimi %d giorni):\n", in.Days)
+	total := 0
+	for rows.Next() {
+		var intent, role string
+		var n int
+		if err := rows.Scan(&intent, &role, &n); err != nil {
+			return "", err
+		}
+		used[intent] = true
+		total += n
+		fmt.Fprintf(&sb, "  %-14s %-8s %d\n", intent, role, n)
+	}
+	if total == 0 {
+		return fmt.Sprintf("Nessun dato negli ultimi %d giorni.", in.Days), nil
+	}
+
+	var unused []string
+	for _, ik := range intentKeywords {
+		if !used[ik.intent] {
+			unused = append(unused, ik.intent)
+		}
+	}
+	fmt.Fprintf(&sb, "Totale: %d\n", total)
+	if len(unused) > 0 {
+		fmt.Fprintf(&sb, "Mai usati: %s\n", strings.Join(unused, ", "))
+	}
+	return sb.String(), nil
+}
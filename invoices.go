@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Invoices are issued per reservation and numbered per property and year
+// (1/2026, 2/2026…), as Italian law requires a gapless progressive number.
+// The computed lines are stored with the invoice, so asking again for the
+// same reservation re-sends the same document even if rates or extras have
+// changed since. Invoices are never updated or deleted by the bot.
+//
+// Amounts are VAT inclusive, like rates and amount_eur: the PDF splits room
+// and extras into taxable base and VAT; the city tax is outside the scope of
+// VAT and listed separately.
+//
+// Configure via env:
+//
+//	INVOICE_ISSUER="Hotel Cimon srl|Via Roma 1, 38054 Primiero|P.IVA 01234567890"
+//	                         issuer block, lines separated by "|" (default: hotel name)
+//	INVOICE_VAT_PCT=10       VAT rate of accommodation and extras
+
+// invoiceLine is one row of an invoice. VAT is false for the city tax.
+type invoiceLine struct {
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitEUR     float64 `json:"unit_eur"`
+	AmountEUR   float64 `json:"amount_eur"`
+	VAT         bool    `json:"vat"`
+}
+
+type invoice struct {
+	number, year             int
+	issuedAt                 time.Time
+	reservationID            int64
+	customer, address, taxID string
+	stay                     string
+	vatPct                   float64
+	lines                    []invoiceLine
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ── create_invoice ───────────────────────────────────────────────────────────
+
+type createInvoiceTool struct {
+	botToken string
+}
+
+func (t *createInvoiceTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "create_invoice",
+		Description: "Emette la fattura di una prenotazione confermata (soggiorno, extra, tassa di soggiorno, IVA) e la invia in chat come PDF. " +
+			"Se la prenotazione è già fatturata reinvia la fattura esistente. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer", "description": "ID della prenotazione"},
+				"customer_name": {"type": "string", "description": "Intestatario (default: nome dell'ospite)"},
+				"customer_address": {"type": "string", "description": "Indirizzo dell'intestatario"},
+				"customer_tax_code": {"type": "string", "description": "Codice fiscale o partita IVA dell'intestatario"}
+			},
+			"required": ["reservation_id"]
+		}`),
+	}
+}
+
+func (t *createInvoiceTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID   int64  `json:"reservation_id"`
+		CustomerName    string `json:"customer_name"`
+		CustomerAddress string `json:"customer_address"`
+		CustomerTaxCode string `json:"customer_tax_code"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("create_invoice is only available to managers")
+	}
+
+	var inv invoice
+	var reissued bool
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		var err error
+		reissued, err = loadInvoice(bg, tx, in.ReservationID, &inv)
+		if err != nil || reissued {
+			return err
+		}
+		if err := buildInvoice(bg, tx, in.ReservationID, &inv); err != nil {
+			return err
+		}
+		if in.CustomerName != "" {
+			inv.customer = in.CustomerName
+		}
+		if inv.customer == "" {
+			return fmt.Errorf("la prenotazione %d non ha un nome ospite: indica customer_name", in.ReservationID)
+		}
+		inv.address, inv.taxID = in.CustomerAddress, in.CustomerTaxCode
+		return insertInvoice(bg, tx, ctx.UserID, &inv)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var issuer string
+	if err := db.QueryRow(bg, `SELECT name FROM hotels WHERE id = current_hotel_id()`).Scan(&issuer); err != nil {
+		issuer = envOr("HOTEL_NAME", "Hotel Cimon")
+	}
+	issuer = envOr("INVOICE_ISSUER", issuer)
+	name := fmt.Sprintf("fattura_%d_%d.pdf", inv.year, inv.number)
+	if err := sendDocument(bg, t.botToken, ctx.ChatID, name, renderInvoice(issuer, inv),
+		fmt.Sprintf("Fattura n. %d/%d", inv.number, inv.year)); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	total := 0.0
+	for _, l := range inv.lines {
+		total += l.AmountEUR
+	}
+	if reissued {
+		return fmt.Sprintf("La prenotazione %d è già fatturata: reinviata la fattura n. %d/%d (%.2f€, %s).",
+			in.ReservationID, inv.number, inv.year, total, inv.customer), nil
+	}
+	return fmt.Sprintf("🧾 Fattura n. %d/%d emessa a %s: %.2f€. PDF inviato in chat (%s).",
+		inv.number, inv.year, inv.customer, total, name), nil
+}
+
+// loadInvoice fills inv from the invoice already issued for the reservation,
+// if any.
+func loadInvoice(ctx context.Context, tx pgx.Tx, reservationID int64, inv *invoice) (bool, error) {
+	var lines []byte
+	var address, taxID *string
+	err := tx.QueryRow(ctx,
+		`SELECT number, year, created_at, customer_name, customer_address, customer_tax_code, stay, vat_pct::float8, lines
+		 FROM invoices WHERE reservation_id = $1`, reservationID,
+	).Scan(&inv.number, &inv.year, &inv.issuedAt, &inv.customer, &address, &taxID, &inv.stay, &inv.vatPct, &lines)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("load invoice: %w", err)
+	}
+	inv.reservationID = reservationID
+	if address != nil {
+		inv.address = *address
+	}
+	if taxID != nil {
+		inv.taxID = *taxID
+	}
+	return true, json.Unmarshal(lines, &inv.lines)
+}
+
+// buildInvoice computes the lines of a new invoice: the stay (amount_eur of
+// the reservation, else the rate calendar), its extras, the minibar and the
+// city tax.
+func buildInvoice(ctx context.Context, tx pgx.Tx, reservationID int64, inv *invoice) error {
+	var roomID int64
+	var room, roomType, status string
+	var checkin, checkout time.Time
+	var guests, children int
+	var amount *float64
+	err := tx.QueryRow(ctx,
+		`SELECT res.room_id, r.name, COALESCE(t.name, ''), COALESCE(res.guest_name, ''), res.status,
+		        res.checkin_at, res.checkout_at, res.guests, res.children, res.amount_eur::float8
+		 FROM reservations res
+		 JOIN rooms r ON r.id = res.room_id
+		 LEFT JOIN room_types t ON t.id = r.room_type_id
+		 WHERE res.id = $1`, reservationID,
+	).Scan(&roomID, &room, &roomType, &inv.customer, &status, &checkin, &checkout, &guests, &children, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("prenotazione %d non trovata", reservationID)
+	}
+	if err != nil {
+		return fmt.Errorf("load reservation: %w", err)
+	}
+	if status != "confirmed" {
+		return fmt.Errorf("la prenotazione %d è %s: si fatturano solo prenotazioni confermate", reservationID, status)
+	}
+	nights := len(nightsBetween(checkin, checkout))
+	if nights == 0 {
+		return fmt.Errorf("la prenotazione %d non ha notti da fatturare", reservationID)
+	}
+	inv.reservationID = reservationID
+	inv.vatPct = envFloat("INVOICE_VAT_PCT", 10)
+	loc := romeLocation()
+	inv.stay = fmt.Sprintf("Prenotazione %d, camera %s, dal %s al %s, %d persone",
+		reservationID, room, checkin.In(loc).Format("02/01/2006"), checkout.In(loc).Format("02/01/2006"), guests)
+
+	var stay float64
+	if amount != nil {
+		stay = *amount
+	} else {
+		nightly, err := stayNights(ctx, tx, roomID, checkin, checkout, guests)
+		if err != nil {
+			return fmt.Errorf("price: %w", err)
+		}
+		for _, n := range nightly {
+			if n.price == nil {
+				return fmt.Errorf("nessuna tariffa per il %s e amount_eur non è indicato sulla prenotazione %d",
+					n.day.Format("02/01"), reservationID)
+			}
+			stay += *n.price
+		}
+	}
+	desc := "Soggiorno camera " + room
+	if roomType != "" {
+		desc += " (" + roomType + ")"
+	}
+	inv.lines = append(inv.lines, invoiceLine{Description: desc, Quantity: nights,
+		UnitEUR: roundCents(stay / float64(nights)), AmountEUR: roundCents(stay), VAT: true})
+
+	rows, err := tx.Query(ctx,
+		`SELECT e.name, re.quantity, e.pricing, re.from_date, re.to_date, re.unit_price_eur::float8
+		 FROM reservation_extras re
+		 JOIN extras e ON e.hotel_id = re.hotel_id AND e.code = re.extra_code
+		 WHERE re.reservation_id = $1
+		 ORDER BY re.from_date, re.id`, reservationID)
+	if err != nil {
+		return fmt.Errorf("extras: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, pricing string
+		var qty int
+		var from, to time.Time
+		var unit float64
+		if err := rows.Scan(&name, &qty, &pricing, &from, &to, &unit); err != nil {
+			return err
+		}
+		if pricing == "per_day" {
+			qty *= int(to.Sub(from).Hours()/24) + 1
+			name += fmt.Sprintf(" (%s–%s)", from.Format("02/01"), to.Format("02/01"))
+		}
+		inv.lines = append(inv.lines, invoiceLine{Description: name, Quantity: qty,
+			UnitEUR: unit, AmountEUR: roundCents(unit * float64(qty)), VAT: true})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	minibar, err := tx.Query(ctx,
+		`SELECT m.name, sum(mc.quantity)::int, mc.unit_price_eur::float8
+		 FROM minibar_consumption mc
+		 JOIN minibar_items m ON m.id = mc.item_id
+		 WHERE mc.reservation_id = $1
+		 GROUP BY m.name, mc.unit_price_eur
+		 ORDER BY m.name`, reservationID)
+	if err != nil {
+		return fmt.Errorf("minibar: %w", err)
+	}
+	defer minibar.Close()
+	for minibar.Next() {
+		var name string
+		var qty int
+		var unit float64
+		if err := minibar.Scan(&name, &qty, &unit); err != nil {
+			return err
+		}
+		inv.lines = append(inv.lines, invoiceLine{Description: "Minibar: " + name, Quantity: qty,
+			UnitEUR: unit, AmountEUR: roundCents(unit * float64(qty)), VAT: true})
+	}
+	if err := minibar.Err(); err != nil {
+		return err
+	}
+
+	taxed := nights
+	if limit := envInt("CITY_TAX_MAX_NIGHTS", 0); limit > 0 && taxed > limit {
+		taxed = limit
+	}
+	if tax := cityTax(guests, children, nights); tax > 0 {
+		inv.lines = append(inv.lines, invoiceLine{Description: "Imposta di soggiorno (fuori campo IVA)",
+			Quantity: (guests - children) * taxed, UnitEUR: envFloat("CITY_TAX_EUR", 0), AmountEUR: roundCents(tax)})
+	}
+	return nil
+}
+
+// insertInvoice stores inv with the next number of the year. The advisory
+// lock serializes numbering, so two invoices never get the same number.
+func insertInvoice(ctx context.Context, tx pgx.Tx, userID int64, inv *invoice) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('invoices'))`); err != nil {
+		return fmt.Errorf("lock: %w", err)
+	}
+	inv.issuedAt = time.Now().In(romeLocation())
+	inv.year = inv.issuedAt.Year()
+	if err := tx.QueryRow(ctx,
+		`SELECT COALESCE(max(number), 0) + 1 FROM invoices WHERE year = $1`, inv.year,
+	).Scan(&inv.number); err != nil {
+		return fmt.Errorf("next number: %w", err)
+	}
+	lines, err := json.Marshal(inv.lines)
+	if err != nil {
+		return err
+	}
+	var total float64
+	for _, l := range inv.lines {
+		total += l.AmountEUR
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO invoices (year, number, reservation_id, customer_name, customer_address, customer_tax_code,
+		   stay, vat_pct, lines, total_eur, created_by, created_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF(upper($6), ''), $7, $8, $9, $10, $11, $12)`,
+		inv.year, inv.number, inv.reservationID, inv.customer, inv.address, inv.taxID,
+		inv.stay, inv.vatPct, lines, roundCents(total), userID, inv.issuedAt)
+	if err != nil {
+		return fmt.Errorf("insert invoice: %w", err)
+	}
+	return nil
+}
+
+// renderInvoice lays out inv as a one-page PDF.
+func renderInvoice(issuer string, inv invoice) []byte {
+	var doc pdfDoc
+	const left, right = 50.0, pdfPageWidth - 50
+	y := pdfPageHeight - 60
+
+	for i, line := range strings.Split(issuer, "|") {
+		font, size := pdfRegular, 10.0
+		if i == 0 {
+			font, size = pdfBold, 14
+		}
+		doc.Text(left, y, font, size, strings.TrimSpace(line))
+		y -= size + 4
+	}
+
+	y -= 20
+	doc.Text(left, y, pdfBold, 16, fmt.Sprintf("Fattura n. %d/%d", inv.number, inv.year))
+	doc.TextRight(right, y, 10, "Data "+inv.issuedAt.In(romeLocation()).Format("02/01/2006"))
+	y -= 28
+	doc.Text(left, y, pdfBold, 10, "Intestatario")
+	y -= 14
+	for _, s := range []string{inv.customer, inv.address, inv.taxID} {
+		if s != "" {
+			doc.Text(left, y, pdfRegular, 10, s)
+			y -= 13
+		}
+	}
+	y -= 10
+	doc.Text(left, y, pdfRegular, 10, inv.stay)
+
+	y -= 30
+	doc.Text(left, y, pdfBold, 10, "Descrizione")
+	doc.TextRight(right-190, y, 9, "Q.tà")
+	doc.TextRight(right-90, y, 9, "Prezzo")
+	doc.TextRight(right, y, 9, "Importo")
+	y -= 6
+	doc.Line(left, y, right, y)
+	y -= 14
+
+	var vatGross, other float64
+	for _, l := range inv.lines {
+		doc.Text(left, y, pdfRegular, 10, l.Description)
+		doc.TextRight(right-190, y, 9, fmt.Sprint(l.Quantity))
+		doc.TextRight(right-90, y, 9, euro(l.UnitEUR))
+		doc.TextRight(right, y, 9, euro(l.AmountEUR))
+		y -= 16
+		if l.VAT {
+			vatGross += l.AmountEUR
+		} else {
+			other += l.AmountEUR
+		}
+	}
+	doc.Line(left, y+8, right, y+8)
+
+	base := roundCents(vatGross / (1 + inv.vatPct/100))
+	summary := []struct {
+		label  string
+		amount float64
+	}{
+		{"Imponibile", base},
+		{fmt.Sprintf("IVA %g%%", inv.vatPct), roundCents(vatGross - base)},
+	}
+	if other > 0 {
+		summary = append(summary, struct {
+			label  string
+			amount float64
+		}{"Fuori campo IVA", other})
+	}
+	y -= 10
+	for _, row := range summary {
+		doc.Text(right-250, y, pdfRegular, 10, row.label)
+		doc.TextRight(right, y, 9, euro(row.amount))
+		y -= 15
+	}
+	doc.Text(right-250, y, pdfBold, 12, "Totale")
+	doc.TextRight(right, y, 11, euro(vatGross+other))
+
+	doc.Text(left, 50, pdfRegular, 8, "Importi in euro, IVA inclusa ove applicabile.")
+	return doc.Bytes()
+}
+
+// euro formats v Italian style: 1.234,50 €.
+func euro(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	intPart, dec := s[:len(s)-3], s[len(s)-2:]
+	neg := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(r)
+	}
+	out := b.String() + "," + dec + " €"
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
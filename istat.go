@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// ── istat_report ─────────────────────────────────────────────────────────────
+//
+// Regional tourism statistics (ISTAT model C59) ask, for every day of the
+// month and every place of residence (Italian province or foreign country),
+// how many guests arrived, left, and stayed the night ("presenze"). They are
+// computed from reservations.guests and residence_country/residence_province,
+// which outlive the guest_documents purge because they identify no one.
+
+type istatReportTool struct {
+	botToken string
+}
+
+func (t *istatReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "istat_report",
+		Description: "Statistiche turistiche mensili (ISTAT/C59): arrivi, partenze e presenze per giorno e provenienza " +
+			"(provincia italiana o stato estero). Invia il CSV dettagliato in chat e restituisce il riepilogo. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {
+					"type": "string",
+					"description": "Mese nel formato YYYY-MM (default: mese precedente)"
+				}
+			}
+		}`),
+	}
+}
+
+type istatRow struct {
+	day                             time.Time
+	residence                       string
+	arrivals, departures, presences int
+}
+
+func (t *istatReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("istat_report is only available to managers")
+	}
+	var in struct {
+		Month string `json:"month"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		start, err = time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := db.Query(bg,
+		`WITH stays AS (
+		   SELECT guests,
+		          CASE WHEN residence_country = 'IT' AND residence_province IS NOT NULL
+		               THEN 'IT-' || residence_province
+		               ELSE COALESCE(residence_country, '??') END AS residence,
+		          (checkin_at AT TIME ZONE 'Europe/Rome')::date AS ci,
+		          (checkout_at AT TIME ZONE 'Europe/Rome')::date AS co
+		   FROM reservations
+		   WHERE status = 'confirmed'
+		     AND (checkin_at AT TIME ZONE 'Europe/Rome')::date < $2
+		     AND (checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		 )
+		 SELECT d::date, s.residence,
+		        COALESCE(sum(s.guests) FILTER (WHERE s.ci = d::date), 0),
+		        COALESCE(sum(s.guests) FILTER (WHERE s.co = d::date), 0),
+		        COALESCE(sum(s.guests) FILTER (WHERE s.ci <= d::date AND d::date < s.co), 0)
+		 FROM generate_series($1::date, $2::date - 1, INTERVAL '1 day') d
+		 JOIN stays s ON s.ci <= d::date AND s.co >= d::date
+		 GROUP BY d, s.residence
+		 ORDER BY d, s.residence`,
+		start, end,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var data []istatRow
+	for rows.Next() {
+		var r istatRow
+		if err := rows.Scan(&r.day, &r.residence, &r.arrivals, &r.departures, &r.presences); err != nil {
+			return "", err
+		}
+		data = append(data, r)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	month := start.Format("01/2006")
+	if len(data) == 0 {
+		return fmt.Sprintf("Nessun movimento nel mese %s.", month), nil
+	}
+
+	var csv strings.Builder
+	csv.WriteString("data;provenienza;arrivi;partenze;presenze\n")
+	totals := make(map[string]*istatRow)
+	for _, r := range data {
+		fmt.Fprintf(&csv, "%s;%s;%d;%d;%d\n", r.day.Format("02/01/2006"), r.residence, r.arrivals, r.departures, r.presences)
+		tot := totals[r.residence]
+		if tot == nil {
+			tot = &istatRow{residence: r.residence}
+			totals[r.residence] = tot
+		}
+		tot.arrivals += r.arrivals
+		tot.departures += r.departures
+		tot.presences += r.presences
+	}
+
+	var unknown int
+	var sums []*istatRow
+	for _, tot := range totals {
+		sums = append(sums, tot)
+		if tot.residence == "??" {
+			unknown = tot.arrivals
+		}
+	}
+	sort.Slice(sums, func(i, j int) bool { return sums[i].presences > sums[j].presences })
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Movimento clienti %s (ISTAT/C59):\n", month)
+	fmt.Fprintf(&sb, "  %-8s %7s %8s %8s\n", "prov.", "arrivi", "partenze", "presenze")
+	var ta, td, tp int
+	for _, r := range sums {
+		fmt.Fprintf(&sb, "  %-8s %7d %8d %8d\n", r.residence, r.arrivals, r.departures, r.presences)
+		ta, td, tp = ta+r.arrivals, td+r.departures, tp+r.presences
+	}
+	fmt.Fprintf(&sb, "Totale: %d arrivi, %d partenze, %d presenze.\n", ta, td, tp)
+	if unknown > 0 {
+		fmt.Fprintf(&sb, "⚠️ %d arrivi senza provenienza (residence_country): completali prima dell'invio.\n", unknown)
+	}
+
+	name := "istat_" + start.Format("200601") + ".csv"
+	if err := sendDocument(bg, t.botToken, ctx.ChatID, name, []byte(csv.String()),
+		"Movimento clienti "+month+" per giorno e provenienza"); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	fmt.Fprintf(&sb, "📄 Dettaglio giornaliero inviato in chat (%s).", name)
+	return sb.String(), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Key custody: the keys table lists the property's master keys and keycards
+// and who holds each one. take_key / return_key move them between the board
+// and the staff; keys still out at the end of the day show up in the
+// heartbeat (keys_out) and in the evening digest.
+
+// heldKey is a row of keys as the custody tools see it.
+type heldKey struct {
+	id     int
+	label  string
+	holder *int64
+	name   string // holder's name, "" when on the board
+}
+
+// findKey resolves a key label, exact match first, then by prefix.
+func findKey(ctx context.Context, db querier, label string) (heldKey, error) {
+	var k heldKey
+	err := db.QueryRow(ctx,
+		`SELECT k.id, k.label, k.held_by, COALESCE(u.name, '')
+		 FROM keys k LEFT JOIN users u ON u.telegram_id = k.held_by
+		 WHERE k.active AND k.label ILIKE $1 || '%'
+		 ORDER BY lower(k.label) = lower($1) DESC, k.label LIMIT 1`,
+		strings.TrimSpace(label)).Scan(&k.id, &k.label, &k.holder, &k.name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return k, fmt.Errorf("nessuna chiave si chiama %q (i manager aggiungono le chiavi alla tabella keys con execute_sql)", label)
+	}
+	if err != nil {
+		return k, fmt.Errorf("query key: %w", err)
+	}
+	return k, nil
+}
+
+// keyHolder is who a custody tool acts for: the caller, or for managers the
+// staff member they name.
+func keyHolder(ctx agent.ToolContext, db querier, staff string) (id int64, name string, manager bool, err error) {
+	bg := context.Background()
+	_ = db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager)
+	if strings.TrimSpace(staff) != "" {
+		if !manager {
+			return 0, "", false, fmt.Errorf("only managers can record keys for other people")
+		}
+		id, name, err = findStaff(bg, db, staff)
+		return id, name, manager, err
+	}
+	_ = db.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&name)
+	return ctx.UserID, name, manager, nil
+}
+
+// ── take_key ─────────────────────────────────────────────────────────────────
+
+type takeKeyTool struct{}
+
+func (t *takeKeyTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "take_key",
+		Description: "Registra che una chiave (passe-partout, keycard) è stata presa dalla bacheca: da chi scrive o, per i " +
+			"manager, dalla persona indicata con staff. Una chiave già in mano a un altro va prima restituita; i manager " +
+			"possono passarla direttamente.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"key": {"type": "string", "description": "Nome della chiave, es. 'Passe 1' o 'Keycard 3'"},
+				"staff": {"type": "string", "description": "Solo manager: chi prende la chiave"}
+			},
+			"required": ["key"]
+		}`),
+	}
+}
+
+func (t *takeKeyTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Key   string `json:"key"`
+		Staff string `json:"staff"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	userID, userName, manager, err := keyHolder(ctx, db, in.Staff)
+	if err != nil {
+		return "", err
+	}
+	k, err := findKey(bg, db, in.Key)
+	if err != nil {
+		return "", err
+	}
+	if k.holder != nil && *k.holder == userID {
+		return fmt.Sprintf("La chiave %s è già in mano a %s.", k.label, userName), nil
+	}
+	if k.holder != nil && !manager {
+		return "", fmt.Errorf("la chiave %s è in mano a %s: deve restituirla prima (o un manager può passarla)", k.label, k.name)
+	}
+	tag, err := db.Exec(bg, `UPDATE keys SET held_by = $2, taken_at = now() WHERE id = $1`, k.id, userID)
+	if err != nil {
+		return "", fmt.Errorf("take key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", fmt.Errorf("la chiave %s non è più disponibile", k.label)
+	}
+	msg := fmt.Sprintf("🔑 Chiave %s presa da %s alle %s.", k.label, userName, time.Now().In(romeLocation()).Format("15:04"))
+	if k.holder != nil {
+		msg += fmt.Sprintf(" Prima l'aveva %s.", k.name)
+	}
+	return msg, nil
+}
+
+// ── return_key ───────────────────────────────────────────────────────────────
+
+type returnKeyTool struct{}
+
+func (t *returnKeyTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "return_key",
+		Description: "Registra la restituzione di una chiave alla bacheca, o di tutte quelle di una persona con key='all'. " +
+			"Il personale restituisce le proprie; i manager qualunque chiave (con staff, tutte quelle di quella persona).",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"key": {"type": "string", "description": "Nome della chiave, o 'all' per tutte quelle in mano"},
+				"staff": {"type": "string", "description": "Solo manager: chi restituisce la chiave"}
+			},
+			"required": ["key"]
+		}`),
+	}
+}
+
+func (t *returnKeyTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Key   string `json:"key"`
+		Staff string `json:"staff"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	userID, userName, manager, err := keyHolder(ctx, db, in.Staff)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(in.Key), "all") {
+		rows, err := db.Query(bg,
+			`UPDATE keys SET held_by = NULL, taken_at = NULL WHERE held_by = $1 RETURNING label`, userID)
+		if err != nil {
+			return "", fmt.Errorf("return keys: %w", err)
+		}
+		labels, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return "", fmt.Errorf("return keys: %w", err)
+		}
+		if len(labels) == 0 {
+			return fmt.Sprintf("%s non ha chiavi da restituire.", userName), nil
+		}
+		return fmt.Sprintf("🔑 %s ha restituito %d chiavi: %s.", userName, len(labels), strings.Join(labels, ", ")), nil
+	}
+
+	k, err := findKey(bg, db, in.Key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case k.holder == nil:
+		return fmt.Sprintf("La chiave %s è già sulla bacheca.", k.label), nil
+	case *k.holder != userID && (!manager || in.Staff != ""):
+		return "", fmt.Errorf("la chiave %s è in mano a %s, non a %s", k.label, k.name, userName)
+	}
+	tag, err := db.Exec(bg, `UPDATE keys SET held_by = NULL, taken_at = NULL WHERE id = $1 AND held_by = $2`, k.id, *k.holder)
+	if err != nil {
+		return "", fmt.Errorf("return key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", fmt.Errorf("la chiave %s è cambiata nel frattempo: riprova", k.label)
+	}
+	return fmt.Sprintf("🔑 Chiave %s restituita da %s.", k.label, k.name), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// startKitchenDigest launches a background goroutine that sends the kitchen,
+// once a day, tomorrow's breakfast headcount (and the half board dinners) and
+// every dietary requirement recorded on the reservations eating in. Like the
+// countdown it goes straight to Telegram: no LLM turn, and the kitchen
+// contact does not need to be a registered user (a group chat works).
+//
+// Configure via env:
+//
+//	KITCHEN_CHAT_ID=-100123…    Telegram chat (user or group) of the kitchen; empty disables
+//	KITCHEN_DIGEST_TIME=18:00   daily send time, Europe/Rome; the HOTEL_ID property's
+//	                            kitchen_digest_time setting wins
+func startKitchenDigest(ctx context.Context, pool *pgxpool.Pool, botToken string) {
+	v := envOr("KITCHEN_CHAT_ID", "")
+	if v == "" {
+		return
+	}
+	chatID, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Printf("kitchen digest: disabled (KITCHEN_CHAT_ID=%q)", v)
+		return
+	}
+	loc := romeLocation()
+
+	go func() {
+		for {
+			next, ok := waitDaily(ctx, pool, envInt("HOTEL_ID", 1), "kitchen_digest_time")
+			if !ok {
+				return
+			}
+			tomorrow := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+			text, err := kitchenDigest(ctx, pool, tomorrow)
+			if err != nil {
+				log.Printf("kitchen digest: %v", err)
+				continue
+			}
+			if err := newBot(botToken).SendHTML(ctx, chatID, text); err != nil {
+				log.Printf("kitchen digest: send: %v", err)
+			}
+		}
+	}()
+}
+
+// boardTypes are the values of reservations.board.
+var boardTypes = map[string]string{
+	"room_only":  "solo pernottamento",
+	"bb":         "B&B",
+	"half_board": "mezza pensione",
+	"full_board": "pensione completa",
+}
+
+// mealCount is the kitchen's headcount for one day.
+type mealCount struct {
+	breakfasts, rooms int // breakfast covers and the rooms they come from
+	children          int // of the breakfast covers
+	dinners           int // half and full board guests dining that evening
+	diets             []mealDiet
+}
+
+// mealDiet is a reservation with dietary notes eating in on the day.
+type mealDiet struct {
+	room, guest, notes string
+	guests, children   int
+	breakfast, dinner  bool
+}
+
+// countMeals counts the meals for day. Breakfast is for guests who slept in
+// the hotel the night before (checked in before day, leaving on day or
+// later) unless they booked room only; dinner is for half and full board
+// guests sleeping in the hotel the night of day.
+func countMeals(ctx context.Context, db querier, day time.Time) (mealCount, error) {
+	var mc mealCount
+	rows, err := db.Query(ctx,
+		`SELECT r.name, COALESCE(res.guest_name, ''), res.guests, res.children, COALESCE(res.dietary_notes, ''),
+		        (res.checkin_at AT TIME ZONE 'Europe/Rome')::date < $1 AND res.board <> 'room_only',
+		        (res.checkout_at AT TIME ZONE 'Europe/Rome')::date > $1 AND res.board IN ('half_board', 'full_board')
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.status = 'confirmed'
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		 ORDER BY r.floor, r.name`, day)
+	if err != nil {
+		return mc, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d mealDiet
+		if err := rows.Scan(&d.room, &d.guest, &d.guests, &d.children, &d.notes, &d.breakfast, &d.dinner); err != nil {
+			return mc, err
+		}
+		if d.breakfast {
+			mc.breakfasts += d.guests
+			mc.children += d.children
+			mc.rooms++
+		}
+		if d.dinner {
+			mc.dinners += d.guests
+		}
+		if d.notes != "" && (d.breakfast || d.dinner) {
+			mc.diets = append(mc.diets, d)
+		}
+	}
+	return mc, rows.Err()
+}
+
+// plainCovers is how many of the breakfast covers have no dietary notes.
+func (mc mealCount) plainCovers() int {
+	n := mc.breakfasts
+	for _, d := range mc.diets {
+		if d.breakfast {
+			n -= d.guests
+		}
+	}
+	return n
+}
+
+// meals tells which meals of the day a reservation with notes takes.
+func (d mealDiet) meals() string {
+	switch {
+	case d.breakfast && d.dinner:
+		return "colazione e cena"
+	case d.dinner:
+		return "solo cena"
+	}
+	return "colazione"
+}
+
+// kitchenDigest builds the message for the meals of day.
+func kitchenDigest(ctx context.Context, pool *pgxpool.Pool, day time.Time) (string, error) {
+	mc, err := countMeals(ctx, pool, day)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🍳 <b>Colazione di %s %s</b>\n\n", strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01"))
+	fmt.Fprintf(&sb, "Coperti previsti: <b>%d</b> (%d camere), %d senza esigenze particolari\n",
+		mc.breakfasts, mc.rooms, mc.plainCovers())
+	if mc.children > 0 {
+		fmt.Fprintf(&sb, "Di cui bambini: %d\n", mc.children)
+	}
+	if mc.dinners > 0 {
+		fmt.Fprintf(&sb, "Cene in mezza pensione / pensione completa: <b>%d</b>\n", mc.dinners)
+	}
+	if len(mc.diets) == 0 {
+		sb.WriteString("\nNessuna esigenza alimentare segnalata.")
+		return sb.String(), nil
+	}
+	sb.WriteString("\n<b>Esigenze alimentari / allergie:</b>\n")
+	notes := make([]string, len(mc.diets))
+	for i, d := range mc.diets {
+		notes[i] = fmt.Sprintf("• Camera %s (%s, %d pers., %s): %s", htmlpkg.EscapeString(d.room),
+			htmlpkg.EscapeString(d.guest), d.guests, d.meals(), htmlpkg.EscapeString(d.notes))
+	}
+	sb.WriteString(strings.Join(notes, "\n"))
+	return sb.String(), nil
+}
+
+// ── breakfast_count ──────────────────────────────────────────────────────────
+
+type breakfastCountTool struct{}
+
+func (t *breakfastCountTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "breakfast_count",
+		Description: "Quante colazioni (e cene in mezza pensione) preparare in un giorno, con le esigenze alimentari " +
+			"camera per camera. Default domani: è lo stesso conteggio del messaggio serale alla cucina.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {"type": "string", "description": "Giorno YYYY-MM-DD (default domani)"}
+			}
+		}`),
+	}
+}
+
+func (t *breakfastCountTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Date string `json:"date"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		day = d
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	mc, err := countMeals(context.Background(), db, day)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Colazioni %s %s: %d coperti da %d camere",
+		strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01"), mc.breakfasts, mc.rooms)
+	if mc.children > 0 {
+		fmt.Fprintf(&sb, ", di cui %d bambini", mc.children)
+	}
+	fmt.Fprintf(&sb, " (%d senza esigenze particolari).\n", mc.plainCovers())
+	if mc.dinners > 0 {
+		fmt.Fprintf(&sb, "Cene (mezza pensione / pensione completa): %d.\n", mc.dinners)
+	}
+	if len(mc.diets) == 0 {
+		sb.WriteString("Nessuna esigenza alimentare segnalata.")
+		return sb.String(), nil
+	}
+	sb.WriteString("Esigenze alimentari:")
+	for _, d := range mc.diets {
+		fmt.Fprintf(&sb, "\n- camera %s", d.room)
+		if d.guest != "" {
+			fmt.Fprintf(&sb, " (%s)", d.guest)
+		}
+		fmt.Fprintf(&sb, ", %d pers., %s: %s", d.guests, d.meals(), d.notes)
+	}
+	return sb.String(), nil
+}
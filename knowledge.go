@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Chemical safety sheets are knowledge_base rows with category 'chemical':
+// the title is the product name, the body holds dilution, use, PPE and first
+// aid, and the tags list trade names plus the hazard classes below. Whether
+// two products may be mixed is decided from the classes, never by the LLM.
+
+// hazardClasses are the tags that classify a cleaning chemical.
+var hazardClasses = []string{"chlorine", "ammonia", "acid", "peroxide", "alcohol"}
+
+// dangerousMixes are class pairs that must never be combined.
+var dangerousMixes = []struct {
+	a, b   string
+	reason string
+}{
+	{"chlorine", "acid", "sviluppa cloro gassoso (tossico)"},
+	{"chlorine", "ammonia", "sviluppa clorammine (tossiche)"},
+	{"chlorine", "alcohol", "forma cloroformio e composti clorurati"},
+	{"chlorine", "peroxide", "reazione violenta con sviluppo di calore"},
+	{"peroxide", "acid", "forma acido peracetico (corrosivo)"},
+}
+
+type safetySheet struct {
+	title string
+	body  string
+	tags  []string
+}
+
+// findSafetySheets returns the chemical sheets whose title or tags match product.
+func findSafetySheets(ctx context.Context, db *pgxpool.Pool, product string) ([]safetySheet, error) {
+	rows, err := db.Query(ctx,
+		`SELECT title, body, tags FROM knowledge_base
+		 WHERE category = 'chemical'
+		   AND (title ILIKE '%' || $1 || '%' OR lower($1) = ANY (SELECT lower(t) FROM unnest(tags) t))
+		 ORDER BY lower(title) = lower($1) DESC, title
+		 LIMIT 3`, strings.TrimSpace(product))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []safetySheet
+	for rows.Next() {
+		var s safetySheet
+		if err := rows.Scan(&s.title, &s.body, &s.tags); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// classesOf returns the hazard classes among a sheet's tags.
+func classesOf(s safetySheet) map[string]bool {
+	out := make(map[string]bool)
+	for _, t := range s.tags {
+		for _, c := range hazardClasses {
+			if strings.EqualFold(t, c) {
+				out[c] = true
+			}
+		}
+	}
+	return out
+}
+
+// ── safety_lookup ────────────────────────────────────────────────────────────
+
+type safetyLookupTool struct{}
+
+func (t *safetyLookupTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "safety_lookup",
+		Description: "Scheda di sicurezza di un prodotto per la pulizia (diluizione, uso, DPI, primo soccorso). " +
+			"Con mix_with dice se due prodotti si possono mescolare. Usalo sempre per domande su prodotti chimici.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"product": {
+					"type": "string",
+					"description": "Nome del prodotto (es. 'candeggina', 'anticalcare')"
+				},
+				"mix_with": {
+					"type": "string",
+					"description": "Secondo prodotto, per sapere se si possono mescolare"
+				}
+			},
+			"required": ["product"]
+		}`),
+	}
+}
+
+func (t *safetyLookupTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Product string `json:"product"`
+		MixWith string `json:"mix_with"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	first, err := findSafetySheets(bg, db, in.Product)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	if len(first) == 0 {
+		return fmt.Sprintf("⚠️ Nessuna scheda di sicurezza per %q. Non usarlo né mescolarlo finché un manager "+
+			"non aggiunge la scheda (knowledge_base, category 'chemical').", in.Product), nil
+	}
+	if in.MixWith == "" {
+		var sb strings.Builder
+		for i, s := range first {
+			if i > 0 {
+				sb.WriteString("\n\n")
+			}
+			fmt.Fprintf(&sb, "🧴 %s\n%s", s.title, s.body)
+		}
+		return sb.String(), nil
+	}
+
+	second, err := findSafetySheets(bg, db, in.MixWith)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	if len(second) == 0 {
+		return fmt.Sprintf("⚠️ Nessuna scheda per %q: NON mescolarlo con %s finché un manager non la aggiunge.",
+			in.MixWith, first[0].title), nil
+	}
+	a, b := first[0], second[0]
+	ca, cb := classesOf(a), classesOf(b)
+	for _, m := range dangerousMixes {
+		if (ca[m.a] && cb[m.b]) || (ca[m.b] && cb[m.a]) {
+			return fmt.Sprintf("❌ NON mescolare %s e %s: %s. Usali separatamente e risciacqua tra un prodotto e l'altro.",
+				a.title, b.title, m.reason), nil
+		}
+	}
+	return fmt.Sprintf("Nessuna incompatibilità nota tra %s e %s nelle schede, ma non mescolare mai prodotti "+
+		"diversi se la scheda non lo prevede.\n\n🧴 %s\n%s\n\n🧴 %s\n%s", a.title, b.title, a.title, a.body, b.title, b.body), nil
+}
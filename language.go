@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Each user's language (users.language) is sticky: it is either chosen with
+// the onboarding buttons (language_source 'chosen') or detected from their
+// first messages (languageTracker, 'detected'), and never flips afterwards on
+// a single foreign word. The LLM replies in it (the prompt is translated,
+// promptlang.go); the deterministic messages of the bot — confirmations,
+// errors of button flows, alerts and digests, all written in Italian — are
+// translated into it on the way out by messageLocalizer, through newBot,
+// sendKeyboard and sendDocument. Messages to group chats (no users row) are
+// sent as written.
+
+// systemMessageLanguage is the language deterministic messages are written in.
+const systemMessageLanguage = "Italian"
+
+// ── detection ────────────────────────────────────────────────────────────────
+
+// languageWords are frequent words that tell the languages of the staff
+// apart; words shared by two languages count for both.
+var languageWords = map[string][]string{
+	"Italian": {"il", "lo", "gli", "di", "che", "è", "e", "non", "per", "una", "sono", "ho", "della", "del",
+		"grazie", "ciao", "fatto", "finito", "oggi", "domani", "pulita", "pulito", "buongiorno", "quando", "dove",
+		"come", "anche", "ancora", "perché", "cosa", "camere", "sì"},
+	"English": {"the", "is", "are", "and", "i", "you", "to", "of", "it", "room", "rooms", "done", "thanks",
+		"thank", "hello", "hi", "today", "tomorrow", "please", "what", "my", "clean", "finished", "when", "where",
+		"how", "yes", "can", "need", "with"},
+	"German": {"der", "die", "das", "und", "ist", "ich", "nicht", "zimmer", "danke", "hallo", "heute", "morgen",
+		"bitte", "fertig", "mit", "ein", "eine", "sauber", "wann", "wo", "wie", "ja", "auch", "noch", "was"},
+	"Romanian": {"și", "si", "este", "nu", "eu", "sunt", "mulțumesc", "multumesc", "bună", "buna", "astăzi",
+		"azi", "mâine", "maine", "gata", "curat", "curată", "terminat", "cu", "pe", "ce", "când", "unde", "da",
+		"camere", "am"},
+	"French": {"le", "les", "et", "est", "je", "pas", "chambre", "merci", "bonjour", "aujourd'hui", "demain",
+		"fini", "propre", "des", "quand", "où", "oui", "avec", "une"},
+	"Spanish": {"el", "los", "las", "y", "es", "yo", "habitación", "gracias", "hola", "hoy", "mañana",
+		"terminado", "limpia", "limpio", "por", "cuando", "dónde", "sí", "con", "una"},
+}
+
+// detectLanguage guesses the language of text from languageWords. ok is
+// false unless the best language has at least two hits and beats the others.
+func detectLanguage(text string) (language string, ok bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := make(map[string]int)
+	for _, w := range words {
+		for lang, list := range languageWords {
+			for _, x := range list {
+				if w == x {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+	best, second := 0, 0
+	for lang, n := range scores {
+		switch {
+		case n > best:
+			best, second, language = n, best, lang
+		case n > second:
+			second = n
+		}
+	}
+	return language, best >= 2 && best > second
+}
+
+// languageDetectionMessages is how many first messages are looked at.
+const languageDetectionMessages = 3
+
+// languageTracker detects the language of users who never picked one. It is
+// a messenger observer: it sees every message that reaches the agent.
+type languageTracker struct {
+	adminPool *pgxpool.Pool
+
+	mu      sync.Mutex
+	pending map[int64][]string // userID → first messages, while undecided
+	settled map[int64]bool     // userID → language known, nothing to do
+}
+
+func newLanguageTracker(adminPool *pgxpool.Pool) *languageTracker {
+	return &languageTracker{adminPool: adminPool, pending: make(map[int64][]string), settled: make(map[int64]bool)}
+}
+
+// Inbound implements the routedMessenger observer.
+func (t *languageTracker) Inbound(ctx context.Context, u agent.Update) {
+	text := strings.TrimSpace(u.Text)
+	if text == "" || strings.HasPrefix(text, "/") {
+		return
+	}
+	t.mu.Lock()
+	if t.settled[u.UserID] {
+		t.mu.Unlock()
+		return
+	}
+	seen, known := t.pending[u.UserID]
+	t.mu.Unlock()
+
+	// Users who finished onboarding picked their language there.
+	if !known {
+		var undecided bool
+		if err := t.adminPool.QueryRow(ctx,
+			`SELECT language_source = 'default' AND onboarded_at IS NULL FROM users WHERE telegram_id = $1`, u.UserID,
+		).Scan(&undecided); err != nil || !undecided {
+			t.settle(u.UserID)
+			return
+		}
+	}
+	seen = append(seen, text)
+	language, ok := detectLanguage(strings.Join(seen, "\n"))
+	if !ok {
+		t.mu.Lock()
+		if len(seen) >= languageDetectionMessages {
+			delete(t.pending, u.UserID)
+			t.settled[u.UserID] = true
+		} else {
+			t.pending[u.UserID] = seen
+		}
+		t.mu.Unlock()
+		return
+	}
+	if _, err := t.adminPool.Exec(ctx,
+		`UPDATE users SET language = $2, language_source = 'detected'
+		 WHERE telegram_id = $1 AND language_source = 'default'`, u.UserID, language,
+	); err != nil {
+		log.Printf("language: store %s for user %d: %v", language, u.UserID, err)
+		return
+	}
+	log.Printf("language: user %d writes in %s", u.UserID, language)
+	t.settle(u.UserID)
+}
+
+func (t *languageTracker) settle(userID int64) {
+	t.mu.Lock()
+	delete(t.pending, userID)
+	t.settled[userID] = true
+	t.mu.Unlock()
+}
+
+// ── translation ──────────────────────────────────────────────────────────────
+
+// messageLocalizer translates deterministic messages into the language of
+// the chat's user. Translations are cached in message_translations by hash
+// of the source text, so fixed messages cost one LLM call per language; on
+// any failure the message goes out as written.
+type messageLocalizer struct {
+	adminPool *pgxpool.Pool
+	llm       *llm.Client
+}
+
+// localizer is set once at startup (main.go) and read by newBot,
+// sendKeyboard and sendDocument; nil leaves every message as written.
+var localizer *messageLocalizer
+
+func newMessageLocalizer(adminPool *pgxpool.Pool, client *llm.Client) *messageLocalizer {
+	return &messageLocalizer{adminPool: adminPool, llm: client}
+}
+
+const messageTranslationSystem = `You translate notifications sent by a hotel-management bot to its staff.
+Translate the message from Italian into the requested language. Keep unchanged:
+- HTML tags and Markdown markup, emoji, line breaks and bullet layout;
+- numbers, dates, times, amounts, room names, people's names and quoted text;
+- command names starting with "/" and ids like "#12".
+Reply with the translated message only, no preamble.`
+
+// Localize returns text in the language of chatID's user.
+func (l *messageLocalizer) Localize(ctx context.Context, chatID int64, text string) string {
+	if l == nil || strings.TrimSpace(text) == "" {
+		return text
+	}
+	var language string
+	if err := l.adminPool.QueryRow(ctx,
+		`SELECT language FROM users WHERE telegram_id = $1`, chatID).Scan(&language); err != nil ||
+		language == "" || strings.EqualFold(language, systemMessageLanguage) {
+		return text
+	}
+	hash := promptHash(text)
+	var translated string
+	if err := l.adminPool.QueryRow(ctx,
+		`SELECT text FROM message_translations WHERE language = $1 AND source_hash = $2`, language, hash,
+	).Scan(&translated); err == nil && translated != "" {
+		return translated
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	resp, err := l.llm.Chat(tctx, llm.Request{
+		System: messageTranslationSystem,
+		Messages: []llm.Message{{
+			Role:    "user",
+			Content: []llm.ContentBlock{{Type: "text", Text: "Language: " + language + "\n\n" + text}},
+		}},
+		Options: llm.Options{MaxTokens: 2048},
+	})
+	if err != nil {
+		log.Printf("message translation %s: %v", language, err)
+		return text
+	}
+	translated = strings.TrimSpace(resp.Text)
+	if translated == "" {
+		return text
+	}
+	// Old rows are dropped as new ones come in: most messages carry names and
+	// times and never repeat.
+	if _, err := l.adminPool.Exec(ctx,
+		`WITH purge AS (DELETE FROM message_translations WHERE created_at < now() - INTERVAL '30 days')
+		 INSERT INTO message_translations (language, source_hash, text) VALUES ($1, $2, $3)
+		 ON CONFLICT (language, source_hash) DO UPDATE SET text = EXCLUDED.text, created_at = now()`,
+		language, hash, translated,
+	); err != nil {
+		log.Printf("message translation %s: store: %v", language, err)
+	}
+	return translated
+}
+
+// LocalizeButtons translates the labels of an inline keyboard.
+func (l *messageLocalizer) LocalizeButtons(ctx context.Context, chatID int64, rows [][]telegram.Button) [][]telegram.Button {
+	if l == nil || len(rows) == 0 {
+		return rows
+	}
+	out := make([][]telegram.Button, len(rows))
+	for i, row := range rows {
+		out[i] = make([]telegram.Button, len(row))
+		for j, b := range row {
+			b.Text = l.Localize(ctx, chatID, b.Text)
+			out[i][j] = b
+		}
+	}
+	return out
+}
+
+// localizedClient is the Telegram client of deterministic messages: Send and
+// SendHTML translate the text for the recipient first.
+type localizedClient struct {
+	*telegram.Client
+}
+
+// newBot returns the client for the bot's own (non-LLM) messages.
+func newBot(botToken string) *localizedClient {
+	return &localizedClient{Client: telegram.New(botToken)}
+}
+
+// Send and SendHTML also keep what could not be delivered for the catch-up
+// digest (missed.go).
+func (c *localizedClient) Send(ctx context.Context, chatID int64, text string) error {
+	err := deliver(ctx, chatID, func() error {
+		return c.Client.Send(ctx, chatID, localizer.Localize(ctx, chatID, text))
+	})
+	if err != nil {
+		missed.Record(ctx, chatID, text, false, err)
+	}
+	return err
+}
+
+func (c *localizedClient) SendHTML(ctx context.Context, chatID int64, html string) error {
+	err := deliver(ctx, chatID, func() error {
+		return c.Client.SendHTML(ctx, chatID, localizer.Localize(ctx, chatID, html))
+	})
+	if err != nil {
+		missed.Record(ctx, chatID, html, true, err)
+	}
+	return err
+}
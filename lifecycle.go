@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// roomTransitions are the automatic rooms.status changes, applied in order
+// every minute. Each is a single idempotent UPDATE: a room only moves when it
+// is in the expected "from" state, so manual overrides (a manager forcing a
+// status) are never fought. out_of_service follows room_blocks: a free room
+// enters it on the first day of a block and leaves it once no block covers
+// today. Changes are made by the bot, so
+// room_status_events records them with a NULL actor.
+var roomTransitions = []struct {
+	name string
+	sql  string
+}{
+	// A guest has arrived: the room becomes occupied and mirrors the stay.
+	{"checkin", `
+		UPDATE rooms r SET status = 'occupied',
+		       guest_name = res.guest_name, checkin_at = res.checkin_at, checkout_at = res.checkout_at
+		FROM reservations res
+		WHERE res.room_id = r.id AND res.status = 'confirmed'
+		  AND res.checkin_at <= now() AND res.checkout_at > now()
+		  AND r.status IN ('available', 'ready')
+		RETURNING r.name, 'occupied'`},
+
+	// Morning of departure day: full clean needed once the guest leaves.
+	{"checkout_due", `
+		UPDATE rooms r SET status = 'checkout_due'
+		FROM reservations res
+		WHERE res.room_id = r.id AND res.status = 'confirmed'
+		  AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date = (now() AT TIME ZONE 'Europe/Rome')::date
+		  AND (now() AT TIME ZONE 'Europe/Rome')::time >= $1::time
+		  AND r.status = 'occupied'
+		RETURNING r.name, 'checkout_due'`},
+
+	// Morning of every other day in house: daily refresh.
+	{"stayover_due", `
+		UPDATE rooms r SET status = 'stayover_due'
+		FROM reservations res
+		WHERE res.room_id = r.id AND res.status = 'confirmed'
+		  AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date < (now() AT TIME ZONE 'Europe/Rome')::date
+		  AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date > (now() AT TIME ZONE 'Europe/Rome')::date
+		  AND (now() AT TIME ZONE 'Europe/Rome')::time >= $1::time
+		  AND r.status = 'occupied'
+		  AND NOT EXISTS (SELECT 1 FROM assignments a
+		                  WHERE a.room_id = r.id AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date
+		                    AND a.type = 'stayover' AND a.status IN ('done', 'skipped'))
+		RETURNING r.name, 'stayover_due'`},
+
+	// Stayover cleaned (or skipped, e.g. "do not disturb"): guests still in house.
+	{"stayover_done", `
+		UPDATE rooms r SET status = 'occupied'
+		WHERE r.status IN ('stayover_due', 'cleaning')
+		  AND EXISTS (SELECT 1 FROM assignments a
+		              WHERE a.room_id = r.id AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date
+		                AND a.type = 'stayover' AND a.status IN ('done', 'skipped'))
+		  AND NOT EXISTS (SELECT 1 FROM assignments a
+		                  WHERE a.room_id = r.id AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date
+		                    AND a.status IN ('pending', 'in_progress'))
+		RETURNING r.name, 'occupied'`},
+
+	// Checkout clean confirmed: ready for today's arrival, otherwise available;
+	// inspection_due first when the room's checklist requires an inspection.
+	{"checkout_done", `
+		UPDATE rooms r SET
+		       status = CASE WHEN room_inspection_pending(r.id) THEN 'inspection_due'
+		                     WHEN EXISTS (SELECT 1 FROM reservations res
+		                                  WHERE res.room_id = r.id AND res.status = 'confirmed'
+		                                    AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = (now() AT TIME ZONE 'Europe/Rome')::date)
+		                     THEN 'ready' ELSE 'available' END,
+		       guest_name = NULL, checkin_at = NULL, checkout_at = NULL
+		WHERE r.status IN ('checkout_due', 'cleaning')
+		  AND EXISTS (SELECT 1 FROM assignments a
+		              WHERE a.room_id = r.id AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date
+		                AND a.type = 'checkout' AND a.status = 'done')
+		  AND NOT EXISTS (SELECT 1 FROM assignments a
+		                  WHERE a.room_id = r.id AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date
+		                    AND a.status IN ('pending', 'in_progress'))
+		RETURNING r.name, r.status`},
+
+	// Inspection passed (inspect_room), or no longer required.
+	{"inspected", `
+		UPDATE rooms r SET
+		       status = CASE WHEN EXISTS (SELECT 1 FROM reservations res
+		                                  WHERE res.room_id = r.id AND res.status = 'confirmed'
+		                                    AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = (now() AT TIME ZONE 'Europe/Rome')::date)
+		                     THEN 'ready' ELSE 'available' END
+		WHERE r.status = 'inspection_due' AND NOT room_inspection_pending(r.id)
+		RETURNING r.name, r.status`},
+
+	// A block starts (block_room): the free room goes out of service. A room
+	// still being cleaned gets there once it is available.
+	{"block_start", `
+		UPDATE rooms r SET status = 'out_of_service'
+		WHERE r.status IN ('available', 'ready')
+		  AND EXISTS (SELECT 1 FROM room_blocks b
+		              WHERE b.room_id = r.id AND b.lifted_at IS NULL
+		                AND (now() AT TIME ZONE 'Europe/Rome')::date BETWEEN b.from_date AND b.to_date)
+		RETURNING r.name, 'out_of_service'`},
+
+	// The block ended or was lifted. Rooms that never had a block keep a
+	// status set by hand.
+	{"block_end", `
+		UPDATE rooms r SET status = 'available'
+		WHERE r.status = 'out_of_service'
+		  AND EXISTS (SELECT 1 FROM room_blocks b WHERE b.room_id = r.id)
+		  AND NOT EXISTS (SELECT 1 FROM room_blocks b
+		                  WHERE b.room_id = r.id AND b.lifted_at IS NULL
+		                    AND (now() AT TIME ZONE 'Europe/Rome')::date BETWEEN b.from_date AND b.to_date)
+		RETURNING r.name, 'available'`},
+}
+
+// startLifecycleProducer launches a background goroutine that moves rooms
+// through their lifecycle from reservations and assignments, so managers no
+// longer have to set every status by hand.
+//
+// Configure via env:
+//
+//	LIFECYCLE_MORNING=07:00   time (Europe/Rome) from which rooms become checkout_due/stayover_due
+func startLifecycleProducer(ctx context.Context, pool *pgxpool.Pool) {
+	morning := envOr("LIFECYCLE_MORNING", "07:00")
+	if _, _, ok := parseClock(morning); !ok {
+		log.Printf("lifecycle: invalid LIFECYCLE_MORNING=%q, using 07:00", morning)
+		morning = "07:00"
+	}
+	go func() {
+		log.Printf("lifecycle producer started")
+		ticker := time.NewTicker(1 * time.Minute)
+		defer ticker.Stop()
+		for {
+			applyRoomTransitions(ctx, pool, morning)
+			select {
+			case <-ctx.Done():
+				log.Printf("lifecycle producer stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func applyRoomTransitions(ctx context.Context, pool *pgxpool.Pool, morning string) {
+	for _, t := range roomTransitions {
+		var args []any
+		if t.name == "checkout_due" || t.name == "stayover_due" {
+			args = append(args, morning)
+		}
+		rows, err := pool.Query(ctx, t.sql, args...)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("lifecycle %s: %v", t.name, err)
+			}
+			return
+		}
+		for rows.Next() {
+			var room, status string
+			if err := rows.Scan(&room, &status); err == nil {
+				log.Printf("lifecycle: room %s → %s (%s)", room, status, t.name)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			log.Printf("lifecycle %s: %v", t.name, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// startListener launches a goroutine that holds a dedicated connection on
+// LISTEN <channel> and calls drain on every notification, and every 30s as a
+// safety net. drain must read its work from a table (never from the payload)
+// so that nothing is lost while the connection is down or the bot restarts.
+func startListener(ctx context.Context, pool *pgxpool.Pool, channel string, drain func(context.Context)) {
+	go func() {
+		log.Printf("listener %s started", channel)
+		for ctx.Err() == nil {
+			if err := listen(ctx, pool, channel, drain); err != nil && ctx.Err() == nil {
+				log.Printf("listener %s: %v — retrying in 5s", channel, err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+		log.Printf("listener %s stopped", channel)
+	}()
+}
+
+func listen(ctx context.Context, pool *pgxpool.Pool, channel string, drain func(context.Context)) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire: %w", err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	for {
+		drain(ctx)
+		waitCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		_, err := conn.Conn().WaitForNotification(waitCtx)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && waitCtx.Err() == nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Lost & found runs on the caller's pool: RLS lets anyone log an item as
+// themselves, and only managers mark an item as returned.
+
+// ── log_found_item ───────────────────────────────────────────────────────────
+
+type logFoundItemTool struct{}
+
+func (t *logFoundItemTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "log_found_item",
+		Description: "Registra un oggetto trovato (in camera o in un'area comune): descrizione, camera, dove è stato riposto, foto opzionale.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"description": {
+					"type": "string",
+					"description": "Cosa è stato trovato (es. 'caricabatterie iPhone bianco')"
+				},
+				"room_id": {
+					"type": "integer",
+					"description": "ID della camera (omettere per aree comuni)"
+				},
+				"found_on": {
+					"type": "string",
+					"description": "Data del ritrovamento YYYY-MM-DD (default: oggi)"
+				},
+				"stored_at": {
+					"type": "string",
+					"description": "Dove è stato riposto (es. 'reception, cassetto 2')"
+				},
+				"photo": {
+					"type": "string",
+					"description": "Telegram file_id della foto (opzionale)"
+				},
+				"attachment_id": {
+					"type": "integer",
+					"description": "attachment_id della foto inviata in chat (opzionale, al posto di photo)"
+				}
+			},
+			"required": ["description"]
+		}`),
+	}
+}
+
+func (t *logFoundItemTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Description  string `json:"description"`
+		RoomID       *int64 `json:"room_id"`
+		FoundOn      string `json:"found_on"`
+		StoredAt     string `json:"stored_at"`
+		Photo        string `json:"photo"`
+		AttachmentID *int64 `json:"attachment_id"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Description) == "" {
+		return "", fmt.Errorf("description is required")
+	}
+	foundOn := time.Now().In(romeLocation())
+	if in.FoundOn != "" {
+		d, err := time.Parse("2006-01-02", in.FoundOn)
+		if err != nil {
+			return "", fmt.Errorf("found_on must be YYYY-MM-DD: %w", err)
+		}
+		foundOn = d
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	if in.AttachmentID != nil {
+		if err := db.QueryRow(context.Background(),
+			`SELECT file_id FROM attachments WHERE id = $1`, *in.AttachmentID,
+		).Scan(&in.Photo); err != nil {
+			return "", fmt.Errorf("foto %d non trovata", *in.AttachmentID)
+		}
+	}
+	var id int64
+	if err := db.QueryRow(context.Background(),
+		`INSERT INTO lost_found (room_id, found_by, found_on, description, stored_at, photo)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')) RETURNING id`,
+		in.RoomID, ctx.UserID, foundOn.Format("2006-01-02"), in.Description, in.StoredAt, in.Photo,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert item: %w", err)
+	}
+	return fmt.Sprintf("🧳 Oggetto #%d registrato.", id), nil
+}
+
+// ── search_found_items ───────────────────────────────────────────────────────
+
+type searchFoundItemsTool struct{}
+
+func (t *searchFoundItemsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "search_found_items",
+		Description: "Cerca tra gli oggetti smarriti/trovati, ad esempio quando un ospite chiama. Filtra per parole nella descrizione, camera e periodo. Di default solo quelli non ancora restituiti.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"query": {
+					"type": "string",
+					"description": "Parole da cercare nella descrizione (es. 'occhiali')"
+				},
+				"room_id": {
+					"type": "integer",
+					"description": "Filtra per camera"
+				},
+				"from": {
+					"type": "string",
+					"description": "Trovati dal giorno YYYY-MM-DD"
+				},
+				"to": {
+					"type": "string",
+					"description": "Trovati fino al giorno YYYY-MM-DD"
+				},
+				"include_returned": {
+					"type": "boolean",
+					"description": "Includi anche gli oggetti già restituiti (default false)"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *searchFoundItemsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Query           string `json:"query"`
+		RoomID          *int64 `json:"room_id"`
+		From            string `json:"from"`
+		To              string `json:"to"`
+		IncludeReturned bool   `json:"include_returned"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Every word must appear in the description, in any order.
+	words := []string{}
+	for _, w := range strings.Fields(in.Query) {
+		words = append(words, "%"+w+"%")
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT lf.id, COALESCE(r.name, '-') AS room, lf.found_on, lf.description,
+		        COALESCE(lf.stored_at, '') AS stored_at, u.name AS found_by,
+		        lf.photo IS NOT NULL AS photo, lf.returned_at, COALESCE(lf.returned_to, '') AS returned_to
+		 FROM lost_found lf
+		 LEFT JOIN rooms r ON r.id = lf.room_id
+		 JOIN users u ON u.telegram_id = lf.found_by
+		 WHERE lf.description ILIKE ALL ($1::text[])
+		   AND ($2::int IS NULL OR lf.room_id = $2)
+		   AND (NULLIF($3, '')::date IS NULL OR lf.found_on >= NULLIF($3, '')::date)
+		   AND (NULLIF($4, '')::date IS NULL OR lf.found_on <= NULLIF($4, '')::date)
+		   AND ($5 OR lf.returned_at IS NULL)
+		 ORDER BY lf.found_on DESC, lf.id DESC
+		 LIMIT 50`,
+		words, in.RoomID, in.From, in.To, in.IncludeReturned,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query items: %w", err)
+	}
+	return formatRows(rows)
+}
+
+// ── mark_returned ────────────────────────────────────────────────────────────
+
+type markReturnedTool struct{}
+
+func (t *markReturnedTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "mark_returned",
+		Description: "Segna un oggetto trovato come restituito (o spedito) all'ospite. Solo i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"item_id": {
+					"type": "integer",
+					"description": "ID dell'oggetto"
+				},
+				"returned_to": {
+					"type": "string",
+					"description": "A chi è stato restituito / come è stato spedito"
+				}
+			},
+			"required": ["item_id", "returned_to"]
+		}`),
+	}
+}
+
+func (t *markReturnedTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ItemID     int64  `json:"item_id"`
+		ReturnedTo string `json:"returned_to"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var description string
+	err = db.QueryRow(context.Background(),
+		`UPDATE lost_found SET returned_at = now(), returned_to = $2, returned_by = $3
+		 WHERE id = $1 AND returned_at IS NULL
+		 RETURNING description`,
+		in.ItemID, in.ReturnedTo, ctx.UserID,
+	).Scan(&description)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("oggetto #%d non trovato, già restituito, o permesso negato (solo i manager)", in.ItemID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("mark returned: %w", err)
+	}
+	return fmt.Sprintf("✅ Oggetto #%d (%s) restituito a %s.", in.ItemID, description, in.ReturnedTo), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Utility meters: the monthly electricity, water and gas readings of each
+// room (and of the building, room_id NULL), dictated to the bot with
+// log_reading. A reading is the meter's cumulative index; consumption is the
+// difference from the previous one, per day so that readings taken a few
+// days apart compare. A reading marked reset (meter replaced) starts a new
+// series. log_reading answers with the consumption against the usual rate,
+// and the heartbeat lists the latest readings well above it (saved query
+// meter_anomalies).
+
+// meterKinds are the values of meter_readings.meter: label and unit.
+var meterKinds = map[string]struct{ label, unit string }{
+	"electricity": {"luce", "kWh"},
+	"water":       {"acqua", "m³"},
+	"gas":         {"gas", "m³"},
+}
+
+// meterAnomalyFactor is how far above its usual daily rate a consumption is
+// reported; the heartbeat query uses the same factor.
+const meterAnomalyFactor = 1.5
+
+// meterPoint is one reading of a series, oldest first.
+type meterPoint struct {
+	on      time.Time
+	reading float64
+	reset   bool
+}
+
+// meterConsumption returns what the last reading of points adds to the one
+// before (used over days), and the average daily rate of the earlier
+// intervals (usual, 0 = no history). ok is false when the last reading has
+// nothing to compare with.
+func meterConsumption(points []meterPoint) (used float64, days int, usual float64, ok bool) {
+	n := len(points)
+	if n < 2 || points[n-1].reset {
+		return 0, 0, 0, false
+	}
+	last, prev := points[n-1], points[n-2]
+	used = last.reading - prev.reading
+	days = int(last.on.Sub(prev.on).Hours()/24 + 0.5)
+	var total float64
+	var totalDays int
+	for i := 1; i < n-1; i++ {
+		if points[i].reset {
+			continue
+		}
+		total += points[i].reading - points[i-1].reading
+		totalDays += int(points[i].on.Sub(points[i-1].on).Hours()/24 + 0.5)
+	}
+	if totalDays > 0 {
+		usual = total / float64(totalDays)
+	}
+	return used, days, usual, days > 0
+}
+
+// ── log_reading ──────────────────────────────────────────────────────────────
+
+type logReadingTool struct{}
+
+func (t *logReadingTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_reading",
+		Description: "Registra le letture dei contatori (luce, acqua, gas) di una o più camere, o dei contatori generali " +
+			"(room vuoto o 'generale'). Il valore è quello segnato sul contatore. Risponde con il consumo dalla lettura " +
+			"precedente e lo confronta con quello abituale. Una lettura dello stesso giorno la sostituisce.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"readings": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"room": {"type": "string", "description": "Nome della camera; vuoto o 'generale' per il contatore dell'edificio"},
+							"meter": {"type": "string", "enum": ["electricity", "water", "gas"]},
+							"value": {"type": "number", "description": "Valore letto sul contatore (kWh o m³)"},
+							"reset": {"type": "boolean", "description": "Contatore sostituito o azzerato: riparte da questo valore"},
+							"notes": {"type": "string"}
+						},
+						"required": ["meter", "value"]
+					}
+				},
+				"date": {"type": "string", "description": "Giorno della lettura YYYY-MM-DD (default oggi)"}
+			},
+			"required": ["readings"]
+		}`),
+	}
+}
+
+func (t *logReadingTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Readings []struct {
+			Room  string  `json:"room"`
+			Meter string  `json:"meter"`
+			Value float64 `json:"value"`
+			Reset bool    `json:"reset"`
+			Notes string  `json:"notes"`
+		} `json:"readings"`
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Readings) == 0 {
+		return "", fmt.Errorf("readings is required")
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		if d.After(day) {
+			return "", fmt.Errorf("la data %s è nel futuro", d.Format("02/01/2006"))
+		}
+		day = d
+	}
+	for _, r := range in.Readings {
+		if _, ok := meterKinds[r.Meter]; !ok {
+			return "", fmt.Errorf("meter must be electricity, water or gas")
+		}
+		if r.Value < 0 {
+			return "", fmt.Errorf("il valore letto non può essere negativo")
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	type logged struct {
+		room     string
+		roomID   *int
+		meter    string
+		value    float64
+		replaced bool
+	}
+	var done []logged
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		for _, r := range in.Readings {
+			l := logged{room: "generale", meter: r.Meter, value: r.Value}
+			if name := strings.TrimSpace(r.Room); name != "" && !strings.EqualFold(name, "generale") {
+				var id int
+				if err := tx.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, name).Scan(&id, &l.room); err != nil {
+					return fmt.Errorf("camera %q non trovata", name)
+				}
+				l.roomID = &id
+			}
+			kind := meterKinds[r.Meter]
+			var prev float64
+			var prevOn time.Time
+			err := tx.QueryRow(bg,
+				`SELECT reading::float8, read_on FROM meter_readings
+				 WHERE COALESCE(room_id, 0) = COALESCE($1, 0) AND meter = $2 AND read_on < $3
+				 ORDER BY read_on DESC LIMIT 1`, l.roomID, r.Meter, day).Scan(&prev, &prevOn)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("query previous reading: %w", err)
+			}
+			if err == nil && r.Value < prev && !r.Reset {
+				return fmt.Errorf("%s %s: %.2f %s è meno della lettura del %s (%.2f): controlla il valore, o usa reset se il contatore è stato sostituito",
+					l.room, kind.label, r.Value, kind.unit, prevOn.Format("02/01"), prev)
+			}
+			if err := tx.QueryRow(bg,
+				`INSERT INTO meter_readings (room_id, meter, reading, read_on, reset, notes, logged_by)
+				 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), current_telegram_id())
+				 ON CONFLICT (hotel_id, (COALESCE(room_id, 0)), meter, read_on) DO UPDATE
+				   SET reading = EXCLUDED.reading, reset = EXCLUDED.reset, notes = EXCLUDED.notes,
+				       logged_by = EXCLUDED.logged_by, logged_at = now()
+				 RETURNING xmax <> 0`,
+				l.roomID, r.Meter, r.Value, day, r.Reset, strings.TrimSpace(r.Notes)).Scan(&l.replaced); err != nil {
+				return fmt.Errorf("save reading: %w", err)
+			}
+			done = append(done, l)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📟 Letture del %s registrate:", day.Format("02/01/2006"))
+	for _, l := range done {
+		kind := meterKinds[l.meter]
+		fmt.Fprintf(&sb, "\n• %s %s: %.2f %s", l.room, kind.label, l.value, kind.unit)
+		if l.replaced {
+			sb.WriteString(" (sostituisce la lettura dello stesso giorno)")
+		}
+		rows, err := db.Query(bg,
+			`SELECT read_on, reading::float8, reset FROM meter_readings
+			 WHERE COALESCE(room_id, 0) = COALESCE($1, 0) AND meter = $2
+			   AND read_on <= $3 AND read_on > $3::date - 400
+			 ORDER BY read_on`, l.roomID, l.meter, day)
+		if err != nil {
+			return "", fmt.Errorf("query readings: %w", err)
+		}
+		var points []meterPoint
+		for rows.Next() {
+			var p meterPoint
+			if err := rows.Scan(&p.on, &p.reading, &p.reset); err != nil {
+				rows.Close()
+				return "", err
+			}
+			points = append(points, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		used, days, usual, ok := meterConsumption(points)
+		if !ok {
+			sb.WriteString(" — prima lettura della serie")
+			continue
+		}
+		perDay := used / float64(days)
+		fmt.Fprintf(&sb, " — %.2f %s in %d giorni (%.2f al giorno", used, kind.unit, days, perDay)
+		if usual > 0 {
+			fmt.Fprintf(&sb, ", di solito %.2f", usual)
+		}
+		sb.WriteString(")")
+		if usual > 0 && perDay > meterAnomalyFactor*usual {
+			fmt.Fprintf(&sb, " ⚠️ +%.0f%% rispetto al solito: una perdita o un guasto?", (perDay/usual-1)*100)
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+)
+
+// latencyTracker measures end-to-end turn latency: from the moment an inbound
+// update is handed to the agent to the first outbound message in that chat.
+// Samples are kept in memory (a rolling window) — enough for p50/p95 and SLO
+// alerting without another table.
+//
+// Configure via env:
+//
+//	LATENCY_SLO_SECONDS=30   alert the admin when p95 over the last 15 min exceeds this
+//	METRICS_ADDR=:9090       serve GET /metrics (plain text); empty disables
+type latencyTracker struct {
+	mu      sync.Mutex
+	pending map[int64]time.Time // chatID → inbound time, awaiting first reply
+	samples []latencySample
+	exports []func(w io.Writer) // more lines for /metrics (Expose)
+}
+
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+// latencyWindow bounds both memory and the alerting lookback.
+const (
+	latencyWindow     = 15 * time.Minute
+	latencyMinSamples = 5
+	latencyCheckEvery = 5 * time.Minute
+	latencyCooldown   = 1 * time.Hour
+)
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{pending: make(map[int64]time.Time)}
+}
+
+// Inbound starts the clock for u's chat. Only the first pending update counts,
+// so a burst of messages is measured from the oldest one.
+func (t *latencyTracker) Inbound(_ context.Context, u agent.Update) {
+	t.mu.Lock()
+	if _, ok := t.pending[u.ChatID]; !ok {
+		t.pending[u.ChatID] = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+// Outbound stops the clock for chatID, if running, and records the sample.
+func (t *latencyTracker) Outbound(chatID int64, _ string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	start, ok := t.pending[chatID]
+	if !ok {
+		return
+	}
+	delete(t.pending, chatID)
+	now := time.Now()
+	t.samples = append(t.samples, latencySample{at: now, d: now.Sub(start)})
+	t.prune(now)
+}
+
+func (t *latencyTracker) prune(now time.Time) {
+	i := 0
+	for i < len(t.samples) && now.Sub(t.samples[i].at) > latencyWindow {
+		i++
+	}
+	t.samples = t.samples[i:]
+}
+
+// Percentiles returns p50, p95 and the sample count over the rolling window.
+func (t *latencyTracker) Percentiles() (p50, p95 time.Duration, n int) {
+	t.mu.Lock()
+	t.prune(time.Now())
+	ds := make([]time.Duration, len(t.samples))
+	for i, s := range t.samples {
+		ds[i] = s.d
+	}
+	t.mu.Unlock()
+
+	if len(ds) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	pct := func(p float64) time.Duration {
+		return ds[int(p*float64(len(ds)-1))]
+	}
+	return pct(0.50), pct(0.95), len(ds)
+}
+
+// Expose adds the lines written by f to /metrics.
+func (t *latencyTracker) Expose(f func(w io.Writer)) {
+	t.mu.Lock()
+	t.exports = append(t.exports, f)
+	t.mu.Unlock()
+}
+
+// Start launches the SLO checker and, if METRICS_ADDR is set, the HTTP endpoint.
+func (t *latencyTracker) Start(ctx context.Context, botToken string, adminID int64) {
+	slo := 30 * time.Second
+	if v := envOr("LATENCY_SLO_SECONDS", ""); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			slo = time.Duration(n) * time.Second
+		} else {
+			log.Printf("latency: invalid LATENCY_SLO_SECONDS=%q, using %v", v, slo)
+		}
+	}
+
+	if addr := envOr("METRICS_ADDR", ""); addr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+			p50, p95, n := t.Percentiles()
+			fmt.Fprintf(w, "turn_latency_p50_seconds %.3f\n", p50.Seconds())
+			fmt.Fprintf(w, "turn_latency_p95_seconds %.3f\n", p95.Seconds())
+			fmt.Fprintf(w, "turn_latency_samples %d\n", n)
+			fmt.Fprintf(w, "turn_latency_slo_seconds %.0f\n", slo.Seconds())
+			t.mu.Lock()
+			exports := t.exports
+			t.mu.Unlock()
+			for _, f := range exports {
+				f(w)
+			}
+		})
+		srv := &http.Server{Addr: addr, Handler: mux}
+		go func() {
+			log.Printf("metrics: listening on %s", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("metrics: %v", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(latencyCheckEvery)
+		defer ticker.Stop()
+		var lastAlert time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			p50, p95, n := t.Percentiles()
+			if n < latencyMinSamples || p95 <= slo || time.Since(lastAlert) < latencyCooldown {
+				continue
+			}
+			lastAlert = time.Now()
+			msg := fmt.Sprintf("🐢 Risposte lente: p95 %s (p50 %s) su %d turni negli ultimi %d minuti, soglia %s. Possibile degrado del provider LLM.",
+				p95.Round(time.Second), p50.Round(time.Second), n, int(latencyWindow.Minutes()), slo)
+			log.Printf("latency: SLO breach p95=%v p50=%v n=%d", p95, p50, n)
+			if err := telegram.New(botToken).Send(ctx, adminID, msg); err != nil {
+				log.Printf("latency: alert admin: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Minibar consumption. Cleaners log what is missing from the minibar during
+// the room check; each row is billed to the reservation staying in (or
+// leaving) the room at the price of minibar_items at that moment. Invoices
+// list it as "Minibar: …" lines and outstanding_balance adds it to the total,
+// so it is charged at checkout with the rest. The price list is
+// minibar_items, edited by managers with execute_sql.
+
+// ── log_minibar ──────────────────────────────────────────────────────────────
+
+type logMinibarTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *logMinibarTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_minibar",
+		Description: "Registra i prodotti consumati dal minibar di una camera durante il controllo: vengono addebitati " +
+			"alla prenotazione in corso (o in partenza oggi) e finiscono nel conto e in fattura.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera (es. '101')"},
+				"items": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"item": {"type": "string", "description": "Codice o nome del prodotto (es. 'acqua', 'birra')"},
+							"quantity": {"type": "integer", "description": "Pezzi consumati (default 1)"}
+						},
+						"required": ["item"]
+					}
+				},
+				"assignment_id": {"type": "integer", "description": "Assegnazione durante cui è stato controllato (opzionale)"}
+			},
+			"required": ["room", "items"]
+		}`),
+	}
+}
+
+type minibarLine struct {
+	id       int64
+	name     string
+	quantity int
+	unitEUR  float64
+}
+
+func (t *logMinibarTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room  string `json:"room"`
+		Items []struct {
+			Item     string `json:"item"`
+			Quantity int    `json:"quantity"`
+		} `json:"items"`
+		AssignmentID *int64 `json:"assignment_id"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Room) == "" || len(in.Items) == 0 {
+		return "", fmt.Errorf("room and items are required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var roomID, reservationID int64
+	var room, guest string
+	err = db.QueryRow(bg,
+		`SELECT r.id, r.name, res.id, COALESCE(res.guest_name, '')
+		 FROM rooms r
+		 JOIN reservations res ON res.room_id = r.id AND res.status = 'confirmed'
+		 WHERE lower(r.name) = lower($1)
+		   AND res.checkin_at <= now()
+		   AND res.checkout_at >= (date_trunc('day', now() AT TIME ZONE 'Europe/Rome') AT TIME ZONE 'Europe/Rome')
+		 ORDER BY res.checkin_at DESC
+		 LIMIT 1`, strings.TrimSpace(in.Room),
+	).Scan(&roomID, &room, &reservationID, &guest)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("nessun ospite in camera %s oggi: il consumo non si può addebitare, avvisa il manager", in.Room)
+	}
+	if err != nil {
+		return "", fmt.Errorf("query reservation: %w", err)
+	}
+
+	var lines []minibarLine
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		for _, it := range in.Items {
+			if it.Quantity == 0 {
+				it.Quantity = 1
+			}
+			if it.Quantity < 0 {
+				return fmt.Errorf("quantity must be positive")
+			}
+			var l minibarLine
+			err := tx.QueryRow(bg,
+				`SELECT id, name, price_eur::float8 FROM minibar_items
+				 WHERE active AND (lower(code) = lower($1) OR name ILIKE '%' || $1 || '%')
+				 ORDER BY lower(code) = lower($1) DESC, name
+				 LIMIT 1`, strings.TrimSpace(it.Item),
+			).Scan(&l.id, &l.name, &l.unitEUR)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("prodotto %q non è nel listino del minibar", it.Item)
+			}
+			if err != nil {
+				return fmt.Errorf("query item: %w", err)
+			}
+			l.quantity = it.Quantity
+			if _, err := tx.Exec(bg,
+				`INSERT INTO minibar_consumption (reservation_id, room_id, item_id, quantity, unit_price_eur, logged_by, assignment_id)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				reservationID, roomID, l.id, l.quantity, l.unitEUR, ctx.UserID, in.AssignmentID,
+			); err != nil {
+				return fmt.Errorf("insert consumption: %w", err)
+			}
+			lines = append(lines, l)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var total float64
+	items := make([]string, len(lines))
+	for i, l := range lines {
+		total += l.unitEUR * float64(l.quantity)
+		items[i] = fmt.Sprintf("%d × %s", l.quantity, l.name)
+	}
+	msg := fmt.Sprintf("🍫 Minibar camera %s: %s — %.2f€ addebitati alla prenotazione #%d",
+		room, strings.Join(items, ", "), roundCents(total), reservationID)
+	if guest != "" {
+		msg += " (" + guest + ")"
+	}
+	msg += "."
+	// Invoices are visible to managers only, hence the admin pool. An issued
+	// invoice is never reissued: the manager has to settle the minibar apart.
+	var invoiced bool
+	_ = t.adminPool.QueryRow(bg,
+		`SELECT EXISTS (SELECT 1 FROM invoices WHERE reservation_id = $1)`, reservationID).Scan(&invoiced)
+	if invoiced {
+		t.notifyManagers(ctx, reservationID, room, items, total)
+		msg += " La fattura era già emessa: il manager è stato avvisato."
+	}
+	return msg, nil
+}
+
+func (t *logMinibarTool) notifyManagers(ctx agent.ToolContext, reservationID int64, room string, items []string, total float64) {
+	bg := context.Background()
+	msg := fmt.Sprintf("🍫 Minibar camera %s dopo la fattura della prenotazione #%d: %s (%.2f€). Non è in fattura: da incassare a parte.",
+		room, reservationID, strings.Join(items, ", "), roundCents(total))
+	var hotelID int
+	if err := t.adminPool.QueryRow(bg, `SELECT hotel_id FROM reservations WHERE id = $1`, reservationID).Scan(&hotelID); err != nil {
+		return
+	}
+	managers, err := managerIDs(bg, t.adminPool, hotelID)
+	if err != nil {
+		return
+	}
+	tg := newBot(t.botToken)
+	for _, m := range managers {
+		if m == ctx.UserID {
+			continue
+		}
+		_ = tg.Send(bg, m, msg)
+	}
+}
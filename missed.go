@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// missedDeliveries keeps the bot's own messages that Telegram refused or
+// never received (bot blocked, user offline for long, network errors) in
+// missed_messages, and sends them back as one catch-up digest the next time
+// the user writes to the bot. Only users are tracked: a failure towards a
+// group chat is just logged. Buttons of a failed keyboard are not kept, the
+// text says what was asked.
+type missedDeliveries struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+// missed is set once at startup (main.go) next to localizer; nil drops
+// failed sends as before.
+var missed *missedDeliveries
+
+func newMissedDeliveries(adminPool *pgxpool.Pool, botToken string) *missedDeliveries {
+	return &missedDeliveries{adminPool: adminPool, botToken: botToken}
+}
+
+// missedDigestMax is how many missed messages a digest repeats in full; the
+// older ones are only counted.
+const missedDigestMax = 30
+
+// Record stores text (as passed to the sender, before translation) that
+// could not be delivered to chatID.
+func (m *missedDeliveries) Record(ctx context.Context, chatID int64, text string, isHTML bool, sendErr error) {
+	if m == nil || strings.TrimSpace(text) == "" {
+		return
+	}
+	// The request context may be the one that just failed.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	tag, err := m.adminPool.Exec(ctx,
+		`INSERT INTO missed_messages (telegram_id, text, html, error)
+		 SELECT telegram_id, $2, $3, $4 FROM users WHERE telegram_id = $1`,
+		chatID, text, isHTML, sendErr.Error())
+	if err != nil {
+		log.Printf("missed: record for %d: %v", chatID, err)
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("missed: delivery to %d failed (%v), kept for the catch-up digest", chatID, sendErr)
+	}
+}
+
+// Inbound implements the routedMessenger observer: a message from the user
+// proves they are reachable again.
+func (m *missedDeliveries) Inbound(ctx context.Context, u agent.Update) {
+	m.Deliver(ctx, u.UserID)
+}
+
+// Deliver sends userID the digest of their missed messages, if any, and
+// returns how many it held.
+func (m *missedDeliveries) Deliver(ctx context.Context, userID int64) int {
+	if m == nil {
+		return 0
+	}
+	rows, err := m.adminPool.Query(ctx,
+		`SELECT id, text, html, created_at FROM missed_messages WHERE telegram_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		log.Printf("missed: query for %d: %v", userID, err)
+		return 0
+	}
+	var ids []int64
+	var texts []string
+	var times []time.Time
+	for rows.Next() {
+		var id int64
+		var text string
+		var isHTML bool
+		var at time.Time
+		if err := rows.Scan(&id, &text, &isHTML, &at); err != nil {
+			rows.Close()
+			log.Printf("missed: scan: %v", err)
+			return 0
+		}
+		if isHTML {
+			text = htmlToText(text)
+		}
+		ids = append(ids, id)
+		texts = append(texts, text)
+		times = append(times, at)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return 0
+	}
+
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📬 Mentre non eri raggiungibile ti ho scritto %d messaggi", len(ids))
+	if skipped := len(ids) - missedDigestMax; skipped > 0 {
+		fmt.Fprintf(&sb, " (ecco gli ultimi %d)", missedDigestMax)
+		texts, times = texts[skipped:], times[skipped:]
+	}
+	sb.WriteString(":")
+	for i, text := range texts {
+		fmt.Fprintf(&sb, "\n\n🕐 %s\n%s", times[i].In(loc).Format("02/01 15:04"), text)
+	}
+	// Sent through the plain client: a failure here must not be recorded again.
+	msg := localizer.Localize(ctx, userID, sb.String())
+	if err := telegram.New(m.botToken).Send(ctx, userID, msg); err != nil {
+		log.Printf("missed: digest to %d: %v", userID, err)
+		return 0
+	}
+	if _, err := m.adminPool.Exec(ctx, `DELETE FROM missed_messages WHERE id = ANY($1)`, ids); err != nil {
+		log.Printf("missed: delete for %d: %v", userID, err)
+	}
+	return len(ids)
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// htmlToText turns a Telegram HTML message into plain text for the digest.
+func htmlToText(s string) string {
+	return html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Onboarding is the scripted (non-LLM) welcome tour that runs right after an
+// invite is redeemed:
+//
+//	welcome + role tour → language buttons → timezone buttons → pinned cheat-sheet
+//
+// Button presses arrive as "onb:lang:<Language>" / "onb:tz:<IANA zone>" and
+// are routed here by routedMessenger, so the whole flow costs zero tokens.
+type Onboarding struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+}
+
+func newOnboarding(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *Onboarding {
+	return &Onboarding{adminPool: adminPool, registry: registry, botToken: botToken}
+}
+
+// onboardingLanguages are offered as buttons; values match users.language.
+var onboardingLanguages = []telegram.Button{
+	{Text: "🇮🇹 Italiano", CallbackData: "onb:lang:Italian"},
+	{Text: "🇬🇧 English", CallbackData: "onb:lang:English"},
+	{Text: "🇩🇪 Deutsch", CallbackData: "onb:lang:German"},
+	{Text: "🇷🇴 Română", CallbackData: "onb:lang:Romanian"},
+}
+
+// onboardingTimezones are offered as buttons; values must be valid IANA zones.
+var onboardingTimezones = []telegram.Button{
+	{Text: "🇮🇹 Roma", CallbackData: "onb:tz:Europe/Rome"},
+	{Text: "🇬🇧 London", CallbackData: "onb:tz:Europe/London"},
+	{Text: "🇷🇴 București", CallbackData: "onb:tz:Europe/Bucharest"},
+	{Text: "🌐 UTC", CallbackData: "onb:tz:UTC"},
+}
+
+// Register wires the onboarding button handlers into the messenger.
+func (o *Onboarding) Register(m *routedMessenger) {
+	m.Handle("onb:", o.handleCallback)
+}
+
+// Start sends the role tour and the language picker. It returns the line the
+// caller (HandleStart) should send last, pointing the user at the buttons.
+func (o *Onboarding) Start(ctx context.Context, chatID int64, info *InviteInfo) (string, error) {
+	var hotelName string
+	if err := o.adminPool.QueryRow(ctx, `SELECT name FROM hotels WHERE id = $1`, info.HotelID).Scan(&hotelName); err != nil {
+		return "", fmt.Errorf("hotel %d: %w", info.HotelID, err)
+	}
+	tg := newBot(o.botToken)
+	if err := tg.SendHTML(ctx, chatID, welcomeTour(hotelName, info.Name, info.Role)); err != nil {
+		return "", fmt.Errorf("send tour: %w", err)
+	}
+	if _, err := sendKeyboard(ctx, o.botToken, chatID,
+		"🌍 <b>1/2</b> — In che lingua preferisci che ti risponda?",
+		[][]telegram.Button{onboardingLanguages},
+	); err != nil {
+		return "", fmt.Errorf("send language picker: %w", err)
+	}
+	return "👆 Scegli la lingua per continuare.", nil
+}
+
+func (o *Onboarding) handleCallback(ctx context.Context, u agent.Update) error {
+	if !o.registry.IsRegistered(ctx, u.UserID) {
+		return fmt.Errorf("user %d not registered", u.UserID)
+	}
+	parts := strings.SplitN(u.Text, ":", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed onboarding callback")
+	}
+
+	switch parts[1] {
+	case "lang":
+		offered := false
+		for _, b := range onboardingLanguages {
+			offered = offered || b.CallbackData == u.Text
+		}
+		if !offered {
+			return fmt.Errorf("invalid language %q", parts[2])
+		}
+		if _, err := o.adminPool.Exec(ctx,
+			`UPDATE users SET language = $1, language_source = 'chosen' WHERE telegram_id = $2`, parts[2], u.UserID,
+		); err != nil {
+			return fmt.Errorf("set language: %w", err)
+		}
+		_, err := sendKeyboard(ctx, o.botToken, u.ChatID,
+			"🕐 <b>2/2</b> — Qual è il tuo fuso orario?",
+			[][]telegram.Button{onboardingTimezones},
+		)
+		return err
+
+	case "tz":
+		if _, err := time.LoadLocation(parts[2]); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", parts[2], err)
+		}
+		var role, language string
+		if err := o.adminPool.QueryRow(ctx,
+			`UPDATE users SET timezone = $1, onboarded_at = now()
+			 WHERE telegram_id = $2
+			 RETURNING role, language`, parts[2], u.UserID,
+		).Scan(&role, &language); err != nil {
+			return fmt.Errorf("set timezone: %w", err)
+		}
+
+		msgID, err := sendKeyboard(ctx, o.botToken, u.ChatID, cheatSheet(Role(role), language), nil)
+		if err != nil {
+			return fmt.Errorf("send cheat-sheet: %w", err)
+		}
+		if err := pinMessage(ctx, o.botToken, u.ChatID, msgID); err != nil {
+			// Not fatal: the cheat-sheet is delivered, just not pinned.
+			log.Printf("warn: pin cheat-sheet for user %d: %v", u.UserID, err)
+		}
+		log.Printf("onboarding complete for user %d (language=%s tz=%s)", u.UserID, language, parts[2])
+		return nil
+	}
+	return fmt.Errorf("unknown onboarding step %q", parts[1])
+}
+
+// welcomeTour is the first onboarding message: what this role can do.
+func welcomeTour(hotelName, name string, role Role) string {
+	var sb strings.Builder
+	if role == RoleGuest {
+		fmt.Fprintf(&sb, "✅ <b>Benvenuto/a, %s!</b>\nSono l'assistente di %s per il tuo soggiorno. 🏨\n\n",
+			htmlpkg.EscapeString(name), htmlpkg.EscapeString(hotelName))
+	} else {
+		fmt.Fprintf(&sb, "✅ <b>Benvenuto/a, %s!</b>\nSei nel team di %s. 🏨\n\n",
+			htmlpkg.EscapeString(name), htmlpkg.EscapeString(hotelName))
+	}
+	sb.WriteString("<b>Cosa puoi fare con me:</b>\n")
+	switch role {
+	case RoleManager:
+		sb.WriteString("• Gestire camere, prenotazioni e assegnazioni delle pulizie\n")
+		sb.WriteString("• Mandare messaggi allo staff (a una persona, a un ruolo o a tutti)\n")
+		sb.WriteString("• Programmare promemoria per te o per i colleghi\n")
+		sb.WriteString("• Invitare nuovi membri dello staff\n")
+	case RoleGuest:
+		sb.WriteString("• Rivedere la tua prenotazione e l'orario di checkout\n")
+		sb.WriteString("• Chiedere asciugamani puliti o in più\n")
+		sb.WriteString("• Segnalare un problema in camera\n")
+	default:
+		sb.WriteString("• Vedere quali camere vanno pulite oggi\n")
+		sb.WriteString("• Prenderti una camera e aggiornarne lo stato\n")
+		sb.WriteString("• Segnalare problemi nelle note dell'assegnazione\n")
+		sb.WriteString("• Programmare promemoria e scrivere al manager\n")
+	}
+	sb.WriteString("\nScrivimi in modo naturale, come faresti con un collega.")
+	return sb.String()
+}
+
+// cheatSheet is the pinned quick reference, in the user's chosen language
+// (Italian or English; other languages fall back to English).
+func cheatSheet(role Role, language string) string {
+	italian := language == "Italian"
+	switch {
+	case role == RoleGuest && italian:
+		return "📌 <b>Promemoria rapido</b>\n\n" +
+			"• <i>A che ora devo lasciare la camera?</i>\n" +
+			"• <i>Potrei avere due asciugamani in più?</i>\n" +
+			"• <i>Il condizionatore non funziona</i>\n" +
+			"• <i>Fino a quando è la mia prenotazione?</i>"
+	case role == RoleGuest:
+		return "📌 <b>Quick reference</b>\n\n" +
+			"• <i>What time is checkout?</i>\n" +
+			"• <i>Could I have two extra towels?</i>\n" +
+			"• <i>The air conditioning is not working</i>\n" +
+			"• <i>Until when is my booking?</i>"
+	case role == RoleManager && italian:
+		return "📌 <b>Promemoria rapido</b>\n\n" +
+			"• <i>Chi pulisce la 101 oggi?</i>\n" +
+			"• <i>Assegna la 203 a Maria per domani mattina</i>\n" +
+			"• <i>Nuova prenotazione: Rossi, camera 12, dal 3 al 5</i>\n" +
+			"• <i>Ricordami alle 17 di controllare la 105</i>\n" +
+			"• <i>Invita Luca come addetto alle pulizie</i>"
+	case role == RoleManager:
+		return "📌 <b>Quick reference</b>\n\n" +
+			"• <i>Who is cleaning 101 today?</i>\n" +
+			"• <i>Assign 203 to Maria tomorrow morning</i>\n" +
+			"• <i>New reservation: Rossi, room 12, from the 3rd to the 5th</i>\n" +
+			"• <i>Remind me at 5pm to check 105</i>\n" +
+			"• <i>Invite Luca as cleaning staff</i>"
+	case italian:
+		return "📌 <b>Promemoria rapido</b>\n\n" +
+			"• <i>Cosa ho oggi?</i>\n" +
+			"• <i>Prendo io la 104</i>\n" +
+			"• <i>Ho iniziato la 104</i> / <i>Ho finito la 104</i>\n" +
+			"• <i>Nella 104 manca il phon</i>\n" +
+			"• <i>Ricordami alle 14 la 203</i>"
+	default:
+		return "📌 <b>Quick reference</b>\n\n" +
+			"• <i>What do I have today?</i>\n" +
+			"• <i>I'll take 104</i>\n" +
+			"• <i>Started 104</i> / <i>Finished 104</i>\n" +
+			"• <i>The hairdryer is missing in 104</i>\n" +
+			"• <i>Remind me about 203 at 2pm</i>"
+	}
+}
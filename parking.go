@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Parking: parking_spots lists the property's spaces and
+// reservations.parking_spot_id gives one to a stay. The
+// reservations_reject_parking_overlap trigger keeps a spot to one stay per
+// night. parking answers "c'è posto per l'ospite che arriva stasera?",
+// assign_parking gives or takes back a spot, and the arrivals of today_board
+// show it.
+
+// parkingKinds are the values of parking_spots.kind, as the tools show them.
+var parkingKinds = map[string]string{
+	"outdoor": "scoperto",
+	"covered": "coperto",
+	"garage":  "garage",
+}
+
+// parkingSpot is an active spot with the stay holding it in a period, if any.
+type parkingSpot struct {
+	id                 int
+	label, kind, notes string
+	reservation        int64 // 0 = free
+	guest, room        string
+	checkout           time.Time
+}
+
+// parkingSpots returns the active spots with, for each, the first confirmed
+// stay (or live option) other than exclude overlapping from..to.
+func parkingSpots(ctx context.Context, db querier, from, to time.Time, exclude int64) ([]parkingSpot, error) {
+	rows, err := db.Query(ctx,
+		`SELECT p.id, p.label, p.kind, COALESCE(p.notes, ''),
+		        COALESCE(o.id, 0), COALESCE(o.guest_name, ''), COALESCE(o.room, ''), o.checkout_at
+		 FROM parking_spots p
+		 LEFT JOIN LATERAL (
+		     SELECT res.id, res.guest_name, r.name AS room, res.checkout_at
+		     FROM reservations res JOIN rooms r ON r.id = res.room_id
+		     WHERE res.parking_spot_id = p.id AND res.id <> $3
+		       AND res.checkin_at < $2 AND res.checkout_at > $1
+		       AND (res.status = 'confirmed' OR (res.status = 'option' AND res.hold_until > now()))
+		     ORDER BY res.checkin_at
+		     LIMIT 1) o ON true
+		 WHERE p.active
+		 ORDER BY p.label`, from, to, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("query parking: %w", err)
+	}
+	defer rows.Close()
+	var out []parkingSpot
+	for rows.Next() {
+		var s parkingSpot
+		var checkout *time.Time
+		if err := rows.Scan(&s.id, &s.label, &s.kind, &s.notes, &s.reservation, &s.guest, &s.room, &checkout); err != nil {
+			return nil, err
+		}
+		if checkout != nil {
+			s.checkout = *checkout
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// describe is how the tools name a spot: "P3 (coperto)".
+func (s parkingSpot) describe() string {
+	return fmt.Sprintf("%s (%s)", s.label, parkingKinds[s.kind])
+}
+
+// parkingStay is the reservation a parking tool works on.
+type parkingStay struct {
+	id                int64
+	guest, room       string
+	status            string
+	checkin, checkout time.Time
+	spot              string // label of the spot it holds, "" = none
+}
+
+func loadParkingStay(ctx context.Context, db querier, id int64) (parkingStay, error) {
+	s := parkingStay{id: id}
+	err := db.QueryRow(ctx,
+		`SELECT COALESCE(res.guest_name, 'ospite'), r.name, res.status, res.checkin_at, res.checkout_at, COALESCE(p.label, '')
+		 FROM reservations res
+		 JOIN rooms r ON r.id = res.room_id
+		 LEFT JOIN parking_spots p ON p.id = res.parking_spot_id
+		 WHERE res.id = $1`, id,
+	).Scan(&s.guest, &s.room, &s.status, &s.checkin, &s.checkout, &s.spot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, fmt.Errorf("prenotazione #%d non trovata", id)
+	}
+	if err != nil {
+		return s, fmt.Errorf("query reservation: %w", err)
+	}
+	return s, nil
+}
+
+// ── parking ──────────────────────────────────────────────────────────────────
+
+type parkingTool struct{}
+
+func (t *parkingTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "parking",
+		Description: "Posti auto: per una notte (default stanotte) quali sono liberi e chi occupa gli altri; con reservation_id " +
+			"quali restano liberi per tutto il soggiorno di quella prenotazione e se ne ha già uno. Usalo per " +
+			"'c'è posto per l'ospite che arriva stasera?'.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {"type": "string", "description": "Notte, YYYY-MM-DD (default oggi)"},
+				"reservation_id": {"type": "integer", "description": "Prenotazione di cui controllare il soggiorno"}
+			}
+		}`),
+	}
+}
+
+func (t *parkingTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Date          string `json:"date"`
+		ReservationID int64  `json:"reservation_id"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	loc := romeLocation()
+
+	var stay parkingStay
+	var from, to time.Time
+	if in.ReservationID != 0 {
+		if stay, err = loadParkingStay(bg, db, in.ReservationID); err != nil {
+			return "", err
+		}
+		from, to = stay.checkin, stay.checkout
+	} else {
+		now := time.Now().In(loc)
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		if in.Date != "" {
+			if day, err = time.ParseInLocation("2006-01-02", in.Date, loc); err != nil {
+				return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+			}
+		}
+		// The night of day: from the evening to the next morning.
+		from = day.Add(18 * time.Hour)
+		to = day.AddDate(0, 0, 1).Add(9 * time.Hour)
+	}
+	spots, err := parkingSpots(bg, db, from, to, in.ReservationID)
+	if err != nil {
+		return "", err
+	}
+	if len(spots) == 0 {
+		return "Nessun posto auto registrato (i manager li aggiungono alla tabella parking_spots con execute_sql).", nil
+	}
+
+	var free, taken []string
+	for _, s := range spots {
+		line := "• " + s.describe()
+		if s.notes != "" {
+			line += " — " + s.notes
+		}
+		if s.reservation == 0 {
+			free = append(free, line)
+			continue
+		}
+		taken = append(taken, fmt.Sprintf("%s — %s, camera %s (#%d), fino al %s",
+			line, s.guest, s.room, s.reservation, s.checkout.In(loc).Format("02/01")))
+	}
+
+	var sb strings.Builder
+	if in.ReservationID != 0 {
+		fmt.Fprintf(&sb, "🅿️ Soggiorno #%d di %s, camera %s, %s → %s.", stay.id, stay.guest, stay.room,
+			stay.checkin.In(loc).Format("02/01"), stay.checkout.In(loc).Format("02/01"))
+		if stay.spot != "" {
+			fmt.Fprintf(&sb, " Ha già il posto %s.", stay.spot)
+		}
+		fmt.Fprintf(&sb, "\nLiberi per tutto il soggiorno (%d di %d):", len(free), len(spots))
+	} else {
+		fmt.Fprintf(&sb, "🅿️ Posti auto la notte del %s — liberi %d di %d:", from.Format("02/01"), len(free), len(spots))
+	}
+	if len(free) == 0 {
+		sb.WriteString("\nnessuno.")
+	} else {
+		sb.WriteString("\n" + strings.Join(free, "\n"))
+	}
+	if len(taken) > 0 {
+		sb.WriteString("\nOccupati:\n" + strings.Join(taken, "\n"))
+	}
+	return sb.String(), nil
+}
+
+// ── assign_parking ───────────────────────────────────────────────────────────
+
+type assignParkingTool struct{}
+
+func (t *assignParkingTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "assign_parking",
+		Description: "Assegna un posto auto a una prenotazione per tutto il soggiorno (spot, o il primo libero se omesso), " +
+			"oppure lo libera con release. Rifiuta un posto già dato a un altro soggiorno nelle stesse notti. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer", "description": "ID della prenotazione"},
+				"spot": {"type": "string", "description": "Nome del posto (default: il primo libero)"},
+				"release": {"type": "boolean", "description": "Libera il posto della prenotazione"}
+			},
+			"required": ["reservation_id"]
+		}`),
+	}
+}
+
+func (t *assignParkingTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64  `json:"reservation_id"`
+		Spot          string `json:"spot"`
+		Release       bool   `json:"release"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.ReservationID == 0 {
+		return "", fmt.Errorf("reservation_id is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("assign_parking is only available to managers")
+	}
+	stay, err := loadParkingStay(bg, db, in.ReservationID)
+	if err != nil {
+		return "", err
+	}
+
+	if in.Release {
+		if stay.spot == "" {
+			return fmt.Sprintf("La prenotazione #%d non ha un posto auto.", stay.id), nil
+		}
+		if _, err := db.Exec(bg, `UPDATE reservations SET parking_spot_id = NULL WHERE id = $1`, stay.id); err != nil {
+			return "", fmt.Errorf("release parking: %w", err)
+		}
+		return fmt.Sprintf("🅿️ Posto %s liberato (prenotazione #%d, %s).", stay.spot, stay.id, stay.guest), nil
+	}
+	if stay.status != "confirmed" && stay.status != "option" {
+		return "", fmt.Errorf("la prenotazione #%d è %s: niente posto auto", stay.id, stay.status)
+	}
+
+	spots, err := parkingSpots(bg, db, stay.checkin, stay.checkout, stay.id)
+	if err != nil {
+		return "", err
+	}
+	var pick *parkingSpot
+	var free []string
+	want := strings.TrimSpace(in.Spot)
+	for i, s := range spots {
+		if s.reservation == 0 {
+			free = append(free, s.label)
+		}
+		switch {
+		case want != "" && strings.EqualFold(s.label, want):
+			pick = &spots[i]
+		case want == "" && pick == nil && s.reservation == 0:
+			pick = &spots[i]
+		}
+	}
+	freeList := "nessuno"
+	if len(free) > 0 {
+		freeList = strings.Join(free, ", ")
+	}
+	loc := romeLocation()
+	switch {
+	case len(spots) == 0:
+		return "", fmt.Errorf("nessun posto auto registrato: i manager li aggiungono alla tabella parking_spots con execute_sql")
+	case pick == nil && want != "":
+		return "", fmt.Errorf("posto %q non trovato; liberi per il soggiorno: %s", want, freeList)
+	case pick == nil:
+		return fmt.Sprintf("Nessun posto auto libero per tutto il soggiorno #%d (%s → %s).", stay.id,
+			stay.checkin.In(loc).Format("02/01"), stay.checkout.In(loc).Format("02/01")), nil
+	case pick.reservation != 0:
+		return "", fmt.Errorf("il posto %s è già di %s, camera %s (#%d), fino al %s; liberi per il soggiorno: %s",
+			pick.label, pick.guest, pick.room, pick.reservation, pick.checkout.In(loc).Format("02/01"), freeList)
+	}
+
+	if _, err := db.Exec(bg, `UPDATE reservations SET parking_spot_id = $2 WHERE id = $1`, stay.id, pick.id); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+			return "", fmt.Errorf("il posto %s è appena stato assegnato ad altri (%s); liberi: %s", pick.label, pgErr.Message, freeList)
+		}
+		return "", fmt.Errorf("assign parking: %w", err)
+	}
+	msg := fmt.Sprintf("🅿️ Posto %s a %s, camera %s (#%d), %s → %s.", pick.describe(), stay.guest, stay.room, stay.id,
+		stay.checkin.In(loc).Format("02/01"), stay.checkout.In(loc).Format("02/01"))
+	if stay.spot != "" && !strings.EqualFold(stay.spot, pick.label) {
+		msg += fmt.Sprintf(" Il posto %s torna libero.", stay.spot)
+	}
+	return msg, nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Payments received for a reservation: deposits at booking, the balance at
+// checkout, refunds as negative amounts. What a reservation owes is the total
+// of its invoice when one was issued, otherwise amount_eur plus its extras,
+// its minibar consumption and the city tax; reservations without amount_eur have no known total and
+// are reported as such rather than as settled.
+
+var paymentMethods = map[string]string{
+	"cash":     "contanti",
+	"card":     "carta",
+	"transfer": "bonifico",
+	"ota":      "portale",
+	"other":    "altro",
+}
+
+// reservationBalance is what a reservation owes and has paid.
+type reservationBalance struct {
+	id                int64
+	room, guest       string
+	checkin, checkout time.Time
+	due               *float64 // nil when the total is unknown
+	paid, deposits    float64
+}
+
+func (b reservationBalance) outstanding() float64 {
+	if b.due == nil {
+		return 0
+	}
+	return roundCents(*b.due - b.paid)
+}
+
+// loadBalances computes the balance of the confirmed reservations matched by
+// where, a condition on res (reservations) with args starting at $1.
+func loadBalances(ctx context.Context, db querier, where string, args ...any) ([]reservationBalance, error) {
+	rows, err := db.Query(ctx,
+		`SELECT res.id, r.name, COALESCE(res.guest_name, ''), res.checkin_at, res.checkout_at,
+		        res.guests, res.children, res.amount_eur::float8, i.total_eur::float8,
+		        COALESCE((SELECT sum(re.quantity * re.unit_price_eur *
+		                             CASE WHEN e.pricing = 'per_day' THEN re.to_date - re.from_date + 1 ELSE 1 END)
+		                  FROM reservation_extras re JOIN extras e ON e.hotel_id = re.hotel_id AND e.code = re.extra_code
+		                  WHERE re.reservation_id = res.id), 0)::float8
+		          + COALESCE((SELECT sum(mc.quantity * mc.unit_price_eur)
+		                      FROM minibar_consumption mc WHERE mc.reservation_id = res.id), 0)::float8,
+		        COALESCE((SELECT sum(p.amount_eur) FROM payments p WHERE p.reservation_id = res.id), 0)::float8,
+		        COALESCE((SELECT sum(p.amount_eur) FROM payments p WHERE p.reservation_id = res.id AND p.is_deposit), 0)::float8
+		 FROM reservations res
+		 JOIN rooms r ON r.id = res.room_id
+		 LEFT JOIN invoices i ON i.reservation_id = res.id
+		 WHERE res.status = 'confirmed' AND `+where+`
+		 ORDER BY res.checkout_at, r.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []reservationBalance
+	for rows.Next() {
+		var b reservationBalance
+		var guests, children int
+		var amount, invoiced *float64
+		var extras float64
+		if err := rows.Scan(&b.id, &b.room, &b.guest, &b.checkin, &b.checkout, &guests, &children,
+			&amount, &invoiced, &extras, &b.paid, &b.deposits); err != nil {
+			return nil, err
+		}
+		switch {
+		case invoiced != nil:
+			b.due = invoiced
+		case amount != nil:
+			due := roundCents(*amount + extras + cityTax(guests, children, len(nightsBetween(b.checkin, b.checkout))))
+			b.due = &due
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// summary is one line per reservation: stay, total, paid and what is left.
+func (b reservationBalance) summary() string {
+	loc := romeLocation()
+	s := fmt.Sprintf("#%d camera %s", b.id, b.room)
+	if b.guest != "" {
+		s += " " + b.guest
+	}
+	s += fmt.Sprintf(" (%s → %s)", b.checkin.In(loc).Format("02/01"), b.checkout.In(loc).Format("02/01"))
+	if b.due == nil {
+		return s + fmt.Sprintf(": totale non indicato (amount_eur), pagati %.2f€", b.paid)
+	}
+	s += fmt.Sprintf(": totale %.2f€, pagati %.2f€", *b.due, b.paid)
+	if b.deposits > 0 {
+		s += fmt.Sprintf(" (di cui caparra %.2f€)", b.deposits)
+	}
+	switch rest := b.outstanding(); {
+	case rest > 0:
+		s += fmt.Sprintf(", da saldare %.2f€", rest)
+	case rest < 0:
+		s += fmt.Sprintf(", pagato in eccesso %.2f€", -rest)
+	default:
+		s += ", saldato"
+	}
+	return s
+}
+
+// ── record_payment ───────────────────────────────────────────────────────────
+
+type recordPaymentTool struct{}
+
+func (t *recordPaymentTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "record_payment",
+		Description: "Registra un pagamento ricevuto per una prenotazione (caparra, acconto, saldo; importo negativo per un rimborso) " +
+			"e restituisce quanto resta da saldare. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer", "description": "ID della prenotazione"},
+				"amount_eur": {"type": "number", "description": "Importo ricevuto (negativo per un rimborso)"},
+				"method": {"type": "string", "enum": ["cash", "card", "transfer", "ota", "other"], "description": "contanti, carta, bonifico, incassato dal portale, altro"},
+				"deposit": {"type": "boolean", "description": "È una caparra (default false)"},
+				"paid_on": {"type": "string", "description": "Data del pagamento YYYY-MM-DD (default oggi)"},
+				"note": {"type": "string", "description": "Riferimento (es. CRO del bonifico)"}
+			},
+			"required": ["reservation_id", "amount_eur", "method"]
+		}`),
+	}
+}
+
+func (t *recordPaymentTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64   `json:"reservation_id"`
+		AmountEUR     float64 `json:"amount_eur"`
+		Method        string  `json:"method"`
+		Deposit       bool    `json:"deposit"`
+		PaidOn        string  `json:"paid_on"`
+		Note          string  `json:"note"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.AmountEUR == 0 {
+		return "", fmt.Errorf("amount_eur must not be zero")
+	}
+	if _, ok := paymentMethods[in.Method]; !ok {
+		return "", fmt.Errorf("method must be one of cash, card, transfer, ota, other")
+	}
+	paidAt := time.Now()
+	if in.PaidOn != "" {
+		day, err := time.ParseInLocation("2006-01-02", in.PaidOn, romeLocation())
+		if err != nil {
+			return "", fmt.Errorf("paid_on must be YYYY-MM-DD: %w", err)
+		}
+		paidAt = day.Add(12 * time.Hour)
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("record_payment is only available to managers")
+	}
+	var status string
+	if err := db.QueryRow(bg, `SELECT status FROM reservations WHERE id = $1`, in.ReservationID).Scan(&status); err != nil {
+		return fmt.Sprintf("Prenotazione %d non trovata.", in.ReservationID), nil
+	}
+	if _, err := db.Exec(bg,
+		`INSERT INTO payments (reservation_id, amount_eur, method, is_deposit, paid_at, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)`,
+		in.ReservationID, in.AmountEUR, in.Method, in.Deposit, paidAt, in.Note, ctx.UserID,
+	); err != nil {
+		return "", fmt.Errorf("insert payment: %w", err)
+	}
+
+	kind := "Pagamento"
+	if in.Deposit {
+		kind = "Caparra"
+	}
+	if in.AmountEUR < 0 {
+		kind = "Rimborso"
+	}
+	msg := fmt.Sprintf("✅ %s di %.2f€ (%s) registrato sulla prenotazione %d.", kind, in.AmountEUR, paymentMethods[in.Method], in.ReservationID)
+	if status != "confirmed" {
+		return msg + fmt.Sprintf("\nAttenzione: la prenotazione è %s.", status), nil
+	}
+	balances, err := loadBalances(bg, db, `res.id = $1`, in.ReservationID)
+	if err != nil {
+		return "", fmt.Errorf("balance: %w", err)
+	}
+	if len(balances) == 1 {
+		msg += "\n" + balances[0].summary()
+	}
+	return msg, nil
+}
+
+// ── outstanding_balance ──────────────────────────────────────────────────────
+
+type outstandingBalanceTool struct{}
+
+func (t *outstandingBalanceTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "outstanding_balance",
+		Description: "Chi deve ancora pagare: prenotazioni confermate con saldo aperto che partono nel periodo indicato " +
+			"(default da oggi a 7 giorni), o il dettaglio dei pagamenti di una prenotazione. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"reservation_id": {"type": "integer", "description": "Dettaglio di una sola prenotazione"},
+				"from": {"type": "string", "description": "Partenze da questa data, YYYY-MM-DD (default oggi)"},
+				"to": {"type": "string", "description": "Partenze fino a questa data inclusa, YYYY-MM-DD (default da from a 7 giorni)"}
+			}
+		}`),
+	}
+}
+
+func (t *outstandingBalanceTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ReservationID int64  `json:"reservation_id"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("outstanding_balance is only available to managers")
+	}
+	loc := romeLocation()
+
+	if in.ReservationID != 0 {
+		balances, err := loadBalances(bg, db, `res.id = $1`, in.ReservationID)
+		if err != nil {
+			return "", err
+		}
+		if len(balances) == 0 {
+			return fmt.Sprintf("Nessuna prenotazione confermata con ID %d.", in.ReservationID), nil
+		}
+		var sb strings.Builder
+		sb.WriteString(balances[0].summary())
+		rows, err := db.Query(bg,
+			`SELECT paid_at, amount_eur::float8, method, is_deposit, COALESCE(note, '')
+			 FROM payments WHERE reservation_id = $1 ORDER BY paid_at, id`, in.ReservationID)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var at time.Time
+			var amount float64
+			var method, note string
+			var deposit bool
+			if err := rows.Scan(&at, &amount, &method, &deposit, &note); err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&sb, "\n• %s %.2f€ %s", at.In(loc).Format("02/01/2006"), amount, paymentMethods[method])
+			if deposit {
+				sb.WriteString(" (caparra)")
+			}
+			if note != "" {
+				sb.WriteString(" — " + note)
+			}
+		}
+		return sb.String(), rows.Err()
+	}
+
+	now := time.Now().In(loc)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if in.From != "" {
+		if from, err = time.ParseInLocation("2006-01-02", in.From, loc); err != nil {
+			return "", fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+		}
+	}
+	to := from.AddDate(0, 0, 7)
+	if in.To != "" {
+		if to, err = time.ParseInLocation("2006-01-02", in.To, loc); err != nil {
+			return "", fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+		}
+	}
+	balances, err := loadBalances(bg, db,
+		`(res.checkout_at AT TIME ZONE 'Europe/Rome')::date BETWEEN $1 AND $2`, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	var open, unknown []reservationBalance
+	var total float64
+	for _, b := range balances {
+		switch {
+		case b.due == nil:
+			unknown = append(unknown, b)
+		case b.outstanding() > 0:
+			open = append(open, b)
+			total += b.outstanding()
+		}
+	}
+	period := from.Format("02/01") + " – " + to.Format("02/01")
+	if len(open) == 0 && len(unknown) == 0 {
+		return fmt.Sprintf("Tutte le %d prenotazioni in partenza %s risultano saldate.", len(balances), period), nil
+	}
+	var sb strings.Builder
+	if len(open) > 0 {
+		fmt.Fprintf(&sb, "💶 Da incassare, partenze %s: %.2f€\n", period, total)
+		for _, b := range open {
+			sb.WriteString("• " + b.summary() + "\n")
+		}
+	} else {
+		fmt.Fprintf(&sb, "Nessun saldo aperto per le partenze %s.\n", period)
+	}
+	if len(unknown) > 0 {
+		sb.WriteString("⚠️ Senza totale (indica amount_eur):\n")
+		for _, b := range unknown {
+			sb.WriteString("• " + b.summary() + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
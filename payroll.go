@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// ── payroll_export ───────────────────────────────────────────────────────────
+//
+// Monthly hours for the accountant, one CSV row per staff member: days and
+// hours worked (same measure as hours.go, so clocked time where there is
+// any), how many of those days were clocked, contracted hours, overtime, and
+// the sick and leave days from staff_absences. Overtime is counted week by
+// week against users.weekly_hours, so a busy week is not offset by a quiet
+// one; the weeks cut by the start or end of the month get the contract
+// prorated to their days in the month.
+
+type payrollExportTool struct {
+	botToken string
+}
+
+func (t *payrollExportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "payroll_export",
+		Description: "Presenze del mese per le buste paga: per dipendente giorni e ore lavorate, ore da contratto, " +
+			"straordinario e giorni di malattia e ferie. Invia in chat il CSV per il commercialista e restituisce il riepilogo. " +
+			"Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {
+					"type": "string",
+					"description": "Mese nel formato YYYY-MM (default: mese precedente)"
+				}
+			}
+		}`),
+	}
+}
+
+type payrollRow struct {
+	id               int64
+	name, role       string
+	weekly           float64
+	days, clocked    int
+	worked, contract float64
+	overtime         float64
+	sick, leave      int
+}
+
+func (t *payrollExportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("payroll_export is only available to managers")
+	}
+	var in struct {
+		Month string `json:"month"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		start, err = time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+
+	staff := make(map[int64]*payrollRow)
+	rows, err := db.Query(bg,
+		`SELECT telegram_id, COALESCE(name, telegram_id::text), role, COALESCE(weekly_hours, 0)::float8 FROM users`)
+	if err != nil {
+		return "", fmt.Errorf("query staff: %w", err)
+	}
+	for rows.Next() {
+		r := &payrollRow{}
+		if err := rows.Scan(&r.id, &r.name, &r.role, &r.weekly); err != nil {
+			rows.Close()
+			return "", err
+		}
+		staff[r.id] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	// Hours per day, summed per week segment for the overtime.
+	type segment struct {
+		id     int64
+		monday time.Time
+	}
+	weeks := make(map[segment]float64)
+	rows, err = db.Query(bg, workedDaysCTE+`SELECT cleaner_id, day, hours::float8, clocked FROM days`, start, end)
+	if err != nil {
+		return "", fmt.Errorf("query hours: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var day time.Time
+		var hours float64
+		var clocked bool
+		if err := rows.Scan(&id, &day, &hours, &clocked); err != nil {
+			rows.Close()
+			return "", err
+		}
+		r := staff[id]
+		if r == nil {
+			continue
+		}
+		r.days++
+		if clocked {
+			r.clocked++
+		}
+		r.worked += hours
+		weeks[segment{id, weekStart(day)}] += hours
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	rows, err = db.Query(bg,
+		`SELECT ab.user_id,
+		        count(DISTINCT d) FILTER (WHERE ab.reason = 'sick')::int,
+		        count(DISTINCT d) FILTER (WHERE ab.reason = 'leave')::int
+		 FROM staff_absences ab
+		 CROSS JOIN LATERAL generate_series(GREATEST(ab.from_date, $1::date), LEAST(ab.to_date, $2::date - 1), interval '1 day') d
+		 WHERE ab.status = 'approved' AND ab.from_date < $2::date AND ab.to_date >= $1::date
+		 GROUP BY ab.user_id`,
+		start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return "", fmt.Errorf("query absences: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var sick, leave int
+		if err := rows.Scan(&id, &sick, &leave); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if r := staff[id]; r != nil {
+			r.sick, r.leave = sick, leave
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	// Contract and overtime, week segment by week segment.
+	for _, r := range staff {
+		if r.weekly == 0 {
+			continue
+		}
+		for monday := weekStart(start); monday.Before(end); monday = monday.AddDate(0, 0, 7) {
+			from, to := monday, monday.AddDate(0, 0, 7)
+			if from.Before(start) {
+				from = start
+			}
+			if to.After(end) {
+				to = end
+			}
+			days := math.Round(to.Sub(from).Hours() / 24)
+			contract := r.weekly * days / 7
+			r.contract += contract
+			key := segment{r.id, time.Date(monday.Year(), monday.Month(), monday.Day(), 0, 0, 0, 0, time.UTC)}
+			if over := weeks[key] - contract; over > 0 {
+				r.overtime += over
+			}
+		}
+	}
+
+	var list []*payrollRow
+	for _, r := range staff {
+		if r.role == string(RoleCleaner) || r.days > 0 || r.sick > 0 || r.leave > 0 {
+			list = append(list, r)
+		}
+	}
+	month := start.Format("01/2006")
+	if len(list) == 0 {
+		return fmt.Sprintf("Nessun dipendente con ore o assenze nel mese %s.", month), nil
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+
+	var csv strings.Builder
+	csv.WriteString("dipendente;telegram_id;ruolo;giorni_lavorati;giorni_timbrati;ore_lavorate;ore_contratto;ore_straordinario;giorni_malattia;giorni_ferie\n")
+	var worked, overtime float64
+	var sick, leave int
+	for _, r := range list {
+		fmt.Fprintf(&csv, "%s;%d;%s;%d;%d;%.2f;%.2f;%.2f;%d;%d\n",
+			strings.ReplaceAll(r.name, ";", ","), r.id, r.role, r.days, r.clocked, r.worked, r.contract, r.overtime, r.sick, r.leave)
+		worked += r.worked
+		overtime += r.overtime
+		sick += r.sick
+		leave += r.leave
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Presenze %s (%d dipendenti):\n", month, len(list))
+	fmt.Fprintf(&sb, "  ore lavorate: %s\n", formatHours(worked))
+	fmt.Fprintf(&sb, "  straordinario: %s\n", formatHours(overtime))
+	fmt.Fprintf(&sb, "  giorni di malattia: %d, di ferie: %d\n", sick, leave)
+	name := "presenze_" + start.Format("200601") + ".csv"
+	if err := sendDocument(bg, t.botToken, ctx.ChatID, name, []byte(csv.String()),
+		"Presenze "+month+" per dipendente"); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	fmt.Fprintf(&sb, "📄 Dettaglio per dipendente inviato in chat (%s).", name)
+	return sb.String(), nil
+}
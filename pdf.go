@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A minimal PDF writer for generated documents (invoices): A4 pages of text
+// and rules in the standard Helvetica and Courier fonts, which every viewer
+// has built in, so no font is embedded and no dependency is needed. Text is
+// encoded as WinAnsi, which covers Italian accents and the euro sign; other
+// characters print as "?".
+
+const (
+	pdfPageWidth  = 595.0 // A4 in points
+	pdfPageHeight = 842.0
+)
+
+type pdfFont string
+
+const (
+	pdfRegular pdfFont = "F1" // Helvetica
+	pdfBold    pdfFont = "F2" // Helvetica-Bold
+	pdfMono    pdfFont = "F3" // Courier, for aligned columns
+)
+
+type pdfDoc struct {
+	pages []*bytes.Buffer
+}
+
+// page returns the content stream of the current page, starting the first
+// one if needed.
+func (d *pdfDoc) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+func (d *pdfDoc) AddPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+// Text writes s with its baseline starting at (x, y), y measured from the
+// bottom of the page.
+func (d *pdfDoc) Text(x, y float64, font pdfFont, size float64, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// TextRight writes s in Courier so that it ends at x.
+func (d *pdfDoc) TextRight(x, y, size float64, s string) {
+	width := 0.6 * size * float64(len([]rune(s)))
+	d.Text(x-width, y, pdfMono, size, s)
+}
+
+// Line draws a thin rule from (x1, y1) to (x2, y2).
+func (d *pdfDoc) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// Bytes serializes the document.
+func (d *pdfDoc) Bytes() []byte {
+	d.page()
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 page tree, 3-5 fonts, then a page and its content per page.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for _, base := range []string{"Helvetica", "Helvetica-Bold", "Courier"} {
+		obj("<< /Type /Font /Subtype /Type1 /BaseFont /" + base + " /Encoding /WinAnsiEncoding >>")
+	}
+	for i, content := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfWinAnsi maps the characters outside Latin-1 that WinAnsi places in
+// 0x80-0x9F.
+var pdfWinAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// pdfString encodes s as the body of a PDF literal string.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case pdfWinAnsi[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", pdfWinAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
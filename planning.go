@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Planner is the guided weekly planning mode a manager enters with /plan.
+// It is a small state machine persisted in planning_sessions:
+//
+//	day 0 … day 6   show arrivals/departures + proposed assignments for the day
+//	                ("plan:next" accepts and advances; the manager can also ask
+//	                the LLM to tweak the draft via the plan_adjust tool)
+//	day 7 (review)  full summary; "plan:commit" inserts every drafted
+//	                assignment in a single transaction
+//	any             "plan:cancel" discards the session
+//
+// Each step is also injected into the manager's context so free-text requests
+// ("metti Maria sulla 101") have the draft in view.
+type Planner struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	assigner  *AutoAssigner
+	injector  agent.ContextInjector // set after the agent is built
+	contexts  *chatContexts         // conversation keys of group chats
+}
+
+func newPlanner(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string, assigner *AutoAssigner) *Planner {
+	return &Planner{adminPool: adminPool, registry: registry, botToken: botToken, assigner: assigner}
+}
+
+// planEntry is one drafted assignment.
+type planEntry struct {
+	Date        string `json:"date"` // YYYY-MM-DD
+	RoomID      int64  `json:"room_id"`
+	RoomName    string `json:"room_name"`
+	CleanerID   int64  `json:"cleaner_id"`
+	CleanerName string `json:"cleaner_name"`
+	Type        string `json:"type"`
+	Shift       string `json:"shift"`
+	Minutes     int    `json:"minutes,omitempty"` // estimated effort (AutoAssigner.estimate)
+}
+
+type planSession struct {
+	managerID int64
+	weekStart time.Time
+	day       int // 0–6 = reviewing that day, 7 = final review
+	draft     []planEntry
+}
+
+// Register wires /plan and the plan:* buttons into the messenger.
+func (p *Planner) Register(m *routedMessenger) {
+	m.Handle("/plan", p.handleCommand)
+	m.Handle("plan:", p.handleCallback)
+}
+
+// Tools implements agent.ToolSet.
+func (p *Planner) Tools() []agent.Tool {
+	return []agent.Tool{&planAdjustTool{planner: p}}
+}
+
+func (p *Planner) isManager(ctx context.Context, userID int64) bool {
+	var role string
+	_ = p.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, userID).Scan(&role)
+	return Role(role) == RoleManager
+}
+
+func (p *Planner) handleCommand(ctx context.Context, u agent.Update) error {
+	if !p.isManager(ctx, u.UserID) {
+		return newBot(p.botToken).Send(ctx, u.ChatID, "🔒 La pianificazione settimanale è riservata ai manager.")
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	daysUntilMonday := (8 - int(now.Weekday())) % 7
+	if daysUntilMonday == 0 {
+		daysUntilMonday = 7
+	}
+	monday := time.Date(now.Year(), now.Month(), now.Day()+daysUntilMonday, 0, 0, 0, 0, loc)
+
+	hotelID, err := hotelOf(ctx, p.adminPool, u.UserID)
+	if err != nil {
+		return err
+	}
+	draft, err := p.propose(ctx, monday, hotelID)
+	if err != nil {
+		return fmt.Errorf("propose: %w", err)
+	}
+	s := &planSession{managerID: u.UserID, weekStart: monday, draft: draft}
+	if err := p.save(ctx, s); err != nil {
+		return err
+	}
+	log.Printf("planning: session started by %d for week of %s (%d proposed)", u.UserID, monday.Format("2006-01-02"), len(draft))
+	return p.showStep(ctx, u.ChatID, s)
+}
+
+func (p *Planner) handleCallback(ctx context.Context, u agent.Update) error {
+	if !p.isManager(ctx, u.UserID) {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	s, err := p.load(ctx, u.UserID)
+	if err != nil {
+		return newBot(p.botToken).Send(ctx, u.ChatID, "Nessuna pianificazione in corso. Scrivi /plan per iniziare.")
+	}
+
+	switch strings.TrimPrefix(u.Text, "plan:") {
+	case "next":
+		if s.day < 7 {
+			s.day++
+		}
+		if err := p.save(ctx, s); err != nil {
+			return err
+		}
+		return p.showStep(ctx, u.ChatID, s)
+	case "commit":
+		n, err := p.commit(ctx, s)
+		if err != nil {
+			return newBot(p.botToken).Send(ctx, u.ChatID,
+				fmt.Sprintf("❌ Piano non salvato, nessuna modifica applicata: %v", err))
+		}
+		p.note(s.managerID, u.ChatID, fmt.Sprintf("[planning] Piano della settimana dal %s confermato: %d assegnazioni create.",
+			s.weekStart.Format("02/01"), n))
+		return newBot(p.botToken).Send(ctx, u.ChatID,
+			fmt.Sprintf("💾 Piano salvato: %d assegnazioni create per la settimana dal %s.", n, s.weekStart.Format("02/01")))
+	case "cancel":
+		_, _ = p.adminPool.Exec(ctx, `DELETE FROM planning_sessions WHERE manager_id = $1`, u.UserID)
+		p.note(s.managerID, u.ChatID, "[planning] Pianificazione annullata.")
+		return newBot(p.botToken).Send(ctx, u.ChatID, "Pianificazione annullata, nessuna modifica salvata.")
+	}
+	return fmt.Errorf("unknown planning action %q", u.Text)
+}
+
+// propose drafts the week's assignments of property hotelID, one day at a
+// time with the same balancing engine as generate_daily_plan (assignments.go).
+func (p *Planner) propose(ctx context.Context, monday time.Time, hotelID int) ([]planEntry, error) {
+	var draft []planEntry
+	for i := 0; i < 7; i++ {
+		day, err := p.assigner.propose(ctx, monday.AddDate(0, 0, i), hotelID)
+		if err != nil {
+			return nil, err
+		}
+		draft = append(draft, day...)
+	}
+	return draft, nil
+}
+
+// showStep sends the current step (a day, or the final review) with buttons.
+func (p *Planner) showStep(ctx context.Context, chatID int64, s *planSession) error {
+	var sb strings.Builder
+	var buttons []telegram.Button
+	if s.day < 7 {
+		day := s.weekStart.AddDate(0, 0, s.day)
+		key := day.Format("2006-01-02")
+		fmt.Fprintf(&sb, "🗓 <b>Pianificazione %d/7 — %s %s</b>\n\n", s.day+1, italianWeekday(day.Weekday()), day.Format("02/01"))
+		sb.WriteString(p.dayMovements(ctx, s.managerID, day))
+		sb.WriteString("\n<b>Assegnazioni proposte:</b>\n")
+		writeDraftDay(&sb, s.draft, key)
+		sb.WriteString("\nPuoi chiedermi modifiche a parole (es. <i>metti Maria sulla 101</i>).")
+		buttons = []telegram.Button{
+			{Text: "✅ Ok, avanti", CallbackData: "plan:next"},
+			{Text: "❌ Annulla", CallbackData: "plan:cancel"},
+		}
+	} else {
+		fmt.Fprintf(&sb, "📋 <b>Riepilogo settimana dal %s</b>\n", s.weekStart.Format("02/01"))
+		for i := 0; i < 7; i++ {
+			day := s.weekStart.AddDate(0, 0, i)
+			fmt.Fprintf(&sb, "\n<b>%s %s</b>\n", italianWeekday(day.Weekday()), day.Format("02/01"))
+			writeDraftDay(&sb, s.draft, day.Format("2006-01-02"))
+		}
+		sb.WriteString("\nConfermi? Tutte le assegnazioni vengono salvate insieme.")
+		buttons = []telegram.Button{
+			{Text: "💾 Conferma piano", CallbackData: "plan:commit"},
+			{Text: "❌ Annulla", CallbackData: "plan:cancel"},
+		}
+	}
+	text := sb.String()
+	p.note(s.managerID, chatID, "[planning] "+stripTags(text))
+	_, err := sendKeyboard(ctx, p.botToken, chatID, text, [][]telegram.Button{buttons})
+	return err
+}
+
+// dayMovements lists day's arrivals and departures at the manager's property.
+func (p *Planner) dayMovements(ctx context.Context, managerID int64, day time.Time) string {
+	hotelID, err := hotelOf(ctx, p.adminPool, managerID)
+	if err != nil {
+		return "(movimenti non disponibili)\n"
+	}
+	rows, err := p.adminPool.Query(ctx,
+		`SELECT r.name, COALESCE(res.guest_name, ''),
+		        (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1::date AS arriving
+		 FROM reservations res JOIN rooms r ON r.id = res.room_id
+		 WHERE res.status = 'confirmed' AND res.hotel_id = $2
+		   AND ((res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1::date
+		     OR (res.checkout_at AT TIME ZONE 'Europe/Rome')::date = $1::date)
+		 ORDER BY arriving, r.name`, day, hotelID,
+	)
+	if err != nil {
+		return "(movimenti non disponibili)\n"
+	}
+	defer rows.Close()
+	var arr, dep []string
+	for rows.Next() {
+		var room, guest string
+		var arriving bool
+		if err := rows.Scan(&room, &guest, &arriving); err != nil {
+			continue
+		}
+		item := room
+		if guest != "" {
+			item += " (" + guest + ")"
+		}
+		if arriving {
+			arr = append(arr, item)
+		} else {
+			dep = append(dep, item)
+		}
+	}
+	return fmt.Sprintf("🛬 Arrivi: %s\n🛫 Partenze: %s\n", joinOrDash(arr), joinOrDash(dep))
+}
+
+func writeDraftDay(sb *strings.Builder, draft []planEntry, date string) {
+	found := false
+	for _, e := range draft {
+		if e.Date == date {
+			fmt.Fprintf(sb, "  • %s — %s (%s, %s)\n", e.RoomName, e.CleanerName, e.Type, e.Shift)
+			found = true
+		}
+	}
+	if !found {
+		sb.WriteString("  —\n")
+	}
+}
+
+func joinOrDash(items []string) string {
+	if len(items) == 0 {
+		return "—"
+	}
+	return strings.Join(items, ", ")
+}
+
+// stripTags removes the few HTML tags used in planning messages, for the
+// plain-text copy injected into the manager's context.
+func stripTags(s string) string {
+	return strings.NewReplacer("<b>", "", "</b>", "", "<i>", "", "</i>", "").Replace(s)
+}
+
+// commit inserts the whole draft in one transaction, as the manager (so RLS
+// applies), then closes the session. Any failure rolls everything back.
+func (p *Planner) commit(ctx context.Context, s *planSession) (int, error) {
+	db, err := p.registry.Pool(ctx, s.managerID)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		for _, e := range s.draft {
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO assignments (room_id, cleaner_id, date, shift, type)
+				 VALUES ($1, $2, $3, $4, $5)`,
+				e.RoomID, e.CleanerID, e.Date, e.Shift, e.Type,
+			); err != nil {
+				return fmt.Errorf("camera %s del %s: %w", e.RoomName, e.Date, err)
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	_, _ = p.adminPool.Exec(ctx, `DELETE FROM planning_sessions WHERE manager_id = $1`, s.managerID)
+	log.Printf("planning: committed %d assignment(s) for manager %d", n, s.managerID)
+	return n, nil
+}
+
+// note adds text to the manager's conversation in chatID, so plan_adjust
+// calls there see the current step.
+func (p *Planner) note(managerID, chatID int64, text string) {
+	if p.injector != nil {
+		key := managerID
+		if p.contexts != nil {
+			key = p.contexts.Key(managerID, chatID)
+		}
+		p.injector.Inject(key, llm.Message{
+			Role:    "assistant",
+			Content: []llm.ContentBlock{{Type: "text", Text: text}},
+		})
+	}
+}
+
+func (p *Planner) save(ctx context.Context, s *planSession) error {
+	draft, err := json.Marshal(s.draft)
+	if err != nil {
+		return err
+	}
+	_, err = p.adminPool.Exec(ctx,
+		`INSERT INTO planning_sessions (manager_id, week_start, day_index, draft)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (manager_id) DO UPDATE SET week_start = $2, day_index = $3, draft = $4, updated_at = now()`,
+		s.managerID, s.weekStart, s.day, draft,
+	)
+	if err != nil {
+		return fmt.Errorf("save planning session: %w", err)
+	}
+	return nil
+}
+
+func (p *Planner) load(ctx context.Context, managerID int64) (*planSession, error) {
+	s := &planSession{managerID: managerID}
+	var draft []byte
+	err := p.adminPool.QueryRow(ctx,
+		`SELECT week_start, day_index, draft FROM planning_sessions WHERE manager_id = $1`, managerID,
+	).Scan(&s.weekStart, &s.day, &draft)
+	if err != nil {
+		return nil, err
+	}
+	s.weekStart = time.Date(s.weekStart.Year(), s.weekStart.Month(), s.weekStart.Day(), 0, 0, 0, 0, romeLocation())
+	if err := json.Unmarshal(draft, &s.draft); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ── plan_adjust ──────────────────────────────────────────────────────────────
+
+type planAdjustTool struct {
+	planner *Planner
+}
+
+func (t *planAdjustTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "plan_adjust",
+		Description: "Modifica la bozza della pianificazione settimanale in corso (/plan). " +
+			"Aggiunge o rimuove un'assegnazione proposta; nulla viene salvato finché il manager non conferma il piano. " +
+			"Solo per i manager con una pianificazione attiva.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"action": {"type": "string", "enum": ["add", "remove"]},
+				"date": {"type": "string", "description": "Giorno, formato YYYY-MM-DD"},
+				"room": {"type": "string", "description": "Nome della camera"},
+				"cleaner": {"type": "string", "description": "Nome dell'addetto/a (richiesto per add; per remove limita la rimozione)"},
+				"type": {"type": "string", "enum": ["checkout", "stayover"], "description": "Default: checkout"},
+				"shift": {"type": "string", "enum": ["morning", "afternoon", "evening"], "description": "Default: morning"}
+			},
+			"required": ["action", "date", "room"]
+		}`),
+	}
+}
+
+func (t *planAdjustTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Action  string `json:"action"`
+		Date    string `json:"date"`
+		Room    string `json:"room"`
+		Cleaner string `json:"cleaner"`
+		Type    string `json:"type"`
+		Shift   string `json:"shift"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	s, err := t.planner.load(bg, ctx.UserID)
+	if err != nil {
+		return "", fmt.Errorf("nessuna pianificazione attiva: il manager deve prima scrivere /plan")
+	}
+	if _, err := time.Parse("2006-01-02", in.Date); err != nil {
+		return "", fmt.Errorf("invalid date %q, use YYYY-MM-DD", in.Date)
+	}
+
+	switch in.Action {
+	case "add":
+		// Looked up as the manager, so only their own property's rooms and
+		// staff match (room names are unique per property only).
+		db, err := t.planner.registry.Pool(bg, ctx.UserID)
+		if err != nil {
+			return "", err
+		}
+		var e planEntry
+		if err := db.QueryRow(bg,
+			`SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, in.Room,
+		).Scan(&e.RoomID, &e.RoomName); err != nil {
+			return "", fmt.Errorf("camera '%s' non trovata", in.Room)
+		}
+		if err := db.QueryRow(bg,
+			`SELECT telegram_id, name FROM users WHERE role = 'cleaner' AND lower(name) = lower($1)`, in.Cleaner,
+		).Scan(&e.CleanerID, &e.CleanerName); err != nil {
+			return "", fmt.Errorf("addetto/a alle pulizie '%s' non trovato/a", in.Cleaner)
+		}
+		e.Date, e.Type, e.Shift = in.Date, in.Type, in.Shift
+		if e.Type == "" {
+			e.Type = "checkout"
+		}
+		if e.Shift == "" {
+			e.Shift = "morning"
+		}
+		s.draft = append(s.draft, e)
+	case "remove":
+		kept := s.draft[:0]
+		removed := 0
+		for _, e := range s.draft {
+			match := e.Date == in.Date && strings.EqualFold(e.RoomName, in.Room) &&
+				(in.Cleaner == "" || strings.EqualFold(e.CleanerName, in.Cleaner))
+			if match {
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if removed == 0 {
+			return "Nessuna assegnazione corrispondente nella bozza.", nil
+		}
+		s.draft = kept
+	default:
+		return "", fmt.Errorf("invalid action: %s", in.Action)
+	}
+
+	if err := t.planner.save(bg, s); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Bozza aggiornata. %s:\n", in.Date)
+	writeDraftDay(&sb, s.draft, in.Date)
+	return sb.String(), nil
+}
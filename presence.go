@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// presenceTracker keeps users.last_seen_at: the last time each user wrote to
+// the bot or pressed one of its buttons. It is shown by staff_directory and
+// shortens the acceptance window of cleaners who have not opened Telegram
+// today (acceptance.go).
+type presenceTracker struct {
+	adminPool *pgxpool.Pool
+
+	mu      sync.Mutex
+	written map[int64]time.Time // userID → last stamp written
+}
+
+func newPresenceTracker(adminPool *pgxpool.Pool) *presenceTracker {
+	return &presenceTracker{adminPool: adminPool, written: make(map[int64]time.Time)}
+}
+
+// presenceResolution is how stale last_seen_at may get: a burst of messages
+// costs one UPDATE.
+const presenceResolution = time.Minute
+
+// Seen implements the routedMessenger ObserveAll observer.
+func (p *presenceTracker) Seen(ctx context.Context, u agent.Update) {
+	if u.UserID == 0 {
+		return
+	}
+	now := time.Now()
+	p.mu.Lock()
+	if now.Sub(p.written[u.UserID]) < presenceResolution {
+		p.mu.Unlock()
+		return
+	}
+	p.written[u.UserID] = now
+	p.mu.Unlock()
+	if _, err := p.adminPool.Exec(ctx,
+		`UPDATE users SET last_seen_at = now() WHERE telegram_id = $1`, u.UserID); err != nil {
+		log.Printf("presence: user %d: %v", u.UserID, err)
+	}
+}
+
+// lastSeenLabel describes a last_seen_at for staff: "mai", "adesso",
+// "oggi 09:12", "ieri 18:30", "lun 14/10" within a week, else "14/10/2026".
+func lastSeenLabel(seen *time.Time, now time.Time) string {
+	if seen == nil {
+		return "mai"
+	}
+	loc := romeLocation()
+	t, now := seen.In(loc), now.In(loc)
+	if now.Sub(t) < 5*time.Minute {
+		return "adesso"
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case !t.Before(today):
+		return "oggi " + t.Format("15:04")
+	case !t.Before(today.AddDate(0, 0, -1)):
+		return "ieri " + t.Format("15:04")
+	case !t.Before(today.AddDate(0, 0, -6)):
+		return strings.ToLower(italianWeekday(t.Weekday())[:3]) + " " + t.Format("02/01")
+	}
+	return t.Format("02/01/2006")
+}
+
+// ── staff_directory ──────────────────────────────────────────────────────────
+
+type staffDirectoryTool struct{}
+
+func (t *staffDirectoryTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "staff_directory",
+		Description: "Elenco del personale della struttura: ruolo, lingua, turno di oggi e ultimo accesso al bot " +
+			"(«visto oggi 09:12», «mai»). Utile per capire chi è raggiungibile prima di scrivergli.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"role": {"type": "string", "enum": ["manager", "cleaner"], "description": "Solo questo ruolo (default tutti)"}
+			}
+		}`),
+	}
+}
+
+func (t *staffDirectoryTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Role string `json:"role"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	rows, err := db.Query(context.Background(),
+		`SELECT COALESCE(u.name, u.telegram_id::text), u.role, u.language, u.last_seen_at, s.name,
+		        COALESCE(u.unreachable_reason, '')
+		 FROM users u
+		 LEFT JOIN shift_assignments sa ON sa.user_id = u.telegram_id AND sa.date = $1::date
+		 LEFT JOIN shifts s ON s.id = sa.shift_id
+		 WHERE u.role <> 'guest' AND ($2 = '' OR u.role = $2)
+		 ORDER BY u.role DESC, u.last_seen_at DESC NULLS LAST, u.name`,
+		now.In(romeLocation()).Format("2006-01-02"), in.Role)
+	if err != nil {
+		return "", fmt.Errorf("query staff: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	n := 0
+	for rows.Next() {
+		var name, role, language string
+		var seen *time.Time
+		var shift *string
+		var unreachable string
+		if err := rows.Scan(&name, &role, &language, &seen, &shift, &unreachable); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n• %s — %s, %s", name, role, language)
+		if shift != nil {
+			fmt.Fprintf(&sb, ", oggi di turno %s", shiftNames[*shift])
+		}
+		fmt.Fprintf(&sb, "; visto %s", lastSeenLabel(seen, now))
+		switch sendFailure(unreachable) {
+		case failureBlocked:
+			sb.WriteString(" — ⛔ ha bloccato il bot: non riceve messaggi finché non scrive")
+		case failureNotFound:
+			sb.WriteString(" — ⛔ chat non trovata: non riceve messaggi finché non scrive al bot")
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "Nessun membro del personale trovato.", nil
+	}
+	return fmt.Sprintf("👥 Personale (%d):", n) + sb.String(), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Prompt schema drift. The live schema reaches the model through the
+// {{.Schema}} placeholder, but the prompt prose names tables and columns too
+// ("users.weekly_hours", "the keys table (label, kind, room_id, active)"), and
+// a prompt edited by hand may carry a pasted copy of the schema instead of
+// the placeholder. Both go stale silently and the model writes SQL against
+// columns that no longer exist. checkPromptSchema runs at startup: it logs
+// every reference the live schema does not have, and puts {{.Schema}} back in
+// a stored prompt whose "## Database schema" section lost it.
+
+// promptSchemaHeading is the section the templates end with.
+const promptSchemaHeading = "## Database schema"
+
+// schemaRef is a table (column empty) or a table column named in a prompt.
+type schemaRef struct {
+	table, column string
+}
+
+func (r schemaRef) String() string {
+	if r.column == "" {
+		return r.table
+	}
+	return r.table + "." + r.column
+}
+
+var (
+	// "users.weekly_hours"; the left side only counts when it is a table.
+	dottedRef = regexp.MustCompile(`\b([a-z][a-z0-9_]*)\.([a-z][a-z0-9_]*)\b`)
+	// "the keys table (label, kind, room_id, active)", "the shifts table".
+	tableRef = regexp.MustCompile(`\b[Tt]he ([a-z][a-z0-9_]*) table\b(?: \(([^)]*)\))?`)
+	// A column in a table's list: a bare identifier, not prose.
+	identifier = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// fileSuffixes keep "shifts.go" or "schema.sql" from reading as columns.
+var fileSuffixes = map[string]bool{"go": true, "sql": true, "md": true, "csv": true, "xlsx": true, "pdf": true, "json": true}
+
+// promptSchemaRefs returns the tables and columns text refers to. tables is
+// the set of live table names: a dotted reference only counts when its left
+// side is one, since "e.g" or an SQL alias look the same.
+func promptSchemaRefs(text string, tables map[string]map[string]bool) []schemaRef {
+	var refs []schemaRef
+	seen := make(map[schemaRef]bool)
+	add := func(r schemaRef) {
+		if !seen[r] {
+			seen[r] = true
+			refs = append(refs, r)
+		}
+	}
+	for _, m := range tableRef.FindAllStringSubmatch(text, -1) {
+		add(schemaRef{table: m[1]})
+		for _, col := range strings.Split(m[2], ",") {
+			if col = strings.TrimSpace(col); identifier.MatchString(col) {
+				add(schemaRef{table: m[1], column: col})
+			}
+		}
+	}
+	for _, m := range dottedRef.FindAllStringSubmatch(text, -1) {
+		if _, ok := tables[m[1]]; ok && !fileSuffixes[m[2]] {
+			add(schemaRef{table: m[1], column: m[2]})
+		}
+	}
+	return refs
+}
+
+// staleSchemaRefs returns the refs the live schema does not have.
+func staleSchemaRefs(refs []schemaRef, tables map[string]map[string]bool) []string {
+	var out []string
+	for _, r := range refs {
+		cols, ok := tables[r.table]
+		if !ok {
+			if r.column == "" {
+				out = append(out, r.String()+" (no such table)")
+			}
+			continue
+		}
+		if r.column != "" && !cols[r.column] {
+			out = append(out, r.String())
+		}
+	}
+	return out
+}
+
+// restoreSchemaSection replaces the body of a template's "## Database
+// schema" section — up to the next "## " heading — with {{.Schema}} when the
+// placeholder is missing from the template. ok is false when there is
+// nothing to fix.
+func restoreSchemaSection(tmpl string) (string, bool) {
+	if strings.Contains(tmpl, "{{.Schema}}") {
+		return tmpl, false
+	}
+	i := strings.Index(tmpl, promptSchemaHeading)
+	if i < 0 {
+		return tmpl, false
+	}
+	body := i + len(promptSchemaHeading)
+	end := len(tmpl)
+	if j := strings.Index(tmpl[body:], "\n## "); j >= 0 {
+		end = body + j
+	}
+	return tmpl[:body] + "\n{{.Schema}}" + tmpl[end:], true
+}
+
+// liveTables returns the columns of every public table.
+func liveTables(ctx context.Context, pool *pgxpool.Pool) (map[string]map[string]bool, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = 'public'`)
+	if err != nil {
+		return nil, fmt.Errorf("query columns: %w", err)
+	}
+	defer rows.Close()
+	tables := make(map[string]map[string]bool)
+	for rows.Next() {
+		var t, c string
+		if err := rows.Scan(&t, &c); err != nil {
+			return nil, err
+		}
+		if tables[t] == nil {
+			tables[t] = make(map[string]bool)
+		}
+		tables[t][c] = true
+	}
+	return tables, rows.Err()
+}
+
+// checkPromptSchema compares the stored prompts and the built-in defaults
+// with the live schema and logs what has drifted; see the top of the file.
+func checkPromptSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	tables, err := liveTables(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	type prompt struct{ label, role, text string }
+	var prompts []prompt
+	rows, err := pool.Query(ctx, `SELECT role, template FROM prompts ORDER BY role`)
+	if err != nil {
+		return fmt.Errorf("query prompts: %w", err)
+	}
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var p prompt
+		if err := rows.Scan(&p.role, &p.text); err != nil {
+			rows.Close()
+			return err
+		}
+		p.label = "prompts." + p.role
+		stored[p.text] = true
+		prompts = append(prompts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, role := range []Role{RoleManager, RoleCleaner, RoleGuest} {
+		if text := defaultTemplate(role); !stored[text] {
+			prompts = append(prompts, prompt{label: "default " + string(role), text: text})
+		}
+	}
+
+	for _, p := range prompts {
+		if stale := staleSchemaRefs(promptSchemaRefs(p.text, tables), tables); len(stale) > 0 {
+			log.Printf("prompt schema: %s names what the database does not have: %s", p.label, strings.Join(stale, ", "))
+		}
+		if p.role == "" {
+			continue
+		}
+		fixed, ok := restoreSchemaSection(p.text)
+		if !ok {
+			continue
+		}
+		if _, err := pool.Exec(ctx,
+			`UPDATE prompts SET template = $2, updated_at = now() WHERE role = $1 AND template = $3`, p.role, fixed, p.text); err != nil {
+			return fmt.Errorf("restore schema section of %s: %w", p.label, err)
+		}
+		log.Printf("prompt schema: %s had a pasted schema section, replaced with the live {{.Schema}}", p.label)
+	}
+	return nil
+}
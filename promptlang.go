@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// promptTranslator serves each user the system prompt in their language
+// (users.language). The prompts table keeps a single canonical template per
+// role, written in English; translations are generated once with the LLM and
+// cached in prompt_translations, keyed by a hash of the canonical text so an
+// edit to the template invalidates them. Until a translation exists (it is
+// generated in the background) the canonical template is used as is.
+type promptTranslator struct {
+	adminPool *pgxpool.Pool
+	llm       *llm.Client
+
+	mu       sync.Mutex
+	inflight map[string]bool // role/language being generated
+}
+
+func newPromptTranslator(adminPool *pgxpool.Pool, client *llm.Client) *promptTranslator {
+	return &promptTranslator{adminPool: adminPool, llm: client, inflight: make(map[string]bool)}
+}
+
+// canonicalLanguage is the language the templates in prompts are written in.
+const canonicalLanguage = "English"
+
+// Localize returns canonical translated into language, or canonical itself
+// while no up-to-date translation is available.
+func (p *promptTranslator) Localize(ctx context.Context, role, language, canonical string) string {
+	if language == "" || strings.EqualFold(language, canonicalLanguage) {
+		return canonical
+	}
+	hash := promptHash(canonical)
+	var translated string
+	err := p.adminPool.QueryRow(ctx,
+		`SELECT template FROM prompt_translations WHERE role = $1 AND language = $2 AND source_hash = $3`,
+		role, language, hash,
+	).Scan(&translated)
+	if err == nil && translated != "" {
+		return translated
+	}
+
+	key := role + "/" + language
+	p.mu.Lock()
+	busy := p.inflight[key]
+	p.inflight[key] = true
+	p.mu.Unlock()
+	if !busy {
+		go func() {
+			defer func() {
+				p.mu.Lock()
+				delete(p.inflight, key)
+				p.mu.Unlock()
+			}()
+			if err := p.generate(context.Background(), role, language, canonical, hash); err != nil {
+				log.Printf("prompt translation %s: %v", key, err)
+			}
+		}()
+	}
+	return canonical
+}
+
+const promptTranslationSystem = `You translate the system prompt of a hotel-management assistant.
+Translate the prose into the requested language. Keep unchanged, byte for byte:
+- every template action between double curly braces, e.g. {{.HotelName}} or {{"{{"}};
+- tool names, SQL, table/column names and quoted status values ('checkout_due', 'confirmed'…);
+- Markdown structure, bullet layout and line breaks.
+Reply with the translated template only, no preamble.`
+
+func (p *promptTranslator) generate(ctx context.Context, role, language, canonical, hash string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+	resp, err := p.llm.Chat(ctx, llm.Request{
+		System: promptTranslationSystem,
+		Messages: []llm.Message{{
+			Role:    "user",
+			Content: []llm.ContentBlock{{Type: "text", Text: "Language: " + language + "\n\n" + canonical}},
+		}},
+		Options: llm.Options{MaxTokens: 8192},
+	})
+	if err != nil {
+		return fmt.Errorf("llm: %w", err)
+	}
+	translated := strings.TrimSpace(resp.Text)
+	if err := checkTranslation(canonical, translated); err != nil {
+		return err
+	}
+	_, err = p.adminPool.Exec(ctx,
+		`INSERT INTO prompt_translations (role, language, template, source_hash) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (role, language) DO UPDATE
+		   SET template = EXCLUDED.template, source_hash = EXCLUDED.source_hash, updated_at = now()`,
+		role, language, translated, hash,
+	)
+	if err != nil {
+		return fmt.Errorf("store: %w", err)
+	}
+	log.Printf("prompt translation %s/%s stored", role, language)
+	return nil
+}
+
+var templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// checkTranslation rejects a translation that does not parse or whose
+// template actions differ from the canonical ones: a dropped {{.Schema}}
+// would silently blind the assistant.
+func checkTranslation(canonical, translated string) error {
+	if translated == "" {
+		return fmt.Errorf("empty translation")
+	}
+	if _, err := template.New("prompt").Parse(translated); err != nil {
+		return fmt.Errorf("translation does not parse: %w", err)
+	}
+	want := templateAction.FindAllString(canonical, -1)
+	got := templateAction.FindAllString(translated, -1)
+	sort.Strings(want)
+	sort.Strings(got)
+	if strings.Join(want, "\x00") != strings.Join(got, "\x00") {
+		return fmt.Errorf("translation altered template actions")
+	}
+	return nil
+}
+
+func promptHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Rate rules sit on top of the rates calendar (rates.go): over a period, for
+// a room type or every room of the property, a rule adds surcharge_pct to the
+// nightly price — on Friday and Saturday nights only when weekends_only is set
+// — and/or requires a stay of at least min_nights when any of its nights falls
+// in the period. Event dates and holidays are rules with a short period.
+// Where several surcharges cover a night the highest applies.
+//
+// stayNights applies the surcharges, so quote, get_quote and invoices price
+// them. A stay shorter than a minimum is never accepted silently: quote leaves
+// those rooms out and says why, add_reservation and add_group_booking refuse
+// it until a manager repeats the call with override=true, which is written in
+// the reservation notes.
+
+// minStayViolation describes the strictest minimum stay that a stay of roomID
+// from checkin to checkout breaks, e.g. "soggiorno minimo 3 notti (Ferragosto,
+// 10/08–17/08)"; empty when it breaks none.
+func minStayViolation(ctx context.Context, db querier, roomID int64, checkin, checkout time.Time) (string, error) {
+	nights := len(nightsBetween(checkin, checkout))
+	var minNights int
+	var note string
+	var from, to time.Time
+	err := db.QueryRow(ctx,
+		`SELECT min_nights, COALESCE(note, ''), valid_from, valid_to
+		 FROM rate_rules
+		 WHERE hotel_id = (SELECT hotel_id FROM rooms WHERE id = $1)
+		   AND (room_type_id IS NULL OR room_type_id = (SELECT room_type_id FROM rooms WHERE id = $1))
+		   AND min_nights > $4
+		   AND valid_from < ($3::timestamptz AT TIME ZONE 'Europe/Rome')::date
+		   AND valid_to >= ($2::timestamptz AT TIME ZONE 'Europe/Rome')::date
+		 ORDER BY min_nights DESC
+		 LIMIT 1`, roomID, checkin, checkout, nights).Scan(&minNights, &note, &from, &to)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query minimum stay: %w", err)
+	}
+	period := from.Format("02/01") + "–" + to.Format("02/01")
+	if note != "" {
+		period = note + ", " + period
+	}
+	return fmt.Sprintf("soggiorno minimo %d notti (%s)", minNights, period), nil
+}
+
+// overrideNote is what a stay accepted with override=true carries in its
+// notes, next to the broken rule.
+func overrideNote(violation string, notes string) string {
+	line := "Deroga: " + violation
+	if strings.TrimSpace(notes) == "" {
+		return line
+	}
+	return notes + "\n" + line
+}
+
+// ── set_rate_rule ────────────────────────────────────────────────────────────
+
+type setRateRuleTool struct{}
+
+func (t *setRateRuleTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_rate_rule",
+		Description: "Regole sulle tariffe per un periodo: soggiorno minimo (min_nights), supplemento percentuale " +
+			"(surcharge_pct, anche negativo per uno sconto), solo nelle notti di venerdì e sabato con weekends_only. " +
+			"Per festività ed eventi usa un periodo breve con una nota. Una regola con stesso periodo, tipologia e " +
+			"weekends_only viene aggiornata; delete=true la rimuove. Senza from elenca le regole in vigore e future. " +
+			"Le modifiche sono solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD"},
+				"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD, incluso (default: from)"},
+				"room_type": {"type": "string", "description": "Tipologia di camera (default: tutte le camere)"},
+				"min_nights": {"type": "integer", "description": "Notti minime per i soggiorni che toccano il periodo"},
+				"surcharge_pct": {"type": "number", "description": "Supplemento sul prezzo a notte in percentuale, es. 20"},
+				"weekends_only": {"type": "boolean", "description": "Il supplemento vale solo le notti di venerdì e sabato"},
+				"note": {"type": "string", "description": "Nome della regola, es. 'Ferragosto', 'Fiera del Levante'"},
+				"delete": {"type": "boolean", "description": "Rimuove la regola con questo periodo e destinatario"}
+			}
+		}`),
+	}
+}
+
+func (t *setRateRuleTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From         string   `json:"from"`
+		To           string   `json:"to"`
+		RoomType     string   `json:"room_type"`
+		MinNights    *int     `json:"min_nights"`
+		SurchargePct *float64 `json:"surcharge_pct"`
+		WeekendsOnly bool     `json:"weekends_only"`
+		Note         string   `json:"note"`
+		Delete       bool     `json:"delete"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	if in.From == "" {
+		return listRateRules(bg, db)
+	}
+
+	from, err := time.Parse("2006-01-02", in.From)
+	if err != nil {
+		return "", fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+	}
+	to := from
+	if in.To != "" {
+		if to, err = time.Parse("2006-01-02", in.To); err != nil {
+			return "", fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return "", fmt.Errorf("to is before from")
+	}
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_rate_rule is only available to managers")
+	}
+
+	var typeID *int64
+	target := "tutte le camere"
+	if in.RoomType != "" {
+		var id int64
+		if err := db.QueryRow(bg, `SELECT id, name FROM room_types WHERE lower(name) = lower($1)`, in.RoomType).Scan(&id, &in.RoomType); err != nil {
+			return fmt.Sprintf("Tipologia %q non trovata.", in.RoomType), nil
+		}
+		typeID, target = &id, "tipologia "+in.RoomType
+	}
+	period := from.Format("02/01/2006")
+	if !to.Equal(from) {
+		period += " → " + to.Format("02/01/2006")
+	}
+	if in.WeekendsOnly {
+		period += ", solo weekend"
+	}
+
+	// Same target, period and weekends_only: the rule is edited (or removed)
+	// in place.
+	const match = `room_type_id IS NOT DISTINCT FROM $1 AND valid_from = $2 AND valid_to = $3 AND weekends_only = $4`
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM rate_rules WHERE `+match, typeID, from, to, in.WeekendsOnly)
+		if err != nil {
+			return "", fmt.Errorf("delete: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Sprintf("Nessuna regola per %s, %s.", target, period), nil
+		}
+		return fmt.Sprintf("🗑 Regola rimossa: %s, %s.", target, period), nil
+	}
+	if in.MinNights == nil && in.SurchargePct == nil {
+		return "", fmt.Errorf("give min_nights, surcharge_pct or both")
+	}
+	if in.MinNights != nil && *in.MinNights < 2 {
+		return "", fmt.Errorf("min_nights must be at least 2")
+	}
+	if in.SurchargePct != nil && (*in.SurchargePct <= -100 || *in.SurchargePct > 500 || *in.SurchargePct == 0) {
+		return "", fmt.Errorf("surcharge_pct must be between -100 and 500, and not 0")
+	}
+	if in.WeekendsOnly && in.SurchargePct == nil {
+		return "", fmt.Errorf("weekends_only applies to surcharge_pct")
+	}
+
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(bg,
+			`UPDATE rate_rules SET min_nights = $5, surcharge_pct = $6, note = NULLIF($7, ''), created_by = current_telegram_id()
+			 WHERE `+match, typeID, from, to, in.WeekendsOnly, in.MinNights, in.SurchargePct, in.Note)
+		if err != nil || tag.RowsAffected() > 0 {
+			return err
+		}
+		_, err = tx.Exec(bg,
+			`INSERT INTO rate_rules (room_type_id, valid_from, valid_to, weekends_only, min_nights, surcharge_pct, note, created_by)
+			 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), current_telegram_id())`,
+			typeID, from, to, in.WeekendsOnly, in.MinNights, in.SurchargePct, in.Note)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("save: %w", err)
+	}
+	return fmt.Sprintf("✅ Regola per %s, %s: %s.", target, period, describeRateRule(in.MinNights, in.SurchargePct)), nil
+}
+
+// describeRateRule is "soggiorno minimo 3 notti, +20%".
+func describeRateRule(minNights *int, surchargePct *float64) string {
+	var parts []string
+	if minNights != nil {
+		parts = append(parts, fmt.Sprintf("soggiorno minimo %d notti", *minNights))
+	}
+	if surchargePct != nil {
+		parts = append(parts, fmt.Sprintf("%+g%%", *surchargePct))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// listRateRules lists the rules still in force or to come.
+func listRateRules(ctx context.Context, db querier) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT rr.valid_from, rr.valid_to, COALESCE(t.name, ''), rr.weekends_only,
+		        rr.min_nights, rr.surcharge_pct::float8, COALESCE(rr.note, '')
+		 FROM rate_rules rr LEFT JOIN room_types t ON t.id = rr.room_type_id
+		 WHERE rr.valid_to >= (now() AT TIME ZONE 'Europe/Rome')::date
+		 ORDER BY rr.valid_from, rr.valid_to, t.name NULLS FIRST`)
+	if err != nil {
+		return "", fmt.Errorf("query rate rules: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		var from, to time.Time
+		var typeName, note string
+		var weekends bool
+		var minNights *int
+		var surcharge *float64
+		if err := rows.Scan(&from, &to, &typeName, &weekends, &minNights, &surcharge, &note); err != nil {
+			return "", err
+		}
+		period := from.Format("02/01/2006")
+		if !to.Equal(from) {
+			period += " → " + to.Format("02/01/2006")
+		}
+		fmt.Fprintf(&sb, "\n• %s", period)
+		if note != "" {
+			fmt.Fprintf(&sb, " %s", note)
+		}
+		if typeName != "" {
+			fmt.Fprintf(&sb, " [%s]", typeName)
+		}
+		fmt.Fprintf(&sb, ": %s", describeRateRule(minNights, surcharge))
+		if weekends {
+			sb.WriteString(" (venerdì e sabato)")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if sb.Len() == 0 {
+		return "Nessuna regola sulle tariffe: valgono solo i prezzi di rates.", nil
+	}
+	return "📐 Regole sulle tariffe:" + sb.String(), nil
+}
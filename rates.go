@@ -0,0 +1,740 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Nightly prices live in the rates table. A row covers valid_from..valid_to
+// (inclusive) for one room, one room type, or every room when both room_id
+// and room_type_id are NULL. When several rows match a night the most
+// specific wins: a room's own rate, then its type's, then the generic one;
+// among equals the shortest period (so a "Ferragosto" row overrides "summer",
+// and a one-day row overrides a single date). Guests beyond included_guests
+// pay extra_guest_eur each per night. Nights no row covers fall back to the
+// base_rate of the room's type. On top of that price, the rate_rules of the
+// property add surcharges and minimum stays (raterules.go).
+//
+// Configure via env:
+//
+//	CITY_TAX_EUR=2.50          city tax per guest per night; empty means none
+//	CITY_TAX_MAX_NIGHTS=10     nights taxed per stay; empty means all
+//
+// Children are exempt from the city tax; see citytax.go for the monthly report.
+
+// quoteHoldDuration is how long a quoted room stays blocked as an option.
+const quoteHoldDuration = 24 * time.Hour
+
+// nightPrice is the price of one night of a stay; price is nil when no rate
+// covers it. note is the winning rates row's note ("tariffa base" for the
+// room type fallback); surcharge is the rate rule percentage included in
+// price, surchargeNote that rule's note.
+type nightPrice struct {
+	day           time.Time
+	price         *float64
+	note          string
+	surcharge     float64
+	surchargeNote string
+}
+
+// stayNights prices each night between checkin and checkout (Europe/Rome
+// dates) of roomID for a party of guests.
+func stayNights(ctx context.Context, db querier, roomID int64, checkin, checkout time.Time, guests int) ([]nightPrice, error) {
+	rows, err := db.Query(ctx,
+		`SELECT d::date, round((COALESCE(rt.price, base.rate) * (1 + COALESCE(sc.pct, 0) / 100))::numeric, 2)::float8,
+		        CASE WHEN rt.price IS NOT NULL THEN rt.note WHEN base.rate IS NOT NULL THEN 'tariffa base' ELSE '' END,
+		        COALESCE(sc.pct, 0), COALESCE(sc.note, '')
+		 FROM generate_series(($2::timestamptz AT TIME ZONE 'Europe/Rome')::date,
+		                      ($3::timestamptz AT TIME ZONE 'Europe/Rome')::date - 1, INTERVAL '1 day') d
+		 LEFT JOIN LATERAL (
+		   SELECT (nightly_eur + GREATEST(0, $4 - included_guests) * extra_guest_eur)::float8 AS price,
+		          COALESCE(note, '') AS note
+		   FROM rates
+		   WHERE (room_id = $1
+		          OR room_type_id = (SELECT room_type_id FROM rooms WHERE id = $1)
+		          OR (room_id IS NULL AND room_type_id IS NULL))
+		     AND d::date BETWEEN valid_from AND valid_to
+		   ORDER BY room_id IS NULL, room_type_id IS NULL, valid_to - valid_from, id DESC
+		   LIMIT 1
+		 ) rt ON true
+		 LEFT JOIN LATERAL (
+		   SELECT t.base_rate::float8 AS rate
+		   FROM rooms r JOIN room_types t ON t.id = r.room_type_id
+		   WHERE r.id = $1
+		 ) base ON true
+		 LEFT JOIN LATERAL (
+		   SELECT surcharge_pct::float8 AS pct, COALESCE(note, '') AS note
+		   FROM rate_rules
+		   WHERE hotel_id = (SELECT hotel_id FROM rooms WHERE id = $1)
+		     AND (room_type_id IS NULL OR room_type_id = (SELECT room_type_id FROM rooms WHERE id = $1))
+		     AND surcharge_pct IS NOT NULL
+		     AND d::date BETWEEN valid_from AND valid_to
+		     AND (NOT weekends_only OR extract(isodow FROM d) IN (5, 6))
+		   ORDER BY surcharge_pct DESC
+		   LIMIT 1
+		 ) sc ON true
+		 ORDER BY d`, roomID, checkin, checkout, guests)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []nightPrice
+	for rows.Next() {
+		var n nightPrice
+		if err := rows.Scan(&n.day, &n.price, &n.note, &n.surcharge, &n.surchargeNote); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// stayPrice sums stayNights. Nights without any matching rate are returned
+// in missing and not counted in total.
+func stayPrice(ctx context.Context, db *pgxpool.Pool, roomID int64, checkin, checkout time.Time, guests int) (total float64, missing []time.Time, err error) {
+	nights, err := stayNights(ctx, db, roomID, checkin, checkout, guests)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, n := range nights {
+		if n.price == nil {
+			missing = append(missing, n.day)
+			continue
+		}
+		total += *n.price
+	}
+	return total, missing, nil
+}
+
+// cityTax is the city tax of a stay: CITY_TAX_EUR per guest per night, on at
+// most CITY_TAX_MAX_NIGHTS nights. children (part of guests) are exempt.
+func cityTax(guests, children, nights int) float64 {
+	if limit := envInt("CITY_TAX_MAX_NIGHTS", 0); limit > 0 && nights > limit {
+		nights = limit
+	}
+	return envFloat("CITY_TAX_EUR", 0) * float64((guests-children)*nights)
+}
+
+// ── quote ────────────────────────────────────────────────────────────────────
+
+type quoteTool struct{}
+
+func (t *quoteTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "quote",
+		Description: "Preventivo per una richiesta telefonica: verifica le camere libere, applica le tariffe (tabella rates) " +
+			"e le regole (supplementi, soggiorno minimo) e restituisce un messaggio pronto da inoltrare all'ospite. " +
+			"Con hold=true blocca la camera come opzione per 24 ore. Le camere con un soggiorno minimo non rispettato " +
+			"vengono escluse: un manager può proporle comunque con override=true.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"checkin": {"type": "string", "description": "Arrivo: YYYY-MM-DD o ISO 8601 con fuso"},
+				"checkout": {"type": "string", "description": "Partenza: YYYY-MM-DD o ISO 8601 con fuso"},
+				"guests": {"type": "integer", "description": "Numero di persone in totale (default 2)"},
+				"adults": {"type": "integer", "description": "Adulti: in alternativa a guests, che diventa adults + children"},
+				"children": {"type": "integer", "description": "Bambini, compresi nei guests ed esenti dalla tassa di soggiorno"},
+				"room": {"type": "string", "description": "Camera specifica (default: tutte le libere)"},
+				"features": {"type": "array", "items": {"type": "string", "enum": ["pets", "accessible", "balcony", "connecting"]}, "description": "Caratteristiche richieste: animali, accessibile, balcone, comunicante"},
+				"hold": {"type": "boolean", "description": "Blocca la camera (quella indicata o la più economica) come opzione per 24h. Solo per i manager."},
+				"guest_name": {"type": "string", "description": "Nome dell'ospite, per l'opzione"},
+				"override": {"type": "boolean", "description": "Ignora il soggiorno minimo (solo manager): la deroga viene annotata sull'opzione"}
+			},
+			"required": ["checkin", "checkout"]
+		}`),
+	}
+}
+
+type quoteOption struct {
+	room    roomRef
+	partner *roomRef // connecting room booked with room, if any
+	total   float64
+	// violation is the minimum stay the option breaks, offered anyway
+	// with override.
+	violation string
+}
+
+func (t *quoteTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Checkin   string   `json:"checkin"`
+		Checkout  string   `json:"checkout"`
+		Guests    int      `json:"guests"`
+		Adults    int      `json:"adults"`
+		Children  int      `json:"children"`
+		Room      string   `json:"room"`
+		Features  []string `json:"features"`
+		Hold      bool     `json:"hold"`
+		GuestName string   `json:"guest_name"`
+		Override  bool     `json:"override"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if err := checkRoomFeatures(in.Features); err != nil {
+		return "", err
+	}
+	checkin, err := parseStayTime(in.Checkin, defaultCheckinHour)
+	if err != nil {
+		return "", fmt.Errorf("checkin %w", err)
+	}
+	checkout, err := parseStayTime(in.Checkout, defaultCheckoutHour)
+	if err != nil {
+		return "", fmt.Errorf("checkout %w", err)
+	}
+	nights := len(nightsBetween(checkin, checkout))
+	if nights == 0 {
+		return "", fmt.Errorf("a quote needs at least one night")
+	}
+	if err := partySize(&in.Guests, in.Adults, in.Children, 2); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	if in.Override {
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("only managers can override the minimum stay")
+		}
+	}
+
+	rooms, err := availableRooms(bg, db, checkin, checkout)
+	if err != nil {
+		return "", fmt.Errorf("availability: %w", err)
+	}
+	byID := make(map[int64]roomRef, len(rooms))
+	for _, r := range rooms {
+		byID[r.id] = r
+	}
+	rooms = withFeatures(rooms, in.Features)
+	pairs := slices.Contains(in.Features, "connecting")
+	offered := make(map[int64]bool, len(rooms))
+	for _, r := range rooms {
+		offered[r.id] = true
+	}
+	loc := romeLocation()
+	period := checkin.In(loc).Format("02/01") + " → " + checkout.In(loc).Format("02/01")
+	if len(in.Features) > 0 {
+		period += " con le caratteristiche richieste"
+	}
+
+	var options []quoteOption
+	var unpriced, tooSmall []string
+	// Rooms left out for a minimum stay, grouped by the rule they break.
+	var rules []string
+	shortStay := make(map[string][]string)
+	minStay := func(label string, ids ...int64) (violation string, ok bool, err error) {
+		for _, id := range ids {
+			if violation, err = minStayViolation(bg, db, id, checkin, checkout); err != nil || violation != "" {
+				break
+			}
+		}
+		if err != nil || violation == "" || in.Override {
+			return violation, err == nil, err
+		}
+		if _, seen := shortStay[violation]; !seen {
+			rules = append(rules, violation)
+		}
+		shortStay[violation] = append(shortStay[violation], label)
+		return violation, false, nil
+	}
+	for _, r := range rooms {
+		if pairs {
+			// A connecting pair is one option, priced as both rooms.
+			p := byID[r.connectingID]
+			if p.id < r.id && offered[p.id] {
+				continue // listed from the other room
+			}
+			if in.Room != "" && !strings.EqualFold(r.name, in.Room) && !strings.EqualFold(p.name, in.Room) {
+				continue
+			}
+			if r.capacity > 0 && p.capacity > 0 && r.capacity+p.capacity < in.Guests {
+				tooSmall = append(tooSmall, fmt.Sprintf("%s+%s (max %d)", r.name, p.name, r.capacity+p.capacity))
+				continue
+			}
+			violation, ok, err := minStay(r.name+"+"+p.name, r.id, p.id)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				continue
+			}
+			g1, _, g2, _ := splitParty(in.Guests, in.Children)
+			t1, m1, err := stayPrice(bg, db, r.id, checkin, checkout, g1)
+			if err != nil {
+				return "", fmt.Errorf("price room %s: %w", r.name, err)
+			}
+			t2, m2, err := stayPrice(bg, db, p.id, checkin, checkout, g2)
+			if err != nil {
+				return "", fmt.Errorf("price room %s: %w", p.name, err)
+			}
+			if missing := append(m1, m2...); len(missing) > 0 {
+				unpriced = append(unpriced, fmt.Sprintf("%s+%s (manca il %s)", r.name, p.name, missing[0].Format("02/01")))
+				continue
+			}
+			options = append(options, quoteOption{room: r, partner: &p, total: t1 + t2, violation: violation})
+			continue
+		}
+		if in.Room != "" && !strings.EqualFold(r.name, in.Room) {
+			continue
+		}
+		if r.capacity > 0 && r.capacity < in.Guests {
+			tooSmall = append(tooSmall, fmt.Sprintf("%s (max %d)", r.name, r.capacity))
+			continue
+		}
+		violation, ok, err := minStay(r.name, r.id)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		total, missing, err := stayPrice(bg, db, r.id, checkin, checkout, in.Guests)
+		if err != nil {
+			return "", fmt.Errorf("price room %s: %w", r.name, err)
+		}
+		if len(missing) > 0 {
+			unpriced = append(unpriced, fmt.Sprintf("%s (manca il %s)", r.name, missing[0].Format("02/01")))
+			continue
+		}
+		options = append(options, quoteOption{room: r, total: total, violation: violation})
+	}
+	var short []string
+	for _, v := range rules {
+		short = append(short, strings.Join(shortStay[v], ", ")+": "+v)
+	}
+	if len(options) == 0 {
+		msg := "Nessuna camera libera " + period + "."
+		if in.Room != "" {
+			msg = fmt.Sprintf("Camera %s non disponibile %s.", in.Room, period)
+		}
+		if len(tooSmall) > 0 {
+			msg += fmt.Sprintf("\nLibere ma troppo piccole per %d persone: %s.", in.Guests, strings.Join(tooSmall, ", "))
+		}
+		if len(unpriced) > 0 {
+			msg += "\nLibere ma senza tariffa: " + strings.Join(unpriced, ", ") + ". Aggiungi le righe mancanti in rates."
+		}
+		if len(short) > 0 {
+			msg += "\nLibere ma con un soggiorno minimo più lungo — " + strings.Join(short, "; ") +
+				". Proponi più notti, oppure un manager può derogare con override=true."
+		}
+		return msg, nil
+	}
+	sort.Slice(options, func(i, j int) bool { return options[i].total < options[j].total })
+	if len(options) > 3 {
+		options = options[:3]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🏨 Preventivo soggiorno\n")
+	fmt.Fprintf(&sb, "📅 Dal %s al %s (%d notti), %d persone\n\n",
+		checkin.In(loc).Format("02/01/2006"), checkout.In(loc).Format("02/01/2006"), nights, in.Guests)
+	tax := cityTax(in.Guests, in.Children, nights)
+	for _, o := range options {
+		if o.partner != nil {
+			fmt.Fprintf(&sb, "• Camere comunicanti %s + %s: %.2f€ (%.2f€ a notte)\n",
+				o.room.name, o.partner.name, o.total, o.total/float64(nights))
+			continue
+		}
+		label := o.room.name
+		details := o.room.featureLabels()
+		if o.room.typeName != "" {
+			details = append([]string{o.room.typeName}, details...)
+		}
+		if len(details) > 0 {
+			label += " (" + strings.Join(details, ", ") + ")"
+		}
+		fmt.Fprintf(&sb, "• Camera %s: %.2f€ (%.2f€ a notte)\n", label, o.total, o.total/float64(nights))
+	}
+
+	if tax > 0 {
+		fmt.Fprintf(&sb, "Tassa di soggiorno: %.2f€, da aggiungere al prezzo.\n", tax)
+	}
+
+	if in.Hold {
+		o := options[0]
+		holdUntil := time.Now().Add(quoteHoldDuration)
+		type hold struct {
+			roomID           int64
+			guests, children int
+			amount           *float64
+		}
+		var notes string
+		if o.violation != "" {
+			notes = overrideNote(o.violation, "")
+		}
+		holds := []hold{{o.room.id, in.Guests, in.Children, &o.total}}
+		blocked := "Camera " + o.room.name + " bloccata"
+		if o.partner != nil {
+			g1, c1, g2, c2 := splitParty(in.Guests, in.Children)
+			a1, a2 := splitAmount(&o.total)
+			holds = []hold{{o.room.id, g1, c1, a1}, {o.partner.id, g2, c2, a2}}
+			blocked = "Camere " + o.room.name + " e " + o.partner.name + " bloccate"
+		}
+		var ids []int64
+		err := pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+			for _, h := range holds {
+				var id int64
+				if err := tx.QueryRow(bg,
+					`INSERT INTO reservations (room_id, guest_name, checkin_at, checkout_at, guests, children, source, amount_eur,
+					   status, hold_until, created_by, notes)
+					 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, 'phone', $7, 'option', $8, $9, NULLIF($10, ''))
+					 RETURNING id`,
+					h.roomID, in.GuestName, checkin, checkout, h.guests, h.children, h.amount, holdUntil, ctx.UserID, notes,
+				).Scan(&id); err != nil {
+					return err
+				}
+				ids = append(ids, id)
+			}
+			if len(ids) == 2 {
+				return linkReservations(bg, tx, ids[0], ids[1])
+			}
+			return nil
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+			return "❌ " + pgErr.Message + "\n\n" + sb.String(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("hold (only managers can hold rooms): %w", err)
+		}
+		fmt.Fprintf(&sb, "\n%s per lei fino al %s.", blocked, holdUntil.In(loc).Format("02/01 15:04"))
+		fmt.Fprintf(&sb, "\n\n(interno: opzione = prenotazione %d, confermala con confirm_option)", ids[0])
+	}
+	if len(unpriced) > 0 {
+		fmt.Fprintf(&sb, "\n\n(interno: libere ma senza tariffa: %s)", strings.Join(unpriced, ", "))
+	}
+	if len(short) > 0 {
+		fmt.Fprintf(&sb, "\n\n(interno: escluse per soggiorno minimo — %s; override=true per proporle comunque)", strings.Join(short, "; "))
+	}
+	for _, o := range options {
+		if o.violation != "" {
+			fmt.Fprintf(&sb, "\n\n(interno: proposte in deroga al %s)", o.violation)
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+// nightsBetween returns the Europe/Rome dates of each night of a stay.
+func nightsBetween(checkin, checkout time.Time) []time.Time {
+	loc := romeLocation()
+	ci, co := checkin.In(loc), checkout.In(loc)
+	end := time.Date(co.Year(), co.Month(), co.Day(), 0, 0, 0, 0, loc)
+	var out []time.Time
+	for d := time.Date(ci.Year(), ci.Month(), ci.Day(), 0, 0, 0, 0, loc); d.Before(end); d = d.AddDate(0, 0, 1) {
+		out = append(out, d)
+	}
+	return out
+}
+
+// ── set_rate ─────────────────────────────────────────────────────────────────
+
+type setRateTool struct{}
+
+func (t *setRateTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_rate",
+		Description: "Imposta il prezzo a notte per un periodo (stagione) o un singolo giorno, per una camera, " +
+			"una tipologia o tutte le camere. Una riga con stesso periodo e destinatario viene aggiornata; " +
+			"con delete=true viene rimossa. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD"},
+				"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD, incluso (default: from, cioè un solo giorno)"},
+				"nightly_eur": {"type": "number", "description": "Prezzo della camera a notte"},
+				"room": {"type": "string", "description": "Camera (default: tutte)"},
+				"room_type": {"type": "string", "description": "Tipologia di camera, in alternativa a room"},
+				"included_guests": {"type": "integer", "description": "Persone incluse nel prezzo (default 2)"},
+				"extra_guest_eur": {"type": "number", "description": "Supplemento per persona in più a notte (default 0)"},
+				"note": {"type": "string", "description": "Nome della tariffa, es. 'Alta stagione', 'Ferragosto'"},
+				"delete": {"type": "boolean", "description": "Rimuove la tariffa con questo periodo e destinatario"}
+			},
+			"required": ["from"]
+		}`),
+	}
+}
+
+func (t *setRateTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From           string   `json:"from"`
+		To             string   `json:"to"`
+		NightlyEUR     *float64 `json:"nightly_eur"`
+		Room           string   `json:"room"`
+		RoomType       string   `json:"room_type"`
+		IncludedGuests int      `json:"included_guests"`
+		ExtraGuestEUR  float64  `json:"extra_guest_eur"`
+		Note           string   `json:"note"`
+		Delete         bool     `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	from, err := time.Parse("2006-01-02", in.From)
+	if err != nil {
+		return "", fmt.Errorf("from must be YYYY-MM-DD: %w", err)
+	}
+	to := from
+	if in.To != "" {
+		if to, err = time.Parse("2006-01-02", in.To); err != nil {
+			return "", fmt.Errorf("to must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if to.Before(from) {
+		return "", fmt.Errorf("to is before from")
+	}
+	if in.Room != "" && in.RoomType != "" {
+		return "", fmt.Errorf("give either room or room_type, not both")
+	}
+	if in.IncludedGuests <= 0 {
+		in.IncludedGuests = 2
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_rate is only available to managers")
+	}
+
+	var roomID, typeID *int64
+	target := "tutte le camere"
+	switch {
+	case in.Room != "":
+		var id int64
+		if err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, in.Room).Scan(&id, &in.Room); err != nil {
+			return fmt.Sprintf("Camera %q non trovata.", in.Room), nil
+		}
+		roomID, target = &id, "camera "+in.Room
+	case in.RoomType != "":
+		var id int64
+		if err := db.QueryRow(bg, `SELECT id, name FROM room_types WHERE lower(name) = lower($1)`, in.RoomType).Scan(&id, &in.RoomType); err != nil {
+			return fmt.Sprintf("Tipologia %q non trovata.", in.RoomType), nil
+		}
+		typeID, target = &id, "tipologia "+in.RoomType
+	}
+	period := from.Format("02/01/2006")
+	if !to.Equal(from) {
+		period += " → " + to.Format("02/01/2006")
+	}
+
+	// Same target and period: the row is edited (or removed) in place.
+	const match = `room_id IS NOT DISTINCT FROM $1 AND room_type_id IS NOT DISTINCT FROM $2
+	               AND valid_from = $3 AND valid_to = $4`
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM rates WHERE `+match, roomID, typeID, from, to)
+		if err != nil {
+			return "", fmt.Errorf("delete: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Sprintf("Nessuna tariffa per %s, %s.", target, period), nil
+		}
+		return fmt.Sprintf("🗑 Tariffa rimossa: %s, %s.", target, period), nil
+	}
+	if in.NightlyEUR == nil || *in.NightlyEUR < 0 {
+		return "", fmt.Errorf("nightly_eur is required and must not be negative")
+	}
+
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(bg,
+			`UPDATE rates SET nightly_eur = $5, included_guests = $6, extra_guest_eur = $7, note = NULLIF($8, '')
+			 WHERE `+match, roomID, typeID, from, to, *in.NightlyEUR, in.IncludedGuests, in.ExtraGuestEUR, in.Note)
+		if err != nil || tag.RowsAffected() > 0 {
+			return err
+		}
+		_, err = tx.Exec(bg,
+			`INSERT INTO rates (room_id, room_type_id, valid_from, valid_to, nightly_eur, included_guests, extra_guest_eur, note)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))`,
+			roomID, typeID, from, to, *in.NightlyEUR, in.IncludedGuests, in.ExtraGuestEUR, in.Note)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("save: %w", err)
+	}
+	msg := fmt.Sprintf("✅ %s, %s: %.2f€ a notte per %d persone", target, period, *in.NightlyEUR, in.IncludedGuests)
+	if in.ExtraGuestEUR > 0 {
+		msg += fmt.Sprintf(", +%.2f€ per persona in più", in.ExtraGuestEUR)
+	}
+	return msg + ".", nil
+}
+
+// ── get_quote ────────────────────────────────────────────────────────────────
+
+type getQuoteTool struct{}
+
+func (t *getQuoteTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "get_quote",
+		Description: "Calcola quanto costa una camera per un soggiorno: prezzo notte per notte dalle tariffe, " +
+			"totale, tassa di soggiorno e totale complessivo, e dice se la camera è libera. " +
+			"Es. \"quanto costa la 101 dal 3 al 7 agosto\".",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Camera"},
+				"checkin": {"type": "string", "description": "Arrivo: YYYY-MM-DD o ISO 8601 con fuso"},
+				"checkout": {"type": "string", "description": "Partenza: YYYY-MM-DD o ISO 8601 con fuso"},
+				"guests": {"type": "integer", "description": "Numero di persone in totale (default 2)"},
+				"adults": {"type": "integer", "description": "Adulti: in alternativa a guests, che diventa adults + children"},
+				"children": {"type": "integer", "description": "Bambini, compresi nei guests ed esenti dalla tassa di soggiorno"}
+			},
+			"required": ["room", "checkin", "checkout"]
+		}`),
+	}
+}
+
+func (t *getQuoteTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room     string `json:"room"`
+		Checkin  string `json:"checkin"`
+		Checkout string `json:"checkout"`
+		Guests   int    `json:"guests"`
+		Adults   int    `json:"adults"`
+		Children int    `json:"children"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	checkin, err := parseStayTime(in.Checkin, defaultCheckinHour)
+	if err != nil {
+		return "", fmt.Errorf("checkin %w", err)
+	}
+	checkout, err := parseStayTime(in.Checkout, defaultCheckoutHour)
+	if err != nil {
+		return "", fmt.Errorf("checkout %w", err)
+	}
+	if len(nightsBetween(checkin, checkout)) == 0 {
+		return "", fmt.Errorf("a quote needs at least one night")
+	}
+	if err := partySize(&in.Guests, in.Adults, in.Children, 2); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	room, err := scanRoomRef(db.QueryRow(bg,
+		`SELECT `+roomRefColumns+`
+		 FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id
+		 LEFT JOIN rooms c ON c.id = r.connecting_room_id
+		 WHERE lower(r.name) = lower($1)`, in.Room))
+	if err != nil {
+		return fmt.Sprintf("Camera %q non trovata.", in.Room), nil
+	}
+	nights, err := stayNights(bg, db, room.id, checkin, checkout, in.Guests)
+	if err != nil {
+		return "", fmt.Errorf("price: %w", err)
+	}
+
+	loc := romeLocation()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "💶 Camera %s", room.name)
+	if room.typeName != "" {
+		sb.WriteString(" (" + room.typeName + ")")
+	}
+	fmt.Fprintf(&sb, ", dal %s al %s, %d notti, %d persone\n",
+		checkin.In(loc).Format("02/01/2006"), checkout.In(loc).Format("02/01/2006"), len(nights), in.Guests)
+
+	// Consecutive nights at the same price and rate are shown as one line.
+	var total float64
+	var missing []string
+	for i := 0; i < len(nights); {
+		j := i + 1
+		for j < len(nights) && samePrice(nights[i], nights[j]) {
+			j++
+		}
+		n := nights[i]
+		span := n.day.Format("02/01")
+		if j-i > 1 {
+			span += "–" + nights[j-1].day.Format("02/01")
+		}
+		if n.price == nil {
+			missing = append(missing, span)
+		} else {
+			fmt.Fprintf(&sb, "• %s: %d × %.2f€", span, j-i, *n.price)
+			if label := n.label(); label != "" {
+				sb.WriteString(" (" + label + ")")
+			}
+			sb.WriteString("\n")
+			total += *n.price * float64(j-i)
+		}
+		i = j
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&sb, "⚠️ Nessuna tariffa per: %s. Aggiungila con set_rate; il totale è parziale.\n", strings.Join(missing, ", "))
+	}
+	tax := cityTax(in.Guests, in.Children, len(nights))
+	fmt.Fprintf(&sb, "Camera: %.2f€\n", total)
+	if tax > 0 {
+		fmt.Fprintf(&sb, "Tassa di soggiorno: %.2f€\n", tax)
+	}
+	fmt.Fprintf(&sb, "Totale: %.2f€", total+tax)
+
+	if room.capacity > 0 && room.capacity < in.Guests {
+		fmt.Fprintf(&sb, "\n⚠️ La camera ospita al massimo %d persone.", room.capacity)
+	}
+	if v, err := minStayViolation(bg, db, room.id, checkin, checkout); err != nil {
+		return "", err
+	} else if v != "" {
+		fmt.Fprintf(&sb, "\n⚠️ Non rispetta il %s: prenotabile solo in deroga, da un manager.", v)
+	}
+	free, err := availableRooms(bg, db, checkin, checkout)
+	if err != nil {
+		return "", fmt.Errorf("availability: %w", err)
+	}
+	available := false
+	for _, r := range free {
+		if r.id == room.id {
+			available = true
+			break
+		}
+	}
+	if available {
+		sb.WriteString("\n✅ Libera in quelle date.")
+	} else {
+		sb.WriteString("\n❌ Non disponibile in quelle date (occupata, in opzione o fuori servizio).")
+	}
+	return sb.String(), nil
+}
+
+// label describes where the price of n comes from: the rate and, when one
+// applies, the surcharge ("Alta stagione, weekend +20%").
+func (n nightPrice) label() string {
+	if n.surcharge == 0 {
+		return n.note
+	}
+	s := fmt.Sprintf("%+g%%", n.surcharge)
+	if n.surchargeNote != "" {
+		s = n.surchargeNote + " " + s
+	}
+	if n.note == "" {
+		return s
+	}
+	return n.note + ", " + s
+}
+
+func samePrice(a, b nightPrice) bool {
+	if (a.price == nil) != (b.price == nil) {
+		return false
+	}
+	return a.note == b.note && a.surchargeNote == b.surchargeNote && (a.price == nil || *a.price == *b.price)
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Recurring tasks: work that comes back on a rule rather than from a
+// reservation, e.g. the deep clean of room 7 every first Monday of the
+// month. A recurring_tasks row holds the rule; every morning
+// RecurringTasks.materialize turns the rules due that day into ordinary
+// assignments (type deep_clean), so they show up in the cleaners' lists,
+// in start_task/finish_task and in the auto-assigner's load. A rule without
+// a cleaner goes to the least loaded cleaner on shift at the room's
+// property; a rule's cleaner who is off that day is replaced the same way.
+// last_generated keeps a rule from firing twice on the same day, so an
+// assignment the manager deletes is not recreated.
+//
+// Rules (frequency, every N, anchored on starts_on):
+//
+//	daily    every N days
+//	weekly   on weekday, every N weeks
+//	monthly  on day_of_month, or on the week_of_month-th weekday (-1 = last), every N months
+//
+// Configure via env:
+//
+//	RECURRING_TASKS_TIME=06:30   daily time (Europe/Rome) the day's tasks are created; "off" disables it
+
+// isoWeekdays are the weekday names of the tools, Monday = 1 as in
+// recurring_tasks.weekday.
+var isoWeekdays = []string{"", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// weekOfMonthNames are the Italian ordinals of recurring_tasks.week_of_month.
+var weekOfMonthNames = map[int]string{1: "il primo", 2: "il secondo", 3: "il terzo", 4: "il quarto", -1: "l'ultimo"}
+
+func isoWeekday(d time.Weekday) int {
+	if d == time.Sunday {
+		return 7
+	}
+	return int(d)
+}
+
+// recurrence is the rule of a recurring task; unset fields are zero.
+type recurrence struct {
+	frequency   string
+	every       int
+	weekday     int // 1 = Monday … 7 = Sunday
+	weekOfMonth int // 1…4, -1 = last
+	dayOfMonth  int
+	startsOn    time.Time
+}
+
+// validate mirrors recurring_tasks_rule_check, with messages for the tool.
+func (r recurrence) validate() error {
+	if r.every < 1 {
+		return fmt.Errorf("every must be at least 1")
+	}
+	switch r.frequency {
+	case "daily":
+		if r.weekday != 0 || r.weekOfMonth != 0 || r.dayOfMonth != 0 {
+			return fmt.Errorf("a daily rule takes no weekday, week_of_month or day_of_month")
+		}
+	case "weekly":
+		if r.weekday == 0 || r.weekOfMonth != 0 || r.dayOfMonth != 0 {
+			return fmt.Errorf("a weekly rule takes a weekday only")
+		}
+	case "monthly":
+		byDay := r.dayOfMonth != 0 && r.weekday == 0 && r.weekOfMonth == 0
+		byWeekday := r.dayOfMonth == 0 && r.weekday != 0 && r.weekOfMonth != 0
+		if !byDay && !byWeekday {
+			return fmt.Errorf("a monthly rule takes either day_of_month or weekday with week_of_month")
+		}
+		if r.dayOfMonth < 0 || r.dayOfMonth > 31 {
+			return fmt.Errorf("day_of_month must be 1-31")
+		}
+		if _, ok := weekOfMonthNames[r.weekOfMonth]; byWeekday && !ok {
+			return fmt.Errorf("week_of_month must be 1-4 or -1 (last)")
+		}
+	default:
+		return fmt.Errorf("frequency must be daily, weekly or monthly")
+	}
+	return nil
+}
+
+// due reports whether the rule fires on day. A monthly day_of_month past the
+// end of a short month falls on its last day.
+func (r recurrence) due(day time.Time) bool {
+	d := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	start := time.Date(r.startsOn.Year(), r.startsOn.Month(), r.startsOn.Day(), 0, 0, 0, 0, time.UTC)
+	if d.Before(start) {
+		return false
+	}
+	every := max(1, r.every)
+	days := int(d.Sub(start).Hours() / 24)
+	switch r.frequency {
+	case "daily":
+		return days%every == 0
+	case "weekly":
+		return isoWeekday(d.Weekday()) == r.weekday && (days/7)%every == 0
+	case "monthly":
+		months := (d.Year()-start.Year())*12 + int(d.Month()) - int(start.Month())
+		if months%every != 0 {
+			return false
+		}
+		if r.dayOfMonth != 0 {
+			last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+			return d.Day() == min(r.dayOfMonth, last)
+		}
+		if isoWeekday(d.Weekday()) != r.weekday {
+			return false
+		}
+		if r.weekOfMonth == -1 {
+			return d.AddDate(0, 0, 7).Month() != d.Month()
+		}
+		return (d.Day()-1)/7+1 == r.weekOfMonth
+	}
+	return false
+}
+
+// next returns the first day from from on which the rule fires, within two
+// years.
+func (r recurrence) next(from time.Time) (time.Time, bool) {
+	for i := 0; i < 731; i++ {
+		if d := from.AddDate(0, 0, i); r.due(d) {
+			return d, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// describe renders the rule in Italian, e.g. "il primo lunedì di ogni mese".
+func (r recurrence) describe() string {
+	weekday := ""
+	if r.weekday != 0 {
+		weekday = strings.ToLower(italianWeekday(time.Weekday(r.weekday % 7)))
+	}
+	switch r.frequency {
+	case "daily":
+		if r.every == 1 {
+			return "ogni giorno"
+		}
+		return fmt.Sprintf("ogni %d giorni", r.every)
+	case "weekly":
+		if r.every == 1 {
+			return "ogni " + weekday
+		}
+		return fmt.Sprintf("ogni %d settimane, di %s", r.every, weekday)
+	case "monthly":
+		what := fmt.Sprintf("il giorno %d", r.dayOfMonth)
+		if r.dayOfMonth == 0 {
+			what = weekOfMonthNames[r.weekOfMonth] + " " + weekday
+		}
+		if r.every == 1 {
+			return what + " di ogni mese"
+		}
+		return fmt.Sprintf("%s, ogni %d mesi", what, r.every)
+	}
+	return r.frequency
+}
+
+// recurringTask is a recurring_tasks row with its room and cleaner names.
+type recurringTask struct {
+	id             int64
+	hotelID        int
+	roomID         int64
+	room           string
+	kind, title    string
+	notes          string
+	rule           recurrence
+	cleanerID      *int64
+	cleaner, shift string // shift "" = the cleaner's own
+	active         bool
+}
+
+const recurringColumns = `t.id, t.hotel_id, t.room_id, r.name, t.type, t.title, COALESCE(t.notes, ''),
+	t.frequency, t.every, t.weekday, t.week_of_month, t.day_of_month, t.starts_on,
+	t.cleaner_id, COALESCE(u.name, ''), COALESCE(t.shift, ''), t.active
+	FROM recurring_tasks t JOIN rooms r ON r.id = t.room_id
+	LEFT JOIN users u ON u.telegram_id = t.cleaner_id`
+
+func scanRecurring(row pgx.Row) (recurringTask, error) {
+	var t recurringTask
+	var weekday, weekOfMonth, dayOfMonth *int
+	if err := row.Scan(&t.id, &t.hotelID, &t.roomID, &t.room, &t.kind, &t.title, &t.notes,
+		&t.rule.frequency, &t.rule.every, &weekday, &weekOfMonth, &dayOfMonth, &t.rule.startsOn,
+		&t.cleanerID, &t.cleaner, &t.shift, &t.active); err != nil {
+		return t, err
+	}
+	for _, f := range []struct {
+		dst *int
+		src *int
+	}{{&t.rule.weekday, weekday}, {&t.rule.weekOfMonth, weekOfMonth}, {&t.rule.dayOfMonth, dayOfMonth}} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return t, nil
+}
+
+// nullInt stores an unset rule field as NULL.
+func nullInt(v int) *int {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// RecurringTasks materializes the recurring tasks every morning and provides
+// the tools to manage them.
+type RecurringTasks struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+	assigner  *AutoAssigner
+}
+
+func newRecurringTasks(adminPool *pgxpool.Pool, botToken string, assigner *AutoAssigner) *RecurringTasks {
+	return &RecurringTasks{adminPool: adminPool, botToken: botToken, assigner: assigner}
+}
+
+func (rt *RecurringTasks) Tools() []agent.Tool {
+	return []agent.Tool{&setRecurringTaskTool{}, &listRecurringTasksTool{}}
+}
+
+// Start creates the day's tasks every morning at RECURRING_TASKS_TIME, and
+// once at startup when the bot comes up after that time.
+func (rt *RecurringTasks) Start(ctx context.Context) {
+	timeStr := envOr("RECURRING_TASKS_TIME", "06:30")
+	hour, min, ok := parseClock(timeStr)
+	if !ok {
+		log.Printf("recurring tasks: disabled (RECURRING_TASKS_TIME=%q)", timeStr)
+		return
+	}
+	loc := romeLocation()
+
+	go func() {
+		now := time.Now().In(loc)
+		if at := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc); now.After(at) {
+			rt.run(ctx, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc))
+		}
+		for {
+			now := time.Now().In(loc)
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			rt.run(ctx, time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc))
+		}
+	}()
+}
+
+func (rt *RecurringTasks) run(ctx context.Context, day time.Time) {
+	created, err := rt.materialize(ctx, day)
+	if err != nil {
+		log.Printf("recurring tasks: %v", err)
+	}
+	if len(created) > 0 {
+		log.Printf("recurring tasks: %d assignments for %s", len(created), day.Format("2006-01-02"))
+		rt.notify(ctx, day, created)
+	}
+}
+
+// materialize creates the assignments of the rules due on day, skipping
+// rooms that already have a task of the same type that day.
+func (rt *RecurringTasks) materialize(ctx context.Context, day time.Time) ([]planEntry, error) {
+	rows, err := rt.adminPool.Query(ctx,
+		`SELECT `+recurringColumns+`
+		 WHERE t.active AND t.starts_on <= $1 AND (t.last_generated IS NULL OR t.last_generated < $1)
+		 ORDER BY r.floor, r.name`, day)
+	if err != nil {
+		return nil, fmt.Errorf("query recurring tasks: %w", err)
+	}
+	var due []recurringTask
+	for rows.Next() {
+		t, err := scanRecurring(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan recurring task: %w", err)
+		}
+		if t.rule.due(day) {
+			due = append(due, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(due) == 0 {
+		return nil, err
+	}
+
+	cleaners, err := rt.assigner.cleanersOn(ctx, day, 0)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = rt.adminPool.Query(ctx,
+		`SELECT cleaner_id, count(*)::int FROM assignments WHERE date = $1 GROUP BY cleaner_id`, day)
+	if err != nil {
+		return nil, fmt.Errorf("query load: %w", err)
+	}
+	load := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		load[id] = n
+	}
+	rows.Close()
+
+	var created []planEntry
+	for _, t := range due {
+		var pick *assignCleaner
+		for _, c := range cleaners {
+			if c.hotelID != t.hotelID {
+				continue
+			}
+			if t.cleanerID != nil && c.id == *t.cleanerID {
+				pick = c
+				break
+			}
+			if pick == nil || load[c.id] < load[pick.id] {
+				pick = c
+			}
+		}
+		if pick == nil {
+			log.Printf("recurring tasks: %s in room %s: no cleaner on shift", t.title, t.room)
+			continue
+		}
+		shift := t.shift
+		if shift == "" {
+			shift = pick.shift
+		}
+		notes := t.title
+		if t.notes != "" {
+			notes += ": " + t.notes
+		}
+		var inserted bool
+		err := pgx.BeginFunc(ctx, rt.adminPool, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO assignments (room_id, cleaner_id, date, shift, type, notes)
+				 SELECT $1, $2, $3, $4, $5, $6
+				 WHERE NOT EXISTS (SELECT 1 FROM assignments WHERE room_id = $1 AND date = $3 AND type = $5)`,
+				t.roomID, pick.id, day, shift, t.kind, notes)
+			if err != nil {
+				return fmt.Errorf("insert assignment: %w", err)
+			}
+			inserted = tag.RowsAffected() == 1
+			_, err = tx.Exec(ctx, `UPDATE recurring_tasks SET last_generated = $2 WHERE id = $1`, t.id, day)
+			return err
+		})
+		if err != nil {
+			return created, fmt.Errorf("recurring task %d: %w", t.id, err)
+		}
+		if inserted {
+			load[pick.id]++
+			created = append(created, planEntry{Date: day.Format("2006-01-02"), RoomID: t.roomID, RoomName: t.room,
+				CleanerID: pick.id, CleanerName: pick.name, Type: notes, Shift: shift})
+		}
+	}
+	return created, nil
+}
+
+// notify tells each cleaner about the recurring tasks added to their day.
+func (rt *RecurringTasks) notify(ctx context.Context, day time.Time, created []planEntry) {
+	byCleaner := make(map[int64][]planEntry)
+	var order []int64
+	for _, e := range created {
+		if _, ok := byCleaner[e.CleanerID]; !ok {
+			order = append(order, e.CleanerID)
+		}
+		byCleaner[e.CleanerID] = append(byCleaner[e.CleanerID], e)
+	}
+	tg := newBot(rt.botToken)
+	for _, id := range order {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "🧽 Attività programmate per %s %s:\n", strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01"))
+		for _, e := range byCleaner[id] {
+			fmt.Fprintf(&sb, "• %s — %s (turno di %s)\n", e.RoomName, e.Type, shiftNames[e.Shift])
+		}
+		sb.WriteString("\nSegnala inizio e fine come per le altre camere.")
+		if err := tg.Send(ctx, id, sb.String()); err != nil {
+			log.Printf("recurring tasks: notify %d: %v", id, err)
+		}
+	}
+}
+
+// ── set_recurring_task ───────────────────────────────────────────────────────
+
+type setRecurringTaskTool struct{}
+
+func (t *setRecurringTaskTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_recurring_task",
+		Description: "Crea o modifica (con id) un'attività ricorrente su una camera, di default una pulizia a fondo, " +
+			"che ogni mattina diventa un'assegnazione nei giorni previsti. Regole: daily (ogni N giorni), weekly " +
+			"(weekday, ogni N settimane), monthly (day_of_month, oppure weekday + week_of_month: 'ogni primo lunedì' = " +
+			"monthly, weekday=monday, week_of_month=1; -1 = ultimo). Senza cleaner va al meno carico in turno. " +
+			"active=false la sospende, delete=true la elimina. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"id": {"type": "integer", "description": "Attività da modificare o eliminare (da list_recurring_tasks)"},
+				"room": {"type": "string", "description": "Nome della camera"},
+				"title": {"type": "string", "description": "Default 'Pulizia a fondo'"},
+				"notes": {"type": "string", "description": "Istruzioni per il cleaner, es. 'materassi, tende, dietro i mobili'"},
+				"frequency": {"type": "string", "enum": ["daily", "weekly", "monthly"]},
+				"every": {"type": "integer", "description": "Ogni N giorni/settimane/mesi (default 1)"},
+				"weekday": {"type": "string", "enum": ["monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"]},
+				"week_of_month": {"type": "integer", "description": "Con monthly + weekday: 1-4, -1 = ultimo del mese"},
+				"day_of_month": {"type": "integer", "description": "Con monthly: giorno del mese 1-31"},
+				"starts_on": {"type": "string", "description": "Da quando, YYYY-MM-DD (default oggi)"},
+				"cleaner": {"type": "string", "description": "Cleaner fisso; stringa vuota = il meno carico in turno"},
+				"shift": {"type": "string", "enum": ["morning", "afternoon", "evening"], "description": "Default il turno del cleaner"},
+				"active": {"type": "boolean"},
+				"delete": {"type": "boolean"}
+			}
+		}`),
+	}
+}
+
+func (t *setRecurringTaskTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		ID          *int64  `json:"id"`
+		Room        string  `json:"room"`
+		Title       *string `json:"title"`
+		Notes       *string `json:"notes"`
+		Frequency   *string `json:"frequency"`
+		Every       *int    `json:"every"`
+		Weekday     *string `json:"weekday"`
+		WeekOfMonth *int    `json:"week_of_month"`
+		DayOfMonth  *int    `json:"day_of_month"`
+		StartsOn    string  `json:"starts_on"`
+		Cleaner     *string `json:"cleaner"`
+		Shift       *string `json:"shift"`
+		Active      *bool   `json:"active"`
+		Delete      bool    `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_recurring_task is only available to managers")
+	}
+
+	if in.Delete {
+		if in.ID == nil {
+			return "", fmt.Errorf("delete needs the id")
+		}
+		var title, room string
+		err := db.QueryRow(bg,
+			`DELETE FROM recurring_tasks t USING rooms r
+			 WHERE t.id = $1 AND r.id = t.room_id RETURNING t.title, r.name`, *in.ID).Scan(&title, &room)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("recurring task %d not found", *in.ID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("delete recurring task: %w", err)
+		}
+		return fmt.Sprintf("🗑 Attività ricorrente %d eliminata (%s, camera %s). Le assegnazioni già create restano.", *in.ID, title, room), nil
+	}
+
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	task := recurringTask{kind: "deep_clean", title: "Pulizia a fondo", active: true,
+		rule: recurrence{every: 1, startsOn: today}}
+	if in.ID != nil {
+		task, err = scanRecurring(db.QueryRow(bg, `SELECT `+recurringColumns+` WHERE t.id = $1`, *in.ID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("recurring task %d not found", *in.ID)
+		}
+		if err != nil {
+			return "", fmt.Errorf("load recurring task: %w", err)
+		}
+	} else if in.Room == "" || in.Frequency == nil {
+		return "", fmt.Errorf("a new recurring task needs room and frequency")
+	}
+
+	if in.Room != "" {
+		err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower(trim($1))`, in.Room).Scan(&task.roomID, &task.room)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("room %q not found", in.Room)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if in.Title != nil && strings.TrimSpace(*in.Title) != "" {
+		task.title = strings.TrimSpace(*in.Title)
+	}
+	if in.Notes != nil {
+		task.notes = strings.TrimSpace(*in.Notes)
+	}
+	// A new frequency replaces the whole rule.
+	if in.Frequency != nil {
+		task.rule.frequency = *in.Frequency
+		task.rule.weekday, task.rule.weekOfMonth, task.rule.dayOfMonth = 0, 0, 0
+	}
+	if in.Every != nil {
+		task.rule.every = *in.Every
+	}
+	if in.Weekday != nil {
+		task.rule.weekday = 0
+		for i, name := range isoWeekdays {
+			if i > 0 && name == strings.ToLower(*in.Weekday) {
+				task.rule.weekday = i
+			}
+		}
+		if task.rule.weekday == 0 && *in.Weekday != "" {
+			return "", fmt.Errorf("weekday must be monday-sunday")
+		}
+	}
+	if in.WeekOfMonth != nil {
+		task.rule.weekOfMonth = *in.WeekOfMonth
+	}
+	if in.DayOfMonth != nil {
+		task.rule.dayOfMonth = *in.DayOfMonth
+	}
+	if in.StartsOn != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.StartsOn, loc)
+		if err != nil {
+			return "", fmt.Errorf("starts_on must be YYYY-MM-DD: %w", err)
+		}
+		task.rule.startsOn = d
+	}
+	if err := task.rule.validate(); err != nil {
+		return "", err
+	}
+	if in.Cleaner != nil {
+		task.cleanerID, task.cleaner = nil, ""
+		if name := strings.TrimSpace(*in.Cleaner); name != "" {
+			var id int64
+			err := db.QueryRow(bg,
+				`SELECT telegram_id, name FROM users WHERE role = 'cleaner' AND lower(name) = lower($1)`, name,
+			).Scan(&id, &task.cleaner)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return "", fmt.Errorf("cleaner %q not found", name)
+			}
+			if err != nil {
+				return "", err
+			}
+			task.cleanerID = &id
+		}
+	}
+	if in.Shift != nil {
+		task.shift = *in.Shift
+	}
+	if in.Active != nil {
+		task.active = *in.Active
+	}
+
+	r := task.rule
+	if in.ID == nil {
+		err = db.QueryRow(bg,
+			`INSERT INTO recurring_tasks (room_id, type, title, notes, frequency, every, weekday, week_of_month,
+			                              day_of_month, starts_on, cleaner_id, shift, active, created_by)
+			 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, $14)
+			 RETURNING id`,
+			task.roomID, task.kind, task.title, task.notes, r.frequency, r.every, nullInt(r.weekday),
+			nullInt(r.weekOfMonth), nullInt(r.dayOfMonth), r.startsOn, task.cleanerID, task.shift, task.active, ctx.UserID,
+		).Scan(&task.id)
+	} else {
+		_, err = db.Exec(bg,
+			`UPDATE recurring_tasks SET room_id = $2, title = $3, notes = NULLIF($4, ''), frequency = $5, every = $6,
+			        weekday = $7, week_of_month = $8, day_of_month = $9, starts_on = $10, cleaner_id = $11,
+			        shift = NULLIF($12, ''), active = $13
+			 WHERE id = $1`,
+			task.id, task.roomID, task.title, task.notes, r.frequency, r.every, nullInt(r.weekday),
+			nullInt(r.weekOfMonth), nullInt(r.dayOfMonth), r.startsOn, task.cleanerID, task.shift, task.active)
+	}
+	if err != nil {
+		return "", fmt.Errorf("save recurring task: %w", err)
+	}
+
+	verb := "creata"
+	if in.ID != nil {
+		verb = "aggiornata"
+	}
+	return fmt.Sprintf("🧽 Attività ricorrente %d %s: %s", task.id, verb, formatRecurring(task, today)), nil
+}
+
+// formatRecurring describes a recurring task with its next occurrence.
+func formatRecurring(t recurringTask, today time.Time) string {
+	line := fmt.Sprintf("%s, camera %s, %s", t.title, t.room, t.rule.describe())
+	switch {
+	case t.cleaner != "" && t.shift != "":
+		line += fmt.Sprintf(" (%s, turno di %s)", t.cleaner, shiftNames[t.shift])
+	case t.cleaner != "":
+		line += fmt.Sprintf(" (%s)", t.cleaner)
+	case t.shift != "":
+		line += fmt.Sprintf(" (turno di %s)", shiftNames[t.shift])
+	}
+	if !t.active {
+		return line + " — sospesa"
+	}
+	if next, ok := t.rule.next(today); ok {
+		line += fmt.Sprintf(" — prossima: %s %s", strings.ToLower(italianWeekday(next.Weekday())), next.Format("02/01/2006"))
+	}
+	return line
+}
+
+// ── list_recurring_tasks ─────────────────────────────────────────────────────
+
+type listRecurringTasksTool struct{}
+
+func (t *listRecurringTasksTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "list_recurring_tasks",
+		Description: "Elenca le attività ricorrenti (pulizie a fondo programmate) con la regola e la prossima data, opzionalmente di una camera.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Solo questa camera"}
+			}
+		}`),
+	}
+}
+
+func (t *listRecurringTasksTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room string `json:"room"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT `+recurringColumns+`
+		 WHERE $1 = '' OR lower(r.name) = lower(trim($1))
+		 ORDER BY r.floor, r.name, t.id`, in.Room)
+	if err != nil {
+		return "", fmt.Errorf("query recurring tasks: %w", err)
+	}
+	defer rows.Close()
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var lines []string
+	for rows.Next() {
+		task, err := scanRecurring(rows)
+		if err != nil {
+			return "", err
+		}
+		line := fmt.Sprintf("#%d %s", task.id, formatRecurring(task, today))
+		if task.notes != "" {
+			line += "\n   📝 " + task.notes
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "Nessuna attività ricorrente.", nil
+	}
+	return "🧽 Attività ricorrenti:\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Redaction of guest phone numbers, identity document numbers and passwords
+// in everything the process logs. The standard logger and the SDK's
+// structured JSON log lines (agent.Logger writes to os.Stdout) both pass
+// through a redactor before reaching the file descriptor journald or the
+// container runtime stores. In JSON lines only string values are rewritten,
+// so user and chat IDs stay readable.
+//
+// Built-in patterns can be turned off by name with REDACT_DISABLE (comma
+// separated: phone, document, password, url-credentials); REDACT_PATTERNS_FILE
+// adds one regular expression per line (blank lines and # comments ignored),
+// each match replaced with [REDACTED].
+//
+// Session transcripts are redacted by the startup repair pass
+// (sessionrepair.go): the SDK session store writes its JSONL files itself and
+// the agent exposes no hook in front of it, so the current run's events reach
+// disk in clear until the next startup. Guest documents are kept out of them
+// altogether by the /documento form (see guestdocs.go). There is no audit log.
+
+const redactedText = "[REDACTED]"
+
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+	repl string
+}
+
+var builtinRedactions = []redactRule{
+	// user:password@ in connection strings, e.g. DATABASE_URL.
+	{"url-credentials", regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`), "${1}" + redactedText + "@"},
+	// password=…, pwd: …, and SQL PASSWORD '…' (role creation).
+	{"password", regexp.MustCompile(`(?i)\b(password|passwd|pwd)(\s*[:=]\s*)("[^"]*"|'[^']*'|\S+)`), "${1}${2}" + redactedText},
+	{"password", regexp.MustCompile(`(?i)\b(password\s+)'[^']*'`), "${1}'" + redactedText + "'"},
+	// Carta d'identità elettronica, passport, codice fiscale.
+	{"document", regexp.MustCompile(`\b(?:[A-Z]{2}\d{5}[A-Z]{2}|[A-Z]{2}\d{7}|[A-Z]{6}\d{2}[A-Z]\d{2}[A-Z]\d{3}[A-Z])\b`), redactedText},
+	// International (+39, 0049), Italian mobile (3xx) and landline (0x) numbers.
+	{"phone", regexp.MustCompile(`(?:\+|\b00)\d{1,3}[\s.-]?\d(?:[\s.-]?\d){6,12}\b|\b3\d{2}[\s.-]?\d{3}[\s.-]?\d{3,4}\b|\b0\d{1,3}[\s.-]\d{5,8}\b`), redactedText},
+}
+
+type redactor struct {
+	rules []redactRule
+}
+
+// newRedactor builds the redactor from the built-in patterns and the
+// REDACT_DISABLE / REDACT_PATTERNS_FILE settings.
+func newRedactor() (*redactor, error) {
+	disabled := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv("REDACT_DISABLE"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			disabled[name] = true
+		}
+	}
+	r := &redactor{}
+	for _, rule := range builtinRedactions {
+		if !disabled[rule.name] {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	path := os.Getenv("REDACT_PATTERNS_FILE")
+	if path == "" {
+		return r, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		r.rules = append(r.rules, redactRule{name: "custom", re: re, repl: redactedText})
+	}
+	return r, nil
+}
+
+// String masks every match of the rules in s.
+func (r *redactor) String(s string) string {
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+	return s
+}
+
+// Writer wraps w so every write is redacted first. The standard logger
+// issues one write per entry, so a pattern never spans two writes.
+func (r *redactor) Writer(w io.Writer) io.Writer {
+	return redactWriter{r: r, w: w}
+}
+
+type redactWriter struct {
+	r *redactor
+	w io.Writer
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CaptureStdout replaces os.Stdout with a pipe and copies it, line by line
+// and redacted, to the real stdout. Call it before anything else writes to
+// os.Stdout: the SDK logger looks the variable up on every entry.
+func (r *redactor) CaptureStdout() error {
+	out := os.Stdout
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout = pw
+	go func() {
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for sc.Scan() {
+			out.Write(append(r.line(sc.Bytes()), '\n'))
+		}
+		if err := sc.Err(); err != nil {
+			log.Printf("warn: redact stdout: %v", err)
+			io.Copy(out, pr)
+		}
+	}()
+	return nil
+}
+
+// line redacts one line of output: the string values of a JSON object, or
+// the whole text otherwise.
+func (r *redactor) line(b []byte) []byte {
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return []byte(r.String(string(b)))
+	}
+	var v map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []byte(r.String(string(b)))
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r.value(v)); err != nil {
+		return []byte(r.String(string(b)))
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+}
+
+// event redacts the string values of the message in one session transcript
+// line (newline included), leaving ids and timestamps alone so the parentId
+// chain holds. It reports whether anything was masked.
+func (r *redactor) event(line []byte) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(line, &fields) != nil || fields["message"] == nil {
+		return line, false
+	}
+	raw := fields["message"]
+	if r.String(string(raw)) == string(raw) {
+		return line, false
+	}
+	var msg any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if dec.Decode(&msg) != nil {
+		return line, false
+	}
+	before, err := json.Marshal(msg)
+	if err != nil {
+		return line, false
+	}
+	after, err := json.Marshal(r.value(msg))
+	if err != nil || bytes.Equal(before, after) {
+		return line, false
+	}
+	fields["message"] = after
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return line, false
+	}
+	return append(out, '\n'), true
+}
+
+func (r *redactor) value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case map[string]any:
+		for k, x := range v {
+			v[k] = r.value(x)
+		}
+		return v
+	case []any:
+		for i, x := range v {
+			v[i] = r.value(x)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HotelRelay lets the bots of an owner's properties, each its own deployment,
+// ask each other questions ("does Hotel B have a free double on Friday?").
+// A manager asks with ask_hotel; the question is POSTed to the peer's /relay
+// endpoint, which stores it in relay_messages and publishes it on its
+// persistent bus as a relay event for its manager, attributed to the asking
+// hotel. That agent looks up the answer with its own tools and sends it back
+// with reply_to_hotel; the answer reaches the asking manager the same way.
+//
+// Each pair of instances shares its own secret, and a request carries an
+// HMAC-SHA256 of the timestamp and body under the secret of the peer it
+// claims to come from: a peer cannot speak for another. Requests older than
+// relaySkew and senders not listed in RELAY_PEERS are refused, and a repeated
+// message is stored once (relay_messages_peer_remote_id_key).
+//
+// Configure via env:
+//
+//	RELAY_PEERS=Hotel B=https://b.example.com=s3cr3t,Hotel C=https://c.example.com=…
+//	                 name, base URL (the endpoint is <URL>/relay) and shared secret of
+//	                 the other instances; Hotel B lists this one with the same secret.
+//	                 Empty disables the relay
+//	RELAY_NAME=…     this instance's name in the peers' RELAY_PEERS (default HOTEL_NAME)
+type HotelRelay struct {
+	adminPool *pgxpool.Pool
+	bus       agent.EventBus
+	managerID int64
+	name      string
+	peers     map[string]relayPeer
+	client    *http.Client
+}
+
+// relayPeer is another instance of RELAY_PEERS.
+type relayPeer struct {
+	url    string // base URL
+	secret []byte // shared with that instance only
+}
+
+// relaySkew bounds the age of a signed request, against replays.
+const relaySkew = 5 * time.Minute
+
+func newHotelRelay(adminPool *pgxpool.Pool, bus agent.EventBus, managerID int64, hotelName string) *HotelRelay {
+	r := &HotelRelay{
+		adminPool: adminPool,
+		bus:       bus,
+		managerID: managerID,
+		name:      envOr("RELAY_NAME", hotelName),
+		peers:     make(map[string]relayPeer),
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, p := range strings.Split(envOr("RELAY_PEERS", ""), ",") {
+		// The secret comes last: it may contain '=' (base64 padding).
+		f := strings.SplitN(p, "=", 3)
+		if len(f) != 3 || strings.TrimSpace(f[0]) == "" || strings.TrimSpace(f[1]) == "" || strings.TrimSpace(f[2]) == "" {
+			if strings.TrimSpace(p) != "" {
+				log.Printf("relay: ignoring peer %q (want Name=URL=secret)", f[0])
+			}
+			continue
+		}
+		r.peers[strings.TrimSpace(f[0])] = relayPeer{
+			url:    strings.TrimRight(strings.TrimSpace(f[1]), "/"),
+			secret: []byte(strings.TrimSpace(f[2])),
+		}
+	}
+	if envOr("RELAY_SECRET", "") != "" {
+		log.Printf("relay: RELAY_SECRET is no longer used, give each peer its own secret in RELAY_PEERS")
+	}
+	if r.enabled() {
+		log.Printf("relay: %s, %d peer(s)", r.name, len(r.peers))
+	}
+	return r
+}
+
+func (r *HotelRelay) enabled() bool {
+	return len(r.peers) > 0
+}
+
+// Tools implements agent.ToolSet; none when the relay is not configured.
+func (r *HotelRelay) Tools() []agent.Tool {
+	if !r.enabled() {
+		return nil
+	}
+	return []agent.Tool{&askHotelTool{r: r}, &replyToHotelTool{r: r}}
+}
+
+// peer resolves a peer name, exact match first, then by prefix.
+func (r *HotelRelay) peer(name string) (string, relayPeer, error) {
+	name = strings.TrimSpace(name)
+	names := make([]string, 0, len(r.peers))
+	for n := range r.peers {
+		if strings.EqualFold(n, name) {
+			return n, r.peers[n], nil
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if strings.HasPrefix(strings.ToLower(n), strings.ToLower(name)) {
+			return n, r.peers[n], nil
+		}
+	}
+	return "", relayPeer{}, fmt.Errorf("nessun hotel collegato si chiama %q: %s", name, strings.Join(names, ", "))
+}
+
+// relayMessage is the body of a POST to /relay. ID is the sender's
+// relay_messages id; an answer carries in ReplyTo the id of the question on
+// the receiving side.
+type relayMessage struct {
+	From    string `json:"from"`
+	Kind    string `json:"kind"` // "ask" or "answer"
+	ID      int64  `json:"id"`
+	ReplyTo int64  `json:"reply_to,omitempty"`
+	Text    string `json:"text"`
+}
+
+func sign(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// send POSTs msg to peer p, signed with its secret.
+func (r *HotelRelay) send(ctx context.Context, p relayPeer, msg relayMessage) error {
+	msg.From = r.name
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/relay", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Relay-Timestamp", ts)
+	req.Header.Set("X-Relay-Signature", sign(p.secret, ts, body))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// ServeHTTP receives questions and answers from the peers.
+func (r *HotelRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var msg relayMessage
+	if err := json.Unmarshal(body, &msg); err != nil || msg.ID == 0 || strings.TrimSpace(msg.Text) == "" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// From is only trusted once the body is signed with that peer's secret.
+	p, ok := r.peers[msg.From]
+	if !ok {
+		http.Error(w, "unknown peer", http.StatusForbidden)
+		return
+	}
+	ts := req.Header.Get("X-Relay-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)).Abs() > relaySkew ||
+		!hmac.Equal([]byte(req.Header.Get("X-Relay-Signature")), []byte(sign(p.secret, ts, body))) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	switch msg.Kind {
+	case "ask":
+		err = r.receiveQuestion(req.Context(), msg)
+	case "answer":
+		err = r.receiveAnswer(req.Context(), msg)
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("relay: %s from %s: %v", msg.Kind, msg.From, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// receiveQuestion stores a peer's question and hands it to the manager agent.
+func (r *HotelRelay) receiveQuestion(ctx context.Context, msg relayMessage) error {
+	if r.managerID == 0 {
+		return fmt.Errorf("no manager to answer")
+	}
+	var id int64
+	err := r.adminPool.QueryRow(ctx,
+		`INSERT INTO relay_messages (direction, peer, remote_id, question) VALUES ('in', $1, $2, $3)
+		 ON CONFLICT (peer, direction, remote_id) DO NOTHING RETURNING id`,
+		msg.From, msg.ID, strings.TrimSpace(msg.Text)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // already received
+	}
+	if err != nil {
+		return err
+	}
+	r.bus.Publish(agent.AgentEvent{
+		Kind:     agent.EventRelay,
+		TargetID: r.managerID,
+		ChatID:   r.managerID,
+		Content: fmt.Sprintf("Question from %s, another property of the same owner (relay #%d): %s\n"+
+			"Look up the answer with this hotel's data and send it with reply_to_hotel(relay_id=%d). "+
+			"Share availability, prices and operational facts only, never guests' personal data.",
+			msg.From, id, strings.TrimSpace(msg.Text), id),
+		Source:  "🏨 " + msg.From,
+		EventID: generateUUID(),
+	})
+	return nil
+}
+
+// receiveAnswer records a peer's answer and hands it to the manager who asked.
+func (r *HotelRelay) receiveAnswer(ctx context.Context, msg relayMessage) error {
+	var askedBy *int64
+	var question string
+	err := r.adminPool.QueryRow(ctx,
+		`UPDATE relay_messages SET answer = $3, answered_at = now()
+		 WHERE id = $1 AND direction = 'out' AND peer = $2 AND answer IS NULL
+		 RETURNING asked_by, question`, msg.ReplyTo, msg.From, strings.TrimSpace(msg.Text),
+	).Scan(&askedBy, &question)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // unknown or already answered
+	}
+	if err != nil {
+		return err
+	}
+	target := r.managerID
+	if askedBy != nil {
+		target = *askedBy
+	}
+	r.bus.Publish(agent.AgentEvent{
+		Kind:     agent.EventRelay,
+		TargetID: target,
+		ChatID:   target,
+		Content: fmt.Sprintf("Answer from %s to the question \"%s\" (relay #%d): %s\nReport it to the user.",
+			msg.From, question, msg.ReplyTo, strings.TrimSpace(msg.Text)),
+		Source:  "🏨 " + msg.From,
+		EventID: generateUUID(),
+	})
+	return nil
+}
+
+// ── ask_hotel ────────────────────────────────────────────────────────────────
+
+type askHotelTool struct {
+	r *HotelRelay
+}
+
+func (t *askHotelTool) Def() llm.ToolDef {
+	names := make([]string, 0, len(t.r.peers))
+	for n := range t.r.peers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return llm.ToolDef{
+		Name: "ask_hotel",
+		Description: "Fa una domanda al bot di un'altra struttura dello stesso proprietario (" + strings.Join(names, ", ") + "), " +
+			"es. 'avete una doppia libera venerdì?'. La risposta arriva più tardi in questa chat. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"hotel": {"type": "string", "description": "Struttura a cui chiedere"},
+				"question": {"type": "string", "description": "Domanda, completa di date e dettagli"}
+			},
+			"required": ["hotel", "question"]
+		}`),
+	}
+}
+
+func (t *askHotelTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Hotel    string `json:"hotel"`
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Question) == "" {
+		return "", fmt.Errorf("question is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("ask_hotel is only available to managers")
+	}
+	peer, p, err := t.r.peer(in.Hotel)
+	if err != nil {
+		return "", err
+	}
+
+	// Committed only once the peer has accepted the question.
+	var id int64
+	err = pgx.BeginFunc(bg, t.r.adminPool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(bg,
+			`INSERT INTO relay_messages (direction, peer, asked_by, question) VALUES ('out', $1, $2, $3) RETURNING id`,
+			peer, ctx.UserID, strings.TrimSpace(in.Question)).Scan(&id); err != nil {
+			return err
+		}
+		return t.r.send(bg, p, relayMessage{Kind: "ask", ID: id, Text: strings.TrimSpace(in.Question)})
+	})
+	if err != nil {
+		return "", fmt.Errorf("domanda a %s non inviata: %w", peer, err)
+	}
+	return fmt.Sprintf("📨 Domanda #%d inviata a %s: la risposta arriverà in questa chat.", id, peer), nil
+}
+
+// ── reply_to_hotel ───────────────────────────────────────────────────────────
+
+type replyToHotelTool struct {
+	r *HotelRelay
+}
+
+func (t *replyToHotelTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "reply_to_hotel",
+		Description: "Risponde a una domanda arrivata da un'altra struttura dello stesso proprietario (relay #N). " +
+			"Solo disponibilità, prezzi e informazioni operative: mai dati personali degli ospiti. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"relay_id": {"type": "integer", "description": "Numero della domanda (relay #N)"},
+				"answer": {"type": "string", "description": "Risposta"}
+			},
+			"required": ["relay_id", "answer"]
+		}`),
+	}
+}
+
+func (t *replyToHotelTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		RelayID int64  `json:"relay_id"`
+		Answer  string `json:"answer"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Answer) == "" {
+		return "", fmt.Errorf("answer is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("reply_to_hotel is only available to managers")
+	}
+
+	var peer string
+	err = pgx.BeginFunc(bg, t.r.adminPool, func(tx pgx.Tx) error {
+		var remoteID int64
+		err := tx.QueryRow(bg,
+			`UPDATE relay_messages SET answer = $2, answered_by = $3, answered_at = now()
+			 WHERE id = $1 AND direction = 'in' AND answer IS NULL
+			 RETURNING peer, remote_id`, in.RelayID, strings.TrimSpace(in.Answer), ctx.UserID,
+		).Scan(&peer, &remoteID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("domanda relay #%d non trovata o già risposta", in.RelayID)
+		}
+		if err != nil {
+			return err
+		}
+		p, ok := t.r.peers[peer]
+		if !ok {
+			return fmt.Errorf("%s non è più tra gli hotel collegati", peer)
+		}
+		return t.r.send(bg, p, relayMessage{Kind: "answer", ID: in.RelayID, ReplyTo: remoteID, Text: strings.TrimSpace(in.Answer)})
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("📨 Risposta inviata a %s (relay #%d).", peer, in.RelayID), nil
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -40,9 +45,26 @@ type dueReminder struct {
 }
 
 func fireReminders(ctx context.Context, pool *pgxpool.Pool, bus agent.EventBus) {
+	// A reservation's cleaner reminders go to every cleaner of the property
+	// (nobody is assigned when they are scheduled); once the room has an
+	// assignment that day, only its cleaner gets one.
+	if _, err := pool.Exec(ctx,
+		`UPDATE reminders m SET cancelled_at = now()
+		 FROM reservations res, users u
+		 WHERE m.reservation_id = res.id AND u.telegram_id = m.chat_id AND u.role = 'cleaner'
+		   AND m.fire_at <= now() AND m.fired_at IS NULL AND m.cancelled_at IS NULL
+		   AND EXISTS (SELECT 1 FROM assignments a
+		               WHERE a.room_id = res.room_id AND a.date = (m.fire_at AT TIME ZONE 'Europe/Rome')::date)
+		   AND NOT EXISTS (SELECT 1 FROM assignments a
+		                   WHERE a.room_id = res.room_id AND a.date = (m.fire_at AT TIME ZONE 'Europe/Rome')::date
+		                     AND a.cleaner_id = m.chat_id)`,
+	); err != nil && ctx.Err() == nil {
+		log.Printf("reminder narrow to assigned cleaner: %v", err)
+	}
+
 	rows, err := pool.Query(ctx,
 		`SELECT id, chat_id, message FROM reminders
-		 WHERE fire_at <= now() AND fired_at IS NULL
+		 WHERE fire_at <= now() AND fired_at IS NULL AND cancelled_at IS NULL
 		 ORDER BY fire_at`,
 	)
 	if err != nil {
@@ -83,3 +105,204 @@ func fireReminders(ctx context.Context, pool *pgxpool.Pool, bus agent.EventBus)
 		}
 	}
 }
+
+// Standard reminders of a reservation. Every confirmed reservation gets one
+// reminder per active reminder_templates row and recipient, offset_minutes
+// before its checkin or checkout: the reservations_schedule_reminders trigger
+// (db/rls.sql) schedules them whichever path writes the reservation, and
+// reschedules or cancels them when its dates, room or status change.
+// Managers edit the set with set_reminder_template.
+
+var defaultReminderTemplates = []struct {
+	code, event, audience, message string
+	offset                         int
+}{
+	{"checkout_pulizia", "checkout", "cleaner",
+		"🧹 Alle {time} l'ospite {guest} lascia la camera {room}: tra poco si può pulire.", 45},
+	{"checkin_ispezione", "checkin", "manager",
+		"🔍 Alle {time} arriva {guest} in camera {room}: controlla che la camera sia pronta.", 30},
+}
+
+// seedReminderTemplates adds the default reminders to every property and,
+// when any was added, schedules them for the upcoming reservations. Safe to
+// call on every boot: templates edited or deactivated by managers are kept.
+func seedReminderTemplates(ctx context.Context, pool *pgxpool.Pool) error {
+	var added int64
+	for _, t := range defaultReminderTemplates {
+		tag, err := pool.Exec(ctx,
+			`INSERT INTO reminder_templates (hotel_id, code, event, offset_minutes, audience, message)
+			 SELECT id, $1, $2, $3, $4, $5 FROM hotels
+			 ON CONFLICT (hotel_id, code) DO NOTHING`,
+			t.code, t.event, t.offset, t.audience, t.message,
+		)
+		if err != nil {
+			return fmt.Errorf("seed reminder template %s: %w", t.code, err)
+		}
+		added += tag.RowsAffected()
+	}
+	if added == 0 {
+		return nil
+	}
+	return rescheduleReservationReminders(ctx, pool)
+}
+
+// rescheduleReservationReminders rebuilds the standard reminders of every
+// confirmed reservation not yet checked out, after the templates changed.
+func rescheduleReservationReminders(ctx context.Context, db querier) error {
+	rows, err := db.Query(ctx,
+		`SELECT schedule_reservation_reminders(id) FROM reservations
+		 WHERE status = 'confirmed' AND checkout_at > now()`)
+	if err != nil {
+		return fmt.Errorf("reschedule reservation reminders: %w", err)
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+var reminderEvents = map[string]string{"checkin": "dell'arrivo", "checkout": "della partenza"}
+
+var reminderAudiences = map[string]string{"cleaner": "il cleaner della camera (tutti se non è assegnata)", "manager": "i manager"}
+
+// ── reminder_templates ───────────────────────────────────────────────────────
+
+type reminderTemplatesTool struct{}
+
+func (t *reminderTemplatesTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "reminder_templates",
+		Description: "Elenca i promemoria standard creati automaticamente per ogni prenotazione confermata " +
+			"(es. 45 minuti prima del checkout ai cleaner, 30 minuti prima del checkin per l'ispezione).",
+		Parameters: json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (t *reminderTemplatesTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT code, event, offset_minutes, audience, message, active FROM reminder_templates
+		 ORDER BY event, offset_minutes DESC, code`)
+	if err != nil {
+		return "", fmt.Errorf("query reminder templates: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	for rows.Next() {
+		var code, event, audience, message string
+		var offset int
+		var active bool
+		if err := rows.Scan(&code, &event, &offset, &audience, &message, &active); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "• %s — %d min prima %s, a %s", code, offset, reminderEvents[event], reminderAudiences[audience])
+		if !active {
+			sb.WriteString(" (sospeso)")
+		}
+		fmt.Fprintf(&sb, "\n   %s\n", message)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if sb.Len() == 0 {
+		return "Nessun promemoria standard.", nil
+	}
+	return "⏰ Promemoria automatici delle prenotazioni:\n" + sb.String(), nil
+}
+
+// ── set_reminder_template ────────────────────────────────────────────────────
+
+type setReminderTemplateTool struct{}
+
+func (t *setReminderTemplateTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_reminder_template",
+		Description: "Crea o modifica (per codice) un promemoria standard delle prenotazioni: quanti minuti prima del " +
+			"checkin o del checkout, a chi (cleaner o manager) e il testo, con {room}, {guest} e {time}. active=false lo " +
+			"sospende, delete=true lo elimina. I promemoria delle prenotazioni future vengono ricalcolati. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"code": {"type": "string", "description": "Codice breve, es. 'checkout_pulizia'"},
+				"event": {"type": "string", "enum": ["checkin", "checkout"]},
+				"minutes_before": {"type": "integer", "description": "Minuti prima dell'evento (0-1440)"},
+				"audience": {"type": "string", "enum": ["cleaner", "manager"], "description": "cleaner = il cleaner assegnato alla camera quel giorno (tutti se nessuno), manager = tutti i manager"},
+				"message": {"type": "string", "description": "Testo, es. 'Alle {time} parte {guest} dalla {room}'"},
+				"active": {"type": "boolean"},
+				"delete": {"type": "boolean"}
+			},
+			"required": ["code"]
+		}`),
+	}
+}
+
+func (t *setReminderTemplateTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Code          string  `json:"code"`
+		Event         *string `json:"event"`
+		MinutesBefore *int    `json:"minutes_before"`
+		Audience      *string `json:"audience"`
+		Message       *string `json:"message"`
+		Active        *bool   `json:"active"`
+		Delete        bool    `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	in.Code = strings.TrimSpace(in.Code)
+	if in.Code == "" {
+		return "", fmt.Errorf("code is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_reminder_template is only available to managers")
+	}
+
+	verb := "aggiornato"
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		if in.Delete {
+			tag, err := tx.Exec(bg, `DELETE FROM reminder_templates WHERE code = $1`, in.Code)
+			if err != nil {
+				return fmt.Errorf("delete template: %w", err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("reminder template %q not found", in.Code)
+			}
+			verb = "eliminato"
+			return rescheduleReservationReminders(bg, tx)
+		}
+		tag, err := tx.Exec(bg,
+			`UPDATE reminder_templates SET
+			   event = COALESCE($2, event), offset_minutes = COALESCE($3, offset_minutes),
+			   audience = COALESCE($4, audience), message = COALESCE(NULLIF(trim($5), ''), message),
+			   active = COALESCE($6, active)
+			 WHERE code = $1`,
+			in.Code, in.Event, in.MinutesBefore, in.Audience, in.Message, in.Active)
+		if err != nil {
+			return fmt.Errorf("update template: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			if in.Event == nil || in.MinutesBefore == nil || in.Audience == nil || in.Message == nil {
+				return fmt.Errorf("a new reminder template needs event, minutes_before, audience and message")
+			}
+			if _, err := tx.Exec(bg,
+				`INSERT INTO reminder_templates (code, event, offset_minutes, audience, message, active)
+				 VALUES ($1, $2, $3, $4, trim($5), COALESCE($6, true))`,
+				in.Code, *in.Event, *in.MinutesBefore, *in.Audience, *in.Message, in.Active); err != nil {
+				return fmt.Errorf("insert template: %w", err)
+			}
+			verb = "creato"
+		}
+		return rescheduleReservationReminders(bg, tx)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("⏰ Promemoria %s %s; ricalcolati quelli delle prenotazioni future.", in.Code, verb), nil
+}
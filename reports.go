@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Report builder: a question a manager asks once ("quante notti abbiamo
+// venduto per canale questo mese?") becomes a report they can ask for again,
+// or receive on a schedule. The conversation drives it (the manager prompt
+// describes the flow):
+//
+//  1. the manager describes the report; the model drafts the SQL;
+//  2. preview_report runs the draft read-only through the manager's pool and
+//     shows the first rows and the total, the model iterates on feedback;
+//  3. save_report stores it as a saved query (saved_queries, the same table
+//     behind the heartbeat placeholders), optionally with a schedule that
+//     reuses the recurring task rules (recurrence): daily, weekly on a
+//     weekday, monthly on a day or on the N-th weekday, at send_at;
+//  4. run_report and list_reports bring it back later.
+//
+// Every minute the scheduled reports due today and past their time are run
+// through their recipient's pool (RLS applies to what they reveal) and sent
+// to them; last_sent_on keeps a report from going out twice in a day. Results
+// too long for the chat go out as a CSV file (results.go).
+
+// reportPreviewRows is how many rows preview_report shows by default.
+const reportPreviewRows = 10
+
+var reportNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ReportBuilder provides the report tools and sends the scheduled reports.
+type ReportBuilder struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+}
+
+func newReportBuilder(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string) *ReportBuilder {
+	return &ReportBuilder{adminPool: adminPool, registry: registry, botToken: botToken}
+}
+
+// Tools implements agent.ToolSet.
+func (rb *ReportBuilder) Tools() []agent.Tool {
+	return []agent.Tool{&previewReportTool{}, &saveReportTool{}, &runReportTool{rb: rb}, &listReportsTool{}}
+}
+
+// report is a saved_queries row with its schedule.
+type report struct {
+	hotelID                int
+	name, description, sql string
+	rule                   recurrence // frequency "" = not scheduled
+	sendAt                 string     // HH:MM
+	recipientID            int64      // 0 = nobody
+	recipient              string
+	createdBy              int64 // 0 = unknown
+	lastSent               *time.Time
+}
+
+const reportColumns = `q.hotel_id, q.name, COALESCE(q.description, ''), q.sql, COALESCE(q.schedule, ''),
+	q.weekday, q.week_of_month, q.day_of_month, to_char(q.send_at, 'HH24:MI'),
+	COALESCE(q.recipient, 0), COALESCE(u.name, ''), COALESCE(q.created_by, 0), q.last_sent_on
+	FROM saved_queries q LEFT JOIN users u ON u.telegram_id = q.recipient`
+
+func scanReport(row pgx.Row) (report, error) {
+	var r report
+	var weekday, weekOfMonth, dayOfMonth *int
+	if err := row.Scan(&r.hotelID, &r.name, &r.description, &r.sql, &r.rule.frequency,
+		&weekday, &weekOfMonth, &dayOfMonth, &r.sendAt, &r.recipientID, &r.recipient, &r.createdBy, &r.lastSent); err != nil {
+		return r, err
+	}
+	r.rule.every = 1
+	for _, f := range []struct {
+		dst *int
+		src *int
+	}{{&r.rule.weekday, weekday}, {&r.rule.weekOfMonth, weekOfMonth}, {&r.rule.dayOfMonth, dayOfMonth}} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return r, nil
+}
+
+// dueOn reports whether a scheduled report goes out on day. Reports run
+// every period (every = 1), so the rule needs no anchor.
+func (r report) dueOn(day time.Time) bool {
+	if r.rule.frequency == "" {
+		return false
+	}
+	rule := r.rule
+	rule.startsOn = day
+	return rule.due(day)
+}
+
+// schedule renders when the report is sent, e.g. "ogni lunedì alle 08:00".
+func (r report) schedule() string {
+	if r.rule.frequency == "" {
+		return "su richiesta"
+	}
+	return fmt.Sprintf("%s alle %s", r.rule.describe(), r.sendAt)
+}
+
+// reportQuery refuses what is not a query before it reaches the database;
+// the read-only transaction is what actually enforces it.
+func reportQuery(sql string) (string, error) {
+	q := strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	upper := strings.ToUpper(q)
+	if !strings.HasPrefix(upper, "SELECT") && !strings.HasPrefix(upper, "WITH") {
+		return "", fmt.Errorf("a report must be a SELECT (or WITH … SELECT) query")
+	}
+	return q, nil
+}
+
+// Start sends the scheduled reports, checking every minute.
+func (rb *ReportBuilder) Start(ctx context.Context) {
+	go func() {
+		log.Printf("reports: scheduler started")
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			rb.sendDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendDue runs and sends the reports due today whose time has come.
+func (rb *ReportBuilder) sendDue(ctx context.Context) {
+	now := time.Now().In(romeLocation())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	rows, err := rb.adminPool.Query(ctx,
+		`SELECT `+reportColumns+`
+		 WHERE q.schedule IS NOT NULL AND q.recipient IS NOT NULL
+		   AND q.send_at <= $2::time AND (q.last_sent_on IS NULL OR q.last_sent_on < $1)
+		 ORDER BY q.send_at, q.hotel_id, q.name`, today, now.Format("15:04"))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("reports: query due: %v", err)
+		}
+		return
+	}
+	var due []report
+	for rows.Next() {
+		d, err := scanReport(rows)
+		if err != nil {
+			rows.Close()
+			log.Printf("reports: scan: %v", err)
+			return
+		}
+		if d.dueOn(today) {
+			due = append(due, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range due {
+		// Marked first: a report that fails is reported once, not every minute.
+		if _, err := rb.adminPool.Exec(ctx,
+			`UPDATE saved_queries SET last_sent_on = $3 WHERE hotel_id = $1 AND name = $2`, d.hotelID, d.name, today); err != nil {
+			log.Printf("reports: mark %s: %v", d.name, err)
+			continue
+		}
+		if err := rb.send(ctx, d, now); err != nil {
+			log.Printf("reports: send %s to %d: %v", d.name, d.recipientID, err)
+		}
+	}
+}
+
+// send runs r through its recipient's pool and sends them the result.
+func (rb *ReportBuilder) send(ctx context.Context, r report, now time.Time) error {
+	title := fmt.Sprintf("📊 %s — %s %s", r.name, strings.ToLower(italianWeekday(now.Weekday())), now.Format("02/01"))
+	if r.description != "" {
+		title += "\n" + r.description
+	}
+	tg := newBot(rb.botToken)
+	db, err := rb.registry.Pool(ctx, r.recipientID)
+	if err != nil {
+		return tg.Send(ctx, r.recipientID, fmt.Sprintf("%s\n\n⚠️ Report non disponibile: %v", title, err))
+	}
+	rs, err := queryReadOnly(ctx, db, r.sql)
+	if err != nil {
+		return tg.Send(ctx, r.recipientID, fmt.Sprintf("%s\n\n⚠️ Il report non è andato a buon fine: %v\nCorreggilo in chat (save_report con replace).", title, err))
+	}
+	if !rs.oversized() {
+		return tg.Send(ctx, r.recipientID, title+"\n\n"+strings.TrimRight(rs.table(0), "\n"))
+	}
+	if err := tg.Send(ctx, r.recipientID, fmt.Sprintf("%s\n\n📄 %d righe: il report completo è nel file qui sotto.", title, len(rs.rows))); err != nil {
+		return err
+	}
+	return sendDocument(ctx, rb.botToken, r.recipientID,
+		fmt.Sprintf("%s_%s.csv", r.name, now.Format("20060102")), rs.csv(), r.name)
+}
+
+// queryReadOnly runs sql on db inside a read-only transaction and reads the
+// whole result.
+func queryReadOnly(ctx context.Context, db *pgxpool.Pool, sql string) (rowSet, error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return rowSet{}, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return rowSet{}, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	return collectRows(rows)
+}
+
+// ── preview_report ───────────────────────────────────────────────────────────
+
+type previewReportTool struct{}
+
+func (t *previewReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "preview_report",
+		Description: "Prova la bozza SQL di un report in sola lettura: mostra le prime righe e quante sono in totale, " +
+			"per farle vedere al manager prima di salvare il report con save_report. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"sql": {"type": "string", "description": "La query (SELECT o WITH)"},
+				"rows": {"type": "integer", "description": "Righe da mostrare (default 10)"}
+			},
+			"required": ["sql"]
+		}`),
+	}
+}
+
+func (t *previewReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		SQL  string `json:"sql"`
+		Rows int    `json:"rows"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var manager bool
+	if err := db.QueryRow(context.Background(), `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("preview_report is only available to managers")
+	}
+	sql, err := reportQuery(in.SQL)
+	if err != nil {
+		return "", err
+	}
+	limit := in.Rows
+	if limit <= 0 {
+		limit = reportPreviewRows
+	}
+	start := time.Now()
+	out, err := runReadOnly(context.Background(), db, sql, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("🔎 Anteprima (%s):\n%s", time.Since(start).Round(time.Millisecond), out), nil
+}
+
+// ── save_report ──────────────────────────────────────────────────────────────
+
+type saveReportTool struct{}
+
+func (t *saveReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "save_report",
+		Description: "Salva un report come query salvata con nome (minuscole, cifre e _), da rilanciare con run_report " +
+			"e, con schedule, da ricevere in automatico: daily, weekly (weekday), monthly (day_of_month, oppure " +
+			"weekday + week_of_month; -1 = ultimo), all'ora at. schedule 'none' toglie l'invio automatico. Un nome " +
+			"esistente si sovrascrive solo con replace=true (sql o description vuoti restano com'erano); quello di un " +
+			"altro manager passa a te, con l'invio, solo con anche take_over=true, dopo che il manager l'ha confermato. " +
+			"delete=true lo elimina. La query viene provata prima di salvarla. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string", "description": "Es. 'notti_per_canale_mese'"},
+				"description": {"type": "string", "description": "Cosa mostra, in una riga"},
+				"sql": {"type": "string", "description": "La query provata con preview_report"},
+				"schedule": {"type": "string", "enum": ["none", "daily", "weekly", "monthly"]},
+				"weekday": {"type": "string", "enum": ["monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"]},
+				"week_of_month": {"type": "integer", "description": "Con monthly + weekday: 1-4, -1 = ultimo del mese"},
+				"day_of_month": {"type": "integer", "description": "Con monthly: giorno del mese 1-31"},
+				"at": {"type": "string", "description": "Ora di invio HH:MM, Europe/Rome (default 08:00)"},
+				"replace": {"type": "boolean", "description": "Sovrascrive un report con lo stesso nome"},
+				"take_over": {"type": "boolean", "description": "Con replace: sovrascrive il report di un altro manager, che passa a te"},
+				"delete": {"type": "boolean"}
+			},
+			"required": ["name"]
+		}`),
+	}
+}
+
+func (t *saveReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		SQL         string `json:"sql"`
+		Schedule    string `json:"schedule"`
+		Weekday     string `json:"weekday"`
+		WeekOfMonth int    `json:"week_of_month"`
+		DayOfMonth  int    `json:"day_of_month"`
+		At          string `json:"at"`
+		Replace     bool   `json:"replace"`
+		TakeOver    bool   `json:"take_over"`
+		Delete      bool   `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("save_report is only available to managers")
+	}
+	name := strings.ToLower(strings.TrimSpace(in.Name))
+	if !reportNameRe.MatchString(name) {
+		return "", fmt.Errorf("name must be lowercase letters, digits and _ (e.g. notti_per_canale)")
+	}
+
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM saved_queries WHERE name = $1`, name)
+		if err != nil {
+			return "", fmt.Errorf("delete report: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return "", fmt.Errorf("report %q not found", name)
+		}
+		return fmt.Sprintf("🗑 Report %s eliminato. Se il heartbeat usava {{%s}}, ora mostra '(%s unavailable)'.", name, name, name), nil
+	}
+
+	r, err := scanReport(db.QueryRow(bg, `SELECT `+reportColumns+` WHERE q.name = $1`, name))
+	exists := err == nil
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		r = report{name: name, sendAt: "08:00", rule: recurrence{every: 1}}
+	case err != nil:
+		return "", fmt.Errorf("load report: %w", err)
+	case !in.Replace:
+		return "", fmt.Errorf("a report named %q already exists (%s): pass replace=true to overwrite it, or pick another name", name, r.description)
+	case r.createdBy != 0 && r.createdBy != ctx.UserID && !in.TakeOver:
+		// Replacing also makes the caller its recipient: the owner must not
+		// lose their report by accident.
+		owner := "another manager"
+		_ = db.QueryRow(bg, `SELECT name FROM users WHERE telegram_id = $1`, r.createdBy).Scan(&owner)
+		return "", fmt.Errorf("report %q belongs to %s: ask the manager whether to take it over (it would be sent to them instead), "+
+			"then pass take_over=true, or pick another name", name, owner)
+	}
+
+	if strings.TrimSpace(in.SQL) != "" {
+		r.sql = in.SQL
+	} else if !exists {
+		return "", fmt.Errorf("a new report needs its sql")
+	}
+	if r.sql, err = reportQuery(r.sql); err != nil {
+		return "", err
+	}
+	if d := strings.TrimSpace(in.Description); d != "" {
+		r.description = d
+	}
+	if in.At != "" {
+		h, m, ok := parseClock(in.At)
+		if !ok {
+			return "", fmt.Errorf("at must be HH:MM")
+		}
+		r.sendAt = fmt.Sprintf("%02d:%02d", h, m)
+	}
+	// A new schedule replaces the whole rule.
+	if in.Schedule != "" {
+		r.rule = recurrence{every: 1}
+		if in.Schedule != "none" {
+			r.rule.frequency = in.Schedule
+			r.rule.weekOfMonth, r.rule.dayOfMonth = in.WeekOfMonth, in.DayOfMonth
+			for i, wd := range isoWeekdays {
+				if i > 0 && wd == strings.ToLower(in.Weekday) {
+					r.rule.weekday = i
+				}
+			}
+			if r.rule.weekday == 0 && in.Weekday != "" {
+				return "", fmt.Errorf("weekday must be monday-sunday")
+			}
+			if err := r.rule.validate(); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Try it before saving: a report that fails now would fail every time.
+	out, err := runReadOnly(bg, db, r.sql, 3)
+	if err != nil {
+		return "", fmt.Errorf("the query does not run, not saved: %w", err)
+	}
+
+	var schedule *string
+	if r.rule.frequency != "" {
+		schedule = &r.rule.frequency
+	}
+	if _, err := db.Exec(bg,
+		`INSERT INTO saved_queries (name, description, sql, schedule, weekday, week_of_month, day_of_month,
+		                            send_at, recipient, created_by, last_sent_on)
+		 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8::time, $9, $9,
+		         CASE WHEN $8::time <= (now() AT TIME ZONE 'Europe/Rome')::time
+		              THEN (now() AT TIME ZONE 'Europe/Rome')::date END)
+		 ON CONFLICT (hotel_id, name) DO UPDATE SET
+		   description = EXCLUDED.description, sql = EXCLUDED.sql, schedule = EXCLUDED.schedule,
+		   weekday = EXCLUDED.weekday, week_of_month = EXCLUDED.week_of_month, day_of_month = EXCLUDED.day_of_month,
+		   send_at = EXCLUDED.send_at, recipient = EXCLUDED.recipient, created_by = EXCLUDED.created_by,
+		   last_sent_on = EXCLUDED.last_sent_on, updated_at = now()`,
+		r.name, r.description, r.sql, schedule, nullInt(r.rule.weekday), nullInt(r.rule.weekOfMonth),
+		nullInt(r.rule.dayOfMonth), r.sendAt, ctx.UserID,
+	); err != nil {
+		return "", fmt.Errorf("save report: %w", err)
+	}
+
+	verb := "salvato"
+	if exists {
+		verb = "aggiornato"
+	}
+	msg := fmt.Sprintf("💾 Report %s %s — %s.", r.name, verb, r.schedule())
+	if r.rule.frequency != "" {
+		now := time.Now().In(romeLocation())
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if h, m, _ := parseClock(r.sendAt); !now.Before(day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)) {
+			day = day.AddDate(0, 0, 1)
+		}
+		for i := 0; i < 400 && !r.dueOn(day); i++ {
+			day = day.AddDate(0, 0, 1)
+		}
+		msg += fmt.Sprintf(" Primo invio %s %s, a te.", strings.ToLower(italianWeekday(day.Weekday())), day.Format("02/01"))
+	}
+	return msg + "\nPrime righe:\n" + out, nil
+}
+
+// ── run_report ───────────────────────────────────────────────────────────────
+
+type runReportTool struct {
+	rb *ReportBuilder
+}
+
+func (t *runReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "run_report",
+		Description: "Esegue ora un report salvato (vedi list_reports) e ne restituisce tutte le righe; se sono troppe " +
+			"arrivano in chat come file CSV. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string"}
+			},
+			"required": ["name"]
+		}`),
+	}
+}
+
+func (t *runReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var manager bool
+	if err := db.QueryRow(context.Background(), `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("run_report is only available to managers")
+	}
+	bg := context.Background()
+	name := strings.ToLower(strings.TrimSpace(in.Name))
+	var sql string
+	if err := db.QueryRow(bg, `SELECT sql FROM saved_queries WHERE name = $1`, name).Scan(&sql); err != nil {
+		return "", fmt.Errorf("report %q not found", name)
+	}
+	rs, err := queryReadOnly(bg, db, sql)
+	if err != nil {
+		return "", err
+	}
+	return deliverRows(bg, t.rb.botToken, ctx.ChatID, rs, name)
+}
+
+// ── list_reports ─────────────────────────────────────────────────────────────
+
+type listReportsTool struct{}
+
+func (t *listReportsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "list_reports",
+		Description: "Elenca i report salvati (anche quelli usati dal heartbeat) con descrizione, invio automatico e " +
+			"destinatario. Con sql=true mostra anche le query. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"sql": {"type": "boolean"}
+			}
+		}`),
+	}
+}
+
+func (t *listReportsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		SQL bool `json:"sql"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	var manager bool
+	if err := db.QueryRow(context.Background(), `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("list_reports is only available to managers")
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT `+reportColumns+` ORDER BY q.schedule IS NULL, q.name`)
+	if err != nil {
+		return "", fmt.Errorf("query reports: %w", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return "", err
+		}
+		line := "• " + r.name
+		if r.description != "" {
+			line += " — " + r.description
+		}
+		line += "\n   🗓 " + r.schedule()
+		if r.rule.frequency != "" && r.recipient != "" {
+			line += " a " + r.recipient
+		}
+		if r.lastSent != nil {
+			line += ", ultimo invio " + r.lastSent.Format("02/01")
+		}
+		if in.SQL {
+			line += "\n   " + strings.ReplaceAll(r.sql, "\n", "\n   ")
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "Nessun report salvato.", nil
+	}
+	return "📊 Report salvati:\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Default arrival/departure times when only a date is given.
+const (
+	defaultCheckinHour  = 14
+	defaultCheckoutHour = 10
+)
+
+// parseStayTime accepts RFC 3339 or a bare YYYY-MM-DD, which gets hour
+// (Europe/Rome) as time of day.
+func parseStayTime(s string, hour int) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation("2006-01-02", s, romeLocation())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: use YYYY-MM-DD or ISO 8601 with timezone", s)
+	}
+	return d.Add(time.Duration(hour) * time.Hour), nil
+}
+
+type roomRef struct {
+	id       int64
+	name     string
+	floor    int
+	typeName string // room type, empty if none
+	capacity int    // guests the room type allows; 0 if unknown
+
+	pets, accessible, balcony bool
+	connectingID              int64  // room behind the connecting door; 0 if none
+	connecting                string // its name
+}
+
+// roomRefColumns selects a roomRef from rooms r LEFT JOIN room_types t
+// LEFT JOIN rooms c ON c.id = r.connecting_room_id.
+const roomRefColumns = `r.id, r.name, r.floor, COALESCE(t.name, ''), COALESCE(t.capacity, 0),
+	r.pets_allowed, r.accessible, r.balcony, COALESCE(c.id, 0), COALESCE(c.name, '')`
+
+func scanRoomRef(row pgx.Row) (roomRef, error) {
+	var r roomRef
+	err := row.Scan(&r.id, &r.name, &r.floor, &r.typeName, &r.capacity,
+		&r.pets, &r.accessible, &r.balcony, &r.connectingID, &r.connecting)
+	return r, err
+}
+
+// availableRooms returns rooms with no reservation or live option overlapping
+// [checkin, checkout) and no room block on any of its nights.
+func availableRooms(ctx context.Context, db *pgxpool.Pool, checkin, checkout time.Time) ([]roomRef, error) {
+	rows, err := db.Query(ctx,
+		`SELECT `+roomRefColumns+`
+		 FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id
+		 LEFT JOIN rooms c ON c.id = r.connecting_room_id
+		 WHERE NOT EXISTS (SELECT 1 FROM room_blocks b
+		                   WHERE b.room_id = r.id AND b.lifted_at IS NULL
+		                     AND b.from_date < ($2 AT TIME ZONE 'Europe/Rome')::date
+		                     AND b.to_date >= ($1 AT TIME ZONE 'Europe/Rome')::date)
+		   AND NOT EXISTS (SELECT 1 FROM reservations res
+		                   WHERE res.room_id = r.id AND res.checkin_at < $2 AND res.checkout_at > $1
+		                     AND (res.status = 'confirmed' OR (res.status = 'option' AND res.hold_until > now())))
+		 ORDER BY r.floor, r.name`, checkin, checkout)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []roomRef
+	for rows.Next() {
+		r, err := scanRoomRef(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// freeRooms is availableRooms with the features in want, formatted as
+// "name (piano N, features…)".
+func freeRooms(ctx context.Context, db *pgxpool.Pool, checkin, checkout time.Time, want ...string) ([]string, error) {
+	rooms, err := availableRooms(ctx, db, checkin, checkout)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, r := range withFeatures(rooms, want) {
+		out = append(out, fmt.Sprintf("%s (%s)", r.name,
+			strings.Join(append([]string{fmt.Sprintf("piano %d", r.floor)}, r.featureLabels()...), ", ")))
+	}
+	return out, nil
+}
+
+// partySize fills guests from adults + children when adults is given
+// (default def when neither is) and checks the two agree.
+func partySize(guests *int, adults, children, def int) error {
+	if adults < 0 || children < 0 {
+		return fmt.Errorf("adults and children cannot be negative")
+	}
+	if adults > 0 {
+		if *guests > 0 && *guests != adults+children {
+			return fmt.Errorf("guests (%d) is not adults + children (%d + %d)", *guests, adults, children)
+		}
+		*guests = adults + children
+	}
+	if *guests <= 0 {
+		*guests = def
+	}
+	if children > *guests {
+		return fmt.Errorf("children must be between 0 and guests")
+	}
+	return nil
+}
+
+// ── add_reservation ──────────────────────────────────────────────────────────
+
+type addReservationTool struct{}
+
+func (t *addReservationTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "add_reservation",
+		Description: "Inserisce una prenotazione controllando prima che la camera sia libera in quelle date. " +
+			"In caso di sovrapposizione rifiuta e propone le camere libere. Un soggiorno più corto del minimo " +
+			"(set_rate_rule) viene rifiutato finché non si ripete con override=true. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera (es. '101')"},
+				"guest_name": {"type": "string", "description": "Nome dell'ospite (cognome nome): collega la prenotazione al profilo con lo stesso nome o ne crea uno"},
+				"guest_id": {"type": "integer", "description": "Profilo ospite (guests.id) quando più profili hanno lo stesso nome"},
+				"guest_phone": {"type": "string", "description": "Telefono dell'ospite (salvato nel profilo)"},
+				"guest_email": {"type": "string", "description": "Email dell'ospite (salvata nel profilo)"},
+				"checkin": {"type": "string", "description": "Arrivo: YYYY-MM-DD (ore 14:00) o ISO 8601 con fuso"},
+				"checkout": {"type": "string", "description": "Partenza: YYYY-MM-DD (ore 10:00) o ISO 8601 con fuso"},
+				"guests": {"type": "integer", "description": "Numero di persone in totale (default 1)"},
+				"adults": {"type": "integer", "description": "Adulti: in alternativa a guests, che diventa adults + children"},
+				"children": {"type": "integer", "description": "Bambini, compresi nei guests (esenti dalla tassa di soggiorno)"},
+				"source": {"type": "string", "description": "Canale: direct, booking, airbnb, phone (default direct)"},
+				"amount_eur": {"type": "number", "description": "Prezzo totale del soggiorno"},
+				"residence_country": {"type": "string", "description": "Paese di residenza, codice ISO (es. DE)"},
+				"residence_province": {"type": "string", "description": "Provincia (solo residenti in Italia, es. RM)"},
+				"board": {"type": "string", "enum": ["room_only", "bb", "half_board", "full_board"], "description": "Trattamento: solo pernottamento, B&B (default), mezza pensione, pensione completa"},
+				"dietary_notes": {"type": "string", "description": "Allergie / esigenze alimentari"},
+				"notes": {"type": "string", "description": "Altre note"},
+				"hold_hours": {"type": "integer", "description": "Se indicato, inserisce un'opzione (provvisoria) che scade dopo queste ore invece di una prenotazione confermata"},
+				"connecting": {"type": "boolean", "description": "Prenota insieme anche la camera comunicante (famiglie): guests, children e amount_eur sono del totale e vengono divisi tra le due"},
+				"override": {"type": "boolean", "description": "Accetta il soggiorno anche se più corto del minimo: la deroga viene annotata nelle note"}
+			},
+			"required": ["room", "checkin", "checkout"]
+		}`),
+	}
+}
+
+func (t *addReservationTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room              string   `json:"room"`
+		GuestName         string   `json:"guest_name"`
+		GuestID           int64    `json:"guest_id"`
+		GuestPhone        string   `json:"guest_phone"`
+		GuestEmail        string   `json:"guest_email"`
+		Checkin           string   `json:"checkin"`
+		Checkout          string   `json:"checkout"`
+		Guests            int      `json:"guests"`
+		Adults            int      `json:"adults"`
+		Children          int      `json:"children"`
+		Source            string   `json:"source"`
+		AmountEUR         *float64 `json:"amount_eur"`
+		ResidenceCountry  string   `json:"residence_country"`
+		ResidenceProvince string   `json:"residence_province"`
+		Board             string   `json:"board"`
+		DietaryNotes      string   `json:"dietary_notes"`
+		Notes             string   `json:"notes"`
+		HoldHours         int      `json:"hold_hours"`
+		Connecting        bool     `json:"connecting"`
+		Override          bool     `json:"override"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	checkin, err := parseStayTime(in.Checkin, defaultCheckinHour)
+	if err != nil {
+		return "", fmt.Errorf("checkin %w", err)
+	}
+	checkout, err := parseStayTime(in.Checkout, defaultCheckoutHour)
+	if err != nil {
+		return "", fmt.Errorf("checkout %w", err)
+	}
+	if !checkout.After(checkin) {
+		return "", fmt.Errorf("checkout must be after checkin")
+	}
+	if err := partySize(&in.Guests, in.Adults, in.Children, 1); err != nil {
+		return "", err
+	}
+	if in.Source == "" {
+		in.Source = "direct"
+	}
+	if in.Board == "" {
+		in.Board = "bb"
+	}
+	if _, ok := boardTypes[in.Board]; !ok {
+		return "", fmt.Errorf("board must be room_only, bb, half_board or full_board")
+	}
+	status := "confirmed"
+	var holdUntil *time.Time
+	if in.HoldHours > 0 {
+		t := time.Now().Add(time.Duration(in.HoldHours) * time.Hour)
+		status, holdUntil = "option", &t
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var roomID, partnerID int64
+	var partner string
+	if err := db.QueryRow(bg,
+		`SELECT r.id, COALESCE(c.id, 0), COALESCE(c.name, '')
+		 FROM rooms r LEFT JOIN rooms c ON c.id = r.connecting_room_id
+		 WHERE lower(r.name) = lower($1)`, in.Room).Scan(&roomID, &partnerID, &partner); err != nil {
+		return "", fmt.Errorf("camera %q non trovata", in.Room)
+	}
+	// One stay per room: the party and the price are split over a pair.
+	type stay struct {
+		roomID           int64
+		guests, children int
+		amount           *float64
+	}
+	stays := []stay{{roomID, in.Guests, in.Children, in.AmountEUR}}
+	if in.Connecting {
+		if partnerID == 0 {
+			return "", fmt.Errorf("camera %s non ha una camera comunicante (set_room_features)", in.Room)
+		}
+		if in.Guests < 2 {
+			return "", fmt.Errorf("connecting rooms need at least 2 guests")
+		}
+		g1, c1, g2, c2 := splitParty(in.Guests, in.Children)
+		a1, a2 := splitAmount(in.AmountEUR)
+		stays = []stay{{roomID, g1, c1, a1}, {partnerID, g2, c2, a2}}
+	}
+	for _, s := range stays {
+		v, err := minStayViolation(bg, db, s.roomID, checkin, checkout)
+		if err != nil {
+			return "", err
+		}
+		if v == "" {
+			continue
+		}
+		if !in.Override {
+			return fmt.Sprintf("⚠️ Prenotazione non inserita: non rispetta il %s. Proponi all'ospite più notti, "+
+				"oppure se il manager accetta la deroga ripeti con override=true.", v), nil
+		}
+		in.Notes = overrideNote(v, in.Notes)
+		break
+	}
+
+	// The reservations_reject_overlap trigger is the real guard (it also
+	// covers execute_sql); this only turns its error into a useful answer.
+	// The guest profile is created in the same transaction, so a refused
+	// booking leaves no orphan profile behind.
+	var ids []int64
+	var returning *guestProfile
+	var ambiguous []guestProfile
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		guest, amb, err := resolveGuest(bg, tx, in.GuestID, in.GuestName, in.GuestPhone)
+		if err != nil {
+			return err
+		}
+		ambiguous = amb
+		var guestID *int64
+		switch {
+		case guest != nil:
+			guestID = &guest.id
+			if guest.stays > 0 {
+				returning = guest
+			}
+			if _, err := tx.Exec(bg,
+				`UPDATE guests SET phone = COALESCE(NULLIF($2, ''), phone), email = COALESCE(NULLIF($3, ''), email)
+				 WHERE id = $1`, guest.id, in.GuestPhone, in.GuestEmail); err != nil {
+				return fmt.Errorf("update guest: %w", err)
+			}
+		case amb == nil && strings.TrimSpace(in.GuestName) != "":
+			var newID int64
+			if err := tx.QueryRow(bg,
+				`INSERT INTO guests (name, phone, email) VALUES (trim($1), NULLIF($2, ''), NULLIF($3, '')) RETURNING id`,
+				in.GuestName, in.GuestPhone, in.GuestEmail).Scan(&newID); err != nil {
+				return fmt.Errorf("create guest: %w", err)
+			}
+			guestID = &newID
+		}
+		for _, s := range stays {
+			var id int64
+			if err := tx.QueryRow(bg,
+				`INSERT INTO reservations (room_id, guest_name, checkin_at, checkout_at, guests, source, amount_eur,
+				   residence_country, residence_province, board, dietary_notes, notes, created_by, status, hold_until, guest_id,
+				   children)
+				 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, NULLIF(upper($8), ''), NULLIF(upper($9), ''), $10,
+				   NULLIF($11, ''), NULLIF($12, ''), $13, $14, $15, $16, $17)
+				 RETURNING id`,
+				s.roomID, in.GuestName, checkin, checkout, s.guests, in.Source, s.amount,
+				in.ResidenceCountry, in.ResidenceProvince, in.Board, in.DietaryNotes, in.Notes, ctx.UserID, status, holdUntil, guestID,
+				s.children,
+			).Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 2 {
+			return linkReservations(bg, tx, ids[0], ids[1])
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23514" && strings.Contains(pgErr.Message, "holds at most") {
+		return "❌ " + pgErr.Message + ". Scegli una camera più grande (quote mostra quelle adatte) o, per una famiglia, connecting=true.", nil
+	}
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		msg := "❌ " + pgErr.Message
+		var want []string
+		if in.Connecting {
+			want = []string{"connecting"}
+		}
+		if free, ferr := freeRooms(bg, db, checkin, checkout, want...); ferr == nil {
+			if len(free) == 0 {
+				msg += "\nNessuna camera libera in quelle date."
+			} else {
+				msg += "\nCamere libere: " + strings.Join(free, ", ")
+			}
+		}
+		return msg, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("insert reservation: %w", err)
+	}
+	msg := fmt.Sprintf("✅ Prenotazione %d: camera %s, %s → %s, %d pers.",
+		ids[0], in.Room, checkin.In(romeLocation()).Format("02/01 15:04"), checkout.In(romeLocation()).Format("02/01 15:04"), stays[0].guests)
+	if len(ids) == 2 {
+		msg += fmt.Sprintf("\n✅ Prenotazione %d: camera comunicante %s, %d pers. (collegata alla %d)",
+			ids[1], partner, stays[1].guests, ids[0])
+	}
+	if holdUntil != nil {
+		msg += fmt.Sprintf("\nIn opzione fino al %s: senza conferma (confirm_option) la camera torna libera.",
+			holdUntil.In(romeLocation()).Format("02/01 15:04"))
+	}
+	if returning != nil {
+		msg += "\nOspite abituale — " + returning.summary()
+	}
+	if len(ambiguous) > 0 {
+		msg += fmt.Sprintf("\n⚠️ %d profili ospite si chiamano %q: non collegata. Indica guest_id:", len(ambiguous), in.GuestName)
+		for _, g := range ambiguous {
+			msg += "\n" + g.summary()
+		}
+	}
+	return msg, nil
+}
+
+// ── check_availability ───────────────────────────────────────────────────────
+
+type checkAvailabilityTool struct{}
+
+func (t *checkAvailabilityTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "check_availability",
+		Description: "Elenca le camere libere (nessuna prenotazione sovrapposta, non fuori servizio) per un intervallo di date, " +
+			"con le loro caratteristiche; features filtra quelle con animali ammessi, accessibili, con balcone o comunicanti.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"checkin": {"type": "string", "description": "Arrivo: YYYY-MM-DD o ISO 8601 con fuso"},
+				"checkout": {"type": "string", "description": "Partenza: YYYY-MM-DD o ISO 8601 con fuso"},
+				"features": {"type": "array", "items": {"type": "string", "enum": ["pets", "accessible", "balcony", "connecting"]}, "description": "Caratteristiche richieste (tutte)"}
+			},
+			"required": ["checkin", "checkout"]
+		}`),
+	}
+}
+
+func (t *checkAvailabilityTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Checkin  string   `json:"checkin"`
+		Checkout string   `json:"checkout"`
+		Features []string `json:"features"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if err := checkRoomFeatures(in.Features); err != nil {
+		return "", err
+	}
+	checkin, err := parseStayTime(in.Checkin, defaultCheckinHour)
+	if err != nil {
+		return "", fmt.Errorf("checkin %w", err)
+	}
+	checkout, err := parseStayTime(in.Checkout, defaultCheckoutHour)
+	if err != nil {
+		return "", fmt.Errorf("checkout %w", err)
+	}
+	if !checkout.After(checkin) {
+		return "", fmt.Errorf("checkout must be after checkin")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	free, err := freeRooms(context.Background(), db, checkin, checkout, in.Features...)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	period := checkin.In(romeLocation()).Format("02/01") + " → " + checkout.In(romeLocation()).Format("02/01")
+	if len(in.Features) > 0 {
+		period += " con " + strings.Join(in.Features, ", ")
+	}
+	if len(free) == 0 {
+		return "Nessuna camera libera " + period + ".", nil
+	}
+	return fmt.Sprintf("Camere libere %s (%d): %s", period, len(free), strings.Join(free, ", ")), nil
+}
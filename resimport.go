@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReservationImport migrates the reservations of an old spreadsheet. The
+// manager sends the .xlsx or .csv to the bot (Attachments stores it) and
+// import_reservations validates every row and sends a preview with the
+// errors and the buttons "rimp:ok:<attachment_id>" / "rimp:no:<attachment_id>".
+// Confirming reads and validates the file again and inserts the valid rows
+// in one transaction, as the manager: rows with errors and reservations
+// already present (same room and dates) are skipped, so the same file can be
+// sent again once fixed.
+type ReservationImport struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	files     *Attachments
+}
+
+func newReservationImport(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string, files *Attachments) *ReservationImport {
+	return &ReservationImport{adminPool: adminPool, registry: registry, botToken: botToken, files: files}
+}
+
+// importPreviewLines bounds the rows and the errors listed in the preview.
+const importPreviewLines = 15
+
+// Register wires the confirmation buttons.
+func (ri *ReservationImport) Register(m *routedMessenger) {
+	m.Handle("rimp:", ri.handleButton)
+}
+
+// Tools returns import_reservations.
+func (ri *ReservationImport) Tools() []agent.Tool {
+	return []agent.Tool{&importReservationsTool{imp: ri}}
+}
+
+// importColumns maps the normalized headers found in hotel spreadsheets to
+// the fields of a reservation.
+var importColumns = map[string]string{
+	"camera": "room", "room": "room", "stanza": "room", "n camera": "room", "numero camera": "room", "alloggio": "room",
+	"ospite": "guest", "nome": "guest", "nominativo": "guest", "cliente": "guest", "guest": "guest",
+	"guest name": "guest", "nome ospite": "guest", "cognome e nome": "guest", "name": "guest",
+	"arrivo": "checkin", "data arrivo": "checkin", "check in": "checkin", "checkin": "checkin", "dal": "checkin", "arrival": "checkin",
+	"partenza": "checkout", "data partenza": "checkout", "check out": "checkout", "checkout": "checkout", "al": "checkout", "departure": "checkout",
+	"persone": "guests", "ospiti": "guests", "pax": "guests", "guests": "guests", "n persone": "guests",
+	"bambini": "children", "children": "children", "minori": "children",
+	"importo": "amount", "prezzo": "amount", "totale": "amount", "tariffa": "amount", "amount": "amount", "price": "amount", "total": "amount",
+	"canale": "source", "fonte": "source", "portale": "source", "source": "source", "channel": "source",
+	"telefono": "phone", "tel": "phone", "cellulare": "phone", "phone": "phone",
+	"email": "email", "e mail": "email", "mail": "email",
+	"trattamento": "board", "board": "board",
+	"note": "notes", "notes": "notes",
+}
+
+// importBoards maps how spreadsheets write the board to its code.
+var importBoards = map[string]string{
+	"room only": "room_only", "room_only": "room_only", "ro": "room_only", "solo pernottamento": "room_only", "pernottamento": "room_only",
+	"bb": "bb", "b b": "bb", "b&b": "bb", "bed and breakfast": "bb", "colazione": "bb",
+	"hb": "half_board", "half_board": "half_board", "half board": "half_board", "mezza pensione": "half_board",
+	"fb": "full_board", "full_board": "full_board", "full board": "full_board", "pensione completa": "full_board",
+}
+
+// normalizeHeader lowercases a header and turns punctuation into single
+// spaces: "Check-in" → "check in", "N° camera" → "n camera".
+func normalizeHeader(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// importRow is one reservation read from the file.
+type importRow struct {
+	line              int
+	roomID            int64
+	room, guest       string
+	checkin, checkout time.Time
+	guests, children  int
+	amount            *float64
+	source, board     string
+	phone, email      string
+	notes             string
+	errs              []string
+	present           bool // already in the database
+}
+
+func (r importRow) String() string {
+	loc := romeLocation()
+	s := fmt.Sprintf("riga %d: camera %s, %s, %s → %s, %d pers.", r.line, r.room, r.guest,
+		r.checkin.In(loc).Format("02/01/06"), r.checkout.In(loc).Format("02/01/06"), r.guests)
+	if r.amount != nil {
+		s += fmt.Sprintf(", %.2f €", *r.amount)
+	}
+	return s
+}
+
+// parse reads the attachment and validates its rows against rooms, booking
+// channels, existing reservations and each other.
+func (ri *ReservationImport) parse(ctx context.Context, db querier, attachmentID int64) (string, []importRow, error) {
+	name, data, err := ri.files.read(ctx, db, attachmentID)
+	if err != nil {
+		return "", nil, err
+	}
+	sheet, err := readSpreadsheet(name, data)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sheet) < 2 {
+		return "", nil, fmt.Errorf("%s non contiene prenotazioni: serve una riga di intestazione e almeno una riga di dati", name)
+	}
+	cols := make(map[string]int)
+	for i, h := range sheet[0].cells {
+		if field, ok := importColumns[normalizeHeader(h)]; ok {
+			if _, seen := cols[field]; !seen {
+				cols[field] = i
+			}
+		}
+	}
+	var missing []string
+	for _, f := range []string{"room", "checkin", "checkout"} {
+		if _, ok := cols[f]; !ok {
+			missing = append(missing, map[string]string{"room": "camera", "checkin": "arrivo", "checkout": "partenza"}[f])
+		}
+	}
+	if len(missing) > 0 {
+		return "", nil, fmt.Errorf("nella prima riga di %s mancano le colonne %s (trovate: %s)",
+			name, strings.Join(missing, ", "), strings.Join(sheet[0].cells, ", "))
+	}
+
+	type roomInfo struct {
+		id       int64
+		name     string
+		capacity int
+	}
+	rooms := make(map[string]roomInfo)
+	rows, err := db.Query(ctx,
+		`SELECT r.id, r.name, COALESCE(t.capacity, 0) FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id`)
+	if err != nil {
+		return "", nil, fmt.Errorf("query rooms: %w", err)
+	}
+	for rows.Next() {
+		var r roomInfo
+		if err := rows.Scan(&r.id, &r.name, &r.capacity); err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+		rooms[strings.ToLower(r.name)] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+	channels := make(map[string]string)
+	rows, err = db.Query(ctx, `SELECT name FROM booking_channels`)
+	if err != nil {
+		return "", nil, fmt.Errorf("query channels: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return "", nil, fmt.Errorf("query channels: %w", err)
+	}
+	for _, n := range names {
+		channels[strings.ToLower(n)] = n
+	}
+
+	cell := func(r sheetRow, field string) string {
+		i, ok := cols[field]
+		if !ok || i >= len(r.cells) {
+			return ""
+		}
+		return strings.TrimSpace(r.cells[i])
+	}
+	var out []importRow
+	for _, sr := range sheet[1:] {
+		r := importRow{line: sr.n, guest: cell(sr, "guest"), phone: cell(sr, "phone"), email: cell(sr, "email"),
+			notes: cell(sr, "notes"), guests: 1, source: "direct", board: "bb"}
+		fail := func(format string, args ...any) { r.errs = append(r.errs, fmt.Sprintf(format, args...)) }
+
+		r.room = cell(sr, "room")
+		// Excel stores room numbers as numbers: "101" may come out as "101.0".
+		if f, err := strconv.ParseFloat(r.room, 64); err == nil && f == float64(int(f)) {
+			r.room = strconv.Itoa(int(f))
+		}
+		room, ok := rooms[strings.ToLower(r.room)]
+		switch {
+		case r.room == "":
+			fail("camera mancante")
+		case !ok:
+			fail("camera %q non esiste", r.room)
+		default:
+			r.roomID, r.room = room.id, room.name
+		}
+		if r.checkin, err = parseSheetDate(cell(sr, "checkin"), defaultCheckinHour); err != nil {
+			fail("arrivo: %v", err)
+		}
+		if r.checkout, err = parseSheetDate(cell(sr, "checkout"), defaultCheckoutHour); err != nil {
+			fail("partenza: %v", err)
+		}
+		if !r.checkin.IsZero() && !r.checkout.IsZero() && !r.checkout.After(r.checkin) {
+			fail("la partenza non è dopo l'arrivo")
+		}
+		if s := cell(sr, "guests"); s != "" {
+			n, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+			if err != nil || n < 1 || n != float64(int(n)) {
+				fail("persone %q non valido", s)
+			} else {
+				r.guests = int(n)
+			}
+		}
+		if s := cell(sr, "children"); s != "" {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, ".0"))
+			if err != nil || n < 0 || n > r.guests {
+				fail("bambini %q non valido", s)
+			} else {
+				r.children = n
+			}
+		}
+		if ok && room.capacity > 0 && r.guests > room.capacity {
+			fail("la camera %s ospita al massimo %d persone", room.name, room.capacity)
+		}
+		if s := cell(sr, "amount"); s != "" {
+			if a, err := parseSheetAmount(s); err != nil || a < 0 {
+				fail("importo %q non valido", s)
+			} else {
+				r.amount = &a
+			}
+		}
+		if s := cell(sr, "source"); s != "" {
+			if ch, ok := channels[strings.ToLower(s)]; ok {
+				r.source = ch
+			} else {
+				fail("canale %q sconosciuto (canali: %s)", s, strings.Join(names, ", "))
+			}
+		}
+		if s := cell(sr, "board"); s != "" {
+			if b, ok := importBoards[strings.ToLower(strings.Join(strings.Fields(s), " "))]; ok {
+				r.board = b
+			} else {
+				fail("trattamento %q sconosciuto", s)
+			}
+		}
+		out = append(out, r)
+	}
+	if err := ri.checkOverlaps(ctx, db, out); err != nil {
+		return "", nil, err
+	}
+	return name, out, nil
+}
+
+// checkOverlaps marks rows already in the database as present, and rows
+// that overlap a confirmed reservation or an option, or an earlier valid
+// row of the file, as errors.
+func (ri *ReservationImport) checkOverlaps(ctx context.Context, db querier, rows []importRow) error {
+	var from, to time.Time
+	for _, r := range rows {
+		if len(r.errs) > 0 {
+			continue
+		}
+		if from.IsZero() || r.checkin.Before(from) {
+			from = r.checkin
+		}
+		if r.checkout.After(to) {
+			to = r.checkout
+		}
+	}
+	if from.IsZero() {
+		return nil
+	}
+	type stay struct {
+		roomID            int64
+		checkin, checkout time.Time
+		label             string
+	}
+	var existing []stay
+	q, err := db.Query(ctx,
+		`SELECT room_id, checkin_at, checkout_at, format('prenotazione %s (%s)', id, COALESCE(guest_name, 'ospite'))
+		 FROM reservations
+		 WHERE status IN ('confirmed', 'option') AND checkin_at < $2 AND checkout_at > $1`, from, to)
+	if err != nil {
+		return fmt.Errorf("query reservations: %w", err)
+	}
+	for q.Next() {
+		var s stay
+		if err := q.Scan(&s.roomID, &s.checkin, &s.checkout, &s.label); err != nil {
+			q.Close()
+			return err
+		}
+		existing = append(existing, s)
+	}
+	q.Close()
+	if err := q.Err(); err != nil {
+		return err
+	}
+	sameDay := func(a, b time.Time) bool {
+		return a.In(romeLocation()).Format("2006-01-02") == b.In(romeLocation()).Format("2006-01-02")
+	}
+	for i := range rows {
+		r := &rows[i]
+		if len(r.errs) > 0 {
+			continue
+		}
+		for _, s := range existing {
+			if s.roomID != r.roomID || !s.checkin.Before(r.checkout) || !s.checkout.After(r.checkin) {
+				continue
+			}
+			if sameDay(s.checkin, r.checkin) && sameDay(s.checkout, r.checkout) {
+				r.present = true
+			} else {
+				r.errs = append(r.errs, "si sovrappone alla "+s.label)
+			}
+			break
+		}
+		if r.present || len(r.errs) > 0 {
+			continue
+		}
+		existing = append(existing, stay{r.roomID, r.checkin, r.checkout, fmt.Sprintf("riga %d del file", r.line)})
+	}
+	return nil
+}
+
+// preview is the message listing what an import would do.
+func (ri *ReservationImport) preview(name string, rows []importRow) (string, int) {
+	var valid, present, failed []string
+	for _, r := range rows {
+		switch {
+		case len(r.errs) > 0:
+			failed = append(failed, fmt.Sprintf("riga %d: %s", r.line, strings.Join(r.errs, "; ")))
+		case r.present:
+			present = append(present, r.String())
+		default:
+			valid = append(valid, r.String())
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📥 <b>Importazione da %s</b>\n", htmlpkg.EscapeString(name))
+	fmt.Fprintf(&sb, "Righe lette: %d — da importare: %d, già presenti: %d, con errori: %d\n",
+		len(rows), len(valid), len(present), len(failed))
+	list := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n<b>%s</b>\n", title)
+		for i, l := range lines {
+			if i == importPreviewLines {
+				fmt.Fprintf(&sb, "… e altre %d\n", len(lines)-i)
+				break
+			}
+			sb.WriteString("• " + htmlpkg.EscapeString(l) + "\n")
+		}
+	}
+	list("Da importare", valid)
+	list("Errori", failed)
+	if len(failed) > 0 && len(valid) > 0 {
+		sb.WriteString("\nLe righe con errori non vengono importate: puoi importare le altre ora e rimandare il file " +
+			"corretto dopo (quelle già importate vengono saltate).")
+	}
+	return strings.TrimRight(sb.String(), "\n"), len(valid)
+}
+
+// insert writes the valid rows in one transaction.
+func (ri *ReservationImport) insert(ctx context.Context, db *pgxpool.Pool, userID int64, rows []importRow) (int, error) {
+	n := 0
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		for _, r := range rows {
+			if len(r.errs) > 0 || r.present {
+				continue
+			}
+			guestID, err := importGuest(ctx, tx, r)
+			if err != nil {
+				return fmt.Errorf("riga %d: %w", r.line, err)
+			}
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO reservations (room_id, guest_name, checkin_at, checkout_at, guests, children, source, amount_eur,
+				   board, notes, created_by, guest_id)
+				 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11, $12)`,
+				r.roomID, r.guest, r.checkin, r.checkout, r.guests, r.children, r.source, r.amount,
+				r.board, r.notes, userID, guestID); err != nil {
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) {
+					return fmt.Errorf("riga %d: %s", r.line, pgErr.Message)
+				}
+				return fmt.Errorf("riga %d: %w", r.line, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// importGuest links a row to the guest profile with its name, creating it
+// when there is none; an ambiguous name is left unlinked.
+func importGuest(ctx context.Context, tx pgx.Tx, r importRow) (*int64, error) {
+	guest, ambiguous, err := resolveGuest(ctx, tx, 0, r.guest, r.phone)
+	switch {
+	case err != nil:
+		return nil, err
+	case guest != nil:
+		_, err := tx.Exec(ctx,
+			`UPDATE guests SET phone = COALESCE(phone, NULLIF($2, '')), email = COALESCE(email, NULLIF($3, ''))
+			 WHERE id = $1`, guest.id, r.phone, r.email)
+		return &guest.id, err
+	case ambiguous != nil || r.guest == "":
+		return nil, nil
+	}
+	var id int64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO guests (name, phone, email) VALUES (trim($1), NULLIF($2, ''), NULLIF($3, '')) RETURNING id`,
+		r.guest, r.phone, r.email).Scan(&id)
+	return &id, err
+}
+
+func (ri *ReservationImport) handleButton(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed import callback")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad import attachment id: %w", err)
+	}
+	tg := newBot(ri.botToken)
+	var role string
+	_ = ri.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	if parts[1] == "no" {
+		return tg.Send(ctx, u.ChatID, "Importazione annullata: nessuna prenotazione inserita.")
+	}
+	// Writes run as the manager: RLS and the reservation triggers decide.
+	db, err := ri.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	name, rows, err := ri.parse(ctx, db, id)
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, "❌ "+err.Error())
+	}
+	n, err := ri.insert(ctx, db, u.UserID, rows)
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, "❌ Importazione annullata, nessuna prenotazione inserita: "+err.Error())
+	}
+	skipped := len(rows) - n
+	log.Printf("reservation import: %s by %d, %d inserted, %d skipped", name, u.UserID, n, skipped)
+	msg := fmt.Sprintf("✅ Importate %d prenotazioni da %s.", n, name)
+	if skipped > 0 {
+		msg += fmt.Sprintf(" %d righe saltate (già presenti o con errori).", skipped)
+	}
+	return tg.Send(ctx, u.ChatID, msg)
+}
+
+// ── import_reservations ──────────────────────────────────────────────────────
+
+type importReservationsTool struct {
+	imp *ReservationImport
+}
+
+func (t *importReservationsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "import_reservations",
+		Description: "Importa le prenotazioni da un foglio .xlsx o .csv inviato in chat (attachment_id dalla riga «📎 File allegato»). " +
+			"Controlla ogni riga e manda un'anteprima con gli errori e i pulsanti per confermare: l'inserimento avviene solo " +
+			"con il pulsante. Colonne riconosciute: camera, ospite, arrivo, partenza, persone, bambini, importo, canale, " +
+			"telefono, email, trattamento, note. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"attachment_id": {"type": "integer", "description": "attachment_id del file"}
+			},
+			"required": ["attachment_id"]
+		}`),
+	}
+}
+
+func (t *importReservationsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		AttachmentID int64 `json:"attachment_id"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("import_reservations is only available to managers")
+	}
+	name, rows, err := t.imp.parse(bg, db, in.AttachmentID)
+	if err != nil {
+		return "", err
+	}
+	text, valid := t.imp.preview(name, rows)
+	var buttons [][]telegram.Button
+	if valid > 0 {
+		id := strconv.FormatInt(in.AttachmentID, 10)
+		buttons = [][]telegram.Button{{
+			{Text: fmt.Sprintf("✅ Importa %d prenotazioni", valid), CallbackData: "rimp:ok:" + id},
+			{Text: "❌ Annulla", CallbackData: "rimp:no:" + id},
+		}}
+	}
+	if _, err := sendKeyboard(bg, t.imp.botToken, ctx.ChatID, text, buttons); err != nil {
+		return "", fmt.Errorf("send preview: %w", err)
+	}
+	if valid == 0 {
+		return "Anteprima inviata: nessuna riga da importare. " + htmlToText(text), nil
+	}
+	return fmt.Sprintf("Anteprima inviata con i pulsanti: %d prenotazioni pronte. L'importazione parte solo quando il manager "+
+		"preme «Importa»; non confermarla tu.", valid), nil
+}
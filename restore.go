@@ -0,0 +1,429 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Restore verification: a backup only counts once it has been restored.
+// Backups are pg_dump files written into BACKUP_DIR outside the bot (cron,
+// the hosting provider). /restorecheck (admin only) restores the newest one
+// into a scratch database, runs restoreDiagnostics against it, compares it
+// with the live database and reports whether a recovery would work. It also
+// reports the recovery point: the newest write found in the dump, which is
+// how far back a recovery from it would take the hotel. The scratch database
+// is dropped at the end.
+//
+// Plain dumps (.sql, .sql.gz) are replayed with psql, custom-format ones
+// (.dump) with pg_restore; both must be on PATH.
+//
+// Configure via env:
+//
+//	BACKUP_DIR=                          directory of the pg_dump files; empty disables /restorecheck
+//	RESTORE_CHECK_DB=m4d_restore_check   scratch database, dropped and recreated on every run
+
+// restoreTimeout bounds the restore and the diagnostics.
+const restoreTimeout = 30 * time.Minute
+
+// backupSuffixes are the dump files /restorecheck considers.
+var backupSuffixes = []string{".dump", ".sql", ".sql.gz"}
+
+// restoreFunctions are the SQL functions the RLS policies and triggers need.
+var restoreFunctions = []string{"current_telegram_id", "current_hotel_id", "is_manager", "assign_hotel_id"}
+
+type restoreChecker struct {
+	adminPool *pgxpool.Pool
+	dbURL     string
+	botToken  string
+	adminID   int64
+	dir       string
+	scratch   string
+	running   sync.Mutex
+}
+
+func newRestoreChecker(adminPool *pgxpool.Pool, dbURL, botToken string, adminID int64) *restoreChecker {
+	return &restoreChecker{
+		adminPool: adminPool,
+		dbURL:     dbURL,
+		botToken:  botToken,
+		adminID:   adminID,
+		dir:       envOr("BACKUP_DIR", ""),
+		scratch:   envOr("RESTORE_CHECK_DB", "m4d_restore_check"),
+	}
+}
+
+// Register wires /restorecheck.
+func (r *restoreChecker) Register(m *routedMessenger) {
+	m.Handle("/restorecheck", r.handleCommand)
+}
+
+func (r *restoreChecker) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := telegram.New(r.botToken)
+	if u.UserID != r.adminID {
+		return tg.Send(ctx, u.ChatID, "🔒 /restorecheck è riservato all'amministratore.")
+	}
+	if r.dir == "" {
+		return tg.Send(ctx, u.ChatID, "BACKUP_DIR non è impostata: non so dove sono i backup.")
+	}
+	if !r.running.TryLock() {
+		return tg.Send(ctx, u.ChatID, "⏳ Una verifica è già in corso.")
+	}
+	backup, err := newestBackup(r.dir)
+	if err != nil {
+		r.running.Unlock()
+		return tg.Send(ctx, u.ChatID, "❌ "+err.Error())
+	}
+	if err := tg.Send(ctx, u.ChatID, fmt.Sprintf("⏳ Ripristino di `%s` (%s) in un database di prova, ti scrivo quando ho finito.",
+		filepath.Base(backup.path), backup.modTime.In(romeLocation()).Format("02/01 15:04"))); err != nil {
+		log.Printf("restore check: %v", err)
+	}
+	// The restore takes minutes: the chat must not wait for it.
+	go func() {
+		defer r.running.Unlock()
+		rctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+		defer cancel()
+		report := r.check(rctx, backup)
+		log.Printf("restore check: %s", oneLine(report))
+		if err := tg.Send(context.Background(), u.ChatID, report); err != nil {
+			log.Printf("restore check: send report: %v", err)
+		}
+	}()
+	return nil
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// newestBackup returns the most recent dump file in dir.
+func newestBackup(dir string) (backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return backupFile{}, fmt.Errorf("read BACKUP_DIR: %w", err)
+	}
+	var newest backupFile
+	for _, e := range entries {
+		if e.IsDir() || !hasBackupSuffix(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(newest.modTime) {
+			newest = backupFile{path: filepath.Join(dir, e.Name()), modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	if newest.path == "" {
+		return newest, fmt.Errorf("nessun backup (%s) in %s", strings.Join(backupSuffixes, ", "), dir)
+	}
+	return newest, nil
+}
+
+func hasBackupSuffix(name string) bool {
+	for _, s := range backupSuffixes {
+		if strings.HasSuffix(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// check restores backup into the scratch database, diagnoses it and drops
+// it, returning the report for the admin.
+func (r *restoreChecker) check(ctx context.Context, backup backupFile) string {
+	start := time.Now()
+	name := pgx.Identifier{r.scratch}.Sanitize()
+	if _, err := r.adminPool.Exec(ctx, `DROP DATABASE IF EXISTS `+name+` WITH (FORCE)`); err != nil {
+		return fmt.Sprintf("❌ Verifica non eseguita: drop %s: %v", r.scratch, err)
+	}
+	if _, err := r.adminPool.Exec(ctx, `CREATE DATABASE `+name); err != nil {
+		return fmt.Sprintf("❌ Verifica non eseguita: create %s: %v", r.scratch, err)
+	}
+	defer func() {
+		if _, err := r.adminPool.Exec(context.Background(), `DROP DATABASE IF EXISTS `+name+` WITH (FORCE)`); err != nil {
+			log.Printf("restore check: drop %s: %v", r.scratch, err)
+		}
+	}()
+
+	cfg, err := pgxpool.ParseConfig(r.dbURL)
+	if err != nil {
+		return fmt.Sprintf("❌ Verifica non eseguita: DATABASE_URL: %v", err)
+	}
+	cfg.ConnConfig.Database = r.scratch
+	if out, err := restoreDump(ctx, cfg.ConnConfig, backup.path); err != nil {
+		return fmt.Sprintf("❌ Il ripristino di `%s` è fallito: %v\n%s", filepath.Base(backup.path), err, lastLines(out, 10))
+	}
+	restored := time.Since(start)
+
+	scratch, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Sprintf("❌ Ripristinato ma non raggiungibile: %v", err)
+	}
+	defer scratch.Close()
+	checks, recoveryPoint, err := restoreDiagnostics(ctx, r.adminPool, scratch)
+	if err != nil {
+		return fmt.Sprintf("❌ Ripristinato ma la diagnostica è fallita: %v", err)
+	}
+
+	var sb strings.Builder
+	failed := 0
+	for _, c := range checks {
+		if !c.ok {
+			failed++
+		}
+	}
+	if failed == 0 {
+		sb.WriteString("✅ Il backup si ripristina e i dati sono coerenti: un recupero funzionerebbe.\n")
+	} else {
+		fmt.Fprintf(&sb, "❌ Il backup si ripristina ma %d controlli non passano: un recupero sarebbe incompleto.\n", failed)
+	}
+	fmt.Fprintf(&sb, "\nBackup: `%s`, %.1f MB, del %s\n", filepath.Base(backup.path),
+		float64(backup.size)/(1<<20), backup.modTime.In(romeLocation()).Format("02/01/2006 15:04"))
+	fmt.Fprintf(&sb, "Ripristino in %s\n", restored.Round(time.Second))
+	if !recoveryPoint.IsZero() {
+		age := time.Since(recoveryPoint)
+		ago := formatMinutes(int(age.Minutes()))
+		if age >= 48*time.Hour {
+			ago = fmt.Sprintf("%d giorni", int(age.Hours()/24))
+		}
+		fmt.Fprintf(&sb, "Punto di ripristino: %s (%s fa), quanto scritto dopo andrebbe perso\n",
+			recoveryPoint.In(romeLocation()).Format("02/01/2006 15:04"), ago)
+	}
+	sb.WriteString("\n")
+	for _, c := range checks {
+		icon := "✅"
+		if !c.ok {
+			icon = "❌"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s\n", icon, c.name, c.detail)
+	}
+	return sb.String()
+}
+
+// restoreDump replays path into the database of conn with psql or
+// pg_restore, returning their output.
+func restoreDump(ctx context.Context, conn *pgx.ConnConfig, path string) (string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasSuffix(path, ".dump"):
+		cmd = exec.CommandContext(ctx, "pg_restore", "--no-owner", "--no-privileges", "--exit-on-error", "-d", conn.Database, path)
+	case strings.HasSuffix(path, ".sql.gz"):
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("gunzip: %w", err)
+		}
+		cmd = exec.CommandContext(ctx, "psql", "-q", "-v", "ON_ERROR_STOP=1", "-d", conn.Database)
+		cmd.Stdin = gz
+	default:
+		cmd = exec.CommandContext(ctx, "psql", "-q", "-v", "ON_ERROR_STOP=1", "-d", conn.Database, "-f", path)
+	}
+	cmd.Env = append(os.Environ(),
+		"PGHOST="+conn.Host,
+		fmt.Sprintf("PGPORT=%d", conn.Port),
+		"PGUSER="+conn.User,
+		"PGPASSWORD="+conn.Password,
+	)
+	var out strings.Builder
+	cmd.Stdout = io.Discard
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+type restoreCheck struct {
+	name, detail string
+	ok           bool
+}
+
+// restoreDiagnostics compares the restored database with the live one:
+// tables, row-level security and the functions it relies on, row counts,
+// and the newest created_at/updated_at found (the recovery point).
+func restoreDiagnostics(ctx context.Context, live, restored *pgxpool.Pool) ([]restoreCheck, time.Time, error) {
+	var checks []restoreCheck
+
+	liveTables, err := publicTables(ctx, live)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	gotTables, err := publicTables(ctx, restored)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var missing, noRLS []string
+	for name, rls := range liveTables {
+		got, ok := gotTables[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case rls && !got:
+			noRLS = append(noRLS, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(noRLS)
+	c := restoreCheck{name: "Tabelle", ok: len(missing) == 0, detail: fmt.Sprintf("%d di %d", len(liveTables)-len(missing), len(liveTables))}
+	if len(missing) > 0 {
+		c.detail += ", mancano " + strings.Join(missing, ", ")
+	}
+	checks = append(checks, c)
+	c = restoreCheck{name: "Row-level security", ok: len(noRLS) == 0, detail: "attiva come in produzione"}
+	if len(noRLS) > 0 {
+		c.detail = "disattivata su " + strings.Join(noRLS, ", ")
+	}
+	checks = append(checks, c)
+
+	var noFunc []string
+	for _, f := range restoreFunctions {
+		var ok bool
+		if err := restored.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+			                WHERE n.nspname = 'public' AND p.proname = $1)`, f).Scan(&ok); err != nil {
+			return nil, time.Time{}, err
+		}
+		if !ok {
+			noFunc = append(noFunc, f)
+		}
+	}
+	c = restoreCheck{name: "Funzioni", ok: len(noFunc) == 0, detail: strings.Join(restoreFunctions, ", ")}
+	if len(noFunc) > 0 {
+		c.detail = "mancano " + strings.Join(noFunc, ", ")
+	}
+	checks = append(checks, c)
+
+	// Row counts: the core tables must not be empty, and a table empty in
+	// the backup but not live points at a partial dump.
+	var counts, emptied []string
+	coreOK := true
+	for _, t := range []string{"hotels", "users", "rooms", "reservations", "assignments"} {
+		if _, ok := gotTables[t]; !ok {
+			continue
+		}
+		var n int64
+		if err := restored.QueryRow(ctx, `SELECT count(*) FROM `+pgx.Identifier{t}.Sanitize()).Scan(&n); err != nil {
+			return nil, time.Time{}, err
+		}
+		counts = append(counts, fmt.Sprintf("%s %d", t, n))
+		if n == 0 && (t == "hotels" || t == "users" || t == "rooms") {
+			coreOK = false
+		}
+	}
+	checks = append(checks, restoreCheck{name: "Dati principali", ok: coreOK, detail: strings.Join(counts, ", ")})
+	for name := range gotTables {
+		if _, ok := liveTables[name]; !ok {
+			continue
+		}
+		var gotAny, liveAny bool
+		q := `SELECT EXISTS (SELECT 1 FROM ` + pgx.Identifier{name}.Sanitize() + `)`
+		if err := restored.QueryRow(ctx, q).Scan(&gotAny); err != nil {
+			return nil, time.Time{}, err
+		}
+		if err := live.QueryRow(ctx, q).Scan(&liveAny); err != nil {
+			return nil, time.Time{}, err
+		}
+		if liveAny && !gotAny {
+			emptied = append(emptied, name)
+		}
+	}
+	sort.Strings(emptied)
+	c = restoreCheck{name: "Tabelle vuote nel backup", ok: len(emptied) == 0, detail: "nessuna che in produzione abbia dati"}
+	if len(emptied) > 0 {
+		c.detail = strings.Join(emptied, ", ")
+	}
+	checks = append(checks, c)
+
+	recoveryPoint, err := newestWrite(ctx, restored)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return checks, recoveryPoint, nil
+}
+
+// publicTables returns the tables of the public schema with whether
+// row-level security is enabled on them.
+func publicTables(ctx context.Context, db *pgxpool.Pool) (map[string]bool, error) {
+	rows, err := db.Query(ctx,
+		`SELECT c.relname, c.relrowsecurity FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		 WHERE n.nspname = 'public' AND c.relkind = 'r'`)
+	if err != nil {
+		return nil, fmt.Errorf("query tables: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		var rls bool
+		if err := rows.Scan(&name, &rls); err != nil {
+			return nil, err
+		}
+		out[name] = rls
+	}
+	return out, rows.Err()
+}
+
+// newestWrite is the latest created_at or updated_at in db, up to now.
+func newestWrite(ctx context.Context, db *pgxpool.Pool) (time.Time, error) {
+	rows, err := db.Query(ctx,
+		`SELECT table_name, column_name FROM information_schema.columns
+		 WHERE table_schema = 'public' AND column_name IN ('created_at', 'updated_at')
+		   AND data_type = 'timestamp with time zone'`)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query timestamp columns: %w", err)
+	}
+	var cols [][2]string
+	for rows.Next() {
+		var t, c string
+		if err := rows.Scan(&t, &c); err != nil {
+			rows.Close()
+			return time.Time{}, err
+		}
+		cols = append(cols, [2]string{t, c})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return time.Time{}, err
+	}
+	var newest time.Time
+	for _, tc := range cols {
+		var t *time.Time
+		if err := db.QueryRow(ctx,
+			`SELECT max(`+pgx.Identifier{tc[1]}.Sanitize()+`) FROM `+pgx.Identifier{tc[0]}.Sanitize()+
+				` WHERE `+pgx.Identifier{tc[1]}.Sanitize()+` <= now()`).Scan(&t); err != nil {
+			return time.Time{}, fmt.Errorf("newest write of %s: %w", tc[0], err)
+		}
+		if t != nil && t.After(newest) {
+			newest = *t
+		}
+	}
+	return newest, nil
+}
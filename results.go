@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Large query results as files. A SELECT of a few hundred rows rendered as
+// pipe-separated text fills the model's context and, repeated back, floods
+// the chat with a wall of chunked messages. Past a threshold, execute_sql,
+// run_report and the scheduled reports send the result as a ;-separated CSV
+// document in the chat instead, and the model only gets the row count, the
+// columns and the first rows to summarize.
+//
+// Configure via env:
+//
+//	SQL_INLINE_MAX_ROWS=30      more rows than this go out as a CSV file
+//	SQL_INLINE_MAX_CHARS=3500   so does a longer text table
+
+// resultPreviewRows is how many rows the model sees of a result sent as a file.
+const resultPreviewRows = 5
+
+// rowSet is a query result read into memory, cells already rendered.
+type rowSet struct {
+	headers []string
+	rows    [][]string
+}
+
+func collectRows(rows pgx.Rows) (rowSet, error) {
+	var rs rowSet
+	for _, f := range rows.FieldDescriptions() {
+		rs.headers = append(rs.headers, string(f.Name))
+	}
+	for rows.Next() {
+		vals, err := rows.Values()
+		if err != nil {
+			return rs, err
+		}
+		cells := make([]string, len(vals))
+		for i, v := range vals {
+			cells[i] = fmt.Sprintf("%v", v)
+		}
+		rs.rows = append(rs.rows, cells)
+	}
+	return rs, rows.Err()
+}
+
+// table renders the first limit rows (0 = all) like formatRows.
+func (rs rowSet) table(limit int) string {
+	var sb strings.Builder
+	sb.WriteString(strings.Join(rs.headers, " | "))
+	sb.WriteString("\n" + strings.Repeat("-", 40) + "\n")
+	for i, r := range rs.rows {
+		if limit > 0 && i >= limit {
+			break
+		}
+		sb.WriteString(strings.Join(r, " | ") + "\n")
+	}
+	if len(rs.rows) == 0 {
+		sb.WriteString("(no rows)\n")
+	}
+	return sb.String()
+}
+
+func (rs rowSet) csv() []byte {
+	var sb strings.Builder
+	line := func(cells []string) {
+		for i, c := range cells {
+			if i > 0 {
+				sb.WriteString(";")
+			}
+			sb.WriteString(csvField(c))
+		}
+		sb.WriteString("\n")
+	}
+	line(rs.headers)
+	for _, r := range rs.rows {
+		line(r)
+	}
+	return []byte(sb.String())
+}
+
+// oversized reports whether the result is too big for the chat.
+func (rs rowSet) oversized() bool {
+	if len(rs.rows) > envInt("SQL_INLINE_MAX_ROWS", 30) {
+		return true
+	}
+	return len([]rune(rs.table(0))) > envInt("SQL_INLINE_MAX_CHARS", 3500)
+}
+
+// deliverRows returns the result as a text table, or, when it is oversized,
+// sends it to chatID as <name>_<date>.csv and returns a short summary for
+// the model.
+func deliverRows(ctx context.Context, botToken string, chatID int64, rs rowSet, name string) (string, error) {
+	if !rs.oversized() {
+		return rs.table(0), nil
+	}
+	file := fmt.Sprintf("%s_%s.csv", name, time.Now().In(romeLocation()).Format("20060102_1504"))
+	if err := sendDocument(ctx, botToken, chatID, file, rs.csv(),
+		fmt.Sprintf("%d righe, %d colonne", len(rs.rows), len(rs.headers))); err != nil {
+		return "", fmt.Errorf("send file: %w", err)
+	}
+	return fmt.Sprintf("📄 %d righe: troppe per la chat, il risultato completo è stato inviato come file %s.\n"+
+		"Colonne: %s\nPrime %d righe:\n%s"+
+		"Non ricopiare le righe: riassumi il risultato (totali, casi notevoli) e rimanda al file.",
+		len(rs.rows), file, strings.Join(rs.headers, ", "), min(resultPreviewRows, len(rs.rows)),
+		rs.table(resultPreviewRows)), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Cleaning reviews: a manager scores a completed assignment 1–5, with optional
+// notes. There is one review per assignment — scoring it again replaces the
+// previous one. The scores feed cleaner_stats and its Monday report.
+
+// ── review_cleaning ──────────────────────────────────────────────────────────
+
+type reviewCleaningTool struct{}
+
+func (t *reviewCleaningTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "review_cleaning",
+		Description: "Valuta una pulizia completata con un voto da 1 a 5 e note facoltative. Indica assignment_id, " +
+			"oppure la camera (e il giorno, default oggi) per valutarne l'ultima pulizia completata. Una nuova valutazione " +
+			"della stessa pulizia sostituisce la precedente. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"assignment_id": {"type": "integer", "description": "ID dell'assegnazione"},
+				"room": {"type": "string", "description": "Nome della camera, in alternativa ad assignment_id"},
+				"date": {"type": "string", "description": "Giorno della pulizia YYYY-MM-DD, con room (default: oggi)"},
+				"score": {"type": "integer", "minimum": 1, "maximum": 5, "description": "Voto da 1 (pessima) a 5 (perfetta)"},
+				"notes": {"type": "string", "description": "Cosa è andato bene o male"}
+			},
+			"required": ["score"]
+		}`),
+	}
+}
+
+func (t *reviewCleaningTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		AssignmentID int64  `json:"assignment_id"`
+		Room         string `json:"room"`
+		Date         string `json:"date"`
+		Score        int    `json:"score"`
+		Notes        string `json:"notes"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Score < 1 || in.Score > 5 {
+		return "", fmt.Errorf("score must be between 1 and 5")
+	}
+	if in.AssignmentID == 0 && strings.TrimSpace(in.Room) == "" {
+		return "", fmt.Errorf("assignment_id or room is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("review_cleaning is only available to managers")
+	}
+
+	var (
+		id                          int64
+		room, cleaner, kind, status string
+		day                         time.Time
+	)
+	const pick = `SELECT a.id, r.name, COALESCE(u.name, a.cleaner_id::text), a.type, a.status, a.date
+		 FROM assignments a
+		 JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN users u ON u.telegram_id = a.cleaner_id`
+	if in.AssignmentID != 0 {
+		err = db.QueryRow(bg, pick+` WHERE a.id = $1`, in.AssignmentID).
+			Scan(&id, &room, &cleaner, &kind, &status, &day)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("assegnazione #%d non trovata", in.AssignmentID)
+		}
+	} else {
+		date := time.Now().In(romeLocation()).Format("2006-01-02")
+		if in.Date != "" {
+			d, perr := time.Parse("2006-01-02", in.Date)
+			if perr != nil {
+				return "", fmt.Errorf("invalid date %q: use YYYY-MM-DD", in.Date)
+			}
+			date = d.Format("2006-01-02")
+		}
+		// Prefer the completed clean of that day; fall back to any, so the
+		// refusal below can say why it cannot be scored.
+		err = db.QueryRow(bg, pick+` WHERE lower(r.name) = lower($1) AND a.date = $2
+			 ORDER BY a.status = 'done' DESC, a.completed_at DESC NULLS LAST
+			 LIMIT 1`, strings.TrimSpace(in.Room), date).
+			Scan(&id, &room, &cleaner, &kind, &status, &day)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("nessuna pulizia della camera %s il %s", in.Room, date)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("query assignment: %w", err)
+	}
+	if status != "done" {
+		return "", fmt.Errorf("la pulizia della camera %s del %s (#%d) è %s: si valutano solo le pulizie completate",
+			room, day.Format("02/01"), id, status)
+	}
+
+	var replaced bool
+	if err := db.QueryRow(bg,
+		`INSERT INTO reviews (assignment_id, reviewer_id, score, notes)
+		 VALUES ($1, current_telegram_id(), $2, NULLIF($3, ''))
+		 ON CONFLICT (assignment_id) DO UPDATE
+		   SET reviewer_id = EXCLUDED.reviewer_id, score = EXCLUDED.score,
+		       notes = EXCLUDED.notes, created_at = now()
+		 RETURNING xmax <> 0`, id, in.Score, strings.TrimSpace(in.Notes),
+	).Scan(&replaced); err != nil {
+		return "", fmt.Errorf("save review: %w", err)
+	}
+
+	msg := fmt.Sprintf("⭐ %d/5 per la pulizia (%s) della camera %s del %s, di %s.",
+		in.Score, kind, room, day.Format("02/01"), cleaner)
+	if replaced {
+		msg += " Sostituisce la valutazione precedente."
+	}
+	return msg, nil
+}
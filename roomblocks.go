@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Room blocks take a room out of service for a period (renovation, a broken
+// boiler, a room kept for the owner). The reservations trigger refuses stays
+// on blocked nights, availableRooms skips the room, and the lifecycle moves
+// rooms.status to out_of_service while a block covers today (lifecycle.go).
+// Lifted blocks stay in room_blocks as history.
+
+// roomBlockMaxDays bounds a block; a room closed for longer should be
+// removed from rooms.
+const roomBlockMaxDays = 366
+
+// blockPeriod is "il 20/10" or "dal 20/10 al 24/10".
+func blockPeriod(from, to time.Time) string {
+	if from.Equal(to) {
+		return "il " + from.Format("02/01")
+	}
+	return fmt.Sprintf("dal %s al %s", from.Format("02/01"), to.Format("02/01"))
+}
+
+// ── block_room ───────────────────────────────────────────────────────────────
+
+type blockRoomTool struct{}
+
+func (t *blockRoomTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "block_room",
+		Description: "Mette fuori servizio una o più camere per un periodo (lavori, guasto, uso del proprietario): nessuna " +
+			"prenotazione potrà cadere in quelle notti e la camera non compare tra le disponibili. Rifiuta i periodi con " +
+			"prenotazioni confermate o opzioni attive: vanno prima spostate. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"rooms": {"type": "array", "items": {"type": "string"}, "description": "Camere da bloccare"},
+				"from": {"type": "string", "description": "Primo giorno fuori servizio, YYYY-MM-DD"},
+				"to": {"type": "string", "description": "Ultimo giorno fuori servizio, YYYY-MM-DD (default from)"},
+				"reason": {"type": "string", "description": "Motivo, es. 'ristrutturazione bagno'"}
+			},
+			"required": ["rooms", "from", "reason"]
+		}`),
+	}
+}
+
+func (t *blockRoomTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Rooms  []string `json:"rooms"`
+		From   string   `json:"from"`
+		To     string   `json:"to"`
+		Reason string   `json:"reason"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Rooms) == 0 || in.From == "" || strings.TrimSpace(in.Reason) == "" {
+		return "", fmt.Errorf("rooms, from and reason are required")
+	}
+	from, to, err := parseReportRange(in.From, in.To, time.Time{},
+		func(from time.Time) time.Time { return from }, roomBlockMaxDays)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().In(romeLocation())
+	if from.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+		return "", fmt.Errorf("a block cannot start in the past")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("block_room is only available to managers")
+	}
+
+	var lines []string
+	var room string
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		for _, room = range in.Rooms {
+			var roomID, id int64
+			var name string
+			err := tx.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower(trim($1))`, room).Scan(&roomID, &name)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("camera %q non trovata", room)
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.QueryRow(bg,
+				`INSERT INTO room_blocks (room_id, from_date, to_date, reason, created_by)
+				 VALUES ($1, $2, $3, trim($4), $5) RETURNING id`,
+				roomID, from.Format("2006-01-02"), to.Format("2006-01-02"), in.Reason, ctx.UserID,
+			).Scan(&id); err != nil {
+				return err
+			}
+			lines = append(lines, fmt.Sprintf("• %s (blocco #%d)", name, id))
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" {
+		return fmt.Sprintf("❌ Camera %s: %s. Sposta prima la prenotazione; nessuna camera è stata bloccata.",
+			room, pgErr.Message), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("🚧 Fuori servizio %s (%s):\n%s", blockPeriod(from, to), strings.TrimSpace(in.Reason),
+		strings.Join(lines, "\n")), nil
+}
+
+// ── lift_block ───────────────────────────────────────────────────────────────
+
+type liftBlockTool struct{}
+
+func (t *liftBlockTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "lift_block",
+		Description: "Toglie un blocco fuori servizio (lavori finiti prima, blocco inserito per errore): la camera torna " +
+			"prenotabile e, se era ferma oggi, disponibile. Indica block_id, oppure la camera: senza block_id elenca i " +
+			"suoi blocchi in corso e futuri se sono più di uno. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"block_id": {"type": "integer", "description": "Numero del blocco"},
+				"room": {"type": "string", "description": "Camera (se non conosci il block_id)"}
+			}
+		}`),
+	}
+}
+
+func (t *liftBlockTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		BlockID int64  `json:"block_id"`
+		Room    string `json:"room"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.BlockID == 0 && strings.TrimSpace(in.Room) == "" {
+		return "", fmt.Errorf("give block_id or room")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("lift_block is only available to managers")
+	}
+
+	if in.BlockID == 0 {
+		rows, err := db.Query(bg,
+			`SELECT b.id, r.name, b.from_date, b.to_date, b.reason
+			 FROM room_blocks b JOIN rooms r ON r.id = b.room_id
+			 WHERE lower(r.name) = lower(trim($1)) AND b.lifted_at IS NULL
+			   AND b.to_date >= (now() AT TIME ZONE 'Europe/Rome')::date
+			 ORDER BY b.from_date`, in.Room)
+		if err != nil {
+			return "", fmt.Errorf("query blocks: %w", err)
+		}
+		var ids []int64
+		var lines []string
+		for rows.Next() {
+			var id int64
+			var room, reason string
+			var from, to time.Time
+			if err := rows.Scan(&id, &room, &from, &to, &reason); err != nil {
+				rows.Close()
+				return "", err
+			}
+			ids = append(ids, id)
+			lines = append(lines, fmt.Sprintf("• #%d %s: %s (%s)", id, room, blockPeriod(from, to), reason))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		switch len(ids) {
+		case 0:
+			return fmt.Sprintf("La camera %s non ha blocchi in corso o futuri.", in.Room), nil
+		case 1:
+			in.BlockID = ids[0]
+		default:
+			return "La camera ha più blocchi, indica quale con block_id:\n" + strings.Join(lines, "\n"), nil
+		}
+	}
+
+	var room, reason string
+	var from, to time.Time
+	err = db.QueryRow(bg,
+		`UPDATE room_blocks b SET lifted_at = now(), lifted_by = $2
+		 FROM rooms r
+		 WHERE b.id = $1 AND r.id = b.room_id AND b.lifted_at IS NULL
+		 RETURNING r.name, b.from_date, b.to_date, b.reason`, in.BlockID, ctx.UserID,
+	).Scan(&room, &from, &to, &reason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("blocco #%d non trovato o già tolto", in.BlockID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("lift block: %w", err)
+	}
+	return fmt.Sprintf("✅ Blocco #%d tolto: la camera %s è di nuovo prenotabile (era fuori servizio %s, %s).",
+		in.BlockID, room, blockPeriod(from, to), reason), nil
+}
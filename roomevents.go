@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventRoomStatus is the AgentEvent kind published for room status changes.
+const EventRoomStatus agent.EventKind = "room_status"
+
+// RoomStatusChange is one row of room_status_events: a rooms.status transition
+// captured by the rooms_status_change trigger (db/rls.sql), whoever made it.
+type RoomStatusChange struct {
+	ID        int64     `json:"id"`
+	HotelID   int       `json:"hotel_id"`
+	RoomID    int64     `json:"room_id"`
+	RoomName  string    `json:"room_name"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	ActorID   *int64    `json:"actor_id"` // nil when changed by the bot itself
+	ActorName string    `json:"actor_name"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// RoomEvents dispatches room status changes to in-process subscribers. The
+// trigger writes every change to room_status_events and NOTIFYs
+// 'room_status'; the dispatcher LISTENs and delivers rows in order, stamping
+// dispatched_at so nothing is lost or repeated across restarts.
+//
+// Built-in subscribers, configured via env:
+//
+//	ROOM_STATUS_WEBHOOK_URL=https://…   POST each change as JSON
+//	ROOM_STATUS_AGENT_EVENTS=1          publish an AgentEvent to each manager of
+//	                                    the room's property (off by default: each
+//	                                    one is an LLM turn)
+type RoomEvents struct {
+	pool *pgxpool.Pool
+	mu   sync.RWMutex
+	subs []func(context.Context, RoomStatusChange)
+}
+
+func newRoomEvents(pool *pgxpool.Pool) *RoomEvents {
+	return &RoomEvents{pool: pool}
+}
+
+// Subscribe registers fn for every future room status change. fn runs on the
+// dispatcher goroutine and must not block for long.
+func (e *RoomEvents) Subscribe(fn func(context.Context, RoomStatusChange)) {
+	e.mu.Lock()
+	e.subs = append(e.subs, fn)
+	e.mu.Unlock()
+}
+
+// SubscribeDefaults wires the env-configured webhook and bus subscribers.
+func (e *RoomEvents) SubscribeDefaults(bus agent.EventBus) {
+	if url := envOr("ROOM_STATUS_WEBHOOK_URL", ""); url != "" {
+		client := &http.Client{Timeout: 10 * time.Second}
+		e.Subscribe(func(ctx context.Context, c RoomStatusChange) {
+			body, _ := json.Marshal(c)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				log.Printf("room events: webhook request: %v", err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				log.Printf("room events: webhook: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				log.Printf("room events: webhook returned %s", resp.Status)
+			}
+		})
+		log.Printf("room events: webhook enabled")
+	}
+
+	if envOr("ROOM_STATUS_AGENT_EVENTS", "") == "1" && bus != nil {
+		e.Subscribe(func(ctx context.Context, c RoomStatusChange) {
+			managers, err := managerIDs(ctx, e.pool, c.HotelID)
+			if err != nil {
+				log.Printf("room events: %v", err)
+				return
+			}
+			for _, managerID := range managers {
+				bus.Publish(agent.AgentEvent{
+					Kind:     EventRoomStatus,
+					TargetID: managerID,
+					ChatID:   managerID,
+					Content: fmt.Sprintf("🏷 Room %s: %s → %s (by %s). Act only if this needs attention, otherwise reply OK.",
+						c.RoomName, c.OldStatus, c.NewStatus, c.ActorName),
+					Source:  "room_status",
+					EventID: generateUUID(),
+				})
+			}
+		})
+		log.Printf("room events: agent events enabled")
+	}
+}
+
+// Start launches the dispatcher goroutine.
+func (e *RoomEvents) Start(ctx context.Context) {
+	startListener(ctx, e.pool, "room_status", e.drain)
+}
+
+func (e *RoomEvents) drain(ctx context.Context) {
+	rows, err := e.pool.Query(ctx,
+		`SELECT ev.id, ev.hotel_id, ev.room_id, r.name, ev.old_status, ev.new_status, ev.actor_id,
+		        COALESCE(u.name, 'system'), ev.changed_at
+		 FROM room_status_events ev
+		 JOIN rooms r ON r.id = ev.room_id
+		 LEFT JOIN users u ON u.telegram_id = ev.actor_id
+		 WHERE ev.dispatched_at IS NULL
+		 ORDER BY ev.id`,
+	)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("room events query: %v", err)
+		}
+		return
+	}
+	var pending []RoomStatusChange
+	for rows.Next() {
+		var c RoomStatusChange
+		if err := rows.Scan(&c.ID, &c.HotelID, &c.RoomID, &c.RoomName, &c.OldStatus, &c.NewStatus,
+			&c.ActorID, &c.ActorName, &c.ChangedAt); err != nil {
+			log.Printf("room events scan: %v", err)
+			continue
+		}
+		pending = append(pending, c)
+	}
+	rows.Close()
+
+	e.mu.RLock()
+	subs := append([]func(context.Context, RoomStatusChange){}, e.subs...)
+	e.mu.RUnlock()
+
+	for _, c := range pending {
+		for _, fn := range subs {
+			fn(ctx, c)
+		}
+		if _, err := e.pool.Exec(ctx,
+			`UPDATE room_status_events SET dispatched_at = now() WHERE id = $1`, c.ID,
+		); err != nil {
+			log.Printf("room events mark dispatched (id=%d): %v", c.ID, err)
+		}
+	}
+}
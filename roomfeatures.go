@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Room features are what a guest asks for on the phone: a pet, a
+// wheelchair, a balcony, two rooms with a door in between for a family.
+// They are columns of rooms, set with set_room_features, and both
+// check_availability and quote take a features filter; a "connecting" room
+// only qualifies when the room it connects to is free as well.
+//
+// A family taking both connecting rooms gets two reservations, inserted in
+// one transaction (so the overlap trigger refuses the pair or neither) and
+// pointing at each other through linked_reservation_id: confirm_option
+// confirms or releases them together.
+
+// roomFeatureNames are the values of the features filter.
+var roomFeatureNames = []string{"pets", "accessible", "balcony", "connecting"}
+
+// checkRoomFeatures validates a features filter.
+func checkRoomFeatures(want []string) error {
+	for _, f := range want {
+		found := false
+		for _, n := range roomFeatureNames {
+			if f == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown feature %q: use %s", f, strings.Join(roomFeatureNames, ", "))
+		}
+	}
+	return nil
+}
+
+// has reports whether the room offers feature.
+func (r roomRef) has(feature string) bool {
+	switch feature {
+	case "pets":
+		return r.pets
+	case "accessible":
+		return r.accessible
+	case "balcony":
+		return r.balcony
+	case "connecting":
+		return r.connectingID != 0
+	}
+	return false
+}
+
+// featureLabels describes the room's features in Italian.
+func (r roomRef) featureLabels() []string {
+	var out []string
+	if r.accessible {
+		out = append(out, "accessibile")
+	}
+	if r.pets {
+		out = append(out, "animali ammessi")
+	}
+	if r.balcony {
+		out = append(out, "balcone")
+	}
+	if r.connecting != "" {
+		out = append(out, "comunicante con "+r.connecting)
+	}
+	return out
+}
+
+// withFeatures keeps the rooms offering every feature in want; connecting
+// rooms also need their twin among rooms (i.e. free in the same period).
+func withFeatures(rooms []roomRef, want []string) []roomRef {
+	if len(want) == 0 {
+		return rooms
+	}
+	free := make(map[int64]bool, len(rooms))
+	for _, r := range rooms {
+		free[r.id] = true
+	}
+	var out []roomRef
+	for _, r := range rooms {
+		ok := true
+		for _, f := range want {
+			if !r.has(f) || (f == "connecting" && !free[r.connectingID]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// splitParty divides a party between two connecting rooms: the first gets
+// the larger half, children go to the second first.
+func splitParty(guests, children int) (g1, c1, g2, c2 int) {
+	g2 = guests / 2
+	g1 = guests - g2
+	c2 = min(children, g2)
+	c1 = children - c2
+	return g1, c1, g2, c2
+}
+
+// splitAmount halves a stay price between two connecting rooms.
+func splitAmount(amount *float64) (a, b *float64) {
+	if amount == nil {
+		return nil, nil
+	}
+	half := roundCents(*amount / 2)
+	rest := roundCents(*amount - half)
+	return &half, &rest
+}
+
+// linkReservations makes two reservations of connecting rooms a pair.
+func linkReservations(ctx context.Context, tx pgx.Tx, a, b int64) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE reservations SET linked_reservation_id = CASE id WHEN $1 THEN $2 ELSE $1 END WHERE id IN ($1, $2)`, a, b)
+	if err != nil {
+		return fmt.Errorf("link reservations: %w", err)
+	}
+	return nil
+}
+
+// ── set_room_features ────────────────────────────────────────────────────────
+
+type setRoomFeaturesTool struct{}
+
+func (t *setRoomFeaturesTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_room_features",
+		Description: "Imposta le caratteristiche di una o più camere (animali ammessi, accessibile, balcone, camera comunicante) " +
+			"usate da check_availability e quote. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"rooms": {"type": "array", "items": {"type": "string"}, "description": "Camere da modificare"},
+				"pets": {"type": "boolean", "description": "Animali ammessi"},
+				"accessible": {"type": "boolean", "description": "Accessibile in sedia a rotelle"},
+				"balcony": {"type": "boolean", "description": "Con balcone o terrazzo"},
+				"connecting_room": {"type": "string", "description": "Camera comunicante (una sola camera in rooms); 'none' per scollegarla"}
+			},
+			"required": ["rooms"]
+		}`),
+	}
+}
+
+func (t *setRoomFeaturesTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Rooms          []string `json:"rooms"`
+		Pets           *bool    `json:"pets"`
+		Accessible     *bool    `json:"accessible"`
+		Balcony        *bool    `json:"balcony"`
+		ConnectingRoom string   `json:"connecting_room"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Rooms) == 0 {
+		return "", fmt.Errorf("rooms is required")
+	}
+	in.ConnectingRoom = strings.TrimSpace(in.ConnectingRoom)
+	if in.ConnectingRoom != "" && len(in.Rooms) != 1 {
+		return "", fmt.Errorf("connecting_room needs exactly one room")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_room_features is only available to managers")
+	}
+
+	var updated []string
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(bg,
+			`UPDATE rooms SET pets_allowed = COALESCE($2, pets_allowed), accessible = COALESCE($3, accessible),
+			        balcony = COALESCE($4, balcony)
+			 WHERE lower(name) IN (SELECT lower(trim(n)) FROM unnest($1::text[]) n)
+			 RETURNING name`, in.Rooms, in.Pets, in.Accessible, in.Balcony)
+		if err != nil {
+			return fmt.Errorf("update rooms: %w", err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			updated = append(updated, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(updated) == 0 || in.ConnectingRoom == "" {
+			return nil
+		}
+		// The link is kept on both rooms; the old partners are released.
+		var roomID int64
+		if err := tx.QueryRow(bg, `SELECT id FROM rooms WHERE lower(name) = lower($1)`, updated[0]).Scan(&roomID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(bg,
+			`UPDATE rooms SET connecting_room_id = NULL WHERE id = $1 OR connecting_room_id = $1`, roomID); err != nil {
+			return fmt.Errorf("unlink: %w", err)
+		}
+		if strings.EqualFold(in.ConnectingRoom, "none") {
+			return nil
+		}
+		var otherID int64
+		err = tx.QueryRow(bg, `SELECT id FROM rooms WHERE lower(name) = lower($1)`, in.ConnectingRoom).Scan(&otherID)
+		if err != nil {
+			return fmt.Errorf("camera %q non trovata", in.ConnectingRoom)
+		}
+		if otherID == roomID {
+			return fmt.Errorf("a room cannot connect to itself")
+		}
+		if _, err := tx.Exec(bg,
+			`UPDATE rooms SET connecting_room_id = NULL WHERE connecting_room_id = $1`, otherID); err != nil {
+			return fmt.Errorf("unlink: %w", err)
+		}
+		if _, err := tx.Exec(bg,
+			`UPDATE rooms SET connecting_room_id = CASE id WHEN $1 THEN $2 ELSE $1 END WHERE id IN ($1, $2)`,
+			roomID, otherID); err != nil {
+			return fmt.Errorf("link: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(updated) == 0 {
+		return fmt.Sprintf("Nessuna camera trovata tra: %s.", strings.Join(in.Rooms, ", ")), nil
+	}
+
+	rows, err := db.Query(bg,
+		`SELECT r.name, r.pets_allowed, r.accessible, r.balcony, COALESCE(c.name, '')
+		 FROM rooms r LEFT JOIN rooms c ON c.id = r.connecting_room_id
+		 WHERE r.name = ANY($1) ORDER BY r.floor, r.name`, updated)
+	if err != nil {
+		return "", fmt.Errorf("query rooms: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	sb.WriteString("✅ Caratteristiche aggiornate:")
+	for rows.Next() {
+		var r roomRef
+		if err := rows.Scan(&r.name, &r.pets, &r.accessible, &r.balcony, &r.connecting); err != nil {
+			return "", err
+		}
+		labels := r.featureLabels()
+		if len(labels) == 0 {
+			labels = []string{"nessuna caratteristica"}
+		}
+		fmt.Fprintf(&sb, "\n• %s: %s", r.name, strings.Join(labels, ", "))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(updated) < len(in.Rooms) {
+		sb.WriteString("\n⚠️ Alcune camere non sono state trovate.")
+	}
+	return sb.String(), nil
+}
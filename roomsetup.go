@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// setup_rooms creates a property's rooms in one go during onboarding: the
+// model turns "piani 1–3, camere 101–110, 201–210, 301–305, suite 401–402"
+// into groups of room ranges, each with its room type, and the rooms are
+// written in one transaction. Rooms that already exist keep their status and
+// reservations; only their type (and floor, when given) change.
+
+// setupRoomsMax bounds one call, against a typo like "101-1100".
+const setupRoomsMax = 500
+
+var roomRangeRe = regexp.MustCompile(`^([A-Za-z]*)(\d+)\s*(?:-|–|—|\.\.)\s*([A-Za-z]*)(\d+)$`)
+
+// expandRoomRanges turns "101-110, 201-205, 12, A1-A4" into room names.
+// Zero padding of the first number is kept ("01-12" → 01 … 12).
+func expandRoomRanges(spec string) ([]string, error) {
+	var out []string
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ';' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		m := roomRangeRe.FindStringSubmatch(part)
+		if m == nil {
+			out = append(out, part)
+			continue
+		}
+		if m[3] != "" && !strings.EqualFold(m[1], m[3]) {
+			return nil, fmt.Errorf("intervallo %q: il prefisso deve essere lo stesso", part)
+		}
+		from, _ := strconv.Atoi(m[2])
+		to, _ := strconv.Atoi(m[4])
+		if to < from {
+			return nil, fmt.Errorf("intervallo %q: il secondo numero è minore del primo", part)
+		}
+		if to-from >= setupRoomsMax {
+			return nil, fmt.Errorf("intervallo %q: troppe camere", part)
+		}
+		width := 0
+		if strings.HasPrefix(m[2], "0") {
+			width = len(m[2])
+		}
+		for n := from; n <= to; n++ {
+			out = append(out, fmt.Sprintf("%s%0*d", m[1], width, n))
+		}
+	}
+	return out, nil
+}
+
+// roomFloor guesses the floor from the room number: 101 → 1, 1205 → 12,
+// A3 or 12 → 1.
+func roomFloor(name string) int {
+	digits := strings.TrimLeft(name, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 100 {
+		return 1
+	}
+	return n / 100
+}
+
+type setupRoomsTool struct{}
+
+func (t *setupRoomsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "setup_rooms",
+		Description: "Crea in blocco le camere della struttura da una descrizione compatta: gruppi di intervalli " +
+			"(\"101-110, 201-210\") con tipologia, capienza, tariffa base e minuti di pulizia. Il piano si ricava dal " +
+			"numero (101 → piano 1) se non indicato. Le camere già esistenti non vengono duplicate: ricevono solo la " +
+			"tipologia (e il piano, se indicato). Con dry_run=true mostra cosa farebbe. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"groups": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"rooms": {"type": "string", "description": "Camere o intervalli separati da virgole, es. '101-110, 201-210' o 'A1-A4'"},
+							"floor": {"type": "integer", "description": "Piano (default dal numero della camera)"},
+							"type": {"type": "string", "description": "Tipologia, es. 'Doppia' o 'Suite' (creata se non esiste)"},
+							"capacity": {"type": "integer", "description": "Persone massime della tipologia"},
+							"base_rate": {"type": "number", "description": "Tariffa base a notte della tipologia, in euro"},
+							"cleaning_minutes": {"type": "integer", "description": "Minuti di pulizia di un checkout per la tipologia"}
+						},
+						"required": ["rooms"]
+					}
+				},
+				"dry_run": {"type": "boolean", "description": "Mostra le camere senza crearle"}
+			},
+			"required": ["groups"]
+		}`),
+	}
+}
+
+func (t *setupRoomsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Groups []struct {
+			Rooms           string   `json:"rooms"`
+			Floor           *int     `json:"floor"`
+			Type            string   `json:"type"`
+			Capacity        *int     `json:"capacity"`
+			BaseRate        *float64 `json:"base_rate"`
+			CleaningMinutes *int     `json:"cleaning_minutes"`
+		} `json:"groups"`
+		DryRun bool `json:"dry_run"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Groups) == 0 {
+		return "", fmt.Errorf("groups is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("setup_rooms is only available to managers")
+	}
+
+	type room struct {
+		name       string
+		floor      int
+		fixedFloor bool
+		group      int
+	}
+	var rooms []room
+	seen := make(map[string]int) // lower(name) → group
+	for g, grp := range in.Groups {
+		names, err := expandRoomRanges(grp.Rooms)
+		if err != nil {
+			return "", err
+		}
+		if len(names) == 0 {
+			return "", fmt.Errorf("gruppo %d: nessuna camera in %q", g+1, grp.Rooms)
+		}
+		for _, n := range names {
+			if prev, dup := seen[strings.ToLower(n)]; dup {
+				return "", fmt.Errorf("la camera %s è sia nel gruppo %d sia nel gruppo %d", n, prev+1, g+1)
+			}
+			seen[strings.ToLower(n)] = g
+			r := room{name: n, floor: roomFloor(n), group: g}
+			if grp.Floor != nil {
+				r.floor, r.fixedFloor = *grp.Floor, true
+			}
+			rooms = append(rooms, r)
+		}
+	}
+	if len(rooms) > setupRoomsMax {
+		return "", fmt.Errorf("%d camere in una volta sono troppe (massimo %d)", len(rooms), setupRoomsMax)
+	}
+
+	// Per floor, for the summary.
+	summary := func(names map[int][]string) string {
+		floors := make([]int, 0, len(names))
+		for f := range names {
+			floors = append(floors, f)
+		}
+		sort.Ints(floors)
+		var sb strings.Builder
+		for _, f := range floors {
+			fmt.Fprintf(&sb, "\n• piano %d: %s", f, strings.Join(names[f], ", "))
+		}
+		return sb.String()
+	}
+
+	if in.DryRun {
+		byFloor := make(map[int][]string)
+		for _, r := range rooms {
+			label := r.name
+			if typ := in.Groups[r.group].Type; typ != "" {
+				label += " (" + typ + ")"
+			}
+			byFloor[r.floor] = append(byFloor[r.floor], label)
+		}
+		return fmt.Sprintf("Anteprima: %d camere, niente è stato creato.", len(rooms)) + summary(byFloor), nil
+	}
+
+	var types []string
+	created := make(map[int][]string)
+	var updated []string
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		typeIDs := make([]*int, len(in.Groups))
+		for g, grp := range in.Groups {
+			if strings.TrimSpace(grp.Type) == "" {
+				continue
+			}
+			rt, err := upsertRoomType(bg, tx, strings.TrimSpace(grp.Type), grp.Capacity, grp.BaseRate, grp.CleaningMinutes)
+			if err != nil {
+				return err
+			}
+			typeIDs[g] = &rt.id
+			types = append(types, rt.String())
+		}
+		for _, r := range rooms {
+			var inserted bool
+			if err := tx.QueryRow(bg,
+				`INSERT INTO rooms (name, floor, room_type_id) VALUES ($1, $2, $3)
+				 ON CONFLICT (hotel_id, name) DO UPDATE SET
+				   floor = CASE WHEN $4 THEN EXCLUDED.floor ELSE rooms.floor END,
+				   room_type_id = COALESCE(EXCLUDED.room_type_id, rooms.room_type_id)
+				 RETURNING xmax = 0`, r.name, r.floor, typeIDs[r.group], r.fixedFloor,
+			).Scan(&inserted); err != nil {
+				return fmt.Errorf("camera %s: %w", r.name, err)
+			}
+			if inserted {
+				created[r.floor] = append(created[r.floor], r.name)
+			} else {
+				updated = append(updated, r.name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	n := 0
+	for _, names := range created {
+		n += len(names)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🏨 %d camere create.", n)
+	sb.WriteString(summary(created))
+	if len(updated) > 0 {
+		fmt.Fprintf(&sb, "\nGià esistenti, aggiornate: %s.", strings.Join(updated, ", "))
+	}
+	for _, t := range types {
+		sb.WriteString("\n✅ " + t + ".")
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Room types (room_types table) group rooms that sell and clean the same
+// way: capacity caps the party a quote offers the room to, base_rate prices
+// nights no rates row covers, and cleaning_minutes sizes the checkout clean
+// for the daily plan and the housekeeping estimate of occupancy_report, until
+// enough timed cleans of a room replace it (AutoAssigner.measured).
+
+// formatMinutes renders a duration in minutes as "2h15" or "40 min".
+func formatMinutes(m int) string {
+	if m < 60 {
+		return fmt.Sprintf("%d min", m)
+	}
+	return fmt.Sprintf("%dh%02d", m/60, m%60)
+}
+
+// roomType is a saved room_types row.
+type roomType struct {
+	id, capacity, cleaning int
+	name                   string
+	baseRate               *float64
+}
+
+func (rt roomType) String() string {
+	s := fmt.Sprintf("Tipologia %s: %d persone, pulizia %s", rt.name, rt.capacity, formatMinutes(rt.cleaning))
+	if rt.baseRate != nil {
+		s += fmt.Sprintf(", tariffa base %.2f€ a notte", *rt.baseRate)
+	}
+	return s
+}
+
+// upsertRoomType creates the room type name, or updates the fields given
+// (nil keeps the current value, or the default for a new type).
+func upsertRoomType(ctx context.Context, db querier, name string, capacity *int, baseRate *float64, cleaning *int) (roomType, error) {
+	var rt roomType
+	err := db.QueryRow(ctx,
+		`INSERT INTO room_types (name, capacity, base_rate, cleaning_minutes)
+		 VALUES ($1, COALESCE($2, 2), $3, COALESCE($4, 45))
+		 ON CONFLICT (hotel_id, name) DO UPDATE SET
+		   capacity = COALESCE($2, room_types.capacity),
+		   base_rate = COALESCE($3, room_types.base_rate),
+		   cleaning_minutes = COALESCE($4, room_types.cleaning_minutes)
+		 RETURNING id, name, capacity, base_rate::float8, cleaning_minutes`,
+		name, capacity, baseRate, cleaning,
+	).Scan(&rt.id, &rt.name, &rt.capacity, &rt.baseRate, &rt.cleaning)
+	if err != nil {
+		return rt, fmt.Errorf("save room type %s: %w", name, err)
+	}
+	return rt, nil
+}
+
+// ── set_room_type ────────────────────────────────────────────────────────────
+
+type setRoomTypeTool struct{}
+
+func (t *setRoomTypeTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_room_type",
+		Description: "Crea o modifica una tipologia di camera (capienza, tariffa base a notte, minuti di pulizia) " +
+			"e le assegna le camere indicate. Con delete=true elimina la tipologia (le camere restano senza tipo). Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string", "description": "Nome della tipologia (es. 'Doppia', 'Suite')"},
+				"capacity": {"type": "integer", "description": "Persone massime (default 2)"},
+				"base_rate": {"type": "number", "description": "Prezzo a notte in euro quando nessuna riga di rates copre la data"},
+				"cleaning_minutes": {"type": "integer", "description": "Minuti per la pulizia di un checkout (default 45)"},
+				"rooms": {"type": "array", "items": {"type": "string"}, "description": "Camere da assegnare a questa tipologia"},
+				"delete": {"type": "boolean", "description": "Elimina la tipologia"}
+			},
+			"required": ["name"]
+		}`),
+	}
+}
+
+func (t *setRoomTypeTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Name            string   `json:"name"`
+		Capacity        *int     `json:"capacity"`
+		BaseRate        *float64 `json:"base_rate"`
+		CleaningMinutes *int     `json:"cleaning_minutes"`
+		Rooms           []string `json:"rooms"`
+		Delete          bool     `json:"delete"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_room_type is only available to managers")
+	}
+
+	if in.Delete {
+		tag, err := db.Exec(bg, `DELETE FROM room_types WHERE lower(name) = lower($1)`, in.Name)
+		if err != nil {
+			return "", fmt.Errorf("delete: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Sprintf("Nessuna tipologia %q.", in.Name), nil
+		}
+		return fmt.Sprintf("🗑 Tipologia %s eliminata; le sue camere restano senza tipo.", in.Name), nil
+	}
+
+	rt, err := upsertRoomType(bg, db, in.Name, in.Capacity, in.BaseRate, in.CleaningMinutes)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("✅ " + rt.String() + ".")
+
+	if len(in.Rooms) > 0 {
+		rows, err := db.Query(bg,
+			`UPDATE rooms SET room_type_id = $1
+			 WHERE lower(name) IN (SELECT lower(trim(n)) FROM unnest($2::text[]) n)
+			 RETURNING name`, rt.id, in.Rooms)
+		if err != nil {
+			return "", fmt.Errorf("assign rooms: %w", err)
+		}
+		var linked []string
+		for rows.Next() {
+			var room string
+			if err := rows.Scan(&room); err != nil {
+				rows.Close()
+				return "", err
+			}
+			linked = append(linked, room)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		var unknown []string
+		for _, r := range in.Rooms {
+			found := false
+			for _, l := range linked {
+				if strings.EqualFold(strings.TrimSpace(r), l) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				unknown = append(unknown, r)
+			}
+		}
+		sort.Strings(linked)
+		if len(linked) > 0 {
+			fmt.Fprintf(&sb, "\nCamere assegnate: %s.", strings.Join(linked, ", "))
+		}
+		if len(unknown) > 0 {
+			fmt.Fprintf(&sb, "\n⚠️ Camere non trovate: %s.", strings.Join(unknown, ", "))
+		}
+	}
+	return sb.String(), nil
+}
+
+// ── occupancy_report ─────────────────────────────────────────────────────────
+
+type occupancyReportTool struct {
+	assigner *AutoAssigner
+}
+
+func (t *occupancyReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "occupancy_report",
+		Description: "Occupazione giorno per giorno (camere e posti letto occupati) con il tempo di pulizia stimato " +
+			"dalle tipologie di camera, più il riepilogo per tipologia e il tasso di occupazione del periodo. " +
+			"Con group_by week/month/room_type dà solo il tasso di occupazione per gruppo, su periodi fino a due anni. " +
+			"Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD (default: oggi)"},
+				"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD (default: from + 6 giorni; con group_by day massimo 62 giorni)"},
+				"group_by": {"type": "string", "enum": ["day", "week", "month", "room_type"], "description": "Raggruppamento (default: day, con dettaglio pulizie)"}
+			}
+		}`),
+	}
+}
+
+// occupancyMaxDays bounds the day-by-day report to about two months of lines.
+const occupancyMaxDays = 62
+
+type occupancyRoom struct {
+	capacity int // 0 when the room has no type
+	cleaning int
+}
+
+func (t *occupancyReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From    string `json:"from"`
+		To      string `json:"to"`
+		GroupBy string `json:"group_by"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.GroupBy == "" {
+		in.GroupBy = "day"
+	}
+	if _, ok := roomNightGroups[in.GroupBy]; !ok {
+		return "", fmt.Errorf("group_by must be day, week, month or room_type")
+	}
+	maxDays := analyticsMaxDays
+	if in.GroupBy == "day" {
+		maxDays = occupancyMaxDays
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	from, to, err := parseReportRange(in.From, in.To, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc),
+		func(from time.Time) time.Time { return from.AddDate(0, 0, 6) }, maxDays)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("occupancy_report is only available to managers")
+	}
+	if in.GroupBy != "day" {
+		groups, err := loadRoomNights(bg, db, from, to, in.GroupBy)
+		if err != nil {
+			return "", err
+		}
+		if len(groups) == 0 {
+			return "Nessuna camera registrata.", nil
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "📊 Occupazione %s → %s\n", from.Format("02/01/2006"), to.Format("02/01/2006"))
+		var total roomNights
+		for _, g := range groups {
+			total.add(g)
+			fmt.Fprintf(&sb, "• %s: %d/%d notti (%.0f%%)\n", roomNightLabel(in.GroupBy, g.group), g.sold, g.available, g.occupancy())
+		}
+		fmt.Fprintf(&sb, "Totale: %d/%d notti vendute, occupazione %.1f%%", total.sold, total.available, total.occupancy())
+		return sb.String(), nil
+	}
+
+	rooms := make(map[int64]occupancyRoom)
+	rows, err := db.Query(bg,
+		`SELECT r.id, COALESCE(t.capacity, 0), COALESCE(t.cleaning_minutes, $1)
+		 FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id`, defaultCleaningMinutes)
+	if err != nil {
+		return "", fmt.Errorf("query rooms: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var r occupancyRoom
+		if err := rows.Scan(&id, &r.capacity, &r.cleaning); err != nil {
+			rows.Close()
+			return "", err
+		}
+		rooms[id] = r
+	}
+	rows.Close()
+	if len(rooms) == 0 {
+		return "Nessuna camera registrata.", nil
+	}
+	beds := 0
+	for _, r := range rooms {
+		beds += r.capacity
+	}
+
+	type stay struct {
+		roomID   int64
+		guests   int
+		ci, co   time.Time
+		cleaning int
+	}
+	var stays []stay
+	rows, err = db.Query(bg,
+		`SELECT room_id, guests, (checkin_at AT TIME ZONE 'Europe/Rome')::date, (checkout_at AT TIME ZONE 'Europe/Rome')::date
+		 FROM reservations
+		 WHERE status = 'confirmed'
+		   AND (checkin_at AT TIME ZONE 'Europe/Rome')::date <= $2
+		   AND (checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1`, from, to)
+	if err != nil {
+		return "", fmt.Errorf("query reservations: %w", err)
+	}
+	for rows.Next() {
+		var s stay
+		if err := rows.Scan(&s.roomID, &s.guests, &s.ci, &s.co); err != nil {
+			rows.Close()
+			return "", err
+		}
+		// Dates come back at UTC midnight: compare them as Rome calendar days.
+		s.ci = time.Date(s.ci.Year(), s.ci.Month(), s.ci.Day(), 0, 0, 0, 0, loc)
+		s.co = time.Date(s.co.Year(), s.co.Month(), s.co.Day(), 0, 0, 0, 0, loc)
+		stays = append(stays, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	measured, err := t.assigner.measured(bg, db)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📊 Occupazione %s → %s (%d camere", from.Format("02/01"), to.Format("02/01"), len(rooms))
+	if beds > 0 {
+		fmt.Fprintf(&sb, ", %d posti letto", beds)
+	}
+	sb.WriteString(")\n")
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		occupied, guests, checkouts, stayovers, minutes := 0, 0, 0, 0, 0
+		for _, s := range stays {
+			r := rooms[s.roomID]
+			if !s.ci.After(d) && s.co.After(d) {
+				occupied++
+				guests += s.guests
+				if s.ci.Before(d) {
+					stayovers++
+					minutes += t.assigner.estimate(measured, s.roomID, "stayover", r.cleaning)
+				}
+			}
+			if s.co.Equal(d) {
+				checkouts++
+				minutes += t.assigner.estimate(measured, s.roomID, "checkout", r.cleaning)
+			}
+		}
+		fmt.Fprintf(&sb, "%s %s: %d/%d camere (%d%%)", italianWeekday(d.Weekday())[:3], d.Format("02/01"),
+			occupied, len(rooms), occupied*100/len(rooms))
+		if beds > 0 {
+			fmt.Fprintf(&sb, ", %d/%d letti", guests, beds)
+		} else {
+			fmt.Fprintf(&sb, ", %d ospiti", guests)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&sb, ", pulizie ~%s (%d partenze, %d fermate)", formatMinutes(minutes), checkouts, stayovers)
+		}
+		sb.WriteString("\n")
+	}
+
+	types, err := loadRoomNights(bg, db, from, to, "room_type")
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString("\nPer tipologia (notti vendute):\n")
+	var total roomNights
+	for _, g := range types {
+		total.add(g)
+		fmt.Fprintf(&sb, "• %s: %d/%d notti (%.0f%%)\n", roomNightLabel("room_type", g.group), g.sold, g.available, g.occupancy())
+	}
+	fmt.Fprintf(&sb, "Totale: %d/%d notti vendute, occupazione %.1f%%", total.sold, total.available, total.occupancy())
+	return sb.String(), nil
+}
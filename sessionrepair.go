@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Session transcripts are written by the SDK session store: one O_APPEND file
+// per user, one write(2) per event. That keeps a single process safe, but not
+// two bots sharing SESSION_DIR (their parentId chains would interleave), and a
+// crash mid-write leaves a truncated last line. So at startup, before the
+// store opens anything:
+//
+//   - lockSessionDir takes an exclusive flock on SESSION_DIR/.lock, held for
+//     the life of the process; a second process refuses to start.
+//   - repairSessions checks every <userID>.jsonl: lines that are not valid
+//     JSON (a truncated tail, garbage) are moved to <userID>.jsonl.corrupt,
+//     and message events whose parentId is not the previous event's id are
+//     relinked to it. The store starts every run with an empty parentId, so
+//     the first event after each restart is relinked on the next startup.
+//   - the same pass runs the log redactor (redact.go) over the messages of
+//     every event, lines set aside included. The store writes its files
+//     itself, so what was recorded since the last startup stays in clear
+//     until the next one.
+//
+// A repaired file is rewritten to a temporary file and renamed over the
+// original, so a crash during repair loses nothing.
+
+// lockSessionDir creates dir if needed and locks it for this process. Close
+// the returned file to release the lock.
+func lockSessionDir(dir string) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create session dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%s is in use by another process", dir)
+		}
+		return nil, fmt.Errorf("lock %s: %w", dir, err)
+	}
+	return f, nil
+}
+
+// sessionRepair counts what repairSessions changed.
+type sessionRepair struct {
+	files, repaired             int
+	corrupt, relinked, redacted int
+}
+
+func (r sessionRepair) String() string {
+	return fmt.Sprintf("%d files checked, %d repaired (%d corrupt lines set aside, %d events relinked, %d events redacted)",
+		r.files, r.repaired, r.corrupt, r.relinked, r.redacted)
+}
+
+// repairSessions checks, repairs and redacts with red every transcript in dir.
+func repairSessions(dir string, red *redactor) (sessionRepair, error) {
+	var total sessionRepair
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return total, err
+	}
+	for _, path := range paths {
+		r, err := repairSessionFile(path, red)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		total.files++
+		if r.corrupt+r.relinked+r.redacted > 0 {
+			total.repaired++
+			total.corrupt += r.corrupt
+			total.relinked += r.relinked
+			total.redacted += r.redacted
+		}
+	}
+	return total, nil
+}
+
+func repairSessionFile(path string, red *redactor) (sessionRepair, error) {
+	var r sessionRepair
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	var kept, bad bytes.Buffer
+	var prevID string
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var ev struct {
+			Type     string `json:"type"`
+			ID       string `json:"id"`
+			ParentID string `json:"parentId"`
+		}
+		// A line without its newline is the tail of an interrupted write.
+		if !bytes.HasSuffix(line, []byte("\n")) || json.Unmarshal(line, &ev) != nil || ev.ID == "" {
+			bad.WriteString(red.String(string(bytes.TrimSuffix(line, []byte("\n")))))
+			bad.WriteByte('\n')
+			r.corrupt++
+			continue
+		}
+		if ev.Type == "message" && prevID != "" && ev.ParentID != prevID {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(line, &fields); err != nil {
+				return r, err
+			}
+			fields["parentId"], _ = json.Marshal(prevID)
+			fixed, err := json.Marshal(fields)
+			if err != nil {
+				return r, err
+			}
+			line = append(fixed, '\n')
+			r.relinked++
+		}
+		if clean, ok := red.event(line); ok {
+			line = clean
+			r.redacted++
+		}
+		kept.Write(line)
+		prevID = ev.ID
+	}
+	if r.corrupt+r.relinked+r.redacted == 0 {
+		return r, nil
+	}
+
+	if r.corrupt > 0 {
+		f, err := os.OpenFile(path+".corrupt", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return r, err
+		}
+		_, err = f.Write(bad.Bytes())
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return r, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		tmp.Close()
+		return r, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return r, err
+	}
+	if err := tmp.Close(); err != nil {
+		return r, err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return r, err
+	}
+	return r, os.Rename(tmp.Name(), path)
+}
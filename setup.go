@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// First-boot setup: until a manager completes it (hotels.setup_completed_at),
+// every manager turn carries setupWizardPrompt, which walks them through name
+// and timezone, rooms and rates, staff invites and digest times with the
+// existing tools. configure_hotel stores what has no other home (hotels and
+// hotel_settings) and reports how far the setup has got, so the wizard can
+// resume where it was left after a restart or a day off.
+
+// setupWizardPrompt returns the system prompt section of the setup wizard for
+// a manager whose property is not set up yet, or "".
+func setupWizardPrompt(ctx context.Context, pool *pgxpool.Pool, userID int64) string {
+	var hotel string
+	err := pool.QueryRow(ctx,
+		`SELECT h.name FROM users u JOIN hotels h ON h.id = u.hotel_id
+		 WHERE u.telegram_id = $1 AND u.role = 'manager' AND h.setup_completed_at IS NULL`, userID,
+	).Scan(&hotel)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(`
+
+## First-time setup
+
+%s has not been set up yet. Before day-to-day work, guide this manager through the setup, one step per message, confirming what was saved after each tool call:
+
+1. Name of the property and its timezone → configure_hotel(name, timezone).
+2. Rooms: floors, numbers and room types with capacity, nightly base rate and cleaning minutes → setup_rooms, with dry_run=true first, then for real once the manager confirms.
+3. Seasonal prices, if any (high season, holidays) → set_rate.
+4. Staff: name and role of each person → generate_invite, one link per person, to forward to them.
+5. Send time of the evening digest to managers and, if the kitchen gets its digest, of the kitchen digest ("off" disables) → configure_hotel.
+6. Recap with configure_hotel() and, once the manager confirms, configure_hotel(complete=true).
+
+Call configure_hotel() first to see which steps are already done and resume from there. The manager may skip a step or stop and continue later; if they ask for something else, help them, then offer to go on with the setup.`, hotel)
+}
+
+// ── configure_hotel ──────────────────────────────────────────────────────────
+
+type configureHotelTool struct{}
+
+func (t *configureHotelTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "configure_hotel",
+		Description: "Configura la struttura: nome, fuso orario e orari dei riepiloghi automatici, salvati nel database " +
+			"(hanno la precedenza sulle variabili d'ambiente). Senza argomenti mostra la configurazione e lo stato del setup " +
+			"iniziale (camere, tipologie, tariffe, personale, inviti). complete=true chiude il setup iniziale. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string", "description": "Nome della struttura"},
+				"timezone": {"type": "string", "description": "Fuso orario IANA, es. 'Europe/Rome' (default per il personale nuovo)"},
+				"evening_digest_time": {"type": "string", "description": "Ora del riepilogo serale ai manager, HH:MM, 'off' lo disattiva, '' torna al default"},
+				"kitchen_digest_time": {"type": "string", "description": "Ora del riepilogo per la cucina (unico per l'installazione: solo dalla struttura principale), HH:MM, 'off' lo disattiva, '' torna al default"},
+				"complete": {"type": "boolean", "description": "Segna il setup iniziale come completato"}
+			}
+		}`),
+	}
+}
+
+func (t *configureHotelTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Name     *string `json:"name"`
+		Timezone *string `json:"timezone"`
+		Complete bool    `json:"complete"`
+	}
+	settings := make(map[string]json.RawMessage)
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+		if err := json.Unmarshal(args, &settings); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("configure_hotel is only available to managers")
+	}
+
+	// Validate everything before writing anything.
+	if in.Name != nil && strings.TrimSpace(*in.Name) == "" {
+		return "", fmt.Errorf("name cannot be empty")
+	}
+	if in.Timezone != nil {
+		if _, err := time.LoadLocation(strings.TrimSpace(*in.Timezone)); err != nil || strings.TrimSpace(*in.Timezone) == "" {
+			return "", fmt.Errorf("fuso orario %q non valido: usa un nome IANA come Europe/Rome", *in.Timezone)
+		}
+	}
+	var hotelID int
+	if err := db.QueryRow(bg, `SELECT current_hotel_id()`).Scan(&hotelID); err != nil {
+		return "", fmt.Errorf("query hotel: %w", err)
+	}
+	values := make(map[string]string)
+	for _, d := range hotelSettingDefs {
+		raw, ok := settings[d.key]
+		if !ok {
+			continue
+		}
+		if d.deployment && hotelID != envInt("HOTEL_ID", 1) {
+			return "", fmt.Errorf("%s vale per tutta l'installazione: lo imposta solo un manager della struttura principale", d.key)
+		}
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return "", fmt.Errorf("%s: %w", d.key, err)
+		}
+		v = strings.ToLower(strings.TrimSpace(v))
+		if _, _, ok := parseClock(v); !ok && v != "" && v != "off" {
+			return "", fmt.Errorf("%s: orario %q non valido, usa HH:MM o 'off'", d.key, v)
+		}
+		values[d.key] = v
+	}
+
+	var changes []string
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		if in.Name != nil {
+			if _, err := tx.Exec(bg, `UPDATE hotels SET name = trim($1) WHERE id = current_hotel_id()`, *in.Name); err != nil {
+				return fmt.Errorf("update name: %w", err)
+			}
+			changes = append(changes, "nome")
+		}
+		if in.Timezone != nil {
+			// Staff still on the property's previous zone follow it.
+			if _, err := tx.Exec(bg,
+				`UPDATE users SET timezone = trim($1)
+				 WHERE timezone = (SELECT timezone FROM hotels WHERE id = current_hotel_id())`, *in.Timezone); err != nil {
+				return fmt.Errorf("update staff timezone: %w", err)
+			}
+			if _, err := tx.Exec(bg, `UPDATE hotels SET timezone = trim($1) WHERE id = current_hotel_id()`, *in.Timezone); err != nil {
+				return fmt.Errorf("update timezone: %w", err)
+			}
+			changes = append(changes, "fuso orario")
+		}
+		for _, d := range hotelSettingDefs {
+			v, ok := values[d.key]
+			if !ok {
+				continue
+			}
+			if v == "" {
+				_, err = tx.Exec(bg, `DELETE FROM hotel_settings WHERE key = $1`, d.key)
+			} else {
+				_, err = tx.Exec(bg,
+					`INSERT INTO hotel_settings (key, value, updated_by) VALUES ($1, $2, $3)
+					 ON CONFLICT (hotel_id, key) DO UPDATE SET value = $2, updated_by = $3, updated_at = now()`,
+					d.key, v, ctx.UserID)
+			}
+			if err != nil {
+				return fmt.Errorf("save %s: %w", d.key, err)
+			}
+			changes = append(changes, d.label)
+		}
+		if in.Complete {
+			if _, err := tx.Exec(bg,
+				`UPDATE hotels SET setup_completed_at = COALESCE(setup_completed_at, now()) WHERE id = current_hotel_id()`); err != nil {
+				return fmt.Errorf("complete setup: %w", err)
+			}
+			changes = append(changes, "setup completato")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	status, err := hotelSetupStatus(bg, db)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) > 0 {
+		status = "✅ Salvato: " + strings.Join(changes, ", ") + ".\n\n" + status
+	}
+	return status, nil
+}
+
+// hotelSetupStatus describes the caller's property: what configure_hotel
+// stores and what the other setup steps have created so far.
+func hotelSetupStatus(ctx context.Context, db querier) (string, error) {
+	var hotelID int
+	var name, tz string
+	var completed *time.Time
+	if err := db.QueryRow(ctx,
+		`SELECT id, name, timezone, setup_completed_at FROM hotels WHERE id = current_hotel_id()`,
+	).Scan(&hotelID, &name, &tz, &completed); err != nil {
+		return "", fmt.Errorf("query hotel: %w", err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🏨 %s — fuso orario %s\n", name, tz)
+	if completed != nil {
+		fmt.Fprintf(&sb, "Setup iniziale completato il %s.\n", completed.In(romeLocation()).Format("02/01/2006"))
+	} else {
+		sb.WriteString("Setup iniziale da completare.\n")
+	}
+
+	rows, err := db.Query(ctx,
+		`SELECT COALESCE(t.name, 'senza tipologia'), count(*)::int,
+		        COALESCE(to_char(t.base_rate, 'FM999990.00') || ' €', 'tariffa base non impostata')
+		 FROM rooms r LEFT JOIN room_types t ON t.id = r.room_type_id
+		 GROUP BY t.name, t.base_rate ORDER BY t.name NULLS LAST`)
+	if err != nil {
+		return "", fmt.Errorf("query rooms: %w", err)
+	}
+	var rooms []string
+	for rows.Next() {
+		var typ, rate string
+		var n int
+		if err := rows.Scan(&typ, &n, &rate); err != nil {
+			rows.Close()
+			return "", err
+		}
+		rooms = append(rooms, fmt.Sprintf("  • %s: %d (%s)", typ, n, rate))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(rooms) == 0 {
+		sb.WriteString("Camere: nessuna (setup_rooms)\n")
+	} else {
+		sb.WriteString("Camere:\n" + strings.Join(rooms, "\n") + "\n")
+	}
+
+	var rates, managers, cleaners, invites int
+	if err := db.QueryRow(ctx,
+		`SELECT (SELECT count(*) FROM rates WHERE valid_to >= current_date)::int,
+		        (SELECT count(*) FROM users WHERE role = 'manager')::int,
+		        (SELECT count(*) FROM users WHERE role = 'cleaner')::int,
+		        (SELECT count(*) FROM invites WHERE used_by IS NULL AND expires_at > now())::int`,
+	).Scan(&rates, &managers, &cleaners, &invites); err != nil {
+		return "", fmt.Errorf("query setup counts: %w", err)
+	}
+	fmt.Fprintf(&sb, "Tariffe stagionali in vigore o future: %d\n", rates)
+	fmt.Fprintf(&sb, "Personale: %d manager, %d cameriere; inviti in attesa: %d\n", managers, cleaners, invites)
+
+	stored := make(map[string]string)
+	rows, err = db.Query(ctx, `SELECT key, value FROM hotel_settings`)
+	if err != nil {
+		return "", fmt.Errorf("query settings: %w", err)
+	}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			rows.Close()
+			return "", err
+		}
+		stored[k] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	for _, d := range hotelSettingDefs {
+		if d.deployment && hotelID != envInt("HOTEL_ID", 1) {
+			fmt.Fprintf(&sb, "%s: deciso dalla struttura principale\n", strings.ToUpper(d.label[:1])+d.label[1:])
+			continue
+		}
+		v, source := stored[d.key], "impostato qui"
+		if v == "" {
+			v, source = envOr(d.env, d.def), "default"
+		}
+		fmt.Fprintf(&sb, "%s: %s (%s)\n", strings.ToUpper(d.label[:1])+d.label[1:], v, source)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ShadowMode replays real conversations against a candidate prompt and/or
+// model. Every sampled inbound message is answered twice: by production, as
+// usual, and — once production has replied — by the candidate in the
+// background, with the same recent history. The candidate's tools cannot
+// change anything: execute_sql runs in a read-only transaction, a few lookup
+// tools run for real, every other tool is stubbed as successful. Both answers
+// are stored in shadow_runs, flagged as diverged when the tools called differ
+// or the replies have little in common, so managers can review the candidate
+// on live traffic before switching to it.
+//
+// The candidate template is used as is (no per-language translation), so
+// compare it with users whose language is English or expect the reply
+// language to differ.
+//
+// Configure via env (both empty disables shadow mode):
+//
+//	SHADOW_MODEL=…                   candidate model (default: LLM_MODEL)
+//	SHADOW_PROMPT_FILE=…             candidate template (default: the production prompt)
+//	SHADOW_SAMPLE_PCT=100            share of inbound messages shadowed
+//	SHADOW_MIN_SIMILARITY_PCT=30     replies sharing fewer words than this diverge
+type ShadowMode struct {
+	enabled       bool
+	adminPool     *pgxpool.Pool
+	registry      *UserRegistry
+	llm           *llm.Client
+	model         string
+	template      string
+	promptHash    string
+	prompt        func(ctx context.Context, userID int64, template string) string
+	samplePct     int
+	minSimilarity int
+	tools         *agent.ToolRegistry
+
+	mu      sync.Mutex
+	turns   map[int64]*shadowTurn   // chatID → turn awaiting production's reply
+	history map[int64][]llm.Message // chatID → recent production exchanges
+}
+
+// shadowTurn is one inbound message and what production did with it.
+type shadowTurn struct {
+	userID, chatID int64
+	text           string
+	reply          string
+	tools          []shadowCall
+}
+
+type shadowCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+const (
+	// shadowHistoryTurns is how many previous exchanges the candidate sees.
+	shadowHistoryTurns = 3
+	shadowMaxSteps     = 8
+	shadowTimeout      = 3 * time.Minute
+)
+
+// shadowLiveTools only read data, so the candidate runs them for real.
+var shadowLiveTools = map[string]bool{
+	"read_schema":        true,
+	"check_availability": true,
+	"find_guest":         true,
+	"list_tickets":       true,
+	"search_found_items": true,
+	"safety_lookup":      true,
+	"occupancy_report":   true,
+}
+
+// newShadowMode reads the SHADOW_* env. prompt renders the system prompt of
+// a user with the given template ("" for the production one).
+func newShadowMode(adminPool *pgxpool.Pool, registry *UserRegistry, provider llm.Provider, model string,
+	prompt func(ctx context.Context, userID int64, template string) string) *ShadowMode {
+	s := &ShadowMode{
+		adminPool:     adminPool,
+		registry:      registry,
+		prompt:        prompt,
+		samplePct:     min(envInt("SHADOW_SAMPLE_PCT", 100), 100),
+		minSimilarity: envInt("SHADOW_MIN_SIMILARITY_PCT", 30),
+		turns:         make(map[int64]*shadowTurn),
+		history:       make(map[int64][]llm.Message),
+	}
+	shadowModel := envOr("SHADOW_MODEL", "")
+	path := envOr("SHADOW_PROMPT_FILE", "")
+	if shadowModel == "" && path == "" {
+		return s
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("shadow: disabled: %v", err)
+			return s
+		}
+		s.template = string(b)
+		s.promptHash = promptHash(s.template)
+	}
+	if shadowModel == "" {
+		shadowModel = model
+	}
+	s.model = shadowModel
+	s.llm = llm.New(provider, llm.Options{Model: shadowModel})
+	s.enabled = true
+	log.Printf("shadow: enabled (model %s, prompt %s, %d%% of messages)", shadowModel, envOr("SHADOW_PROMPT_FILE", "production"), s.samplePct)
+	return s
+}
+
+// Record wraps ts so the tool calls production makes during a shadowed turn
+// are kept for comparison. With shadow mode disabled ts is returned as is.
+func (s *ShadowMode) Record(ts agent.ToolSet) agent.ToolSet {
+	if !s.enabled {
+		return ts
+	}
+	return shadowToolSet{ToolSet: ts, shadow: s}
+}
+
+// Start sets the registry the candidate's tools come from.
+func (s *ShadowMode) Start(tools *agent.ToolRegistry) {
+	s.tools = tools
+}
+
+// Inbound opens a turn for u (messenger observer).
+func (s *ShadowMode) Inbound(_ context.Context, u agent.Update) {
+	if !s.enabled || strings.TrimSpace(u.Text) == "" || strings.HasPrefix(u.Text, "/") {
+		return
+	}
+	if rand.IntN(100) >= s.samplePct {
+		return
+	}
+	s.mu.Lock()
+	s.turns[u.ChatID] = &shadowTurn{userID: u.UserID, chatID: u.ChatID, text: u.Text}
+	s.mu.Unlock()
+}
+
+// Outbound closes the turn of chatID with production's reply and starts the
+// candidate (messenger send observer).
+func (s *ShadowMode) Outbound(chatID int64, text string) {
+	if !s.enabled {
+		return
+	}
+	s.mu.Lock()
+	t := s.turns[chatID]
+	delete(s.turns, chatID)
+	if t == nil {
+		s.mu.Unlock()
+		return
+	}
+	t.reply = text
+	history := append([]llm.Message(nil), s.history[chatID]...)
+	h := append(s.history[chatID],
+		llm.Message{Role: "user", Content: []llm.ContentBlock{{Type: "text", Text: t.text}}},
+		llm.Message{Role: "assistant", Content: []llm.ContentBlock{{Type: "text", Text: text}}})
+	if len(h) > 2*shadowHistoryTurns {
+		h = h[len(h)-2*shadowHistoryTurns:]
+	}
+	s.history[chatID] = h
+	s.mu.Unlock()
+
+	go s.run(t, history)
+}
+
+func (s *ShadowMode) recordTool(chatID int64, name string, args json.RawMessage) {
+	s.mu.Lock()
+	if t := s.turns[chatID]; t != nil {
+		t.tools = append(t.tools, shadowCall{Name: name, Arguments: args})
+	}
+	s.mu.Unlock()
+}
+
+// run answers t with the candidate and stores the comparison.
+func (s *ShadowMode) run(t *shadowTurn, history []llm.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	var calls []shadowCall
+	reply, err := s.answer(ctx, t, history, &calls)
+	similarity := replySimilarity(t.reply, reply)
+	diverged := err == nil && (!sameToolNames(t.tools, calls) || similarity*100 < float64(s.minSimilarity))
+
+	prodTools, _ := json.Marshal(t.tools)
+	shadowTools, _ := json.Marshal(calls)
+	var errText *string
+	if err != nil {
+		msg := err.Error()
+		errText = &msg
+	}
+	if _, dbErr := s.adminPool.Exec(context.Background(),
+		`INSERT INTO shadow_runs (telegram_id, inbound, production_reply, production_tools,
+		   shadow_reply, shadow_tools, similarity, diverged, model, prompt_hash, error)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11)`,
+		t.userID, t.text, t.reply, prodTools, reply, shadowTools, similarity, diverged,
+		s.model, s.promptHash, errText,
+	); dbErr != nil {
+		log.Printf("shadow: store run: %v", dbErr)
+	}
+	switch {
+	case err != nil:
+		log.Printf("shadow: user %d: %v", t.userID, err)
+	case diverged:
+		log.Printf("shadow: user %d diverged (similarity %.2f, tools %v vs %v)",
+			t.userID, similarity, toolNames(t.tools), toolNames(calls))
+	}
+}
+
+// answer runs the candidate agent loop on t, appending its tool calls to calls.
+func (s *ShadowMode) answer(ctx context.Context, t *shadowTurn, history []llm.Message, calls *[]shadowCall) (string, error) {
+	pool, err := s.registry.Pool(ctx, t.userID)
+	if err != nil {
+		return "", fmt.Errorf("pool: %w", err)
+	}
+	toolCtx := agent.ToolContext{UserID: t.userID, ChatID: t.chatID, Timestamp: time.Now().Unix(), Extra: pool}
+	req := llm.Request{
+		System:   s.prompt(ctx, t.userID, s.template),
+		Messages: append(history, llm.Message{Role: "user", Content: []llm.ContentBlock{{Type: "text", Text: t.text}}}),
+		Tools:    s.tools.Definitions(),
+	}
+	for step := 0; step < shadowMaxSteps; step++ {
+		resp, err := s.llm.Chat(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("llm: %w", err)
+		}
+		if resp.Type != "tool_use" {
+			return resp.Text, nil
+		}
+		var uses, results []llm.ContentBlock
+		for i := range resp.ToolCalls {
+			tc := resp.ToolCalls[i]
+			*calls = append(*calls, shadowCall{Name: tc.Name, Arguments: tc.Arguments})
+			result := s.execute(ctx, pool, tc, toolCtx)
+			result.ToolCallID = tc.ID
+			uses = append(uses, llm.ContentBlock{Type: "tool_use", ToolCall: &tc})
+			results = append(results, llm.ContentBlock{Type: "tool_result", ToolResult: result})
+		}
+		req.Messages = append(req.Messages,
+			llm.Message{Role: "assistant", Content: uses},
+			llm.Message{Role: "user", Content: results})
+	}
+	return "", fmt.Errorf("no reply after %d model calls", shadowMaxSteps)
+}
+
+// execute runs a candidate tool call without side effects.
+func (s *ShadowMode) execute(ctx context.Context, pool *pgxpool.Pool, tc llm.ToolCall, toolCtx agent.ToolContext) *llm.ToolResult {
+	switch {
+	case tc.Name == "execute_sql":
+		out, err := readOnlySQL(ctx, pool, tc.Arguments)
+		if err != nil {
+			return &llm.ToolResult{Content: err.Error(), IsError: true}
+		}
+		return &llm.ToolResult{Content: out}
+	case shadowLiveTools[tc.Name]:
+		return s.tools.Execute(tc.Name, tc.Arguments, toolCtx)
+	default:
+		return &llm.ToolResult{Content: fmt.Sprintf("OK (shadow mode: %s not executed, assume it succeeded)", tc.Name)}
+	}
+}
+
+// readOnlySQL runs an execute_sql call in a read-only transaction that is
+// always rolled back. Writes are reported as done without touching anything.
+func readOnlySQL(ctx context.Context, pool *pgxpool.Pool, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+	var out string
+	rows, err := tx.Query(ctx, in.Query)
+	if err == nil {
+		out, err = formatRows(rows)
+		rows.Close()
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "25006" { // read_only_sql_transaction
+		return "OK (shadow mode: write not executed, assume it succeeded)", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	return out, nil
+}
+
+// replySimilarity is the Jaccard index of the words of a and b, in [0, 1].
+func replySimilarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		out := make(map[string]bool)
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			out[w] = true
+		}
+		return out
+	}
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(wa)+len(wb)-common)
+}
+
+func toolNames(calls []shadowCall) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range calls {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			out = append(out, c.Name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sameToolNames(a, b []shadowCall) bool {
+	return strings.Join(toolNames(a), ",") == strings.Join(toolNames(b), ",")
+}
+
+// shadowToolSet records production tool calls for the shadow comparison.
+type shadowToolSet struct {
+	agent.ToolSet
+	shadow *ShadowMode
+}
+
+func (ts shadowToolSet) Tools() []agent.Tool {
+	var out []agent.Tool
+	for _, t := range ts.ToolSet.Tools() {
+		out = append(out, shadowTool{Tool: t, shadow: ts.shadow})
+	}
+	return out
+}
+
+type shadowTool struct {
+	agent.Tool
+	shadow *ShadowMode
+}
+
+func (t shadowTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	t.shadow.recordTool(ctx.ChatID, t.Def().Name, args)
+	return t.Tool.Execute(ctx, args)
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Staff shifts. shifts holds, per property, the hours of the three shifts
+// assignments already know (morning, afternoon, evening); shift_assignments
+// says who works which shift on which day, one row per person and day.
+// Managers plan with set_schedule, everyone reads their week with my_shifts
+// and swaps a day with a colleague with swap_shift.
+//
+// Once a day has a schedule at the property, the auto-assignment engine and
+// the sick-day redistribution only consider the people on shift that day,
+// each in their scheduled shift; days nobody planned keep the old behaviour
+// (every cleaner not absent, in their users.default_shift).
+
+// shiftNames are the values of shifts.name, with their Italian label.
+var shiftNames = map[string]string{
+	"morning":   "mattina",
+	"afternoon": "pomeriggio",
+	"evening":   "sera",
+}
+
+var defaultShifts = []struct{ name, start, end string }{
+	{"morning", "07:00", "13:00"},
+	{"afternoon", "13:00", "19:00"},
+	{"evening", "19:00", "23:00"},
+}
+
+// seedShifts creates the default shift hours of every property. Safe to call
+// on every boot: hours edited by managers are kept.
+func seedShifts(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, s := range defaultShifts {
+		if _, err := pool.Exec(ctx,
+			`INSERT INTO shifts (hotel_id, name, starts_at, ends_at)
+			 SELECT id, $1, $2::time, $3::time FROM hotels
+			 ON CONFLICT (hotel_id, name) DO NOTHING`,
+			s.name, s.start, s.end,
+		); err != nil {
+			return fmt.Errorf("seed shift %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// weekdayCodes are the values of set_schedule's weekdays.
+var weekdayCodes = map[string]time.Weekday{
+	"mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+	"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+}
+
+// findStaff resolves a staff member by (the start of) their name.
+func findStaff(ctx context.Context, db querier, name string) (int64, string, error) {
+	var id int64
+	var full string
+	err := db.QueryRow(ctx,
+		`SELECT telegram_id, name FROM users WHERE name ILIKE $1 || '%' ORDER BY lower(name) = lower($1) DESC, name LIMIT 1`,
+		strings.TrimSpace(name)).Scan(&id, &full)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", fmt.Errorf("nessun membro del personale si chiama %q", name)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("query staff: %w", err)
+	}
+	return id, full, nil
+}
+
+// ── set_schedule ─────────────────────────────────────────────────────────────
+
+type setScheduleTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *setScheduleTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "set_schedule",
+		Description: "Pianifica i turni del personale: chi lavora in quale turno (morning, afternoon, evening) nei giorni indicati, " +
+			"o 'off' per toglierli. Il piano pulizie automatico assegna camere solo a chi è di turno. Le persone coinvolte " +
+			"ricevono i loro nuovi turni. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"entries": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"properties": {
+							"staff": {"type": "string", "description": "Nome della persona"},
+							"from": {"type": "string", "description": "Primo giorno YYYY-MM-DD"},
+							"to": {"type": "string", "description": "Ultimo giorno YYYY-MM-DD (default from)"},
+							"weekdays": {"type": "array", "items": {"type": "string", "enum": ["mon", "tue", "wed", "thu", "fri", "sat", "sun"]}, "description": "Solo questi giorni della settimana (default tutti)"},
+							"shift": {"type": "string", "enum": ["morning", "afternoon", "evening", "off"]}
+						},
+						"required": ["staff", "from", "shift"]
+					}
+				}
+			},
+			"required": ["entries"]
+		}`),
+	}
+}
+
+func (t *setScheduleTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Entries []struct {
+			Staff    string   `json:"staff"`
+			From     string   `json:"from"`
+			To       string   `json:"to"`
+			Weekdays []string `json:"weekdays"`
+			Shift    string   `json:"shift"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if len(in.Entries) == 0 {
+		return "", fmt.Errorf("entries is required")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("set_schedule is only available to managers")
+	}
+
+	type change struct {
+		name  string
+		days  []string
+		shift string
+	}
+	changed := make(map[int64]*change)
+	var order []int64
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		for _, e := range in.Entries {
+			if _, ok := shiftNames[e.Shift]; !ok && e.Shift != "off" {
+				return fmt.Errorf("shift must be morning, afternoon, evening or off")
+			}
+			if e.From == "" {
+				return fmt.Errorf("from is required")
+			}
+			from, to, err := parseReportRange(e.From, e.To, time.Time{},
+				func(from time.Time) time.Time { return from }, 92)
+			if err != nil {
+				return err
+			}
+			only := make(map[time.Weekday]bool)
+			for _, w := range e.Weekdays {
+				d, ok := weekdayCodes[strings.ToLower(w)]
+				if !ok {
+					return fmt.Errorf("unknown weekday %q", w)
+				}
+				only[d] = true
+			}
+			userID, name, err := findStaff(bg, tx, e.Staff)
+			if err != nil {
+				return err
+			}
+			var dates []string
+			for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+				if len(only) == 0 || only[d.Weekday()] {
+					dates = append(dates, d.Format("2006-01-02"))
+				}
+			}
+			if len(dates) == 0 {
+				continue
+			}
+			if e.Shift == "off" {
+				_, err = tx.Exec(bg,
+					`DELETE FROM shift_assignments WHERE user_id = $1 AND date = ANY($2::date[])`, userID, dates)
+			} else {
+				_, err = tx.Exec(bg,
+					`INSERT INTO shift_assignments (user_id, date, shift_id, created_by)
+					 SELECT $1, d, s.id, current_telegram_id()
+					 FROM unnest($2::date[]) d, shifts s
+					 WHERE s.name = $3 AND s.hotel_id = current_hotel_id()
+					 ON CONFLICT (user_id, date) DO UPDATE SET shift_id = EXCLUDED.shift_id, created_by = EXCLUDED.created_by, created_at = now()`,
+					userID, dates, e.Shift)
+			}
+			if err != nil {
+				return fmt.Errorf("schedule %s: %w", name, err)
+			}
+			c := changed[userID]
+			if c == nil {
+				c = &change{name: name}
+				changed[userID] = c
+				order = append(order, userID)
+			}
+			label := "riposo"
+			if e.Shift != "off" {
+				label = shiftNames[e.Shift]
+			}
+			c.days = append(c.days, fmt.Sprintf("%s → %s", dateSpan(dates), label))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(order) == 0 {
+		return "Nessun giorno corrisponde ai criteri: niente da cambiare.", nil
+	}
+
+	tg := newBot(t.botToken)
+	var sb strings.Builder
+	sb.WriteString("🗓 Turni aggiornati:")
+	for _, id := range order {
+		c := changed[id]
+		fmt.Fprintf(&sb, "\n• %s: %s", c.name, strings.Join(c.days, "; "))
+		if id != ctx.UserID {
+			_ = tg.Send(bg, id, "🗓 I tuoi turni sono cambiati: "+strings.Join(c.days, "; ")+
+				". Chiedimi «i miei turni» per vedere la settimana.")
+		}
+	}
+	return sb.String(), nil
+}
+
+// dateSpan describes a sorted list of YYYY-MM-DD dates: "20/10" or
+// "20/10–26/10 (5 giorni)".
+func dateSpan(dates []string) string {
+	first, _ := time.Parse("2006-01-02", dates[0])
+	if len(dates) == 1 {
+		return first.Format("02/01")
+	}
+	last, _ := time.Parse("2006-01-02", dates[len(dates)-1])
+	return fmt.Sprintf("%s–%s (%d giorni)", first.Format("02/01"), last.Format("02/01"), len(dates))
+}
+
+// ── my_shifts ────────────────────────────────────────────────────────────────
+
+type myShiftsTool struct{}
+
+func (t *myShiftsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "my_shifts",
+		Description: "Turni di lavoro di una settimana: i propri, oppure (manager) quelli di una persona o di tutto il personale " +
+			"con staff = 'all'.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"week_of": {"type": "string", "description": "Un giorno della settimana da mostrare, YYYY-MM-DD (default: questa settimana)"},
+				"staff": {"type": "string", "description": "Solo manager: nome della persona, o 'all' per tutti"}
+			}
+		}`),
+	}
+}
+
+func (t *myShiftsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		WeekOf string `json:"week_of"`
+		Staff  string `json:"staff"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	day := time.Now().In(loc)
+	if in.WeekOf != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.WeekOf, loc)
+		if err != nil {
+			return "", fmt.Errorf("week_of must be YYYY-MM-DD: %w", err)
+		}
+		day = d
+	}
+	monday := time.Date(day.Year(), day.Month(), day.Day()-(int(day.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	sunday := monday.AddDate(0, 0, 6)
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	userID := ctx.UserID
+	all := false
+	if staff := strings.TrimSpace(in.Staff); staff != "" {
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("only managers can see other people's shifts")
+		}
+		if strings.EqualFold(staff, "all") {
+			all = true
+		} else if userID, _, err = findStaff(bg, db, staff); err != nil {
+			return "", err
+		}
+	}
+
+	rows, err := db.Query(bg,
+		`SELECT u.name, sa.date, s.name, to_char(s.starts_at, 'HH24:MI'), to_char(s.ends_at, 'HH24:MI')
+		 FROM shift_assignments sa
+		 JOIN shifts s ON s.id = sa.shift_id
+		 JOIN users u ON u.telegram_id = sa.user_id
+		 WHERE sa.date BETWEEN $1 AND $2 AND ($3 OR sa.user_id = $4)
+		 ORDER BY sa.date, s.starts_at, u.name`,
+		monday.Format("2006-01-02"), sunday.Format("2006-01-02"), all, userID)
+	if err != nil {
+		return "", fmt.Errorf("query shifts: %w", err)
+	}
+	defer rows.Close()
+	byDay := make(map[string][]string)
+	for rows.Next() {
+		var name, shift, start, end string
+		var date time.Time
+		if err := rows.Scan(&name, &date, &shift, &start, &end); err != nil {
+			return "", err
+		}
+		line := fmt.Sprintf("%s %s–%s", shiftNames[shift], start, end)
+		if all {
+			line = name + ": " + line
+		}
+		key := date.Format("2006-01-02")
+		byDay[key] = append(byDay[key], line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🗓 Turni dal %s al %s", monday.Format("02/01"), sunday.Format("02/01"))
+	if len(byDay) == 0 {
+		sb.WriteString(": nessun turno pianificato.")
+		return sb.String(), nil
+	}
+	for d := monday; !d.After(sunday); d = d.AddDate(0, 0, 1) {
+		lines := byDay[d.Format("2006-01-02")]
+		fmt.Fprintf(&sb, "\n%s %s: ", italianWeekday(d.Weekday()), d.Format("02/01"))
+		if len(lines) == 0 {
+			sb.WriteString("riposo")
+			continue
+		}
+		sb.WriteString(strings.Join(lines, ", "))
+	}
+	return sb.String(), nil
+}
+
+// ── swap_shift ───────────────────────────────────────────────────────────────
+
+type swapShiftTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *swapShiftTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "swap_shift",
+		Description: "Scambia un turno con un collega: il turno del giorno date passa al collega e il suo turno di their_date " +
+			"(default lo stesso giorno) passa a te; se il collega quel giorno è a riposo, ti sostituisce e basta. " +
+			"Collega e manager vengono avvisati. I manager possono scambiare i turni di chiunque con staff.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"date": {"type": "string", "description": "Giorno del turno da cedere, YYYY-MM-DD"},
+				"with": {"type": "string", "description": "Nome del collega"},
+				"their_date": {"type": "string", "description": "Giorno del turno del collega da prendere (default date)"},
+				"staff": {"type": "string", "description": "Solo manager: di chi è il turno da cedere (default: tuo)"}
+			},
+			"required": ["date", "with"]
+		}`),
+	}
+}
+
+func (t *swapShiftTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Date      string `json:"date"`
+		With      string `json:"with"`
+		TheirDate string `json:"their_date"`
+		Staff     string `json:"staff"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.TheirDate == "" {
+		in.TheirDate = in.Date
+	}
+	loc := romeLocation()
+	date, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+	if err != nil {
+		return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+	}
+	theirDate, err := time.ParseInLocation("2006-01-02", in.TheirDate, loc)
+	if err != nil {
+		return "", fmt.Errorf("their_date must be YYYY-MM-DD: %w", err)
+	}
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if date.Before(today) || theirDate.Before(today) {
+		return "", fmt.Errorf("past shifts cannot be swapped")
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	_ = db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager)
+	ownerID, ownerName := ctx.UserID, ""
+	if strings.TrimSpace(in.Staff) != "" {
+		if !manager {
+			return "", fmt.Errorf("only managers can swap other people's shifts")
+		}
+		if ownerID, ownerName, err = findStaff(bg, db, in.Staff); err != nil {
+			return "", err
+		}
+	} else if err := db.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ownerID).Scan(&ownerName); err != nil {
+		return "", fmt.Errorf("query user: %w", err)
+	}
+	otherID, otherName, err := findStaff(bg, db, in.With)
+	if err != nil {
+		return "", err
+	}
+	if otherID == ownerID {
+		return "", fmt.Errorf("pick a colleague, not the same person")
+	}
+
+	// Staff may not write shift_assignments: the bot moves both rows once the
+	// caller is known to own one side (read through their pool, so RLS applies).
+	var ownShift, theirShift string
+	err = db.QueryRow(bg,
+		`SELECT s.name FROM shift_assignments sa JOIN shifts s ON s.id = sa.shift_id
+		 WHERE sa.user_id = $1 AND sa.date = $2`, ownerID, date.Format("2006-01-02")).Scan(&ownShift)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s non è di turno il %s", ownerName, date.Format("02/01"))
+	}
+	if err != nil {
+		return "", fmt.Errorf("query shift: %w", err)
+	}
+	err = pgx.BeginFunc(bg, t.adminPool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(bg,
+			`SELECT s.name FROM shift_assignments sa JOIN shifts s ON s.id = sa.shift_id
+			 WHERE sa.user_id = $1 AND sa.date = $2 FOR UPDATE OF sa`, otherID, theirDate.Format("2006-01-02")).Scan(&theirShift)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("query colleague's shift: %w", err)
+		}
+		var clash bool
+		if err := tx.QueryRow(bg,
+			`SELECT EXISTS (SELECT 1 FROM shift_assignments WHERE user_id = $1 AND date = $2)`,
+			otherID, date.Format("2006-01-02")).Scan(&clash); err != nil {
+			return err
+		}
+		if clash && !date.Equal(theirDate) {
+			return fmt.Errorf("%s lavora già il %s", otherName, date.Format("02/01"))
+		}
+		if theirShift != "" && !date.Equal(theirDate) {
+			var busy bool
+			if err := tx.QueryRow(bg,
+				`SELECT EXISTS (SELECT 1 FROM shift_assignments WHERE user_id = $1 AND date = $2)`,
+				ownerID, theirDate.Format("2006-01-02")).Scan(&busy); err != nil {
+				return err
+			}
+			if busy {
+				return fmt.Errorf("%s lavora già il %s", ownerName, theirDate.Format("02/01"))
+			}
+		}
+		// On the same day the two rows keep their people and exchange the
+		// shift; otherwise each row moves (the checks above keep (user_id,
+		// date) unique).
+		if theirShift != "" && date.Equal(theirDate) {
+			_, err = tx.Exec(bg,
+				`UPDATE shift_assignments a SET shift_id = b.shift_id
+				 FROM shift_assignments b
+				 WHERE a.date = $2 AND b.date = $2
+				   AND ((a.user_id = $1 AND b.user_id = $3) OR (a.user_id = $3 AND b.user_id = $1))`,
+				ownerID, date.Format("2006-01-02"), otherID)
+		} else {
+			_, err = tx.Exec(bg,
+				`UPDATE shift_assignments
+				 SET user_id = CASE WHEN user_id = $1 THEN $3 ELSE $1 END
+				 WHERE (user_id = $1 AND date = $2) OR (user_id = $3 AND date = $4)`,
+				ownerID, date.Format("2006-01-02"), otherID, theirDate.Format("2006-01-02"))
+		}
+		if err != nil {
+			return fmt.Errorf("swap shifts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	gave := fmt.Sprintf("%s %s (%s)", italianWeekday(date.Weekday()), date.Format("02/01"), shiftNames[ownShift])
+	msg := fmt.Sprintf("🔁 Il turno di %s di %s passa a %s", gave, ownerName, otherName)
+	if theirShift != "" {
+		msg += fmt.Sprintf("; %s passa a %s il turno di %s %s (%s)", otherName, ownerName,
+			italianWeekday(theirDate.Weekday()), theirDate.Format("02/01"), shiftNames[theirShift])
+	}
+	msg += "."
+	var cleans int
+	_ = t.adminPool.QueryRow(bg,
+		`SELECT count(*) FROM assignments WHERE cleaner_id = $1 AND date = $2 AND status = 'pending'`,
+		ownerID, date.Format("2006-01-02")).Scan(&cleans)
+	if cleans > 0 {
+		msg += fmt.Sprintf(" %s ha già %d pulizie assegnate quel giorno: vanno spostate.", ownerName, cleans)
+	}
+
+	tg := newBot(t.botToken)
+	notify := []int64{otherID, ownerID}
+	if hotelID, err := hotelOf(bg, t.adminPool, ownerID); err == nil {
+		if managers, err := managerIDs(bg, t.adminPool, hotelID); err == nil {
+			notify = append(notify, managers...)
+		}
+	}
+	sent := make(map[int64]bool)
+	for _, id := range notify {
+		if id == ctx.UserID || sent[id] {
+			continue
+		}
+		sent[id] = true
+		_ = tg.Send(bg, id, msg)
+	}
+	return msg, nil
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SickDays is the /malattia fast path: a scripted flow, no LLM turn, so a
+// cleaner who wakes up sick is done in one message.
+//
+//	/malattia                  buttons for 1, 2, 3 or 5 days from today
+//	/malattia 17/10 [19/10]    a date range (dd/mm[/yyyy] or YYYY-MM-DD)
+//
+// The absence is recorded in staff_absences (the daily plan then leaves the
+// cleaner out), and their pending assignments in the range are shared among
+// the colleagues who are not absent, least loaded first, preferring one
+// already on the same floor that day. The proposal is stored on the absence
+// and sent to the managers with buttons "sick:ok:<id>" (move the assignments
+// and tell each colleague what they got) and "sick:no:<id>" (the manager
+// reassigns by hand).
+type SickDays struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	assigner  *AutoAssigner
+}
+
+func newSickDays(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string, assigner *AutoAssigner) *SickDays {
+	return &SickDays{adminPool: adminPool, registry: registry, botToken: botToken, assigner: assigner}
+}
+
+// sickMaxDays bounds a single report; longer absences go through the manager.
+const sickMaxDays = 31
+
+// sickMove is one assignment of the proposal; CleanerID 0 means nobody is
+// available that day.
+type sickMove struct {
+	AssignmentID int64  `json:"assignment_id"`
+	Room         string `json:"room"`
+	Date         string `json:"date"`
+	Shift        string `json:"shift"`
+	Type         string `json:"type"`
+	CleanerID    int64  `json:"cleaner_id"`
+	CleanerName  string `json:"cleaner_name"`
+}
+
+func (m sickMove) line() string {
+	d, _ := time.Parse("2006-01-02", m.Date)
+	return fmt.Sprintf("%s %s — camera %s, %s (%s)", italianWeekday(d.Weekday())[:3], d.Format("02/01"),
+		htmlpkg.EscapeString(m.Room), m.Type, m.Shift)
+}
+
+// Register wires /malattia and its buttons.
+func (s *SickDays) Register(m *routedMessenger) {
+	m.Handle("/malattia", s.handleCommand)
+	m.Handle("sick:", s.handleButton)
+}
+
+func (s *SickDays) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := newBot(s.botToken)
+	if !s.registry.IsRegistered(ctx, u.UserID) {
+		return tg.Send(ctx, u.ChatID, "Non risulti registrato: chiedi un invito al manager.")
+	}
+	arg := strings.TrimSpace(strings.TrimPrefix(u.Text, "/malattia"))
+	if arg == "" {
+		var row []telegram.Button
+		for _, n := range []int{1, 2, 3, 5} {
+			label := "Solo oggi"
+			if n > 1 {
+				label = fmt.Sprintf("%d giorni", n)
+			}
+			row = append(row, telegram.Button{Text: label, CallbackData: fmt.Sprintf("sick:d:%d", n)})
+		}
+		_, err := sendKeyboard(ctx, s.botToken, u.ChatID,
+			"🤒 Mi dispiace! Per quanti giorni, a partire da oggi?\nOppure scrivi /malattia 17/10 19/10 per un periodo preciso.",
+			[][]telegram.Button{row})
+		return err
+	}
+	from, to, err := parseSickRange(arg, time.Now().In(romeLocation()))
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("%v. Esempio: /malattia 17/10 19/10", err))
+	}
+	return s.report(ctx, u, from, to)
+}
+
+// parseSickRange reads one or two days; the second defaults to the first.
+func parseSickRange(arg string, now time.Time) (time.Time, time.Time, error) {
+	fields := strings.Fields(arg)
+	if len(fields) > 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("indica al massimo due date")
+	}
+	var days []time.Time
+	for _, f := range fields {
+		d, err := parseSickDay(f, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		days = append(days, d)
+	}
+	from, to := days[0], days[len(days)-1]
+	if to.Before(from) {
+		return from, to, fmt.Errorf("la seconda data è prima della prima")
+	}
+	if to.Sub(from) >= sickMaxDays*24*time.Hour {
+		return from, to, fmt.Errorf("al massimo %d giorni per segnalazione", sickMaxDays)
+	}
+	return from, to, nil
+}
+
+func parseSickDay(s string, now time.Time) (time.Time, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch strings.ToLower(s) {
+	case "oggi":
+		return today, nil
+	case "domani":
+		return today.AddDate(0, 0, 1), nil
+	}
+	for _, layout := range []string{"2006-01-02", "02/01/2006", "2/1/2006"} {
+		if d, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return d, nil
+		}
+	}
+	for _, layout := range []string{"02/01", "2/1"} {
+		if d, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return time.Date(now.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("data %q non valida", s)
+}
+
+func (s *SickDays) handleButton(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed sick callback")
+	}
+	n, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad sick callback: %w", err)
+	}
+	switch parts[1] {
+	case "d":
+		if n < 1 || n > sickMaxDays {
+			return fmt.Errorf("bad sick duration %d", n)
+		}
+		now := time.Now().In(romeLocation())
+		from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return s.report(ctx, u, from, from.AddDate(0, 0, int(n)-1))
+	case "ok", "no":
+		return s.resolve(ctx, u, n, parts[1] == "ok")
+	}
+	return fmt.Errorf("unknown sick action %q", parts[1])
+}
+
+// report records the absence of u's user and sends the proposal to the
+// managers.
+func (s *SickDays) report(ctx context.Context, u agent.Update, from, to time.Time) error {
+	tg := newBot(s.botToken)
+	// Inserted as the user: RLS allows only their own absence.
+	db, err := s.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	var absenceID int64
+	if err := db.QueryRow(ctx,
+		`INSERT INTO staff_absences (user_id, from_date, to_date) VALUES ($1, $2, $3) RETURNING id`,
+		u.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"),
+	).Scan(&absenceID); err != nil {
+		return fmt.Errorf("insert absence: %w", err)
+	}
+	var name string
+	_ = s.adminPool.QueryRow(ctx, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, u.UserID).Scan(&name)
+	if name == "" {
+		name = strconv.FormatInt(u.UserID, 10)
+	}
+
+	moves, proposal, buttons, err := s.proposal(ctx, absenceID, u.UserID, from, to)
+	if err != nil {
+		return err
+	}
+	period := fmt.Sprintf("dal %s al %s", from.Format("02/01"), to.Format("02/01"))
+	if to.Equal(from) {
+		period = "il " + from.Format("02/01")
+		if from.Format("2006-01-02") == time.Now().In(romeLocation()).Format("2006-01-02") {
+			period = "oggi"
+		}
+	}
+	log.Printf("sick days: user %d absent %s → %s, %d assignment(s) to move", u.UserID,
+		from.Format("2006-01-02"), to.Format("2006-01-02"), len(moves))
+
+	hotelID, err := hotelOf(ctx, s.adminPool, u.UserID)
+	if err != nil {
+		return err
+	}
+	managers, err := managerIDs(ctx, s.adminPool, hotelID)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("🤒 <b>%s è in malattia</b> %s.\n", htmlpkg.EscapeString(name), period) + proposal
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, s.botToken, m, text, buttons); err != nil {
+			log.Printf("sick days: notify manager %d: %v", m, err)
+		}
+	}
+
+	reply := fmt.Sprintf("🤒 Ricevuto, assente %s. Guarisci presto!", period)
+	if len(moves) > 0 {
+		reply += fmt.Sprintf(" Ho avvisato il manager: le tue %d assegnazioni verranno ridistribuite.", len(moves))
+	} else {
+		reply += " Ho avvisato il manager."
+	}
+	return tg.Send(ctx, u.ChatID, reply)
+}
+
+// proposal computes the redistribution of userID's pending assignments
+// during absenceID, stores it on the absence and returns it as text for the
+// managers with its buttons (none when there is nothing to move).
+func (s *SickDays) proposal(ctx context.Context, absenceID, userID int64, from, to time.Time) ([]sickMove, string, [][]telegram.Button, error) {
+	moves, err := s.propose(ctx, userID, from, to)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if len(moves) == 0 {
+		return nil, "Nessuna assegnazione in attesa da spostare.", nil, nil
+	}
+	raw, err := json.Marshal(moves)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if _, err := s.adminPool.Exec(ctx, `UPDATE staff_absences SET proposal = $2 WHERE id = $1`, absenceID, raw); err != nil {
+		return nil, "", nil, fmt.Errorf("save proposal: %w", err)
+	}
+	var sb strings.Builder
+	sb.WriteString("\nProposta di ridistribuzione:\n")
+	for _, m := range moves {
+		who := "⚠️ nessun collega disponibile"
+		if m.CleanerID != 0 {
+			who = "→ " + htmlpkg.EscapeString(m.CleanerName)
+		}
+		fmt.Fprintf(&sb, "• %s %s\n", m.line(), who)
+	}
+	id := strconv.FormatInt(absenceID, 10)
+	buttons := [][]telegram.Button{{
+		{Text: "✅ Approva", CallbackData: "sick:ok:" + id},
+		{Text: "✋ Gestisco io", CallbackData: "sick:no:" + id},
+	}}
+	return moves, sb.String(), buttons, nil
+}
+
+// absenceLabel says why someone is away, for colleagues' messages.
+func absenceLabel(reason string) string {
+	if reason == "leave" {
+		return "è in ferie"
+	}
+	return "è in malattia"
+}
+
+// propose shares userID's pending assignments in from..to among the
+// colleagues of the same property who are not absent that day.
+func (s *SickDays) propose(ctx context.Context, userID int64, from, to time.Time) ([]sickMove, error) {
+	measured, err := s.assigner.measured(ctx, s.adminPool)
+	if err != nil {
+		return nil, err
+	}
+	type task struct {
+		move    sickMove
+		floor   int
+		minutes int
+	}
+	rows, err := s.adminPool.Query(ctx,
+		`SELECT a.id, a.room_id, r.name, r.floor, a.date::text, a.shift, a.type, COALESCE(t.cleaning_minutes, $4)
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN room_types t ON t.id = r.room_type_id
+		 WHERE a.cleaner_id = $1 AND a.status = 'pending' AND a.date BETWEEN $2 AND $3
+		 ORDER BY a.date, a.shift, r.floor, r.name`,
+		userID, from.Format("2006-01-02"), to.Format("2006-01-02"), defaultCleaningMinutes)
+	if err != nil {
+		return nil, fmt.Errorf("query assignments: %w", err)
+	}
+	var tasks []task
+	for rows.Next() {
+		var t task
+		var roomID int64
+		var cleaning int
+		if err := rows.Scan(&t.move.AssignmentID, &roomID, &t.move.Room, &t.floor, &t.move.Date,
+			&t.move.Shift, &t.move.Type, &cleaning); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.minutes = s.assigner.estimate(measured, roomID, t.move.Type, cleaning)
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+
+	type colleague struct {
+		id     int64
+		name   string
+		load   map[string]int          // date → minutes
+		floors map[string]map[int]bool // date → floors worked
+		absent map[string]bool
+	}
+	rows, err = s.adminPool.Query(ctx,
+		`SELECT u.telegram_id, COALESCE(u.name, u.telegram_id::text)
+		 FROM users u
+		 WHERE u.role = 'cleaner' AND u.telegram_id <> $1
+		   AND u.hotel_id = (SELECT hotel_id FROM users WHERE telegram_id = $1)
+		 ORDER BY u.telegram_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query colleagues: %w", err)
+	}
+	var colleagues []*colleague
+	byID := make(map[int64]*colleague)
+	for rows.Next() {
+		c := &colleague{load: map[string]int{}, floors: map[string]map[int]bool{}, absent: map[string]bool{}}
+		if err := rows.Scan(&c.id, &c.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		colleagues = append(colleagues, c)
+		byID[c.id] = c
+	}
+	rows.Close()
+
+	ids := make([]int64, 0, len(colleagues))
+	for _, c := range colleagues {
+		ids = append(ids, c.id)
+	}
+	rows, err = s.adminPool.Query(ctx,
+		`SELECT a.cleaner_id, a.date::text, a.room_id, a.type, r.floor, COALESCE(t.cleaning_minutes, $4)
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 LEFT JOIN room_types t ON t.id = r.room_type_id
+		 WHERE a.cleaner_id = ANY($1) AND a.date BETWEEN $2 AND $3 AND a.status <> 'skipped'`,
+		ids, from.Format("2006-01-02"), to.Format("2006-01-02"), defaultCleaningMinutes)
+	if err != nil {
+		return nil, fmt.Errorf("query colleagues' load: %w", err)
+	}
+	for rows.Next() {
+		var id, roomID int64
+		var date, kind string
+		var floor, cleaning int
+		if err := rows.Scan(&id, &date, &roomID, &kind, &floor, &cleaning); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c := byID[id]
+		c.load[date] += s.assigner.estimate(measured, roomID, kind, cleaning)
+		if c.floors[date] == nil {
+			c.floors[date] = map[int]bool{}
+		}
+		c.floors[date][floor] = true
+	}
+	rows.Close()
+	// Off work too: colleagues not on the schedule of a day that has one.
+	rows, err = s.adminPool.Query(ctx,
+		`SELECT ab.user_id, d::date::text
+		 FROM staff_absences ab,
+		      generate_series(GREATEST(ab.from_date, $2::date), LEAST(ab.to_date, $3::date), interval '1 day') d
+		 WHERE ab.user_id = ANY($1) AND ab.status = 'approved' AND ab.from_date <= $3::date AND ab.to_date >= $2::date
+		 UNION
+		 SELECT u.telegram_id, d::date::text
+		 FROM users u, generate_series($2::date, $3::date, interval '1 day') d
+		 WHERE u.telegram_id = ANY($1)
+		   AND EXISTS (SELECT 1 FROM shift_assignments x WHERE x.hotel_id = u.hotel_id AND x.date = d::date)
+		   AND NOT EXISTS (SELECT 1 FROM shift_assignments x WHERE x.user_id = u.telegram_id AND x.date = d::date)`,
+		ids, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("query absences: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var date string
+		if err := rows.Scan(&id, &date); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byID[id].absent[date] = true
+	}
+	rows.Close()
+
+	// Heaviest first within each day so the balance stays tight.
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].move.Date != tasks[j].move.Date {
+			return tasks[i].move.Date < tasks[j].move.Date
+		}
+		return tasks[i].minutes > tasks[j].minutes
+	})
+	moves := make([]sickMove, 0, len(tasks))
+	for _, t := range tasks {
+		date := t.move.Date
+		var pick *colleague
+		for _, c := range colleagues {
+			if c.absent[date] {
+				continue
+			}
+			better := pick == nil || c.load[date] < pick.load[date] ||
+				(c.load[date] == pick.load[date] && c.floors[date][t.floor] && !pick.floors[date][t.floor])
+			if better {
+				pick = c
+			}
+		}
+		if pick != nil {
+			pick.load[date] += t.minutes
+			if pick.floors[date] == nil {
+				pick.floors[date] = map[int]bool{}
+			}
+			pick.floors[date][t.floor] = true
+			t.move.CleanerID, t.move.CleanerName = pick.id, pick.name
+		}
+		moves = append(moves, t.move)
+	}
+	sort.SliceStable(moves, func(i, j int) bool {
+		if moves[i].Date != moves[j].Date {
+			return moves[i].Date < moves[j].Date
+		}
+		return moves[i].Shift < moves[j].Shift
+	})
+	return moves, nil
+}
+
+// resolve applies (approve) or sets aside the proposal of an absence.
+func (s *SickDays) resolve(ctx context.Context, u agent.Update, absenceID int64, approve bool) error {
+	tg := newBot(s.botToken)
+	var role string
+	_ = s.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	var sickID int64
+	var sickName, reason string
+	var raw []byte
+	var resolution *string
+	if err := s.adminPool.QueryRow(ctx,
+		`SELECT ab.user_id, COALESCE(u.name, ab.user_id::text), ab.reason, ab.proposal, ab.resolution
+		 FROM staff_absences ab JOIN users u ON u.telegram_id = ab.user_id
+		 WHERE ab.id = $1`, absenceID,
+	).Scan(&sickID, &sickName, &reason, &raw, &resolution); err != nil {
+		return tg.Send(ctx, u.ChatID, "Assenza non trovata.")
+	}
+	if resolution != nil {
+		return tg.Send(ctx, u.ChatID, "Questa assenza è già stata gestita.")
+	}
+	var moves []sickMove
+	if err := json.Unmarshal(raw, &moves); err != nil {
+		return fmt.Errorf("decode proposal %d: %w", absenceID, err)
+	}
+
+	db, err := s.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	if !approve {
+		if _, err := db.Exec(ctx,
+			`UPDATE staff_absences SET resolution = 'manual', resolved_by = $2, resolved_at = now() WHERE id = $1`,
+			absenceID, u.UserID,
+		); err != nil {
+			return fmt.Errorf("resolve absence: %w", err)
+		}
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf(
+			"Ok, le assegnazioni di %s restano da riassegnare: chiedimelo pure in chat.", sickName))
+	}
+
+	moved := make(map[int64][]sickMove)
+	var order []int64
+	skipped := 0
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		for _, m := range moves {
+			if m.CleanerID == 0 {
+				skipped++
+				continue
+			}
+			// Only if still the absentee's and pending: anything changed
+			// since the proposal is left alone.
+			tag, err := tx.Exec(ctx,
+				`UPDATE assignments SET cleaner_id = $2, updated_at = now()
+				 WHERE id = $1 AND cleaner_id = $3 AND status = 'pending'`,
+				m.AssignmentID, m.CleanerID, sickID)
+			if err != nil {
+				return fmt.Errorf("camera %s: %w", m.Room, err)
+			}
+			if tag.RowsAffected() == 0 {
+				skipped++
+				continue
+			}
+			if _, ok := moved[m.CleanerID]; !ok {
+				order = append(order, m.CleanerID)
+			}
+			moved[m.CleanerID] = append(moved[m.CleanerID], m)
+		}
+		_, err := tx.Exec(ctx,
+			`UPDATE staff_absences SET resolution = 'approved', resolved_by = $2, resolved_at = now() WHERE id = $1`,
+			absenceID, u.UserID)
+		return err
+	})
+	if err != nil {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("❌ Ridistribuzione non riuscita: %v", err))
+	}
+
+	total := 0
+	for _, id := range order {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "🤒 %s %s: ti ho passato queste camere.\n\n", htmlpkg.EscapeString(sickName), absenceLabel(reason))
+		for _, m := range moved[id] {
+			sb.WriteString("• " + m.line() + "\n")
+		}
+		total += len(moved[id])
+		if _, err := sendKeyboard(ctx, s.botToken, id, strings.TrimRight(sb.String(), "\n"), nil); err != nil {
+			log.Printf("sick days: notify %d: %v", id, err)
+		}
+	}
+	reply := fmt.Sprintf("✅ %d assegnazioni di %s ridistribuite, colleghi avvisati.", total, sickName)
+	if skipped > 0 {
+		reply += fmt.Sprintf(" %d non spostate (cambiate nel frattempo o senza colleghi liberi): controllale.", skipped)
+	}
+	return tg.Send(ctx, u.ChatID, reply)
+}
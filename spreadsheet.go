@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sheetRow is one non-empty row of a spreadsheet, with its 1-based row
+// number as the user sees it in Excel or in a text editor.
+type sheetRow struct {
+	n     int
+	cells []string
+}
+
+// readSpreadsheet reads the first sheet of an .xlsx file or a .csv file
+// (comma, semicolon or tab separated, UTF-8 or Windows-1252). Empty rows are
+// dropped. XLSX dates come out as Excel serial numbers; see parseSheetDate.
+func readSpreadsheet(name string, data []byte) ([]sheetRow, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx":
+		return readXLSX(data)
+	case ".csv", ".txt":
+		return readCSV(data)
+	}
+	return nil, fmt.Errorf("formato di %q non supportato: manda un file .xlsx o .csv", name)
+}
+
+func readCSV(data []byte) ([]sheetRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		// Excel on Windows saves CSV in Windows-1252; its letters with
+		// accents are the Latin-1 ones, and 0x80 is the euro sign.
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+			if b == 0x80 {
+				runes[i] = '€'
+			}
+		}
+		data = []byte(string(runes))
+	}
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	sep, best := ',', bytes.Count(first, []byte(","))
+	for _, c := range []rune{';', '\t'} {
+		if n := bytes.Count(first, []byte(string(c))); n > best {
+			sep, best = c, n
+		}
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = sep
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var rows []sheetRow
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV non valido: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		if !emptyRow(rec) {
+			rows = append(rows, sheetRow{n: line, cells: rec})
+		}
+	}
+	return rows, nil
+}
+
+func emptyRow(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// xlsxText is a shared or inline string: plain text, or rich text runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxText) String() string {
+	out := s.T
+	for _, r := range s.Runs {
+		out += r.T
+	}
+	return out
+}
+
+// readXLSX reads the first worksheet of an Office Open XML workbook with
+// the standard library: an .xlsx is a zip of XML parts.
+func readXLSX(data []byte) ([]sheetRow, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("file .xlsx non valido: %w", err)
+	}
+	parts := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	decode := func(name string, v any) error {
+		f, ok := parts[name]
+		if !ok {
+			return fmt.Errorf("file .xlsx non valido: manca %s", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	sheetPath := "xl/worksheets/sheet1.xml"
+	if decode("xl/workbook.xml", &workbook) == nil && decode("xl/_rels/workbook.xml.rels", &rels) == nil && len(workbook.Sheets) > 0 {
+		for _, r := range rels.Rels {
+			if r.ID != workbook.Sheets[0].RelID {
+				continue
+			}
+			if strings.HasPrefix(r.Target, "/") {
+				sheetPath = strings.TrimPrefix(r.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", r.Target)
+			}
+		}
+	}
+
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &shared); err != nil {
+			return nil, fmt.Errorf("file .xlsx non valido: %w", err)
+		}
+	}
+	var sheet struct {
+		Rows []struct {
+			N     int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(sheetPath, &sheet); err != nil {
+		return nil, fmt.Errorf("file .xlsx non valido: %w", err)
+	}
+
+	var rows []sheetRow
+	for i, xr := range sheet.Rows {
+		row := sheetRow{n: xr.N}
+		if row.n == 0 {
+			row.n = i + 1
+		}
+		for j, c := range xr.Cells {
+			col := j
+			if c.Ref != "" {
+				col = xlsxColumn(c.Ref)
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				k, err := strconv.Atoi(c.Value)
+				if err == nil && k >= 0 && k < len(shared.Items) {
+					v = shared.Items[k].String()
+				}
+			case "inlineStr":
+				v = c.Inline.String()
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			default:
+				v = c.Value
+			}
+			for len(row.cells) <= col {
+				row.cells = append(row.cells, "")
+			}
+			row.cells[col] = v
+		}
+		if !emptyRow(row.cells) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// xlsxColumn turns a cell reference ("C7", "AB12") into a 0-based column.
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+	return col - 1
+}
+
+// sheetDateLayouts are the date formats found in Italian and ISO sheets,
+// with a time first so "12/10/2026 15:00" keeps it.
+var sheetDateLayouts = []struct {
+	layout  string
+	hasTime bool
+}{
+	{"2006-01-02 15:04", true}, {"2006-01-02T15:04", true}, {"02/01/2006 15:04", true}, {"2/1/2006 15:04", true},
+	{"2006-01-02", false}, {"02/01/2006", false}, {"2/1/2006", false}, {"02/01/06", false}, {"2/1/06", false},
+	{"02-01-2006", false}, {"02.01.2006", false},
+}
+
+// parseSheetDate reads a date cell, in Europe/Rome. A cell without a time
+// gets hour o'clock. Excel serial numbers (days since 1899-12-30, the
+// fraction is the time of day) are accepted for XLSX date cells.
+func parseSheetDate(s string, hour int) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	loc := romeLocation()
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 20000 && f < 100000 {
+		day := math.Floor(f)
+		t := time.Date(1899, 12, 30, 0, 0, 0, 0, loc).AddDate(0, 0, int(day))
+		if secs := math.Round((f - day) * 86400); secs > 0 {
+			return t.Add(time.Duration(secs) * time.Second), nil
+		}
+		return t.Add(time.Duration(hour) * time.Hour), nil
+	}
+	for _, l := range sheetDateLayouts {
+		t, err := time.ParseInLocation(l.layout, s, loc)
+		if err != nil {
+			continue
+		}
+		if !l.hasTime {
+			t = t.Add(time.Duration(hour) * time.Hour)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("data %q non riconosciuta (usa GG/MM/AAAA o AAAA-MM-GG)", s)
+}
+
+// parseSheetAmount reads a money cell: "350", "350,50", "1.234,50 €",
+// "€ 1,234.50". The last separator followed by one or two digits is the
+// decimal one.
+func parseSheetAmount(s string) (float64, error) {
+	clean := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == ',' || r == '.' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	if i := strings.LastIndexAny(clean, ",."); i >= 0 && len(clean)-i-1 <= 2 {
+		clean = strings.NewReplacer(",", "", ".", "").Replace(clean[:i]) + "." + clean[i+1:]
+	} else {
+		clean = strings.NewReplacer(",", "", ".", "").Replace(clean)
+	}
+	f, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, fmt.Errorf("importo %q non valido", s)
+	}
+	return f, nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventEntityChange is the AgentEvent kind of a change to something a user
+// follows.
+const EventEntityChange agent.EventKind = "entity_change"
+
+// Subscriptions: "avvisami di qualsiasi cosa sulla 204", "seguo la
+// prenotazione 88". A subscriptions row follows a room or a reservation; the
+// notify_subscribers trigger (db/rls.sql) writes every change to it, or to
+// its assignments, tickets, guest requests, payments…, into agent_events for
+// each follower but the one who made it, and NOTIFYs entity_change.
+//
+// The bus only reads agent_events at startup (ReplayUnprocessed), so the
+// dispatcher LISTENs and publishes the rows the trigger wrote, stamping
+// dispatched_at. The changes a follower got in one go (a whole daily plan)
+// become a single event, so one LLM turn tells them about all of it.
+type Subscriptions struct {
+	pool *pgxpool.Pool
+	bus  agent.EventBus
+}
+
+// newSubscriptions must run before the bus replays unprocessed events: the
+// replay publishes the trigger rows left over from the last run, which are
+// stamped dispatched here so the dispatcher does not publish them twice.
+func newSubscriptions(ctx context.Context, pool *pgxpool.Pool) *Subscriptions {
+	if _, err := pool.Exec(ctx,
+		`UPDATE agent_events SET dispatched_at = now()
+		 WHERE kind = $1 AND dispatched_at IS NULL`, string(EventEntityChange),
+	); err != nil {
+		log.Printf("subscriptions: stamp replayed events: %v", err)
+	}
+	return &Subscriptions{pool: pool}
+}
+
+// Tools implements agent.ToolSet.
+func (s *Subscriptions) Tools() []agent.Tool {
+	return []agent.Tool{&subscribeTool{}, &mySubscriptionsTool{}}
+}
+
+// Start launches the dispatcher goroutine.
+func (s *Subscriptions) Start(ctx context.Context, bus agent.EventBus) {
+	s.bus = bus
+	startListener(ctx, s.pool, "entity_change", s.drain)
+}
+
+func (s *Subscriptions) drain(ctx context.Context) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, event_id::text, target_user_id, content
+		 FROM agent_events
+		 WHERE kind = $1 AND dispatched_at IS NULL AND processed_at IS NULL
+		 ORDER BY id`, string(EventEntityChange))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("subscriptions query: %v", err)
+		}
+		return
+	}
+	type change struct {
+		id      int64
+		eventID string
+		content string
+	}
+	byUser := make(map[int64][]change)
+	var order []int64
+	for rows.Next() {
+		var c change
+		var target int64
+		if err := rows.Scan(&c.id, &c.eventID, &target, &c.content); err != nil {
+			log.Printf("subscriptions scan: %v", err)
+			continue
+		}
+		if _, ok := byUser[target]; !ok {
+			order = append(order, target)
+		}
+		byUser[target] = append(byUser[target], c)
+	}
+	rows.Close()
+
+	for _, target := range order {
+		changes := byUser[target]
+		var sb strings.Builder
+		sb.WriteString("🔔 Novità su quello che segui (modifiche fatte da altri):\n")
+		ids := make([]int64, len(changes))
+		for i, c := range changes {
+			fmt.Fprintf(&sb, "• %s\n", c.content)
+			ids[i] = c.id
+		}
+		sb.WriteString("Riferiscile all'utente in poche righe, in parole semplici. Non rispondere OK.")
+		content := sb.String()
+
+		// The first row carries the whole batch (so a restart replays it),
+		// the others are done.
+		first := changes[0]
+		if err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx,
+				`UPDATE agent_events SET content = $2, dispatched_at = now() WHERE id = $1`, first.id, content); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx,
+				`UPDATE agent_events SET dispatched_at = now(), processed_at = now()
+				 WHERE id = ANY ($1) AND id <> $2`, ids, first.id)
+			return err
+		}); err != nil {
+			log.Printf("subscriptions mark dispatched (user %d): %v", target, err)
+			continue
+		}
+		s.bus.Publish(agent.AgentEvent{
+			Kind:     EventEntityChange,
+			TargetID: target,
+			ChatID:   target,
+			Content:  content,
+			Source:   "subscriptions",
+			EventID:  first.eventID,
+		})
+	}
+}
+
+// ── subscribe ────────────────────────────────────────────────────────────────
+
+type subscribeTool struct{}
+
+func (t *subscribeTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "subscribe",
+		Description: "Segue una camera o una prenotazione: l'utente viene avvisato di ogni modifica fatta da altri " +
+			"(stato, prenotazioni, assegnazioni, ticket, richieste dell'ospite, extra, pagamenti). " +
+			"off=true smette di seguirla.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room": {"type": "string", "description": "Nome della camera, es. '204'"},
+				"reservation_id": {"type": "integer"},
+				"off": {"type": "boolean", "description": "Smette di seguire"}
+			}
+		}`),
+	}
+}
+
+func (t *subscribeTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Room          string `json:"room"`
+		ReservationID *int64 `json:"reservation_id"`
+		Off           bool   `json:"off"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if (in.Room == "") == (in.ReservationID == nil) {
+		return "", fmt.Errorf("pass either room or reservation_id")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var roomID *int64
+	var label string
+	if in.Room != "" {
+		var id int64
+		err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower(trim($1))`, in.Room).Scan(&id, &label)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("room %q not found", in.Room)
+		}
+		if err != nil {
+			return "", err
+		}
+		roomID = &id
+		label = "la camera " + label
+	} else {
+		var guest, room string
+		err := db.QueryRow(bg,
+			`SELECT COALESCE(res.guest_name, '?'), r.name FROM reservations res JOIN rooms r ON r.id = res.room_id
+			 WHERE res.id = $1`, *in.ReservationID).Scan(&guest, &room)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("reservation %d not found", *in.ReservationID)
+		}
+		if err != nil {
+			return "", err
+		}
+		label = fmt.Sprintf("la prenotazione #%d (%s, camera %s)", *in.ReservationID, guest, room)
+	}
+
+	if in.Off {
+		tag, err := db.Exec(bg,
+			`DELETE FROM subscriptions
+			 WHERE user_id = $1 AND room_id IS NOT DISTINCT FROM $2 AND reservation_id IS NOT DISTINCT FROM $3`,
+			ctx.UserID, roomID, in.ReservationID)
+		if err != nil {
+			return "", fmt.Errorf("delete subscription: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Sprintf("Non stavi seguendo %s.", label), nil
+		}
+		return fmt.Sprintf("🔕 Non segui più %s.", label), nil
+	}
+
+	tag, err := db.Exec(bg,
+		`INSERT INTO subscriptions (user_id, room_id, reservation_id)
+		 SELECT $1, $2, $3
+		 WHERE NOT EXISTS (SELECT 1 FROM subscriptions
+		                   WHERE user_id = $1 AND room_id IS NOT DISTINCT FROM $2 AND reservation_id IS NOT DISTINCT FROM $3)`,
+		ctx.UserID, roomID, in.ReservationID)
+	if err != nil {
+		return "", fmt.Errorf("insert subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Sprintf("Segui già %s.", label), nil
+	}
+	return fmt.Sprintf("🔔 Ora segui %s: ti avviso quando qualcun altro la modifica.", label), nil
+}
+
+// ── my_subscriptions ─────────────────────────────────────────────────────────
+
+type mySubscriptionsTool struct{}
+
+func (t *mySubscriptionsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "my_subscriptions",
+		Description: "Le camere e le prenotazioni che l'utente segue (subscribe).",
+		Parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+	}
+}
+
+func (t *mySubscriptionsTool) Execute(ctx agent.ToolContext, _ json.RawMessage) (string, error) {
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT CASE WHEN s.room_id IS NOT NULL THEN 'camera ' || r.name
+		             ELSE format('prenotazione #%s (%s, camera %s, %s → %s)', res.id, COALESCE(res.guest_name, '?'), rr.name,
+		                         to_char(res.checkin_at AT TIME ZONE 'Europe/Rome', 'DD/MM'),
+		                         to_char(res.checkout_at AT TIME ZONE 'Europe/Rome', 'DD/MM')) END
+		 FROM subscriptions s
+		 LEFT JOIN rooms r ON r.id = s.room_id
+		 LEFT JOIN reservations res ON res.id = s.reservation_id
+		 LEFT JOIN rooms rr ON rr.id = res.room_id
+		 WHERE s.user_id = $1
+		 ORDER BY s.room_id IS NULL, r.name, res.checkin_at`, ctx.UserID)
+	if err != nil {
+		return "", fmt.Errorf("query subscriptions: %w", err)
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, "• "+line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "Non segui nessuna camera o prenotazione.", nil
+	}
+	return "🔔 Segui:\n" + strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Cleaning supplies inventory. Every change of stock is a supply_movements
+// row and the apply_supply_movement trigger keeps supplies.quantity in step,
+// so the ledger is the history and cleaners never update supplies directly.
+// RLS lets cleaners log their own usage only; restocks, counts and thresholds
+// are for managers. Supplies at or under their threshold show up in the
+// heartbeat (saved query low_stock) and in low_stock_report.
+
+type supply struct {
+	id                   int64
+	name, category, unit string
+	quantity             float64
+	threshold            *float64
+}
+
+// findSupply resolves a supply by name: an exact (case-insensitive) match
+// wins, else a single partial match. pgx.ErrNoRows when nothing matches.
+func findSupply(ctx context.Context, db querier, name string) (supply, error) {
+	name = strings.TrimSpace(name)
+	rows, err := db.Query(ctx,
+		`SELECT id, name, category, unit, quantity::float8, threshold::float8 FROM supplies
+		 WHERE name ILIKE '%' || $1 || '%'
+		 ORDER BY lower(name) = lower($1) DESC, name`, name)
+	if err != nil {
+		return supply{}, fmt.Errorf("query supplies: %w", err)
+	}
+	var found []supply
+	for rows.Next() {
+		var s supply
+		if err := rows.Scan(&s.id, &s.name, &s.category, &s.unit, &s.quantity, &s.threshold); err != nil {
+			rows.Close()
+			return supply{}, err
+		}
+		found = append(found, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return supply{}, err
+	}
+	switch {
+	case len(found) == 0:
+		return supply{}, pgx.ErrNoRows
+	case len(found) == 1 || strings.EqualFold(found[0].name, name):
+		return found[0], nil
+	}
+	names := make([]string, len(found))
+	for i, s := range found {
+		names[i] = s.name
+	}
+	return supply{}, fmt.Errorf("%q è ambiguo: %s", name, strings.Join(names, ", "))
+}
+
+// formatQuantity renders a quantity without trailing zeros.
+func formatQuantity(q float64, unit string) string {
+	return strconv.FormatFloat(q, 'f', -1, 64) + " " + unit
+}
+
+// stockLine is "Detersivo bagno: 3 l (soglia 5 l)".
+func (s supply) stockLine() string {
+	line := s.name + ": " + formatQuantity(s.quantity, s.unit)
+	if s.threshold != nil {
+		line += " (soglia " + formatQuantity(*s.threshold, s.unit) + ")"
+	}
+	return line
+}
+
+func (s supply) low() bool {
+	return s.threshold != nil && s.quantity <= *s.threshold
+}
+
+// ── log_usage ────────────────────────────────────────────────────────────────
+
+type logUsageTool struct{}
+
+func (t *logUsageTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_usage",
+		Description: "Registra il consumo di un materiale di pulizia o di biancheria (es. '2 flaconi di sgrassatore', " +
+			"'6 set asciugamani'). Scala la scorta e dice se è sotto la soglia.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"supply": {"type": "string", "description": "Nome del materiale (anche parziale)"},
+				"quantity": {"type": "number", "description": "Quantità usata, nell'unità del materiale"},
+				"assignment_id": {"type": "integer", "description": "Assegnazione per cui è stato usato (opzionale)"},
+				"note": {"type": "string"}
+			},
+			"required": ["supply", "quantity"]
+		}`),
+	}
+}
+
+func (t *logUsageTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Supply       string  `json:"supply"`
+		Quantity     float64 `json:"quantity"`
+		AssignmentID *int64  `json:"assignment_id"`
+		Note         string  `json:"note"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.Quantity <= 0 {
+		return "", fmt.Errorf("quantity must be positive")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	s, err := findSupply(bg, db, in.Supply)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("materiale %q non censito: chiedi al manager di aggiungerlo con restock", in.Supply)
+	}
+	if err != nil {
+		return "", err
+	}
+	if in.Quantity > s.quantity {
+		return "", fmt.Errorf("in magazzino risultano solo %s di %s: avvisa il manager per un conteggio",
+			formatQuantity(s.quantity, s.unit), s.name)
+	}
+	if _, err := db.Exec(bg,
+		`INSERT INTO supply_movements (supply_id, delta, kind, user_id, assignment_id, note)
+		 VALUES ($1, $2, 'usage', $3, $4, NULLIF($5, ''))`,
+		s.id, -in.Quantity, ctx.UserID, in.AssignmentID, in.Note,
+	); err != nil {
+		return "", fmt.Errorf("log usage: %w", err)
+	}
+	s.quantity -= in.Quantity
+	msg := fmt.Sprintf("🧴 Registrato: %s di %s. Restano %s.",
+		formatQuantity(in.Quantity, s.unit), s.name, formatQuantity(s.quantity, s.unit))
+	if s.low() {
+		msg += " ⚠️ Sotto la soglia: il manager lo vedrà nel prossimo controllo."
+	}
+	return msg, nil
+}
+
+// ── restock ──────────────────────────────────────────────────────────────────
+
+type restockTool struct{}
+
+func (t *restockTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "restock",
+		Description: "Carica in magazzino un materiale (consegna o acquisto), oppure registra un conteggio di inventario " +
+			"con counted. Crea il materiale se non esiste (serve category) e imposta la soglia di scorta minima. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"supply": {"type": "string", "description": "Nome del materiale"},
+				"quantity": {"type": "number", "description": "Quantità arrivata, da aggiungere alla scorta"},
+				"counted": {"type": "number", "description": "Quantità contata in magazzino (inventario), al posto di quantity"},
+				"category": {"type": "string", "enum": ["detergent", "linen", "amenity", "other"], "description": "Solo per un materiale nuovo"},
+				"unit": {"type": "string", "description": "Unità di misura per un materiale nuovo (es. 'l', 'flaconi', 'set'; default 'pz')"},
+				"threshold": {"type": "number", "description": "Scorta minima sotto la quale avvisare"},
+				"note": {"type": "string"}
+			},
+			"required": ["supply"]
+		}`),
+	}
+}
+
+func (t *restockTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Supply    string   `json:"supply"`
+		Quantity  float64  `json:"quantity"`
+		Counted   *float64 `json:"counted"`
+		Category  string   `json:"category"`
+		Unit      string   `json:"unit"`
+		Threshold *float64 `json:"threshold"`
+		Note      string   `json:"note"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Supply) == "" {
+		return "", fmt.Errorf("supply is required")
+	}
+	if in.Quantity < 0 || (in.Counted != nil && *in.Counted < 0) || (in.Threshold != nil && *in.Threshold < 0) {
+		return "", fmt.Errorf("quantities cannot be negative")
+	}
+	if in.Quantity > 0 && in.Counted != nil {
+		return "", fmt.Errorf("give quantity or counted, not both")
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("restock is only available to managers")
+	}
+
+	var s supply
+	created := false
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		var err error
+		s, err = findSupply(bg, tx, in.Supply)
+		if errors.Is(err, pgx.ErrNoRows) {
+			if in.Category == "" {
+				return fmt.Errorf("materiale %q nuovo: indica category (detergent, linen, amenity, other)", in.Supply)
+			}
+			unit := strings.TrimSpace(in.Unit)
+			if unit == "" {
+				unit = "pz"
+			}
+			s = supply{name: strings.TrimSpace(in.Supply), category: in.Category, unit: unit}
+			created = true
+			err = tx.QueryRow(bg,
+				`INSERT INTO supplies (name, category, unit) VALUES ($1, $2, $3) RETURNING id`,
+				s.name, s.category, s.unit,
+			).Scan(&s.id)
+		}
+		if err != nil {
+			return err
+		}
+		if in.Threshold != nil {
+			if _, err := tx.Exec(bg, `UPDATE supplies SET threshold = $2, updated_at = now() WHERE id = $1`,
+				s.id, *in.Threshold); err != nil {
+				return fmt.Errorf("set threshold: %w", err)
+			}
+			s.threshold = in.Threshold
+		}
+		delta, kind := in.Quantity, "restock"
+		if in.Counted != nil {
+			delta, kind = *in.Counted-s.quantity, "adjustment"
+		}
+		if delta == 0 {
+			return nil
+		}
+		if _, err := tx.Exec(bg,
+			`INSERT INTO supply_movements (supply_id, delta, kind, user_id, note)
+			 VALUES ($1, $2, $3, $4, NULLIF($5, ''))`,
+			s.id, delta, kind, ctx.UserID, in.Note,
+		); err != nil {
+			return fmt.Errorf("insert movement: %w", err)
+		}
+		s.quantity += delta
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if created {
+		fmt.Fprintf(&sb, "📦 Nuovo materiale %s (%s).\n", s.name, s.category)
+	}
+	switch {
+	case in.Counted != nil:
+		sb.WriteString("📦 Inventario aggiornato — ")
+	case in.Quantity > 0:
+		fmt.Fprintf(&sb, "📦 Caricati %s — ", formatQuantity(in.Quantity, s.unit))
+	default:
+		sb.WriteString("📦 ")
+	}
+	sb.WriteString(s.stockLine())
+	if s.low() {
+		sb.WriteString(" ⚠️ ancora sotto la soglia")
+	}
+	return sb.String(), nil
+}
+
+// ── low_stock_report ─────────────────────────────────────────────────────────
+
+type lowStockReportTool struct{}
+
+func (t *lowStockReportTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "low_stock_report",
+		Description: "Materiali di pulizia e biancheria sotto la scorta minima, con il consumo degli ultimi 7 giorni " +
+			"e per quanti giorni bastano. Con all=true elenca tutte le scorte.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"category": {"type": "string", "enum": ["detergent", "linen", "amenity", "other"]},
+				"all": {"type": "boolean", "description": "Elenca tutte le scorte, non solo quelle basse (default false)"}
+			}
+		}`),
+	}
+}
+
+func (t *lowStockReportTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Category string `json:"category"`
+		All      bool   `json:"all"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT s.name, s.category, s.unit, s.quantity::float8, s.threshold::float8,
+		        COALESCE(-sum(m.delta) FILTER (WHERE m.kind = 'usage' AND m.created_at > now() - interval '7 days'), 0)::float8
+		 FROM supplies s LEFT JOIN supply_movements m ON m.supply_id = s.id
+		 WHERE ($1::text = '' OR s.category = $1)
+		   AND ($2 OR s.quantity <= s.threshold)
+		 GROUP BY s.id
+		 ORDER BY s.category, s.quantity / NULLIF(s.threshold, 0) NULLS LAST, s.name`,
+		in.Category, in.All)
+	if err != nil {
+		return "", fmt.Errorf("query supplies: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	n := 0
+	for rows.Next() {
+		var s supply
+		var used float64
+		if err := rows.Scan(&s.name, &s.category, &s.unit, &s.quantity, &s.threshold, &used); err != nil {
+			return "", err
+		}
+		mark := "•"
+		if s.low() {
+			mark = "⚠️"
+		}
+		fmt.Fprintf(&sb, "%s [%s] %s", mark, s.category, s.stockLine())
+		if used > 0 {
+			fmt.Fprintf(&sb, " — usati %s in 7 giorni, bastano per ~%.0f giorni",
+				formatQuantity(used, s.unit), s.quantity/(used/7))
+		}
+		sb.WriteString("\n")
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		if in.All {
+			return "Nessun materiale censito: aggiungili con restock.", nil
+		}
+		return "✅ Nessun materiale sotto la scorta minima.", nil
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// start_task and finish_task move the caller's own assignment to in_progress
+// and done. The assignments_timestamps trigger stamps started_at and
+// completed_at on those transitions — also when the status is changed with
+// execute_sql — so every cleaned room yields a measured duration for
+// cleaner_stats and for the daily plan estimates (AutoAssigner.measured).
+//
+// The assignment is given by id or by room name (today's assignment of that
+// room); rooms then follow through the lifecycle producer.
+
+// findOwnTask resolves the caller's assignment in one of statuses, by id or
+// by room name for today.
+func findOwnTask(ctx context.Context, db querier, id int64, room string, statuses ...string) (int64, string, string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT a.id, r.name, a.type
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 WHERE a.cleaner_id = current_telegram_id() AND a.status = ANY($3)
+		   AND (a.id = $1 OR ($1 = 0 AND lower(r.name) = lower($2)
+		                      AND a.date = (now() AT TIME ZONE 'Europe/Rome')::date))
+		 ORDER BY a.shift`, id, room, statuses)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("query assignment: %w", err)
+	}
+	defer rows.Close()
+	var found []int64
+	var name, kind string
+	for rows.Next() {
+		var taskID int64
+		if err := rows.Scan(&taskID, &name, &kind); err != nil {
+			return 0, "", "", err
+		}
+		found = append(found, taskID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", "", err
+	}
+	switch {
+	case len(found) == 0 && id != 0:
+		return 0, "", "", fmt.Errorf("assegnazione %d non trovata tra le tue (%s)", id, strings.Join(statuses, "/"))
+	case len(found) == 0:
+		return 0, "", "", fmt.Errorf("nessuna tua assegnazione di oggi per la camera %s (%s)", room, strings.Join(statuses, "/"))
+	case len(found) > 1:
+		return 0, "", "", fmt.Errorf("più assegnazioni per la camera %s oggi: indica assignment_id", room)
+	}
+	return found[0], name, kind, nil
+}
+
+type taskArgs struct {
+	AssignmentID int64  `json:"assignment_id"`
+	Room         string `json:"room"`
+	Notes        string `json:"notes"`
+}
+
+func (a *taskArgs) parse(args json.RawMessage) error {
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, a); err != nil {
+			return err
+		}
+	}
+	if a.AssignmentID == 0 && strings.TrimSpace(a.Room) == "" {
+		return fmt.Errorf("assignment_id or room is required")
+	}
+	return nil
+}
+
+// ── start_task ───────────────────────────────────────────────────────────────
+
+type startTaskTool struct{}
+
+func (t *startTaskTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "start_task",
+		Description: "Inizia una propria assegnazione (in attesa → in corso) e registra l'ora di inizio.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"assignment_id": {"type": "integer", "description": "Assegnazione da iniziare"},
+				"room": {"type": "string", "description": "In alternativa: nome della camera (assegnazione di oggi)"}
+			}
+		}`),
+	}
+}
+
+func (t *startTaskTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in taskArgs
+	if err := in.parse(args); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	id, room, kind, err := findOwnTask(bg, db, in.AssignmentID, in.Room, "pending")
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Exec(bg,
+		`UPDATE assignments SET status = 'in_progress', updated_at = now() WHERE id = $1`, id,
+	); err != nil {
+		return "", fmt.Errorf("start assignment: %w", err)
+	}
+	return fmt.Sprintf("Camera %s (%s, assegnazione %d) iniziata.", room, kind, id), nil
+}
+
+// ── finish_task ──────────────────────────────────────────────────────────────
+
+type finishTaskTool struct{}
+
+func (t *finishTaskTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "finish_task",
+		Description: "Chiude una propria assegnazione (→ fatta), registra l'ora di fine e la durata, " +
+			"con note facoltative (danni, oggetti mancanti).",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"assignment_id": {"type": "integer", "description": "Assegnazione da chiudere"},
+				"room": {"type": "string", "description": "In alternativa: nome della camera (assegnazione di oggi)"},
+				"notes": {"type": "string", "description": "Note da aggiungere all'assegnazione"}
+			}
+		}`),
+	}
+}
+
+func (t *finishTaskTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in taskArgs
+	if err := in.parse(args); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	// A task finished without start_task is closed too, just without a duration.
+	id, room, kind, err := findOwnTask(bg, db, in.AssignmentID, in.Room, "in_progress", "pending")
+	if err != nil {
+		return "", err
+	}
+	var minutes *float64
+	if err := db.QueryRow(bg,
+		`UPDATE assignments SET status = 'done', updated_at = now(),
+		        notes = CASE WHEN $2 = '' THEN notes
+		                     ELSE concat_ws(E'\n', NULLIF(notes, ''), $2) END
+		 WHERE id = $1
+		 RETURNING extract(epoch FROM completed_at - started_at)::float8 / 60`, id, strings.TrimSpace(in.Notes),
+	).Scan(&minutes); err != nil {
+		return "", fmt.Errorf("finish assignment: %w", err)
+	}
+	msg := fmt.Sprintf("Camera %s (%s, assegnazione %d) fatta", room, kind, id)
+	if minutes != nil {
+		msg += fmt.Sprintf(" in %s", formatMinutes(int(*minutes+0.5)))
+	}
+	return msg + ".", nil
+}
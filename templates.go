@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Content templates are the "user message" bodies of background events
+// (heartbeat, digests). Unlike system prompts (Go text/template, prompt.go)
+// they use flat {{name}} placeholders so managers can edit them by hand:
+//
+//	{{date}}, {{time}}, {{hotel_name}}  built-ins
+//	{{<saved query name>}}              result of saved_queries.<name>, as a text table
+//
+// Each property has its own templates and saved queries (hotel_id); the
+// defaults are seeded for every one of them.
+//
+// Resolving data before the LLM turn means the model starts with the facts in
+// hand instead of spending tool calls (and tokens) rediscovering them.
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)\s*\}\}`)
+
+// renderContentTemplate resolves every placeholder in tmpl with the saved
+// queries of property hotelID. They run on db — pass the target user's pool
+// so RLS applies to what they reveal. Unknown placeholders and failing
+// queries render as a short marker rather than aborting the whole event.
+func renderContentTemplate(ctx context.Context, adminPool, db *pgxpool.Pool, hotelID int, tmpl, hotelName string) string {
+	loc, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	builtins := map[string]string{
+		"date":       now.Format("2006-01-02"),
+		"time":       now.Format("15:04"),
+		"hotel_name": hotelName,
+	}
+
+	return placeholderRe.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := placeholderRe.FindStringSubmatch(m)[1]
+		if v, ok := builtins[name]; ok {
+			return v
+		}
+		out, err := runSavedQuery(ctx, adminPool, db, hotelID, name)
+		if err != nil {
+			log.Printf("content template: {{%s}}: %v", name, err)
+			return fmt.Sprintf("(%s unavailable)", name)
+		}
+		return strings.TrimRight(out, "\n")
+	})
+}
+
+// runSavedQuery looks up property hotelID's saved query by name (via
+// adminPool) and executes it on db inside a read-only transaction.
+func runSavedQuery(ctx context.Context, adminPool, db *pgxpool.Pool, hotelID int, name string) (string, error) {
+	var sql string
+	if err := adminPool.QueryRow(ctx,
+		`SELECT sql FROM saved_queries WHERE hotel_id = $1 AND name = $2`, hotelID, name,
+	).Scan(&sql); err != nil {
+		return "", fmt.Errorf("saved query %q not found", name)
+	}
+	return runReadOnly(ctx, db, sql, 0)
+}
+
+// runReadOnly executes sql on db inside a read-only transaction and renders at
+// most limit rows (0 = all) with formatRowsLimit.
+func runReadOnly(ctx context.Context, db *pgxpool.Pool, sql string, limit int) (string, error) {
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return "", fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return "", fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	return formatRowsLimit(rows, limit)
+}
+
+// loadContentTemplate returns property hotelID's content_templates.<name>, or
+// fallback if unset.
+func loadContentTemplate(ctx context.Context, pool *pgxpool.Pool, hotelID int, name, fallback string) string {
+	var tmpl string
+	pool.QueryRow(ctx,
+		`SELECT template FROM content_templates WHERE hotel_id = $1 AND name = $2`, hotelID, name,
+	).Scan(&tmpl)
+	if tmpl == "" {
+		return fallback
+	}
+	return tmpl
+}
+
+// seedContentTemplates inserts the default content templates and the saved
+// queries they reference. Safe to call on every boot: saved queries are only
+// inserted (ON CONFLICT DO NOTHING), and a template follows the default only
+// while it still matches the text it was last seeded with
+// (content_templates.seeded), so new sections reach every deployment and
+// edits made by managers are never overwritten.
+func seedContentTemplates(ctx context.Context, pool *pgxpool.Pool) error {
+	queries := []struct{ name, description, sql string }{
+		{"checkouts_24h", "Departures in the next 24h and whether a cleaning is assigned",
+			`SELECT r.name AS room, res.guest_name, res.checkout_at,
+			        EXISTS (SELECT 1 FROM assignments a
+			                WHERE a.room_id = r.id AND a.date = (res.checkout_at AT TIME ZONE 'Europe/Rome')::date) AS assigned
+			 FROM reservations res JOIN rooms r ON r.id = res.room_id
+			 WHERE res.status = 'confirmed' AND res.checkout_at BETWEEN now() AND now() + INTERVAL '24 hours'
+			 ORDER BY res.checkout_at`},
+		{"checkins_unready_24h", "Arrivals in the next 24h whose room is not ready",
+			`SELECT r.name AS room, r.status, res.guest_name, res.checkin_at
+			 FROM reservations res JOIN rooms r ON r.id = res.room_id
+			 WHERE res.status = 'confirmed' AND res.checkin_at BETWEEN now() AND now() + INTERVAL '24 hours'
+			   AND r.status NOT IN ('ready', 'available')
+			 ORDER BY res.checkin_at`},
+		{"stale_assignments", "Pending/in-progress assignments untouched for 3+ hours",
+			`SELECT a.id, r.name AS room, u.name AS cleaner, a.status, a.updated_at
+			 FROM assignments a JOIN rooms r ON r.id = a.room_id JOIN users u ON u.telegram_id = a.cleaner_id
+			 WHERE a.status IN ('pending', 'in_progress') AND a.updated_at < now() - INTERVAL '3 hours'
+			 ORDER BY a.updated_at`},
+		{"arrival_extras_today", "Extras to prepare for today's arrivals (cots, parking…)",
+			`SELECT r.name AS room, res.guest_name, e.name AS extra, re.quantity
+			 FROM reservation_extras re
+			 JOIN reservations res ON res.id = re.reservation_id
+			 JOIN rooms r ON r.id = res.room_id
+			 JOIN extras e ON e.hotel_id = re.hotel_id AND e.code = re.extra_code
+			 WHERE res.status = 'confirmed'
+			   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = (now() AT TIME ZONE 'Europe/Rome')::date
+			 ORDER BY res.checkin_at, r.name`},
+		{"open_tickets", "Open maintenance tickets, most severe first",
+			`SELECT t.id, COALESCE(r.name, '-') AS room, t.severity, t.status, t.description, u.name AS reporter, t.created_at
+			 FROM maintenance_tickets t LEFT JOIN rooms r ON r.id = t.room_id JOIN users u ON u.telegram_id = t.reporter
+			 WHERE t.status <> 'closed'
+			 ORDER BY array_position(ARRAY['urgent','high','normal','low'], t.severity), t.created_at`},
+		{"open_incidents", "Open guest complaints and incidents, most severe first",
+			`SELECT i.id, i.kind, i.severity, COALESCE(r.name, '-') AS room, i.description, u.name AS reporter, i.created_at
+			 FROM incidents i LEFT JOIN rooms r ON r.id = i.room_id JOIN users u ON u.telegram_id = i.reported_by
+			 WHERE i.status = 'open'
+			 ORDER BY array_position(ARRAY['urgent','high','normal','low'], i.severity), i.created_at`},
+		{"low_stock", "Cleaning supplies and linen at or under their minimum stock",
+			`SELECT s.name, s.category, s.quantity, s.threshold, s.unit
+			 FROM supplies s
+			 WHERE s.quantity <= s.threshold
+			 ORDER BY s.category, s.quantity / NULLIF(s.threshold, 0) NULLS FIRST, s.name`},
+		{"keys_out", "Keys not returned: taken before today, or after 19:00 by someone not clocked in",
+			`SELECT k.label, k.kind, u.name AS held_by, k.taken_at,
+			        EXISTS (SELECT 1 FROM work_sessions w WHERE w.user_id = k.held_by AND w.ended_at IS NULL) AS clocked_in
+			 FROM keys k JOIN users u ON u.telegram_id = k.held_by
+			 WHERE (k.taken_at AT TIME ZONE 'Europe/Rome')::date < (now() AT TIME ZONE 'Europe/Rome')::date
+			    OR ((now() AT TIME ZONE 'Europe/Rome')::time >= '19:00'
+			        AND NOT EXISTS (SELECT 1 FROM work_sessions w WHERE w.user_id = k.held_by AND w.ended_at IS NULL))
+			 ORDER BY k.taken_at`},
+		{"meter_anomalies", "Latest meter readings (last 45 days) with a daily consumption 50%+ above the usual rate of that meter",
+			`WITH r AS (
+			     SELECT room_id, meter, read_on, reset,
+			            reading - lag(reading) OVER w AS used, read_on - lag(read_on) OVER w AS days
+			     FROM meter_readings
+			     WINDOW w AS (PARTITION BY COALESCE(room_id, 0), meter ORDER BY read_on)
+			 ), d AS (
+			     SELECT room_id, meter, read_on, used / days AS per_day,
+			            row_number() OVER (PARTITION BY COALESCE(room_id, 0), meter ORDER BY read_on DESC) AS n
+			     FROM r WHERE days > 0 AND NOT reset
+			 )
+			 SELECT COALESCE(rm.name, 'generale') AS room, l.meter, l.read_on,
+			        round(l.per_day, 2) AS per_day, round(avg(h.per_day), 2) AS usual_per_day
+			 FROM d l
+			 JOIN d h ON COALESCE(h.room_id, 0) = COALESCE(l.room_id, 0) AND h.meter = l.meter
+			         AND h.n > 1 AND h.read_on > l.read_on - 365
+			 LEFT JOIN rooms rm ON rm.id = l.room_id
+			 WHERE l.n = 1 AND l.read_on >= (now() AT TIME ZONE 'Europe/Rome')::date - 45
+			 GROUP BY rm.name, l.room_id, l.meter, l.read_on, l.per_day
+			 HAVING l.per_day > 1.5 * avg(h.per_day)
+			 ORDER BY l.per_day / NULLIF(avg(h.per_day), 0) DESC, room`},
+	}
+	for _, q := range queries {
+		if _, err := pool.Exec(ctx,
+			`INSERT INTO saved_queries (hotel_id, name, description, sql)
+			 SELECT id, $1, $2, $3 FROM hotels
+			 ON CONFLICT (hotel_id, name) DO NOTHING`,
+			q.name, q.description, q.sql,
+		); err != nil {
+			return fmt.Errorf("seed saved query %s: %w", q.name, err)
+		}
+	}
+
+	// Rows seeded before the seeded column existed: adopt them if they are an
+	// earlier default, leave them alone (seeded NULL) if the manager edited them.
+	rows, err := pool.Query(ctx,
+		`SELECT hotel_id, template FROM content_templates WHERE name = 'heartbeat' AND seeded IS NULL`)
+	if err != nil {
+		return fmt.Errorf("read heartbeat content: %w", err)
+	}
+	var adopt []int
+	for rows.Next() {
+		var hotelID int
+		var legacy string
+		if err := rows.Scan(&hotelID, &legacy); err != nil {
+			rows.Close()
+			return fmt.Errorf("read heartbeat content: %w", err)
+		}
+		if olderDefault(legacy, DefaultHeartbeatContent) {
+			adopt = append(adopt, hotelID)
+		}
+	}
+	rows.Close()
+	for _, hotelID := range adopt {
+		if _, err := pool.Exec(ctx,
+			`UPDATE content_templates SET seeded = template WHERE hotel_id = $1 AND name = 'heartbeat'`, hotelID,
+		); err != nil {
+			return fmt.Errorf("adopt heartbeat content: %w", err)
+		}
+	}
+
+	hotels, err := hotelIDs(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for _, hotelID := range hotels {
+		tag, err := pool.Exec(ctx,
+			`INSERT INTO content_templates (hotel_id, name, template, seeded) VALUES ($1, $2, $3, $3)
+			 ON CONFLICT (hotel_id, name) DO UPDATE SET template = EXCLUDED.template, seeded = EXCLUDED.seeded, updated_at = now()
+			 WHERE content_templates.template = content_templates.seeded`,
+			hotelID, "heartbeat", DefaultHeartbeatContent,
+		)
+		if err != nil {
+			return fmt.Errorf("seed heartbeat content: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			log.Printf("content template heartbeat: hotel %d: edited by a manager, default not applied", hotelID)
+		}
+	}
+	return nil
+}
+
+// olderDefault reports whether tmpl is def with some of its sections (blocks
+// separated by a blank line) left out: what every earlier default looks like,
+// since later features only added sections.
+func olderDefault(tmpl, def string) bool {
+	var kept []string
+	for _, block := range strings.Split(def, "\n\n") {
+		if strings.Contains(tmpl, block) {
+			kept = append(kept, block)
+		}
+	}
+	return strings.Join(kept, "\n\n") == tmpl
+}
+
+const DefaultHeartbeatContent = `🕐 Heartbeat check for {{hotel_name}} — {{date}} {{time}}.
+
+Departures in the next 24 hours (assigned = cleaning already planned):
+{{checkouts_24h}}
+
+Arrivals in the next 24 hours whose room is not ready:
+{{checkins_unready_24h}}
+
+Stale assignments (3+ hours without updates):
+{{stale_assignments}}
+
+Extras to prepare for today's arrivals:
+{{arrival_extras_today}}
+
+Open maintenance tickets:
+{{open_tickets}}
+
+Open guest complaints and incidents (close them with log_incident and a resolution):
+{{open_incidents}}
+
+Supplies at or under their minimum stock (restock them):
+{{low_stock}}
+
+Keys not returned at the end of the day (remind the holder with send_user_message):
+{{keys_out}}
+
+Meter readings well above the usual consumption (a leak, a heater left on? open a ticket if it needs a check):
+{{meter_anomalies}}
+
+The data above is already up to date — only use execute_sql if you need more detail.
+If you find issues, use send_user_message to notify me with a summary. If everything looks fine, just reply OK.`
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlpkg "html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TimeOff handles leave requests (ferie, permessi). Staff ask with
+// request_time_off: the absence is stored in staff_absences as 'requested'
+// and sent to the managers with buttons "off:ok:<id>" / "off:no:<id>". Only
+// approved absences count (daily plan, sick-day redistribution, payroll).
+// Approving removes the requester's shifts in the period and, when they have
+// pending assignments there, sends the manager the same redistribution
+// proposal as /malattia (SickDays.proposal). A manager's own request is
+// approved at once.
+type TimeOff struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	sick      *SickDays
+}
+
+func newTimeOff(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string, sick *SickDays) *TimeOff {
+	return &TimeOff{adminPool: adminPool, registry: registry, botToken: botToken, sick: sick}
+}
+
+// timeOffMaxDays bounds a single request.
+const timeOffMaxDays = 60
+
+// Register wires the approval buttons.
+func (o *TimeOff) Register(m *routedMessenger) {
+	m.Handle("off:", o.handleButton)
+}
+
+// Tools returns request_time_off.
+func (o *TimeOff) Tools() []agent.Tool {
+	return []agent.Tool{&requestTimeOffTool{timeOff: o}}
+}
+
+// timeOffPeriod is "il 20/10" or "dal 20/10 al 24/10 (5 giorni)".
+func timeOffPeriod(from, to time.Time) string {
+	if from.Equal(to) {
+		return "il " + from.Format("02/01")
+	}
+	days := int(to.Sub(from).Hours()/24+0.5) + 1
+	return fmt.Sprintf("dal %s al %s (%d giorni)", from.Format("02/01"), to.Format("02/01"), days)
+}
+
+// askManagers sends a request to the managers with what it would affect.
+func (o *TimeOff) askManagers(ctx context.Context, id, userID int64, name string, from, to time.Time, note string) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🌴 <b>%s chiede ferie</b> %s.", htmlpkg.EscapeString(name), timeOffPeriod(from, to))
+	if note != "" {
+		fmt.Fprintf(&sb, "\nNota: %s", htmlpkg.EscapeString(note))
+	}
+	var pending, shifts int
+	_ = o.adminPool.QueryRow(ctx,
+		`SELECT (SELECT count(*) FROM assignments WHERE cleaner_id = $1 AND status = 'pending' AND date BETWEEN $2 AND $3),
+		        (SELECT count(*) FROM shift_assignments WHERE user_id = $1 AND date BETWEEN $2 AND $3)`,
+		userID, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(&pending, &shifts)
+	if pending > 0 || shifts > 0 {
+		fmt.Fprintf(&sb, "\nNel periodo: %d turni pianificati, %d assegnazioni in attesa.", shifts, pending)
+	}
+	rows, err := o.adminPool.Query(ctx,
+		`SELECT COALESCE(u.name, u.telegram_id::text), ab.from_date, ab.to_date
+		 FROM staff_absences ab JOIN users u ON u.telegram_id = ab.user_id
+		 WHERE ab.status = 'approved' AND ab.user_id <> $1 AND ab.from_date <= $3 AND ab.to_date >= $2
+		   AND u.hotel_id = (SELECT hotel_id FROM users WHERE telegram_id = $1)
+		 ORDER BY ab.from_date`, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err == nil {
+		var away []string
+		for rows.Next() {
+			var who string
+			var f, t time.Time
+			if rows.Scan(&who, &f, &t) == nil {
+				away = append(away, fmt.Sprintf("%s %s–%s", htmlpkg.EscapeString(who), f.Format("02/01"), t.Format("02/01")))
+			}
+		}
+		rows.Close()
+		if len(away) > 0 {
+			sb.WriteString("\nGià assenti nel periodo: " + strings.Join(away, ", ") + ".")
+		}
+	}
+	sid := strconv.FormatInt(id, 10)
+	buttons := [][]telegram.Button{{
+		{Text: "✅ Approva", CallbackData: "off:ok:" + sid},
+		{Text: "❌ Rifiuta", CallbackData: "off:no:" + sid},
+	}}
+	hotelID, err := hotelOf(ctx, o.adminPool, userID)
+	if err != nil {
+		log.Printf("time off: %v", err)
+		return
+	}
+	managers, err := managerIDs(ctx, o.adminPool, hotelID)
+	if err != nil {
+		log.Printf("time off: %v", err)
+		return
+	}
+	for _, m := range managers {
+		if _, err := sendKeyboard(ctx, o.botToken, m, sb.String(), buttons); err != nil {
+			log.Printf("time off: notify manager %d: %v", m, err)
+		}
+	}
+}
+
+func (o *TimeOff) handleButton(ctx context.Context, u agent.Update) error {
+	parts := strings.Split(u.Text, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed time off callback")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad time off id: %w", err)
+	}
+	tg := newBot(o.botToken)
+	var role string
+	_ = o.adminPool.QueryRow(ctx, `SELECT role FROM users WHERE telegram_id = $1`, u.UserID).Scan(&role)
+	if Role(role) != RoleManager {
+		return fmt.Errorf("user %d is not a manager", u.UserID)
+	}
+	db, err := o.registry.Pool(ctx, u.UserID)
+	if err != nil {
+		return err
+	}
+	switch parts[1] {
+	case "ok":
+		reply, err := o.approve(ctx, db, id, u.UserID, u.ChatID)
+		if err != nil {
+			return tg.Send(ctx, u.ChatID, "❌ "+err.Error())
+		}
+		return tg.Send(ctx, u.ChatID, reply)
+	case "no":
+		var userID int64
+		var from, to time.Time
+		err := db.QueryRow(ctx,
+			`UPDATE staff_absences SET status = 'rejected', decided_by = $2, decided_at = now()
+			 WHERE id = $1 AND status = 'requested' RETURNING user_id, from_date, to_date`, id, u.UserID,
+		).Scan(&userID, &from, &to)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return tg.Send(ctx, u.ChatID, "Richiesta già gestita.")
+		}
+		if err != nil {
+			return fmt.Errorf("reject time off %d: %w", id, err)
+		}
+		_ = tg.Send(ctx, userID, fmt.Sprintf("❌ La tua richiesta di ferie %s non è stata approvata: parlane con il manager.",
+			timeOffPeriod(from, to)))
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("Richiesta di ferie #%d rifiutata, l'ho detto al collega.", id))
+	}
+	return fmt.Errorf("unknown time off action %q", parts[1])
+}
+
+// approve grants a requested absence on db (the manager's pool), frees the
+// requester's shifts in the period and tells them. When they had pending
+// assignments, the redistribution proposal goes to chatID.
+func (o *TimeOff) approve(ctx context.Context, db *pgxpool.Pool, id, managerID, chatID int64) (string, error) {
+	var userID int64
+	var from, to time.Time
+	var freed int64
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`UPDATE staff_absences SET status = 'approved', decided_by = $2, decided_at = now()
+			 WHERE id = $1 AND status = 'requested' RETURNING user_id, from_date, to_date`, id, managerID,
+		).Scan(&userID, &from, &to)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("richiesta #%d già gestita o non trovata", id)
+		}
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM shift_assignments WHERE user_id = $1 AND date BETWEEN $2 AND $3`, userID, from, to)
+		if err != nil {
+			return fmt.Errorf("free shifts: %w", err)
+		}
+		freed = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	loc := romeLocation()
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	period := timeOffPeriod(from, to)
+	var name string
+	_ = o.adminPool.QueryRow(ctx, `SELECT COALESCE(name, telegram_id::text) FROM users WHERE telegram_id = $1`, userID).Scan(&name)
+	log.Printf("time off: %d approved for user %d, %s → %s", id, userID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+
+	tg := newBot(o.botToken)
+	if userID != managerID {
+		_ = tg.Send(ctx, userID, fmt.Sprintf("🌴 Ferie approvate %s. Buon riposo!", period))
+	}
+	reply := fmt.Sprintf("✅ Ferie di %s approvate %s.", name, period)
+	if freed > 0 {
+		reply += fmt.Sprintf(" Tolti %d turni dal piano.", freed)
+	}
+	moves, proposal, buttons, err := o.sick.proposal(ctx, id, userID, from, to)
+	if err != nil {
+		log.Printf("time off: proposal for %d: %v", id, err)
+		return reply + " Controlla le sue assegnazioni nel periodo.", nil
+	}
+	if len(moves) > 0 {
+		text := fmt.Sprintf("🌴 <b>%s %s</b> %s.\n", htmlpkg.EscapeString(name), absenceLabel("leave"), period) + proposal
+		if _, err := sendKeyboard(ctx, o.botToken, chatID, text, buttons); err != nil {
+			log.Printf("time off: proposal to %d: %v", chatID, err)
+		}
+		reply += fmt.Sprintf(" Ha %d assegnazioni nel periodo: ti ho mandato la proposta di ridistribuzione.", len(moves))
+	}
+	return reply, nil
+}
+
+// ── request_time_off ─────────────────────────────────────────────────────────
+
+type requestTimeOffTool struct {
+	timeOff *TimeOff
+}
+
+func (t *requestTimeOffTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "request_time_off",
+		Description: "Chiede ferie o un permesso per uno o più giorni: la richiesta va ai manager, che la approvano o " +
+			"rifiutano con un pulsante, e l'esito arriva in chat. Le richieste dei manager sono approvate subito. " +
+			"Per la malattia si usa /malattia.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"from": {"type": "string", "description": "Primo giorno di assenza YYYY-MM-DD"},
+				"to": {"type": "string", "description": "Ultimo giorno di assenza YYYY-MM-DD (default from)"},
+				"note": {"type": "string", "description": "Motivo o nota per il manager (facoltativa)"}
+			},
+			"required": ["from"]
+		}`),
+	}
+}
+
+func (t *requestTimeOffTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+		Note string `json:"note"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if in.From == "" {
+		return "", fmt.Errorf("from is required")
+	}
+	from, to, err := parseReportRange(in.From, in.To, time.Time{},
+		func(from time.Time) time.Time { return from }, timeOffMaxDays)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().In(romeLocation())
+	if from.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+		return "", fmt.Errorf("time off cannot start in the past")
+	}
+	note := strings.TrimSpace(in.Note)
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var overlap *time.Time
+	if err := db.QueryRow(bg,
+		`SELECT min(from_date) FROM staff_absences
+		 WHERE user_id = $1 AND status IN ('requested', 'approved') AND from_date <= $3 AND to_date >= $2`,
+		ctx.UserID, from.Format("2006-01-02"), to.Format("2006-01-02")).Scan(&overlap); err != nil {
+		return "", fmt.Errorf("query absences: %w", err)
+	}
+	if overlap != nil {
+		return "", fmt.Errorf("hai già un'assenza richiesta o approvata in quel periodo (dal %s)", overlap.Format("02/01"))
+	}
+
+	var manager bool
+	_ = db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager)
+	// Inserted as the user: RLS allows only their own request.
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO staff_absences (user_id, from_date, to_date, reason, status, note)
+		 VALUES ($1, $2, $3, 'leave', 'requested', NULLIF($4, '')) RETURNING id`,
+		ctx.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"), note).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert request: %w", err)
+	}
+	if manager {
+		return t.timeOff.approve(bg, db, id, ctx.UserID, ctx.ChatID)
+	}
+	var name string
+	_ = db.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&name)
+	if name == "" {
+		name = strconv.FormatInt(ctx.UserID, 10)
+	}
+	t.timeOff.askManagers(bg, id, ctx.UserID, name, from, to, note)
+	return fmt.Sprintf("🌴 Richiesta di ferie #%d inviata al manager (%s). Ti scrivo appena risponde.",
+		id, timeOffPeriod(from, to)), nil
+}
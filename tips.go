@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+)
+
+// Tips: money a cleaner found in a room or was handed by a guest, and gifts
+// (chocolates, a bottle) without an amount. Cleaners log their own with
+// log_tip; RLS keeps each cleaner's tips private to them and the managers.
+// tips_summary totals a month per cleaner — a cleaner only ever sees their
+// own line.
+
+// tipKinds are the values of tips.kind, with their label.
+var tipKinds = map[string]string{
+	"found":  "trovata in camera",
+	"handed": "ricevuta dall'ospite",
+	"gift":   "regalo",
+}
+
+// ── log_tip ──────────────────────────────────────────────────────────────────
+
+type logTipTool struct{}
+
+func (t *logTipTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "log_tip",
+		Description: "Registra una mancia: trovata in camera (found), ricevuta dall'ospite (handed) o un regalo (gift, " +
+			"anche senza importo). Visibile solo a chi la registra e ai manager. Un manager può registrarla per un cleaner.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"amount_eur": {"type": "number", "description": "Importo in euro (facoltativo solo per i regali)"},
+				"kind": {"type": "string", "enum": ["found", "handed", "gift"], "description": "Default found"},
+				"room": {"type": "string", "description": "Camera"},
+				"date": {"type": "string", "description": "Giorno YYYY-MM-DD (default oggi)"},
+				"notes": {"type": "string", "description": "Es. 'biglietto di ringraziamento', 'scatola di cioccolatini'"},
+				"cleaner": {"type": "string", "description": "Solo manager: nome del cleaner per cui registrarla"}
+			}
+		}`),
+	}
+}
+
+func (t *logTipTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		AmountEUR *float64 `json:"amount_eur"`
+		Kind      string   `json:"kind"`
+		Room      string   `json:"room"`
+		Date      string   `json:"date"`
+		Notes     string   `json:"notes"`
+		Cleaner   string   `json:"cleaner"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	if in.Kind == "" {
+		in.Kind = "found"
+	}
+	label, ok := tipKinds[in.Kind]
+	if !ok {
+		return "", fmt.Errorf("kind must be found, handed or gift")
+	}
+	if in.AmountEUR == nil && in.Kind != "gift" {
+		return "", fmt.Errorf("amount_eur is required (only gifts may have none)")
+	}
+	if in.AmountEUR != nil && *in.AmountEUR <= 0 {
+		return "", fmt.Errorf("amount_eur must be positive")
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if in.Date != "" {
+		d, err := time.ParseInLocation("2006-01-02", in.Date, loc)
+		if err != nil {
+			return "", fmt.Errorf("date must be YYYY-MM-DD: %w", err)
+		}
+		if d.After(day) {
+			return "", fmt.Errorf("la data %s è nel futuro", d.Format("02/01/2006"))
+		}
+		day = d
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	cleanerID, who := ctx.UserID, ""
+	if strings.TrimSpace(in.Cleaner) != "" {
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("only managers can log a tip for someone else")
+		}
+		if cleanerID, who, err = findStaff(bg, db, in.Cleaner); err != nil {
+			return "", err
+		}
+	}
+	var roomID *int
+	room := strings.TrimSpace(in.Room)
+	if room != "" {
+		var id int
+		if err := db.QueryRow(bg, `SELECT id, name FROM rooms WHERE lower(name) = lower($1)`, room).Scan(&id, &room); err != nil {
+			return "", fmt.Errorf("camera %q non trovata", in.Room)
+		}
+		roomID = &id
+	}
+
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO tips (cleaner_id, room_id, kind, amount_eur, received_on, notes)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING id`,
+		cleanerID, roomID, in.Kind, in.AmountEUR, day, strings.TrimSpace(in.Notes)).Scan(&id); err != nil {
+		return "", fmt.Errorf("save tip: %w", err)
+	}
+
+	msg := "💶 Registrata"
+	if in.AmountEUR != nil {
+		msg += fmt.Sprintf(" una mancia di %.2f€ %s", *in.AmountEUR, label)
+	} else {
+		msg += " un regalo"
+	}
+	if room != "" {
+		msg += " (camera " + room + ")"
+	}
+	msg += ", " + day.Format("02/01")
+	if who != "" {
+		msg += ", per " + who
+	}
+	return msg + fmt.Sprintf(". #%d", id), nil
+}
+
+// ── tips_summary ─────────────────────────────────────────────────────────────
+
+type tipsSummaryTool struct{}
+
+func (t *tipsSummaryTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "tips_summary",
+		Description: "Riepilogo mensile delle mance per cleaner: totale, quante trovate in camera e quante ricevute, regali. " +
+			"Un cleaner vede solo le proprie, con il dettaglio; un manager tutti, o il dettaglio di uno con cleaner.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {"type": "string", "description": "Mese nel formato YYYY-MM (default: mese corrente)"},
+				"cleaner": {"type": "string", "description": "Solo manager: nome del cleaner di cui vedere il dettaglio"}
+			}
+		}`),
+	}
+}
+
+func (t *tipsSummaryTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Month   string `json:"month"`
+		Cleaner string `json:"cleaner"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		s, err := time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+		start = s
+	}
+	end := start.AddDate(0, 1, 0)
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil {
+		return "", fmt.Errorf("check role: %w", err)
+	}
+	// RLS already limits a cleaner to their own rows; detail is shown for
+	// one person only.
+	var cleanerID int64
+	if strings.TrimSpace(in.Cleaner) != "" {
+		if !manager {
+			return "", fmt.Errorf("only managers can see other people's tips")
+		}
+		if cleanerID, _, err = findStaff(bg, db, in.Cleaner); err != nil {
+			return "", err
+		}
+	} else if !manager {
+		cleanerID = ctx.UserID
+	}
+
+	rows, err := db.Query(bg,
+		`SELECT COALESCE(u.name, t.cleaner_id::text),
+		        COALESCE(sum(t.amount_eur), 0)::float8,
+		        count(*) FILTER (WHERE t.kind = 'found'),
+		        count(*) FILTER (WHERE t.kind = 'handed'),
+		        count(*) FILTER (WHERE t.kind = 'gift')
+		 FROM tips t LEFT JOIN users u ON u.telegram_id = t.cleaner_id
+		 WHERE t.received_on >= $1 AND t.received_on < $2 AND ($3::bigint = 0 OR t.cleaner_id = $3)
+		 GROUP BY t.cleaner_id, u.name
+		 ORDER BY 2 DESC`, start, end, cleanerID)
+	if err != nil {
+		return "", fmt.Errorf("query tips: %w", err)
+	}
+	var sb strings.Builder
+	var total float64
+	var people int
+	for rows.Next() {
+		var name string
+		var sum float64
+		var found, handed, gifts int
+		if err := rows.Scan(&name, &sum, &found, &handed, &gifts); err != nil {
+			rows.Close()
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n• %s: %.2f€ (%d trovate in camera, %d ricevute", name, sum, found, handed)
+		if gifts > 0 {
+			fmt.Fprintf(&sb, ", %d regali", gifts)
+		}
+		sb.WriteString(")")
+		total += sum
+		people++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	month := start.Format("01/2006")
+	if people == 0 {
+		return fmt.Sprintf("Nessuna mancia registrata a %s.", month), nil
+	}
+	out := fmt.Sprintf("💶 Mance di %s:%s", month, sb.String())
+	if people > 1 {
+		out += fmt.Sprintf("\nTotale: %.2f€", total)
+	}
+	if cleanerID == 0 {
+		return out, nil
+	}
+
+	rows, err = db.Query(bg,
+		`SELECT t.received_on, t.kind, t.amount_eur::float8, COALESCE(r.name, ''), COALESCE(t.notes, '')
+		 FROM tips t LEFT JOIN rooms r ON r.id = t.room_id
+		 WHERE t.received_on >= $1 AND t.received_on < $2 AND t.cleaner_id = $3
+		 ORDER BY t.received_on, t.id`, start, end, cleanerID)
+	if err != nil {
+		return "", fmt.Errorf("query tips: %w", err)
+	}
+	defer rows.Close()
+	var detail strings.Builder
+	for rows.Next() {
+		var on time.Time
+		var kind, room, notes string
+		var amount *float64
+		if err := rows.Scan(&on, &kind, &amount, &room, &notes); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&detail, "\n  %s", on.Format("02/01"))
+		if amount != nil {
+			fmt.Fprintf(&detail, " %.2f€", *amount)
+		}
+		detail.WriteString(" " + tipKinds[kind])
+		if room != "" {
+			detail.WriteString(", camera " + room)
+		}
+		if notes != "" {
+			detail.WriteString(" — " + notes)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return out + detail.String(), nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+)
+
+// Tool metadata: what a call is expected to take, what it costs and whether
+// it destroys data, next to the tool definitions instead of only in their
+// prose. llm.ToolDef belongs to the SDK, so the metadata is keyed by tool
+// name (toolMetas) and applied by toolGuard, which wraps every tool set:
+//
+//   - calls slower than toolSlowFactor × their expected latency are logged,
+//     and every call is counted per tool for /metrics;
+//   - a destructive call is refused until the user has written again in the
+//     chat and the model repeats it with the same arguments, so it must
+//     describe what it is about to do and wait for the go-ahead;
+//   - /tools gives the admin the capability report: every tool with its
+//     metadata and the calls since startup;
+//   - guest tools (guestaccess.go) are the only ones guests get, and only
+//     guests get them: toolDefsFor filters what the model is offered and
+//     the guard refuses a call from the wrong side.
+//
+// Configure via env:
+//
+//	TOOL_CONFIRM_DESTRUCTIVE=true   "false" disables the confirmation gate
+
+// costClass is the rough price of a call, beyond the tokens of its result.
+type costClass string
+
+const (
+	costLow    costClass = "low"    // a few indexed queries
+	costMedium costClass = "medium" // scans over months of data, or a file built in memory
+	costHigh   costClass = "high"   // calls leaving the process: Telegram uploads, other hotels, calendars
+)
+
+// When a tool call is destructive (toolMeta.destructive).
+const (
+	destructiveNever    = ""
+	destructiveAlways   = "always"
+	destructiveOnDelete = "delete" // with delete=true
+	destructiveOnSQL    = "sql"    // DELETE/DROP/TRUNCATE or UPDATE without WHERE (isDestructiveSQL)
+	destructiveOnCancel = "cancel" // with action "cancel"
+)
+
+type toolMeta struct {
+	latency     time.Duration // expected duration of a call
+	cost        costClass
+	destructive string
+	external    bool // acts outside the caller's pool: messages to others, the admin pool, other hotels
+	dryRunArg   bool // has its own dry_run argument (dryrun.go)
+	guest       bool // for guests, and only for them (guestaccess.go)
+}
+
+// defaultToolMeta applies to tools without an entry in toolMetas.
+var defaultToolMeta = toolMeta{latency: time.Second, cost: costLow}
+
+// toolMetas lists the tools that differ from defaultToolMeta.
+var toolMetas = map[string]toolMeta{
+	"execute_sql":           {latency: 2 * time.Second, cost: costLow, destructive: destructiveOnSQL},
+	"set_checklist":         {latency: time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"set_rate":              {latency: time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"set_rate_rule":         {latency: time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"set_recurring_task":    {latency: time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"set_reminder_template": {latency: 2 * time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"set_room_type":         {latency: time.Second, cost: costLow, destructive: destructiveOnDelete},
+	"save_report":           {latency: 3 * time.Second, cost: costMedium, destructive: destructiveOnDelete},
+	"preview_report":        {latency: 3 * time.Second, cost: costMedium},
+	"run_report":            {latency: 3 * time.Second, cost: costMedium},
+	"add_group_booking":     {latency: 2 * time.Second, cost: costLow},
+	"group_booking":         {latency: time.Second, cost: costLow, destructive: destructiveOnCancel},
+	"generate_daily_plan":   {latency: 5 * time.Second, cost: costMedium, dryRunArg: true},
+	"setup_rooms":           {latency: 3 * time.Second, cost: costMedium, dryRunArg: true},
+	"revenue_report":        {latency: 3 * time.Second, cost: costMedium},
+	"occupancy_report":      {latency: 3 * time.Second, cost: costMedium},
+	"channel_report":        {latency: 3 * time.Second, cost: costMedium},
+	"cleaner_stats":         {latency: 3 * time.Second, cost: costMedium},
+	"tips_summary":          {latency: 2 * time.Second, cost: costLow},
+	"review_cleaning":       {latency: time.Second, cost: costLow},
+	"cleaning_standard":     {latency: time.Second, cost: costLow},
+	"incident_report":       {latency: 3 * time.Second, cost: costMedium},
+	"timesheet":             {latency: 3 * time.Second, cost: costMedium},
+	"payroll_export":        {latency: 5 * time.Second, cost: costHigh},
+	"istat_report":          {latency: 5 * time.Second, cost: costHigh},
+	"city_tax_report":       {latency: 5 * time.Second, cost: costHigh},
+	"haccp_export":          {latency: 5 * time.Second, cost: costHigh},
+	"export_alloggiati":     {latency: 5 * time.Second, cost: costHigh, external: true},
+	"create_invoice":        {latency: 5 * time.Second, cost: costHigh},
+	"import_reservations":   {latency: 5 * time.Second, cost: costHigh, external: true},
+	"show_photos":           {latency: 5 * time.Second, cost: costHigh},
+	"link_calendar":         {latency: 10 * time.Second, cost: costHigh},
+	"ask_hotel":             {latency: 10 * time.Second, cost: costHigh, external: true},
+	"reply_to_hotel":        {latency: 10 * time.Second, cost: costHigh, external: true},
+	"send_guest_message":    {latency: 5 * time.Second, cost: costHigh, external: true},
+	"send_user_message":     {latency: 2 * time.Second, cost: costHigh, external: true},
+	"schedule_reminder":     {latency: time.Second, cost: costLow, external: true},
+	"generate_invite":       {latency: time.Second, cost: costLow, external: true},
+	"swap_shift":            {latency: time.Second, cost: costLow, external: true},
+	"plan_adjust":           {latency: time.Second, cost: costLow, external: true},
+	"my_reservation":        {latency: time.Second, cost: costLow, guest: true},
+	"checkout_time":         {latency: time.Second, cost: costLow, guest: true},
+	"request_towels":        {latency: 2 * time.Second, cost: costHigh, external: true, guest: true},
+	"report_issue":          {latency: 2 * time.Second, cost: costHigh, external: true, guest: true},
+}
+
+func toolMetaFor(name string) toolMeta {
+	if m, ok := toolMetas[name]; ok {
+		return m
+	}
+	return defaultToolMeta
+}
+
+// toolDefsFor keeps the definitions offered to a user with role: the guest
+// tools for guests, everything else for staff.
+func toolDefsFor(defs []llm.ToolDef, role Role) []llm.ToolDef {
+	var out []llm.ToolDef
+	for _, d := range defs {
+		if toolMetaFor(d.Name).guest == (role == RoleGuest) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// isDestructive reports whether a call with args destroys data.
+func (m toolMeta) isDestructive(args json.RawMessage) bool {
+	switch m.destructive {
+	case destructiveAlways:
+		return true
+	case destructiveOnDelete:
+		var in struct {
+			Delete bool `json:"delete"`
+		}
+		json.Unmarshal(args, &in)
+		return in.Delete
+	case destructiveOnSQL:
+		var in struct {
+			Query string `json:"query"`
+		}
+		json.Unmarshal(args, &in)
+		return isDestructiveSQL(in.Query)
+	case destructiveOnCancel:
+		var in struct {
+			Action string `json:"action"`
+		}
+		json.Unmarshal(args, &in)
+		return in.Action == "cancel"
+	}
+	return false
+}
+
+const (
+	// toolSlowFactor × the expected latency makes a call worth a log line.
+	toolSlowFactor = 3
+	// toolConfirmTTL bounds how long a refused destructive call waits for
+	// the user's go-ahead.
+	toolConfirmTTL = 15 * time.Minute
+)
+
+type toolStats struct {
+	calls, errors, slow int
+	total, max          time.Duration
+}
+
+// toolGuard applies toolMetas to the tools it wraps.
+type toolGuard struct {
+	botToken string
+	adminID  int64
+	registry *UserRegistry
+	confirm  bool
+	dryRun   bool
+
+	mu      sync.Mutex
+	names   []string
+	stats   map[string]*toolStats
+	inbound map[int64]time.Time // chatID → last message from the user
+	pending map[string]time.Time
+}
+
+func newToolGuard(botToken string, adminID int64, registry *UserRegistry) *toolGuard {
+	return &toolGuard{
+		botToken: botToken,
+		adminID:  adminID,
+		registry: registry,
+		confirm:  envOr("TOOL_CONFIRM_DESTRUCTIVE", "true") != "false",
+		dryRun:   dryRunEnabled(),
+		stats:    make(map[string]*toolStats),
+		inbound:  make(map[int64]time.Time),
+		pending:  make(map[string]time.Time),
+	}
+}
+
+// Register wires /tools.
+func (g *toolGuard) Register(m *routedMessenger) {
+	m.Handle("/tools", g.handleCommand)
+}
+
+// Inbound notes that the user wrote in u's chat: destructive calls refused
+// before it may now run.
+func (g *toolGuard) Inbound(_ context.Context, u agent.Update) {
+	g.mu.Lock()
+	g.inbound[u.ChatID] = time.Now()
+	g.mu.Unlock()
+}
+
+// Tools wraps ts so its calls are timed, counted and, when destructive, gated.
+func (g *toolGuard) Tools(ts agent.ToolSet) agent.ToolSet {
+	return guardedToolSet{ToolSet: ts, guard: g}
+}
+
+type guardedToolSet struct {
+	agent.ToolSet
+	guard *toolGuard
+}
+
+func (ts guardedToolSet) Tools() []agent.Tool {
+	var out []agent.Tool
+	for _, t := range ts.ToolSet.Tools() {
+		ts.guard.mu.Lock()
+		ts.guard.names = append(ts.guard.names, t.Def().Name)
+		ts.guard.mu.Unlock()
+		out = append(out, guardedTool{Tool: t, guard: ts.guard})
+	}
+	return out
+}
+
+type guardedTool struct {
+	agent.Tool
+	guard *toolGuard
+}
+
+func (t guardedTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	name := t.Def().Name
+	meta := toolMetaFor(name)
+	if guest := t.guard.registry.Role(context.Background(), ctx.UserID) == RoleGuest; guest != meta.guest {
+		return "", fmt.Errorf("%s is not available to this user", name)
+	}
+	if t.guard.dryRun {
+		start := time.Now()
+		out, err := t.guard.dryRunExecute(ctx, t.Tool, name, meta, args)
+		t.guard.record(name, meta, time.Since(start), err)
+		return out, err
+	}
+	destructive := meta.isDestructive(args)
+	if destructive && t.guard.confirm && !t.guard.confirmed(ctx.ChatID, name, args) {
+		return "", fmt.Errorf("%s with these arguments deletes data and needs the user's go-ahead: "+
+			"describe exactly what it will remove and call it again with the same arguments once they confirm", name)
+	}
+	start := time.Now()
+	out, err := t.Tool.Execute(ctx, args)
+	t.guard.record(name, meta, time.Since(start), err)
+	if destructive && err == nil {
+		log.Printf("tools: destructive %s by %d in chat %d", name, ctx.UserID, ctx.ChatID)
+	}
+	return out, err
+}
+
+// confirmed reports whether the same call was refused earlier and the user
+// has written since; otherwise it remembers the call for the next turn.
+func (g *toolGuard) confirmed(chatID int64, name string, args json.RawMessage) bool {
+	// Re-encoding sorts the keys, so the repeated call matches however the
+	// model lays out its JSON.
+	var v any
+	canonical := args
+	if json.Unmarshal(args, &v) == nil {
+		canonical, _ = json.Marshal(v)
+	}
+	key := fmt.Sprintf("%d|%s|%s", chatID, name, canonical)
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for k, at := range g.pending {
+		if now.Sub(at) > toolConfirmTTL {
+			delete(g.pending, k)
+		}
+	}
+	if at, ok := g.pending[key]; ok && g.inbound[chatID].After(at) {
+		delete(g.pending, key)
+		return true
+	}
+	g.pending[key] = now
+	return false
+}
+
+func (g *toolGuard) record(name string, meta toolMeta, d time.Duration, err error) {
+	g.mu.Lock()
+	s := g.stats[name]
+	if s == nil {
+		s = &toolStats{}
+		g.stats[name] = s
+	}
+	s.calls++
+	s.total += d
+	s.max = max(s.max, d)
+	if err != nil {
+		s.errors++
+	}
+	slow := d > toolSlowFactor*meta.latency
+	if slow {
+		s.slow++
+	}
+	g.mu.Unlock()
+	if slow {
+		log.Printf("tools: %s took %s, expected %s (cost %s)", name, d.Round(time.Millisecond), meta.latency, meta.cost)
+	}
+}
+
+// WriteMetrics adds the per-tool counters to /metrics.
+func (g *toolGuard) WriteMetrics(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.stats))
+	for name := range g.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := g.stats[name]
+		fmt.Fprintf(w, "tool_calls_total{tool=%q} %d\n", name, s.calls)
+		fmt.Fprintf(w, "tool_errors_total{tool=%q} %d\n", name, s.errors)
+		fmt.Fprintf(w, "tool_slow_total{tool=%q} %d\n", name, s.slow)
+		fmt.Fprintf(w, "tool_duration_seconds_sum{tool=%q} %.3f\n", name, s.total.Seconds())
+	}
+}
+
+// report is the capability report: every tool with its metadata and the
+// calls since startup, most expensive first.
+func (g *toolGuard) report() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	rank := map[costClass]int{costHigh: 0, costMedium: 1, costLow: 2}
+	names := append([]string(nil), g.names...)
+	sort.Slice(names, func(i, j int) bool {
+		mi, mj := toolMetaFor(names[i]), toolMetaFor(names[j])
+		if rank[mi.cost] != rank[mj.cost] {
+			return rank[mi.cost] < rank[mj.cost]
+		}
+		return names[i] < names[j]
+	})
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧰 %d strumenti", len(names))
+	if g.dryRun {
+		sb.WriteString(" (modalità prova: nessuna scrittura)")
+	} else if !g.confirm {
+		sb.WriteString(" (conferma delle operazioni distruttive disattivata)")
+	}
+	sb.WriteString("\n")
+	for _, name := range names {
+		m := toolMetaFor(name)
+		fmt.Fprintf(&sb, "\n• `%s` — %s, ~%s", name, m.cost, m.latency)
+		switch m.destructive {
+		case destructiveAlways:
+			sb.WriteString(", ⚠️ distruttivo")
+		case destructiveOnDelete:
+			sb.WriteString(", ⚠️ distruttivo con delete=true")
+		case destructiveOnSQL:
+			sb.WriteString(", ⚠️ distruttivo con DELETE/DROP/TRUNCATE o UPDATE senza WHERE")
+		case destructiveOnCancel:
+			sb.WriteString(", ⚠️ distruttivo con action=cancel")
+		}
+		if m.external {
+			sb.WriteString(", esterno")
+		}
+		if s := g.stats[name]; s != nil {
+			fmt.Fprintf(&sb, " · %d chiamate, media %s, max %s", s.calls,
+				(s.total / time.Duration(s.calls)).Round(time.Millisecond), s.max.Round(time.Millisecond))
+			if s.errors > 0 {
+				fmt.Fprintf(&sb, ", %d errori", s.errors)
+			}
+			if s.slow > 0 {
+				fmt.Fprintf(&sb, ", %d lente", s.slow)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func (g *toolGuard) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := telegram.New(g.botToken)
+	if u.UserID != g.adminID {
+		return tg.Send(ctx, u.ChatID, "🔒 /tools è riservato all'amministratore.")
+	}
+	return tg.Send(ctx, u.ChatID, g.report())
+}
@@ -11,7 +11,7 @@ import (
 
 	"github.com/dmorn/m4dtimes/sdk/agent"
 	"github.com/dmorn/m4dtimes/sdk/llm"
-	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -39,11 +39,83 @@ func newHotelTools(registry *UserRegistry, botName, botToken string, adminPool *
 
 func (h *HotelTools) Tools() []agent.Tool {
 	return []agent.Tool{
-		&executeSQLTool{},
+		&executeSQLTool{botToken: h.botToken},
 		&readSchemaTool{},
 		&generateInviteTool{registry: h.registry, botName: h.botName, botToken: h.botToken},
 		&sendUserMessageTool{adminPool: h.adminPool, botToken: h.botToken, bus: h.bus},
 		&scheduleReminderTool{adminPool: h.adminPool},
+		&intentReportTool{},
+		&addReservationTool{},
+		&checkAvailabilityTool{},
+		&todayBoardTool{},
+		&findGuestTool{},
+		&setRoomTypeTool{},
+		&setupRoomsTool{},
+		&configureHotelTool{},
+		&blockRoomTool{},
+		&liftBlockTool{},
+		&quoteTool{},
+		&getQuoteTool{},
+		&setRateTool{},
+		&setRateRuleTool{},
+		&confirmOptionTool{},
+		&addGroupBookingTool{},
+		&groupBookingTool{},
+		&parkingTool{},
+		&hotelInfoTool{},
+		&logReadingTool{},
+		&logTipTool{},
+		&tipsSummaryTool{},
+		&assignParkingTool{},
+		&channelReportTool{},
+		&revenueReportTool{},
+		&cleanerStatsTool{},
+		&reviewCleaningTool{},
+		&cleaningStandardTool{},
+		&payrollExportTool{botToken: h.botToken},
+		&istatReportTool{botToken: h.botToken},
+		&cityTaxReportTool{botToken: h.botToken},
+		&createInvoiceTool{botToken: h.botToken},
+		&recordPaymentTool{},
+		&outstandingBalanceTool{},
+		&bookExtraTool{},
+		&logMinibarTool{adminPool: h.adminPool, botToken: h.botToken},
+		&startTaskTool{},
+		&finishTaskTool{},
+		&logDNDTool{},
+		&inspectRoomTool{botToken: h.botToken},
+		&setChecklistTool{},
+		&openTicketTool{adminPool: h.adminPool, botToken: h.botToken},
+		&listTicketsTool{},
+		&closeTicketTool{adminPool: h.adminPool, botToken: h.botToken},
+		&logIncidentTool{adminPool: h.adminPool, botToken: h.botToken},
+		&incidentReportTool{},
+		&setScheduleTool{adminPool: h.adminPool, botToken: h.botToken},
+		&myShiftsTool{},
+		&clockInTool{},
+		&clockOutTool{},
+		&timesheetTool{},
+		&takeKeyTool{},
+		&returnKeyTool{},
+		&staffDirectoryTool{},
+		&handoffTool{adminPool: h.adminPool, botToken: h.botToken},
+		&swapShiftTool{adminPool: h.adminPool, botToken: h.botToken},
+		&logFoundItemTool{},
+		&searchFoundItemsTool{},
+		&markReturnedTool{},
+		&safetyLookupTool{},
+		&logUsageTool{},
+		&restockTool{},
+		&lowStockReportTool{},
+		&complianceChecksTool{},
+		&completeCheckTool{adminPool: h.adminPool, botToken: h.botToken},
+		&setComplianceCheckTool{},
+		&reminderTemplatesTool{},
+		&setReminderTemplateTool{},
+		&logTemperatureTool{adminPool: h.adminPool, botToken: h.botToken},
+		&haccpExportTool{botToken: h.botToken},
+		&breakfastCountTool{},
+		&setRoomFeaturesTool{},
 	}
 }
 
@@ -65,44 +137,69 @@ type generateInviteTool struct {
 
 func (t *generateInviteTool) Def() llm.ToolDef {
 	return llm.ToolDef{
-		Name:        "generate_invite",
-		Description: "Genera un link di invito per un nuovo utente. Solo i manager possono usare questo tool. Restituisce un link Telegram da condividere con la persona.",
+		Name: "generate_invite",
+		Description: "Genera un link di invito per un nuovo utente. Solo i manager possono usare questo tool. Restituisce un link Telegram da condividere con la persona. " +
+			"Con role 'guest' e reservation_id il link è per l'ospite di quella prenotazione: vale fino al checkout e gli dà solo gli strumenti da ospite.",
 		Parameters: json.RawMessage(`{
 			"type": "object",
 			"properties": {
 				"name": {
 					"type": "string",
-					"description": "Nome della persona da invitare"
+					"description": "Nome della persona da invitare (per un ospite: quello della prenotazione)"
 				},
 				"role": {
 					"type": "string",
-					"enum": ["cleaner", "manager"],
-					"description": "Ruolo da assegnare: 'cleaner' per le cameriere, 'manager' per i responsabili"
+					"enum": ["cleaner", "manager", "guest"],
+					"description": "Ruolo da assegnare: 'cleaner' per le cameriere, 'manager' per i responsabili, 'guest' per l'ospite di una prenotazione"
+				},
+				"reservation_id": {
+					"type": "integer",
+					"description": "Per role 'guest': la prenotazione dell'ospite"
 				}
 			},
-			"required": ["name", "role"]
+			"required": ["role"]
 		}`),
 	}
 }
 
 func (t *generateInviteTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
 	var in struct {
-		Name string `json:"name"`
-		Role string `json:"role"`
+		Name          string `json:"name"`
+		Role          string `json:"role"`
+		ReservationID int64  `json:"reservation_id"`
 	}
 	if err := json.Unmarshal(args, &in); err != nil {
 		return "", err
 	}
-	if in.Name == "" || in.Role == "" {
-		return "", fmt.Errorf("name and role are required")
-	}
 
 	role := Role(in.Role)
-	if role != RoleManager && role != RoleCleaner {
+	var token string
+	var err error
+	expiry := "Scade tra 7 giorni"
+	switch role {
+	case RoleManager, RoleCleaner:
+		if in.Name == "" {
+			return "", fmt.Errorf("name and role are required")
+		}
+		token, err = t.registry.CreateInvite(context.Background(), ctx.UserID, role, in.Name)
+	case RoleGuest:
+		if in.ReservationID == 0 {
+			return "", fmt.Errorf("reservation_id is required for a guest invite")
+		}
+		// The invite is written with the admin pool: check the caller here.
+		db, perr := poolFrom(ctx)
+		if perr != nil {
+			return "", perr
+		}
+		var manager bool
+		if err := db.QueryRow(context.Background(), `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("guest invites are only available to managers")
+		}
+		token, in.Name, err = t.registry.CreateGuestInvite(context.Background(), ctx.UserID, in.ReservationID)
+		expiry = "Scade al checkout"
+	default:
 		return "", fmt.Errorf("invalid role: %s", in.Role)
 	}
-
-	token, err := t.registry.CreateInvite(context.Background(), ctx.UserID, role, in.Name)
 	if err != nil {
 		return "", fmt.Errorf("create invite: %w", err)
 	}
@@ -112,17 +209,17 @@ func (t *generateInviteTool) Execute(ctx agent.ToolContext, args json.RawMessage
 	// Build HTML directly — the URL lives inside an href attribute, so underscores
 	// are never interpreted as markdown italic markers by the SDK converter.
 	htmlMsg := fmt.Sprintf(
-		"🔗 <b>Invito per %s</b> (%s)\n\n<a href=\"%s\">%s</a>\n\n<i>Scade tra 7 giorni · monouso</i>",
-		htmlpkg.EscapeString(in.Name), in.Role, link, link,
+		"🔗 <b>Invito per %s</b> (%s)\n\n<a href=\"%s\">%s</a>\n\n<i>%s · monouso</i>",
+		htmlpkg.EscapeString(in.Name), in.Role, link, link, expiry,
 	)
 
 	// Send the link directly to the manager's chat — bypasses LLM text generation,
 	// so the URL is never accidentally modified by the model.
 	if ctx.ChatID != 0 {
-		tg := telegram.New(t.botToken)
+		tg := newBot(t.botToken)
 		if err := tg.SendHTML(context.Background(), ctx.ChatID, htmlMsg); err != nil {
 			// Don't fail the tool call — the LLM can still relay the link as fallback
-			return fmt.Sprintf("✅ Invito creato per %s (%s), ma l'invio diretto è fallito.\nLink: %s\n⚠️ Il link scade tra 7 giorni ed è monouso.", in.Name, in.Role, link), nil
+			return fmt.Sprintf("✅ Invito creato per %s (%s), ma l'invio diretto è fallito.\nLink: %s\n⚠️ %s, monouso.", in.Name, in.Role, link, expiry), nil
 		}
 	}
 
@@ -159,7 +256,7 @@ func dumpSchema(ctx context.Context, db *pgxpool.Pool) (string, error) {
 		SELECT table_name, column_name, data_type, column_default, is_nullable
 		FROM information_schema.columns
 		WHERE table_schema = 'public'
-		  AND table_name NOT IN ('user_credentials')
+		  AND table_name NOT IN ('user_credentials', 'countdown_notifications', 'planning_sessions', 'guest_documents')
 		  AND NOT (table_name = 'users' AND column_name IN ('pg_user', 'is_admin'))
 		ORDER BY table_name, ordinal_position
 	`)
@@ -203,7 +300,7 @@ func dumpSchema(ctx context.Context, db *pgxpool.Pool) (string, error) {
 		JOIN information_schema.constraint_column_usage ccu
 			ON tc.constraint_name = ccu.constraint_name AND tc.table_schema = ccu.table_schema
 		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = 'public'
-		  AND kcu.table_name NOT IN ('user_credentials')
+		  AND kcu.table_name NOT IN ('user_credentials', 'countdown_notifications', 'planning_sessions', 'guest_documents')
 		ORDER BY kcu.table_name, kcu.column_name
 	`)
 	if err != nil {
@@ -248,12 +345,15 @@ func dumpSchema(ctx context.Context, db *pgxpool.Pool) (string, error) {
 
 // ── execute_sql ──────────────────────────────────────────────────────────────
 
-type executeSQLTool struct{}
+type executeSQLTool struct {
+	botToken string
+}
 
 func (t *executeSQLTool) Def() llm.ToolDef {
 	return llm.ToolDef{
-		Name:        "execute_sql",
-		Description: "Execute an arbitrary SQL query against the database. Returns rows as text for SELECT, or affected row count for INSERT/UPDATE/DELETE.",
+		Name: "execute_sql",
+		Description: "Execute an arbitrary SQL query against the database. Returns rows as text for SELECT, or affected row count for INSERT/UPDATE/DELETE. " +
+			"A SELECT with many rows is sent to the chat as a CSV file and you get a summary with the first rows.",
 		Parameters: json.RawMessage(`{
 			"type": "object",
 			"properties": {
@@ -291,33 +391,11 @@ func (t *executeSQLTool) Execute(ctx agent.ToolContext, args json.RawMessage) (s
 		}
 		defer rows.Close()
 
-		fields := rows.FieldDescriptions()
-		headers := make([]string, len(fields))
-		for i, f := range fields {
-			headers[i] = string(f.Name)
-		}
-
-		var sb strings.Builder
-		sb.WriteString(strings.Join(headers, " | "))
-		sb.WriteString("\n" + strings.Repeat("-", 40) + "\n")
-
-		count := 0
-		for rows.Next() {
-			vals, err := rows.Values()
-			if err != nil {
-				return "", err
-			}
-			parts := make([]string, len(vals))
-			for i, v := range vals {
-				parts[i] = fmt.Sprintf("%v", v)
-			}
-			sb.WriteString(strings.Join(parts, " | ") + "\n")
-			count++
-		}
-		if count == 0 {
-			sb.WriteString("(no rows)\n")
+		rs, err := collectRows(rows)
+		if err != nil {
+			return "", err
 		}
-		return sb.String(), nil
+		return deliverRows(context.Background(), t.botToken, ctx.ChatID, rs, "query")
 	}
 
 	// INSERT / UPDATE / DELETE / DDL → exec
@@ -328,6 +406,54 @@ func (t *executeSQLTool) Execute(ctx agent.ToolContext, args json.RawMessage) (s
 	return fmt.Sprintf("OK — %d rows affected", tag.RowsAffected()), nil
 }
 
+// formatRows renders a result set as a pipe-separated text table, the format
+// the LLM sees for every SELECT. Shared by execute_sql and saved queries.
+func formatRows(rows pgx.Rows) (string, error) {
+	return formatRowsLimit(rows, 0)
+}
+
+// formatRowsLimit is formatRows showing at most limit rows (0 = all); the
+// rest are only counted.
+func formatRowsLimit(rows pgx.Rows, limit int) (string, error) {
+	fields := rows.FieldDescriptions()
+	headers := make([]string, len(fields))
+	for i, f := range fields {
+		headers[i] = string(f.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.Join(headers, " | "))
+	sb.WriteString("\n" + strings.Repeat("-", 40) + "\n")
+
+	count := 0
+	for rows.Next() {
+		if limit > 0 && count >= limit {
+			count++
+			continue
+		}
+		vals, err := rows.Values()
+		if err != nil {
+			return "", err
+		}
+		parts := make([]string, len(vals))
+		for i, v := range vals {
+			parts[i] = fmt.Sprintf("%v", v)
+		}
+		sb.WriteString(strings.Join(parts, " | ") + "\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if count == 0 {
+		sb.WriteString("(no rows)\n")
+	}
+	if limit > 0 && count > limit {
+		fmt.Fprintf(&sb, "(… %d more rows, %d in total)\n", count-limit, count)
+	}
+	return sb.String(), nil
+}
+
 // ── send_user_message ────────────────────────────────────────────────────────
 
 type sendUserMessageTool struct {
@@ -386,7 +512,7 @@ func (t *sendUserMessageTool) Execute(ctx agent.ToolContext, args json.RawMessag
 
 	switch to {
 	case "all":
-		query = `SELECT telegram_id, COALESCE(name, '') FROM users`
+		query = `SELECT telegram_id, COALESCE(name, '') FROM users WHERE role <> 'guest'`
 	case "manager", "cleaner":
 		query = `SELECT telegram_id, COALESCE(name, '') FROM users WHERE role = $1`
 		queryArgs = []any{to}
@@ -417,9 +543,9 @@ func (t *sendUserMessageTool) Execute(ctx agent.ToolContext, args json.RawMessag
 		return "⚠️ Nessun utente trovato per il destinatario specificato.", nil
 	}
 
-	tg := telegram.New(t.botToken)
+	tg := newBot(t.botToken)
 	var sent, failed int
-	var sentNames []string
+	var sentNames, unreachable []string
 
 	for _, r := range recipients {
 		// Look up recipient role to decide whether to publish a relay event.
@@ -431,6 +557,9 @@ func (t *sendUserMessageTool) Execute(ctx agent.ToolContext, args json.RawMessag
 		// In Telegram, the chat_id for a DM equals the user's telegram_id
 		if err := tg.Send(bg, r.telegramID, in.Message); err != nil {
 			failed++
+			if reach.check(r.telegramID) != nil {
+				unreachable = append(unreachable, r.name)
+			}
 		} else {
 			sent++
 			name := r.name
@@ -443,7 +572,7 @@ func (t *sendUserMessageTool) Execute(ctx agent.ToolContext, args json.RawMessag
 			// so their next LLM turn has full awareness of what was said to them.
 			if ctx.ContextInjector != nil {
 				ctx.ContextInjector.Inject(r.telegramID, llm.Message{
-					Role: "assistant",
+					Role:    "assistant",
 					Content: []llm.ContentBlock{{Type: "text", Text: in.Message}},
 				})
 			}
@@ -477,6 +606,10 @@ func (t *sendUserMessageTool) Execute(ctx agent.ToolContext, args json.RawMessag
 	if failed > 0 {
 		result += fmt.Sprintf("\n⚠️ %d invio/i fallito/i.", failed)
 	}
+	if len(unreachable) > 0 {
+		result += fmt.Sprintf("\n⛔ Non raggiungibili finché non scrivono al bot (bot bloccato o chat inesistente): %s. "+
+			"Il messaggio resta nel riepilogo che riceveranno allora.", strings.Join(unreachable, ", "))
+	}
 	return result, nil
 }
 
@@ -511,6 +644,10 @@ func (t *scheduleReminderTool) Def() llm.ToolDef {
 				"room_id": {
 					"type": "integer",
 					"description": "ID della stanza a cui si riferisce il reminder (opzionale, per contesto)"
+				},
+				"assignment_id": {
+					"type": "integer",
+					"description": "ID dell'assegnazione a cui si riferisce (opzionale). Il reminder viene annullato automaticamente quando l'assegnazione è completata, saltata o eliminata."
 				}
 			},
 			"required": ["fire_at", "message"]
@@ -520,10 +657,11 @@ func (t *scheduleReminderTool) Def() llm.ToolDef {
 
 func (t *scheduleReminderTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
 	var in struct {
-		FireAt  string `json:"fire_at"`
-		Message string `json:"message"`
-		To      string `json:"to"`
-		RoomID  *int64 `json:"room_id"`
+		FireAt       string `json:"fire_at"`
+		Message      string `json:"message"`
+		To           string `json:"to"`
+		RoomID       *int64 `json:"room_id"`
+		AssignmentID *int64 `json:"assignment_id"`
 	}
 	if err := json.Unmarshal(args, &in); err != nil {
 		return "", err
@@ -554,10 +692,29 @@ func (t *scheduleReminderTool) Execute(ctx agent.ToolContext, args json.RawMessa
 		chatID = recipientID
 	}
 
+	// An attached assignment must still be open, otherwise the reminder would
+	// be cancelled before it ever fires. Inherit its room when none is given.
+	if in.AssignmentID != nil {
+		var status string
+		var roomID int64
+		err := t.adminPool.QueryRow(context.Background(),
+			`SELECT status, room_id FROM assignments WHERE id = $1`, *in.AssignmentID,
+		).Scan(&status, &roomID)
+		if err != nil {
+			return "", fmt.Errorf("assegnazione %d non trovata", *in.AssignmentID)
+		}
+		if status == "done" || status == "skipped" {
+			return "", fmt.Errorf("assegnazione %d già chiusa (%s)", *in.AssignmentID, status)
+		}
+		if in.RoomID == nil {
+			in.RoomID = &roomID
+		}
+	}
+
 	_, err = t.adminPool.Exec(context.Background(),
-		`INSERT INTO reminders (fire_at, chat_id, message, room_id, created_by)
-		 VALUES ($1, $2, $3, $4, $5)`,
-		fireAt, chatID, in.Message, in.RoomID, ctx.UserID,
+		`INSERT INTO reminders (fire_at, chat_id, message, room_id, created_by, assignment_id)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		fireAt, chatID, in.Message, in.RoomID, ctx.UserID, in.AssignmentID,
 	)
 	if err != nil {
 		return "", fmt.Errorf("insert reminder: %w", err)
@@ -571,3 +728,265 @@ func (t *scheduleReminderTool) Execute(ctx agent.ToolContext, args json.RawMessa
 		fireAt.Format("02/01/2006"), fireAt.Format("15:04"), dest), nil
 }
 
+// ── maintenance tickets ──────────────────────────────────────────────────────
+//
+// Tickets are written through the caller's own pool, so RLS decides: anyone
+// can open a ticket as themselves, only managers can update or close one.
+
+type openTicketTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *openTicketTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "open_ticket",
+		Description: "Apre un ticket di manutenzione (guasto, danno, cosa da riparare). Tutti possono aprirlo. I ticket con severità high o urgent vengono notificati subito ai manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"description": {
+					"type": "string",
+					"description": "Cosa non funziona, in poche parole"
+				},
+				"room_id": {
+					"type": "integer",
+					"description": "ID della camera interessata (opzionale per aree comuni)"
+				},
+				"severity": {
+					"type": "string",
+					"enum": ["low", "normal", "high", "urgent"],
+					"description": "Gravità: urgent = camera inutilizzabile o rischio sicurezza. Default normal."
+				},
+				"photos": {
+					"type": "array",
+					"items": {"type": "string"},
+					"description": "Telegram file_id delle foto allegate (opzionale)"
+				},
+				"attachments": {
+					"type": "array",
+					"items": {"type": "integer"},
+					"description": "attachment_id delle foto inviate in chat, da allegare al ticket (opzionale)"
+				}
+			},
+			"required": ["description"]
+		}`),
+	}
+}
+
+func (t *openTicketTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Description string   `json:"description"`
+		RoomID      *int64   `json:"room_id"`
+		Severity    string   `json:"severity"`
+		Photos      []string `json:"photos"`
+		Attachments []int64  `json:"attachments"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(in.Description) == "" {
+		return "", fmt.Errorf("description is required")
+	}
+	if in.Severity == "" {
+		in.Severity = "normal"
+	}
+	if in.Photos == nil {
+		in.Photos = []string{}
+	}
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	// Stored photos join the ticket's file_ids: only managers may update a
+	// ticket, so they are resolved before the insert.
+	var attached int64
+	if len(in.Attachments) > 0 {
+		var fileIDs []string
+		if err := db.QueryRow(bg,
+			`SELECT COALESCE(array_agg(file_id ORDER BY id), '{}') FROM attachments
+			 WHERE id = ANY($1) AND uploaded_by = $2`, in.Attachments, ctx.UserID,
+		).Scan(&fileIDs); err != nil {
+			return "", fmt.Errorf("query attachments: %w", err)
+		}
+		in.Photos = append(in.Photos, fileIDs...)
+	}
+	var id int64
+	if err := db.QueryRow(bg,
+		`INSERT INTO maintenance_tickets (room_id, reporter, description, severity, photos)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		in.RoomID, ctx.UserID, in.Description, in.Severity, in.Photos,
+	).Scan(&id); err != nil {
+		return "", fmt.Errorf("insert ticket: %w", err)
+	}
+	if len(in.Attachments) > 0 {
+		tag, err := db.Exec(bg,
+			`UPDATE attachments SET ticket_id = $1 WHERE id = ANY($2) AND uploaded_by = $3`,
+			id, in.Attachments, ctx.UserID)
+		if err != nil {
+			return "", fmt.Errorf("link attachments: %w", err)
+		}
+		attached = tag.RowsAffected()
+	}
+
+	if in.Severity == "high" || in.Severity == "urgent" {
+		t.notifyManagers(ctx, id, in.RoomID, in.Severity, in.Description, in.Photos)
+	}
+	if attached > 0 {
+		return fmt.Sprintf("🔧 Ticket #%d aperto (severità: %s), %d foto allegate.", id, in.Severity, attached), nil
+	}
+	return fmt.Sprintf("🔧 Ticket #%d aperto (severità: %s).", id, in.Severity), nil
+}
+
+func (t *openTicketTool) notifyManagers(ctx agent.ToolContext, id int64, roomID *int64, severity, description string, photos []string) {
+	bg := context.Background()
+	var reporter, room string
+	_ = t.adminPool.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&reporter)
+	if roomID != nil {
+		_ = t.adminPool.QueryRow(bg, `SELECT name FROM rooms WHERE id = $1`, *roomID).Scan(&room)
+	}
+	where := "area comune"
+	if room != "" {
+		where = "camera " + room
+	}
+	msg := fmt.Sprintf("🚨 Ticket #%d (%s) — %s\n%s\nSegnalato da %s.", id, severity, where, description, reporter)
+
+	var hotelID int
+	if err := t.adminPool.QueryRow(bg, `SELECT hotel_id FROM maintenance_tickets WHERE id = $1`, id).Scan(&hotelID); err != nil {
+		return
+	}
+	managers, err := managerIDs(bg, t.adminPool, hotelID)
+	if err != nil {
+		return
+	}
+	tg := newBot(t.botToken)
+	for _, m := range managers {
+		if m == ctx.UserID {
+			continue
+		}
+		_ = tg.Send(bg, m, msg)
+		for _, p := range photos {
+			_ = sendPhoto(bg, t.botToken, m, p, fmt.Sprintf("Ticket #%d", id))
+		}
+	}
+}
+
+type listTicketsTool struct{}
+
+func (t *listTicketsTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "list_tickets",
+		Description: "Elenca i ticket di manutenzione. Di default mostra solo quelli non chiusi, dal più grave.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"room_id": {
+					"type": "integer",
+					"description": "Filtra per camera (opzionale)"
+				},
+				"include_closed": {
+					"type": "boolean",
+					"description": "Includi anche i ticket chiusi (default false)"
+				}
+			}
+		}`),
+	}
+}
+
+func (t *listTicketsTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		RoomID        *int64 `json:"room_id"`
+		IncludeClosed bool   `json:"include_closed"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	rows, err := db.Query(context.Background(),
+		`SELECT t.id, COALESCE(r.name, '-') AS room, t.severity, t.status, t.description,
+		        u.name AS reporter, cardinality(t.photos) AS photos, t.created_at, t.resolved_at
+		 FROM maintenance_tickets t
+		 LEFT JOIN rooms r ON r.id = t.room_id
+		 JOIN users u ON u.telegram_id = t.reporter
+		 WHERE ($1::int IS NULL OR t.room_id = $1) AND ($2 OR t.status <> 'closed')
+		 ORDER BY t.status = 'closed', array_position(ARRAY['urgent','high','normal','low'], t.severity), t.created_at`,
+		in.RoomID, in.IncludeClosed,
+	)
+	if err != nil {
+		return "", fmt.Errorf("query tickets: %w", err)
+	}
+	return formatRows(rows)
+}
+
+type closeTicketTool struct {
+	adminPool *pgxpool.Pool
+	botToken  string
+}
+
+func (t *closeTicketTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name:        "close_ticket",
+		Description: "Chiude un ticket di manutenzione con una nota di risoluzione. Solo i manager possono chiudere i ticket. Chi l'ha aperto viene avvisato.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"ticket_id": {
+					"type": "integer",
+					"description": "ID del ticket"
+				},
+				"resolution": {
+					"type": "string",
+					"description": "Cosa è stato fatto"
+				}
+			},
+			"required": ["ticket_id"]
+		}`),
+	}
+}
+
+func (t *closeTicketTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		TicketID   int64  `json:"ticket_id"`
+		Resolution string `json:"resolution"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Zero rows means either no such open ticket or RLS refused the update.
+	var reporter int64
+	var description string
+	err = db.QueryRow(context.Background(),
+		`UPDATE maintenance_tickets
+		 SET status = 'closed', resolved_at = now(), resolved_by = $2, resolution = NULLIF($3, '')
+		 WHERE id = $1 AND status <> 'closed'
+		 RETURNING reporter, description`,
+		in.TicketID, ctx.UserID, in.Resolution,
+	).Scan(&reporter, &description)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("ticket #%d non trovato, già chiuso, o permesso negato (solo i manager possono chiudere i ticket)", in.TicketID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("close ticket: %w", err)
+	}
+
+	if reporter != ctx.UserID {
+		msg := fmt.Sprintf("✅ Il ticket #%d (%s) è stato chiuso.", in.TicketID, description)
+		if in.Resolution != "" {
+			msg += "\n" + in.Resolution
+		}
+		_ = newBot(t.botToken).Send(context.Background(), reporter, msg)
+	}
+	return fmt.Sprintf("✅ Ticket #%d chiuso.", in.TicketID), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+)
+
+// /topic lets a user keep long-running discussions ("ristrutturazione piano
+// 2") apart from day-to-day operations in the same chat:
+//
+//	/topic                 show the active topic and the ones opened so far
+//	/topic <name>          switch to (or open) a topic
+//	/topic off             back to the chat's main conversation
+//
+// Each topic is its own conversation (see chatContexts), with its own history
+// window and session file, so switching back resumes where it was left.
+// Topics live in memory: after a restart the list starts empty, but opening a
+// topic with the same name continues the same session file. System events
+// (heartbeat, notifications) always go to the main conversation.
+
+// topicMaxLen bounds a topic name, in runes.
+const topicMaxLen = 60
+
+type topicCommand struct {
+	botToken string
+	contexts *chatContexts
+}
+
+// Register wires /topic.
+func (t *topicCommand) Register(m *routedMessenger) {
+	m.Handle("/topic", t.handleCommand)
+}
+
+func (t *topicCommand) handleCommand(ctx context.Context, u agent.Update) error {
+	tg := newBot(t.botToken)
+	arg := strings.TrimPrefix(u.Text, "/topic")
+	if strings.HasPrefix(arg, "@") { // "/topic@bot name" in groups
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	name := strings.Join(strings.Fields(strings.ToLower(arg)), " ")
+	if r := []rune(name); len(r) > topicMaxLen {
+		name = string(r[:topicMaxLen])
+	}
+	current := t.contexts.Topic(u.UserID, u.ChatID)
+
+	switch name {
+	case "":
+		var sb strings.Builder
+		if current == "" {
+			sb.WriteString("💬 Sei nella conversazione principale.")
+		} else {
+			fmt.Fprintf(&sb, "💬 Argomento attivo: «%s».", current)
+		}
+		if topics := t.contexts.Topics(u.UserID, u.ChatID); len(topics) > 0 {
+			sb.WriteString("\nArgomenti aperti:")
+			for _, topic := range topics {
+				fmt.Fprintf(&sb, "\n• %s", topic)
+			}
+		}
+		sb.WriteString("\n\n/topic <nome> apre o riprende un argomento, /topic off torna alla conversazione principale.")
+		return tg.Send(ctx, u.ChatID, sb.String())
+	case "off", "-":
+		if current == "" {
+			return tg.Send(ctx, u.ChatID, "💬 Sei già nella conversazione principale.")
+		}
+		t.contexts.SetTopic(u.UserID, u.ChatID, "")
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("💬 Argomento «%s» sospeso, torni alla conversazione principale.", current))
+	}
+	if name == current {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("💬 Sei già in «%s».", name))
+	}
+	resumed := false
+	for _, topic := range t.contexts.Topics(u.UserID, u.ChatID) {
+		resumed = resumed || topic == name
+	}
+	t.contexts.SetTopic(u.UserID, u.ChatID, name)
+	if resumed {
+		return tg.Send(ctx, u.ChatID, fmt.Sprintf("💬 Riprendi «%s».", name))
+	}
+	return tg.Send(ctx, u.ChatID, fmt.Sprintf("💬 Nuovo argomento «%s»: la conversazione parte da zero. /topic off per tornare.", name))
+}
+
+// topicPrompt tells the model which topic the conversation of key is about;
+// empty outside topics.
+func (c *chatContexts) topicPrompt(key int64) string {
+	topic := c.Context(key).topic
+	if topic == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n## Current topic\n\nThis conversation is the topic %q the user opened with /topic. "+
+		"Keep to it; for unrelated day-to-day requests, answer briefly and suggest /topic off.", topic)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -16,12 +18,14 @@ type Role string
 const (
 	RoleManager Role = "manager"
 	RoleCleaner Role = "cleaner"
+	RoleGuest   Role = "guest" // invited for one reservation (guestaccess.go)
 )
 
 // UserRegistry manages per-user Postgres credentials and connection pools.
 type UserRegistry struct {
 	adminPool *pgxpool.Pool
 	dbURL     string
+	dryRun    bool // user pools are read-only (dryrun.go)
 	mu        sync.Mutex
 	pools     map[int64]*pgxpool.Pool
 }
@@ -30,11 +34,17 @@ func newUserRegistry(adminPool *pgxpool.Pool, dbURL string) *UserRegistry {
 	return &UserRegistry{
 		adminPool: adminPool,
 		dbURL:     dbURL,
+		dryRun:    dryRunEnabled(),
 		pools:     make(map[int64]*pgxpool.Pool),
 	}
 }
 
 // Pool returns the per-user connection pool. Opens it on first call.
+//
+// Callback handlers that write on a user's behalf (a manager's button press)
+// do it through this pool, not adminPool: RLS then decides what the user may
+// change, exactly as for their own tool calls, and a row it hides is simply
+// not touched.
 func (r *UserRegistry) Pool(ctx context.Context, telegramID int64) (*pgxpool.Pool, error) {
 	r.mu.Lock()
 	if p, ok := r.pools[telegramID]; ok {
@@ -64,9 +74,13 @@ func (r *UserRegistry) Pool(ctx context.Context, telegramID int64) (*pgxpool.Poo
 	return pool, nil
 }
 
-// Register creates a Postgres role and registers the user.
-func (r *UserRegistry) Register(ctx context.Context, telegramID int64, role Role, name string) error {
+// Register creates a Postgres role and registers the user at hotelID.
+// Guests get a guest_<id> role in m4d_guest instead of the staff grants.
+func (r *UserRegistry) Register(ctx context.Context, telegramID int64, role Role, name string, hotelID int) error {
 	pgUser := fmt.Sprintf("tg_%d", telegramID)
+	if role == RoleGuest {
+		pgUser = fmt.Sprintf("guest_%d", telegramID)
+	}
 	pgPassword, err := randomPassword()
 	if err != nil {
 		return fmt.Errorf("generate password: %w", err)
@@ -94,8 +108,71 @@ func (r *UserRegistry) Register(ctx context.Context, telegramID int64, role Role
 		fmt.Sprintf(`GRANT SELECT ON invites TO %s`, pgUser),
 		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON reservations TO %s`, pgUser),
 		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON reminders TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON content_templates TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON saved_queries TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT ON room_status_events TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT ON intent_metrics TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT ON assignment_conflicts TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE ON maintenance_tickets TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON booking_channels TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE ON lost_found TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON extras TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON reservation_extras TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON rates TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON rate_rules TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON knowledge_base TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON channel_feeds TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON guests TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON prompt_translations TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, UPDATE ON hotels TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON room_types TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, DELETE ON shadow_runs TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT ON invoices TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON payments TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON staff_absences TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON checklists TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON checklist_items TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT ON room_inspections TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON reviews TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON cleaning_standards TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, UPDATE ON attachments TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON supplies TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT ON supply_movements TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON minibar_items TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON minibar_consumption TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON compliance_templates TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON reminder_templates TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON compliance_tasks TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT ON temperature_logs TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON meter_readings TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON tips TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON guest_requests TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE ON incidents TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON shifts TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON shift_assignments TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON work_sessions TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON keys TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON parking_spots TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON hotel_info TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON room_blocks TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON dnd_log TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON recurring_tasks TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON hotel_settings TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, DELETE ON subscriptions TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON booking_groups TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON guest_message_templates TO %s`, pgUser),
+		fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE ON guest_messages TO %s`, pgUser),
 		fmt.Sprintf(`GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO %s`, pgUser),
 	}
+	if role == RoleGuest {
+		// Must match the m4d_guest section of db/rls.sql: the guest_stays
+		// view and nothing else.
+		grants = []string{
+			fmt.Sprintf(`GRANT CONNECT ON DATABASE m4dtimes TO %s`, pgUser),
+			fmt.Sprintf(`GRANT USAGE ON SCHEMA public TO %s`, pgUser),
+			fmt.Sprintf(`GRANT m4d_guest TO %s`, pgUser),
+		}
+	}
 	for _, g := range grants {
 		if _, err := r.adminPool.Exec(ctx, g); err != nil {
 			log.Printf("warn: grant for %s: %v", pgUser, err)
@@ -114,10 +191,10 @@ func (r *UserRegistry) Register(ctx context.Context, telegramID int64, role Role
 
 	// Upsert into users table
 	_, err = r.adminPool.Exec(ctx,
-		`INSERT INTO users (telegram_id, pg_user, name, role)
-		 VALUES ($1, $2, $3, $4)
-		 ON CONFLICT (telegram_id) DO UPDATE SET pg_user=$2, name=$3, role=$4`,
-		telegramID, pgUser, name, string(role),
+		`INSERT INTO users (telegram_id, pg_user, name, role, hotel_id, timezone)
+		 VALUES ($1, $2, $3, $4, $5, (SELECT timezone FROM hotels WHERE id = $5))
+		 ON CONFLICT (telegram_id) DO UPDATE SET pg_user=$2, name=$3, role=$4, hotel_id=$5`,
+		telegramID, pgUser, name, string(role), hotelID,
 	)
 	if err != nil {
 		return fmt.Errorf("upsert user: %w", err)
@@ -134,7 +211,7 @@ func (r *UserRegistry) Register(ctx context.Context, telegramID int64, role Role
 		return fmt.Errorf("upsert credentials: %w", err)
 	}
 
-	log.Printf("registered user %d (%s) as %s role=%s", telegramID, name, pgUser, role)
+	log.Printf("registered user %d (%s) as %s role=%s hotel=%d", telegramID, name, pgUser, role, hotelID)
 	return nil
 }
 
@@ -147,6 +224,43 @@ func (r *UserRegistry) IsRegistered(ctx context.Context, telegramID int64) bool
 	return exists
 }
 
+// Role returns the user's role, or "" if they are not registered.
+func (r *UserRegistry) Role(ctx context.Context, telegramID int64) Role {
+	var role string
+	r.adminPool.QueryRow(ctx,
+		`SELECT role FROM users WHERE telegram_id=$1`, telegramID,
+	).Scan(&role)
+	return Role(role)
+}
+
+// managerIDs returns the telegram_id of every manager of property hotelID.
+func managerIDs(ctx context.Context, pool *pgxpool.Pool, hotelID int) ([]int64, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT telegram_id FROM users WHERE role = 'manager' AND hotel_id = $1 ORDER BY telegram_id`, hotelID)
+	if err != nil {
+		return nil, fmt.Errorf("query managers: %w", err)
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// hotelOf returns the property user telegramID works at (or stays at).
+func hotelOf(ctx context.Context, pool *pgxpool.Pool, telegramID int64) (int, error) {
+	var id int
+	if err := pool.QueryRow(ctx, `SELECT hotel_id FROM users WHERE telegram_id = $1`, telegramID).Scan(&id); err != nil {
+		return 0, fmt.Errorf("hotel of %d: %w", telegramID, err)
+	}
+	return id, nil
+}
+
 func (r *UserRegistry) openUserPool(ctx context.Context, pgUser, pgPassword string) (*pgxpool.Pool, error) {
 	cfg, err := pgxpool.ParseConfig(r.dbURL)
 	if err != nil {
@@ -155,6 +269,9 @@ func (r *UserRegistry) openUserPool(ctx context.Context, pgUser, pgPassword stri
 	cfg.ConnConfig.User = pgUser
 	cfg.ConnConfig.Password = pgPassword
 	cfg.MaxConns = 3
+	if r.dryRun {
+		cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
@@ -177,13 +294,15 @@ func randomPassword() (string, error) {
 
 // InviteInfo holds the data embedded in an invite row.
 type InviteInfo struct {
-	Token string
-	Role  Role
-	Name  string
+	Token         string
+	Role          Role
+	Name          string
+	HotelID       int
+	ReservationID int64 // guest invites only
 }
 
 // CreateInvite generates a one-time invite token and stores it in the DB.
-// Returns the token on success.
+// The invitee joins the creator's property. Returns the token on success.
 func (r *UserRegistry) CreateInvite(ctx context.Context, createdBy int64, role Role, name string) (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -192,8 +311,8 @@ func (r *UserRegistry) CreateInvite(ctx context.Context, createdBy int64, role R
 	token := hex.EncodeToString(b)
 
 	_, err := r.adminPool.Exec(ctx,
-		`INSERT INTO invites (token, role, name, created_by)
-		 VALUES ($1, $2, $3, $4)`,
+		`INSERT INTO invites (token, role, name, created_by, hotel_id)
+		 VALUES ($1, $2, $3, $4, (SELECT hotel_id FROM users WHERE telegram_id = $4))`,
 		token, string(role), name, createdBy,
 	)
 	if err != nil {
@@ -202,16 +321,44 @@ func (r *UserRegistry) CreateInvite(ctx context.Context, createdBy int64, role R
 	return token, nil
 }
 
+// CreateGuestInvite generates a one-time invite for the guest of a
+// reservation: it joins the reservation's property and expires at checkout.
+// Returns the token and the guest's name.
+func (r *UserRegistry) CreateGuestInvite(ctx context.Context, createdBy, reservationID int64) (string, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	var name string
+	err := r.adminPool.QueryRow(ctx,
+		`INSERT INTO invites (token, role, name, created_by, hotel_id, reservation_id, expires_at)
+		 SELECT $1, 'guest', COALESCE(NULLIF(guest_name, ''), 'Ospite'), $2, hotel_id, id, checkout_at
+		 FROM reservations
+		 WHERE id = $3 AND status IN ('confirmed', 'option') AND checkout_at > now()
+		 RETURNING name`,
+		token, createdBy, reservationID,
+	).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", fmt.Errorf("reservation %d not found, cancelled or already over", reservationID)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("insert invite: %w", err)
+	}
+	return token, name, nil
+}
+
 // LookupInvite returns invite info if the token is valid, unused, and not expired.
 func (r *UserRegistry) LookupInvite(ctx context.Context, token string) (*InviteInfo, error) {
 	var info InviteInfo
 	err := r.adminPool.QueryRow(ctx,
-		`SELECT token, role, name FROM invites
+		`SELECT token, role, name, hotel_id, COALESCE(reservation_id, 0) FROM invites
 		 WHERE token = $1
 		   AND used_at IS NULL
 		   AND expires_at > now()`,
 		token,
-	).Scan(&info.Token, &info.Role, &info.Name)
+	).Scan(&info.Token, &info.Role, &info.Name, &info.HotelID, &info.ReservationID)
 	if err != nil {
 		return nil, fmt.Errorf("invite not found or expired")
 	}
@@ -224,8 +371,12 @@ func (r *UserRegistry) UseInvite(ctx context.Context, token string, telegramID i
 	if err != nil {
 		return nil, err
 	}
+	// A guest link must not turn a member of staff into a guest.
+	if current := r.Role(ctx, telegramID); info.Role == RoleGuest && current != "" && current != RoleGuest {
+		return nil, fmt.Errorf("user %d is already registered as %s", telegramID, current)
+	}
 
-	if err := r.Register(ctx, telegramID, info.Role, info.Name); err != nil {
+	if err := r.Register(ctx, telegramID, info.Role, info.Name, info.HotelID); err != nil {
 		return nil, fmt.Errorf("register user: %w", err)
 	}
 
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// VIP guests and special instructions ("champagne all'arrivo", "non
+// disturbare prima delle 11"). The flag and the instructions live on the
+// guest profile, for every stay, and on the reservation, for one stay; the
+// reservations_inherit_guest_vip trigger copies the profile's onto each new
+// booking, since cleaners cannot read guests. The morning brief of the daily
+// plan shows them under the room (vipNotes), and mark_vip tells the cleaner
+// already assigned to the room today.
+
+// vipNotes returns, per room, the VIP flag and special instructions of the
+// stays touching day, labelled with whether the guest arrives, stays or
+// leaves.
+func vipNotes(ctx context.Context, db querier, day time.Time, roomIDs []int64) (map[int64][]string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT res.room_id, res.vip, COALESCE(res.special_instructions, ''),
+		        CASE WHEN (res.checkin_at AT TIME ZONE 'Europe/Rome')::date = $1 THEN 'in arrivo'
+		             WHEN (res.checkout_at AT TIME ZONE 'Europe/Rome')::date = $1 THEN 'in partenza'
+		             ELSE 'in camera' END
+		 FROM reservations res
+		 WHERE res.room_id = ANY($2) AND res.status = 'confirmed'
+		   AND (res.vip OR COALESCE(res.special_instructions, '') <> '')
+		   AND (res.checkin_at AT TIME ZONE 'Europe/Rome')::date <= $1
+		   AND (res.checkout_at AT TIME ZONE 'Europe/Rome')::date >= $1
+		 ORDER BY res.checkin_at`, day, roomIDs)
+	if err != nil {
+		return nil, fmt.Errorf("query vip notes: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[int64][]string)
+	for rows.Next() {
+		var roomID int64
+		var vip bool
+		var instructions, when string
+		if err := rows.Scan(&roomID, &vip, &instructions, &when); err != nil {
+			return nil, err
+		}
+		out[roomID] = append(out[roomID], vipLabel(vip, instructions, when))
+	}
+	return out, rows.Err()
+}
+
+// vipLabel is "⭐ Ospite VIP in arrivo: fiori in camera" or, without the
+// flag, "📝 Ospite in camera: non disturbare prima delle 11".
+func vipLabel(vip bool, instructions, when string) string {
+	label := "📝 Ospite " + when
+	if vip {
+		label = "⭐ Ospite VIP " + when
+	}
+	if instructions != "" {
+		label += ": " + instructions
+	}
+	return label
+}
+
+// ── mark_vip ─────────────────────────────────────────────────────────────────
+
+type markVIPTool struct {
+	g *GuestRequests
+}
+
+func (t *markVIPTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "mark_vip",
+		Description: "Segna un ospite come VIP (o toglie il flag) e registra le istruzioni speciali per lo staff " +
+			"(es. 'champagne all'arrivo', 'pulizia solo dopo le 11'). Con guest/guest_id vale per il profilo: tutti i " +
+			"soggiorni in corso e futuri e quelli prenotati dopo. Con room/reservation_id vale per quel soggiorno. " +
+			"Compare nel programma mattutino delle cameriere; chi pulisce la camera oggi viene avvisato. Solo per i manager.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"guest": {"type": "string", "description": "Nome esatto del profilo ospite"},
+				"guest_id": {"type": "integer", "description": "ID del profilo ospite (da find_guest)"},
+				"room": {"type": "string", "description": "Camera: vale per il soggiorno in corso o il prossimo"},
+				"reservation_id": {"type": "integer", "description": "Prenotazione (in alternativa a room)"},
+				"vip": {"type": "boolean", "description": "false toglie il flag VIP (default true)"},
+				"special_instructions": {"type": "string", "description": "Istruzioni per lo staff; stringa vuota le cancella"}
+			}
+		}`),
+	}
+}
+
+func (t *markVIPTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Guest         string  `json:"guest"`
+		GuestID       int64   `json:"guest_id"`
+		Room          string  `json:"room"`
+		ReservationID int64   `json:"reservation_id"`
+		VIP           *bool   `json:"vip"`
+		Instructions  *string `json:"special_instructions"`
+	}
+	if err := json.Unmarshal(args, &in); err != nil {
+		return "", err
+	}
+	byGuest := in.GuestID != 0 || strings.TrimSpace(in.Guest) != ""
+	byStay := in.ReservationID != 0 || strings.TrimSpace(in.Room) != ""
+	if byGuest == byStay {
+		return "", fmt.Errorf("give either guest/guest_id or room/reservation_id")
+	}
+	vip := in.VIP == nil || *in.VIP
+	// setInstr: the instructions are replaced (cleared when empty).
+	setInstr := in.Instructions != nil
+	var instr string
+	if setInstr {
+		instr = strings.TrimSpace(*in.Instructions)
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	var manager bool
+	if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+		return "", fmt.Errorf("mark_vip is only available to managers")
+	}
+
+	type stay struct {
+		id     int64
+		roomID int64
+		room   string
+	}
+	var who string
+	var stays []stay
+	err = pgx.BeginFunc(bg, db, func(tx pgx.Tx) error {
+		where := `WHERE res.id = $1`
+		params := []any{in.ReservationID}
+		if byGuest {
+			g, ambiguous, err := resolveGuest(bg, tx, in.GuestID, in.Guest, "")
+			if err != nil {
+				return err
+			}
+			if len(ambiguous) > 0 {
+				var names []string
+				for _, a := range ambiguous {
+					names = append(names, fmt.Sprintf("%s (ID %d)", a.name, a.id))
+				}
+				return fmt.Errorf("più profili si chiamano %q, indica guest_id: %s", in.Guest, strings.Join(names, ", "))
+			}
+			if g == nil {
+				return fmt.Errorf("nessun profilo ospite si chiama %q (cerca con find_guest)", in.Guest)
+			}
+			if _, err := tx.Exec(bg,
+				`UPDATE guests SET vip = $2, special_instructions = CASE WHEN $3 THEN NULLIF($4, '') ELSE special_instructions END
+				 WHERE id = $1`, g.id, vip, setInstr, instr); err != nil {
+				return fmt.Errorf("update guest: %w", err)
+			}
+			who = g.name
+			where = `WHERE res.guest_id = $1`
+			params = []any{g.id}
+		} else if in.ReservationID == 0 {
+			where = `WHERE res.id = (SELECT x.id FROM reservations x JOIN rooms r ON r.id = x.room_id
+			          WHERE lower(r.name) = lower($1) AND x.status IN ('confirmed', 'option')
+			            AND x.checkout_at >= (date_trunc('day', now() AT TIME ZONE 'Europe/Rome') AT TIME ZONE 'Europe/Rome')
+			          ORDER BY x.checkin_at LIMIT 1)`
+			params = []any{strings.TrimSpace(in.Room)}
+		}
+		// The profile's stays in progress and to come follow it; past ones keep their history.
+		rows, err := tx.Query(bg,
+			`UPDATE reservations res SET vip = $2,
+			        special_instructions = CASE WHEN $3 THEN NULLIF($4, '') ELSE res.special_instructions END
+			 FROM rooms r
+			 `+where+` AND r.id = res.room_id AND res.status IN ('confirmed', 'option')
+			   AND res.checkout_at >= (date_trunc('day', now() AT TIME ZONE 'Europe/Rome') AT TIME ZONE 'Europe/Rome')
+			 RETURNING res.id, r.id, r.name, COALESCE(res.guest_name, '')`,
+			append(params, vip, setInstr, instr)...)
+		if err != nil {
+			return fmt.Errorf("update reservations: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var s stay
+			var guest string
+			if err := rows.Scan(&s.id, &s.roomID, &s.room, &guest); err != nil {
+				return err
+			}
+			if who == "" {
+				who = guest
+			}
+			stays = append(stays, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return "", err
+	}
+	if byStay && len(stays) == 0 {
+		if in.ReservationID != 0 {
+			return "", fmt.Errorf("prenotazione %d non trovata, conclusa o annullata", in.ReservationID)
+		}
+		return "", fmt.Errorf("nessuna prenotazione in corso o futura per la camera %s", in.Room)
+	}
+	if who == "" {
+		who = "l'ospite"
+	}
+
+	var sb strings.Builder
+	if vip {
+		fmt.Fprintf(&sb, "⭐ %s è VIP", who)
+	} else {
+		fmt.Fprintf(&sb, "%s non è più VIP", who)
+	}
+	if instr != "" {
+		fmt.Fprintf(&sb, ", istruzioni: %s", instr)
+	} else if setInstr {
+		sb.WriteString(", istruzioni cancellate")
+	}
+	switch {
+	case byGuest && len(stays) == 0:
+		sb.WriteString(". Nessun soggiorno in corso o futuro: varrà per le prossime prenotazioni.")
+	case byGuest:
+		fmt.Fprintf(&sb, ". Aggiornati %d soggiorni in corso o futuri, e varrà per le prossime prenotazioni.", len(stays))
+	default:
+		fmt.Fprintf(&sb, " per il soggiorno #%d in camera %s.", stays[0].id, stays[0].room)
+	}
+
+	notified := 0
+	for _, s := range stays {
+		msg := fmt.Sprintf("⭐ Camera %s: ospite VIP.", s.room)
+		if !vip {
+			msg = fmt.Sprintf("Camera %s: l'ospite non è più VIP.", s.room)
+		}
+		if instr != "" {
+			msg += " Istruzioni: " + instr
+		}
+		notified += t.g.notifyCleaners(bg, s.roomID, ctx.UserID, msg)
+	}
+	if notified > 0 {
+		sb.WriteString(" Chi pulisce la camera oggi è stato avvisato.")
+	}
+	return sb.String(), nil
+}
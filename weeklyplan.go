@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/telegram"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WeeklyPlan compiles next week's provisional cleaning plan for every cleaner
+// and sends it on Sunday evening. Each plan message carries one button per day
+// ("wplan:<YYYY-MM-DD>") so the cleaner can flag a conflict; flags are routed
+// to the managers as a DM plus a relay event on the bus.
+//
+// Configure via env:
+//
+//	WEEKLY_PLAN_TIME=19:00   Sunday send time, Europe/Rome (empty/invalid disables)
+type WeeklyPlan struct {
+	adminPool *pgxpool.Pool
+	registry  *UserRegistry
+	botToken  string
+	bus       agent.EventBus
+}
+
+func newWeeklyPlan(adminPool *pgxpool.Pool, registry *UserRegistry, botToken string, bus agent.EventBus) *WeeklyPlan {
+	return &WeeklyPlan{adminPool: adminPool, registry: registry, botToken: botToken, bus: bus}
+}
+
+// Register wires the conflict buttons into the messenger.
+func (w *WeeklyPlan) Register(m *routedMessenger) {
+	m.Handle("wplan:", w.handleConflict)
+}
+
+// Start launches the Sunday-evening producer goroutine.
+func (w *WeeklyPlan) Start(ctx context.Context) {
+	timeStr := envOr("WEEKLY_PLAN_TIME", "19:00")
+	hour, min, ok := parseClock(timeStr)
+	if !ok {
+		log.Printf("weekly plan: disabled (WEEKLY_PLAN_TIME=%q)", timeStr)
+		return
+	}
+	loc, _ := time.LoadLocation("Europe/Rome")
+
+	go func() {
+		for {
+			now := time.Now().In(loc)
+			daysUntilSunday := (7 - int(now.Weekday())) % 7
+			next := time.Date(now.Year(), now.Month(), now.Day()+daysUntilSunday, hour, min, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 7)
+			}
+			log.Printf("weekly plan: next run at %s", next.Format("2006-01-02 15:04 MST"))
+			select {
+			case <-ctx.Done():
+				log.Printf("weekly plan: stopped")
+				return
+			case <-time.After(time.Until(next)):
+			}
+			monday := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+			if err := w.publish(ctx, monday); err != nil {
+				log.Printf("weekly plan: %v", err)
+			}
+		}
+	}()
+}
+
+type planItem struct {
+	date     time.Time
+	shift    string
+	kind     string
+	roomName string
+}
+
+// publish sends the plan for the week starting on monday to every cleaner,
+// with the departures forecast of their own property.
+func (w *WeeklyPlan) publish(ctx context.Context, monday time.Time) error {
+	sunday := monday.AddDate(0, 0, 6)
+
+	rows, err := w.adminPool.Query(ctx,
+		`SELECT a.cleaner_id, a.date, a.shift, a.type, r.name
+		 FROM assignments a JOIN rooms r ON r.id = a.room_id
+		 WHERE a.date BETWEEN $1 AND $2 AND a.status IN ('pending', 'in_progress')
+		 ORDER BY a.date, a.shift, r.name`, monday, sunday,
+	)
+	if err != nil {
+		return fmt.Errorf("query assignments: %w", err)
+	}
+	plans := make(map[int64][]planItem)
+	for rows.Next() {
+		var cleanerID int64
+		var it planItem
+		if err := rows.Scan(&cleanerID, &it.date, &it.shift, &it.kind, &it.roomName); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan assignment: %w", err)
+		}
+		plans[cleanerID] = append(plans[cleanerID], it)
+	}
+	rows.Close()
+
+	// Forecast: departures per property and day (each one is a checkout
+	// clean to staff).
+	forecast := make(map[int]map[string]int)
+	fRows, err := w.adminPool.Query(ctx,
+		`SELECT hotel_id, (checkout_at AT TIME ZONE 'Europe/Rome')::date AS d, count(*)
+		 FROM reservations
+		 WHERE status = 'confirmed' AND (checkout_at AT TIME ZONE 'Europe/Rome')::date BETWEEN $1 AND $2
+		 GROUP BY hotel_id, d`, monday, sunday,
+	)
+	if err != nil {
+		return fmt.Errorf("query forecast: %w", err)
+	}
+	for fRows.Next() {
+		var hotelID, n int
+		var d time.Time
+		if err := fRows.Scan(&hotelID, &d, &n); err != nil {
+			fRows.Close()
+			return fmt.Errorf("scan forecast: %w", err)
+		}
+		if forecast[hotelID] == nil {
+			forecast[hotelID] = make(map[string]int)
+		}
+		forecast[hotelID][d.Format("2006-01-02")] = n
+	}
+	fRows.Close()
+
+	cRows, err := w.adminPool.Query(ctx,
+		`SELECT telegram_id, COALESCE(name, ''), hotel_id FROM users WHERE role = 'cleaner'`)
+	if err != nil {
+		return fmt.Errorf("query cleaners: %w", err)
+	}
+	type cleaner struct {
+		id      int64
+		name    string
+		hotelID int
+	}
+	var cleaners []cleaner
+	for cRows.Next() {
+		var c cleaner
+		if err := cRows.Scan(&c.id, &c.name, &c.hotelID); err != nil {
+			cRows.Close()
+			return fmt.Errorf("scan cleaner: %w", err)
+		}
+		cleaners = append(cleaners, c)
+	}
+	cRows.Close()
+
+	for _, c := range cleaners {
+		text := formatWeeklyPlan(c.name, monday, plans[c.id], forecast[c.hotelID])
+		if _, err := sendKeyboard(ctx, w.botToken, c.id, text, conflictButtons(monday)); err != nil {
+			log.Printf("weekly plan: send to %d: %v", c.id, err)
+			continue
+		}
+	}
+	log.Printf("weekly plan: sent week of %s to %d cleaner(s)", monday.Format("2006-01-02"), len(cleaners))
+	return nil
+}
+
+func formatWeeklyPlan(name string, monday time.Time, items []planItem, forecast map[string]int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🗓 <b>Piano provvisorio — settimana dal %s</b>\n", monday.Format("02/01"))
+	if name != "" {
+		fmt.Fprintf(&sb, "Ciao %s, ecco cosa è previsto per te:\n", name)
+	}
+	for i := 0; i < 7; i++ {
+		day := monday.AddDate(0, 0, i)
+		key := day.Format("2006-01-02")
+		fmt.Fprintf(&sb, "\n<b>%s %s</b>", italianWeekday(day.Weekday()), day.Format("02/01"))
+		if n := forecast[key]; n > 0 {
+			fmt.Fprintf(&sb, " <i>(%d partenze previste)</i>", n)
+		}
+		sb.WriteString("\n")
+		found := false
+		for _, it := range items {
+			if it.date.Format("2006-01-02") == key {
+				fmt.Fprintf(&sb, "  • %s — camera %s (%s)\n", it.shift, it.roomName, it.kind)
+				found = true
+			}
+		}
+		if !found {
+			sb.WriteString("  —\n")
+		}
+	}
+	sb.WriteString("\nIl piano può ancora cambiare. Se un giorno non puoi, premi il bottone corrispondente: avviso il manager.")
+	return sb.String()
+}
+
+// conflictButtons returns two rows of day buttons (Mon–Thu, Fri–Sun).
+func conflictButtons(monday time.Time) [][]telegram.Button {
+	var first, second []telegram.Button
+	for i := 0; i < 7; i++ {
+		day := monday.AddDate(0, 0, i)
+		b := telegram.Button{
+			Text:         "⚠️ " + italianWeekday(day.Weekday())[:3],
+			CallbackData: "wplan:" + day.Format("2006-01-02"),
+		}
+		if i < 4 {
+			first = append(first, b)
+		} else {
+			second = append(second, b)
+		}
+	}
+	return [][]telegram.Button{first, second}
+}
+
+// handleConflict routes a cleaner's conflict flag to every manager.
+func (w *WeeklyPlan) handleConflict(ctx context.Context, u agent.Update) error {
+	if !w.registry.IsRegistered(ctx, u.UserID) {
+		return fmt.Errorf("user %d not registered", u.UserID)
+	}
+	day, err := time.Parse("2006-01-02", strings.TrimPrefix(u.Text, "wplan:"))
+	if err != nil {
+		return fmt.Errorf("bad date: %w", err)
+	}
+
+	var name string
+	var hotelID int
+	_ = w.adminPool.QueryRow(ctx,
+		`SELECT COALESCE(name, ''), hotel_id FROM users WHERE telegram_id = $1`, u.UserID,
+	).Scan(&name, &hotelID)
+	if name == "" {
+		name = fmt.Sprintf("utente %d", u.UserID)
+	}
+	msg := fmt.Sprintf("⚠️ %s segnala un conflitto con il piano pulizie di %s %s. Contattalo/a per riorganizzare.",
+		name, italianWeekday(day.Weekday()), day.Format("02/01"))
+
+	managers, err := managerIDs(ctx, w.adminPool, hotelID)
+	if err != nil {
+		return err
+	}
+
+	tg := newBot(w.botToken)
+	for _, m := range managers {
+		if err := tg.Send(ctx, m, msg); err != nil {
+			log.Printf("weekly plan: notify manager %d: %v", m, err)
+			continue
+		}
+		if w.bus != nil {
+			w.bus.Publish(agent.AgentEvent{
+				Kind:     agent.EventRelay,
+				TargetID: m,
+				ChatID:   m,
+				Content:  msg,
+				Source:   name,
+				EventID:  generateUUID(),
+			})
+		}
+	}
+	return tg.Send(ctx, u.ChatID, fmt.Sprintf("✅ Ho avvisato il manager del conflitto di %s %s.",
+		italianWeekday(day.Weekday()), day.Format("02/01")))
+}
+
+func italianWeekday(d time.Weekday) string {
+	return [...]string{"Domenica", "Lunedì", "Martedì", "Mercoledì", "Giovedì", "Venerdì", "Sabato"}[d]
+}
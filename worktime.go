@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmorn/m4dtimes/sdk/agent"
+	"github.com/dmorn/m4dtimes/sdk/llm"
+	"github.com/jackc/pgx/v5"
+)
+
+// Clock-in / clock-out. Each work_sessions row is one stretch of work, open
+// until clock_out stamps ended_at; a person has at most one open session.
+// Staff clock themselves, at most clockGrace in the past (RLS enforces it
+// too); managers clock anyone at any time and fix sessions with execute_sql.
+// Days with sessions replace the measure from the assignments in hours.go,
+// so the weekly alerts and payroll_export use clocked time where there is
+// any; timesheet shows a month day by day.
+
+// clockGrace is how late staff may clock a time ("sono entrata alle 7").
+const clockGrace = 15 * time.Minute
+
+// clockTime reads "" (now), "HH:MM" (today) or "YYYY-MM-DD HH:MM".
+func clockTime(at string, now time.Time) (time.Time, error) {
+	at = strings.TrimSpace(at)
+	if at == "" {
+		return now, nil
+	}
+	loc := now.Location()
+	if h, m, ok := parseClock(at); ok {
+		return time.Date(now.Year(), now.Month(), now.Day(), h, m, 0, 0, loc), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", at, loc)
+	if err != nil {
+		return t, fmt.Errorf("at must be HH:MM or YYYY-MM-DD HH:MM")
+	}
+	return t, nil
+}
+
+// clockTarget resolves whose session a clock tool writes: the caller, or
+// (managers only) staff. It also checks at against clockGrace for staff.
+func clockTarget(ctx agent.ToolContext, db querier, staff string, at time.Time, now time.Time) (int64, string, error) {
+	bg := context.Background()
+	var manager bool
+	_ = db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager)
+	if at.After(now.Add(time.Minute)) {
+		return 0, "", fmt.Errorf("cannot clock a time in the future")
+	}
+	if strings.TrimSpace(staff) != "" {
+		if !manager {
+			return 0, "", fmt.Errorf("only managers can clock other people")
+		}
+		return findStaff(bg, db, staff)
+	}
+	if !manager && at.Before(now.Add(-clockGrace)) {
+		return 0, "", fmt.Errorf("you can clock at most %d minutes back: ask a manager to fix it", int(clockGrace.Minutes()))
+	}
+	var name string
+	_ = db.QueryRow(bg, `SELECT COALESCE(name, '') FROM users WHERE telegram_id = $1`, ctx.UserID).Scan(&name)
+	return ctx.UserID, name, nil
+}
+
+var clockParams = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"at": {"type": "string", "description": "Orario HH:MM di oggi o YYYY-MM-DD HH:MM (default adesso; per il personale al massimo 15 minuti fa)"},
+		"staff": {"type": "string", "description": "Solo manager: nome della persona da timbrare"},
+		"note": {"type": "string", "description": "Nota facoltativa (solo clock_out)"}
+	}
+}`)
+
+// ── clock_in ─────────────────────────────────────────────────────────────────
+
+type clockInTool struct{}
+
+func (t *clockInTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "clock_in",
+		Description: "Timbra l'entrata: apre il turno di lavoro di chi scrive (o, per i manager, di una persona " +
+			"indicata con staff, anche a un orario passato).",
+		Parameters: clockParams,
+	}
+}
+
+func (t *clockInTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		At    string `json:"at"`
+		Staff string `json:"staff"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	now := time.Now().In(romeLocation())
+	at, err := clockTime(in.At, now)
+	if err != nil {
+		return "", err
+	}
+	userID, name, err := clockTarget(ctx, db, in.Staff, at, now)
+	if err != nil {
+		return "", err
+	}
+	var open time.Time
+	err = db.QueryRow(bg,
+		`SELECT started_at FROM work_sessions WHERE user_id = $1 AND ended_at IS NULL`, userID).Scan(&open)
+	if err == nil {
+		return "", fmt.Errorf("%s è già entrato/a alle %s (%s): prima timbra l'uscita",
+			name, open.In(now.Location()).Format("15:04"), open.In(now.Location()).Format("02/01"))
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("query open session: %w", err)
+	}
+	if _, err := db.Exec(bg,
+		`INSERT INTO work_sessions (user_id, started_at, edited_by)
+		 VALUES ($1, $2, NULLIF(current_telegram_id(), $1))`, userID, at); err != nil {
+		return "", fmt.Errorf("clock in: %w", err)
+	}
+	if userID != ctx.UserID {
+		return fmt.Sprintf("🟢 Entrata di %s timbrata alle %s del %s.", name, at.Format("15:04"), at.Format("02/01")), nil
+	}
+	return fmt.Sprintf("🟢 Entrata timbrata alle %s. Buon lavoro!", at.Format("15:04")), nil
+}
+
+// ── clock_out ────────────────────────────────────────────────────────────────
+
+type clockOutTool struct{}
+
+func (t *clockOutTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "clock_out",
+		Description: "Timbra l'uscita: chiude il turno aperto con clock_in e dice le ore del giorno. I manager possono " +
+			"timbrare l'uscita di una persona con staff.",
+		Parameters: clockParams,
+	}
+}
+
+func (t *clockOutTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		At    string `json:"at"`
+		Staff string `json:"staff"`
+		Note  string `json:"note"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	at, err := clockTime(in.At, now)
+	if err != nil {
+		return "", err
+	}
+	userID, name, err := clockTarget(ctx, db, in.Staff, at, now)
+	if err != nil {
+		return "", err
+	}
+	var started time.Time
+	err = db.QueryRow(bg,
+		`UPDATE work_sessions
+		 SET ended_at = $2, note = COALESCE(NULLIF($3, ''), note),
+		     edited_by = COALESCE(NULLIF(current_telegram_id(), $1), edited_by)
+		 WHERE user_id = $1 AND ended_at IS NULL AND started_at < $2
+		 RETURNING started_at`, userID, at, strings.TrimSpace(in.Note)).Scan(&started)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("nessuna entrata aperta per %s prima delle %s: timbra prima l'entrata", name, at.Format("15:04"))
+	}
+	if err != nil {
+		return "", fmt.Errorf("clock out: %w", err)
+	}
+	started = started.In(loc)
+	day := time.Date(started.Year(), started.Month(), started.Day(), 0, 0, 0, 0, loc)
+	var total float64
+	_ = db.QueryRow(bg,
+		`SELECT COALESCE(sum(extract(epoch FROM ended_at - started_at)) / 3600, 0)::float8
+		 FROM work_sessions WHERE user_id = $1 AND ended_at IS NOT NULL AND started_at >= $2 AND started_at < $3`,
+		userID, day, day.AddDate(0, 0, 1)).Scan(&total)
+	who := "Uscita timbrata"
+	if userID != ctx.UserID {
+		who = "Uscita di " + name + " timbrata"
+	}
+	return fmt.Sprintf("🔴 %s alle %s (turno %s–%s, %s). Totale del %s: %s.", who, at.Format("15:04"),
+		started.Format("15:04"), at.Format("15:04"), formatHours(at.Sub(started).Hours()),
+		day.Format("02/01"), formatHours(total)), nil
+}
+
+// ── timesheet ────────────────────────────────────────────────────────────────
+
+type timesheetTool struct{}
+
+func (t *timesheetTool) Def() llm.ToolDef {
+	return llm.ToolDef{
+		Name: "timesheet",
+		Description: "Foglio ore del mese dalle timbrature: giorno per giorno entrate, uscite e ore, con il totale " +
+			"e le uscite dimenticate. I manager vedono quello di una persona o, con staff = 'all', il riepilogo di tutti; " +
+			"per il CSV del commercialista c'è payroll_export.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"month": {"type": "string", "description": "Mese YYYY-MM (default: mese corrente)"},
+				"staff": {"type": "string", "description": "Solo manager: nome della persona, o 'all' per tutti"}
+			}
+		}`),
+	}
+}
+
+func (t *timesheetTool) Execute(ctx agent.ToolContext, args json.RawMessage) (string, error) {
+	var in struct {
+		Month string `json:"month"`
+		Staff string `json:"staff"`
+	}
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &in); err != nil {
+			return "", err
+		}
+	}
+	loc := romeLocation()
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if in.Month != "" {
+		m, err := time.ParseInLocation("2006-01", in.Month, loc)
+		if err != nil {
+			return "", fmt.Errorf("month must be YYYY-MM: %w", err)
+		}
+		start = m
+	}
+	end := start.AddDate(0, 1, 0)
+
+	db, err := poolFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+	bg := context.Background()
+	userID, name := ctx.UserID, ""
+	if staff := strings.TrimSpace(in.Staff); staff != "" {
+		var manager bool
+		if err := db.QueryRow(bg, `SELECT is_manager()`).Scan(&manager); err != nil || !manager {
+			return "", fmt.Errorf("only managers can see other people's timesheets")
+		}
+		if strings.EqualFold(staff, "all") {
+			return t.summary(bg, db, start, end)
+		}
+		if userID, name, err = findStaff(bg, db, staff); err != nil {
+			return "", err
+		}
+	}
+
+	rows, err := db.Query(bg,
+		`SELECT started_at, ended_at, COALESCE(note, ''), edited_by IS NOT NULL
+		 FROM work_sessions WHERE user_id = $1 AND started_at >= $2 AND started_at < $3
+		 ORDER BY started_at`, userID, start, end)
+	if err != nil {
+		return "", fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	var total float64
+	days, open := 0, 0
+	lastDay := ""
+	for rows.Next() {
+		var started time.Time
+		var ended *time.Time
+		var note string
+		var edited bool
+		if err := rows.Scan(&started, &ended, &note, &edited); err != nil {
+			return "", err
+		}
+		started = started.In(loc)
+		if d := started.Format("2006-01-02"); d != lastDay {
+			lastDay = d
+			days++
+			fmt.Fprintf(&sb, "\n%s %s:", italianWeekday(started.Weekday())[:3], started.Format("02/01"))
+		}
+		if ended == nil {
+			open++
+			fmt.Fprintf(&sb, " %s–⚠️ uscita non timbrata", started.Format("15:04"))
+			continue
+		}
+		h := ended.Sub(started).Hours()
+		total += h
+		fmt.Fprintf(&sb, " %s–%s (%s)", started.Format("15:04"), ended.In(loc).Format("15:04"), formatHours(h))
+		if edited {
+			sb.WriteString(" ✏️")
+		}
+		if note != "" {
+			fmt.Fprintf(&sb, " «%s»", note)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	who := "Le tue timbrature"
+	if name != "" {
+		who = "Timbrature di " + name
+	}
+	month := start.Format("01/2006")
+	if days == 0 {
+		return fmt.Sprintf("%s di %s: nessuna.", who, month), nil
+	}
+	head := fmt.Sprintf("🕐 %s di %s: %d giorni, %s", who, month, days, formatHours(total))
+	if open > 0 {
+		head += fmt.Sprintf(", %d uscite da sistemare", open)
+	}
+	return head + "." + sb.String() + "\n(✏️ = timbrata o corretta da un manager)", nil
+}
+
+// summary is the manager's view of everyone's month.
+func (t *timesheetTool) summary(ctx context.Context, db querier, start, end time.Time) (string, error) {
+	rows, err := db.Query(ctx,
+		`SELECT COALESCE(u.name, u.telegram_id::text),
+		        count(DISTINCT (w.started_at AT TIME ZONE 'Europe/Rome')::date)::int,
+		        COALESCE(sum(extract(epoch FROM w.ended_at - w.started_at)) / 3600, 0)::float8,
+		        count(*) FILTER (WHERE w.ended_at IS NULL)::int
+		 FROM work_sessions w JOIN users u ON u.telegram_id = w.user_id
+		 WHERE w.started_at >= $1 AND w.started_at < $2
+		 GROUP BY u.telegram_id, u.name
+		 ORDER BY 1`, start, end)
+	if err != nil {
+		return "", fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	n := 0
+	for rows.Next() {
+		var name string
+		var days, open int
+		var hours float64
+		if err := rows.Scan(&name, &days, &hours, &open); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "\n• %s: %d giorni, %s", name, days, formatHours(hours))
+		if open > 0 {
+			fmt.Fprintf(&sb, " (⚠️ %d uscite non timbrate)", open)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	month := start.Format("01/2006")
+	if n == 0 {
+		return fmt.Sprintf("Nessuna timbratura a %s.", month), nil
+	}
+	return fmt.Sprintf("🕐 Timbrature di %s (%d persone):", month, n) + sb.String(), nil
+}